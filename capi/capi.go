@@ -0,0 +1,181 @@
+/*
+Command capi exposes the in-toto verifier as C shared library, so that
+non-Go ecosystems, e.g. C, Rust or Python via cffi, can embed it.  Build it
+with
+
+	go build -buildmode=c-shared -o libintoto.so ./capi
+
+and include in_toto.h, which declares the C ABI, instead of the header
+generated by the build.
+*/
+package main
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"unsafe"
+
+	intoto "github.com/in-toto/in-toto-golang/in_toto"
+)
+
+// Result codes of intoto_verify, see in_toto.h.
+const (
+	resultOK           = 0
+	resultInvalidInput = 1
+	resultVerification = 2
+	resultInternal     = 3
+)
+
+// errInvalidInput wraps errors of decoding the input of intoto_verify.
+var errInvalidInput = errors.New("invalid input")
+
+// errInternal wraps panics recovered in intoto_verify.
+var errInternal = errors.New("internal error")
+
+//export intoto_verify
+func intoto_verify(layout *C.char, layoutLen C.size_t,
+	links **C.char, linkLens *C.size_t, linkCount C.size_t,
+	keys **C.char, keyLens *C.size_t, keyCount C.size_t,
+	errOut **C.char) C.int {
+	err := recoverPanic(func() error {
+		layoutBytes, err := goBytes(layout, layoutLen)
+		if err != nil {
+			return fmt.Errorf("layout: %w", err)
+		}
+		linkBytes, err := goBytesSlice(links, linkLens, linkCount)
+		if err != nil {
+			return fmt.Errorf("link %w", err)
+		}
+		keyBytes, err := goBytesSlice(keys, keyLens, keyCount)
+		if err != nil {
+			return fmt.Errorf("key %w", err)
+		}
+		return verify(layoutBytes, linkBytes, keyBytes)
+	})
+	if err == nil {
+		return resultOK
+	}
+	if errOut != nil {
+		*errOut = C.CString(err.Error())
+	}
+	switch {
+	case errors.Is(err, errInvalidInput):
+		return resultInvalidInput
+	case errors.Is(err, errInternal):
+		return resultInternal
+	}
+	return resultVerification
+}
+
+/*
+recoverPanic calls the passed function and returns its error.  A panic of the
+function is returned as error wrapping errInternal, so that it does not
+abort the host process, which cannot recover Go panics.
+*/
+func recoverPanic(f func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", errInternal, r)
+		}
+	}()
+	return f()
+}
+
+//export intoto_free
+func intoto_free(message *C.char) {
+	C.free(unsafe.Pointer(message))
+}
+
+// bufferLength checks that the passed length of a C buffer fits into a C int,
+// which C.GoBytes takes as length.
+func bufferLength(length uint64) (int, error) {
+	if length > math.MaxInt32 {
+		return 0, fmt.Errorf("%w: buffer of %d bytes exceeds %d bytes", errInvalidInput, length, math.MaxInt32)
+	}
+	return int(length), nil
+}
+
+// goBytes copies the passed C buffer of the passed length.
+func goBytes(data *C.char, length C.size_t) ([]byte, error) {
+	if data == nil {
+		return nil, nil
+	}
+	n, err := bufferLength(uint64(length))
+	if err != nil {
+		return nil, err
+	}
+	return C.GoBytes(unsafe.Pointer(data), C.int(n)), nil
+}
+
+// goBytesSlice copies the passed C array of buffers with the passed array of
+// lengths.  Errors name the index of the buffer.
+func goBytesSlice(data **C.char, lengths *C.size_t, count C.size_t) ([][]byte, error) {
+	if data == nil || lengths == nil || count == 0 {
+		return nil, nil
+	}
+	buffers := unsafe.Slice(data, int(count))
+	bufferLens := unsafe.Slice(lengths, int(count))
+	result := make([][]byte, 0, int(count))
+	for i := range buffers {
+		buffer, err := goBytes(buffers[i], bufferLens[i])
+		if err != nil {
+			return nil, fmt.Errorf("%d: %w", i, err)
+		}
+		result = append(result, buffer)
+	}
+	return result, nil
+}
+
+/*
+verify verifies the supply chain of the passed JSON encoded layout, signed by
+the passed PEM encoded layout keys, with the passed JSON encoded links, like
+in_toto.Verify with its defaults.  Errors of decoding the input wrap
+errInvalidInput.
+*/
+func verify(layout []byte, links [][]byte, keys [][]byte) error {
+	layoutEnv, err := intoto.LoadMetadataFrom(bytes.NewReader(layout))
+	if err != nil {
+		return fmt.Errorf("%w: layout: %w", errInvalidInput, err)
+	}
+	layoutKeys := make(map[string]intoto.Key, len(keys))
+	for i, pem := range keys {
+		var key intoto.Key
+		if err := key.LoadKeyReaderDefaults(bytes.NewReader(pem)); err != nil {
+			return fmt.Errorf("%w: key %d: %w", errInvalidInput, i, err)
+		}
+		layoutKeys[key.KeyID] = key
+	}
+	if len(layoutKeys) == 0 {
+		return fmt.Errorf("%w: no layout keys", errInvalidInput)
+	}
+
+	// Links are passed to the verifier by the name of their step
+	linksByStep := make(map[string][]intoto.Metadata)
+	for i, data := range links {
+		linkEnv, err := intoto.LoadMetadataFrom(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("%w: link %d: %w", errInvalidInput, i, err)
+		}
+		link, ok := linkEnv.GetPayload().(intoto.Link)
+		if !ok {
+			return fmt.Errorf("%w: link %d: %w", errInvalidInput, i, intoto.ErrNotLink)
+		}
+		linksByStep[link.Name] = append(linksByStep[link.Name], linkEnv)
+	}
+	store := intoto.LinkStoreFunc(func(ctx context.Context, stepName string) ([]intoto.Metadata, error) {
+		return linksByStep[stepName], nil
+	})
+
+	_, err = intoto.Verify(layoutEnv, layoutKeys, "", intoto.WithLinkStore(store))
+	return err
+}
+
+func main() {}
@@ -0,0 +1,126 @@
+//go:build cgo
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	intoto "github.com/in-toto/in-toto-golang/in_toto"
+	"github.com/stretchr/testify/assert"
+)
+
+const testData = "../test/data"
+
+func dumpMetadata(t *testing.T, metadata intoto.Metadata, key intoto.Key) []byte {
+	t.Helper()
+	if err := metadata.Sign(key); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := intoto.DumpMetadataTo(metadata, &buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestVerify(t *testing.T) {
+	var carol intoto.Key
+	if err := carol.LoadKey(filepath.Join(testData, "carol"), "ed25519", []string{"sha256", "sha512"}); err != nil {
+		t.Fatal(err)
+	}
+	carolPub, err := os.ReadFile(filepath.Join(testData, "carol.pub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	danPub, err := os.ReadFile(filepath.Join(testData, "dan.pub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var layoutKey intoto.Key
+	if err := layoutKey.LoadKeyReaderDefaults(bytes.NewReader(carolPub)); err != nil {
+		t.Fatal(err)
+	}
+	layout := &intoto.Metablock{Signed: intoto.Layout{
+		Type:    "layout",
+		Expires: "2100-01-01T00:00:00Z",
+		Keys:    map[string]intoto.Key{layoutKey.KeyID: layoutKey},
+		Steps: []intoto.Step{{
+			Type:            "step",
+			PubKeys:         []string{layoutKey.KeyID},
+			Threshold:       1,
+			SupplyChainItem: intoto.SupplyChainItem{Name: "build"},
+		}},
+	}}
+	link := &intoto.Metablock{Signed: intoto.Link{
+		Type:        "link",
+		Name:        "build",
+		Materials:   map[string]intoto.HashObj{},
+		Products:    map[string]intoto.HashObj{},
+		ByProducts:  intoto.LinkByproducts{},
+		Environment: intoto.LinkEnvironment{},
+	}}
+	layoutBytes := dumpMetadata(t, layout, carol)
+	linkBytes := dumpMetadata(t, link, carol)
+
+	tables := []struct {
+		name   string
+		layout []byte
+		links  [][]byte
+		keys   [][]byte
+		result int
+	}{
+		{"verified", layoutBytes, [][]byte{linkBytes}, [][]byte{carolPub}, resultOK},
+		{"missing link", layoutBytes, nil, [][]byte{carolPub}, resultVerification},
+		{"wrong layout key", layoutBytes, [][]byte{linkBytes}, [][]byte{danPub}, resultVerification},
+		{"no layout key", layoutBytes, [][]byte{linkBytes}, nil, resultInvalidInput},
+		{"malformed layout", []byte("{"), [][]byte{linkBytes}, [][]byte{carolPub}, resultInvalidInput},
+		{"malformed link", layoutBytes, [][]byte{[]byte("{")}, [][]byte{carolPub}, resultInvalidInput},
+		{"layout as link", layoutBytes, [][]byte{layoutBytes}, [][]byte{carolPub}, resultInvalidInput},
+		{"malformed key", layoutBytes, [][]byte{linkBytes}, [][]byte{[]byte("key")}, resultInvalidInput},
+	}
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			err := verify(table.layout, table.links, table.keys)
+			switch table.result {
+			case resultOK:
+				assert.Nil(t, err)
+			case resultInvalidInput:
+				assert.ErrorIs(t, err, errInvalidInput)
+			default:
+				assert.NotNil(t, err)
+				assert.False(t, errors.Is(err, errInvalidInput))
+			}
+		})
+	}
+}
+
+func TestBufferLength(t *testing.T) {
+	n, err := bufferLength(math.MaxInt32)
+	assert.Nil(t, err)
+	assert.Equal(t, math.MaxInt32, n)
+
+	// Lengths that a C int cannot hold are not truncated
+	_, err = bufferLength(math.MaxInt32 + 1)
+	assert.ErrorIs(t, err, errInvalidInput)
+	_, err = bufferLength(math.MaxUint64)
+	assert.ErrorIs(t, err, errInvalidInput)
+}
+
+func TestRecoverPanic(t *testing.T) {
+	verificationErr := errors.New("verification failed")
+	assert.Nil(t, recoverPanic(func() error { return nil }))
+	assert.Equal(t, verificationErr, recoverPanic(func() error { return verificationErr }))
+
+	err := recoverPanic(func() error {
+		var links []intoto.Metadata
+		return links[0].VerifySignature(intoto.Key{})
+	})
+	assert.ErrorIs(t, err, errInternal)
+	assert.ErrorContains(t, err, "index out of range")
+}
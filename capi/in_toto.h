@@ -0,0 +1,47 @@
+/*
+ * C ABI of the in-toto verifier, built as shared library with
+ *
+ *     go build -buildmode=c-shared -o libintoto.so ./capi
+ *
+ * Metadata and keys are passed as the contents of their files, i.e. JSON
+ * encoded layouts and links, and PEM encoded public keys, each with its length
+ * in bytes.  The library does not keep references to passed memory.
+ */
+#ifndef IN_TOTO_H
+#define IN_TOTO_H
+
+#include <stddef.h>
+
+#ifdef __cplusplus
+extern "C" {
+#endif
+
+/* Result codes of intoto_verify. */
+#define INTOTO_OK 0
+/* A layout, link or key cannot be decoded. */
+#define INTOTO_ERR_INVALID_INPUT 1
+/* The supply chain does not pass verification. */
+#define INTOTO_ERR_VERIFICATION 2
+/* The verifier failed unexpectedly, e.g. due to a bug. */
+#define INTOTO_ERR_INTERNAL 3
+
+/*
+ * Verifies the supply chain of the passed root layout, signed by each of the
+ * passed layout keys, with the passed links, and returns INTOTO_OK on success.
+ * Inspections of the layout are run in the current working directory.  On
+ * failure, if error is not NULL, *error is set to a message, which the caller
+ * must release with intoto_free.
+ */
+int intoto_verify(const char *layout, size_t layout_len,
+                  const char *const *links, const size_t *link_lens, size_t link_count,
+                  const char *const *keys, const size_t *key_lens, size_t key_count,
+                  char **error);
+
+/* Releases a message returned by intoto_verify. */
+void intoto_free(char *message);
+
+#ifdef __cplusplus
+}
+#endif
+
+#endif /* IN_TOTO_H */
@@ -0,0 +1,193 @@
+package cmd
+
+import (
+	"fmt"
+
+	intoto "github.com/in-toto/in-toto-golang/in_toto"
+	"github.com/spf13/cobra"
+)
+
+var ceremonyCmd = &cobra.Command{
+	Use:   "ceremony",
+	Short: "Sign layouts with keys kept on an air-gapped machine",
+	Long: `Sign layouts with keys kept on an air-gapped machine.  Export a signing
+request on the online machine with 'in-toto ceremony export', sign it on the
+air-gapped machine with 'in-toto ceremony sign' and import the signatures on
+the online machine with 'in-toto ceremony import'.  Each command prints the
+digest of the signed bytes, which participants compare on both machines.`,
+}
+
+var ceremonyExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export a layout as signing request",
+	Args:  cobra.NoArgs,
+	RunE:  ceremonyExport,
+}
+
+var ceremonySignCmd = &cobra.Command{
+	Use:   "sign",
+	Short: "Sign a signing request and write the signatures as signing response",
+	Args:  cobra.NoArgs,
+	RunE:  ceremonySign,
+}
+
+var ceremonyImportCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Add the signatures of a signing response to a layout",
+	Args:  cobra.NoArgs,
+	RunE:  ceremonyImport,
+}
+
+var (
+	ceremonyRequestPath  string
+	ceremonyResponsePath string
+	ceremonyKeyPaths     []string
+)
+
+func init() {
+	rootCmd.AddCommand(ceremonyCmd)
+	ceremonyCmd.AddCommand(ceremonyExportCmd)
+	ceremonyCmd.AddCommand(ceremonySignCmd)
+	ceremonyCmd.AddCommand(ceremonyImportCmd)
+
+	for _, cmd := range []*cobra.Command{ceremonyExportCmd, ceremonyImportCmd} {
+		cmd.Flags().StringVarP(
+			&layoutPath,
+			"file",
+			"f",
+			"",
+			`Path to the layout file to be signed.`,
+		)
+		cmd.MarkFlagRequired("file")
+	}
+	for _, cmd := range []*cobra.Command{ceremonyExportCmd, ceremonySignCmd} {
+		cmd.Flags().StringVarP(
+			&ceremonyRequestPath,
+			"request",
+			"r",
+			"",
+			`Path to the signing request.`,
+		)
+		cmd.MarkFlagRequired("request")
+	}
+	for _, cmd := range []*cobra.Command{ceremonySignCmd, ceremonyImportCmd} {
+		cmd.Flags().StringVar(
+			&ceremonyResponsePath,
+			"response",
+			"",
+			`Path to the signing response.`,
+		)
+		cmd.MarkFlagRequired("response")
+	}
+
+	ceremonySignCmd.Flags().StringArrayVarP(
+		&ceremonyKeyPaths,
+		"key",
+		"k",
+		[]string{},
+		`Path to a PEM formatted private key to sign the layout with.
+Can be passed several times to sign with several keys.`,
+	)
+	ceremonySignCmd.Flags().StringVarP(
+		&keyType,
+		"key-type",
+		"t",
+		"",
+		`Type of the keys passed with '--key', i.e. 'rsa', 'ed25519'
+or 'ecdsa'. If not passed, the type is derived from the key
+files, otherwise the keys must be of the passed type.`,
+	)
+	ceremonySignCmd.MarkFlagRequired("key")
+
+	ceremonyImportCmd.Flags().StringArrayVarP(
+		&ceremonyKeyPaths,
+		"key",
+		"k",
+		[]string{},
+		`Path to a public key to verify the signatures of the signing
+response with. Can be passed several times. Importing fails if a
+signature does not verify with one of the keys.`,
+	)
+	ceremonyImportCmd.Flags().StringVarP(
+		&outputPath,
+		"output",
+		"o",
+		"",
+		`Path to store the signed layout at. If not passed, the layout
+is written to the path of the passed layout file.`,
+	)
+	ceremonyImportCmd.MarkFlagRequired("key")
+}
+
+func ceremonyExport(cmd *cobra.Command, args []string) error {
+	layoutEnv, err := intoto.LoadMetadata(layoutPath)
+	if err != nil {
+		return fmt.Errorf("failed to load layout at %s: %w", layoutPath, err)
+	}
+	request, err := intoto.NewSigningRequest(layoutEnv)
+	if err != nil {
+		return err
+	}
+	if err := request.Dump(ceremonyRequestPath); err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "%s\n", intoto.FormatSigningDigest(request.Digest))
+	return nil
+}
+
+func ceremonySign(cmd *cobra.Command, args []string) error {
+	if err := validateKeyType(keyType); err != nil {
+		return err
+	}
+	request, err := intoto.LoadSigningRequest(ceremonyRequestPath)
+	if err != nil {
+		return err
+	}
+	keys := make([]intoto.Key, 0, len(ceremonyKeyPaths))
+	for _, path := range ceremonyKeyPaths {
+		var key intoto.Key
+		if err := loadKeyOfType(&key, path, keyType); err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+	response, err := request.Sign(keys...)
+	if err != nil {
+		return err
+	}
+	if err := response.Dump(ceremonyResponsePath); err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "%s\n", intoto.FormatSigningDigest(response.Digest))
+	return nil
+}
+
+func ceremonyImport(cmd *cobra.Command, args []string) error {
+	layoutEnv, err := intoto.LoadMetadata(layoutPath)
+	if err != nil {
+		return fmt.Errorf("failed to load layout at %s: %w", layoutPath, err)
+	}
+	response, err := intoto.LoadSigningResponse(ceremonyResponsePath)
+	if err != nil {
+		return err
+	}
+	keys := make(map[string]intoto.Key, len(ceremonyKeyPaths))
+	for _, path := range ceremonyKeyPaths {
+		var key intoto.Key
+		if err := loadKeyOfType(&key, path, ""); err != nil {
+			return err
+		}
+		keys[key.KeyID] = key
+	}
+	if err := intoto.MergeSignatures(layoutEnv, response, keys); err != nil {
+		return err
+	}
+	if outputPath == "" {
+		outputPath = layoutPath
+	}
+	if err := layoutEnv.Dump(outputPath); err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "%s\n", intoto.FormatSigningDigest(response.Digest))
+	return nil
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/in-toto/in-toto-golang/in_toto"
+	"github.com/spf13/cobra"
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff <metadata> <metadata>",
+	Short: "Compare two link or two layout metadata files",
+	Long: `Compare two link or two layout metadata files and print their
+differences, e.g. changed artifact hashes, added or removed artifacts,
+and changed artifact rules or keys. Exits with 1 if the metadata differ.`,
+	Args: cobra.ExactArgs(2),
+	RunE: diff,
+}
+
+var diffFormat string
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+
+	diffCmd.Flags().StringVar(
+		&diffFormat,
+		"format",
+		"text",
+		`Format of the printed differences, one of 'text' or 'json'.`,
+	)
+}
+
+func diff(cmd *cobra.Command, args []string) error {
+	if diffFormat != "text" && diffFormat != "json" {
+		return fmt.Errorf("unsupported diff format '%s'", diffFormat)
+	}
+
+	a, err := in_toto.LoadMetadata(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to load %s: %w", args[0], err)
+	}
+	b, err := in_toto.LoadMetadata(args[1])
+	if err != nil {
+		return fmt.Errorf("failed to load %s: %w", args[1], err)
+	}
+
+	metadataDiff, err := in_toto.Diff(a, b)
+	if err != nil {
+		return err
+	}
+
+	if diffFormat == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(metadataDiff)
+	} else {
+		err = metadataDiff.WriteText(os.Stdout)
+	}
+	if err != nil {
+		return err
+	}
+
+	if !metadataDiff.Empty() {
+		os.Exit(1)
+	}
+	return nil
+}
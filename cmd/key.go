@@ -3,6 +3,8 @@ package cmd
 import (
 	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 
 	intoto "github.com/in-toto/in-toto-golang/in_toto"
@@ -30,11 +32,84 @@ var keyLayoutCmd = &cobra.Command{
 	RunE:  keyLayout,
 }
 
+var keySplitCmd = &cobra.Command{
+	Use:   "split <file>",
+	Short: "Split a private key into shares encrypted to recipient keys",
+	Long: `Split a private key into one Shamir secret share per recipient key, for
+offline escrow.  Each share is encrypted to its recipient's RSA or ECDSA public
+key.  Any threshold of shares recombine the key, see 'in-toto key combine'.`,
+	Args: cobra.ExactArgs(1),
+	RunE: keySplit,
+}
+
+var keyCombineCmd = &cobra.Command{
+	Use:   "combine <share>...",
+	Short: "Recombine a private key from its shares",
+	Long: `Recombine a private key split with 'in-toto key split' and write it in PEM
+format.  Each share is decrypted with the private key of its recipient, shares
+without recipient key are ignored.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: keyCombine,
+}
+
+var (
+	shareThreshold  int
+	shareRecipients []string
+	shareOutputDir  string
+	shareKeyPaths   []string
+	combinedKeyPath string
+)
+
 func init() {
 	rootCmd.AddCommand(keyCmd)
 
 	keyCmd.AddCommand(keyIDCmd)
 	keyCmd.AddCommand(keyLayoutCmd)
+	keyCmd.AddCommand(keySplitCmd)
+	keyCmd.AddCommand(keyCombineCmd)
+
+	keySplitCmd.Flags().IntVarP(
+		&shareThreshold,
+		"threshold",
+		"t",
+		2,
+		"Number of shares required to recombine the key",
+	)
+	keySplitCmd.Flags().StringArrayVarP(
+		&shareRecipients,
+		"recipient",
+		"r",
+		[]string{},
+		`Path to a PEM formatted public key to encrypt a share to,
+passed once per share`,
+	)
+	keySplitCmd.Flags().StringVarP(
+		&shareOutputDir,
+		"output-dir",
+		"d",
+		"./",
+		`Directory to store the shares in, named
+<key id prefix>.<index>.share`,
+	)
+	keySplitCmd.MarkFlagRequired("recipient")
+
+	keyCombineCmd.Flags().StringArrayVarP(
+		&shareKeyPaths,
+		"key",
+		"k",
+		[]string{},
+		`Path to a PEM formatted private key of a share recipient,
+passed once per recipient`,
+	)
+	keyCombineCmd.Flags().StringVarP(
+		&combinedKeyPath,
+		"output",
+		"o",
+		"",
+		"Path to store the recombined private key at",
+	)
+	keyCombineCmd.MarkFlagRequired("key")
+	keyCombineCmd.MarkFlagRequired("output")
 }
 
 func keyID(cmd *cobra.Command, args []string) error {
@@ -71,3 +146,66 @@ func keyLayout(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
+
+func keySplit(cmd *cobra.Command, args []string) error {
+	var key intoto.Key
+	if err := key.LoadKeyDefaults(args[0]); err != nil {
+		return fmt.Errorf("invalid key at %s: %w", args[0], err)
+	}
+
+	recipients := make([]intoto.Key, 0, len(shareRecipients))
+	for _, path := range shareRecipients {
+		var recipient intoto.Key
+		if err := recipient.LoadKeyDefaults(path); err != nil {
+			return fmt.Errorf("invalid recipient key at %s: %w", path, err)
+		}
+		recipients = append(recipients, recipient)
+	}
+
+	shares, err := intoto.SplitKey(key, shareThreshold, recipients)
+	if err != nil {
+		return err
+	}
+	for _, share := range shares {
+		path := filepath.Join(shareOutputDir, fmt.Sprintf("%.8s.%d.share", share.KeyID, share.Index))
+		if err := share.Dump(path); err != nil {
+			return err
+		}
+		fmt.Printf("%s (recipient %s)\n", path, share.Recipient)
+	}
+	return nil
+}
+
+func keyCombine(cmd *cobra.Command, args []string) error {
+	recipientKeys := make(map[string]intoto.Key, len(shareKeyPaths))
+	for _, path := range shareKeyPaths {
+		var recipient intoto.Key
+		if err := recipient.LoadKeyDefaults(path); err != nil {
+			return fmt.Errorf("invalid recipient key at %s: %w", path, err)
+		}
+		recipientKeys[recipient.KeyID] = recipient
+	}
+
+	shares := make([]intoto.KeyShare, 0, len(args))
+	for _, path := range args {
+		share, err := intoto.LoadKeyShare(path)
+		if err != nil {
+			return err
+		}
+		shares = append(shares, share)
+	}
+
+	key, err := intoto.CombineKeyShares(shares, recipientKeys)
+	if err != nil {
+		return err
+	}
+	pemBytes, err := key.EncodePrivateKeyPEM()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(combinedKeyPath, pemBytes, 0600); err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", key.KeyID)
+	return nil
+}
@@ -2,8 +2,6 @@ package cmd
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
 
 	intoto "github.com/in-toto/in-toto-golang/in_toto"
 	"github.com/spf13/cobra"
@@ -13,6 +11,7 @@ var (
 	recordStepName       string
 	recordMaterialsPaths []string
 	recordProductsPaths  []string
+	recordAbsentProducts []string
 )
 
 var recordCmd = &cobra.Command{
@@ -71,6 +70,16 @@ i.e. ‘<name>.<keyid prefix>.link’. See ‘–key-type’ for available
 formats. Passing one of ‘–key’ or ‘–gpg’ is required.`,
 	)
 
+	recordCmd.PersistentFlags().StringVarP(
+		&keyType,
+		"key-type",
+		"t",
+		"",
+		`Type of the key passed with '--key', i.e. 'rsa', 'ed25519'
+or 'ecdsa'. If not passed, the type is derived from the key
+file, otherwise the key must be of the passed type.`,
+	)
+
 	recordCmd.PersistentFlags().StringVarP(
 		&certPath,
 		"cert",
@@ -111,6 +120,15 @@ of another.`,
 in environment variables or config files. See Config docs for details.`,
 	)
 
+	recordCmd.PersistentFlags().StringVar(
+		&excludeSyntax,
+		"exclude-syntax",
+		"",
+		`Syntax of the '--exclude' patterns, e.g. 'extended' for
+'dir/**' and brace patterns, or 'fnmatch'. Defaults to
+gitignore-style patterns.`,
+	)
+
 	recordCmd.PersistentFlags().StringVar(
 		&spiffeUDS,
 		"spiffe-workload-api-path",
@@ -127,6 +145,39 @@ operating systems. It is done by replacing all line separators
 with a new line character.`,
 	)
 
+	recordCmd.PersistentFlags().BoolVar(
+		&textLineNormalization,
+		"normalize-text-line-endings",
+		false,
+		`Like '--normalize-line-endings', but only normalize line
+separators of text files, i.e. of files without NUL bytes in
+their first 8000 bytes, and hash binary files as is.`,
+	)
+
+	recordCmd.PersistentFlags().BoolVar(
+		&selfDigest,
+		"self-digest",
+		false,
+		`Embed a digest of the signed portion in the link file, so
+that files corrupted in storage or transit are detected when
+loaded.`,
+	)
+
+	recordCmd.PersistentFlags().BoolVar(
+		&showProgress,
+		"progress",
+		false,
+		`Print the progress of recording artifacts to stderr, i.e. the number of
+hashed artifacts and the time taken by each stage.`,
+	)
+
+	recordCmd.PersistentFlags().BoolVar(
+		&debug,
+		"debug",
+		false,
+		`Print debug messages to stderr, e.g. about excluded and hashed artifacts.`,
+	)
+
 	recordCmd.PersistentFlags().BoolVar(
 		&useDSSE,
 		"use-dsse",
@@ -139,8 +190,115 @@ with a new line character.`,
 		"follow-symlink-dirs",
 		false,
 		`Follow symlinked directories to their targets. Note: this parameter
-toggles following linked directories only, linked files are always
-recorded independently of this parameter.`,
+toggles following linked directories only, linked files are
+recorded unless '--skip-symlinks' is passed.`,
+	)
+
+	recordCmd.PersistentFlags().BoolVar(
+		&skipSymlinks,
+		"skip-symlinks",
+		false,
+		`Skip symlinked files and directories instead of recording
+their targets.`,
+	)
+
+	recordCmd.PersistentFlags().StringVar(
+		&symlinkCyclePolicy,
+		"symlink-cycle-policy",
+		"",
+		`Handling of symlinks that lead to a cycle, i.e. 'error', the
+default, 'skip', or 'record-target' to record the symlink with
+the hashes of the path it points to.`,
+	)
+
+	recordCmd.PersistentFlags().StringVar(
+		&specialFilePolicy,
+		"special-file-policy",
+		"",
+		`Handling of device files, sockets and FIFOs, i.e. 'skip', the
+default, or 'error'.`,
+	)
+
+	recordCmd.PersistentFlags().BoolVar(
+		&recordEmptyDirs,
+		"record-empty-dirs",
+		false,
+		`Record empty directories as artifacts without hashes. Their
+names end with a slash.`,
+	)
+
+	recordCmd.PersistentFlags().StringArrayVar(
+		&dirHashPatterns,
+		"dirhash",
+		[]string{},
+		`Path pattern to match directories that should be recorded as
+a single artifact, whose name ends with a slash, instead of one
+artifact per file. The artifact's hashes summarize the names and
+contents of all files in the directory like Go's dirhash.`,
+	)
+
+	recordCmd.PersistentFlags().StringVar(
+		&dirHashMode,
+		"dirhash-mode",
+		"",
+		`Mode used to hash directories matched by '--dirhash', i.e.
+'dirhash', the default, or 'merkle' for a Merkle tree hash,
+in which the hash of a subdirectory does not depend on its
+location.`,
+	)
+
+	recordCmd.PersistentFlags().StringArrayVar(
+		&goVendorPatterns,
+		"go-vendor",
+		[]string{},
+		`Path pattern to match Go vendor directories, e.g. 'vendor',
+that should be recorded by their vendored modules, i.e. by
+module path, version and go.sum hash, instead of one artifact
+per vendored file.`,
+	)
+
+	recordCmd.PersistentFlags().BoolVar(
+		&detectTypes,
+		"detect-content-types",
+		false,
+		`Record the content types of artifacts, e.g.
+'application/gzip', in the environment of the link, so that
+the layout owner can restrict the types of artifacts.`,
+	)
+
+	recordCmd.PersistentFlags().StringVar(
+		&artifactProfileName,
+		"artifact-profile",
+		"",
+		`Name of the artifact profile used to record artifacts. The
+profile sets the exclude patterns, lstrip paths, line
+normalization, hash algorithms and the handling of symlinks
+and empty directories, and cannot be combined with the
+corresponding flags. Requires '--artifact-profiles'.`,
+	)
+
+	recordCmd.PersistentFlags().StringVar(
+		&artifactProfilesPath,
+		"artifact-profiles",
+		"",
+		`Path to a layout or JSON file that defines the artifact profile
+passed with '--artifact-profile'.`,
+	)
+
+	recordCmd.PersistentFlags().IntVar(
+		&hashWorkers,
+		"hash-workers",
+		0,
+		`Number of files hashed concurrently when recording artifacts.
+Defaults to the number of CPUs usable by the process.`,
+	)
+
+	recordCmd.PersistentFlags().StringSliceVar(
+		&hashAlgorithms,
+		"hash-algorithms",
+		[]string{"sha256"},
+		`Hash algorithms used to record artifacts. Supported are
+'sha256', 'sha384', 'sha512', 'blake2b' and 'blake2b-256'.`,
 	)
 
 	recordCmd.MarkPersistentFlagRequired("name")
@@ -170,48 +328,105 @@ command is executed. Symlinks are followed.`,
 are stored in the resulting link metadata after the
 command is executed. Symlinks are followed.`,
 	)
+
+	recordStopCmd.Flags().StringVar(
+		&metadataService,
+		"metadata-service",
+		"",
+		`URL of a metadata service to submit the resulting link
+metadata to, in addition to writing it to the output directory.
+The bearer token in the IN_TOTO_METADATA_TOKEN environment
+variable is used for authentication, if set.`,
+	)
+
+	recordStopCmd.Flags().StringVar(
+		&timestampURL,
+		"timestamp-url",
+		"",
+		`URL of an RFC 3161 time-stamping authority, which
+timestamps the signatures of the resulting link metadata, so
+that they can be verified after the signing certificate
+expired. Requires the legacy signature wrapper.`,
+	)
+
+	recordStopCmd.Flags().StringArrayVar(
+		&recordAbsentProducts,
+		"absent-products",
+		[]string{},
+		`Path pattern, e.g. '*.pem', that no recorded product may
+match. The pattern is asserted absent in the resulting link
+metadata, as required by ABSENT rules of a layout.`,
+	)
 }
 
 func recordStart(cmd *cobra.Command, args []string) error {
-	block, err := intoto.InTotoRecordStart(recordStepName, recordMaterialsPaths, key, []string{"sha256"}, exclude, lStripPaths, lineNormalization, followSymlinkDirs, useDSSE)
+	profile, err := getArtifactProfile(cmd)
 	if err != nil {
-		return fmt.Errorf("failed to create start link file: %w", err)
+		return err
 	}
+	intoto.ArtifactHashWorkers = hashWorkers
 
-	prelimLinkName := fmt.Sprintf(intoto.PreliminaryLinkNameFormat, recordStepName, key.KeyID)
-	prelimLinkPath := filepath.Join(outDir, prelimLinkName)
-	err = block.Dump(prelimLinkPath)
-	if err != nil {
-		return fmt.Errorf("failed to write start link file to %s: %w", prelimLinkName, err)
+	opts := []intoto.RunOption{
+		intoto.WithMaterials(recordMaterialsPaths...),
+		intoto.WithArtifactProfile(profile),
+		intoto.WithHashAlgorithms(profile.GetHashAlgorithms()...),
+		intoto.WithUnsignedLink(),
+	}
+	if !useDSSE {
+		opts = append(opts, intoto.WithMetablock())
+	}
+	if selfDigest {
+		opts = append(opts, intoto.WithSelfDigest())
+	}
+	if progress := printProgress(cmd.ErrOrStderr()); progress != nil {
+		opts = append(opts, intoto.WithProgress(progress))
+	}
+	if logger := newDebugLogger(cmd.ErrOrStderr()); logger != nil {
+		opts = append(opts, intoto.WithLogger(logger))
+	}
+	if _, err := intoto.RecordStartFile(outDir, recordStepName, key, opts...); err != nil {
+		return fmt.Errorf("failed to create start link file: %w", err)
 	}
-
 	return nil
 }
 
 func recordStop(cmd *cobra.Command, args []string) error {
-	prelimLinkName := fmt.Sprintf(intoto.PreliminaryLinkNameFormat, recordStepName, key.KeyID)
-	prelimLinkPath := filepath.Join(outDir, prelimLinkName)
-	prelimLinkMb, err := intoto.LoadMetadata(prelimLinkPath)
+	profile, err := getArtifactProfile(cmd)
 	if err != nil {
-		return fmt.Errorf("failed to load start link file at %s: %w", prelimLinkName, err)
+		return err
 	}
+	intoto.ArtifactHashWorkers = hashWorkers
 
-	linkMb, err := intoto.InTotoRecordStop(prelimLinkMb, recordProductsPaths, key, []string{"sha256"}, exclude, lStripPaths, lineNormalization, followSymlinkDirs, useDSSE)
+	opts := []intoto.RunOption{
+		intoto.WithProducts(recordProductsPaths...),
+		intoto.WithAbsentProducts(recordAbsentProducts...),
+		intoto.WithArtifactProfile(profile),
+		intoto.WithHashAlgorithms(profile.GetHashAlgorithms()...),
+		intoto.WithUnsignedLink(),
+	}
+	if selfDigest {
+		opts = append(opts, intoto.WithSelfDigest())
+	}
+	if timestampURL != "" {
+		opts = append(opts, intoto.WithTimestamper(intoto.RFC3161Timestamper{URL: timestampURL}))
+	}
+	if progress := printProgress(cmd.ErrOrStderr()); progress != nil {
+		opts = append(opts, intoto.WithProgress(progress))
+	}
+	if logger := newDebugLogger(cmd.ErrOrStderr()); logger != nil {
+		opts = append(opts, intoto.WithLogger(logger))
+	}
+	linkPath, err := intoto.RecordStopFile(outDir, recordStepName, key, opts...)
 	if err != nil {
 		return fmt.Errorf("failed to create stop link file: %w", err)
 	}
 
-	linkName := fmt.Sprintf(intoto.LinkNameFormat, recordStepName, key.KeyID)
-	linkPath := filepath.Join(outDir, linkName)
-	err = linkMb.Dump(linkPath)
-	if err != nil {
-		return fmt.Errorf("failed to write stop link file to %s: %w", prelimLinkName, err)
+	if metadataService == "" {
+		return nil
 	}
-
-	err = os.Remove(prelimLinkPath)
+	linkEnv, err := intoto.LoadMetadata(linkPath)
 	if err != nil {
-		return fmt.Errorf("failed to remove start link file at %s: %w", prelimLinkName, err)
+		return err
 	}
-
-	return nil
+	return submitLink(linkEnv)
 }
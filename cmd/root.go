@@ -4,8 +4,14 @@ import (
 	"context"
 	"encoding/pem"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	intoto "github.com/in-toto/in-toto-golang/in_toto"
 	"github.com/in-toto/in-toto-golang/internal/spiffe"
@@ -16,17 +22,57 @@ var (
 	spiffeUDS         string
 	layoutPath        string
 	keyPath           string
+	keyType           string
 	certPath          string
 	key               intoto.Key
 	cert              intoto.Key
+	signer            intoto.Signer
 	lStripPaths       []string
 	exclude           []string
+	excludeSyntax     string
 	outDir            string
 	lineNormalization bool
-	followSymlinkDirs bool
-	useDSSE           bool
+	// textLineNormalization normalizes line separators of text files only
+	textLineNormalization bool
+	followSymlinkDirs     bool
+	skipSymlinks          bool
+	symlinkCyclePolicy    string
+	specialFilePolicy     string
+	recordEmptyDirs       bool
+	dirHashPatterns       []string
+	dirHashMode           string
+	goVendorPatterns      []string
+	detectTypes           bool
+	useDSSE               bool
+	selfDigest            bool
+	// timestampURL is the URL of an RFC 3161 time-stamping authority, which
+	// timestamps the signatures of links, see intoto.RFC3161Timestamper
+	timestampURL string
+	// artifactProfileName and artifactProfilesPath select an artifact profile,
+	// which replaces the artifact handling flags of run and record
+	artifactProfileName  string
+	artifactProfilesPath string
+	hashWorkers          int
+	hashAlgorithms       []string
+	// metadataService is the URL of a metadata service to submit links to,
+	// or to load links from, see newMetadataClient
+	metadataService string
+	// showProgress prints the progress of run, record and verify, see
+	// printProgress
+	showProgress bool
+	// debug prints debug messages of run, record and verify, see
+	// newDebugLogger
+	debug bool
 )
 
+// metadataTokenEnv is the environment variable that holds the bearer token to
+// authenticate to the metadata service with.
+const metadataTokenEnv = "IN_TOTO_METADATA_TOKEN"
+
+// sigstoreTokenEnv is the environment variable that holds the OIDC identity
+// token to obtain a Fulcio certificate for with '--keyless'.
+const sigstoreTokenEnv = "SIGSTORE_ID_TOKEN"
+
 var rootCmd = &cobra.Command{
 	Use:               "in-toto",
 	Short:             "Framework to secure integrity of software supply chains",
@@ -81,10 +127,14 @@ func loadKeyFromDisk() error {
 		return fmt.Errorf("key or cert must be provided")
 	}
 
+	if err := validateKeyType(keyType); err != nil {
+		return err
+	}
+
 	if len(keyPath) > 0 {
 		if _, err := os.Stat(keyPath); err == nil {
-			if err := key.LoadKeyDefaults(keyPath); err != nil {
-				return fmt.Errorf("invalid key at %s: %w", keyPath, err)
+			if err := loadKeyOfType(&key, keyPath, keyType); err != nil {
+				return err
 			}
 		} else {
 			return fmt.Errorf("key not found at %s: %w", keyPath, err)
@@ -96,7 +146,13 @@ func loadKeyFromDisk() error {
 			if err := cert.LoadKeyDefaults(certPath); err != nil {
 				return fmt.Errorf("invalid cert at %s: %w", certPath, err)
 			}
-			key.KeyVal.Certificate = cert.KeyVal.Certificate
+			if len(keyPath) > 0 {
+				if err := key.AttachCertificate([]byte(cert.KeyVal.Certificate)); err != nil {
+					return fmt.Errorf("invalid cert at %s: %w", certPath, err)
+				}
+			} else {
+				key.KeyVal.Certificate = cert.KeyVal.Certificate
+			}
 		} else {
 			return fmt.Errorf("cert not found at %s: %w", certPath, err)
 		}
@@ -104,17 +160,234 @@ func loadKeyFromDisk() error {
 	return nil
 }
 
+/*
+loadKeyOfType loads the key at the passed path into the passed key, deriving
+its format from the key file, see LoadKeyDefaults.  If the passed key type is
+not empty, i.e. one of the types accepted by '--key-type', the key must be of
+that type.
+*/
+func loadKeyOfType(k *intoto.Key, path string, keyType string) error {
+	if err := k.LoadKeyDefaults(path); err != nil {
+		return fmt.Errorf("invalid key at %s: %w", path, err)
+	}
+	if keyType != "" && k.KeyType != keyType {
+		return fmt.Errorf("key at %s is of type '%s', not '%s'", path, k.KeyType, keyType)
+	}
+	return nil
+}
+
+// validateKeyType checks that the passed key type is accepted by
+// '--key-type'.
+func validateKeyType(keyType string) error {
+	switch keyType {
+	case "", "rsa", "ed25519", "ecdsa":
+		return nil
+	}
+	return fmt.Errorf("unsupported key type '%s', expected one of 'rsa', 'ed25519' or 'ecdsa'", keyType)
+}
+
+/*
+loadSSHAgentSigner loads the OpenSSH public key passed with '--ssh-agent-key'
+and creates a signer for its private key held by the ssh-agent.  The public
+key is used as key, e.g. to name links after its key id.  The connection to
+the agent is closed when the process exits.
+*/
+func loadSSHAgentSigner() error {
+	if keyPath != "" || certPath != "" {
+		return fmt.Errorf("'--ssh-agent-key' cannot be combined with '--key' or '--cert'")
+	}
+	var public intoto.Key
+	if err := public.LoadKeyDefaults(sshAgentKeyPath); err != nil {
+		return fmt.Errorf("invalid key at %s: %w", sshAgentKeyPath, err)
+	}
+	sshAgent, _, err := intoto.ConnectSSHAgent()
+	if err != nil {
+		return err
+	}
+	signer, err = intoto.NewSSHAgentSigner(sshAgent, public)
+	if err != nil {
+		return err
+	}
+	key = signer.Public()
+	return nil
+}
+
+/*
+loadKeylessKey generates an ephemeral key and obtains a certificate for it
+from the Fulcio instance passed with '--fulcio-url', binding it to the
+identity of the OIDC identity token in SIGSTORE_ID_TOKEN, e.g. of a CI
+workflow.
+*/
+func loadKeylessKey(ctx context.Context) error {
+	if keyPath != "" || certPath != "" || sshAgentKeyPath != "" {
+		return fmt.Errorf("'--keyless' cannot be combined with '--key', '--cert' or '--ssh-agent-key'")
+	}
+	idToken := os.Getenv(sigstoreTokenEnv)
+	if idToken == "" {
+		return fmt.Errorf("'--keyless' requires an OIDC identity token in %s", sigstoreTokenEnv)
+	}
+	var err error
+	key, _, err = intoto.NewFulcioClient(fulcioURL).GenerateKeylessKey(ctx, idToken)
+	if err != nil {
+		return fmt.Errorf("failed to obtain fulcio certificate: %w", err)
+	}
+	return nil
+}
+
 func getKeyCert(cmd *cobra.Command, args []string) error {
 	if spiffeUDS != "" {
 		return loadKeyFromSpireSocket()
 	}
+	if keyless {
+		return loadKeylessKey(cmd.Context())
+	}
+	if sshAgentKeyPath != "" {
+		return loadSSHAgentSigner()
+	}
 	return loadKeyFromDisk()
 }
 
 // Execute runs the root command
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	// Interrupted or terminated commands, e.g. of cancelled CI jobs, abort
+	// running commands and artifact hashing
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
+		stop()
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 }
+
+/*
+getArtifactProfile returns the artifact profile to record artifacts with.
+Without '--artifact-profile' the profile is built from the artifact handling
+flags, otherwise it is loaded from '--artifact-profiles'.  Passing any of the
+artifact handling flags together with a profile is an error, so that links are
+recorded exactly like the verifier records inspections with the profile.
+*/
+func getArtifactProfile(cmd *cobra.Command) (intoto.ArtifactProfile, error) {
+	if artifactProfileName == "" {
+		if artifactProfilesPath != "" {
+			return intoto.ArtifactProfile{}, fmt.Errorf("'--artifact-profiles' requires '--artifact-profile'")
+		}
+		if lineNormalization && textLineNormalization {
+			return intoto.ArtifactProfile{}, fmt.Errorf("'--normalize-line-endings' cannot be combined with '--normalize-text-line-endings'")
+		}
+		return intoto.ArtifactProfile{
+			ExcludePatterns:       exclude,
+			ExcludePatternSyntax:  excludeSyntax,
+			LStripPaths:           lStripPaths,
+			LineNormalization:     lineNormalization,
+			TextLineNormalization: textLineNormalization,
+			HashAlgorithms:        hashAlgorithms,
+			FollowSymlinkDirs:     followSymlinkDirs,
+			SkipSymlinks:          skipSymlinks,
+			SymlinkCyclePolicy:    symlinkCyclePolicy,
+			SpecialFilePolicy:     specialFilePolicy,
+			RecordEmptyDirs:       recordEmptyDirs,
+			DirHashPatterns:       dirHashPatterns,
+			DirHashMode:           dirHashMode,
+			GoVendorPatterns:      goVendorPatterns,
+			DetectContentTypes:    detectTypes,
+		}, nil
+	}
+	if artifactProfilesPath == "" {
+		return intoto.ArtifactProfile{}, fmt.Errorf("'--artifact-profile' requires '--artifact-profiles'")
+	}
+	for _, flag := range []string{"exclude", "exclude-syntax", "lstrip-paths", "normalize-line-endings",
+		"normalize-text-line-endings", "hash-algorithms",
+		"follow-symlink-dirs", "skip-symlinks", "symlink-cycle-policy", "special-file-policy", "record-empty-dirs", "dirhash",
+		"dirhash-mode", "go-vendor", "detect-content-types"} {
+		if cmd.Flags().Changed(flag) {
+			return intoto.ArtifactProfile{}, fmt.Errorf("'--%s' cannot be combined with '--artifact-profile'", flag)
+		}
+	}
+
+	profiles, err := intoto.LoadArtifactProfiles(artifactProfilesPath)
+	if err != nil {
+		return intoto.ArtifactProfile{}, fmt.Errorf("failed to load artifact profiles from %s: %w", artifactProfilesPath, err)
+	}
+	return intoto.ResolveArtifactProfile(profiles, artifactProfileName)
+}
+
+// newMetadataClient returns a client of the metadata service passed with
+// '--metadata-service', which authenticates with the bearer token in the
+// IN_TOTO_METADATA_TOKEN environment variable, if set.
+func newMetadataClient() *intoto.MetadataClient {
+	var auth intoto.Authenticator
+	if token := os.Getenv(metadataTokenEnv); token != "" {
+		auth = intoto.BearerToken(token)
+	}
+	return intoto.NewMetadataClient(metadataService, auth)
+}
+
+// submitLink submits the passed link to the metadata service passed with
+// '--metadata-service', if any.
+func submitLink(linkEnv intoto.Metadata) error {
+	if metadataService == "" {
+		return nil
+	}
+	if err := newMetadataClient().SubmitLink(context.Background(), linkEnv); err != nil {
+		return fmt.Errorf("failed to submit link metadata to %s: %w", metadataService, err)
+	}
+	return nil
+}
+
+// progressArtifactInterval is the number of hashed artifacts after which
+// printProgress prints the number of artifacts hashed so far.
+const progressArtifactInterval = 1000
+
+// printProgress returns a function that prints the progress of run, record
+// and verify to the passed writer, if '--progress' is passed, or nil.
+func printProgress(w io.Writer) intoto.ProgressFunc {
+	if !showProgress {
+		return nil
+	}
+	return func(event intoto.ProgressEvent) {
+		name := event.Stage
+		if event.Item != "" {
+			name += fmt.Sprintf(" '%s'", event.Item)
+		}
+		switch event.Kind {
+		case intoto.ProgressStageFinished:
+			status := "finished"
+			if event.Err != nil {
+				status = "failed"
+			}
+			fmt.Fprintf(w, "%s %s in %s\n", name, status, event.Elapsed.Round(time.Millisecond))
+		case intoto.ProgressArtifactHashed:
+			if event.Files%progressArtifactInterval == 0 || event.Files == event.TotalFiles {
+				fmt.Fprintf(w, "hashed %d/%d artifacts, %d bytes\n", event.Files, event.TotalFiles, event.Bytes)
+			}
+		}
+	}
+}
+
+// debugLogger is an intoto.Logger, which prints debug messages as a line of
+// the message and its key value pairs.
+type debugLogger struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *debugLogger) Debug(msg string, keysAndValues ...interface{}) {
+	var line strings.Builder
+	fmt.Fprintf(&line, "DEBUG %s", msg)
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		fmt.Fprintf(&line, " %v=%v", keysAndValues[i], keysAndValues[i+1])
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintln(l.w, line.String())
+}
+
+// newDebugLogger returns a logger that prints the debug messages of run,
+// record and verify to the passed writer, if '--debug' is passed, or nil.
+func newDebugLogger(w io.Writer) intoto.Logger {
+	if !debug {
+		return nil
+	}
+	return &debugLogger{w: w}
+}
@@ -1,8 +1,11 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"os"
 	"path/filepath"
+	"strings"
 
 	intoto "github.com/in-toto/in-toto-golang/in_toto"
 	"github.com/spf13/cobra"
@@ -13,7 +16,26 @@ var (
 	runDir         string
 	materialsPaths []string
 	productsPaths  []string
+	absentProducts []string
+	imageMaterials []string
+	imageProducts  []string
 	noCommand      bool
+	noStreams      bool
+	maxStdoutSize  int
+	maxStderrSize  int
+	toolchains     []string
+	// sshAgentKeyPath is the public key of the ssh-agent key links are signed
+	// with, see loadSSHAgentSigner
+	sshAgentKeyPath string
+	// keyless, fulcioURL and rekorURL configure signing with a Fulcio-issued
+	// certificate and logging to Rekor, see loadKeylessKey
+	keyless   bool
+	fulcioURL string
+	rekorURL  string
+	// sigstoreTUFRoot and sigstoreTUFURL configure the TUF repository the
+	// Sigstore trust root is obtained from, see verifyKeylessLink
+	sigstoreTUFRoot string
+	sigstoreTUFURL  string
 )
 
 var runCmd = &cobra.Command{
@@ -61,6 +83,67 @@ exist, be writable, and not be a symlink.`,
 the resulting link metadata.`,
 	)
 
+	runCmd.Flags().StringVarP(
+		&keyType,
+		"key-type",
+		"t",
+		"",
+		`Type of the key passed with '--key', i.e. 'rsa', 'ed25519'
+or 'ecdsa'. If not passed, the type is derived from the key
+file, otherwise the key must be of the passed type.`,
+	)
+
+	runCmd.Flags().StringVar(
+		&sshAgentKeyPath,
+		"ssh-agent-key",
+		"",
+		`Path to an OpenSSH public key, e.g. '~/.ssh/id_ed25519.pub',
+whose private key is held by the ssh-agent at SSH_AUTH_SOCK,
+to sign the resulting link metadata with instead of '--key'.`,
+	)
+
+	runCmd.Flags().BoolVar(
+		&keyless,
+		"keyless",
+		false,
+		`Sign the resulting link metadata with an ephemeral key, whose
+certificate Fulcio issues for the OIDC identity token in the
+SIGSTORE_ID_TOKEN environment variable, instead of '--key',
+and log the signature to Rekor.`,
+	)
+
+	runCmd.Flags().StringVar(
+		&fulcioURL,
+		"fulcio-url",
+		intoto.DefaultFulcioURL,
+		`URL of the Fulcio instance used with '--keyless'.`,
+	)
+
+	runCmd.Flags().StringVar(
+		&rekorURL,
+		"rekor-url",
+		intoto.DefaultRekorURL,
+		`URL of the Rekor instance used with '--keyless'.`,
+	)
+
+	runCmd.Flags().StringVar(
+		&sigstoreTUFRoot,
+		"sigstore-tuf-root",
+		"",
+		`Path to the trusted initial root metadata of the Sigstore TUF
+repository. If passed with '--keyless', the certificate and the
+Rekor log entry of the resulting link metadata are verified
+against the Sigstore trust root obtained from the repository.`,
+	)
+
+	runCmd.Flags().StringVar(
+		&sigstoreTUFURL,
+		"sigstore-tuf-url",
+		intoto.DefaultSigstoreTUFURL,
+		`URL of the Sigstore TUF repository used with
+'--sigstore-tuf-root'.`,
+	)
+
 	runCmd.Flags().StringVarP(
 		&certPath,
 		"cert",
@@ -90,6 +173,45 @@ are stored in the resulting link metadata after the
 command is executed. Symlinks are followed.`,
 	)
 
+	runCmd.Flags().StringVar(
+		&metadataService,
+		"metadata-service",
+		"",
+		`URL of a metadata service to submit the resulting link
+metadata to, in addition to writing it to the output directory.
+The bearer token in the IN_TOTO_METADATA_TOKEN environment
+variable is used for authentication, if set.`,
+	)
+
+	runCmd.Flags().StringArrayVar(
+		&imageMaterials,
+		"image-materials",
+		[]string{},
+		`Container images recorded as materials by the digest of their
+manifest, in '<name>=<source>' format. Sources are
+'docker://<ref>@<digest>', 'oci:<dir>[:<tag>]' or
+'oci-archive:<tar>[:<tag>]', e.g.
+'base=docker://example.com/base@sha256:...'.`,
+	)
+
+	runCmd.Flags().StringArrayVar(
+		&imageProducts,
+		"image-products",
+		[]string{},
+		`Container images recorded as products after the command is
+executed, in '<name>=<source>' format, see '--image-materials'.`,
+	)
+
+	runCmd.Flags().StringArrayVar(
+		&absentProducts,
+		"absent-products",
+		[]string{},
+		`Path pattern, e.g. '*.pem', that no recorded product may
+match after the command is executed. The pattern is asserted
+absent in the resulting link metadata, as required by ABSENT
+rules of a layout.`,
+	)
+
 	runCmd.Flags().StringVarP(
 		&outDir,
 		"metadata-directory",
@@ -121,8 +243,61 @@ of another.`,
 in environment variables or config files. See Config docs for details.`,
 	)
 
+	runCmd.Flags().StringVar(
+		&excludeSyntax,
+		"exclude-syntax",
+		"",
+		`Syntax of the '--exclude' patterns, e.g. 'extended' for
+'dir/**' and brace patterns, or 'fnmatch'. Defaults to
+gitignore-style patterns.`,
+	)
+
 	runCmd.MarkFlagRequired("name")
 
+	runCmd.Flags().StringSliceVar(
+		&hashAlgorithms,
+		"hash-algorithms",
+		[]string{"sha256"},
+		`Hash algorithms used to record artifacts. Supported are
+'sha256', 'sha384', 'sha512', 'blake2b' and 'blake2b-256'.`,
+	)
+
+	runCmd.Flags().StringSliceVar(
+		&toolchains,
+		"toolchains",
+		[]string{},
+		`Toolchains whose versions are recorded in the environment of
+the resulting link metadata, e.g. 'go,gcc,node', so that the
+layout can require approved toolchain versions.`,
+	)
+
+	runCmd.Flags().IntVar(
+		&hashWorkers,
+		"hash-workers",
+		0,
+		`Number of files hashed concurrently when recording artifacts.
+Defaults to the number of CPUs usable by the process.`,
+	)
+
+	runCmd.Flags().StringVar(
+		&artifactProfileName,
+		"artifact-profile",
+		"",
+		`Name of the artifact profile used to record artifacts. The
+profile sets the exclude patterns, lstrip paths, line
+normalization, hash algorithms and the handling of symlinks
+and empty directories, and cannot be combined with the
+corresponding flags. Requires '--artifact-profiles'.`,
+	)
+
+	runCmd.Flags().StringVar(
+		&artifactProfilesPath,
+		"artifact-profiles",
+		"",
+		`Path to a layout or JSON file that defines the artifact profile
+passed with '--artifact-profile'.`,
+	)
+
 	runCmd.Flags().BoolVar(
 		&lineNormalization,
 		"normalize-line-endings",
@@ -132,6 +307,15 @@ operating systems. It is done by replacing all line separators
 with a new line character.`,
 	)
 
+	runCmd.Flags().BoolVar(
+		&textLineNormalization,
+		"normalize-text-line-endings",
+		false,
+		`Like '--normalize-line-endings', but only normalize line
+separators of text files, i.e. of files without NUL bytes in
+their first 8000 bytes, and hash binary files as is.`,
+	)
+
 	runCmd.Flags().BoolVarP(
 		&noCommand,
 		"no-command",
@@ -140,13 +324,118 @@ with a new line character.`,
 		`Indicate that there is no command to be executed for the step.`,
 	)
 
+	runCmd.Flags().BoolVar(
+		&noStreams,
+		"no-record-streams",
+		false,
+		`Do not record stdout and stderr of the command as byproducts.
+The streams are shown during command execution instead.`,
+	)
+
+	runCmd.Flags().IntVar(
+		&maxStdoutSize,
+		"max-stdout-size",
+		0,
+		`Maximum number of bytes of stdout recorded as byproduct.
+Further output is discarded. Zero means no limit.`,
+	)
+
+	runCmd.Flags().IntVar(
+		&maxStderrSize,
+		"max-stderr-size",
+		0,
+		`Maximum number of bytes of stderr recorded as byproduct.
+Further output is discarded. Zero means no limit.`,
+	)
+
 	runCmd.PersistentFlags().BoolVar(
 		&followSymlinkDirs,
 		"follow-symlink-dirs",
 		false,
 		`Follow symlinked directories to their targets. Note: this parameter
-toggles following linked directories only, linked files are always
-recorded independently of this parameter.`,
+toggles following linked directories only, linked files are
+recorded unless '--skip-symlinks' is passed.`,
+	)
+
+	runCmd.PersistentFlags().BoolVar(
+		&skipSymlinks,
+		"skip-symlinks",
+		false,
+		`Skip symlinked files and directories instead of recording
+their targets.`,
+	)
+
+	runCmd.PersistentFlags().StringVar(
+		&symlinkCyclePolicy,
+		"symlink-cycle-policy",
+		"",
+		`Handling of symlinks that lead to a cycle, i.e. 'error', the
+default, 'skip', or 'record-target' to record the symlink with
+the hashes of the path it points to.`,
+	)
+
+	runCmd.PersistentFlags().StringVar(
+		&specialFilePolicy,
+		"special-file-policy",
+		"",
+		`Handling of device files, sockets and FIFOs, i.e. 'skip', the
+default, or 'error'.`,
+	)
+
+	runCmd.PersistentFlags().BoolVar(
+		&recordEmptyDirs,
+		"record-empty-dirs",
+		false,
+		`Record empty directories as artifacts without hashes. Their
+names end with a slash.`,
+	)
+
+	runCmd.PersistentFlags().StringArrayVar(
+		&dirHashPatterns,
+		"dirhash",
+		[]string{},
+		`Path pattern to match directories that should be recorded as
+a single artifact, whose name ends with a slash, instead of one
+artifact per file. The artifact's hashes summarize the names and
+contents of all files in the directory like Go's dirhash.`,
+	)
+
+	runCmd.PersistentFlags().StringVar(
+		&dirHashMode,
+		"dirhash-mode",
+		"",
+		`Mode used to hash directories matched by '--dirhash', i.e.
+'dirhash', the default, or 'merkle' for a Merkle tree hash,
+in which the hash of a subdirectory does not depend on its
+location.`,
+	)
+
+	runCmd.PersistentFlags().StringArrayVar(
+		&goVendorPatterns,
+		"go-vendor",
+		[]string{},
+		`Path pattern to match Go vendor directories, e.g. 'vendor',
+that should be recorded by their vendored modules, i.e. by
+module path, version and go.sum hash, instead of one artifact
+per vendored file.`,
+	)
+
+	runCmd.PersistentFlags().BoolVar(
+		&detectTypes,
+		"detect-content-types",
+		false,
+		`Record the content types of artifacts, e.g.
+'application/gzip', in the environment of the link, so that
+the layout owner can restrict the types of artifacts.`,
+	)
+
+	runCmd.PersistentFlags().BoolVar(
+		&selfDigest,
+		"self-digest",
+		false,
+		`Embed a digest of the signed portion in the link file, so
+that files corrupted in storage or transit are detected when
+loaded.`,
 	)
 
 	runCmd.PersistentFlags().BoolVar(
@@ -156,6 +445,31 @@ recorded independently of this parameter.`,
 		"Create metadata using DSSE instead of the legacy signature wrapper.",
 	)
 
+	runCmd.Flags().StringVar(
+		&timestampURL,
+		"timestamp-url",
+		"",
+		`URL of an RFC 3161 time-stamping authority, which
+timestamps the signatures of the resulting link metadata, so
+that they can be verified after the signing certificate
+expired. Requires the legacy signature wrapper.`,
+	)
+
+	runCmd.Flags().BoolVar(
+		&showProgress,
+		"progress",
+		false,
+		`Print the progress of recording artifacts and running the command to stderr, i.e. the number of
+hashed artifacts and the time taken by each stage.`,
+	)
+
+	runCmd.Flags().BoolVar(
+		&debug,
+		"debug",
+		false,
+		`Print debug messages to stderr, e.g. about excluded and hashed artifacts.`,
+	)
+
 	runCmd.Flags().StringVar(
 		&spiffeUDS,
 		"spiffe-workload-api-path",
@@ -174,10 +488,87 @@ func run(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("no command arguments passed, please specify or use --no-command option")
 	}
 
-	metadata, err := intoto.InTotoRun(stepName, runDir, materialsPaths, productsPaths, args, key, []string{"sha256"}, exclude, lStripPaths, lineNormalization, followSymlinkDirs, useDSSE)
+	profile, err := getArtifactProfile(cmd)
+	if err != nil {
+		return err
+	}
+	intoto.ArtifactHashWorkers = hashWorkers
+
+	if maxStdoutSize < 0 || maxStderrSize < 0 {
+		return fmt.Errorf("'--max-stdout-size' and '--max-stderr-size' must not be negative")
+	}
+	byproducts := intoto.ByproductOptions{
+		DisableCapture: noStreams,
+		MaxStdoutSize:  maxStdoutSize,
+		MaxStderrSize:  maxStderrSize,
+	}
+
+	opts := []intoto.RunOption{
+		intoto.WithRunDir(runDir),
+		intoto.WithMaterials(materialsPaths...),
+		intoto.WithProducts(productsPaths...),
+		intoto.WithAbsentProducts(absentProducts...),
+		intoto.WithArtifactProfile(profile),
+		intoto.WithHashAlgorithms(profile.GetHashAlgorithms()...),
+		intoto.WithByproducts(byproducts),
+		intoto.WithUnsignedLink(),
+	}
+	if len(toolchains) > 0 {
+		opts = append(opts, intoto.WithToolchains(toolchains...))
+	}
+	if len(imageMaterials) > 0 {
+		sources, err := parseImageSources(imageMaterials)
+		if err != nil {
+			return fmt.Errorf("invalid '--image-materials': %w", err)
+		}
+		opts = append(opts, intoto.WithImageMaterials(sources))
+	}
+	if len(imageProducts) > 0 {
+		sources, err := parseImageSources(imageProducts)
+		if err != nil {
+			return fmt.Errorf("invalid '--image-products': %w", err)
+		}
+		opts = append(opts, intoto.WithImageProducts(sources))
+	}
+	if !useDSSE {
+		opts = append(opts, intoto.WithMetablock())
+	} else if keyless {
+		return fmt.Errorf("'--keyless' cannot be combined with '--use-dsse'")
+	}
+	if selfDigest {
+		opts = append(opts, intoto.WithSelfDigest())
+	}
+	if timestampURL != "" {
+		if useDSSE {
+			return fmt.Errorf("'--timestamp-url' cannot be combined with '--use-dsse'")
+		}
+		opts = append(opts, intoto.WithTimestamper(intoto.RFC3161Timestamper{URL: timestampURL}))
+	}
+	if progress := printProgress(cmd.ErrOrStderr()); progress != nil {
+		opts = append(opts, intoto.WithProgress(progress))
+	}
+	if logger := newDebugLogger(cmd.ErrOrStderr()); logger != nil {
+		opts = append(opts, intoto.WithLogger(logger))
+	}
+	if signer != nil {
+		opts = append(opts, intoto.WithSigner(signer))
+	}
+	metadata, err := intoto.RunContext(cmd.Context(), stepName, args, key, opts...)
 	if err != nil {
 		return fmt.Errorf("failed to create link metadata: %w", err)
 	}
+	if keyless {
+		entry, err := metadata.(*intoto.Metablock).AddRekorEntry(cmd.Context(), intoto.NewRekorClient(rekorURL), key)
+		if err != nil {
+			return fmt.Errorf("failed to log link metadata to rekor: %w", err)
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Logged link metadata to rekor at index %d\n", entry.LogIndex)
+		if err := verifyKeylessLink(cmd.Context(), metadata.(*intoto.Metablock)); err != nil {
+			return err
+		}
+	} else if sigstoreTUFRoot != "" {
+		return fmt.Errorf("'--sigstore-tuf-root' requires '--keyless'")
+	}
 
 	linkName := fmt.Sprintf(intoto.LinkNameFormat, metadata.GetPayload().(intoto.Link).Name, key.KeyID)
 
@@ -187,5 +578,53 @@ func run(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to write link metadata to %s: %w", linkPath, err)
 	}
 
-	return nil
+	return submitLink(metadata)
+}
+
+// parseImageSources parses the passed '<name>=<source>' pairs of container
+// images to a map of sources by artifact name.
+func parseImageSources(images []string) (map[string]string, error) {
+	sources := make(map[string]string, len(images))
+	for _, image := range images {
+		name, source, ok := strings.Cut(image, "=")
+		if !ok || name == "" || source == "" {
+			return nil, fmt.Errorf("'%s' is not in '<name>=<source>' format", image)
+		}
+		sources[name] = source
+	}
+	return sources, nil
+}
+
+/*
+verifyKeylessLink verifies the Rekor log entry of the passed keyless signed
+link and the Fulcio certificate of the signing key at the time of the entry,
+against the Sigstore trust root of the TUF repository passed with
+'--sigstore-tuf-url', if '--sigstore-tuf-root' is passed.  Verified TUF
+metadata is cached in the user cache directory.
+*/
+func verifyKeylessLink(ctx context.Context, linkMb *intoto.Metablock) error {
+	if sigstoreTUFRoot == "" {
+		return nil
+	}
+	initialRoot, err := os.ReadFile(sigstoreTUFRoot)
+	if err != nil {
+		return fmt.Errorf("failed to read sigstore tuf root: %w", err)
+	}
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return fmt.Errorf("failed to locate cache directory: %w", err)
+	}
+	client, err := intoto.NewSigstoreTUFClient(sigstoreTUFURL, initialRoot, filepath.Join(cacheDir, "in-toto", "sigstore-tuf"))
+	if err != nil {
+		return fmt.Errorf("invalid sigstore tuf root at %s: %w", sigstoreTUFRoot, err)
+	}
+	trustedRoot, err := client.TrustedRoot(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to obtain sigstore trust root: %w", err)
+	}
+	logged, err := intoto.VerifySignatureTimestamp(linkMb.Signatures[0], trustedRoot.RekorVerifiers()...)
+	if err != nil {
+		return fmt.Errorf("failed to verify rekor log entry: %w", err)
+	}
+	return trustedRoot.VerifyFulcioCertificate(key, logged)
 }
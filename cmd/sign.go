@@ -2,14 +2,19 @@ package cmd
 
 import (
 	"fmt"
+	"path/filepath"
 
 	intoto "github.com/in-toto/in-toto-golang/in_toto"
 	"github.com/spf13/cobra"
 )
 
 var (
-	outputPath string
-	verifyFile bool
+	outputPath       string
+	verifyFile       bool
+	appendSignature  bool
+	existingKeyPaths []string
+	revokeKeyIDs     []string
+	revokeReason     string
 )
 
 var signCmd = &cobra.Command{
@@ -27,7 +32,10 @@ func init() {
 		"output",
 		"o",
 		"",
-		`Path to store metadata file after signing`,
+		`Path to store metadata file after signing. If not passed,
+layout metadata is written to the path of the signed file and
+link metadata to '<name>.<keyid prefix>.link' in the directory
+of the signed file.`,
 	)
 
 	signCmd.Flags().StringVarP(
@@ -48,6 +56,53 @@ root layout's signature(s). Passing exactly one key using
 '--key' is required.`,
 	)
 
+	signCmd.Flags().StringVarP(
+		&keyType,
+		"key-type",
+		"t",
+		"",
+		`Type of the key passed with '--key', i.e. 'rsa', 'ed25519'
+or 'ecdsa'. If not passed, the type is derived from the key
+file, otherwise the key must be of the passed type.`,
+	)
+
+	signCmd.Flags().BoolVarP(
+		&appendSignature,
+		"append",
+		"a",
+		false,
+		`Add the signature to the existing signatures instead of
+replacing them, e.g. to add a layout key. An existing signature
+of the same key is replaced. Only available for layouts.`,
+	)
+
+	signCmd.Flags().StringSliceVar(
+		&existingKeyPaths,
+		"existing-keys",
+		[]string{},
+		`Path(s) to public key(s) to verify the existing signatures of
+the file with before signing. Signing fails if any existing
+signature does not verify with one of the keys.`,
+	)
+
+	signCmd.Flags().StringSliceVar(
+		&revokeKeyIDs,
+		"revoke-key",
+		[]string{},
+		`Key ID(s) of functionary keys to revoke in the layout before
+signing, so that links signed with them fail verification.
+Existing signatures are replaced, because they do not cover the
+changed layout.`,
+	)
+
+	signCmd.Flags().StringVar(
+		&revokeReason,
+		"revoke-reason",
+		"",
+		`Reason recorded for the keys revoked with '--revoke-key',
+e.g. 'key compromise'.`,
+	)
+
 	signCmd.Flags().BoolVar(
 		&verifyFile,
 		"verify",
@@ -65,9 +120,12 @@ func sign(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to load layout at %s: %w", layoutPath, err)
 	}
 
+	if err := validateKeyType(keyType); err != nil {
+		return err
+	}
 	key = intoto.Key{}
-	if err := key.LoadKeyDefaults(keyPath); err != nil {
-		return fmt.Errorf("invalid key at %s: %w", keyPath, err)
+	if err := loadKeyOfType(&key, keyPath, keyType); err != nil {
+		return err
 	}
 
 	if verifyFile {
@@ -77,11 +135,54 @@ func sign(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
+	if len(existingKeyPaths) > 0 {
+		existingKeys := make(map[string]intoto.Key, len(existingKeyPaths))
+		for _, path := range existingKeyPaths {
+			var existingKey intoto.Key
+			if err := loadKeyOfType(&existingKey, path, ""); err != nil {
+				return err
+			}
+			existingKeys[existingKey.KeyID] = existingKey
+		}
+		if err := intoto.VerifyExistingSignatures(layoutEnv, existingKeys); err != nil {
+			return fmt.Errorf("existing signature verification failed: %w", err)
+		}
+	}
+
+	// Links are signed by a single functionary, and named after its key
+	_, isLink := layoutEnv.GetPayload().(intoto.Link)
+	if isLink && appendSignature {
+		return fmt.Errorf("'--append' is only available for layouts")
+	}
+	if len(revokeKeyIDs) > 0 {
+		layout, ok := layoutEnv.GetPayload().(intoto.Layout)
+		if !ok {
+			return fmt.Errorf("'--revoke-key' is only available for layouts")
+		}
+		if appendSignature {
+			return fmt.Errorf("'--revoke-key' cannot be combined with '--append'")
+		}
+		for _, keyID := range revokeKeyIDs {
+			if err := layout.RevokeKey(keyID, revokeReason); err != nil {
+				return err
+			}
+		}
+		if err := intoto.SetLayout(layoutEnv, layout); err != nil {
+			return err
+		}
+	}
 	if len(outputPath) == 0 {
 		outputPath = layoutPath
+		if isLink {
+			linkName, err := intoto.LinkFilename(layoutEnv, key)
+			if err != nil {
+				return err
+			}
+			outputPath = filepath.Join(filepath.Dir(layoutPath), linkName)
+		}
 	}
 
-	if err := layoutEnv.Sign(key); err != nil {
+	if err := intoto.Resign(layoutEnv, key, !appendSignature); err != nil {
 		return err
 	}
 	return layoutEnv.Dump(outputPath)
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"fmt"
+
+	intoto "github.com/in-toto/in-toto-golang/in_toto"
+	"github.com/spf13/cobra"
+)
+
+var (
+	testVectorsSeed string
+	testVectorsDir  string
+)
+
+var testVectorsCmd = &cobra.Command{
+	Use:   "test-vectors",
+	Short: "Generate reproducible demo supply chains for verification tests",
+	Long: `Generate reproducible demo supply chains, i.e. keys, a layout and
+links, which are valid or tampered with in various ways, together
+with a manifest of their expected verification results. The same
+seed always yields the same files, so that downstream projects can
+use them as fixtures for their own verification tests.`,
+	Args: cobra.NoArgs,
+	RunE: testVectors,
+}
+
+func init() {
+	rootCmd.AddCommand(testVectorsCmd)
+
+	testVectorsCmd.Flags().StringVar(
+		&testVectorsSeed,
+		"seed",
+		"",
+		`Seed all keys and artifacts are derived from`,
+	)
+	testVectorsCmd.MarkFlagRequired("seed") //nolint:errcheck
+
+	testVectorsCmd.Flags().StringVarP(
+		&testVectorsDir,
+		"output-directory",
+		"d",
+		"./",
+		`Directory to write the test vectors to`,
+	)
+}
+
+func testVectors(cmd *cobra.Command, args []string) error {
+	vectors, err := intoto.GenerateTestVectors(testVectorsDir, []byte(testVectorsSeed))
+	if err != nil {
+		return fmt.Errorf("failed to generate test vectors: %w", err)
+	}
+	for _, vector := range vectors.Vectors {
+		expected := "passes"
+		if vector.Err != nil {
+			expected = "fails: " + vector.ExpectedError
+		}
+		fmt.Printf("%s: %s (%s)\n", vector.Name, vector.Description, expected)
+	}
+	return nil
+}
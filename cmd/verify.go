@@ -1,17 +1,44 @@
 package cmd
 
 import (
+	"context"
+	"crypto/x509"
 	"fmt"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	intoto "github.com/in-toto/in-toto-golang/in_toto"
 	"github.com/spf13/cobra"
 )
 
 var (
-	pubKeyPaths       []string
-	linkDir           string
-	intermediatePaths []string
+	pubKeyPaths        []string
+	pubKeyTypes        []string
+	gpgKeyPaths        []string
+	linkDir            string
+	intermediatePaths  []string
+	reportPath         string
+	reportFormat       string
+	eventSinkURL       string
+	denylistPath       string
+	denylistKeyPaths   []string
+	inspectionTimeout  time.Duration
+	inspectionEnv      []string
+	inspectionCleanEnv bool
+	verificationTime   string
+	clockSkew          time.Duration
+	tsaCertPaths       []string
+	gitDir             string
+	allowedTypes       []string
+	// tufRoot and tufURL configure the TUF repository the targets passed
+	// with tufLayout and tufLayoutKeys are obtained from, see newTUFClient
+	tufRoot       string
+	tufURL        string
+	tufLayout     string
+	tufLayoutKeys []string
 )
 
 var verifyCmd = &cobra.Command{
@@ -43,8 +70,28 @@ func init() {
 		[]string{},
 		`Path(s) to PEM formatted public key(s), used to verify the passed 
 root layout's signature(s). Passing at least one key using
-'--layout-keys' is required. For each passed key the layout
-must carry a valid signature.`,
+'--layout-keys' or '--gpg-layout-keys' is required. For each
+passed key the layout must carry a valid signature.`,
+	)
+
+	verifyCmd.Flags().StringSliceVarP(
+		&pubKeyTypes,
+		"key-types",
+		"t",
+		[]string{},
+		`Type(s) of the keys passed with '--layout-keys', i.e. 'rsa',
+'ed25519' or 'ecdsa', in the same order. If not passed, the
+types are derived from the key files.`,
+	)
+
+	verifyCmd.Flags().StringSliceVar(
+		&gpgKeyPaths,
+		"gpg-layout-keys",
+		[]string{},
+		`Path(s) to GPG public key(s), either ASCII armored or exported
+as binary keyring, used to verify the passed root layout's
+signature(s). For each passed key the layout must carry a
+valid signature.`,
 	)
 
 	verifyCmd.Flags().StringVarP(
@@ -67,8 +114,183 @@ the chain of trust to the layout's trusted root. These will be used in
 addition to any intermediates in the layout.`,
 	)
 
-	verifyCmd.MarkFlagRequired("layout")
-	verifyCmd.MarkFlagRequired("layout-keys")
+	verifyCmd.Flags().StringVar(
+		&reportPath,
+		"report",
+		"",
+		`Path to write a verification report to. The report is written
+regardless of whether verification passes or fails.`,
+	)
+
+	verifyCmd.Flags().StringVar(
+		&reportFormat,
+		"report-format",
+		"sarif",
+		`Format of the verification report, one of 'sarif' or 'html'.`,
+	)
+
+	verifyCmd.Flags().StringVar(
+		&eventSinkURL,
+		"event-sink",
+		"",
+		`URL of an HTTP endpoint to publish the verification result to
+as CloudEvent. The event is published regardless of whether
+verification passes or fails.`,
+	)
+
+	verifyCmd.Flags().StringVar(
+		&denylistPath,
+		"denylist",
+		"",
+		`Path to a signed denylist of revoked link metadata. Revoked
+links are ignored during verification. Requires
+'--denylist-keys'.`,
+	)
+
+	verifyCmd.Flags().StringSliceVar(
+		&denylistKeyPaths,
+		"denylist-keys",
+		[]string{},
+		`Path(s) to PEM formatted public key(s), used to verify the
+passed denylist's signature(s). For each passed key the
+denylist must carry a valid signature.`,
+	)
+
+	verifyCmd.Flags().DurationVar(
+		&inspectionTimeout,
+		"inspection-timeout",
+		0,
+		`Maximum duration of each inspection, e.g. '2m'. Inspections
+that do not finish in time are killed and fail verification.
+Zero means no limit.`,
+	)
+
+	verifyCmd.Flags().StringArrayVar(
+		&inspectionEnv,
+		"inspection-env",
+		[]string{},
+		`Environment variable in 'KEY=VALUE' format to run inspections
+with, passed once per variable. If passed, inspections are run
+with the passed variables only, instead of the environment of
+in-toto-verify.`,
+	)
+
+	verifyCmd.Flags().BoolVar(
+		&inspectionCleanEnv,
+		"inspection-clean-env",
+		false,
+		`Run inspections with an empty environment, apart from variables
+passed with '--inspection-env'.`,
+	)
+
+	verifyCmd.Flags().StringVar(
+		&verificationTime,
+		"verification-time",
+		"",
+		`Time to verify the layout expiration at instead of the current
+time, in '2006-01-02T15:04:05Z' format, e.g. to verify a
+historical layout or on a machine without a trusted clock.`,
+	)
+
+	verifyCmd.Flags().DurationVar(
+		&clockSkew,
+		"clock-skew",
+		0,
+		`Tolerated difference between the clocks of signers and the
+verifier, e.g. '5m'. It is applied to the layout expiration and
+to the validity of certificates of link signers, and recorded in
+the verification report.`,
+	)
+
+	verifyCmd.Flags().StringSliceVar(
+		&tsaCertPaths,
+		"tsa-certs",
+		[]string{},
+		`Path(s) to PEM formatted root certificates of trusted RFC 3161
+time-stamping authorities. If passed, each link signature must
+carry a timestamp by one of them, which is verified against the
+layout expiration, and certificates of link signers are verified
+at the timestamped time instead of the verification time.`,
+	)
+
+	verifyCmd.Flags().BoolVar(
+		&showProgress,
+		"progress",
+		false,
+		`Print the progress of verification, including inspections to stderr, i.e. the number of
+hashed artifacts and the time taken by each stage.`,
+	)
+
+	verifyCmd.Flags().BoolVar(
+		&debug,
+		"debug",
+		false,
+		`Print debug messages to stderr, e.g. about signature checks and the
+artifacts consumed by each artifact rule.`,
+	)
+
+	verifyCmd.Flags().StringArrayVar(
+		&allowedTypes,
+		"allowed-product-types",
+		[]string{},
+		`Content types allowed for the products of a step, in
+'<step>=<type>[,<type>...]' format, e.g.
+'sign=application/pgp-signature,application/gzip'. Types may
+contain wildcards, e.g. 'application/*'. Products without
+recorded content type fail verification, see
+'--detect-content-types' of run and record.`,
+	)
+
+	verifyCmd.Flags().StringVar(
+		&metadataService,
+		"metadata-service",
+		"",
+		`URL of a metadata service to load the links of the layout's
+steps from, instead of '--link-dir'. The bearer token in the
+IN_TOTO_METADATA_TOKEN environment variable is used for
+authentication, if set.`,
+	)
+
+	verifyCmd.Flags().StringVar(
+		&gitDir,
+		"git-dir",
+		"",
+		`Path to the git repository of the signed commits and tags that
+steps of the layout reference as evidence. Defaults to the
+current working directory.`,
+	)
+
+	verifyCmd.Flags().StringVar(
+		&tufRoot,
+		"tuf-root",
+		"",
+		`Path to the trusted initial root metadata of a TUF repository,
+to obtain the root layout and layout keys from with
+'--tuf-layout' and '--tuf-layout-keys'. Requires '--tuf-url'.`,
+	)
+
+	verifyCmd.Flags().StringVar(
+		&tufURL,
+		"tuf-url",
+		"",
+		`URL of the TUF repository used with '--tuf-root'.`,
+	)
+
+	verifyCmd.Flags().StringVar(
+		&tufLayout,
+		"tuf-layout",
+		"",
+		`Name of the TUF target of the root layout, e.g.
+'layouts/root.layout', instead of '--layout'.`,
+	)
+
+	verifyCmd.Flags().StringSliceVar(
+		&tufLayoutKeys,
+		"tuf-layout-keys",
+		[]string{},
+		`Name(s) of TUF targets of PEM formatted public key(s), used
+like '--layout-keys'.`,
+	)
 
 	verifyCmd.Flags().BoolVar(
 		&lineNormalization,
@@ -81,23 +303,84 @@ with a new line character.`,
 }
 
 func verify(cmd *cobra.Command, args []string) error {
-	layoutMb, err := intoto.LoadMetadata(layoutPath)
+	if reportFormat != "sarif" && reportFormat != "html" {
+		return fmt.Errorf("unsupported report format '%s'", reportFormat)
+	}
+
+	var tufClient *intoto.TUFClient
+	if tufRoot != "" {
+		client, err := newTUFClient()
+		if err != nil {
+			return err
+		}
+		tufClient = client
+	} else if tufLayout != "" || len(tufLayoutKeys) > 0 {
+		return fmt.Errorf("'--tuf-layout' and '--tuf-layout-keys' require '--tuf-root'")
+	}
+
+	var layoutMb intoto.Metadata
+	var err error
+	switch {
+	case layoutPath != "" && tufLayout != "":
+		return fmt.Errorf("'--layout' and '--tuf-layout' are mutually exclusive")
+	case tufLayout != "":
+		layoutPath = tufLayout
+		layoutMb, err = intoto.LoadTUFLayout(cmd.Context(), tufClient, tufLayout)
+	case layoutPath != "":
+		layoutMb, err = intoto.LoadMetadata(layoutPath)
+	default:
+		return fmt.Errorf("verification requires '--layout' or '--tuf-layout'")
+	}
 	if err != nil {
 		return fmt.Errorf("failed to load layout at %s: %w", layoutPath, err)
 	}
 
 	layoutKeys := make(map[string]intoto.Key, len(pubKeyPaths))
 
-	for _, pubKeyPath := range pubKeyPaths {
+	if len(pubKeyTypes) > 0 && len(pubKeyTypes) != len(pubKeyPaths) {
+		return fmt.Errorf("'--key-types' requires one type for each of the %d '--layout-keys'", len(pubKeyPaths))
+	}
+	for i, pubKeyPath := range pubKeyPaths {
 		var pubKey intoto.Key
 
-		if err := pubKey.LoadKeyDefaults(pubKeyPath); err != nil {
-			return fmt.Errorf("invalid key at %s: %w", pubKeyPath, err)
+		pubKeyType := ""
+		if len(pubKeyTypes) > 0 {
+			pubKeyType = pubKeyTypes[i]
+			if err := validateKeyType(pubKeyType); err != nil {
+				return err
+			}
+		}
+		if err := loadKeyOfType(&pubKey, pubKeyPath, pubKeyType); err != nil {
+			return err
 		}
 
 		layoutKeys[pubKey.KeyID] = pubKey
 	}
 
+	for _, gpgKeyPath := range gpgKeyPaths {
+		gpgKeys, err := intoto.LoadGPGKeys(gpgKeyPath)
+		if err != nil {
+			return fmt.Errorf("invalid gpg key at %s: %w", gpgKeyPath, err)
+		}
+		for keyID, gpgKey := range gpgKeys {
+			layoutKeys[keyID] = gpgKey
+		}
+	}
+
+	if len(tufLayoutKeys) > 0 {
+		tufKeys, err := intoto.LoadTUFLayoutKeys(cmd.Context(), tufClient, tufLayoutKeys...)
+		if err != nil {
+			return fmt.Errorf("failed to load layout keys from tuf repository: %w", err)
+		}
+		for keyID, tufKey := range tufKeys {
+			layoutKeys[keyID] = tufKey
+		}
+	}
+
+	if len(layoutKeys) == 0 {
+		return fmt.Errorf("verification requires '--layout-keys', '--gpg-layout-keys' or '--tuf-layout-keys'")
+	}
+
 	intermediatePems := make([][]byte, 0, len(intermediatePaths))
 	for _, intermediate := range intermediatePaths {
 		pemBytes, err := os.ReadFile(intermediate)
@@ -108,10 +391,166 @@ func verify(cmd *cobra.Command, args []string) error {
 		intermediatePems = append(intermediatePems, pemBytes)
 	}
 
-	_, err = intoto.InTotoVerify(layoutMb, layoutKeys, linkDir, "", make(map[string]string), intermediatePems, lineNormalization)
+	inspectionOpts := intoto.InspectionOptions{Timeout: inspectionTimeout}
+	if inspectionCleanEnv || len(inspectionEnv) > 0 {
+		inspectionOpts.Env = append([]string{}, inspectionEnv...)
+	}
+
+	// Command misalignment and link names are checked like in the reference
+	// implementation, i.e. not at all or with a warning only
+	verifyOpts := []intoto.VerifyOption{
+		intoto.WithIntermediateCertificates(intermediatePems...),
+		intoto.WithInspectionOptions(inspectionOpts),
+		intoto.AllowCommandMisalignment(),
+		intoto.AllowLinkNameMismatch(),
+	}
+	if lineNormalization {
+		verifyOpts = append(verifyOpts, intoto.WithLineNormalization())
+	}
+	if verificationTime != "" {
+		now, timeErr := time.Parse(intoto.ISO8601DateSchema, verificationTime)
+		if timeErr != nil {
+			return fmt.Errorf("invalid verification time '%s': %w", verificationTime, timeErr)
+		}
+		verifyOpts = append(verifyOpts, intoto.WithVerificationTime(now))
+	}
+	if clockSkew < 0 {
+		return fmt.Errorf("invalid clock skew '%s'", clockSkew)
+	}
+	if clockSkew > 0 {
+		verifyOpts = append(verifyOpts, intoto.WithClockSkewTolerance(clockSkew))
+	}
+	if len(tsaCertPaths) > 0 {
+		tsaRoots := x509.NewCertPool()
+		for _, tsaCertPath := range tsaCertPaths {
+			pemBytes, err := os.ReadFile(tsaCertPath)
+			if err != nil {
+				return fmt.Errorf("failed to read tsa certificate %s: %w", tsaCertPath, err)
+			}
+			if !tsaRoots.AppendCertsFromPEM(pemBytes) {
+				return fmt.Errorf("no certificates found in tsa certificate %s", tsaCertPath)
+			}
+		}
+		verifyOpts = append(verifyOpts, intoto.WithTimestampVerifiers(intoto.RFC3161Verifier{Roots: tsaRoots}))
+	}
+	if progress := printProgress(cmd.ErrOrStderr()); progress != nil {
+		verifyOpts = append(verifyOpts, intoto.WithVerificationProgress(progress))
+	}
+	if logger := newDebugLogger(cmd.ErrOrStderr()); logger != nil {
+		verifyOpts = append(verifyOpts, intoto.WithVerificationLogger(logger))
+	}
+	if metadataService != "" {
+		verifyOpts = append(verifyOpts, intoto.WithLinkStore(newMetadataClient()))
+	}
+	if gitDir != "" {
+		verifyOpts = append(verifyOpts, intoto.WithGitRepository(gitDir))
+	}
+	for _, allowed := range allowedTypes {
+		stepName, types, ok := strings.Cut(allowed, "=")
+		if !ok || stepName == "" || types == "" {
+			return fmt.Errorf("invalid allowed product types '%s', expected '<step>=<type>[,<type>...]'", allowed)
+		}
+		verifyOpts = append(verifyOpts, intoto.WithAllowedProductContentTypes(stepName, strings.Split(types, ",")...))
+	}
+	if denylistPath != "" {
+		denylist, denylistErr := loadDenylist()
+		if denylistErr != nil {
+			return denylistErr
+		}
+		verifyOpts = append(verifyOpts, intoto.WithDenylist(denylist))
+	}
+	_, err = intoto.VerifyContext(cmd.Context(), layoutMb, layoutKeys, linkDir, verifyOpts...)
+
+	if reportPath != "" || eventSinkURL != "" {
+		report := intoto.NewVerificationReport(layoutPath, layoutMb, err)
+		if clockSkew > 0 {
+			report.ClockSkewTolerance = clockSkew.String()
+		}
+		if reportPath != "" {
+			if reportErr := writeReport(report); reportErr != nil {
+				return reportErr
+			}
+		}
+		if eventSinkURL != "" {
+			emitter := intoto.NewEventEmitter("in-toto-golang", &intoto.HTTPEventSink{URL: eventSinkURL})
+			if emitErr := emitter.EmitVerificationResult(context.Background(), report); emitErr != nil {
+				return fmt.Errorf("failed to publish verification result: %w", emitErr)
+			}
+		}
+	}
+
 	if err != nil {
 		return fmt.Errorf("inspection failed: %w", err)
 	}
 
 	return nil
 }
+
+/*
+newTUFClient creates a client of the TUF repository passed with '--tuf-url',
+trusting the initial root metadata passed with '--tuf-root'.  Verified TUF
+metadata and targets are cached in the user cache directory.
+*/
+func newTUFClient() (*intoto.TUFClient, error) {
+	if tufURL == "" {
+		return nil, fmt.Errorf("'--tuf-root' requires '--tuf-url'")
+	}
+	initialRoot, err := os.ReadFile(tufRoot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tuf root: %w", err)
+	}
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate cache directory: %w", err)
+	}
+	client, err := intoto.NewTUFClient(tufURL, initialRoot, filepath.Join(cacheDir, "in-toto", "tuf", url.PathEscape(tufURL)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid tuf root at %s: %w", tufRoot, err)
+	}
+	return client, nil
+}
+
+func loadDenylist() (*intoto.Denylist, error) {
+	if len(denylistKeyPaths) == 0 {
+		return nil, fmt.Errorf("verifying a denylist requires '--denylist-keys'")
+	}
+
+	denylistEnv, err := intoto.LoadMetadata(denylistPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load denylist at %s: %w", denylistPath, err)
+	}
+
+	denylistKeys := make(map[string]intoto.Key, len(denylistKeyPaths))
+	for _, keyPath := range denylistKeyPaths {
+		var key intoto.Key
+		if err := key.LoadKeyDefaults(keyPath); err != nil {
+			return nil, fmt.Errorf("invalid key at %s: %w", keyPath, err)
+		}
+		denylistKeys[key.KeyID] = key
+	}
+
+	denylist, err := intoto.VerifyDenylist(denylistEnv, denylistKeys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify denylist at %s: %w", denylistPath, err)
+	}
+	return denylist, nil
+}
+
+func writeReport(report *intoto.VerificationReport) error {
+	reportFile, err := os.Create(reportPath)
+	if err != nil {
+		return fmt.Errorf("failed to create report at %s: %w", reportPath, err)
+	}
+	defer reportFile.Close()
+
+	if reportFormat == "html" {
+		err = report.RenderHTML(reportFile)
+	} else {
+		err = report.RenderSARIF(reportFile)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write report to %s: %w", reportPath, err)
+	}
+
+	return reportFile.Close()
+}
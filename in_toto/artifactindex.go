@@ -0,0 +1,123 @@
+package in_toto
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+/*
+artifactIndex indexes the artifact paths of a link by path prefix, so that
+artifact rules only match their pattern against the artifacts starting with
+the literal prefix of the pattern, e.g. against the artifacts in 'src/' for
+the pattern 'src/*.go', instead of against all artifacts of the link.  For
+case-insensitive matching, paths are indexed in lower case.
+*/
+type artifactIndex struct {
+	// keys holds the sorted, optionally lower case, paths
+	keys []string
+	// paths holds the path of each key
+	paths []string
+	m     artifactMatcher
+}
+
+// newArtifactIndex indexes the passed artifact paths for matching with the
+// passed matcher.
+func newArtifactIndex(artifactPaths Set, m artifactMatcher) artifactIndex {
+	index := artifactIndex{m: m, paths: artifactPaths.Slice()}
+	index.keys = make([]string, 0, len(index.paths))
+	for _, artifactPath := range index.paths {
+		index.keys = append(index.keys, index.key(artifactPath))
+	}
+	sort.Sort(index)
+	return index
+}
+
+func (index artifactIndex) Len() int           { return len(index.keys) }
+func (index artifactIndex) Less(i, j int) bool { return index.keys[i] < index.keys[j] }
+func (index artifactIndex) Swap(i, j int) {
+	index.keys[i], index.keys[j] = index.keys[j], index.keys[i]
+	index.paths[i], index.paths[j] = index.paths[j], index.paths[i]
+}
+
+// key returns the index key of the passed path or pattern prefix.
+func (index artifactIndex) key(s string) string {
+	if index.m.caseInsensitive {
+		return strings.ToLower(s)
+	}
+	return s
+}
+
+/*
+withPrefix returns the indexed paths starting with the passed prefix, or all
+paths if the matcher does not only match patterns against paths starting
+with their literal prefix, see literalPatternPrefix.
+*/
+func (index artifactIndex) withPrefix(prefix string) []string {
+	if !index.m.matchesLiteralPrefix() {
+		return index.paths
+	}
+	prefix = index.key(prefix)
+	start := sort.SearchStrings(index.keys, prefix)
+	end := start
+	for end < len(index.keys) && strings.HasPrefix(index.keys[end], prefix) {
+		end++
+	}
+	return index.paths[start:end]
+}
+
+/*
+filter returns the paths of the passed queue, i.e. a subset of the indexed
+paths, which match the passed pattern, like Set.filter, but only matches the
+paths starting with the literal prefix of the pattern.
+*/
+func (index artifactIndex) filter(queue Set, pattern string) Set {
+	res := NewSet()
+	for _, artifactPath := range index.withPrefix(literalPatternPrefix(pattern)) {
+		if !queue.Has(artifactPath) {
+			continue
+		}
+		matched, err := index.m.match(pattern, artifactPath)
+		if err != nil {
+			fmt.Printf("WARNING: %s, pattern was '%s'\n", err, pattern)
+			continue
+		}
+		if matched {
+			res.Add(artifactPath)
+		}
+	}
+	return res
+}
+
+/*
+literalPatternPrefix returns the prefix of the passed pattern up to its first
+special character in PatternSyntaxFnmatch or PatternSyntaxExtended, which
+every path matching the pattern starts with.
+*/
+func literalPatternPrefix(pattern string) string {
+	if i := strings.IndexAny(pattern, `*?[\{`); i >= 0 {
+		return pattern[:i]
+	}
+	return pattern
+}
+
+/*
+withTrimmedPrefix returns the indexed paths, which may match the passed
+pattern after the passed prefix is trimmed from them, like the source
+artifacts of a MATCH rule, see verifyMatchRule.  These are the paths starting
+with the prefix followed by the literal prefix of the pattern, and the paths
+without the prefix starting with the literal prefix of the pattern.
+*/
+func (index artifactIndex) withTrimmedPrefix(prefix string, pattern string) []string {
+	literal := literalPatternPrefix(pattern)
+	if prefix == "" || !index.m.matchesLiteralPrefix() {
+		return index.withPrefix(literal)
+	}
+	candidates := append([]string{}, index.withPrefix(prefix+literal)...)
+	for _, artifactPath := range index.withPrefix(literal) {
+		if trimArtifactPrefix(artifactPath, prefix, index.m.caseInsensitive) == artifactPath {
+			candidates = append(candidates, artifactPath)
+		}
+	}
+	return candidates
+}
@@ -0,0 +1,60 @@
+package in_toto
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArtifactIndexFilter(t *testing.T) {
+	artifacts := NewSet("foo", "foo.py", "foobar", "src/a.go", "src/b.go", "src/sub/c.go",
+		"Src/D.go", "srcs/e.go", "docs/README.md", "a[1].txt")
+	patterns := []string{"*", "foo", "foo*", "src/*", "src/*.go", "src/sub/*", "SRC/*.GO", "src/?.go",
+		"[sd]*", "docs/**", "*.{go,md}", "a\\[1\\].txt", "missing/*", ""}
+
+	for _, syntax := range []string{PatternSyntaxFnmatch, PatternSyntaxExtended} {
+		for _, matching := range []string{ArtifactMatchingCaseSensitive, ArtifactMatchingCaseInsensitive} {
+			m, err := newArtifactMatcher(Layout{PatternSyntax: syntax, ArtifactMatching: matching})
+			if err != nil {
+				t.Fatal(err)
+			}
+			index := newArtifactIndex(artifacts, m)
+			queue := artifacts.Difference(NewSet("src/b.go"))
+			for _, pattern := range patterns {
+				// The index matches the same artifacts as matching all artifacts
+				assert.Equal(t, queue.filter(pattern, m), index.filter(queue, pattern), syntax, matching, pattern)
+
+				for _, prefix := range []string{"", "src/", "SRC/"} {
+					var expected []string
+					for artifactPath := range artifacts {
+						if matched, _ := m.match(pattern, trimArtifactPrefix(artifactPath, prefix, m.caseInsensitive)); matched {
+							expected = append(expected, artifactPath)
+						}
+					}
+					var got []string
+					for _, artifactPath := range index.withTrimmedPrefix(prefix, pattern) {
+						if matched, _ := m.match(pattern, trimArtifactPrefix(artifactPath, prefix, m.caseInsensitive)); matched {
+							got = append(got, artifactPath)
+						}
+					}
+					sort.Strings(expected)
+					sort.Strings(got)
+					assert.Equal(t, expected, got, syntax, matching, prefix, pattern)
+				}
+			}
+		}
+	}
+
+	// Patterns of other syntaxes are matched against all artifacts
+	RegisterPatternSyntax("suffix", PatternMatcherFunc(func(pattern, name string) (bool, error) {
+		return len(name) >= len(pattern) && name[len(name)-len(pattern):] == pattern, nil
+	}))
+	defer RegisterPatternSyntax("suffix", nil)
+	m, err := newArtifactMatcher(Layout{PatternSyntax: "suffix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, NewSet("src/a.go"), newArtifactIndex(artifacts, m).filter(artifacts, "a.go"))
+	assert.Equal(t, NewSet("src/sub/c.go"), newArtifactIndex(artifacts, m).filter(artifacts, "sub/c.go"))
+}
@@ -0,0 +1,120 @@
+package in_toto
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// ErrSpecialFile signals a device file, socket or FIFO found by
+// RecordArtifacts, whose SpecialFilePolicy is ArtifactPolicyError.
+var ErrSpecialFile = errors.New("special file detected")
+
+// ErrUnknownArtifactPolicy is returned for symlink cycle and special file
+// policies other than the ArtifactPolicy constants allowed for them.
+var ErrUnknownArtifactPolicy = errors.New("unknown artifact policy")
+
+const (
+	// ArtifactPolicyError aborts recording artifacts with an error, i.e.
+	// ErrSymCycle or ErrSpecialFile.  It is the default for symlink cycles.
+	ArtifactPolicyError = "error"
+	// ArtifactPolicySkip skips the path, like the Python implementation does.
+	// It is the default for special files.
+	ArtifactPolicySkip = "skip"
+	// ArtifactPolicyRecordTarget records a symlink, which leads to a cycle,
+	// as artifact whose digests are those of its target string, i.e. of the
+	// path the symlink points to, like git records symlinks.
+	ArtifactPolicyRecordTarget = "record-target"
+)
+
+// SymlinkContentType is the content type of symlinks recorded with
+// ArtifactPolicyRecordTarget.
+const SymlinkContentType = "inode/symlink"
+
+/*
+validateArtifactPolicies checks that the symlink cycle policy of the passed
+profile is empty, ArtifactPolicyError, ArtifactPolicySkip or
+ArtifactPolicyRecordTarget, and that its special file policy is empty,
+ArtifactPolicySkip or ArtifactPolicyError.
+*/
+func validateArtifactPolicies(profile ArtifactProfile) error {
+	switch profile.SymlinkCyclePolicy {
+	case "", ArtifactPolicyError, ArtifactPolicySkip, ArtifactPolicyRecordTarget:
+	default:
+		return fmt.Errorf("%w for symlink cycles: '%s'", ErrUnknownArtifactPolicy, profile.SymlinkCyclePolicy)
+	}
+	switch profile.SpecialFilePolicy {
+	case "", ArtifactPolicySkip, ArtifactPolicyError:
+	default:
+		return fmt.Errorf("%w for special files: '%s'", ErrUnknownArtifactPolicy, profile.SpecialFilePolicy)
+	}
+	return nil
+}
+
+// isSpecialFile reports whether the passed file mode is that of a device
+// file, socket, FIFO or other irregular file, i.e. neither of a regular file,
+// nor of a directory or symlink.
+func isSpecialFile(mode os.FileMode) bool {
+	return mode&(os.ModeDevice|os.ModeCharDevice|os.ModeNamedPipe|os.ModeSocket|os.ModeIrregular) != 0
+}
+
+/*
+realDir returns the absolute path of the passed directory with all symlinks
+resolved, which is compared to the directories of followed symlinks to detect
+cycles, see isSymlinkCycle.
+*/
+func realDir(path string) (string, error) {
+	evalPath, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(evalPath)
+}
+
+/*
+isSymlinkCycle reports whether following a symlink to the passed directory,
+given as real path, see realDir, leads to a cycle, i.e. whether the directory
+is one of the passed walked directories or one of their parents.  Walking the
+directory would then reach the symlink again.
+*/
+func isSymlinkCycle(dir string, walkedDirs []string) bool {
+	prefix := dir
+	if !strings.HasSuffix(prefix, string(filepath.Separator)) {
+		prefix += string(filepath.Separator)
+	}
+	for _, walked := range walkedDirs {
+		if walked == dir || strings.HasPrefix(walked, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isSymlinkLoop reports whether the symlink at the passed path cannot be
+// resolved, because it is part of a chain of symlinks pointing back to itself.
+func isSymlinkLoop(path string) bool {
+	_, err := os.Stat(path)
+	return errors.Is(err, syscall.ELOOP)
+}
+
+/*
+recordLinkTargets records the passed symlink targets by artifact name, see
+ArtifactPolicyRecordTarget, and adds them to the passed artifacts.  It returns
+an ErrNonUniqueArtifactName, if an artifact name is recorded more than once.
+*/
+func recordLinkTargets(artifacts map[string]HashObj, linkTargets map[string]string, hashAlgorithms []string) error {
+	for name, target := range linkTargets {
+		if _, exists := artifacts[name]; exists {
+			return fmt.Errorf("%w: %s", ErrNonUniqueArtifactName, name)
+		}
+		hashes, err := hashReader(strings.NewReader(filepath.ToSlash(target)), hashAlgorithms, false)
+		if err != nil {
+			return err
+		}
+		artifacts[name] = hashes
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package in_toto
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordArtifactsSpecialFiles(t *testing.T) {
+	if testOSisWindows() {
+		t.Skip("unix sockets are not reported as special files on windows")
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "foo"), []byte("foo"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("unix", filepath.Join(dir, "socket"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	// Special files are skipped by default, like in the Python implementation
+	for _, policy := range []string{"", ArtifactPolicySkip} {
+		artifacts, err := ArtifactProfile{SpecialFilePolicy: policy, LStripPaths: []string{dir + "/"}}.RecordArtifacts([]string{dir})
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"foo"}, NewSet(artifactsDictKeyStrings(artifacts)...).sortedSlice())
+	}
+
+	_, err = ArtifactProfile{SpecialFilePolicy: ArtifactPolicyError}.RecordArtifacts([]string{dir})
+	assert.ErrorIs(t, err, ErrSpecialFile)
+	_, err = ArtifactProfile{SpecialFilePolicy: ArtifactPolicyRecordTarget}.RecordArtifacts([]string{dir})
+	assert.ErrorIs(t, err, ErrUnknownArtifactPolicy)
+}
+
+func TestRecordArtifactsSymlinkCyclePolicy(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "foo"), []byte("foo"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(dir, filepath.Join(dir, "up")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("loopB", filepath.Join(dir, "loopA")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("loopA", filepath.Join(dir, "loopB")); err != nil {
+		t.Fatal(err)
+	}
+	profile := ArtifactProfile{FollowSymlinkDirs: true, LStripPaths: []string{dir + "/"}}
+
+	// Symlinks to a parent directory and chains of symlinks are cycles
+	for _, policy := range []string{"", ArtifactPolicyError} {
+		profile.SymlinkCyclePolicy = policy
+		_, err := profile.RecordArtifacts([]string{dir})
+		assert.ErrorIs(t, err, ErrSymCycle)
+	}
+
+	profile.SymlinkCyclePolicy = ArtifactPolicySkip
+	artifacts, err := profile.RecordArtifacts([]string{dir})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"foo"}, NewSet(artifactsDictKeyStrings(artifacts)...).sortedSlice())
+
+	profile.SymlinkCyclePolicy = ArtifactPolicyRecordTarget
+	profile.DetectContentTypes = true
+	artifacts, contentTypes, err := recordArtifactsWithContentTypes(context.Background(), []string{dir}, []string{"sha256"}, profile)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"foo", "loopA", "loopB", "up"}, NewSet(artifactsDictKeyStrings(artifacts)...).sortedSlice())
+	digest := sha256.Sum256([]byte(filepath.ToSlash(dir)))
+	assert.Equal(t, HashObj{"sha256": hex.EncodeToString(digest[:])}, artifacts["up"])
+	digest = sha256.Sum256([]byte("loopB"))
+	assert.Equal(t, HashObj{"sha256": hex.EncodeToString(digest[:])}, artifacts["loopA"])
+	assert.Equal(t, SymlinkContentType, contentTypes["up"])
+
+	profile.SymlinkCyclePolicy = "follow"
+	_, err = profile.RecordArtifacts([]string{dir})
+	assert.ErrorIs(t, err, ErrUnknownArtifactPolicy)
+	assert.ErrorIs(t, validateArtifactProfile("cycles", profile), ErrUnknownArtifactPolicy)
+}
+
+// TestRecordArtifactsSymlinkedSibling makes sure that symlinks reached twice,
+// via a symlinked directory and directly, are no cycle.
+func TestRecordArtifactsSymlinkedSibling(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "shared"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "foo"), []byte("foo"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "foo"), filepath.Join(dir, "shared", "foo.sym")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "shared"), filepath.Join(dir, "a.sym")); err != nil {
+		t.Fatal(err)
+	}
+
+	artifacts, err := ArtifactProfile{FollowSymlinkDirs: true, LStripPaths: []string{dir + "/"}}.RecordArtifacts([]string{dir})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a.sym/foo.sym", "foo", "shared/foo.sym"}, NewSet(artifactsDictKeyStrings(artifacts)...).sortedSlice())
+}
+
+func TestIsSymlinkCycle(t *testing.T) {
+	walked := []string{filepath.FromSlash("/a/b"), filepath.FromSlash("/c")}
+	assert.True(t, isSymlinkCycle(filepath.FromSlash("/a/b"), walked))
+	assert.True(t, isSymlinkCycle(filepath.FromSlash("/a"), walked))
+	assert.True(t, isSymlinkCycle(string(filepath.Separator), walked))
+	assert.False(t, isSymlinkCycle(filepath.FromSlash("/a/b/d"), walked))
+	assert.False(t, isSymlinkCycle(filepath.FromSlash("/a/bc"), walked))
+	assert.False(t, isSymlinkCycle(filepath.FromSlash("/c"), nil))
+}
@@ -54,6 +54,10 @@ type StatementHeader struct {
 	Type          string    `json:"_type"`
 	PredicateType string    `json:"predicateType"`
 	Subject       []Subject `json:"subject"`
+	// Validity optionally restricts the time window, in which the statement
+	// is trusted, see VerifyAttestationWithOptions.  It is an extension of
+	// this library and ignored by other in-toto implementations.
+	Validity *StatementValidity `json:"validity,omitempty"`
 }
 
 /*
@@ -0,0 +1,139 @@
+package in_toto
+
+import (
+	"encoding/json"
+	"math"
+)
+
+const (
+	// ReturnValueByproductKey is the key of the exit code of the command of
+	// a link in its byproducts, see LinkByproducts.ReturnValue.
+	ReturnValueByproductKey = "return-value"
+	// StdoutByproductKey is the key of the captured standard output of the
+	// command of a link in its byproducts.
+	StdoutByproductKey = "stdout"
+	// StderrByproductKey is the key of the captured standard error of the
+	// command of a link in its byproducts.
+	StderrByproductKey = "stderr"
+)
+
+/*
+LinkByproducts are the byproducts of a link, i.e. the exit code and the
+captured output of its command, and custom byproducts, e.g. of a
+CommandExecutor.  Values decoded from JSON are generic, e.g. float64 for
+numbers, hence they are read with the typed accessors instead of type
+assertions.  Like a plain map, byproducts of unknown keys are kept when a
+link is decoded and encoded again.
+*/
+type LinkByproducts map[string]interface{}
+
+/*
+ReturnValue returns the exit code of the command of the link, and whether it
+is recorded as integer, regardless of whether the link was created by this
+package or decoded from JSON.
+*/
+func (b LinkByproducts) ReturnValue() (int, bool) {
+	switch retVal := b[ReturnValueByproductKey].(type) {
+	case int:
+		return retVal, true
+	case int64:
+		return int(retVal), true
+	case float64:
+		if retVal != math.Trunc(retVal) || math.Abs(retVal) > math.MaxInt32 {
+			return 0, false
+		}
+		return int(retVal), true
+	case json.Number:
+		value, err := retVal.Int64()
+		return int(value), err == nil
+	}
+	return 0, false
+}
+
+// SetReturnValue records the passed exit code, as float64 like decoded from
+// JSON.
+func (b *LinkByproducts) SetReturnValue(retVal int) {
+	b.SetCustom(ReturnValueByproductKey, float64(retVal))
+}
+
+// Stdout returns the captured standard output of the command of the link, or
+// an empty string if none is recorded.
+func (b LinkByproducts) Stdout() string {
+	stdout, _ := b[StdoutByproductKey].(string)
+	return stdout
+}
+
+// SetStdout records the passed standard output.
+func (b *LinkByproducts) SetStdout(stdout string) {
+	b.SetCustom(StdoutByproductKey, stdout)
+}
+
+// Stderr returns the captured standard error of the command of the link, or
+// an empty string if none is recorded.
+func (b LinkByproducts) Stderr() string {
+	stderr, _ := b[StderrByproductKey].(string)
+	return stderr
+}
+
+// SetStderr records the passed standard error.
+func (b *LinkByproducts) SetStderr(stderr string) {
+	b.SetCustom(StderrByproductKey, stderr)
+}
+
+/*
+Custom decodes the byproduct of the passed key into the value pointed to by v,
+like json.Unmarshal, and reports whether the byproduct exists.  Byproducts set
+by this package and decoded from JSON are decoded alike.
+*/
+func (b LinkByproducts) Custom(key string, v any) (bool, error) {
+	return decodeCustomField(b, key, v)
+}
+
+// SetCustom records the passed value as byproduct of the passed key.  The
+// value must be JSON serializable.
+func (b *LinkByproducts) SetCustom(key string, value any) {
+	if *b == nil {
+		*b = LinkByproducts{}
+	}
+	(*b)[key] = value
+}
+
+/*
+LinkEnvironment is the environment of a link, i.e. information about the
+environment the command of the link was run in, e.g. the recorded content
+types of its artifacts, see GetArtifactContentTypes.  Like LinkByproducts, it
+is read with typed accessors and keeps fields of unknown keys.
+*/
+type LinkEnvironment map[string]interface{}
+
+// Custom decodes the environment field of the passed key, see
+// LinkByproducts.Custom.
+func (e LinkEnvironment) Custom(key string, v any) (bool, error) {
+	return decodeCustomField(e, key, v)
+}
+
+// SetCustom records the passed value as environment field of the passed key.
+// The value must be JSON serializable.
+func (e *LinkEnvironment) SetCustom(key string, value any) {
+	if *e == nil {
+		*e = LinkEnvironment{}
+	}
+	(*e)[key] = value
+}
+
+/*
+decodeCustomField decodes the field of the passed key into the value pointed
+to by v.  Fields are converted via JSON, because links decoded from JSON hold
+generic values, and links created by this package typed values.
+*/
+func decodeCustomField(fields map[string]interface{}, key string, v any) (bool, error) {
+	value, ok := fields[key]
+	if !ok {
+		return false, nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return true, err
+	}
+	return true, json.Unmarshal(data, v)
+}
@@ -0,0 +1,76 @@
+package in_toto
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLinkByproducts(t *testing.T) {
+	type custom struct {
+		Runner string `json:"runner"`
+		Jobs   int    `json:"jobs"`
+	}
+	link := Link{Type: "link", Name: "build", Materials: map[string]HashObj{}, Products: map[string]HashObj{}}
+	link.ByProducts.SetReturnValue(2)
+	link.ByProducts.SetStdout("out")
+	link.ByProducts.SetStderr("err")
+	link.ByProducts.SetCustom("ci", custom{Runner: "linux", Jobs: 4})
+	link.Environment.SetCustom("ci", custom{Runner: "linux", Jobs: 4})
+
+	// Accessors behave alike before and after a JSON round trip, which also
+	// keeps unknown fields
+	var buf bytes.Buffer
+	if err := (&Metablock{Signed: link, Signatures: []Signature{}}).DumpTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := decodeMetadata(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range []Link{link, decoded.GetPayload().(Link)} {
+		retVal, ok := l.ByProducts.ReturnValue()
+		assert.True(t, ok)
+		assert.Equal(t, 2, retVal)
+		assert.Equal(t, "out", l.ByProducts.Stdout())
+		assert.Equal(t, "err", l.ByProducts.Stderr())
+		for _, fields := range []interface {
+			Custom(string, any) (bool, error)
+		}{l.ByProducts, l.Environment} {
+			var c custom
+			ok, err := fields.Custom("ci", &c)
+			assert.True(t, ok)
+			assert.Nil(t, err)
+			assert.Equal(t, custom{Runner: "linux", Jobs: 4}, c)
+			ok, err = fields.Custom("missing", &c)
+			assert.False(t, ok)
+			assert.Nil(t, err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		byProducts LinkByproducts
+		retVal     int
+		ok         bool
+	}{
+		{"int", LinkByproducts{"return-value": 1}, 1, true},
+		{"float", LinkByproducts{"return-value": float64(0)}, 0, true},
+		{"fraction", LinkByproducts{"return-value": 1.5}, 0, false},
+		{"string", LinkByproducts{"return-value": "0"}, 0, false},
+		{"missing", nil, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			retVal, ok := tt.byProducts.ReturnValue()
+			assert.Equal(t, tt.retVal, retVal)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, "", tt.byProducts.Stdout())
+		})
+	}
+
+	var c custom
+	_, err = LinkByproducts{"ci": "linux"}.Custom("ci", &c)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,108 @@
+package in_toto
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/secure-systems-lab/go-securesystemslib/dsse"
+)
+
+// ErrUnknownSpecVersion is returned when no Canonicalizer is registered for a
+// metadata spec version.
+var ErrUnknownSpecVersion = errors.New("unknown metadata spec version")
+
+const (
+	// SpecVersion09 is the in-toto spec version of v0.9 metablocks.
+	SpecVersion09 = "0.9"
+	// SpecVersion10 is the in-toto spec version of v1.0 metablocks, which are
+	// signed like v0.9 metablocks.
+	SpecVersion10 = "1.0"
+	// SpecVersionITE5 is the version of metadata in DSSE envelopes, as
+	// introduced by in-toto enhancement ITE-5.
+	SpecVersionITE5 = "ITE-5"
+)
+
+// metablockSpecVersion and envelopeSpecVersion are the spec versions
+// Metablocks and Envelopes are signed and verified with.
+const (
+	metablockSpecVersion = SpecVersion10
+	envelopeSpecVersion  = SpecVersionITE5
+)
+
+/*
+Canonicalizer prepares the bytes that are signed and verified for metadata of
+a spec version, see RegisterCanonicalizer.
+
+  - EncodePayload serializes a link or layout, e.g. as canonical JSON.
+  - SignableBytes returns the bytes that signatures are created over and
+    verified against, for the passed payload type and serialized payload,
+    e.g. the serialized payload itself or its DSSE pre-authentication
+    encoding.
+*/
+type Canonicalizer interface {
+	EncodePayload(payload any) ([]byte, error)
+	SignableBytes(payloadType string, payload []byte) []byte
+}
+
+// canonicalJSON signs the canonical JSON encoding of a payload, like
+// Metablocks of spec versions 0.9 and 1.0.
+type canonicalJSON struct{}
+
+func (canonicalJSON) EncodePayload(payload any) ([]byte, error) {
+	return EncodeCanonical(payload)
+}
+
+func (canonicalJSON) SignableBytes(_ string, payload []byte) []byte {
+	return payload
+}
+
+// dssePAE signs the DSSE pre-authentication encoding of the canonical JSON
+// encoding of a payload, like DSSE envelopes.
+type dssePAE struct{}
+
+func (dssePAE) EncodePayload(payload any) ([]byte, error) {
+	return EncodeCanonical(payload)
+}
+
+func (dssePAE) SignableBytes(payloadType string, payload []byte) []byte {
+	return dsse.PAE(payloadType, payload)
+}
+
+var (
+	canonicalizersMu sync.RWMutex
+	canonicalizers   = map[string]Canonicalizer{
+		SpecVersion09:   canonicalJSON{},
+		SpecVersion10:   canonicalJSON{},
+		SpecVersionITE5: dssePAE{},
+	}
+)
+
+/*
+RegisterCanonicalizer registers the passed Canonicalizer for the passed spec
+version, replacing the Canonicalizer registered before, if any.  Passing nil
+unregisters the spec version.  This allows to implement a canonicalization
+change of a future spec version, without changing how metadata is signed and
+verified.
+*/
+func RegisterCanonicalizer(specVersion string, c Canonicalizer) {
+	canonicalizersMu.Lock()
+	defer canonicalizersMu.Unlock()
+	if c == nil {
+		delete(canonicalizers, specVersion)
+		return
+	}
+	canonicalizers[specVersion] = c
+}
+
+// GetCanonicalizer returns the Canonicalizer registered for the passed spec
+// version, or an ErrUnknownSpecVersion.
+func GetCanonicalizer(specVersion string) (Canonicalizer, error) {
+	canonicalizersMu.RLock()
+	defer canonicalizersMu.RUnlock()
+	c, ok := canonicalizers[specVersion]
+	if !ok {
+		return nil, fmt.Errorf("%w: '%s'", ErrUnknownSpecVersion, specVersion)
+	}
+	return c, nil
+}
@@ -0,0 +1,102 @@
+package in_toto
+
+import (
+	"context"
+	"testing"
+
+	"github.com/in-toto/in-toto-golang/in_toto/keys"
+	"github.com/secure-systems-lab/go-securesystemslib/dsse"
+	"github.com/stretchr/testify/assert"
+)
+
+// prefixCanonicalizer signs a prefixed canonical JSON encoding, like a
+// hypothetical future spec version.
+type prefixCanonicalizer struct {
+	canonicalJSON
+}
+
+func (prefixCanonicalizer) SignableBytes(payloadType string, payload []byte) []byte {
+	return append([]byte("v2 "+payloadType+" "), payload...)
+}
+
+func TestGetCanonicalizer(t *testing.T) {
+	for _, version := range []string{SpecVersion09, SpecVersion10, SpecVersionITE5} {
+		_, err := GetCanonicalizer(version)
+		assert.Nil(t, err, version)
+	}
+	_, err := GetCanonicalizer("2.0")
+	assert.ErrorIs(t, err, ErrUnknownSpecVersion)
+
+	RegisterCanonicalizer("2.0", prefixCanonicalizer{})
+	c, err := GetCanonicalizer("2.0")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v2 t {}"), c.SignableBytes("t", []byte("{}")))
+	RegisterCanonicalizer("2.0", nil)
+	_, err = GetCanonicalizer("2.0")
+	assert.ErrorIs(t, err, ErrUnknownSpecVersion)
+}
+
+func TestCanonicalizerSignVerify(t *testing.T) {
+	var key Key
+	if err := key.LoadKey("carol", "ed25519", []string{"sha256", "sha512"}); err != nil {
+		t.Fatal(err)
+	}
+	link := Link{Type: "link", Name: "build"}
+
+	// Metablocks and envelopes are signed with the registered canonicalizer
+	for _, version := range []string{metablockSpecVersion, envelopeSpecVersion} {
+		defaultCanonicalizer, err := GetCanonicalizer(version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		RegisterCanonicalizer(version, prefixCanonicalizer{})
+
+		mb := &Metablock{Signed: link}
+		env := &Envelope{}
+		if err := env.SetPayload(link); err != nil {
+			t.Fatal(err)
+		}
+		for _, metadata := range []Metadata{mb, env} {
+			if err := metadata.Sign(key); err != nil {
+				t.Fatal(err)
+			}
+			assert.Nil(t, metadata.VerifySignature(key), version)
+		}
+
+		RegisterCanonicalizer(version, defaultCanonicalizer)
+		if version == metablockSpecVersion {
+			assert.NotNil(t, mb.VerifySignature(key))
+			assert.Nil(t, env.VerifySignature(key))
+		} else {
+			assert.Nil(t, mb.VerifySignature(key))
+			assert.ErrorIs(t, env.VerifySignature(key), ErrInvalidSignature)
+		}
+	}
+
+	// Envelopes are compatible with the DSSE library and keep all signatures
+	var otherKey Key
+	if err := otherKey.LoadKeyDefaults("alice"); err != nil {
+		t.Fatal(err)
+	}
+	env := &Envelope{}
+	if err := env.SetPayload(link); err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []Key{key, otherKey} {
+		if err := env.Sign(k); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert.Len(t, env.Sigs(), 2)
+	verifier, err := keys.NewSignerVerifier(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev, err := dsse.NewEnvelopeVerifier(verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ev.Verify(context.Background(), env.envelope)
+	assert.Nil(t, err)
+	assert.Nil(t, env.VerifySignature(otherKey))
+}
@@ -0,0 +1,289 @@
+package in_toto
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/secure-systems-lab/go-securesystemslib/dsse"
+)
+
+// ErrInvalidSigningRequest is returned when a signing request or response of
+// the offline signing ceremony cannot be loaded or is malformed, see
+// SigningRequest.
+var ErrInvalidSigningRequest = errors.New("invalid signing request")
+
+// ErrSigningDigestMismatch is returned when the layout of a signing request or
+// response does not match the signed digest, e.g. because the layout was
+// modified after the request was exported.
+var ErrSigningDigestMismatch = errors.New("signing digest does not match layout")
+
+/*
+SigningRequest carries a layout to an air-gapped machine, where it is signed
+with layout keys that never touch an online machine.  The offline signing
+ceremony consists of three steps:
+
+ 1. On the online machine, NewSigningRequest exports the layout together with
+    the digest of the bytes to be signed, i.e. of the signable representation
+    of a Metablock or the PAE encoding of an Envelope.
+ 2. On the air-gapped machine, Sign recomputes the digest from the layout,
+    signs it with the layout keys and returns a SigningResponse, which holds
+    only the digest and the signatures.
+ 3. On the online machine, MergeSignatures adds the verified signatures to the
+    layout, if the digest of the response matches the layout.
+
+Participants compare the digest displayed on both machines, see
+FormatSigningDigest, to make sure the air-gapped machine signs the reviewed
+layout.
+*/
+type SigningRequest struct {
+	Type   string          `json:"_type"`
+	Layout json.RawMessage `json:"layout"`
+	Digest HashObj         `json:"digest"`
+}
+
+// SigningResponse holds the signatures created from a SigningRequest on an
+// air-gapped machine, and the digest of the signed bytes.
+type SigningResponse struct {
+	Type       string      `json:"_type"`
+	Digest     HashObj     `json:"digest"`
+	Signatures []Signature `json:"signatures"`
+}
+
+// NewSigningRequest exports the passed layout for signing on an air-gapped
+// machine.  Existing signatures of the layout are kept.
+func NewSigningRequest(layoutEnv Metadata) (*SigningRequest, error) {
+	if _, ok := layoutEnv.GetPayload().(Layout); !ok {
+		return nil, ErrNotLayout
+	}
+	digest, err := signingDigest(layoutEnv)
+	if err != nil {
+		return nil, err
+	}
+	layoutBytes, err := encodeHandoffMetadata(layoutEnv)
+	if err != nil {
+		return nil, err
+	}
+	return &SigningRequest{Type: "signing-request", Layout: layoutBytes, Digest: digest}, nil
+}
+
+/*
+GetLayout returns the layout of the signing request, after checking that the
+digest of its signable bytes matches the digest of the request, or returns an
+ErrSigningDigestMismatch.
+*/
+func (r *SigningRequest) GetLayout() (Metadata, error) {
+	layoutEnv, err := decodeMetadata(r.Layout)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSigningRequest, err)
+	}
+	if _, ok := layoutEnv.GetPayload().(Layout); !ok {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSigningRequest, ErrNotLayout)
+	}
+	digest, err := signingDigest(layoutEnv)
+	if err != nil {
+		return nil, err
+	}
+	if !digestsMatch(r.Digest, digest) {
+		return nil, fmt.Errorf("%w: request digest '%s', layout digest '%s'", ErrSigningDigestMismatch,
+			FormatSigningDigest(r.Digest), FormatSigningDigest(digest))
+	}
+	return layoutEnv, nil
+}
+
+/*
+Sign signs the layout of the signing request with each of the passed keys,
+e.g. on an air-gapped machine, and returns the signatures in a response for
+MergeSignatures.  The layout must match the digest of the request, see
+GetLayout.
+*/
+func (r *SigningRequest) Sign(keys ...Key) (*SigningResponse, error) {
+	layoutEnv, err := r.GetLayout()
+	if err != nil {
+		return nil, err
+	}
+	response := &SigningResponse{Type: "signing-response", Digest: r.Digest, Signatures: []Signature{}}
+	for _, key := range keys {
+		if err := ClearSignatures(layoutEnv); err != nil {
+			return nil, err
+		}
+		if err := layoutEnv.Sign(key); err != nil {
+			return nil, fmt.Errorf("failed to sign with key '%s': %w", key.KeyID, err)
+		}
+		response.Signatures = append(response.Signatures, layoutEnv.Sigs()...)
+	}
+	return response, nil
+}
+
+/*
+MergeSignatures adds the signatures of the passed signing response to the
+passed layout, e.g. the layout a SigningRequest was exported from.  It returns
+an ErrSigningDigestMismatch if the response was not created for the layout in
+its current form, and an ErrUnverifiedSignature if a signature does not verify
+with one of the passed keys, in which case no signature is added.  Existing
+signatures of the same keys are replaced, so that merging is idempotent.
+*/
+func MergeSignatures(layoutEnv Metadata, response *SigningResponse, keys map[string]Key) error {
+	digest, err := signingDigest(layoutEnv)
+	if err != nil {
+		return err
+	}
+	if !digestsMatch(response.Digest, digest) {
+		return fmt.Errorf("%w: response digest '%s', layout digest '%s'", ErrSigningDigestMismatch,
+			FormatSigningDigest(response.Digest), FormatSigningDigest(digest))
+	}
+
+	// Each signature is verified on its own, on a copy of the layout
+	layoutBytes, err := encodeHandoffMetadata(layoutEnv)
+	if err != nil {
+		return err
+	}
+	for _, sig := range response.Signatures {
+		sigEnv, err := decodeUnvalidatedMetadata(layoutBytes)
+		if err != nil {
+			return err
+		}
+		if err := ClearSignatures(sigEnv); err != nil {
+			return err
+		}
+		if err := appendSignature(sigEnv, sig); err != nil {
+			return err
+		}
+		if err := VerifyExistingSignatures(sigEnv, keys); err != nil {
+			return err
+		}
+	}
+
+	keyIDs := NewSet()
+	for _, sig := range response.Signatures {
+		keyIDs.Add(sig.KeyID)
+	}
+	if err := removeSignatures(layoutEnv, keyIDs.Has); err != nil {
+		return err
+	}
+	for _, sig := range response.Signatures {
+		if err := appendSignature(layoutEnv, sig); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendSignature appends the passed signature to the passed Metablock or
+// Envelope.
+func appendSignature(metadata Metadata, sig Signature) error {
+	switch m := metadata.(type) {
+	case *Metablock:
+		m.Signatures = append(m.Signatures, sig)
+	case *Envelope:
+		m.envelope.Signatures = append(m.envelope.Signatures, dsse.Signature{KeyID: sig.KeyID, Sig: sig.Sig})
+	default:
+		return ErrUnknownMetadataType
+	}
+	return nil
+}
+
+// signingDigest returns the sha256 digest of the bytes the signatures of the
+// passed Metablock or Envelope are created over.
+func signingDigest(metadata Metadata) (HashObj, error) {
+	var signable []byte
+	var err error
+	switch m := metadata.(type) {
+	case *Metablock:
+		signable, err = m.GetSignableRepresentation()
+	case *Envelope:
+		signable, err = m.signableBytes()
+	default:
+		return nil, ErrUnknownMetadataType
+	}
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(signable)
+	return HashObj{"sha256": hex.EncodeToString(sum[:])}, nil
+}
+
+/*
+FormatSigningDigest formats the sha256 digest of a signing request or
+response for manual comparison by the participants of a signing ceremony, in
+upper case groups of four characters, e.g. "SHA256:1A2B 3C4D ...".
+*/
+func FormatSigningDigest(digest HashObj) string {
+	value := strings.ToUpper(digest["sha256"])
+	groups := make([]string, 0, len(value)/4+1)
+	for len(value) > 4 {
+		groups = append(groups, value[:4])
+		value = value[4:]
+	}
+	groups = append(groups, value)
+	return "SHA256:" + strings.Join(groups, " ")
+}
+
+/*
+LoadSigningRequest loads a JSON encoded signing request from the passed path,
+e.g. as written by SigningRequest.Dump.
+*/
+func LoadSigningRequest(path string) (*SigningRequest, error) {
+	var request SigningRequest
+	if err := loadCeremonyFile(path, &request); err != nil {
+		return nil, err
+	}
+	if request.Type != "signing-request" {
+		return nil, fmt.Errorf("%w: invalid Type value for signing request: should be 'signing-request'",
+			ErrInvalidSigningRequest)
+	}
+	return &request, nil
+}
+
+// Dump JSON serializes and writes the signing request to the passed path.
+func (r *SigningRequest) Dump(path string) error {
+	return dumpCeremonyFile(path, r)
+}
+
+/*
+LoadSigningResponse loads a JSON encoded signing response from the passed
+path, e.g. as written by SigningResponse.Dump.
+*/
+func LoadSigningResponse(path string) (*SigningResponse, error) {
+	var response SigningResponse
+	if err := loadCeremonyFile(path, &response); err != nil {
+		return nil, err
+	}
+	if response.Type != "signing-response" {
+		return nil, fmt.Errorf("%w: invalid Type value for signing response: should be 'signing-response'",
+			ErrInvalidSigningRequest)
+	}
+	return &response, nil
+}
+
+// Dump JSON serializes and writes the signing response to the passed path.
+func (r *SigningResponse) Dump(path string) error {
+	return dumpCeremonyFile(path, r)
+}
+
+// loadCeremonyFile decodes the JSON encoded file at the passed path into the
+// passed signing request or response.
+func loadCeremonyFile(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidSigningRequest, err)
+	}
+	return nil
+}
+
+// dumpCeremonyFile writes the passed signing request or response JSON encoded
+// to the passed path.
+func dumpCeremonyFile(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeMetadataFile(path, data, 0644)
+}
@@ -0,0 +1,96 @@
+package in_toto
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSigningCeremony(t *testing.T) {
+	var alice, carol, alicePub, carolPub Key
+	for _, k := range []struct {
+		key  *Key
+		path string
+	}{{&alice, "alice"}, {&carol, "carol"}, {&alicePub, "alice.pub"}, {&carolPub, "carol.pub"}} {
+		if err := k.key.LoadKeyDefaults(k.path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	publicKeys := map[string]Key{alicePub.KeyID: alicePub, carolPub.KeyID: carolPub}
+
+	// The envelope layout has no keys, whose PEM encoding does not survive the
+	// envelope payload encoding
+	env := &Envelope{}
+	if err := env.SetPayload(Layout{Type: "layout", Expires: "2100-01-01T00:00:00Z",
+		Steps: []Step{}, Inspect: []Inspection{}, Keys: map[string]Key{}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, envelope := range []bool{false, true} {
+		layoutEnv, err := LoadMetadata("demo.layout")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if envelope {
+			layoutEnv = env
+		}
+
+		// The request travels to the air-gapped machine and back as files
+		dir := t.TempDir()
+		request, err := NewSigningRequest(layoutEnv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := request.Dump(filepath.Join(dir, "request.json")); err != nil {
+			t.Fatal(err)
+		}
+		request, err = LoadSigningRequest(filepath.Join(dir, "request.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		response, err := request.Sign(alice, carol)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Len(t, response.Signatures, 2)
+		if err := response.Dump(filepath.Join(dir, "response.json")); err != nil {
+			t.Fatal(err)
+		}
+		response, err = LoadSigningResponse(filepath.Join(dir, "response.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Signatures must verify with the passed keys
+		err = MergeSignatures(layoutEnv, response, map[string]Key{alicePub.KeyID: alicePub})
+		assert.ErrorIs(t, err, ErrUnverifiedSignature)
+
+		if err := MergeSignatures(layoutEnv, response, publicKeys); err != nil {
+			t.Fatal(err)
+		}
+		assert.Nil(t, layoutEnv.VerifySignature(alicePub))
+		assert.Nil(t, layoutEnv.VerifySignature(carolPub))
+		sigs := len(layoutEnv.Sigs())
+		assert.Nil(t, MergeSignatures(layoutEnv, response, publicKeys))
+		assert.Len(t, layoutEnv.Sigs(), sigs)
+
+		// Requests and responses must match the layout
+		_, err = LoadSigningResponse(filepath.Join(dir, "request.json"))
+		assert.ErrorIs(t, err, ErrInvalidSigningRequest)
+		request.Digest = HashObj{"sha256": strings.Repeat("0", 64)}
+		_, err = request.Sign(alice)
+		assert.ErrorIs(t, err, ErrSigningDigestMismatch)
+		response.Digest = request.Digest
+		assert.ErrorIs(t, MergeSignatures(layoutEnv, response, publicKeys), ErrSigningDigestMismatch)
+	}
+
+	linkEnv, err := LoadMetadata("foo.b7d643de.link")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewSigningRequest(linkEnv)
+	assert.ErrorIs(t, err, ErrNotLayout)
+
+	assert.Equal(t, "SHA256:0123 4567 89AB CDEF 01", FormatSigningDigest(HashObj{"sha256": "0123456789abcdef01"}))
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/x509"
 	"fmt"
 	"net/url"
+	"time"
 )
 
 const (
@@ -45,25 +46,33 @@ func (cr *checkResult) evaluate(cert *x509.Certificate, constraintCheck func(*x5
 	return cr
 }
 
-// error reduces all of the errors into one error with a
-// combined error message. If there are no errors, nil
+// error reduces all of the errors into one error, which wraps
+// each of them, see MultiError. If there are no errors, nil
 // will be returned.
 func (cr *checkResult) error() error {
 	if len(cr.errors) == 0 {
 		return nil
 	}
-	return fmt.Errorf("cert failed constraints check: %+q", cr.errors)
+	return fmt.Errorf("cert failed constraints check: %w", &MultiError{Errs: cr.errors})
 }
 
 // Check tests the provided certificate against the constraint. An error is returned if the certificate
 // fails any of the constraints. nil is returned if the certificate passes all of the constraints.
 func (cc CertificateConstraint) Check(cert *x509.Certificate, rootCAIDs []string, rootCertPool, intermediateCertPool *x509.CertPool) error {
+	return cc.checkAt(cert, rootCAIDs, rootCertPool, intermediateCertPool, time.Time{}, 0)
+}
+
+// checkAt is like Check, but verifies the trust chain of the certificate at
+// the passed time with the passed clock skew tolerance, see
+// VerifyCertificateTrustAt.
+func (cc CertificateConstraint) checkAt(cert *x509.Certificate, rootCAIDs []string, rootCertPool, intermediateCertPool *x509.CertPool,
+	now time.Time, clockSkew time.Duration) error {
 	return newCheckResult().
 		evaluate(cert, cc.checkCommonName).
 		evaluate(cert, cc.checkDNSNames).
 		evaluate(cert, cc.checkEmails).
 		evaluate(cert, cc.checkOrganizations).
-		evaluate(cert, cc.checkRoots(rootCAIDs, rootCertPool, intermediateCertPool)).
+		evaluate(cert, cc.checkRoots(rootCAIDs, rootCertPool, intermediateCertPool, now, clockSkew)).
 		evaluate(cert, cc.checkURIs).
 		error()
 }
@@ -90,9 +99,10 @@ func (cc CertificateConstraint) checkOrganizations(cert *x509.Certificate) error
 
 // checkRoots verifies that the certificate's roots matches the constraint.
 // The certificates trust chain must also be verified.
-func (cc CertificateConstraint) checkRoots(rootCAIDs []string, rootCertPool, intermediateCertPool *x509.CertPool) func(*x509.Certificate) error {
+func (cc CertificateConstraint) checkRoots(rootCAIDs []string, rootCertPool, intermediateCertPool *x509.CertPool,
+	now time.Time, clockSkew time.Duration) func(*x509.Certificate) error {
 	return func(cert *x509.Certificate) error {
-		_, err := VerifyCertificateTrust(cert, rootCertPool, intermediateCertPool)
+		_, err := VerifyCertificateTrustAt(cert, rootCertPool, intermediateCertPool, now, clockSkew)
 		if err != nil {
 			return fmt.Errorf("failed to verify roots: %w", err)
 		}
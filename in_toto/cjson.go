@@ -0,0 +1,462 @@
+package in_toto
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"unicode/utf8"
+)
+
+// ErrNonCanonicalJSON indicates that data passed to DecodeCanonical is not in
+// the OLPC canonical JSON form.
+var ErrNonCanonicalJSON = errors.New("not canonical JSON")
+
+// ErrUncanonicalizableValue indicates that a value passed to EncodeCanonical
+// cannot be represented in canonical JSON, e.g. a floating point number.
+var ErrUncanonicalizableValue = errors.New("value cannot be canonicalized")
+
+// maxCanonicalDepth limits the nesting of arrays and objects in canonical
+// JSON, like the limit of encoding/json.
+const maxCanonicalDepth = 10000
+
+/*
+EncodeCanonical returns the OLPC canonical JSON encoding of the passed object
+(see http://wiki.laptop.org/go/Canonical_JSON), consistent with the
+securesystemslib, so that key ids and signatures of metadata agree with other
+in-toto implementations.  The object is first marshalled with encoding/json,
+hence struct tags are respected.  Then:
+
+  - object keys are sorted by their UTF-8 bytes, i.e. by code point, on all
+    nesting levels,
+  - strings are wrapped in double quotes, and only backslashes and double
+    quotes are escaped, all other characters are written verbatim,
+  - integers are written in their shortest decimal form, without limit on
+    their size,
+  - no insignificant whitespace is written.
+
+Floating point numbers, including integers written with a fraction or
+exponent, cannot be canonicalized, and an ErrUncanonicalizableValue is
+returned.  NaN and infinite values are rejected by encoding/json already.
+
+The marshalled JSON is rewritten in a single pass into the result, without
+decoding it into maps and strings first, and the buffers used on the way are
+pooled, so that encoding metadata with thousands of artifacts, e.g. to verify
+its signatures, allocates little more than the result.
+*/
+func EncodeCanonical(obj any) ([]byte, error) {
+	buf := canonicalBufferPool.Get().(*bytes.Buffer)
+	defer canonicalBufferPool.Put(buf)
+	buf.Reset()
+	enc := json.NewEncoder(buf)
+	// Escaping HTML characters is pointless, they are written verbatim
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(obj); err != nil {
+		return nil, err
+	}
+
+	e := canonicalEncoderPool.Get().(*canonicalEncoder)
+	defer func() {
+		e.data, e.out, e.members = nil, nil, e.members[:0]
+		canonicalEncoderPool.Put(e)
+	}()
+	// The result is never longer than the marshalled JSON, because
+	// canonicalization only removes escapes and whitespace
+	e.data = bytes.TrimRight(buf.Bytes(), "\n")
+	e.pos = 0
+	e.out = make([]byte, 0, len(e.data))
+	if err := e.value(0); err != nil {
+		return nil, err
+	}
+	return e.out, nil
+}
+
+// canonicalBufferPool holds the buffers objects are marshalled into by
+// EncodeCanonical.
+var canonicalBufferPool = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// canonicalEncoderPool holds canonicalEncoders, whose buffers are reused.
+var canonicalEncoderPool = sync.Pool{New: func() any { return &canonicalEncoder{} }}
+
+/*
+canonicalEncoder rewrites JSON as marshalled by encoding/json, i.e. valid and
+compact JSON, into canonical JSON, see EncodeCanonical.  The members of all
+objects currently written are kept on a shared stack, so that objects whose
+keys are not sorted already, e.g. structs, are reordered in place.
+*/
+type canonicalEncoder struct {
+	data    []byte
+	pos     int
+	out     []byte
+	members []canonicalMember
+	scratch []byte
+}
+
+// canonicalMember is an object member written to out[start:end], with its
+// unescaped key.
+type canonicalMember struct {
+	key        []byte
+	start, end int
+}
+
+func (e *canonicalEncoder) value(depth int) error {
+	if depth > maxCanonicalDepth {
+		return fmt.Errorf("%w: exceeded max depth", ErrUncanonicalizableValue)
+	}
+	switch c := e.data[e.pos]; {
+	case c == '{':
+		return e.object(depth)
+	case c == '[':
+		return e.array(depth)
+	case c == '"':
+		s, escaped, err := e.string()
+		if err != nil {
+			return err
+		}
+		if !escaped {
+			// Without escapes the string is canonical already
+			e.out = append(e.out, e.data[e.pos-len(s)-2:e.pos]...)
+			return nil
+		}
+		e.out = appendCanonicalString(e.out, s)
+	case c == '-' || (c >= '0' && c <= '9'):
+		return e.integer()
+	default:
+		// true, false or null
+		start := e.pos
+		for e.pos < len(e.data) && e.data[e.pos] >= 'a' && e.data[e.pos] <= 'z' {
+			e.pos++
+		}
+		e.out = append(e.out, e.data[start:e.pos]...)
+	}
+	return nil
+}
+
+func (e *canonicalEncoder) object(depth int) error {
+	e.pos++ // '{'
+	e.out = append(e.out, '{')
+	base := len(e.members)
+	defer func() { e.members = e.members[:base] }()
+	sorted := true
+	for e.data[e.pos] != '}' {
+		if len(e.members) > base {
+			e.pos++ // ','
+			e.out = append(e.out, ',')
+		}
+		key, _, err := e.string()
+		if err != nil {
+			return err
+		}
+		start := len(e.out)
+		e.out = appendCanonicalString(e.out, key)
+		e.pos++ // ':'
+		e.out = append(e.out, ':')
+		if err := e.value(depth + 1); err != nil {
+			return err
+		}
+		if len(e.members) > base && bytes.Compare(e.members[len(e.members)-1].key, key) >= 0 {
+			sorted = false
+		}
+		e.members = append(e.members, canonicalMember{key: key, start: start, end: len(e.out)})
+	}
+	e.pos++ // '}'
+	if !sorted {
+		e.sortMembers(e.members[base:])
+	}
+	e.out = append(e.out, '}')
+	return nil
+}
+
+/*
+sortMembers rewrites the passed members of the current object, which are the
+last bytes written, sorted by their keys.  Like decoding into a map, only the
+last member of duplicate keys is kept.
+*/
+func (e *canonicalEncoder) sortMembers(members []canonicalMember) {
+	offset := members[0].start
+	e.scratch = append(e.scratch[:0], e.out[offset:]...)
+	e.out = e.out[:offset]
+	sort.SliceStable(members, func(i, j int) bool {
+		return bytes.Compare(members[i].key, members[j].key) < 0
+	})
+	for i, member := range members {
+		if i+1 < len(members) && bytes.Equal(member.key, members[i+1].key) {
+			continue
+		}
+		if len(e.out) > offset {
+			e.out = append(e.out, ',')
+		}
+		e.out = append(e.out, e.scratch[member.start-offset:member.end-offset]...)
+	}
+}
+
+func (e *canonicalEncoder) array(depth int) error {
+	e.pos++ // '['
+	e.out = append(e.out, '[')
+	for i := 0; e.data[e.pos] != ']'; i++ {
+		if i > 0 {
+			e.pos++ // ','
+			e.out = append(e.out, ',')
+		}
+		if err := e.value(depth + 1); err != nil {
+			return err
+		}
+	}
+	e.pos++ // ']'
+	e.out = append(e.out, ']')
+	return nil
+}
+
+/*
+string reads the next string and returns its unescaped bytes, and whether it
+had to be unescaped, or the error of unescaping it.  Strings without escapes
+are returned as part of the marshalled JSON, so that they are not copied.
+*/
+func (e *canonicalEncoder) string() ([]byte, bool, error) {
+	start := e.pos
+	escaped := false
+	e.pos++ // '"'
+	for e.data[e.pos] != '"' {
+		if e.data[e.pos] == '\\' {
+			escaped = true
+			e.pos++
+		}
+		e.pos++
+	}
+	e.pos++ // '"'
+	// Marshalled json.RawMessage may contain invalid UTF-8, which is replaced
+	// when unescaping
+	if !escaped && utf8.Valid(e.data[start+1:e.pos-1]) {
+		return e.data[start+1 : e.pos-1], false, nil
+	}
+	var s string
+	// Escapes are rare, e.g. of control characters, so unescaping them
+	// like encoding/json is cheap
+	if err := json.Unmarshal(e.data[start:e.pos], &s); err != nil {
+		return nil, true, err
+	}
+	return []byte(s), true, nil
+}
+
+// integer writes the next number in its shortest form, which must be an
+// integer without fraction or exponent.
+func (e *canonicalEncoder) integer() error {
+	start := e.pos
+	for e.pos < len(e.data) && bytes.IndexByte([]byte("-+0123456789.eE"), e.data[e.pos]) >= 0 {
+		e.pos++
+	}
+	number := e.data[start:e.pos]
+	if bytes.ContainsAny(number, ".eE") {
+		return fmt.Errorf("%w: floating point number '%s'", ErrUncanonicalizableValue, number)
+	}
+	// encoding/json only writes valid numbers, i.e. without leading zeros,
+	// hence only negative zero is not in its shortest form
+	if string(number) == "-0" {
+		number = number[1:]
+	}
+	e.out = append(e.out, number...)
+	return nil
+}
+
+// appendCanonicalString appends the passed string to the passed bytes in
+// double quotes, escaping only backslashes and double quotes.
+func appendCanonicalString(out []byte, s []byte) []byte {
+	out = append(out, '"')
+	for _, c := range s {
+		if c == '\\' || c == '"' {
+			out = append(out, '\\')
+		}
+		out = append(out, c)
+	}
+	return append(out, '"')
+}
+
+/*
+DecodeCanonical parses the passed OLPC canonical JSON data and stores the
+result in the value pointed to by v, like json.Unmarshal.  Unlike
+json.Unmarshal, it only accepts data in canonical form, as returned by
+EncodeCanonical, hence decoding and encoding again yields the same bytes, and
+key ids and signatures computed over the data do not drift.  In particular,
+data with whitespace, unsorted or duplicate object keys, escapes other than
+\\ and \", floating point numbers, non-minimal integers or invalid UTF-8 is
+rejected with an ErrNonCanonicalJSON.  Numbers decoded into an interface
+value are stored as json.Number.
+*/
+func DecodeCanonical(data []byte, v any) error {
+	d := &canonicalDecoder{data: data}
+	value, err := d.value(0)
+	if err != nil {
+		return err
+	}
+	if d.pos != len(d.data) {
+		return d.errorf("unexpected data after value")
+	}
+
+	// Like EncodeCanonical, rely on encoding/json to populate typed values
+	standard, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(standard))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// canonicalDecoder parses canonical JSON into the values encoding/json
+// decodes into an interface value with UseNumber.
+type canonicalDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *canonicalDecoder) errorf(format string, args ...any) error {
+	return fmt.Errorf("%w: %s at offset %d", ErrNonCanonicalJSON, fmt.Sprintf(format, args...), d.pos)
+}
+
+func (d *canonicalDecoder) value(depth int) (any, error) {
+	if depth > maxCanonicalDepth {
+		return nil, d.errorf("exceeded max depth")
+	}
+	if d.pos >= len(d.data) {
+		return nil, d.errorf("unexpected end of data")
+	}
+	switch c := d.data[d.pos]; {
+	case c == '{':
+		return d.object(depth)
+	case c == '[':
+		return d.array(depth)
+	case c == '"':
+		return d.string()
+	case c == '-' || (c >= '0' && c <= '9'):
+		return d.integer()
+	case bytes.HasPrefix(d.data[d.pos:], []byte("true")):
+		d.pos += len("true")
+		return true, nil
+	case bytes.HasPrefix(d.data[d.pos:], []byte("false")):
+		d.pos += len("false")
+		return false, nil
+	case bytes.HasPrefix(d.data[d.pos:], []byte("null")):
+		d.pos += len("null")
+		return nil, nil
+	}
+	return nil, d.errorf("unexpected character %q", d.data[d.pos])
+}
+
+func (d *canonicalDecoder) object(depth int) (any, error) {
+	d.pos++ // '{'
+	obj := map[string]any{}
+	if d.consume('}') {
+		return obj, nil
+	}
+
+	previous := ""
+	for i := 0; ; i++ {
+		if d.pos >= len(d.data) || d.data[d.pos] != '"' {
+			return nil, d.errorf("expected object key")
+		}
+		key, err := d.string()
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 && key <= previous {
+			return nil, d.errorf("object key '%s' not sorted or duplicate", key)
+		}
+		previous = key
+
+		if !d.consume(':') {
+			return nil, d.errorf("expected ':'")
+		}
+		value, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		obj[key] = value
+
+		if d.consume('}') {
+			return obj, nil
+		}
+		if !d.consume(',') {
+			return nil, d.errorf("expected ',' or '}'")
+		}
+	}
+}
+
+func (d *canonicalDecoder) array(depth int) (any, error) {
+	d.pos++ // '['
+	arr := []any{}
+	if d.consume(']') {
+		return arr, nil
+	}
+
+	for {
+		value, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		arr = append(arr, value)
+
+		if d.consume(']') {
+			return arr, nil
+		}
+		if !d.consume(',') {
+			return nil, d.errorf("expected ',' or ']'")
+		}
+	}
+}
+
+func (d *canonicalDecoder) string() (string, error) {
+	d.pos++ // '"'
+	var s []byte
+	for d.pos < len(d.data) {
+		c := d.data[d.pos]
+		d.pos++
+		switch c {
+		case '"':
+			if !utf8.Valid(s) {
+				return "", d.errorf("invalid UTF-8 in string")
+			}
+			return string(s), nil
+		case '\\':
+			if d.pos >= len(d.data) || (d.data[d.pos] != '\\' && d.data[d.pos] != '"') {
+				return "", d.errorf("invalid escape in string")
+			}
+			c = d.data[d.pos]
+			d.pos++
+		}
+		s = append(s, c)
+	}
+	return "", d.errorf("unterminated string")
+}
+
+func (d *canonicalDecoder) integer() (any, error) {
+	start := d.pos
+	d.consume('-')
+	digits := d.pos
+	for d.pos < len(d.data) && d.data[d.pos] >= '0' && d.data[d.pos] <= '9' {
+		d.pos++
+	}
+	number := string(d.data[start:d.pos])
+
+	switch {
+	case d.pos == digits:
+		return nil, d.errorf("expected digit")
+	case d.pos < len(d.data) && bytes.IndexByte([]byte(".eE"), d.data[d.pos]) >= 0:
+		return nil, d.errorf("floating point number")
+	case d.data[digits] == '0' && d.pos-digits > 1:
+		return nil, d.errorf("integer '%s' with leading zero", number)
+	case number == "-0":
+		return nil, d.errorf("negative zero")
+	}
+	return json.Number(number), nil
+}
+
+// consume advances past the next byte, if it is the passed byte.
+func (d *canonicalDecoder) consume(c byte) bool {
+	if d.pos < len(d.data) && d.data[d.pos] == c {
+		d.pos++
+		return true
+	}
+	return false
+}
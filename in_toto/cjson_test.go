@@ -0,0 +1,221 @@
+package in_toto
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/secure-systems-lab/go-securesystemslib/cjson"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeCanonical(t *testing.T) {
+	tables := []struct {
+		name     string
+		input    any
+		expected string
+	}{
+		{"null", nil, `null`},
+		{"booleans", []bool{true, false}, `[true,false]`},
+		{"integers", []int64{0, -1, math.MaxInt64, math.MinInt64}, `[0,-1,9223372036854775807,-9223372036854775808]`},
+		{"large unsigned integer", uint64(math.MaxUint64), `18446744073709551615`},
+		{"escaped string", "a\\b\"c", `"a\\b\"c"`},
+		{"verbatim control and non-ASCII characters", "\n\té<>& ", "\"\n\té<>& \""},
+		{"sorted nested maps", map[string]any{"b": map[string]int{"z": 1, "a": 2}, "a": []any{map[string]any{"d": nil, "c": true}}},
+			`{"a":[{"c":true,"d":null}],"b":{"a":2,"z":1}}`},
+		{"keys sorted by code point", map[string]int{"é": 1, "z": 2, "Z": 3}, "{\"Z\":3,\"z\":2,\"é\":1}"},
+		{"struct tags", Signature{KeyID: "k", Sig: "s"}, `{"keyid":"k","sig":"s"}`},
+		{"integral raw number", json.RawMessage(`-0`), `0`},
+		{"unescaped raw string", json.RawMessage(`"\u003c\n\"\ud83d\ude00"`), "\"<\n\\\"\U0001F600\""},
+		{"invalid UTF-8 in raw string", json.RawMessage("\"\xa9\""), "\"\uFFFD\""},
+		{"escaped keys sorted unescaped", json.RawMessage(`{"a#":1,"a\"":2}`), `{"a\"":2,"a#":1}`},
+		{"last duplicate raw key", json.RawMessage(`{"b":[],"a":1,"a":{"d":2,"c":3}}`), `{"a":{"c":3,"d":2},"b":[]}`},
+	}
+	for _, table := range tables {
+		result, err := EncodeCanonical(table.input)
+		assert.Nil(t, err, table.name)
+		assert.Equal(t, table.expected, string(result), table.name)
+	}
+
+	floats := []any{1.5, json.RawMessage(`1.0`), json.RawMessage(`1e3`), map[string]any{"a": []any{0.1}}}
+	for _, input := range floats {
+		_, err := EncodeCanonical(input)
+		assert.ErrorIs(t, err, ErrUncanonicalizableValue, input)
+	}
+
+	for _, input := range []any{math.NaN(), math.Inf(1), make(chan int)} {
+		_, err := EncodeCanonical(input)
+		assert.NotNil(t, err)
+	}
+}
+
+func TestEncodeCanonicalSecuresystemslibParity(t *testing.T) {
+	for _, path := range []string{"demo.layout", "write-code.b7d643de.link", "canonical-test.link"} {
+		mb, err := LoadMetadata(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, err := cjson.EncodeCanonical(mb.GetPayload())
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := EncodeCanonical(mb.GetPayload())
+		assert.Nil(t, err, path)
+		assert.Equal(t, string(expected), string(result), path)
+	}
+}
+
+func TestDecodeCanonical(t *testing.T) {
+	var link Link
+	data := []byte(`{"_type":"link","byproducts":{},"command":["sh","-c","echo \"a\\b\""],"environment":{},"materials":{},"name":"x` + "\n" + `y","products":{}}`)
+	assert.Nil(t, DecodeCanonical(data, &link))
+	assert.Equal(t, "x\ny", link.Name)
+	assert.Equal(t, []string{"sh", "-c", `echo "a\b"`}, link.Command)
+
+	encoded, err := EncodeCanonical(link)
+	assert.Nil(t, err)
+	assert.Equal(t, string(data), string(encoded))
+
+	var value any
+	assert.Nil(t, DecodeCanonical([]byte(`[-12,0,18446744073709551615,null,true,false,""]`), &value))
+	assert.Equal(t, []any{json.Number("-12"), json.Number("0"), json.Number("18446744073709551615"), nil, true, false, ""}, value)
+
+	invalid := []string{
+		``,
+		` {}`,
+		`{} `,
+		`{"a": 1}`,
+		`{"b":1,"a":2}`,
+		`{"a":1,"a":2}`,
+		`{1:2}`,
+		`[1,]`,
+		`[1 ]`,
+		`"\n"`,
+		`"\u0041"`,
+		"\"\xff\"",
+		`"abc`,
+		`1.0`,
+		`1e3`,
+		`01`,
+		`-0`,
+		`-`,
+		`tru`,
+		`[]]`,
+	}
+	for _, input := range invalid {
+		var value any
+		err := DecodeCanonical([]byte(input), &value)
+		assert.ErrorIs(t, err, ErrNonCanonicalJSON, input)
+	}
+
+	var deep any
+	err = DecodeCanonical(bytes.Repeat([]byte("["), maxCanonicalDepth+2), &deep)
+	assert.ErrorIs(t, err, ErrNonCanonicalJSON)
+}
+
+func FuzzEncodeCanonical(f *testing.F) {
+	for _, seed := range []string{`{"b":[1,"\\\""],"a":null}`, `"é\n"`, `[true,false,-0]`, `1.5`, `{"a":{"b":{}}}`} {
+		f.Add(seed)
+	}
+	for _, pattern := range []string{"*.link", "*.layout"} {
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			f.Fatal(err)
+		}
+		for _, path := range paths {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				f.Fatal(err)
+			}
+			f.Add(string(data))
+		}
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		var value any
+		dec := json.NewDecoder(bytes.NewReader([]byte(input)))
+		dec.UseNumber()
+		if err := dec.Decode(&value); err != nil {
+			return
+		}
+		encoded, err := EncodeCanonical(value)
+		if err != nil {
+			return
+		}
+
+		// The encoding is canonical, hence stable under decoding and encoding
+		var decoded any
+		if err := DecodeCanonical(encoded, &decoded); err != nil {
+			t.Fatalf("failed to decode canonical encoding %q: %s", encoded, err)
+		}
+		reencoded, err := EncodeCanonical(decoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(encoded, reencoded) {
+			t.Fatalf("canonical encoding not stable: %q != %q", encoded, reencoded)
+		}
+	})
+}
+
+func FuzzDecodeCanonical(f *testing.F) {
+	for _, seed := range []string{`{"a":[1,"\\\""],"b":null}`, "\"\n\"", `[true,false,0]`, `{"a":1,"a":2}`, `01`} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var value any
+		if err := DecodeCanonical(data, &value); err != nil {
+			return
+		}
+
+		// Only canonical data is accepted, hence encoding yields the input
+		encoded, err := EncodeCanonical(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, encoded) {
+			t.Fatalf("accepted non-canonical data %q, encodes to %q", data, encoded)
+		}
+	})
+}
+
+// benchmarkLink returns a link with the passed number of materials and
+// products, like links of large builds.
+func benchmarkLink(artifacts int) Link {
+	link := Link{
+		Type:        "link",
+		Name:        "build",
+		Materials:   make(map[string]HashObj, artifacts),
+		Products:    make(map[string]HashObj, artifacts),
+		ByProducts:  map[string]interface{}{"return-value": 0, "stdout": "", "stderr": ""},
+		Command:     []string{"make", "all"},
+		Environment: map[string]interface{}{},
+	}
+	for i := 0; i < artifacts; i++ {
+		digest := sha256.Sum256([]byte(strconv.Itoa(i)))
+		hashes := HashObj{"sha256": hex.EncodeToString(digest[:])}
+		link.Materials[fmt.Sprintf("src/pkg%d/file%d.go", i%100, i)] = hashes
+		link.Products[fmt.Sprintf("dist/pkg%d/file%d.o", i%100, i)] = hashes
+	}
+	return link
+}
+
+func BenchmarkEncodeCanonical(b *testing.B) {
+	for _, artifacts := range []int{10, 1000, 10000} {
+		link := benchmarkLink(artifacts)
+		b.Run(strconv.Itoa(artifacts), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := EncodeCanonical(link); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package in_toto
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	// CloudEventsSpecVersion is the version of the CloudEvents specification
+	// emitted events conform to.
+	CloudEventsSpecVersion = "1.0"
+	// CloudEventsContentType is the media type of events in structured
+	// content mode, see the CloudEvents JSON event format.
+	CloudEventsContentType = "application/cloudevents+json"
+	// EventTypeVerificationCompleted is the event type of supply chain
+	// verification results.
+	EventTypeVerificationCompleted = "io.in-toto.verification.completed"
+	// EventTypeLinkReceived is the event type of newly received link metadata.
+	EventTypeLinkReceived = "io.in-toto.link.received"
+)
+
+// ErrEventDelivery is returned when an event sink fails to deliver an event.
+var ErrEventDelivery = errors.New("failed to deliver event")
+
+// ErrNotLink is returned when link metadata is expected, but other metadata
+// is passed.
+var ErrNotLink = errors.New("metadata is not a link")
+
+/*
+CloudEvent is an event in the CloudEvents 1.0 JSON event format, see
+https://github.com/cloudevents/spec/blob/v1.0.2/cloudevents/formats/json-format.md
+*/
+type CloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            string          `json:"time,omitempty"`
+	DataContentType string          `json:"datacontenttype,omitempty"`
+	Data            json.RawMessage `json:"data,omitempty"`
+}
+
+/*
+EventSink delivers CloudEvents to an event system.  HTTPEventSink delivers
+events via HTTP, other transports such as Kafka or NATS can be plugged in by
+implementing this interface, or via EventSinkFunc, typically publishing the
+JSON encoding of the event as message value.
+*/
+type EventSink interface {
+	Send(ctx context.Context, event CloudEvent) error
+}
+
+// EventSinkFunc is an adapter to use an ordinary function as EventSink.
+type EventSinkFunc func(ctx context.Context, event CloudEvent) error
+
+// Send calls f(ctx, event).
+func (f EventSinkFunc) Send(ctx context.Context, event CloudEvent) error {
+	return f(ctx, event)
+}
+
+/*
+HTTPEventSink delivers events to URL via HTTP POST in structured content mode,
+i.e. the entire event is the JSON encoded request body.  If Client is nil,
+http.DefaultClient is used.  Headers are added to each request, e.g. for
+authentication.
+*/
+type HTTPEventSink struct {
+	URL     string
+	Client  *http.Client
+	Headers map[string]string
+}
+
+/*
+Send posts the passed event to the sink's URL.  Any response status other than
+2xx is treated as failed delivery and results in an ErrEventDelivery.
+*/
+func (s *HTTPEventSink) Send(ctx context.Context, event CloudEvent) (err error) {
+	ctx, span := startSpan(ctx, "in_toto.HTTPEventSink.Send")
+	span.SetAttribute("cloudevents.event_type", event.Type)
+	defer func() { endSpan(span, err) }()
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", CloudEventsContentType)
+	for name, value := range s.Headers {
+		req.Header.Set(name, value)
+	}
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrEventDelivery, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body) //nolint:errcheck
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%w: sink responded with status %d", ErrEventDelivery, resp.StatusCode)
+	}
+	return nil
+}
+
+/*
+EventEmitter publishes supply chain events, such as verification results and
+received links, as CloudEvents to an EventSink.  Source identifies the
+emitting system, e.g. a URI of the verifier, and is used as source attribute
+of all emitted events.
+*/
+type EventEmitter struct {
+	Source string
+	Sink   EventSink
+}
+
+// NewEventEmitter creates an EventEmitter publishing events with the passed
+// source to the passed sink.
+func NewEventEmitter(source string, sink EventSink) *EventEmitter {
+	return &EventEmitter{Source: source, Sink: sink}
+}
+
+// newEventID returns a random event ID.
+func newEventID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+/*
+NewEvent creates a CloudEvent of the passed type and subject with the JSON
+encoding of data as payload.  The event gets a random ID and the current time.
+*/
+func (e *EventEmitter) NewEvent(eventType string, subject string, data interface{}) (CloudEvent, error) {
+	id, err := newEventID()
+	if err != nil {
+		return CloudEvent{}, err
+	}
+	dataBytes, err := json.Marshal(data)
+	if err != nil {
+		return CloudEvent{}, err
+	}
+
+	return CloudEvent{
+		SpecVersion:     CloudEventsSpecVersion,
+		ID:              id,
+		Source:          e.Source,
+		Type:            eventType,
+		Subject:         subject,
+		Time:            time.Now().UTC().Format(time.RFC3339),
+		DataContentType: "application/json",
+		Data:            dataBytes,
+	}, nil
+}
+
+/*
+EmitVerificationResult publishes the passed verification report as event of
+type EventTypeVerificationCompleted, with the verified layout as subject.
+*/
+func (e *EventEmitter) EmitVerificationResult(ctx context.Context, report *VerificationReport) error {
+	if report == nil {
+		return fmt.Errorf("verification result event requires a verification report")
+	}
+	event, err := e.NewEvent(EventTypeVerificationCompleted, report.Layout, report)
+	if err != nil {
+		return err
+	}
+	return e.Sink.Send(ctx, event)
+}
+
+// LinkEventData is the payload of EventTypeLinkReceived events.
+type LinkEventData struct {
+	Name       string                 `json:"name"`
+	KeyIDs     []string               `json:"keyids"`
+	Command    []string               `json:"command,omitempty"`
+	Materials  map[string]HashObj     `json:"materials"`
+	Products   map[string]HashObj     `json:"products"`
+	ByProducts map[string]interface{} `json:"byproducts,omitempty"`
+}
+
+/*
+EmitLinkReceived publishes the link in the passed metadata as event of type
+EventTypeLinkReceived, with the step name of the link as subject.  The event
+carries the key IDs of the link's signatures, but the signatures are not
+verified.
+*/
+func (e *EventEmitter) EmitLinkReceived(ctx context.Context, linkEnv Metadata) error {
+	link, ok := linkEnv.GetPayload().(Link)
+	if !ok {
+		return ErrNotLink
+	}
+
+	data := LinkEventData{
+		Name:       link.Name,
+		KeyIDs:     []string{},
+		Command:    link.Command,
+		Materials:  link.Materials,
+		Products:   link.Products,
+		ByProducts: link.ByProducts,
+	}
+	for _, sig := range linkEnv.Sigs() {
+		data.KeyIDs = append(data.KeyIDs, sig.KeyID)
+	}
+
+	event, err := e.NewEvent(EventTypeLinkReceived, link.Name, data)
+	if err != nil {
+		return err
+	}
+	return e.Sink.Send(ctx, event)
+}
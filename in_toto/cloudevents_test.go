@@ -0,0 +1,100 @@
+package in_toto
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPEventSink(t *testing.T) {
+	var received []CloudEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, CloudEventsContentType, r.Header.Get("Content-Type"))
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		body, _ := io.ReadAll(r.Body)
+		var event CloudEvent
+		if err := json.Unmarshal(body, &event); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received = append(received, event)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	sink := &HTTPEventSink{URL: server.URL, Headers: map[string]string{"Authorization": "Bearer secret"}}
+	emitter := NewEventEmitter("https://verifier.example.com", sink)
+
+	report := NewVerificationReport("demo.layout", nil, errors.New("missing link"))
+	if err := emitter.EmitVerificationResult(context.Background(), report); err != nil {
+		t.Fatalf("EmitVerificationResult failed: %s", err)
+	}
+
+	linkEnv, err := LoadMetadata("write-code.b7d643de.link")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := emitter.EmitLinkReceived(context.Background(), linkEnv); err != nil {
+		t.Fatalf("EmitLinkReceived failed: %s", err)
+	}
+
+	if assert.Len(t, received, 2) {
+		assert.Equal(t, CloudEventsSpecVersion, received[0].SpecVersion)
+		assert.Equal(t, EventTypeVerificationCompleted, received[0].Type)
+		assert.Equal(t, "https://verifier.example.com", received[0].Source)
+		assert.Equal(t, "demo.layout", received[0].Subject)
+		assert.NotEmpty(t, received[0].ID)
+		var receivedReport VerificationReport
+		assert.Nil(t, json.Unmarshal(received[0].Data, &receivedReport))
+		assert.False(t, receivedReport.Passed)
+
+		assert.Equal(t, EventTypeLinkReceived, received[1].Type)
+		assert.Equal(t, "write-code", received[1].Subject)
+		assert.NotEqual(t, received[0].ID, received[1].ID)
+		var data LinkEventData
+		assert.Nil(t, json.Unmarshal(received[1].Data, &data))
+		assert.Equal(t, []string{"b7d643dec0a051096ee5d87221b5d91a33daa658699d30903e1cefb90c418401"}, data.KeyIDs)
+		assert.Contains(t, data.Products, "foo.py")
+	}
+}
+
+func TestHTTPEventSinkErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	emitter := NewEventEmitter("test", &HTTPEventSink{URL: server.URL})
+	err := emitter.EmitVerificationResult(context.Background(), NewVerificationReport("demo.layout", nil, nil))
+	assert.ErrorIs(t, err, ErrEventDelivery)
+
+	err = emitter.EmitVerificationResult(context.Background(), nil)
+	assert.NotNil(t, err)
+
+	layoutEnv, err := LoadMetadata("demo.layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.ErrorIs(t, emitter.EmitLinkReceived(context.Background(), layoutEnv), ErrNotLink)
+}
+
+func TestEventSinkFunc(t *testing.T) {
+	// Other transports, e.g. Kafka or NATS, publish the JSON encoded event
+	var published [][]byte
+	sink := EventSinkFunc(func(ctx context.Context, event CloudEvent) error {
+		msg, err := json.Marshal(event)
+		published = append(published, msg)
+		return err
+	})
+
+	emitter := NewEventEmitter("test", sink)
+	assert.Nil(t, emitter.EmitVerificationResult(context.Background(), NewVerificationReport("demo.layout", nil, nil)))
+	assert.Len(t, published, 1)
+}
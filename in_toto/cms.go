@@ -0,0 +1,205 @@
+package in_toto
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+)
+
+// The following types model the subset of CMS, see RFC 5652, that is needed
+// to verify detached signatures, e.g. as created by gitsign for git commits.
+var (
+	oidCMSData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidCMSSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidCMSMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+)
+
+// cmsHashes maps CMS digest algorithm identifiers to hash functions.  SHA-1
+// is deliberately not supported.
+var cmsHashes = map[string]crypto.Hash{
+	"2.16.840.1.101.3.4.2.1": crypto.SHA256,
+	"2.16.840.1.101.3.4.2.2": crypto.SHA384,
+	"2.16.840.1.101.3.4.2.3": crypto.SHA512,
+}
+
+type cmsContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+// cmsRaw holds an optional implicitly tagged element, e.g. the certificates
+// of signed data, in encoded form.
+type cmsRaw struct {
+	Raw asn1.RawContent
+}
+
+type cmsEncapsulatedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     asn1.RawValue `asn1:"optional,explicit,tag:0"`
+}
+
+type cmsSignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo cmsEncapsulatedContentInfo
+	Certificates     cmsRaw          `asn1:"optional,tag:0"`
+	CRLs             cmsRaw          `asn1:"optional,tag:1"`
+	SignerInfos      []cmsSignerInfo `asn1:"set"`
+}
+
+type cmsSignerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        cmsRaw `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      cmsRaw `asn1:"optional,tag:1"`
+}
+
+type cmsIssuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type cmsAttribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue `asn1:"set"`
+}
+
+/*
+verifyCMSDetachedSignature verifies the passed DER encoded CMS signed data,
+which must carry a single signer and its certificate, over the passed detached
+content.  On success it returns the certificate of the signer, whose trust
+must be established by the caller.
+*/
+func verifyCMSDetachedSignature(der []byte, content []byte) (*x509.Certificate, error) {
+	var contentInfo cmsContentInfo
+	if rest, err := asn1.Unmarshal(der, &contentInfo); err != nil || len(rest) > 0 {
+		return nil, fmt.Errorf("malformed cms content info")
+	}
+	if !contentInfo.ContentType.Equal(oidCMSSignedData) {
+		return nil, fmt.Errorf("cms content is not signed data")
+	}
+	var signedData cmsSignedData
+	if _, err := asn1.Unmarshal(contentInfo.Content.Bytes, &signedData); err != nil {
+		return nil, fmt.Errorf("malformed cms signed data: %s", err)
+	}
+	if !signedData.EncapContentInfo.EContentType.Equal(oidCMSData) ||
+		len(signedData.EncapContentInfo.EContent.FullBytes) > 0 {
+		return nil, fmt.Errorf("cms signature is not detached")
+	}
+	if len(signedData.SignerInfos) != 1 {
+		return nil, fmt.Errorf("expected one cms signer, got %d", len(signedData.SignerInfos))
+	}
+	signerInfo := signedData.SignerInfos[0]
+
+	var certs []*x509.Certificate
+	if len(signedData.Certificates.Raw) > 0 {
+		var rawCerts asn1.RawValue
+		if _, err := asn1.Unmarshal(signedData.Certificates.Raw, &rawCerts); err != nil {
+			return nil, fmt.Errorf("malformed cms certificates")
+		}
+		var err error
+		if certs, err = x509.ParseCertificates(rawCerts.Bytes); err != nil {
+			return nil, fmt.Errorf("malformed cms certificates: %s", err)
+		}
+	}
+	signer, err := cmsSignerCertificate(signerInfo.SID, certs)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, ok := cmsHashes[signerInfo.DigestAlgorithm.Algorithm.String()]
+	if !ok {
+		return nil, fmt.Errorf("unsupported cms digest algorithm %s", signerInfo.DigestAlgorithm.Algorithm)
+	}
+	h := hash.New()
+	h.Write(content)
+	digest := h.Sum(nil)
+
+	// With signed attributes, the signature covers their DER encoding as SET,
+	// which must include the digest of the content, see RFC 5652, 5.4
+	signed := content
+	if len(signerInfo.SignedAttrs.Raw) > 0 {
+		signed = append([]byte{0x31}, signerInfo.SignedAttrs.Raw[1:]...)
+		messageDigest, err := cmsMessageDigest(signed)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(messageDigest, digest) {
+			return nil, fmt.Errorf("cms message digest does not match content")
+		}
+	}
+	h = hash.New()
+	h.Write(signed)
+	signedDigest := h.Sum(nil)
+
+	switch pub := signer.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(pub, signedDigest, signerInfo.Signature) {
+			return nil, fmt.Errorf("invalid cms ecdsa signature")
+		}
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(pub, hash, signedDigest, signerInfo.Signature); err != nil {
+			return nil, fmt.Errorf("invalid cms rsa signature: %s", err)
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(pub, signed, signerInfo.Signature) {
+			return nil, fmt.Errorf("invalid cms ed25519 signature")
+		}
+	default:
+		return nil, fmt.Errorf("%w: cms signer key %T", ErrUnsupportedKeyType, pub)
+	}
+	return signer, nil
+}
+
+// cmsSignerCertificate returns the certificate identified by the passed
+// signer identifier, i.e. by issuer and serial number or by subject key id.
+func cmsSignerCertificate(sid asn1.RawValue, certs []*x509.Certificate) (*x509.Certificate, error) {
+	for _, cert := range certs {
+		switch {
+		case sid.Class == asn1.ClassUniversal && sid.Tag == asn1.TagSequence:
+			var issuerAndSerial cmsIssuerAndSerialNumber
+			if _, err := asn1.Unmarshal(sid.FullBytes, &issuerAndSerial); err != nil {
+				return nil, fmt.Errorf("malformed cms signer identifier")
+			}
+			if bytes.Equal(cert.RawIssuer, issuerAndSerial.Issuer.FullBytes) &&
+				cert.SerialNumber.Cmp(issuerAndSerial.SerialNumber) == 0 {
+				return cert, nil
+			}
+		case sid.Class == asn1.ClassContextSpecific && sid.Tag == 0:
+			if len(cert.SubjectKeyId) > 0 && bytes.Equal(cert.SubjectKeyId, sid.Bytes) {
+				return cert, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("cms signer certificate not found")
+}
+
+// cmsMessageDigest returns the message digest attribute of the passed DER
+// encoded signed attributes.
+func cmsMessageDigest(signedAttrs []byte) ([]byte, error) {
+	var attrs []cmsAttribute
+	if _, err := asn1.UnmarshalWithParams(signedAttrs, &attrs, "set"); err != nil {
+		return nil, fmt.Errorf("malformed cms signed attributes")
+	}
+	for _, attr := range attrs {
+		if !attr.Type.Equal(oidCMSMessageDigest) {
+			continue
+		}
+		var digest []byte
+		if _, err := asn1.Unmarshal(attr.Values.Bytes, &digest); err != nil {
+			return nil, fmt.Errorf("malformed cms message digest")
+		}
+		return digest, nil
+	}
+	return nil, fmt.Errorf("cms signed attributes lack a message digest")
+}
@@ -0,0 +1,127 @@
+package in_toto
+
+import (
+	"fmt"
+	"strings"
+)
+
+// shellMetacharacters are characters that have a special meaning when a
+// string is interpreted by a shell, e.g. command separators, pipes,
+// redirections, substitutions and globs.
+const shellMetacharacters = ";|&$`<>()*?[]{}~!\\\"'\n"
+
+// knownShells are executables that interpret (part of) their arguments as
+// shell commands.
+var knownShells = NewSet("sh", "bash", "dash", "zsh", "ksh", "mksh", "csh",
+	"tcsh", "fish", "ash", "busybox", "cmd", "cmd.exe", "powershell",
+	"powershell.exe", "pwsh", "pwsh.exe")
+
+/*
+CommandsEqual compares the passed commands argument by argument.  Unlike
+comparing the joined command strings, this does not confuse commands whose
+arguments only differ in how they are split, e.g. `sh -c "a b"` and
+`sh -c a b`.
+*/
+func CommandsEqual(expected []string, executed []string) bool {
+	if len(expected) != len(executed) {
+		return false
+	}
+	for i := range expected {
+		if expected[i] != executed[i] {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+CommandShellRisk describes an argument of a command that is interpreted by a
+shell and contains shell metacharacters.  Such commands are prone to
+injection, e.g. via parameter substitution, and their semantics cannot be told
+from the argv alone.
+*/
+type CommandShellRisk struct {
+	// Index of the risky argument in the command
+	Index int
+	// Argument is the risky argument
+	Argument string
+	// Metacharacters found in the argument
+	Metacharacters string
+}
+
+func (r CommandShellRisk) String() string {
+	return fmt.Sprintf("argument %d (%q) is interpreted by a shell and contains"+
+		" the metacharacter(s) %q", r.Index, r.Argument, r.Metacharacters)
+}
+
+// executableName returns the file name of the passed executable path.
+// Unlike filepath.Base, it handles Windows separators on all platforms.
+func executableName(executable string) string {
+	return strings.ToLower(executable[strings.LastIndexAny(executable, `/\`)+1:])
+}
+
+// isShell returns true if the passed executable is a known shell.
+func isShell(executable string) bool {
+	return knownShells.Has(executableName(executable))
+}
+
+// isShellCommandFlag returns true if the passed argument makes a shell execute
+// the next argument as command string.
+func isShellCommandFlag(arg string) bool {
+	switch strings.ToLower(arg) {
+	case "-c", "/c", "/k", "-command", "-encodedcommand":
+		return true
+	}
+	// Combined short flags, e.g. `bash -ec`
+	return strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "--") &&
+		strings.Contains(arg, "c")
+}
+
+/*
+AnalyzeCommandShellSafety returns the risks of the passed command, if it runs a
+shell with a command string, e.g. `sh -c "..."`, and the command string, or
+any argument passed to it, contains shell metacharacters.  Commands that do
+not run a shell are considered safe, because their arguments are passed to the
+executable verbatim.
+*/
+func AnalyzeCommandShellSafety(command []string) []CommandShellRisk {
+	if len(command) == 0 {
+		return nil
+	}
+
+	shellIndex := 0
+	// Skip wrappers such as `env sh -c ...` or `sudo sh -c ...`
+	for shellIndex < len(command)-1 && !isShell(command[shellIndex]) {
+		name := executableName(command[shellIndex])
+		if name != "env" && name != "sudo" && name != "exec" {
+			break
+		}
+		shellIndex++
+	}
+	if !isShell(command[shellIndex]) {
+		return nil
+	}
+
+	risks := []CommandShellRisk{}
+	scriptStarted := false
+	for i := shellIndex + 1; i < len(command); i++ {
+		arg := command[i]
+		if !scriptStarted {
+			if isShellCommandFlag(arg) {
+				scriptStarted = true
+			}
+			continue
+		}
+
+		found := ""
+		for _, c := range arg {
+			if strings.ContainsRune(shellMetacharacters, c) && !strings.ContainsRune(found, c) {
+				found += string(c)
+			}
+		}
+		if found != "" {
+			risks = append(risks, CommandShellRisk{Index: i, Argument: arg, Metacharacters: found})
+		}
+	}
+	return risks
+}
@@ -0,0 +1,56 @@
+package in_toto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandsEqual(t *testing.T) {
+	tables := []struct {
+		expected []string
+		executed []string
+		equal    bool
+	}{
+		{[]string{}, []string{}, true},
+		{nil, []string{}, true},
+		{[]string{"git", "clone", "foo"}, []string{"git", "clone", "foo"}, true},
+		{[]string{"git", "clone", "foo"}, []string{"git", "clone"}, false},
+		{[]string{"sh", "-c", "a b"}, []string{"sh", "-c", "a", "b"}, false},
+		{[]string{"a b"}, []string{"a", "b"}, false},
+	}
+	for _, table := range tables {
+		if CommandsEqual(table.expected, table.executed) != table.equal {
+			t.Errorf("CommandsEqual(%q, %q) returned %t, expected %t",
+				table.expected, table.executed, !table.equal, table.equal)
+		}
+	}
+}
+
+func TestAnalyzeCommandShellSafety(t *testing.T) {
+	tables := []struct {
+		name    string
+		command []string
+		risks   []CommandShellRisk
+	}{
+		{"empty command", []string{}, nil},
+		{"no shell", []string{"tar", "zcvf", "foo.tar.gz", "foo;rm -rf /"}, nil},
+		{"shell without metacharacters", []string{"sh", "-c", "make test"}, []CommandShellRisk{}},
+		{"shell script without command string", []string{"bash", "build.sh", "$HOME"}, []CommandShellRisk{}},
+		{"shell with command separator", []string{"sh", "-c", "make; make install"},
+			[]CommandShellRisk{{Index: 2, Argument: "make; make install", Metacharacters: ";"}}},
+		{"shell with substitution", []string{"/bin/bash", "-ec", "echo $(cat foo) | tee bar"},
+			[]CommandShellRisk{{Index: 2, Argument: "echo $(cat foo) | tee bar", Metacharacters: "$()|"}}},
+		{"wrapped shell", []string{"/usr/bin/env", "bash", "-c", "a && b"},
+			[]CommandShellRisk{{Index: 3, Argument: "a && b", Metacharacters: "&"}}},
+		{"windows shell", []string{`C:\Windows\System32\cmd.exe`, "/C", "a > b"},
+			[]CommandShellRisk{{Index: 2, Argument: "a > b", Metacharacters: ">"}}},
+	}
+	for _, table := range tables {
+		risks := AnalyzeCommandShellSafety(table.command)
+		assert.Equal(t, table.risks, risks, table.name)
+	}
+
+	risk := CommandShellRisk{Index: 2, Argument: "a;b", Metacharacters: ";"}
+	assert.Contains(t, risk.String(), `"a;b"`)
+}
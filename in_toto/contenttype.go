@@ -0,0 +1,281 @@
+package in_toto
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ContentTypesEnvironmentKey is the key of the content types of the
+// artifacts of a link in its Environment, see ArtifactContentTypes.
+const ContentTypesEnvironmentKey = "content_types"
+
+// DirectoryContentType is the content type of directory artifacts, i.e. empty
+// directories and directories recorded as a single artifact.
+const DirectoryContentType = "inode/directory"
+
+// ErrContentTypeNotAllowed indicates that an artifact of a step has a content
+// type that is not allowed for the step, see WithAllowedProductContentTypes.
+var ErrContentTypeNotAllowed = errors.New("artifact content type not allowed")
+
+// contentTypeSniffLen is the maximum number of bytes considered by
+// http.DetectContentType.
+const contentTypeSniffLen = 512
+
+/*
+contentTypesByExtension refines the content types of formats that are not
+recognized by content sniffing, e.g. detached signatures.  A fixed table is
+used instead of mime.TypeByExtension, which depends on the system's MIME
+database, so that links of the same files agree across platforms.
+*/
+var contentTypesByExtension = map[string]string{
+	".asc":   "application/pgp-signature",
+	".sig":   "application/pgp-signature",
+	".p7s":   "application/pkcs7-signature",
+	".pem":   "application/x-pem-file",
+	".crt":   "application/x-x509-ca-cert",
+	".tar":   "application/x-tar",
+	".json":  "application/json",
+	".jsonl": "application/jsonl",
+	".link":  "application/vnd.in-toto+json",
+	".yaml":  "application/yaml",
+	".yml":   "application/yaml",
+}
+
+/*
+ArtifactContentTypes holds the content types of the materials and products of
+a link by artifact name, e.g. "application/gzip".  They are recorded if
+DetectContentTypes is set in the artifact profile of a step, and stored in the
+Environment of the link under ContentTypesEnvironmentKey, see
+GetArtifactContentTypes.
+*/
+type ArtifactContentTypes struct {
+	Materials map[string]string `json:"materials,omitempty"`
+	Products  map[string]string `json:"products,omitempty"`
+}
+
+/*
+DetectContentType returns the media type of the file at the passed path,
+without parameters.  The type is sniffed from the first 512 bytes of the file
+with http.DetectContentType.  Files that are sniffed as generic binary or
+plain text are refined by their extension, e.g. ".sig" files are detected as
+"application/pgp-signature".  Directories are of type DirectoryContentType.
+Symlinks are followed, like RecordArtifact does.
+*/
+func DetectContentType(artifactPath string) (string, error) {
+	info, err := os.Stat(artifactPath)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return DirectoryContentType, nil
+	}
+
+	f, err := os.Open(artifactPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	data := make([]byte, contentTypeSniffLen)
+	n, err := io.ReadFull(f, data)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	return detectContentType(filepath.Base(artifactPath), data[:n]), nil
+}
+
+// detectContentType returns the media type of the passed data of the file of
+// the passed name, see DetectContentType.
+func detectContentType(name string, data []byte) string {
+	mediaType, _, err := mime.ParseMediaType(http.DetectContentType(data))
+	if err != nil {
+		mediaType = "application/octet-stream"
+	}
+	if mediaType == "application/octet-stream" || mediaType == "text/plain" {
+		if refined, ok := contentTypesByExtension[strings.ToLower(path.Ext(name))]; ok {
+			return refined
+		}
+	}
+	return mediaType
+}
+
+/*
+detectContentTypes returns the content types of the files at the passed
+paths by artifact name, as returned by recordArtifacts.  Artifacts with an
+empty path, i.e. empty directories, and artifacts whose path ends with a
+separator are directories.
+*/
+func detectContentTypes(artifactPaths map[string]string) (map[string]string, error) {
+	contentTypes := make(map[string]string, len(artifactPaths))
+	for name, artifactPath := range artifactPaths {
+		name = filepath.ToSlash(name)
+		if artifactPath == "" || strings.HasSuffix(artifactPath, string(filepath.Separator)) {
+			contentTypes[name] = DirectoryContentType
+			continue
+		}
+		contentType, err := DetectContentType(artifactPath)
+		if err != nil {
+			return nil, err
+		}
+		contentTypes[name] = contentType
+	}
+	return contentTypes, nil
+}
+
+/*
+GetArtifactContentTypes returns the content types recorded in the Environment
+of the passed link.  If the link has no content types, empty content types
+are returned.  Content types are part of the signed link, but are reported by
+the functionary, the verifier does not sniff the artifacts itself.
+*/
+func GetArtifactContentTypes(link Link) (ArtifactContentTypes, error) {
+	var contentTypes ArtifactContentTypes
+	ok, err := link.Environment.Custom(ContentTypesEnvironmentKey, &contentTypes)
+	if err != nil {
+		return ArtifactContentTypes{}, fmt.Errorf("invalid content types in link '%s': %w", link.Name, err)
+	}
+	if !ok {
+		return ArtifactContentTypes{}, nil
+	}
+	return contentTypes, nil
+}
+
+// setArtifactContentTypes stores the passed content types in the Environment
+// of the passed link.
+func setArtifactContentTypes(link *Link, contentTypes ArtifactContentTypes) {
+	link.Environment.SetCustom(ContentTypesEnvironmentKey, contentTypes)
+}
+
+/*
+ArtifactContentType describes an artifact of a step and its recorded content
+type, as passed to a ContentTypeHook.  ContentType is empty, if the link of
+the step does not record the content type of the artifact.
+*/
+type ArtifactContentType struct {
+	Step        string
+	Name        string
+	ContentType string
+	// Product is set for products and unset for materials
+	Product bool
+}
+
+/*
+ContentTypeHook is called during verification for the artifacts of the steps
+of a layout, whose content type matches the pattern the hook is registered
+with, see WithContentTypeHook.  If the hook returns an error, verification
+fails with the error.
+*/
+type ContentTypeHook func(artifact ArtifactContentType) error
+
+// contentTypeHook is a ContentTypeHook with the content type pattern it is
+// registered for.
+type contentTypeHook struct {
+	pattern string
+	hook    ContentTypeHook
+}
+
+// matchContentType reports whether the passed content type matches the
+// passed pattern, e.g. "application/*", see path.Match.
+func matchContentType(pattern string, contentType string) bool {
+	matched, err := path.Match(pattern, contentType)
+	return err == nil && matched
+}
+
+/*
+allowedProductContentTypes returns a ContentTypeHook, which fails with an
+ErrContentTypeNotAllowed for products of the passed step, whose content type
+matches none of the passed patterns.
+*/
+func allowedProductContentTypes(stepName string, patterns []string) ContentTypeHook {
+	return func(artifact ArtifactContentType) error {
+		if artifact.Step != stepName || !artifact.Product {
+			return nil
+		}
+		for _, pattern := range patterns {
+			if matchContentType(pattern, artifact.ContentType) {
+				return nil
+			}
+		}
+		contentType := artifact.ContentType
+		if contentType == "" {
+			contentType = "unknown"
+		}
+		return fmt.Errorf("%w: product '%s' of step '%s' is of type '%s', expected one of '%s'",
+			ErrContentTypeNotAllowed, artifact.Name, artifact.Step, contentType,
+			strings.Join(patterns, "', '"))
+	}
+}
+
+/*
+verifyContentTypes calls the passed hooks for the materials and products of
+the links of the steps of the passed layout, whose content type matches the
+pattern of a hook.  Steps, links and artifacts are visited in a fixed order,
+so that the same error is returned on every run.  Links without Link payload,
+e.g. the summary links of sublayouts, are skipped.
+*/
+func verifyContentTypes(layout Layout, stepsMetadata map[string]map[string]Metadata, hooks []contentTypeHook) error {
+	if len(hooks) == 0 {
+		return nil
+	}
+	for _, step := range layout.Steps {
+		keyIDs := make([]string, 0, len(stepsMetadata[step.Name]))
+		for keyID := range stepsMetadata[step.Name] {
+			keyIDs = append(keyIDs, keyID)
+		}
+		sort.Strings(keyIDs)
+
+		for _, keyID := range keyIDs {
+			link, ok := stepsMetadata[step.Name][keyID].GetPayload().(Link)
+			if !ok {
+				continue
+			}
+			contentTypes, err := GetArtifactContentTypes(link)
+			if err != nil {
+				return err
+			}
+			if err := verifyArtifactContentTypes(step.Name, link.Materials, contentTypes.Materials, false, hooks); err != nil {
+				return err
+			}
+			if err := verifyArtifactContentTypes(step.Name, link.Products, contentTypes.Products, true, hooks); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// verifyArtifactContentTypes calls the passed hooks for the passed artifacts
+// of a step in lexical order, see verifyContentTypes.
+func verifyArtifactContentTypes(stepName string, artifacts map[string]HashObj, contentTypes map[string]string, product bool, hooks []contentTypeHook) error {
+	names := make([]string, 0, len(artifacts))
+	for name := range artifacts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		artifact := ArtifactContentType{
+			Step:        stepName,
+			Name:        name,
+			ContentType: contentTypes[name],
+			Product:     product,
+		}
+		for _, h := range hooks {
+			if !matchContentType(h.pattern, artifact.ContentType) {
+				continue
+			}
+			if err := h.hook(artifact); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package in_toto
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectContentType(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"foo.tar.gz":     {0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00},
+		"foo.tar.gz.sig": []byte("-----BEGIN PGP SIGNATURE-----\n"),
+		"foo.json":       []byte(`{"foo": "bar"}`),
+		"foo.txt":        []byte("foo\n"),
+		"foo.bin":        {0x00, 0x01, 0x02, 0x03},
+		"foo.sig.html":   []byte("<!DOCTYPE html><html></html>"),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tables := []struct {
+		name        string
+		contentType string
+	}{
+		{"foo.tar.gz", "application/x-gzip"},
+		{"foo.tar.gz.sig", "application/pgp-signature"},
+		{"foo.json", "application/json"},
+		{"foo.txt", "text/plain"},
+		{"foo.bin", "application/octet-stream"},
+		// Sniffed types take precedence over extensions
+		{"foo.sig.html", "text/html"},
+	}
+	for _, table := range tables {
+		contentType, err := DetectContentType(filepath.Join(dir, table.name))
+		assert.Nil(t, err, table.name)
+		assert.Equal(t, table.contentType, contentType, table.name)
+	}
+
+	contentType, err := DetectContentType(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, DirectoryContentType, contentType)
+
+	_, err = DetectContentType(filepath.Join(dir, "missing"))
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+}
+
+func TestRecordContentTypes(t *testing.T) {
+	var key Key
+	if err := key.LoadKey("carol", "ed25519", []string{"sha256", "sha512"}); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	source := filepath.Join(dir, "foo.txt")
+	archive := filepath.Join(dir, "foo.tar.gz")
+	if err := os.WriteFile(source, []byte("foo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(archive, []byte{0x1f, 0x8b, 0x08, 0x00}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	profile := ArtifactProfile{LStripPaths: []string{dir + "/"}, DetectContentTypes: true}
+
+	// Content types are only recorded if enabled
+	linkEnv, err := Run("step", nil, key, WithMaterials(source), WithProducts(archive),
+		WithArtifactProfile(ArtifactProfile{LStripPaths: profile.LStripPaths}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotContains(t, linkEnv.GetPayload().(Link).Environment, ContentTypesEnvironmentKey)
+
+	linkEnv, err = Run("step", nil, key, WithMaterials(source), WithProducts(archive),
+		WithArtifactProfile(profile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := ArtifactContentTypes{
+		Materials: map[string]string{"foo.txt": "text/plain"},
+		Products:  map[string]string{"foo.tar.gz": "application/x-gzip"},
+	}
+	contentTypes, err := GetArtifactContentTypes(linkEnv.GetPayload().(Link))
+	assert.Nil(t, err)
+	assert.Equal(t, expected, contentTypes)
+
+	// Content types are part of the signed link and survive a round trip
+	var buf bytes.Buffer
+	if err := DumpMetadataTo(linkEnv, &buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadMetadataFrom(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, loaded.VerifySignature(key))
+	contentTypes, err = GetArtifactContentTypes(loaded.GetPayload().(Link))
+	assert.Nil(t, err)
+	assert.Equal(t, expected, contentTypes)
+
+	// RecordStop keeps the content types of the materials recorded by
+	// RecordStart
+	linkEnv, err = InTotoRecordStartWithProfile("step", []string{source}, key, profile, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	linkEnv, err = InTotoRecordStopWithProfile(linkEnv, []string{archive}, key, profile, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contentTypes, err = GetArtifactContentTypes(linkEnv.GetPayload().(Link))
+	assert.Nil(t, err)
+	assert.Equal(t, expected, contentTypes)
+
+	_, err = GetArtifactContentTypes(Link{Environment: map[string]interface{}{
+		ContentTypesEnvironmentKey: "application/json",
+	}})
+	assert.NotNil(t, err)
+}
+
+func TestVerifyContentTypes(t *testing.T) {
+	layout := Layout{Steps: []Step{{SupplyChainItem: SupplyChainItem{Name: "sign"}}}}
+	link := Link{
+		Type:      "link",
+		Name:      "sign",
+		Materials: map[string]HashObj{"foo.tar.gz": {}},
+		Products:  map[string]HashObj{"foo.tar.gz": {}, "foo.tar.gz.sig": {}, "README": {}},
+		Environment: map[string]interface{}{ContentTypesEnvironmentKey: map[string]interface{}{
+			"materials": map[string]interface{}{"foo.tar.gz": "application/x-gzip"},
+			"products": map[string]interface{}{
+				"foo.tar.gz":     "application/x-gzip",
+				"foo.tar.gz.sig": "application/pgp-signature",
+			},
+		}},
+	}
+	stepsMetadata := map[string]map[string]Metadata{
+		"sign": {"keyid": &Metablock{Signed: link}},
+	}
+
+	// Hooks are called by content type pattern
+	var called []ArtifactContentType
+	hooks := []contentTypeHook{{pattern: "application/*", hook: func(artifact ArtifactContentType) error {
+		called = append(called, artifact)
+		return nil
+	}}}
+	assert.Nil(t, verifyContentTypes(layout, stepsMetadata, hooks))
+	assert.Equal(t, []ArtifactContentType{
+		{Step: "sign", Name: "foo.tar.gz", ContentType: "application/x-gzip"},
+		{Step: "sign", Name: "foo.tar.gz", ContentType: "application/x-gzip", Product: true},
+		{Step: "sign", Name: "foo.tar.gz.sig", ContentType: "application/pgp-signature", Product: true},
+	}, called)
+
+	hookErr := errors.New("no archives")
+	hooks = []contentTypeHook{{pattern: "application/x-gzip", hook: func(artifact ArtifactContentType) error {
+		return hookErr
+	}}}
+	assert.ErrorIs(t, verifyContentTypes(layout, stepsMetadata, hooks), hookErr)
+
+	// Products without content type are not allowed
+	hooks = []contentTypeHook{{pattern: "*", hook: allowedProductContentTypes("sign",
+		[]string{"application/pgp-signature", "application/*gzip"})}}
+	err := verifyContentTypes(layout, stepsMetadata, hooks)
+	assert.ErrorIs(t, err, ErrContentTypeNotAllowed)
+	assert.Contains(t, err.Error(), "'README'")
+
+	delete(link.Products, "README")
+	assert.Nil(t, verifyContentTypes(layout, stepsMetadata, hooks))
+
+	// Other steps are not affected
+	hooks = []contentTypeHook{{pattern: "*", hook: allowedProductContentTypes("package",
+		[]string{"text/plain"})}}
+	assert.Nil(t, verifyContentTypes(layout, stepsMetadata, hooks))
+}
+
+func TestVerifyWithAllowedProductContentTypes(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := GenerateTestVectors(dir, []byte("content types")); err != nil {
+		t.Fatal(err)
+	}
+	var ownerKey Key
+	if err := ownerKey.LoadKeyDefaults(filepath.Join(dir, "keys", "owner.pub")); err != nil {
+		t.Fatal(err)
+	}
+	layoutKeys := map[string]Key{ownerKey.KeyID: ownerKey}
+	layoutEnv, err := LoadMetadata(filepath.Join(dir, "valid", RootLayoutName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	linkDir := filepath.Join(dir, "valid")
+
+	_, err = Verify(layoutEnv, layoutKeys, linkDir, WithAllowedProductContentTypes("package", "*"))
+	assert.Nil(t, err)
+
+	// The links of the test vectors do not record content types
+	_, err = Verify(layoutEnv, layoutKeys, linkDir, WithAllowedProductContentTypes("package", "application/*"))
+	assert.ErrorIs(t, err, ErrContentTypeNotAllowed)
+}
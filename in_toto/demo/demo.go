@@ -0,0 +1,497 @@
+/*
+Package demo builds the classic in-toto demo supply chain, in which bob clones
+the demo project and updates its version, and carl packages it, with a root
+layout signed by alice.  Tamperings can be injected, e.g. a modified artifact
+or a link signed by the unauthorized mallory, so that tutorials, tests and
+conformance checks of downstream integrators can exercise verification
+failures without crafting metadata by hand:
+
+	chain, err := demo.New(demo.TamperArtifact())
+	if err != nil {
+		return err
+	}
+	if err := chain.Write("."); err != nil {
+		return err
+	}
+	_, err = chain.Verify(".") // errors.Is(err, chain.Err)
+*/
+package demo
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/in-toto/in-toto-golang/in_toto"
+)
+
+// Step and inspection names of the demo supply chain.
+const (
+	StepClone         = "clone"
+	StepUpdateVersion = "update-version"
+	StepPackage       = "package"
+	InspectionUntar   = "untar"
+)
+
+// Paths of the artifacts of the demo supply chain, relative to the directory
+// the steps are carried out in.
+const (
+	SourcePath  = "demo-project/foo.py"
+	PackagePath = "demo-project.tar.gz"
+)
+
+// DefaultExpires is the expiration date of the layout, if not set with
+// WithExpires.  It is fixed, so that seeded supply chains are reproducible.
+var DefaultExpires = time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// expired is the expiration date of the layout injected by ExpireLayout.
+var expired = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+var (
+	sourceV0 = []byte("VERSION = \"foo-v0\"\n\nprint(\"Hello in-toto\")\n")
+	sourceV1 = []byte("VERSION = \"foo-v1\"\n\nprint(\"Hello in-toto\")\n")
+	// sourceMalicious is the source injected by TamperArtifact and
+	// TamperPackage
+	sourceMalicious = []byte("VERSION = \"foo-v1\"\n\nprint(\"Hello in-toto\")\nprint(\"Attack!\")\n")
+)
+
+/*
+SupplyChain is a demo supply chain built with New.  Alice is the layout
+owner, Bob the functionary of the clone and update-version steps, Carl the
+functionary of the package step and Mallory a key the layout does not
+trust; all keys include their private part.  Links holds the signed links of
+the steps by step name, without steps whose link was removed, and Package the
+delivered demo-project.tar.gz.  Err is nil, if the supply chain passes
+verification, or the sentinel error the verification error matches with
+errors.Is.
+*/
+type SupplyChain struct {
+	Alice, Bob, Carl, Mallory in_toto.Key
+	Layout                    *in_toto.Metablock
+	Links                     map[string]*in_toto.Metablock
+	Package                   []byte
+	Err                       error
+}
+
+/*
+Option configures the demo supply chain built by New, e.g. its keys or a
+tampering.  Tamperings are applied in a fixed order, regardless of the order
+of the options, and Err is the error of the tampering verification detects
+first.
+*/
+type Option func(*config)
+
+// tampering is a modification of the demo supply chain applied after it was
+// carried out.  Tamperings of lower stages are detected first by Verify.
+type tampering struct {
+	stage int
+	err   error
+	apply func(*SupplyChain) error
+}
+
+// Stages of tamperings, in the order Verify detects them.
+const (
+	stageLayout = iota
+	stageLinks
+	stageArtifacts
+	stageInspections
+)
+
+type config struct {
+	seed       []byte
+	expires    time.Time
+	inspection bool
+	source     []byte
+	tamperings []tampering
+}
+
+/*
+WithSeed derives the keys of the supply chain from the passed seed, see
+in_toto.DeterministicReader, so that the same seed always yields the same
+metadata.  By default, keys are generated randomly.  Seeded keys must never be
+used for anything but demos.
+*/
+func WithSeed(seed []byte) Option {
+	return func(c *config) { c.seed = seed }
+}
+
+// WithExpires sets the expiration date of the layout, DefaultExpires by
+// default.
+func WithExpires(expires time.Time) Option {
+	return func(c *config) { c.expires = expires }
+}
+
+/*
+WithInspection adds the untar inspection to the layout, which extracts the
+delivered package and checks that it contains the source of the
+update-version step.  It requires the tar command, and must run in the
+directory the supply chain is written to, see Verify.
+*/
+func WithInspection() Option {
+	return func(c *config) { c.inspection = true }
+}
+
+/*
+TamperArtifact modifies the source after the update-version step and before
+the package step, so that the materials of the package step do not match the
+products of the update-version step.  Verify fails with an
+in_toto.ErrRuleViolation.
+*/
+func TamperArtifact() Option {
+	return func(c *config) {
+		c.source = sourceMalicious
+		c.tamperings = append(c.tamperings, tampering{stage: stageArtifacts, err: in_toto.ErrRuleViolation})
+	}
+}
+
+/*
+TamperPackage replaces the delivered package with one containing a
+malicious source, after the package step.  Only the untar inspection detects
+it, see WithInspection, and Verify fails with an in_toto.ErrRuleViolation.
+Without inspection, the supply chain passes verification.
+*/
+func TamperPackage() Option {
+	return func(c *config) {
+		c.tamperings = append(c.tamperings, tampering{
+			stage: stageInspections,
+			err:   in_toto.ErrRuleViolation,
+			apply: func(s *SupplyChain) error {
+				pkg, err := packageSource(sourceMalicious)
+				s.Package = pkg
+				return err
+			},
+		})
+	}
+}
+
+/*
+TamperLink modifies the link of the passed step after its functionary signed
+it, so that its signature does not verify.  Verify fails with an
+in_toto.ErrThresholdNotMet.
+*/
+func TamperLink(step string) Option {
+	return tamperLink(step, func(s *SupplyChain, linkMb *in_toto.Metablock) error {
+		link := linkMb.Signed.(in_toto.Link)
+		link.Command = append(append([]string{}, link.Command...), "--backdoor")
+		linkMb.Signed = link
+		return nil
+	})
+}
+
+// RemoveLink removes the link of the passed step.  Verify fails with an
+// in_toto.ErrThresholdNotMet.
+func RemoveLink(step string) Option {
+	return tamperLink(step, func(s *SupplyChain, linkMb *in_toto.Metablock) error {
+		delete(s.Links, step)
+		return nil
+	})
+}
+
+/*
+UnauthorizedFunctionary signs the link of the passed step with the key of
+mallory instead of the functionary of the step.  Verify fails with an
+in_toto.ErrThresholdNotMet.
+*/
+func UnauthorizedFunctionary(step string) Option {
+	return tamperLink(step, func(s *SupplyChain, linkMb *in_toto.Metablock) error {
+		*linkMb = in_toto.Metablock{Signed: linkMb.Signed}
+		return linkMb.Sign(s.Mallory)
+	})
+}
+
+// tamperLink returns an option, which applies the passed tampering to the
+// link of the passed step.
+func tamperLink(step string, apply func(*SupplyChain, *in_toto.Metablock) error) Option {
+	return func(c *config) {
+		c.tamperings = append(c.tamperings, tampering{
+			stage: stageLinks,
+			err:   in_toto.ErrThresholdNotMet,
+			apply: func(s *SupplyChain) error {
+				linkMb, ok := s.Links[step]
+				if !ok {
+					return fmt.Errorf("no link of step '%s'", step)
+				}
+				return apply(s, linkMb)
+			},
+		})
+	}
+}
+
+// ExpireLayout sets the expiration date of the layout to the past.  Verify
+// fails with an in_toto.ErrLayoutExpired.
+func ExpireLayout() Option {
+	return func(c *config) {
+		c.expires = expired
+		c.tamperings = append(c.tamperings, tampering{stage: stageLayout, err: in_toto.ErrLayoutExpired})
+	}
+}
+
+/*
+New builds the demo supply chain configured by the passed options: it
+generates the keys, the signed layout and the signed links of a run of the
+supply chain, and applies the tamperings, if any.
+*/
+func New(opts ...Option) (*SupplyChain, error) {
+	c := config{expires: DefaultExpires, source: sourceV1}
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	s := &SupplyChain{Links: map[string]*in_toto.Metablock{}}
+	var rand *in_toto.DeterministicReader
+	if c.seed != nil {
+		rand = in_toto.NewDeterministicReader(c.seed)
+	}
+	for _, key := range []*in_toto.Key{&s.Alice, &s.Bob, &s.Carl, &s.Mallory} {
+		var err error
+		if *key, err = newKey(rand); err != nil {
+			return nil, err
+		}
+	}
+
+	var err error
+	if s.Package, err = packageSource(c.source); err != nil {
+		return nil, err
+	}
+	s.Layout = &in_toto.Metablock{Signed: layout(s, c)}
+	if err := s.Layout.Sign(s.Alice); err != nil {
+		return nil, err
+	}
+
+	sourceV0Digest := digest(sourceV0)
+	links := []struct {
+		link in_toto.Link
+		key  in_toto.Key
+	}{
+		{newLink(StepClone, []string{"git", "clone", "https://github.com/in-toto/demo-project.git"},
+			nil, map[string]in_toto.HashObj{SourcePath: sourceV0Digest}), s.Bob},
+		{newLink(StepUpdateVersion, []string{"vi", SourcePath},
+			map[string]in_toto.HashObj{SourcePath: sourceV0Digest},
+			map[string]in_toto.HashObj{SourcePath: digest(sourceV1)}), s.Bob},
+		{newLink(StepPackage, []string{"tar", "--exclude", ".git", "-zcvf", PackagePath, "demo-project"},
+			map[string]in_toto.HashObj{SourcePath: digest(c.source)},
+			map[string]in_toto.HashObj{PackagePath: digest(s.Package)}), s.Carl},
+	}
+	for _, l := range links {
+		linkMb := &in_toto.Metablock{Signed: l.link}
+		if err := linkMb.Sign(l.key); err != nil {
+			return nil, err
+		}
+		s.Links[l.link.Name] = linkMb
+	}
+
+	sort.SliceStable(c.tamperings, func(i, j int) bool {
+		return c.tamperings[i].stage < c.tamperings[j].stage
+	})
+	for _, t := range c.tamperings {
+		if t.apply != nil {
+			if err := t.apply(s); err != nil {
+				return nil, err
+			}
+		}
+		// Without inspections, tampered packages go unnoticed
+		if s.Err == nil && (t.stage != stageInspections || c.inspection) {
+			s.Err = t.err
+		}
+	}
+	return s, nil
+}
+
+/*
+Write writes the supply chain to the passed directory, as if it was carried
+out there: the signed root layout, the signed links named like links recorded
+with in-toto run, the delivered package, and the keys of alice, bob, carl and
+mallory in the format of in-toto-keygen, in a "keys" subdirectory.
+*/
+func (s *SupplyChain) Write(dir string) error {
+	keyDir := filepath.Join(dir, "keys")
+	if err := os.MkdirAll(keyDir, 0755); err != nil {
+		return err
+	}
+	for name, key := range map[string]in_toto.Key{"alice": s.Alice, "bob": s.Bob, "carl": s.Carl, "mallory": s.Mallory} {
+		if err := in_toto.WriteKeyPair(filepath.Join(keyDir, name), key, nil); err != nil {
+			return err
+		}
+	}
+	if err := s.Layout.Dump(filepath.Join(dir, in_toto.RootLayoutName)); err != nil {
+		return err
+	}
+	for name, linkMb := range s.Links {
+		for _, sig := range linkMb.Signatures {
+			if err := linkMb.Dump(filepath.Join(dir, fmt.Sprintf(in_toto.LinkNameFormat, name, sig.KeyID))); err != nil {
+				return err
+			}
+		}
+	}
+	return os.WriteFile(filepath.Join(dir, PackagePath), s.Package, 0644)
+}
+
+/*
+Verify verifies the supply chain written to the passed directory with Write,
+with the public key of alice as layout key, see in_toto.Verify.  Like
+in-toto-verify in the classic demo, inspections run in the current working
+directory, hence with WithInspection, Verify must be called in the directory
+passed to Write.
+*/
+func (s *SupplyChain) Verify(dir string, opts ...in_toto.VerifyOption) (in_toto.Metadata, error) {
+	layoutKeys := map[string]in_toto.Key{s.Alice.KeyID: publicKey(s.Alice)}
+	return in_toto.Verify(s.Layout, layoutKeys, dir, opts...)
+}
+
+// layout returns the layout of the demo supply chain of the passed keys.
+func layout(s *SupplyChain, c config) in_toto.Layout {
+	l := in_toto.Layout{
+		Type:    "layout",
+		Expires: c.expires.UTC().Format(in_toto.ISO8601DateSchema),
+		Readme:  "in-toto demo supply chain",
+		Keys: map[string]in_toto.Key{
+			s.Bob.KeyID:  publicKey(s.Bob),
+			s.Carl.KeyID: publicKey(s.Carl),
+		},
+		Steps: []in_toto.Step{
+			{
+				Type:            "step",
+				PubKeys:         []string{s.Bob.KeyID},
+				ExpectedCommand: []string{"git", "clone", "https://github.com/in-toto/demo-project.git"},
+				Threshold:       1,
+				SupplyChainItem: in_toto.SupplyChainItem{
+					Name:              StepClone,
+					ExpectedMaterials: [][]string{},
+					ExpectedProducts:  [][]string{{"CREATE", SourcePath}, {"DISALLOW", "*"}},
+				},
+			},
+			{
+				Type:            "step",
+				PubKeys:         []string{s.Bob.KeyID},
+				ExpectedCommand: []string{"vi", SourcePath},
+				Threshold:       1,
+				SupplyChainItem: in_toto.SupplyChainItem{
+					Name: StepUpdateVersion,
+					ExpectedMaterials: [][]string{
+						{"MATCH", "demo-project/*", "WITH", "PRODUCTS", "FROM", StepClone},
+						{"DISALLOW", "*"},
+					},
+					ExpectedProducts: [][]string{{"ALLOW", SourcePath}, {"DISALLOW", "*"}},
+				},
+			},
+			{
+				Type:            "step",
+				PubKeys:         []string{s.Carl.KeyID},
+				ExpectedCommand: []string{"tar", "--exclude", ".git", "-zcvf", PackagePath, "demo-project"},
+				Threshold:       1,
+				SupplyChainItem: in_toto.SupplyChainItem{
+					Name: StepPackage,
+					ExpectedMaterials: [][]string{
+						{"MATCH", "demo-project/*", "WITH", "PRODUCTS", "FROM", StepUpdateVersion},
+						{"DISALLOW", "*"},
+					},
+					ExpectedProducts: [][]string{{"CREATE", PackagePath}, {"DISALLOW", "*"}},
+				},
+			},
+		},
+		Inspect: []in_toto.Inspection{},
+	}
+	if c.inspection {
+		l.Inspect = append(l.Inspect, in_toto.Inspection{
+			Type: "inspection",
+			Run:  []string{"tar", "xzf", PackagePath},
+			SupplyChainItem: in_toto.SupplyChainItem{
+				Name: InspectionUntar,
+				ExpectedMaterials: [][]string{
+					{"MATCH", PackagePath, "WITH", "PRODUCTS", "FROM", StepPackage},
+					{"DISALLOW", PackagePath},
+					{"ALLOW", "*"},
+				},
+				ExpectedProducts: [][]string{
+					{"MATCH", SourcePath, "WITH", "PRODUCTS", "FROM", StepUpdateVersion},
+					{"DISALLOW", "demo-project/*"},
+					{"ALLOW", "*"},
+				},
+			},
+		})
+	}
+	return l
+}
+
+// newLink returns the link of the step of the passed name, which ran the
+// passed command and reports the passed materials and products.
+func newLink(name string, command []string, materials, products map[string]in_toto.HashObj) in_toto.Link {
+	if materials == nil {
+		materials = map[string]in_toto.HashObj{}
+	}
+	return in_toto.Link{
+		Type:        "link",
+		Name:        name,
+		Materials:   materials,
+		Products:    products,
+		ByProducts:  map[string]interface{}{"return-value": 0},
+		Command:     command,
+		Environment: map[string]interface{}{},
+	}
+}
+
+// packageSource returns demo-project.tar.gz containing the passed source.
+// Headers carry no timestamps, so that the same source yields the same bytes.
+func packageSource(source []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	if err := tw.WriteHeader(&tar.Header{Name: "demo-project/", Typeflag: tar.TypeDir, Mode: 0755}); err != nil {
+		return nil, err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: SourcePath, Mode: 0644, Size: int64(len(source))}); err != nil {
+		return nil, err
+	}
+	if _, err := tw.Write(source); err != nil {
+		return nil, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// digest returns the sha256 digest of the passed artifact.
+func digest(data []byte) in_toto.HashObj {
+	return in_toto.HashObj{"sha256": fmt.Sprintf("%x", sha256.Sum256(data))}
+}
+
+/*
+newKey generates an ed25519 key from the passed reader, or a random key if
+the reader is nil.  Keys are loaded from PKCS8 PEM like keys of functionaries,
+so that their key IDs match.
+*/
+func newKey(rand *in_toto.DeterministicReader) (in_toto.Key, error) {
+	if rand == nil {
+		return in_toto.GenerateEd25519Key()
+	}
+	_, privateKey, err := ed25519.GenerateKey(rand)
+	if err != nil {
+		return in_toto.Key{}, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return in_toto.Key{}, err
+	}
+	var key in_toto.Key
+	err = key.LoadKeyReaderDefaults(bytes.NewReader(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})))
+	return key, err
+}
+
+// publicKey returns the passed key without its private part.
+func publicKey(key in_toto.Key) in_toto.Key {
+	key.KeyVal.Private = ""
+	return key
+}
@@ -0,0 +1,104 @@
+package demo
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/in-toto/in-toto-golang/in_toto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSupplyChain(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       []Option
+		inspection bool
+		err        error
+	}{
+		{"valid", nil, false, nil},
+		{"tampered-artifact", []Option{TamperArtifact()}, false, in_toto.ErrRuleViolation},
+		{"tampered-link", []Option{TamperLink(StepUpdateVersion)}, false, in_toto.ErrThresholdNotMet},
+		{"missing-link", []Option{RemoveLink(StepClone)}, false, in_toto.ErrThresholdNotMet},
+		{"unauthorized-functionary", []Option{UnauthorizedFunctionary(StepPackage)}, false, in_toto.ErrThresholdNotMet},
+		{"expired-layout", []Option{ExpireLayout()}, false, in_toto.ErrLayoutExpired},
+		{"tampered-package-uninspected", []Option{TamperPackage()}, false, nil},
+		{"several", []Option{TamperArtifact(), ExpireLayout()}, false, in_toto.ErrLayoutExpired},
+		{"inspected", []Option{WithInspection()}, true, nil},
+		{"tampered-package", []Option{WithInspection(), TamperPackage()}, true, in_toto.ErrRuleViolation},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := exec.LookPath("tar"); tt.inspection && err != nil {
+				t.Skip("tar is not installed")
+			}
+			chain, err := New(tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tt.err, chain.Err)
+			dir := t.TempDir()
+			if err := chain.Write(dir); err != nil {
+				t.Fatal(err)
+			}
+			assert.FileExists(t, filepath.Join(dir, "keys", "alice.pub"))
+			// Inspections run and dump their links in the working directory,
+			// which must be the temporary directory
+			if tt.inspection {
+				cwd, err := os.Getwd()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Chdir(dir); err != nil {
+					t.Fatal(err)
+				}
+				defer os.Chdir(cwd)
+			}
+			_, err = chain.Verify(dir)
+			if tt.inspection {
+				assert.FileExists(t, filepath.Join(dir, "untar.link"))
+			}
+			if tt.err == nil {
+				assert.Nil(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.err)
+			}
+		})
+	}
+
+	_, err := New(RemoveLink(StepPackage), TamperLink(StepPackage))
+	assert.NotNil(t, err)
+}
+
+func TestSupplyChainSeed(t *testing.T) {
+	readFiles := func(opts ...Option) map[string]string {
+		chain, err := New(opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dir := t.TempDir()
+		if err := chain.Write(dir); err != nil {
+			t.Fatal(err)
+		}
+		files := map[string]string{}
+		err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			data, err := os.ReadFile(path)
+			rel, _ := filepath.Rel(dir, path)
+			files[rel] = string(data)
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return files
+	}
+
+	files := readFiles(WithSeed([]byte("demo")))
+	assert.Equal(t, files, readFiles(WithSeed([]byte("demo"))))
+	assert.NotEqual(t, files, readFiles(WithSeed([]byte("other"))))
+	assert.NotEqual(t, files, readFiles())
+}
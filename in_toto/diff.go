@@ -0,0 +1,359 @@
+package in_toto
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// ErrDiffTypeMismatch is returned when metadata of different types, e.g. a
+// link and a layout, are compared with Diff.
+var ErrDiffTypeMismatch = errors.New("cannot compare metadata of different types")
+
+// Kinds of a MetadataChange
+const (
+	ChangeAdded    = "added"
+	ChangeRemoved  = "removed"
+	ChangeModified = "modified"
+)
+
+/*
+MetadataChange is a single difference between two links or two layouts, see
+Diff.  Section is the field of the link or layout that differs, e.g.
+"products" or "steps".  For fields that map names to values, i.e. artifacts,
+byproducts, environment variables and keys, and for steps and inspections,
+Name is the name that differs, e.g. the artifact path, the key ID or the name
+of the step.  Field is the field of the step or inspection that differs, e.g.
+"expected_materials".  Old and New are human readable representations of the
+value in the first and second metadata, and only one of them is set for added
+and removed values, e.g. for each added or removed artifact rule.
+*/
+type MetadataChange struct {
+	Kind    string `json:"kind"`
+	Section string `json:"section"`
+	Name    string `json:"name,omitempty"`
+	Field   string `json:"field,omitempty"`
+	Old     string `json:"old,omitempty"`
+	New     string `json:"new,omitempty"`
+}
+
+// String returns the change as a line of the text format of MetadataDiff.
+func (c MetadataChange) String() string {
+	location := c.Section
+	if c.Name != "" {
+		location += fmt.Sprintf("[%q]", c.Name)
+	}
+	if c.Field != "" {
+		location += "." + c.Field
+	}
+	switch c.Kind {
+	case ChangeAdded:
+		return fmt.Sprintf("+ %s: %s", location, c.New)
+	case ChangeRemoved:
+		return fmt.Sprintf("- %s: %s", location, c.Old)
+	}
+	return fmt.Sprintf("~ %s: %s -> %s", location, c.Old, c.New)
+}
+
+/*
+MetadataDiff is the comparison of two links or two layouts, see Diff.  Type is
+the type of the compared metadata, i.e. "link" or "layout", and Changes are
+the differences, ordered by section, name and field.
+*/
+type MetadataDiff struct {
+	Type    string           `json:"type"`
+	Changes []MetadataChange `json:"changes"`
+}
+
+// Empty returns true, if the compared metadata do not differ.
+func (d *MetadataDiff) Empty() bool {
+	return len(d.Changes) == 0
+}
+
+/*
+WriteText writes the diff in a human readable text format, one change per
+line, e.g.:
+
+	~ products["foo.tar.gz"]: sha256:8f4a... -> sha256:5e1b...
+	+ products["foo.sig"]: sha256:0c2d...
+	- steps["package"].expected_materials: DISALLOW *
+*/
+func (d *MetadataDiff) WriteText(w io.Writer) error {
+	for _, change := range d.Changes {
+		if _, err := fmt.Fprintln(w, change.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// diffMapSections are the fields of links and layouts that map names to
+// values, which are compared name by name
+var diffMapSections = NewSet("materials", "products", "byproducts", "environment",
+	"keys", "rootcas", "intermediatecas", "roles", "artifact_profiles", "key_validity")
+
+// diffItemSections are the fields of layouts with lists of steps or
+// inspections, which are compared by name
+var diffItemSections = NewSet("steps", "inspect")
+
+// diffSetFields are the fields of steps and inspections with lists of
+// artifact rules or key IDs, whose elements are compared
+var diffSetFields = NewSet("expected_materials", "expected_products", "pubkeys")
+
+/*
+Diff compares the passed links or layouts, e.g. the links of a step of two
+builds when verification of the later one fails, and returns their
+differences.  Signed fields are compared as follows:
+
+  - artifacts are compared by path, i.e. an artifact with changed hashes is
+    modified, otherwise it is added or removed,
+  - byproducts, environment variables and keys, including root and
+    intermediate certificate authorities, are compared by name,
+  - steps and inspections are compared by name, and then field by field,
+    where artifact rules and public keys are added or removed one by one,
+  - all other fields, e.g. the command of a link or the expiry date of a
+    layout, are compared as a whole.
+
+Signatures are compared by key ID in the "signatures" section.  An
+ErrDiffTypeMismatch is returned for metadata of different types.
+*/
+func Diff(a, b Metadata) (*MetadataDiff, error) {
+	typeA, err := diffPayloadType(a)
+	if err != nil {
+		return nil, err
+	}
+	typeB, err := diffPayloadType(b)
+	if err != nil {
+		return nil, err
+	}
+	if typeA != typeB {
+		return nil, fmt.Errorf("%w: %s and %s", ErrDiffTypeMismatch, typeA, typeB)
+	}
+
+	payloadA, err := diffObject(a.GetPayload())
+	if err != nil {
+		return nil, err
+	}
+	payloadB, err := diffObject(b.GetPayload())
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &MetadataDiff{Type: typeA, Changes: []MetadataChange{}}
+	for _, section := range diffKeys(payloadA, payloadB) {
+		if section == "_type" {
+			continue
+		}
+		valueA, valueB := payloadA[section], payloadB[section]
+		switch {
+		case diffMapSections.Has(section):
+			diff.diffMap(section, diffAsObject(valueA), diffAsObject(valueB))
+		case diffItemSections.Has(section):
+			diff.diffItems(section, diffAsList(valueA), diffAsList(valueB))
+		default:
+			diff.diffValue(MetadataChange{Section: section}, valueA, valueB)
+		}
+	}
+	diff.diffSignatures(a.Sigs(), b.Sigs())
+	return diff, nil
+}
+
+// diffPayloadType returns the type of the payload of the passed metadata,
+// i.e. "link" or "layout".
+func diffPayloadType(metadata Metadata) (string, error) {
+	switch metadata.GetPayload().(type) {
+	case Link:
+		return "link", nil
+	case Layout:
+		return "layout", nil
+	}
+	return "", ErrUnknownMetadataType
+}
+
+// diffMap compares the passed maps of the passed section by name.
+func (d *MetadataDiff) diffMap(section string, a, b map[string]interface{}) {
+	for _, name := range diffKeys(a, b) {
+		d.diffValue(MetadataChange{Section: section, Name: name}, a[name], b[name])
+	}
+}
+
+// diffItems compares the passed steps or inspections of the passed section
+// by name, and then field by field.
+func (d *MetadataDiff) diffItems(section string, a, b []interface{}) {
+	itemsA, itemsB := diffItemsByName(a), diffItemsByName(b)
+	for _, name := range diffKeys(itemsA, itemsB) {
+		if itemsA[name] == nil || itemsB[name] == nil {
+			d.diffValue(MetadataChange{Section: section, Name: name}, itemsA[name], itemsB[name])
+			continue
+		}
+		itemA, itemB := diffAsObject(itemsA[name]), diffAsObject(itemsB[name])
+		for _, field := range diffKeys(itemA, itemB) {
+			if field == "_type" || field == "name" {
+				continue
+			}
+			change := MetadataChange{Section: section, Name: name, Field: field}
+			if diffSetFields.Has(field) {
+				d.diffSet(change, diffAsList(itemA[field]), diffAsList(itemB[field]))
+				continue
+			}
+			d.diffValue(change, itemA[field], itemB[field])
+		}
+	}
+}
+
+// diffItemsByName returns the passed steps or inspections by name, items
+// without name by their index.
+func diffItemsByName(items []interface{}) map[string]interface{} {
+	byName := make(map[string]interface{}, len(items))
+	for i, item := range items {
+		name, ok := diffAsObject(item)["name"].(string)
+		if !ok {
+			name = fmt.Sprintf("#%d", i)
+		}
+		byName[name] = item
+	}
+	return byName
+}
+
+// diffSet records the elements of the passed lists, i.e. artifact rules or
+// key IDs, which are only in one of them, as added or removed.
+func (d *MetadataDiff) diffSet(change MetadataChange, a, b []interface{}) {
+	elementsA, elementsB := NewSet(), NewSet()
+	for _, element := range a {
+		elementsA.Add(diffFormat(change, element))
+	}
+	for _, element := range b {
+		elementsB.Add(diffFormat(change, element))
+	}
+	removed, added := elementsA.Difference(elementsB).Slice(), elementsB.Difference(elementsA).Slice()
+	sort.Strings(removed)
+	sort.Strings(added)
+	for _, element := range removed {
+		c := change
+		c.Kind, c.Old = ChangeRemoved, element
+		d.Changes = append(d.Changes, c)
+	}
+	for _, element := range added {
+		c := change
+		c.Kind, c.New = ChangeAdded, element
+		d.Changes = append(d.Changes, c)
+	}
+}
+
+// diffValue records the passed change, if the passed values differ.  A nil
+// value denotes a missing value.
+func (d *MetadataDiff) diffValue(change MetadataChange, a, b interface{}) {
+	switch {
+	case a == nil && b == nil:
+		return
+	case a == nil:
+		change.Kind, change.New = ChangeAdded, diffFormat(change, b)
+	case b == nil:
+		change.Kind, change.Old = ChangeRemoved, diffFormat(change, a)
+	default:
+		change.Old, change.New = diffFormat(change, a), diffFormat(change, b)
+		if change.Old == change.New {
+			return
+		}
+		change.Kind = ChangeModified
+	}
+	d.Changes = append(d.Changes, change)
+}
+
+// diffSignatures compares the passed signatures by key ID.
+func (d *MetadataDiff) diffSignatures(a, b []Signature) {
+	sigsA, sigsB := map[string]interface{}{}, map[string]interface{}{}
+	for _, sig := range a {
+		sigsA[sig.KeyID] = sig.Sig
+	}
+	for _, sig := range b {
+		sigsB[sig.KeyID] = sig.Sig
+	}
+	d.diffMap("signatures", sigsA, sigsB)
+}
+
+/*
+diffFormat returns the human readable representation of the passed value of
+the passed change: hashes of artifacts as '<algorithm>:<digest>' pairs,
+artifact rules as words separated by spaces, strings as they are, and any
+other value as JSON.
+*/
+func diffFormat(change MetadataChange, value interface{}) string {
+	switch {
+	case change.Section == "materials" || change.Section == "products":
+		if hashes, ok := value.(map[string]interface{}); ok {
+			pairs := make([]string, 0, len(hashes))
+			for algorithm, digest := range hashes {
+				pairs = append(pairs, fmt.Sprintf("%s:%v", algorithm, digest))
+			}
+			sort.Strings(pairs)
+			return strings.Join(pairs, ", ")
+		}
+	case change.Field == "expected_materials" || change.Field == "expected_products":
+		if rule, ok := value.([]interface{}); ok {
+			words := make([]string, 0, len(rule))
+			for _, word := range rule {
+				words = append(words, fmt.Sprint(word))
+			}
+			return strings.Join(words, " ")
+		}
+	}
+	if s, ok := value.(string); ok {
+		return s
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(value); err != nil {
+		return fmt.Sprint(value)
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// diffObject returns the passed payload as generic JSON object, with numbers
+// as json.Number.
+func diffObject(payload interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	var object map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&object); err != nil {
+		return nil, err
+	}
+	return object, nil
+}
+
+// diffAsObject returns the passed generic JSON value as object, or an empty
+// object if it is none.
+func diffAsObject(value interface{}) map[string]interface{} {
+	object, _ := value.(map[string]interface{})
+	return object
+}
+
+// diffAsList returns the passed generic JSON value as list, or an empty list
+// if it is none.
+func diffAsList(value interface{}) []interface{} {
+	list, _ := value.([]interface{})
+	return list
+}
+
+// diffKeys returns the sorted union of the keys of the passed maps.
+func diffKeys(a, b map[string]interface{}) []string {
+	keys := NewSet()
+	for key := range a {
+		keys.Add(key)
+	}
+	for key := range b {
+		keys.Add(key)
+	}
+	sorted := keys.Slice()
+	sort.Strings(sorted)
+	return sorted
+}
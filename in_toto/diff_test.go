@@ -0,0 +1,137 @@
+package in_toto
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffLinks(t *testing.T) {
+	yesterday := &Metablock{
+		Signed: Link{
+			Type:      "link",
+			Name:      "package",
+			Materials: map[string]HashObj{"foo.py": {"sha256": "aaaa"}},
+			Products: map[string]HashObj{
+				"foo.tar.gz": {"sha256": "bbbb"},
+				"foo.txt":    {"sha256": "cccc"},
+			},
+			ByProducts: LinkByproducts{"return-value": 0},
+			Command:    []string{"tar", "zcvf", "foo.tar.gz", "foo.py"},
+		},
+		Signatures: []Signature{{KeyID: "1234", Sig: "abcd"}},
+	}
+	today := &Metablock{
+		Signed: Link{
+			Type:      "link",
+			Name:      "package",
+			Materials: map[string]HashObj{"foo.py": {"sha256": "aaaa"}},
+			Products: map[string]HashObj{
+				"foo.tar.gz": {"sha256": "dddd"},
+				"foo.sig":    {"sha256": "eeee"},
+			},
+			ByProducts: LinkByproducts{"return-value": 1},
+			Command:    []string{"tar", "zcf", "foo.tar.gz", "foo.py"},
+		},
+		Signatures: []Signature{{KeyID: "1234", Sig: "abcd"}},
+	}
+
+	diff, err := Diff(yesterday, today)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "link", diff.Type)
+	assert.Equal(t, []MetadataChange{
+		{Kind: ChangeModified, Section: "byproducts", Name: "return-value", Old: "0", New: "1"},
+		{Kind: ChangeModified, Section: "command", Old: `["tar","zcvf","foo.tar.gz","foo.py"]`, New: `["tar","zcf","foo.tar.gz","foo.py"]`},
+		{Kind: ChangeAdded, Section: "products", Name: "foo.sig", New: "sha256:eeee"},
+		{Kind: ChangeModified, Section: "products", Name: "foo.tar.gz", Old: "sha256:bbbb", New: "sha256:dddd"},
+		{Kind: ChangeRemoved, Section: "products", Name: "foo.txt", Old: "sha256:cccc"},
+	}, diff.Changes)
+
+	var text bytes.Buffer
+	if err := diff.WriteText(&text); err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, text.String(), "~ products[\"foo.tar.gz\"]: sha256:bbbb -> sha256:dddd\n")
+	assert.Contains(t, text.String(), "+ products[\"foo.sig\"]: sha256:eeee\n")
+	assert.Contains(t, text.String(), "- products[\"foo.txt\"]: sha256:cccc\n")
+
+	diff, err = Diff(yesterday, yesterday)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, diff.Empty())
+}
+
+func TestDiffLayouts(t *testing.T) {
+	layoutEnv, err := LoadMetadata("demo.layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	layout := layoutEnv.GetPayload().(Layout)
+
+	changed := layout
+	changed.Expires = "2040-01-01T00:00:00Z"
+	changed.Steps = append([]Step{}, layout.Steps...)
+	changed.Steps[1].Threshold = 2
+	changed.Steps[1].ExpectedMaterials = [][]string{changed.Steps[1].ExpectedMaterials[0]}
+	changed.Steps[1].PubKeys = append([]string{"1234"}, changed.Steps[1].PubKeys...)
+	changed.Inspect = nil
+	changed.Keys = map[string]Key{}
+	for keyID, key := range layout.Keys {
+		if keyID != changed.Steps[1].PubKeys[1] {
+			changed.Keys[keyID] = key
+		}
+	}
+
+	diff, err := Diff(&Metablock{Signed: layout}, &Metablock{Signed: changed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "layout", diff.Type)
+
+	sections := NewSet()
+	for _, change := range diff.Changes {
+		sections.Add(change.Section)
+	}
+	assert.Equal(t, NewSet("expires", "inspect", "keys", "steps"), sections)
+	assert.Contains(t, diff.Changes, MetadataChange{Kind: ChangeModified, Section: "expires",
+		Old: layout.Expires, New: changed.Expires})
+	assert.Contains(t, diff.Changes, MetadataChange{Kind: ChangeRemoved, Section: "keys",
+		Name: changed.Steps[1].PubKeys[1], Old: diffFormat(MetadataChange{}, mustDiffObject(t, layout.Keys[changed.Steps[1].PubKeys[1]]))})
+	assert.Contains(t, diff.Changes, MetadataChange{Kind: ChangeModified, Section: "steps",
+		Name: "package", Field: "threshold", Old: "1", New: "2"})
+	assert.Contains(t, diff.Changes, MetadataChange{Kind: ChangeRemoved, Section: "steps",
+		Name: "package", Field: "expected_materials", Old: "DISALLOW *"})
+	assert.Contains(t, diff.Changes, MetadataChange{Kind: ChangeAdded, Section: "steps",
+		Name: "package", Field: "pubkeys", New: "1234"})
+	for _, inspection := range layout.Inspect {
+		found := false
+		for _, change := range diff.Changes {
+			if change.Section == "inspect" && change.Name == inspection.Name && change.Kind == ChangeRemoved {
+				found = true
+			}
+		}
+		assert.True(t, found, inspection.Name)
+	}
+
+	linkEnv, err := LoadMetadata("write-code.b7d643de.link")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Diff(layoutEnv, linkEnv)
+	assert.ErrorIs(t, err, ErrDiffTypeMismatch)
+}
+
+// mustDiffObject returns the passed value as generic JSON object, see
+// diffObject.
+func mustDiffObject(t *testing.T, value interface{}) map[string]interface{} {
+	t.Helper()
+	object, err := diffObject(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return object
+}
@@ -0,0 +1,97 @@
+package in_toto
+
+import (
+	"reflect"
+)
+
+/*
+reusableItems returns the names of the steps of the passed layout, whose
+verification by the previous verification the evidence was gathered in still
+holds, given the reduced links of the steps of the current verification,
+which are canonicalized with the passed memo, see WithPreviousEvidence.
+
+A step has changed, if its reduced link differs from the previous one, e.g.
+because the step was run again.  Inspections check the local filesystem
+instead of links, hence they are always run again and count as changed.  The
+verification of a step is reused, if neither the step nor any step or
+inspection it matches artifacts from has changed.  Nothing is reused, if the
+evidence is of another layout or of a failed verification.
+*/
+func (e *VerificationEvidence) reusableItems(layout Layout, stepsMetadataReduced map[string]Metadata,
+	memo *signableMemo) (Set, error) {
+	reusable := NewSet()
+	if e == nil || e.itemsMetadata == nil || !reflect.DeepEqual(e.layout, layout) {
+		return reusable, nil
+	}
+
+	changed := NewSet()
+	for _, step := range layout.Steps {
+		previous, ok := e.itemsMetadata[step.Name]
+		if !ok {
+			changed.Add(step.Name)
+			continue
+		}
+		previousDigest, err := e.signables.digest(previous)
+		if err != nil {
+			return nil, err
+		}
+		digest, err := memo.digest(stepsMetadataReduced[step.Name])
+		if err != nil {
+			return nil, err
+		}
+		if !digestsMatch(previousDigest, digest) {
+			changed.Add(step.Name)
+		}
+	}
+
+	for _, inspection := range layout.Inspect {
+		changed.Add(inspection.Name)
+	}
+
+	for _, step := range layout.Steps {
+		if !changed.Has(step.Name) && !matchesChanged(step.SupplyChainItem, changed) {
+			reusable.Add(step.Name)
+		}
+	}
+	return reusable, nil
+}
+
+// matchesChanged reports whether the passed item has MATCH rules for artifacts
+// of any of the passed changed steps or inspections.
+func matchesChanged(item SupplyChainItem, changed Set) bool {
+	for _, rules := range [][][]string{item.ExpectedMaterials, item.ExpectedProducts} {
+		for _, rule := range rules {
+			parsed, err := ParseArtifactRule(rule)
+			if err == nil && parsed.Type == "match" && changed.Has(parsed.DstName) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// reuse records the verification of the passed items as reused from the
+// passed previous evidence.
+func (e *VerificationEvidence) reuse(previous *VerificationEvidence, reused Set) {
+	e.reused = reused
+	for itemName := range reused {
+		if consumedBy, ok := previous.consumedBy[itemName]; ok {
+			e.consumedBy[itemName] = consumedBy
+		}
+	}
+}
+
+/*
+ReusedItems returns the names of the steps, whose verification was reused
+from a previous verification instead of being repeated, ordered like the
+layout, see WithPreviousEvidence.  Inspections are always run again.
+*/
+func (e *VerificationEvidence) ReusedItems() []string {
+	var names []string
+	for _, step := range e.layout.Steps {
+		if e.reused.Has(step.Name) {
+			names = append(names, step.Name)
+		}
+	}
+	return names
+}
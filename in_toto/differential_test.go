@@ -0,0 +1,153 @@
+package in_toto
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyWithPreviousEvidence(t *testing.T) {
+	layoutEnv, err := LoadMetadata("demo.layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pubKey Key
+	if err := pubKey.LoadKeyDefaults("alice.pub"); err != nil {
+		t.Fatal(err)
+	}
+	layoutKeys := map[string]Key{pubKey.KeyID: pubKey}
+	defer os.Remove("untar.link")
+
+	verify := func(previous *VerificationEvidence) *VerificationEvidence {
+		if err := os.Remove("untar.link"); err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+		evidence := &VerificationEvidence{}
+		opts := []VerifyOption{AllowCommandMisalignment(), AllowLinkNameMismatch(),
+			WithEvidence(evidence), WithPreviousEvidence(previous)}
+		if testOSisWindows() {
+			opts = append(opts, WithLineNormalization())
+		}
+		if _, err := Verify(layoutEnv, layoutKeys, ".", opts...); err != nil {
+			t.Fatal(err)
+		}
+		return evidence
+	}
+
+	previous := verify(nil)
+	assert.Empty(t, previous.ReusedItems())
+	assert.FileExists(t, "untar.link")
+
+	// Nothing changed, no step is verified again, but inspections run again
+	evidence := verify(previous)
+	assert.Equal(t, []string{"write-code", "package"}, evidence.ReusedItems())
+	assert.FileExists(t, "untar.link")
+	explanation, err := evidence.Explain("foo.tar.gz")
+	if assert.Nil(t, err) {
+		assert.Equal(t, []string{"MATCH", "foo.tar.gz", "WITH", "PRODUCTS", "FROM", "package"},
+			explanation.Evidence[1].Rule)
+	}
+
+	report := NewVerificationReport("demo.layout", layoutEnv, nil)
+	report.MarkReused(evidence)
+	assert.Equal(t, []ItemReport{
+		{Name: "write-code", Type: "step", Status: ReportStatusPassed, Reused: true},
+		{Name: "package", Type: "step", Status: ReportStatusPassed, Reused: true},
+		{Name: "untar", Type: "inspection", Status: ReportStatusPassed},
+	}, report.Items)
+
+	// Inspections detect local changes, although the links are unchanged
+	tarball, err := os.ReadFile("foo.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("foo.tar.gz", append(tarball, 0), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opts := []VerifyOption{AllowCommandMisalignment(), AllowLinkNameMismatch(), WithPreviousEvidence(previous)}
+	if testOSisWindows() {
+		opts = append(opts, WithLineNormalization())
+	}
+	_, err = Verify(layoutEnv, layoutKeys, ".", opts...)
+	assert.ErrorIs(t, err, ErrRuleViolation)
+	if err := os.WriteFile("foo.tar.gz", tarball, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A changed step is verified again with the inspection matching from it
+	previous.itemsMetadata["package"] = previous.itemsMetadata["write-code"]
+	evidence = verify(previous)
+	assert.Equal(t, []string{"write-code"}, evidence.ReusedItems())
+	assert.FileExists(t, "untar.link")
+
+	// Evidence of another layout or of a failed verification is not reused
+	previous.layout.Readme = "changed"
+	assert.Empty(t, verify(previous).ReusedItems())
+	assert.Empty(t, verify(&VerificationEvidence{}).ReusedItems())
+}
+
+// TestVerifyWithPreviousEvidencePointers makes sure that errors of items
+// verified again are located in the layout, although other items are reused.
+func TestVerifyWithPreviousEvidencePointers(t *testing.T) {
+	var layoutKey, key Key
+	if err := layoutKey.LoadKeyDefaults("alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := key.LoadKey("carol", "ed25519", []string{"sha256", "sha512"}); err != nil {
+		t.Fatal(err)
+	}
+	pubKey := key
+	pubKey.KeyVal.Private = ""
+	layoutKeys := map[string]Key{layoutKey.KeyID: layoutKey}
+
+	newStep := func(name string, expectedProducts ...[]string) Step {
+		return Step{Type: "step", PubKeys: []string{pubKey.KeyID}, Threshold: 1,
+			SupplyChainItem: SupplyChainItem{Name: name, ExpectedProducts: expectedProducts}}
+	}
+	layoutEnv := &Metablock{Signed: Layout{
+		Type:    "layout",
+		Expires: time.Now().Add(time.Hour).UTC().Format(ISO8601DateSchema),
+		Keys:    map[string]Key{pubKey.KeyID: pubKey},
+		Steps: []Step{
+			newStep("build", []string{"ALLOW", "*"}),
+			newStep("package", []string{"CREATE", "foo.tar.gz"}, []string{"DISALLOW", "*"}),
+		},
+		Inspect: []Inspection{},
+	}}
+	if err := layoutEnv.Sign(layoutKey); err != nil {
+		t.Fatal(err)
+	}
+
+	linkDir := t.TempDir()
+	record := func(name string, products ...string) {
+		linkEnv, err := Run(name, []string{"sh", "-c", "true"}, key, WithProducts(products...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := linkEnv.Dump(filepath.Join(linkDir, fmt.Sprintf(LinkNameFormat, name, key.KeyID))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	record("build", "foo.tar.gz")
+	record("package", "foo.tar.gz")
+	previous := &VerificationEvidence{}
+	if _, err := Verify(layoutEnv, layoutKeys, linkDir, WithEvidence(previous)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The unchanged first step is reused, the second step fails again
+	record("package", "foo.tar.gz", "demo.layout")
+	evidence := &VerificationEvidence{}
+	_, err := Verify(layoutEnv, layoutKeys, linkDir, WithEvidence(evidence), WithPreviousEvidence(previous))
+	var violation *RuleViolationError
+	if assert.True(t, errors.As(err, &violation)) {
+		assert.Equal(t, "package", violation.Step)
+	}
+	assert.Equal(t, "/signed/steps/1/expected_products/1", ErrorPointer(err))
+	assert.Equal(t, []string{"build"}, evidence.ReusedItems())
+}
@@ -0,0 +1,139 @@
+package in_toto
+
+import (
+	"encoding/hex"
+	"hash"
+	"strings"
+)
+
+// maxDigestSize is the size of the largest digest of the supported hash
+// algorithms, i.e. of sha512 and blake2b.
+const maxDigestSize = 64
+
+/*
+Digest is a fixed-size binary digest of up to 64 bytes, i.e. of any of the
+SupportedHashAlgorithms.  Unlike the hex encoded digests of a HashObj, Digests
+can be parsed, compared and copied without allocation, which matters when
+verifying links with hundreds of thousands of artifacts.  They are only
+encoded as hex string on demand, see String.  The zero value is the empty
+digest.
+*/
+type Digest struct {
+	size  uint8
+	bytes [maxDigestSize]byte
+}
+
+/*
+ParseDigest parses the passed hex encoded digest, in lower or upper case,
+without allocation.  It returns an ErrInvalidHexString if the string is not
+valid hex, or longer than the largest supported digest.
+*/
+func ParseDigest(s string) (Digest, error) {
+	var d Digest
+	if len(s)%2 != 0 || len(s) > 2*maxDigestSize {
+		return Digest{}, ErrInvalidHexString
+	}
+	for i := 0; i < len(s); i += 2 {
+		hi, ok := fromHexChar(s[i])
+		if !ok {
+			return Digest{}, ErrInvalidHexString
+		}
+		lo, ok := fromHexChar(s[i+1])
+		if !ok {
+			return Digest{}, ErrInvalidHexString
+		}
+		d.bytes[i/2] = hi<<4 | lo
+	}
+	d.size = uint8(len(s) / 2)
+	return d, nil
+}
+
+// sumDigest returns the digest of the passed hash, without allocation if the
+// hash does not allocate.
+func sumDigest(h hash.Hash) Digest {
+	var d Digest
+	d.size = uint8(len(h.Sum(d.bytes[:0])))
+	return d
+}
+
+// Size returns the size of the digest in bytes.
+func (d Digest) Size() int {
+	return int(d.size)
+}
+
+// Bytes returns a copy of the bytes of the digest.
+func (d Digest) Bytes() []byte {
+	return append([]byte(nil), d.bytes[:d.size]...)
+}
+
+// String returns the digest in lower case hex encoding, as in a HashObj.
+func (d Digest) String() string {
+	return hex.EncodeToString(d.bytes[:d.size])
+}
+
+// Equal reports whether the digests are equal.
+func (d Digest) Equal(other Digest) bool {
+	return d == other
+}
+
+// fromHexChar returns the value of the passed hex character, and false if
+// it is not a hex character.
+func fromHexChar(c byte) (byte, bool) {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0', true
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10, true
+	case 'A' <= c && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+// isHexString reports whether the passed string is a non-empty string of
+// hex characters, without allocation.
+func isHexString(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if _, ok := fromHexChar(s[i]); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// digestStringsEqual reports whether the passed hex encoded digests are
+// equal, regardless of the case of their encoding, without allocation.
+// Strings that are not valid digests, e.g. of odd length, are compared case
+// insensitively.
+func digestStringsEqual(a string, b string) bool {
+	if a == b {
+		return true
+	}
+	digestA, errA := ParseDigest(a)
+	digestB, errB := ParseDigest(b)
+	if errA != nil || errB != nil {
+		return strings.EqualFold(a, b)
+	}
+	return digestA == digestB
+}
+
+/*
+hashObjsEqual reports whether the passed digests record the same hash
+algorithms with equal digests, see digestStringsEqual.  Missing and empty
+digests are equal, e.g. of empty directories.
+*/
+func hashObjsEqual(a HashObj, b HashObj) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for algorithm, digestA := range a {
+		digestB, ok := b[algorithm]
+		if !ok || !digestStringsEqual(digestA, digestB) {
+			return false
+		}
+	}
+	return true
+}
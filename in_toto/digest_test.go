@@ -0,0 +1,58 @@
+package in_toto
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDigest(t *testing.T) {
+	sum := sha256.Sum256([]byte("foo"))
+	hexDigest := fmt.Sprintf("%x", sum)
+
+	digest, err := ParseDigest(hexDigest)
+	assert.Nil(t, err)
+	assert.Equal(t, 32, digest.Size())
+	assert.Equal(t, sum[:], digest.Bytes())
+	assert.Equal(t, hexDigest, digest.String())
+
+	upper, err := ParseDigest(fmt.Sprintf("%X", sum))
+	assert.Nil(t, err)
+	assert.True(t, upper.Equal(digest))
+
+	empty, err := ParseDigest("")
+	assert.Nil(t, err)
+	assert.Equal(t, Digest{}, empty)
+
+	for _, invalid := range []string{"abc", "zz", hexDigest + hexDigest + "00"} {
+		_, err := ParseDigest(invalid)
+		assert.ErrorIs(t, err, ErrInvalidHexString, invalid)
+	}
+
+	h := sha256.New()
+	h.Write([]byte("foo")) //nolint:errcheck
+	assert.Equal(t, digest, sumDigest(h))
+}
+
+func TestDigestComparisonAllocations(t *testing.T) {
+	sum := sha256.Sum256([]byte("foo"))
+	lower := HashObj{"sha256": fmt.Sprintf("%x", sum)}
+	upper := HashObj{"sha256": fmt.Sprintf("%X", sum)}
+	assert.True(t, hashObjsEqual(lower, upper))
+	assert.False(t, hashObjsEqual(lower, HashObj{"sha512": lower["sha256"]}))
+	assert.True(t, hashObjsEqual(nil, HashObj{}))
+
+	a := map[string]HashObj{"src/foo": lower, "dist/": {}}
+	b := map[string]HashObj{"src/foo": upper, "dist/": {}}
+	assert.True(t, artifactsEqual(a, b))
+
+	// Comparing artifacts with normalized names does not allocate
+	allocs := testing.AllocsPerRun(100, func() {
+		if !artifactsEqual(a, b) || !hashObjsEqual(lower, upper) || validateArtifacts(a) != nil {
+			t.Fatal("artifacts differ")
+		}
+	})
+	assert.Zero(t, allocs)
+}
@@ -0,0 +1,258 @@
+package in_toto
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ErrUnknownDirHashMode is returned for directory hash modes other than
+// DirHashModeDirhash and DirHashModeMerkle.
+var ErrUnknownDirHashMode = errors.New("unknown directory hash mode")
+
+const (
+	// DirHashModeDirhash hashes directories like Go's dirhash package, see
+	// RecordDirectory.  It is the default mode.
+	DirHashModeDirhash = "dirhash"
+	// DirHashModeMerkle hashes directories as Merkle tree of their
+	// subdirectories, see RecordDirectoryTree.
+	DirHashModeMerkle = "merkle"
+)
+
+/*
+RecordDirectory records the directory at the passed path as a single artifact,
+whose digests summarize the names and contents of all files in the directory
+tree.  For each of the passed hash algorithms, see SupportedHashAlgorithms,
+the digest is computed like the "h1" hash of Go's dirhash package: each file
+is hashed with the algorithm, and the digest is the hash of the lines
+
+	<hex digest of file>  <slash-separated path relative to the directory>\n
+
+in lexical order of the paths.  The sha256 digest of a directory is thus the
+digest of its "h1" hash in hex instead of base64 encoding, as returned by
+dirhash.HashDir with an empty prefix, which allows to compare digests with Go
+tooling.  Unlike
+RecordArtifact, line separators are never normalized, for the same reason.
+
+Files matched by the passed gitignore-style exclude patterns are left out.
+Symlinked files are hashed with the contents of their target, symlinked
+directories are left out.  Paths that contain a newline cannot be hashed
+unambiguously and are rejected.
+*/
+func RecordDirectory(dir string, hashAlgorithms []string, excludePatterns []string) (HashObj, error) {
+	return recordDirectory(dir, hashAlgorithms, DirHashModeDirhash, "", excludePatterns)
+}
+
+/*
+RecordDirectoryTree records the directory at the passed path as a single
+artifact like RecordDirectory, but computes its digests as Merkle tree of the
+directory tree: the digest of a directory is the hash of the lines
+
+	blob <hex digest of file>  <name>\n
+	tree <hex digest of subdirectory>  <name>\n
+
+for each file and each subdirectory with files in the directory, in lexical
+order of the names.  Hence the digest of a subdirectory, e.g. of a package in
+node_modules, does not depend on where the directory is located, and equals
+the digest of the subdirectory recorded on its own.  Exclude patterns,
+symlinks and paths with newlines are handled like by RecordDirectory.
+*/
+func RecordDirectoryTree(dir string, hashAlgorithms []string, excludePatterns []string) (HashObj, error) {
+	return recordDirectory(dir, hashAlgorithms, DirHashModeMerkle, "", excludePatterns)
+}
+
+// validateDirHashMode checks that the passed directory hash mode is empty,
+// i.e. the default mode, or known.
+func validateDirHashMode(mode string) error {
+	switch mode {
+	case "", DirHashModeDirhash, DirHashModeMerkle:
+		return nil
+	}
+	return fmt.Errorf("%w: '%s'", ErrUnknownDirHashMode, mode)
+}
+
+// recordDirectory implements RecordDirectory and RecordDirectoryTree,
+// depending on the passed directory hash mode, matching the exclude patterns
+// with the passed pattern syntax, see isExcluded.
+func recordDirectory(dir string, hashAlgorithms []string, mode string, excludeSyntax string, excludePatterns []string) (HashObj, error) {
+	if err := validateHashAlgorithms(hashAlgorithms); err != nil {
+		return nil, err
+	}
+	if err := validateDirHashMode(mode); err != nil {
+		return nil, err
+	}
+
+	var names []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		ignore, err := isExcluded(excludeSyntax, excludePatterns, path)
+		if err != nil {
+			return err
+		}
+		if ignore || info.IsDir() {
+			return nil
+		}
+		if info.Mode()&os.ModeSymlink == os.ModeSymlink {
+			targetInfo, err := os.Stat(path)
+			if err != nil {
+				return err
+			}
+			if targetInfo.IsDir() {
+				return nil
+			}
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if strings.Contains(name, "\n") {
+			return fmt.Errorf("cannot hash directory %s: path %q contains a newline", dir, name)
+		}
+		names = append(names, name)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	if mode == DirHashModeMerkle {
+		return hashDirectoryTree(dir, names, hashAlgorithms)
+	}
+	return hashDirectoryFiles(dir, names, hashAlgorithms)
+}
+
+// hashDirectoryFiles returns the digests of the files of the passed sorted
+// slash-separated names relative to the passed directory, see
+// RecordDirectory.
+func hashDirectoryFiles(dir string, names []string, hashAlgorithms []string) (HashObj, error) {
+	hashMapping := getHashMapping()
+	summaries := make([]hash.Hash, len(hashAlgorithms))
+	for i, algorithm := range hashAlgorithms {
+		summaries[i] = hashMapping[algorithm]()
+	}
+	for _, name := range names {
+		fileHashes, err := hashDirectoryFile(filepath.Join(dir, filepath.FromSlash(name)), hashAlgorithms)
+		if err != nil {
+			return nil, err
+		}
+		for i, fileHash := range fileHashes {
+			fmt.Fprintf(summaries[i], "%x  %s\n", fileHash, name)
+		}
+	}
+
+	hashObj := make(HashObj, len(hashAlgorithms))
+	for i, algorithm := range hashAlgorithms {
+		hashObj[algorithm] = sumDigest(summaries[i]).String()
+	}
+	return hashObj, nil
+}
+
+// hashDirectoryFile returns the digests of the file at the passed path for
+// each of the passed hash algorithms, reading the file only once.
+func hashDirectoryFile(path string, hashAlgorithms []string) ([][]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	hashMapping := getHashMapping()
+	hashers := make([]hash.Hash, len(hashAlgorithms))
+	writers := make([]io.Writer, len(hashAlgorithms))
+	for i, algorithm := range hashAlgorithms {
+		hashers[i] = hashMapping[algorithm]()
+		writers[i] = hashers[i]
+	}
+	if _, err := io.Copy(io.MultiWriter(writers...), file); err != nil {
+		return nil, err
+	}
+
+	digests := make([][]byte, len(hashers))
+	for i, hasher := range hashers {
+		digests[i] = hasher.Sum(nil)
+	}
+	return digests, nil
+}
+
+// merkleDir is a directory of the Merkle tree of RecordDirectoryTree, with
+// the digests of its files by name.
+type merkleDir struct {
+	files map[string][][]byte
+	dirs  map[string]*merkleDir
+}
+
+// hashDirectoryTree returns the Merkle tree digests of the files of the
+// passed slash-separated names relative to the passed directory, see
+// RecordDirectoryTree.
+func hashDirectoryTree(dir string, names []string, hashAlgorithms []string) (HashObj, error) {
+	root := &merkleDir{files: map[string][][]byte{}, dirs: map[string]*merkleDir{}}
+	for _, name := range names {
+		fileHashes, err := hashDirectoryFile(filepath.Join(dir, filepath.FromSlash(name)), hashAlgorithms)
+		if err != nil {
+			return nil, err
+		}
+		node := root
+		segments := strings.Split(name, "/")
+		for _, segment := range segments[:len(segments)-1] {
+			sub, ok := node.dirs[segment]
+			if !ok {
+				sub = &merkleDir{files: map[string][][]byte{}, dirs: map[string]*merkleDir{}}
+				node.dirs[segment] = sub
+			}
+			node = sub
+		}
+		node.files[segments[len(segments)-1]] = fileHashes
+	}
+
+	digests := root.hash(hashAlgorithms)
+	hashObj := make(HashObj, len(hashAlgorithms))
+	for i, algorithm := range hashAlgorithms {
+		hashObj[algorithm] = hex.EncodeToString(digests[i])
+	}
+	return hashObj, nil
+}
+
+// hash returns the digests of the directory for each of the passed hash
+// algorithms, see RecordDirectoryTree.
+func (d *merkleDir) hash(hashAlgorithms []string) [][]byte {
+	entries := make([]string, 0, len(d.files)+len(d.dirs))
+	for name := range d.files {
+		entries = append(entries, name)
+	}
+	for name := range d.dirs {
+		entries = append(entries, name)
+	}
+	sort.Strings(entries)
+
+	hashMapping := getHashMapping()
+	summaries := make([]hash.Hash, len(hashAlgorithms))
+	for i, algorithm := range hashAlgorithms {
+		summaries[i] = hashMapping[algorithm]()
+	}
+	for _, name := range entries {
+		kind := "blob"
+		digests, ok := d.files[name]
+		if !ok {
+			kind = "tree"
+			digests = d.dirs[name].hash(hashAlgorithms)
+		}
+		for i, digest := range digests {
+			fmt.Fprintf(summaries[i], "%s %x  %s\n", kind, digest, name)
+		}
+	}
+
+	digests := make([][]byte, len(hashAlgorithms))
+	for i, summary := range summaries {
+		digests[i] = summary.Sum(nil)
+	}
+	return digests
+}
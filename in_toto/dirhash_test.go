@@ -0,0 +1,84 @@
+package in_toto
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordDirectory(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "sub", "empty"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "sub", "foo"), []byte("foo"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "bar"), []byte("bar"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "sub"), filepath.Join(dir, "sub.sym")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Digest of the lines "<sha256 of file>  <path>\n" of bar and sub/foo, like
+	// dirhash.HashDir(dir, "", dirhash.Hash1)
+	got, err := RecordDirectory(dir, []string{"sha256"}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, HashObj{"sha256": "3dc18a755451b4825abaf5f0083bcaf178e98e2dd0dc63aff8cdc241ef265c37"}, got)
+
+	got, err = RecordDirectory(dir, []string{"sha256", "sha512"}, []string{"bar"})
+	assert.Nil(t, err)
+	assert.Equal(t, "d41f2f4c9cd4d0599cbcccb7ee84357bbfecdc989650c93a399b339e4c98064f", got["sha256"])
+	assert.Len(t, got["sha512"], 128)
+
+	_, err = RecordDirectory(dir, []string{"invalid"}, nil)
+	assert.ErrorIs(t, err, ErrUnsupportedHashAlgorithm)
+	_, err = RecordDirectory(filepath.Join(dir, "missing"), []string{"sha256"}, nil)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestRecordDirectoryTree(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "sub", "empty"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "sub", "foo"), []byte("foo"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "bar"), []byte("bar"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	sum := func(data string) string {
+		return fmt.Sprintf("%x", sha256.Sum256([]byte(data)))
+	}
+	subDigest := sum(fmt.Sprintf("blob %s  foo\n", sum("foo")))
+	got, err := RecordDirectoryTree(dir, []string{"sha256"}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, HashObj{"sha256": sum(fmt.Sprintf("blob %s  bar\ntree %s  sub\n", sum("bar"), subDigest))}, got)
+
+	// The digest of a subdirectory does not depend on its location
+	got, err = RecordDirectoryTree(filepath.Join(dir, "sub"), []string{"sha256"}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, HashObj{"sha256": subDigest}, got)
+
+	got, err = RecordDirectoryTree(dir, []string{"sha256"}, []string{"bar"})
+	assert.Nil(t, err)
+	assert.Equal(t, HashObj{"sha256": sum(fmt.Sprintf("tree %s  sub\n", subDigest))}, got)
+
+	// Profiles select the mode of directory artifacts
+	profile := ArtifactProfile{DirHashPatterns: []string{"sub"}, DirHashMode: DirHashModeMerkle, LStripPaths: []string{dir + "/"}}
+	artifacts, err := profile.RecordArtifacts([]string{dir})
+	assert.Nil(t, err)
+	assert.Equal(t, HashObj{"sha256": subDigest}, artifacts["sub/"])
+
+	profile.DirHashMode = "tree"
+	_, err = profile.RecordArtifacts([]string{dir})
+	assert.ErrorIs(t, err, ErrUnknownDirHashMode)
+	assert.ErrorIs(t, validateArtifactProfile("p", profile), ErrUnknownDirHashMode)
+}
@@ -0,0 +1,69 @@
+package in_toto
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadKeyWithPassphrase(t *testing.T) {
+	var danKey Key
+	if err := danKey.LoadKey("dan", "rsassa-pss-sha256", []string{"sha256", "sha512"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tables := []struct {
+		name       string
+		path       string
+		passphrase []byte
+	}{
+		{"unencrypted PKCS1 key", "dan", nil},
+		{"unencrypted PKCS8 key", "dan.pkcs8", nil},
+		{"encrypted PKCS8 key", "dan.pkcs8.enc", []byte("123")},
+		{"legacy encrypted PEM key", "dan.enc", []byte("123")},
+	}
+	for _, table := range tables {
+		var key Key
+		if err := key.LoadKeyWithPassphrase(table.path, table.passphrase, "rsassa-pss-sha256", []string{"sha256", "sha512"}); err != nil {
+			t.Errorf("LoadKeyWithPassphrase failed for %s: %s", table.name, err)
+			continue
+		}
+		// All keys are dan's key in different encodings
+		assert.Equal(t, danKey.KeyID, key.KeyID, table.name)
+		assert.Equal(t, danKey.KeyVal.Private, key.KeyVal.Private, table.name)
+
+		sig, err := GenerateSignature([]byte("data"), key)
+		if err != nil {
+			t.Errorf("GenerateSignature failed for %s: %s", table.name, err)
+			continue
+		}
+		assert.Nil(t, VerifySignature(danKey, sig, []byte("data")), table.name)
+	}
+}
+
+func TestLoadKeyWithPassphraseErrors(t *testing.T) {
+	tables := []struct {
+		name       string
+		path       string
+		passphrase []byte
+		err        error
+	}{
+		{"encrypted PKCS8 key without passphrase", "dan.pkcs8.enc", nil, ErrEncryptedKeyNoPassphrase},
+		{"legacy encrypted PEM key without passphrase", "dan.enc", nil, ErrEncryptedKeyNoPassphrase},
+		{"encrypted PKCS8 key with wrong passphrase", "dan.pkcs8.enc", []byte("wrong"), ErrDecryptionFailed},
+		{"legacy encrypted PEM key with wrong passphrase", "dan.enc", []byte("wrong"), ErrDecryptionFailed},
+	}
+	for _, table := range tables {
+		var key Key
+		err := key.LoadKeyWithPassphrase(table.path, table.passphrase, "rsassa-pss-sha256", []string{"sha256", "sha512"})
+		if !errors.Is(err, table.err) {
+			t.Errorf("LoadKeyWithPassphrase returned '%v' for %s, expected '%s'", err, table.name, table.err)
+		}
+	}
+
+	// LoadKey does not decrypt keys
+	var key Key
+	err := key.LoadKey("dan.pkcs8.enc", "rsassa-pss-sha256", []string{"sha256", "sha512"})
+	assert.ErrorIs(t, err, ErrEncryptedKeyNoPassphrase)
+}
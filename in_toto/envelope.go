@@ -3,14 +3,12 @@ package in_toto
 import (
 	"context"
 	"encoding/base64"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"os"
+	"io"
 
-	"github.com/secure-systems-lab/go-securesystemslib/cjson"
+	"github.com/in-toto/in-toto-golang/in_toto/keys"
 	"github.com/secure-systems-lab/go-securesystemslib/dsse"
-	"github.com/secure-systems-lab/go-securesystemslib/signerverifier"
 )
 
 // PayloadType is the payload type used for links and layouts.
@@ -22,6 +20,9 @@ var ErrInvalidPayloadType = errors.New("unknown payload type")
 type Envelope struct {
 	envelope *dsse.Envelope
 	payload  any
+	// selfDigest embeds a digest of the payload when dumped, see
+	// SetSelfDigest
+	selfDigest bool
 }
 
 func loadEnvelope(env *dsse.Envelope) (*Envelope, error) {
@@ -42,7 +43,11 @@ func loadEnvelope(env *dsse.Envelope) (*Envelope, error) {
 }
 
 func (e *Envelope) SetPayload(payload any) error {
-	encodedBytes, err := cjson.EncodeCanonical(payload)
+	c, err := GetCanonicalizer(envelopeSpecVersion)
+	if err != nil {
+		return err
+	}
+	encodedBytes, err := c.EncodePayload(payload)
 	if err != nil {
 		return err
 	}
@@ -51,6 +56,7 @@ func (e *Envelope) SetPayload(payload any) error {
 	e.envelope = &dsse.Envelope{
 		Payload:     base64.StdEncoding.EncodeToString(encodedBytes),
 		PayloadType: PayloadType,
+		Signatures:  []dsse.Signature{},
 	}
 
 	return nil
@@ -61,43 +67,101 @@ func (e *Envelope) GetPayload() any {
 }
 
 func (e *Envelope) VerifySignature(key Key) error {
-	verifier, err := getSignerVerifierFromKey(key)
+	verifier, err := keys.NewSignerVerifier(key)
 	if err != nil {
 		return err
 	}
+	return e.verifyWith(verifier)
+}
 
-	ev, err := dsse.NewEnvelopeVerifier(verifier)
+func (e *Envelope) Sign(key Key) error {
+	signer, err := keys.NewSignerVerifier(key)
 	if err != nil {
 		return err
 	}
-
-	_, err = ev.Verify(context.Background(), e.envelope)
-	return err
+	return e.signWith(signer)
 }
 
-func (e *Envelope) Sign(key Key) error {
-	signer, err := getSignerVerifierFromKey(key)
+// signableBytes returns the bytes the signatures of the envelope are created
+// over, as prepared by the Canonicalizer of the spec version of envelopes.
+func (e *Envelope) signableBytes() ([]byte, error) {
+	c, err := GetCanonicalizer(envelopeSpecVersion)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	payload, err := e.envelope.DecodeB64Payload()
+	if err != nil {
+		return nil, err
+	}
+	return c.SignableBytes(e.envelope.PayloadType, payload), nil
+}
 
-	es, err := dsse.NewEnvelopeSigner(signer)
+// signWith adds a signature of the passed signer over the signable bytes to
+// the envelope.
+func (e *Envelope) signWith(signer dsse.Signer) error {
+	signable, err := e.signableBytes()
 	if err != nil {
 		return err
 	}
-
-	payload, err := e.envelope.DecodeB64Payload()
+	sig, err := signer.Sign(context.Background(), signable)
 	if err != nil {
 		return err
 	}
+	keyID, err := signer.KeyID()
+	if err != nil {
+		keyID = ""
+	}
+	e.envelope.Signatures = append(e.envelope.Signatures, dsse.Signature{
+		KeyID: keyID,
+		Sig:   base64.StdEncoding.EncodeToString(sig),
+	})
+	return nil
+}
 
-	env, err := es.SignPayload(context.Background(), e.envelope.PayloadType, payload)
+/*
+verifyWith verifies that the envelope carries a signature over the signable
+bytes that is valid for the passed verifier.  Like the DSSE library,
+signatures are skipped if both they and the verifier have a key id, and the
+key ids differ.  Malformed signatures are skipped, too, and the first of their
+errors is wrapped in the returned error, if no signature is valid.
+*/
+func (e *Envelope) verifyWith(verifier dsse.Verifier) error {
+	if len(e.envelope.Signatures) == 0 {
+		return dsse.ErrNoSignature
+	}
+	signable, err := e.signableBytes()
 	if err != nil {
 		return err
 	}
-
-	e.envelope = env
-	return nil
+	keyID, err := verifier.KeyID()
+	if err != nil {
+		keyID = ""
+	}
+	// Malformed signatures, e.g. of other key types without key id, must not
+	// hide a valid signature later in the envelope
+	var malformedErr error
+	for _, s := range e.envelope.Signatures {
+		if s.KeyID != "" && keyID != "" && s.KeyID != keyID {
+			continue
+		}
+		sig, err := decodeBase64Signature(s.Sig)
+		if err == nil {
+			err = validateSignatureBytes(verifier.Public(), sig)
+		}
+		if err != nil {
+			if malformedErr == nil {
+				malformedErr = err
+			}
+			continue
+		}
+		if err := verifier.Verify(context.Background(), signable, sig); err == nil {
+			return nil
+		}
+	}
+	if malformedErr != nil {
+		return fmt.Errorf("%w: no valid signature for key '%s': %w", ErrInvalidSignature, keyID, malformedErr)
+	}
+	return fmt.Errorf("%w: no valid signature for key '%s'", ErrInvalidSignature, keyID)
 }
 
 func (e *Envelope) Sigs() []Signature {
@@ -118,17 +182,17 @@ func (e *Envelope) GetSignatureForKeyID(keyID string) (Signature, error) {
 		}
 	}
 
-	return Signature{}, fmt.Errorf("no signature found for key '%s'", keyID)
+	return Signature{}, fmt.Errorf("%w for key '%s'", ErrSignatureNotFound, keyID)
 }
 
 func (e *Envelope) Dump(path string) error {
-	jsonBytes, err := json.MarshalIndent(e.envelope, "", "  ")
+	jsonBytes, err := marshalEnvelope(e)
 	if err != nil {
 		return err
 	}
 
 	// Write JSON bytes to the passed path with permissions (-rw-r--r--)
-	err = os.WriteFile(path, jsonBytes, 0644)
+	err = writeMetadataFile(path, jsonBytes, 0644)
 	if err != nil {
 		return err
 	}
@@ -136,31 +200,48 @@ func (e *Envelope) Dump(path string) error {
 	return nil
 }
 
-func getSignerVerifierFromKey(key Key) (dsse.SignerVerifier, error) {
-	sslibKey := getSSLibKeyFromKey(key)
-
-	switch sslibKey.KeyType {
-	case signerverifier.RSAKeyType:
-		return signerverifier.NewRSAPSSSignerVerifierFromSSLibKey(&sslibKey)
-	case signerverifier.ED25519KeyType:
-		return signerverifier.NewED25519SignerVerifierFromSSLibKey(&sslibKey)
-	case signerverifier.ECDSAKeyType:
-		return signerverifier.NewECDSASignerVerifierFromSSLibKey(&sslibKey)
+// DumpTo JSON serializes the envelope on which it was called like Dump, and
+// writes it to the passed writer.
+func (e *Envelope) DumpTo(w io.Writer) error {
+	jsonBytes, err := marshalEnvelope(e)
+	if err != nil {
+		return err
 	}
+	_, err = w.Write(jsonBytes)
+	return err
+}
 
-	return nil, ErrUnsupportedKeyType
+/*
+WrapMetablock wraps the link or layout of the passed Metablock in a new DSSE
+envelope.  The signatures of the Metablock are not carried over, because DSSE
+signatures are computed over a different representation of the payload.
+Hence, the returned envelope must be signed again, e.g. via Sign.
+*/
+func WrapMetablock(mb *Metablock) (*Envelope, error) {
+	switch mb.Signed.(type) {
+	case Link, Layout:
+	default:
+		return nil, ErrUnknownMetadataType
+	}
+
+	env := &Envelope{}
+	if err := env.SetPayload(mb.Signed); err != nil {
+		return nil, err
+	}
+	return env, nil
 }
 
-func getSSLibKeyFromKey(key Key) signerverifier.SSLibKey {
-	return signerverifier.SSLibKey{
-		KeyType:             key.KeyType,
-		KeyIDHashAlgorithms: key.KeyIDHashAlgorithms,
-		KeyID:               key.KeyID,
-		Scheme:              key.Scheme,
-		KeyVal: signerverifier.KeyVal{
-			Public:      key.KeyVal.Public,
-			Private:     key.KeyVal.Private,
-			Certificate: key.KeyVal.Certificate,
-		},
+/*
+UnwrapEnvelope returns the link or layout of the passed DSSE envelope in a new
+Metablock.  Like WrapMetablock, it does not carry over signatures, so the
+returned Metablock must be signed again, e.g. via Sign.
+*/
+func UnwrapEnvelope(env *Envelope) (*Metablock, error) {
+	switch env.payload.(type) {
+	case Link, Layout:
+	default:
+		return nil, ErrUnknownMetadataType
 	}
+
+	return &Metablock{Signed: env.payload, Signatures: []Signature{}}, nil
 }
@@ -258,3 +258,42 @@ func TestEnvelopeGetSignatureForKeyID(t *testing.T) {
 	_, err = env.GetSignatureForKeyID("unknown")
 	assert.ErrorContains(t, err, "no signature found for key")
 }
+
+func TestWrapAndUnwrapMetadata(t *testing.T) {
+	var key Key
+	if err := key.LoadKeyDefaults("carol"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"demo.layout", "write-code.b7d643de.link"} {
+		mb := &Metablock{}
+		if err := mb.Load(path); err != nil {
+			t.Fatal(err)
+		}
+
+		env, err := WrapMetablock(mb)
+		if err != nil {
+			t.Errorf("WrapMetablock failed for %s: %s", path, err)
+			continue
+		}
+		assert.Equal(t, mb.Signed, env.GetPayload())
+		assert.Empty(t, env.Sigs())
+		assert.Nil(t, env.Sign(key))
+		assert.Nil(t, env.VerifySignature(key))
+
+		unwrapped, err := UnwrapEnvelope(env)
+		if err != nil {
+			t.Errorf("UnwrapEnvelope failed for %s: %s", path, err)
+			continue
+		}
+		assert.Equal(t, mb.Signed, unwrapped.Signed)
+		assert.Empty(t, unwrapped.Sigs())
+		assert.Nil(t, unwrapped.Sign(key))
+		assert.Nil(t, unwrapped.VerifySignature(key))
+	}
+
+	_, err := WrapMetablock(&Metablock{Signed: "foo"})
+	assert.ErrorIs(t, err, ErrUnknownMetadataType)
+	_, err = UnwrapEnvelope(&Envelope{payload: "foo"})
+	assert.ErrorIs(t, err, ErrUnknownMetadataType)
+}
@@ -0,0 +1,181 @@
+package in_toto
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/in-toto/in-toto-golang/in_toto/keys"
+)
+
+// ErrStreamingUnsupported indicates that signatures of a key cannot be
+// verified without holding the signed payload in memory.
+var ErrStreamingUnsupported = errors.New("streaming verification unsupported")
+
+/*
+NewPAEReader returns a reader over the DSSE pre-authentication encoding of the
+passed payload type and the payload read from the passed reader, which must
+yield exactly size bytes.  The payload is not buffered, hence the signable
+bytes of envelopes with very large payloads can be hashed piecewise.  If the
+payload reader yields more or less than size bytes, reading fails with
+io.ErrUnexpectedEOF.
+*/
+func NewPAEReader(payloadType string, payload io.Reader, size int64) io.Reader {
+	var header bytes.Buffer
+	header.WriteString("DSSEv1 ")
+	header.WriteString(strconv.Itoa(len(payloadType)))
+	header.WriteString(" ")
+	header.WriteString(payloadType)
+	header.WriteString(" ")
+	header.WriteString(strconv.FormatInt(size, 10))
+	header.WriteString(" ")
+	return io.MultiReader(&header, &sizedReader{r: payload, remaining: size})
+}
+
+// sizedReader fails if the wrapped reader does not yield exactly the
+// remaining number of bytes.
+type sizedReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (s *sizedReader) Read(p []byte) (int, error) {
+	if s.remaining <= 0 {
+		// Probe for trailing bytes, which would change the signed payload
+		var probe [1]byte
+		n, err := s.r.Read(probe[:])
+		if n > 0 {
+			return 0, io.ErrUnexpectedEOF
+		}
+		if err == nil {
+			return 0, nil
+		}
+		if errors.Is(err, io.EOF) {
+			return 0, io.EOF
+		}
+		return 0, err
+	}
+	if int64(len(p)) > s.remaining {
+		p = p[:s.remaining]
+	}
+	n, err := s.r.Read(p)
+	s.remaining -= int64(n)
+	if errors.Is(err, io.EOF) {
+		if s.remaining > 0 {
+			return n, io.ErrUnexpectedEOF
+		}
+		err = nil
+	}
+	return n, err
+}
+
+/*
+VerifyPayloadStream verifies that one of the passed DSSE signatures, e.g. as
+returned by Envelope.Sigs, is a valid signature of the passed key over the
+payload read from the passed reader, which must yield exactly size bytes of
+the decoded payload.  The payload is hashed once while it is read, and never
+held in memory, hence envelopes with very large payloads, such as SBOMs, can
+be verified from a file or network stream.  Payloads that are still base64
+encoded can be passed through base64.NewDecoder.
+
+Like Envelope.VerifySignature, signatures are skipped if both they and the key
+have a key id, and the key ids differ.  Streaming verification requires the
+signature scheme to hash the signed bytes before signing, hence it is
+supported for RSA and ECDSA keys, but not for ed25519 keys, for which
+ErrStreamingUnsupported is returned.
+*/
+func VerifyPayloadStream(key Key, payloadType string, payload io.Reader, size int64, sigs []Signature) error {
+	if err := keys.ValidateKey(key); err != nil {
+		return err
+	}
+	if len(sigs) == 0 {
+		return fmt.Errorf("%w: no signatures", ErrInvalidSignature)
+	}
+
+	hash, verify, err := getStreamVerifier(key)
+	if err != nil {
+		return err
+	}
+
+	h := hash.New()
+	if _, err := io.Copy(h, NewPAEReader(payloadType, payload, size)); err != nil {
+		return fmt.Errorf("failed to read payload: %w", err)
+	}
+	digest := h.Sum(nil)
+
+	for _, s := range sigs {
+		if s.KeyID != "" && key.KeyID != "" && s.KeyID != key.KeyID {
+			continue
+		}
+		sig, err := decodeBase64Signature(s.Sig)
+		if err != nil {
+			return err
+		}
+		if public, err := key.CryptoPublicKey(); err == nil {
+			if err := validateSignatureBytes(public, sig); err != nil {
+				return err
+			}
+		}
+		if verify(digest, sig) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: no valid signature for key '%s'", ErrInvalidSignature, key.KeyID)
+}
+
+/*
+getStreamVerifier returns the hash function, which the scheme of the passed key
+applies to the signed bytes, and a function that verifies a signature over the
+resulting digest.  The hash functions are chosen consistent with the
+signerverifiers used by Envelope.VerifySignature.
+*/
+func getStreamVerifier(key Key) (crypto.Hash, func(digest, sig []byte) bool, error) {
+	switch key.KeyType {
+	case rsaKeyType, ecdsaKeyType:
+	case ed25519KeyType:
+		return 0, nil, fmt.Errorf("%w: %s keys sign the message itself", ErrStreamingUnsupported, key.KeyType)
+	default:
+		return 0, nil, fmt.Errorf("%w: %s", ErrUnsupportedKeyType, key.KeyType)
+	}
+
+	publicKey, err := key.CryptoPublicKey()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	switch public := publicKey.(type) {
+	case *rsa.PublicKey:
+		hash, pss, err := keys.RSASchemeParameters(key.Scheme)
+		if err != nil {
+			return 0, nil, err
+		}
+		return hash, func(digest, sig []byte) bool {
+			if pss {
+				return rsa.VerifyPSS(public, hash, digest, sig,
+					&rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto, Hash: hash}) == nil
+			}
+			return rsa.VerifyPKCS1v15(public, hash, digest, sig) == nil
+		}, nil
+	case *ecdsa.PublicKey:
+		var hash crypto.Hash
+		// Consistent with the securesystemslib, the hash is chosen by curve size
+		curveSize := public.Curve.Params().BitSize
+		switch {
+		case curveSize <= 256:
+			hash = crypto.SHA256
+		case curveSize <= 384:
+			hash = crypto.SHA384
+		default:
+			hash = crypto.SHA512
+		}
+		return hash, func(digest, sig []byte) bool {
+			return ecdsa.VerifyASN1(public, digest, sig)
+		}, nil
+	}
+	return 0, nil, fmt.Errorf("%w: public key does not match key type %s", ErrInvalidKey, key.KeyType)
+}
@@ -0,0 +1,108 @@
+package in_toto
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/secure-systems-lab/go-securesystemslib/dsse"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewPAEReader(t *testing.T) {
+	payload := []byte(`{"_type":"link"}`)
+	pae, err := io.ReadAll(NewPAEReader(PayloadType, bytes.NewReader(payload), int64(len(payload))))
+	assert.Nil(t, err)
+	assert.Equal(t, dsse.PAE(PayloadType, payload), pae)
+
+	_, err = io.ReadAll(NewPAEReader(PayloadType, bytes.NewReader(payload), int64(len(payload)+1)))
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	_, err = io.ReadAll(NewPAEReader(PayloadType, bytes.NewReader(payload), int64(len(payload)-1)))
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestVerifyPayloadStream(t *testing.T) {
+	metadata, err := LoadMetadata("demo.dsse.layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := metadata.(*Envelope)
+	payload, err := env.envelope.DecodeB64Payload()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var alice Key
+	if err := alice.LoadKey("alice.pub", "rsassa-pss-sha256", []string{"sha256", "sha512"}); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("rsa signature", func(t *testing.T) {
+		err := VerifyPayloadStream(alice, PayloadType, bytes.NewReader(payload), int64(len(payload)), env.Sigs())
+		assert.Nil(t, err)
+	})
+
+	t.Run("base64 encoded payload", func(t *testing.T) {
+		decoder := base64.NewDecoder(base64.StdEncoding, strings.NewReader(env.envelope.Payload))
+		err := VerifyPayloadStream(alice, PayloadType, decoder, int64(len(payload)), env.Sigs())
+		assert.Nil(t, err)
+	})
+
+	t.Run("tampered payload", func(t *testing.T) {
+		tampered := bytes.Replace(payload, []byte("layout"), []byte("LAYOUT"), 1)
+		err := VerifyPayloadStream(alice, PayloadType, bytes.NewReader(tampered), int64(len(tampered)), env.Sigs())
+		assert.ErrorIs(t, err, ErrInvalidSignature)
+	})
+
+	t.Run("wrong payload type", func(t *testing.T) {
+		err := VerifyPayloadStream(alice, "text/plain", bytes.NewReader(payload), int64(len(payload)), env.Sigs())
+		assert.ErrorIs(t, err, ErrInvalidSignature)
+	})
+
+	t.Run("wrong size", func(t *testing.T) {
+		err := VerifyPayloadStream(alice, PayloadType, bytes.NewReader(payload), int64(len(payload)-1), env.Sigs())
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	})
+
+	t.Run("no signatures", func(t *testing.T) {
+		err := VerifyPayloadStream(alice, PayloadType, bytes.NewReader(payload), int64(len(payload)), nil)
+		assert.ErrorIs(t, err, ErrInvalidSignature)
+	})
+
+	t.Run("ecdsa signature", func(t *testing.T) {
+		for _, name := range []string{"frank", "grace", "heidi"} {
+			var key Key
+			if err := key.LoadKeyDefaults(name); err != nil {
+				t.Fatal(err)
+			}
+			signed := &Envelope{}
+			if err := signed.SetPayload(env.GetPayload()); err != nil {
+				t.Fatal(err)
+			}
+			if err := signed.Sign(key); err != nil {
+				t.Fatal(err)
+			}
+			signedPayload, err := signed.envelope.DecodeB64Payload()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			public := key
+			public.KeyVal.Private = ""
+			err = VerifyPayloadStream(public, PayloadType, bytes.NewReader(signedPayload), int64(len(signedPayload)), signed.Sigs())
+			assert.Nil(t, err, name)
+		}
+	})
+
+	t.Run("ed25519 unsupported", func(t *testing.T) {
+		var carol Key
+		if err := carol.LoadKey("carol.pub", "ed25519", []string{"sha256", "sha512"}); err != nil {
+			t.Fatal(err)
+		}
+		err := VerifyPayloadStream(carol, PayloadType, bytes.NewReader(payload), int64(len(payload)), env.Sigs())
+		assert.ErrorIs(t, err, ErrStreamingUnsupported)
+	})
+}
@@ -1,6 +1,8 @@
 package in_toto
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 )
@@ -55,3 +57,34 @@ func ExampleInTotoVerify() {
 	}
 	// Output: in-toto verification succeeded!
 }
+
+func ExampleEventSinkFunc() {
+	// publish stands in for the producer of a Kafka or NATS client, e.g.
+	// (*kafka.Writer).WriteMessages of github.com/segmentio/kafka-go or
+	// (*nats.Conn).Publish of github.com/nats-io/nats.go.
+	publish := func(ctx context.Context, topic string, key, value []byte) error {
+		fmt.Printf("published event for '%s' to %s\n", key, topic)
+		return nil
+	}
+
+	// Publish each event in structured content mode, i.e. the JSON encoding
+	// of the entire event is the message value.  Keying messages by subject
+	// keeps the events of a layout or step in order.
+	sink := EventSinkFunc(func(ctx context.Context, event CloudEvent) error {
+		value, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		if err := publish(ctx, "in-toto.events", []byte(event.Subject), value); err != nil {
+			return fmt.Errorf("%w: %s", ErrEventDelivery, err)
+		}
+		return nil
+	})
+
+	emitter := NewEventEmitter("https://verifier.example.com", sink)
+	report := &VerificationReport{Layout: LayoutPath, Passed: true}
+	if err := emitter.EmitVerificationResult(context.Background(), report); err != nil {
+		fmt.Printf("Unable to emit verification result: %s", err)
+	}
+	// Output: published event for 'demo.layout' to in-toto.events
+}
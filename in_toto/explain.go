@@ -0,0 +1,186 @@
+package in_toto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ErrArtifactNotExplained is returned when the verification evidence does
+// not mention an artifact.
+var ErrArtifactNotExplained = errors.New("artifact not found in verification evidence")
+
+/*
+VerificationEvidence holds the evidence gathered during a successful supply
+chain verification, i.e. the verified layout, the verified links and their
+signers for each step and which artifact rules consumed which artifacts.  It is populated by
+InTotoVerifyWithEvidence and queried via Explain.
+*/
+type VerificationEvidence struct {
+	layout        Layout
+	signers       map[string][]string
+	links         map[string]map[string]Metadata
+	itemsMetadata map[string]Metadata
+	// consumedBy maps item name, artifact type and artifact name to the rule
+	// that consumed the artifact
+	consumedBy map[string]map[string]map[string][]string
+	// reused holds the names of items, whose verification was reused, see
+	// WithPreviousEvidence
+	reused Set
+	// signables memoizes the digests of the links, see LinkDigests
+	signables *signableMemo
+}
+
+// init prepares the evidence for the passed layout and verified links, which
+// were canonicalized with the passed memo.
+func (e *VerificationEvidence) init(layout Layout, stepsMetadataVerified map[string]map[string]Metadata,
+	memo *signableMemo) {
+	e.layout = layout
+	e.signables = memo
+	e.links = stepsMetadataVerified
+	e.signers = make(map[string][]string, len(stepsMetadataVerified))
+	for stepName, linksPerStep := range stepsMetadataVerified {
+		keyIDs := make([]string, 0, len(linksPerStep))
+		for keyID := range linksPerStep {
+			keyIDs = append(keyIDs, keyID)
+		}
+		sort.Strings(keyIDs)
+		e.signers[stepName] = keyIDs
+	}
+	e.consumedBy = map[string]map[string]map[string][]string{}
+	e.reused = NewSet()
+}
+
+// recordConsumption records that the passed rule of the passed item consumed
+// the passed artifacts.
+func (e *VerificationEvidence) recordConsumption(itemName string, srcType string, rule []string, consumed Set) {
+	if e.consumedBy[itemName] == nil {
+		e.consumedBy[itemName] = map[string]map[string][]string{}
+	}
+	if e.consumedBy[itemName][srcType] == nil {
+		e.consumedBy[itemName][srcType] = map[string][]string{}
+	}
+	for artifact := range consumed {
+		e.consumedBy[itemName][srcType][artifact] = rule
+	}
+}
+
+/*
+ArtifactEvidence describes how a single step or inspection vouches for an
+artifact.  Item is the name of the step or inspection and ItemType is either
+"step" or "inspection".  ArtifactType is "materials" or "products", depending
+on how the link of the item recorded the artifact, and Digest is the recorded
+digest.  Rule is the artifact rule that consumed the artifact, if any, and
+Signers are the key IDs of the functionaries whose links of the step were
+verified.  Inspections are run by the verifier and have no signers.
+*/
+type ArtifactEvidence struct {
+	Item         string   `json:"item"`
+	ItemType     string   `json:"item_type"`
+	ArtifactType string   `json:"artifact_type"`
+	Digest       HashObj  `json:"digest"`
+	Rule         []string `json:"rule,omitempty"`
+	Signers      []string `json:"signers,omitempty"`
+}
+
+/*
+ArtifactExplanation is the chain of evidence for an artifact, ordered like
+the steps and inspections of the layout, with materials before products for
+each item.
+*/
+type ArtifactExplanation struct {
+	Artifact string             `json:"artifact"`
+	Evidence []ArtifactEvidence `json:"evidence"`
+}
+
+/*
+Explain returns the chain of evidence for the passed artifact, i.e. each link
+that recorded the artifact, the rule that consumed it there and who signed the
+link.  If no link recorded the artifact, ErrArtifactNotExplained is returned.
+*/
+func (e *VerificationEvidence) Explain(artifact string) (*ArtifactExplanation, error) {
+	explanation := &ArtifactExplanation{Artifact: artifact, Evidence: []ArtifactEvidence{}}
+
+	addEvidence := func(itemName string, itemType string) {
+		linkEnv, ok := e.itemsMetadata[itemName]
+		if !ok {
+			return
+		}
+		link, ok := linkEnv.GetPayload().(Link)
+		if !ok {
+			return
+		}
+		for _, artifactType := range []string{"materials", "products"} {
+			artifacts := link.Materials
+			if artifactType == "products" {
+				artifacts = link.Products
+			}
+			digest, ok := artifacts[artifact]
+			if !ok {
+				continue
+			}
+			explanation.Evidence = append(explanation.Evidence, ArtifactEvidence{
+				Item:         itemName,
+				ItemType:     itemType,
+				ArtifactType: artifactType,
+				Digest:       digest,
+				Rule:         e.consumedBy[itemName][artifactType][artifact],
+				Signers:      e.signers[itemName],
+			})
+		}
+	}
+
+	for _, step := range e.layout.Steps {
+		addEvidence(step.Name, "step")
+	}
+	for _, inspection := range e.layout.Inspect {
+		addEvidence(inspection.Name, "inspection")
+	}
+
+	if len(explanation.Evidence) == 0 {
+		return nil, fmt.Errorf("%w: '%s'", ErrArtifactNotExplained, artifact)
+	}
+	return explanation, nil
+}
+
+/*
+LinkDigests returns the digests of the links the supply chain was verified
+with, see MetadataDigest, ordered by step and signer, e.g. to keep them when
+pruning a metadata store, see RetentionPolicy.
+*/
+func (e *VerificationEvidence) LinkDigests() ([]HashObj, error) {
+	stepNames := make([]string, 0, len(e.links))
+	for stepName := range e.links {
+		stepNames = append(stepNames, stepName)
+	}
+	sort.Strings(stepNames)
+	var digests []HashObj
+	for _, stepName := range stepNames {
+		for _, keyID := range e.signers[stepName] {
+			digest, err := e.signables.digest(e.links[stepName][keyID])
+			if err != nil {
+				return nil, err
+			}
+			digests = append(digests, digest)
+		}
+	}
+	return digests, nil
+}
+
+/*
+InTotoVerifyWithEvidence performs the verification routine of InTotoVerify
+and, on success, additionally returns the gathered evidence, which explains
+why artifacts passed verification, see VerificationEvidence.Explain.
+*/
+func InTotoVerifyWithEvidence(layoutEnv Metadata, layoutKeys map[string]Key,
+	linkDir string, stepName string, parameterDictionary map[string]string, intermediatePems [][]byte, lineNormalization bool) (
+	Metadata, *VerificationEvidence, error) {
+	evidence := &VerificationEvidence{}
+	summaryLink, err := inTotoVerify(context.Background(), layoutEnv, layoutKeys, linkDir, stepName,
+		parameterDictionary, intermediatePems, lineNormalization, verifyOptions{evidence: evidence})
+	if err != nil {
+		return nil, nil, err
+	}
+	return summaryLink, evidence, nil
+}
@@ -0,0 +1,70 @@
+package in_toto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInTotoVerifyWithEvidence(t *testing.T) {
+	layoutEnv, err := LoadMetadata("demo.layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pubKey Key
+	if err := pubKey.LoadKey("alice.pub", "rsassa-pss-sha256", []string{"sha256", "sha512"}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, evidence, err := InTotoVerifyWithEvidence(layoutEnv, map[string]Key{pubKey.KeyID: pubKey}, ".", "",
+		map[string]string{}, [][]byte{}, testOSisWindows())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	digest := HashObj{"sha256": "52947cb78b91ad01fe81cd6aef42d1f6817e92b9e6936c1e5aabb7c98514f355"}
+	explanation, err := evidence.Explain("foo.tar.gz")
+	assert.Nil(t, err)
+	assert.Equal(t, &ArtifactExplanation{
+		Artifact: "foo.tar.gz",
+		Evidence: []ArtifactEvidence{
+			{
+				Item:         "package",
+				ItemType:     "step",
+				ArtifactType: "products",
+				Digest:       digest,
+				Rule:         []string{"ALLOW", "foo.tar.gz"},
+				Signers:      []string{"d3ffd1086938b3698618adf088bf14b13db4c8ae19e4e78d73da49ee88492710"},
+			},
+			{
+				Item:         "untar",
+				ItemType:     "inspection",
+				ArtifactType: "materials",
+				Digest:       digest,
+				Rule:         []string{"MATCH", "foo.tar.gz", "WITH", "PRODUCTS", "FROM", "package"},
+			},
+			{
+				// Not consumed by any rule
+				Item:         "untar",
+				ItemType:     "inspection",
+				ArtifactType: "products",
+				Digest:       digest,
+			},
+		},
+	}, explanation)
+
+	explanation, err = evidence.Explain("foo.py")
+	assert.Nil(t, err)
+	assert.Equal(t, "write-code", explanation.Evidence[0].Item)
+	assert.Equal(t, []string{"ALLOW", "foo.py"}, explanation.Evidence[0].Rule)
+	assert.Equal(t, []string{"b7d643dec0a051096ee5d87221b5d91a33daa658699d30903e1cefb90c418401"}, explanation.Evidence[0].Signers)
+
+	_, err = evidence.Explain("does-not-exist")
+	assert.ErrorIs(t, err, ErrArtifactNotExplained)
+
+	// No evidence for failed verification
+	_, evidence, err = InTotoVerifyWithEvidence(layoutEnv, map[string]Key{}, ".", "",
+		map[string]string{}, [][]byte{}, testOSisWindows())
+	assert.NotNil(t, err)
+	assert.Nil(t, evidence)
+}
@@ -0,0 +1,93 @@
+package in_toto
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Artifact name prefixes of git objects, see RecordGitArtifacts.
+const (
+	GitCommitArtifactPrefix = "git:commit:"
+	GitTagArtifactPrefix    = "git:tag:"
+	GitTreeArtifactPrefix   = "git:tree:"
+)
+
+/*
+RecordGitArtifacts records the git objects the passed revisions resolve to in
+the git repository in repoDir, as artifacts of a version control step, e.g. of
+a "checkout" step, instead of hashing the entire worktree.  Revisions are any
+revisions git understands, e.g. branch or tag names, and default to "HEAD".
+For each revision the commit and its tree are recorded as
+"git:commit:<revision>" and "git:tree:<revision>", and for annotated tags also
+the tag object as "git:tag:<revision>".  The digests are the object ids, by
+the hash algorithm of the repository, i.e. "sha1" or "sha256".
+*/
+func RecordGitArtifacts(repoDir string, revisions ...string) (map[string]HashObj, error) {
+	return RecordGitArtifactsContext(context.Background(), repoDir, revisions...)
+}
+
+// RecordGitArtifactsContext is like RecordGitArtifacts, but aborts running
+// git commands when the passed context is cancelled.
+func RecordGitArtifactsContext(ctx context.Context, repoDir string, revisions ...string) (map[string]HashObj, error) {
+	if repoDir == "" {
+		repoDir = "."
+	}
+	if len(revisions) == 0 {
+		revisions = []string{"HEAD"}
+	}
+	artifacts := make(map[string]HashObj, 2*len(revisions))
+	for _, revision := range revisions {
+		if err := validateGitReference(GitReference{Revision: revision}); err != nil {
+			return nil, err
+		}
+		objectID, err := resolveGitObject(ctx, repoDir, revision+"^{object}")
+		if err != nil {
+			return nil, err
+		}
+		objectType, err := runGit(ctx, repoDir, "cat-file", "-t", objectID)
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(string(objectType)) == "tag" {
+			if artifacts[GitTagArtifactPrefix+revision], err = gitObjectDigest(objectID); err != nil {
+				return nil, err
+			}
+		}
+		for prefix, peel := range map[string]string{GitCommitArtifactPrefix: "^{commit}", GitTreeArtifactPrefix: "^{tree}"} {
+			id, err := resolveGitObject(ctx, repoDir, objectID+peel)
+			if err != nil {
+				return nil, err
+			}
+			if artifacts[prefix+revision], err = gitObjectDigest(id); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return artifacts, nil
+}
+
+// resolveGitObject returns the id of the object the passed revision resolves
+// to in the git repository in repoDir.
+func resolveGitObject(ctx context.Context, repoDir string, revision string) (string, error) {
+	id, err := runGit(ctx, repoDir, "rev-parse", "--verify", "--quiet", revision)
+	if err != nil {
+		return "", fmt.Errorf("git revision '%s': %w", revision, err)
+	}
+	return strings.TrimSpace(string(id)), nil
+}
+
+// gitObjectDigest returns the passed git object id as digest of the hash
+// algorithm of the repository, derived from its length.
+func gitObjectDigest(id string) (HashObj, error) {
+	if !isHexString(id) {
+		return nil, fmt.Errorf("%w: git object id '%s'", ErrInvalidHexString, id)
+	}
+	switch len(id) {
+	case 40:
+		return HashObj{"sha1": id}, nil
+	case 64:
+		return HashObj{"sha256": id}, nil
+	}
+	return nil, fmt.Errorf("git object id '%s' is neither sha1 nor sha256", id)
+}
@@ -0,0 +1,65 @@
+package in_toto
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordGitArtifacts(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	ctx := context.Background()
+	git := func(args ...string) string {
+		out, err := runGit(ctx, dir, append([]string{"-c", "user.name=Alice", "-c", "user.email=alice@example.com"}, args...)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	if _, err := runGit(ctx, ".", "init", "-q", dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "foo.py"), []byte("print('foo')\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	git("add", "foo.py")
+	git("commit", "-q", "-m", "Add foo")
+	git("tag", "-a", "v1", "-m", "Release")
+	git("tag", "v1-light")
+	commit := git("rev-parse", "HEAD")
+	tree := git("rev-parse", "HEAD^{tree}")
+	tag := git("rev-parse", "v1")
+
+	artifacts, err := RecordGitArtifacts(dir)
+	if assert.Nil(t, err) {
+		assert.Equal(t, map[string]HashObj{
+			"git:commit:HEAD": {"sha1": commit},
+			"git:tree:HEAD":   {"sha1": tree},
+		}, artifacts)
+	}
+
+	artifacts, err = RecordGitArtifactsContext(ctx, dir, "v1", "v1-light")
+	if assert.Nil(t, err) {
+		assert.Equal(t, map[string]HashObj{
+			"git:tag:v1":          {"sha1": tag},
+			"git:commit:v1":       {"sha1": commit},
+			"git:tree:v1":         {"sha1": tree},
+			"git:commit:v1-light": {"sha1": commit},
+			"git:tree:v1-light":   {"sha1": tree},
+		}, artifacts)
+		assert.Nil(t, validateArtifacts(artifacts))
+	}
+
+	_, err = RecordGitArtifacts(dir, "missing")
+	assert.NotNil(t, err)
+	_, err = RecordGitArtifacts(dir, "--all")
+	assert.NotNil(t, err)
+}
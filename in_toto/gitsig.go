@@ -0,0 +1,631 @@
+package in_toto
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/openpgp"        //nolint:staticcheck
+	"golang.org/x/crypto/openpgp/armor"  //nolint:staticcheck
+	"golang.org/x/crypto/openpgp/packet" //nolint:staticcheck
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrInvalidGitSignature is returned if the signature of a git commit or tag
+// is malformed or does not verify.
+var ErrInvalidGitSignature = errors.New("invalid git signature")
+
+// ErrUnsupportedGitSignature is returned if a git object is signed in a format
+// other than SSH, GPG or X.509, e.g. by gitsign.
+var ErrUnsupportedGitSignature = errors.New("unsupported git signature")
+
+const (
+	gitSSHSignatureArmor  = "-----BEGIN SSH SIGNATURE-----"
+	gitGPGSignatureArmor  = "-----BEGIN PGP SIGNATURE-----"
+	gitX509SignatureArmor = "-----BEGIN SIGNED MESSAGE-----"
+	// gitSSHNamespace is the namespace git signs commits and tags in with SSH
+	// keys, see ssh-keygen -Y sign
+	gitSSHNamespace = "git"
+)
+
+/*
+GitReference references a signed git commit or tag, whose signature is
+verified as evidence of a step, instead of loading link metadata files of the
+step.  Revision is any revision git understands, e.g. a commit id or a tag
+name, and may contain parameters, e.g. "{COMMIT}", see SubstituteParameters.
+The signer of the commit or tag must be a functionary of the step, identified
+by a key of the layout or, for gitsign, by a certificate matching the
+certificate constraints of the step.  The products of the step are the files
+of the commit, or of the commit the tag points to, so that later steps can
+match their materials against the source.
+*/
+type GitReference struct {
+	Revision string `json:"revision"`
+}
+
+// validateGitReference checks that the passed reference has a revision.
+func validateGitReference(ref GitReference) error {
+	if ref.Revision == "" {
+		return fmt.Errorf("empty revision")
+	}
+	if strings.HasPrefix(ref.Revision, "-") {
+		return fmt.Errorf("revision '%s' must not start with '-'", ref.Revision)
+	}
+	return nil
+}
+
+/*
+GitObject is a signed git commit or tag, which implements Metadata, so that it
+can serve as evidence of a step, see GitReference.  ID is the object id, Type
+is "commit" or "tag" and Raw the object as stored by git.  Payload is the part
+of the object that is signed and Signature the armored signature, created with
+an SSH key, a GPG key or, e.g. by gitsign, an X.509 certificate.  Git objects
+are signed with git, hence Sign always fails.
+*/
+type GitObject struct {
+	ID        string
+	Type      string
+	Raw       []byte
+	Payload   []byte
+	Signature string
+	link      Link
+	sigs      []Signature
+}
+
+/*
+ParseGitObject parses the passed raw git commit or tag, as printed by
+'git cat-file <type> <object>', and separates its signature from the signed
+payload.  It errors if the object is not signed.
+*/
+func ParseGitObject(objectType string, raw []byte) (*GitObject, error) {
+	object := &GitObject{Type: objectType, Raw: raw}
+	switch objectType {
+	case "commit":
+		// Commits carry the signature in a header, whose continuation lines
+		// are indented with a space, see git's signature-format.txt
+		for _, header := range []string{"gpgsig", "gpgsig-sha256"} {
+			object.Payload, object.Signature = splitCommitSignature(raw, header)
+			if object.Signature != "" {
+				break
+			}
+		}
+	case "tag":
+		// Tags carry the signature at the end of the tag message
+		start := -1
+		for _, marker := range []string{gitSSHSignatureArmor, gitGPGSignatureArmor, gitX509SignatureArmor} {
+			if i := bytes.Index(raw, []byte("\n"+marker)); i >= 0 && (start < 0 || i+1 < start) {
+				start = i + 1
+			}
+		}
+		if start >= 0 {
+			object.Payload, object.Signature = raw[:start], string(raw[start:])
+		}
+	default:
+		return nil, fmt.Errorf("%w: git object type '%s'", ErrUnsupportedGitSignature, objectType)
+	}
+	if object.Signature == "" {
+		return nil, fmt.Errorf("%w: git %s is not signed", ErrInvalidGitSignature, objectType)
+	}
+	return object, nil
+}
+
+// splitCommitSignature removes the passed signature header from the headers
+// of the passed raw commit, and returns the remaining commit and the value of
+// the header.
+func splitCommitSignature(raw []byte, header string) ([]byte, string) {
+	headersEnd := bytes.Index(raw, []byte("\n\n"))
+	if headersEnd < 0 {
+		headersEnd = len(raw)
+	} else {
+		headersEnd++
+	}
+	var payload bytes.Buffer
+	var signature strings.Builder
+	inSignature := false
+	for _, line := range bytes.SplitAfter(raw[:headersEnd], []byte("\n")) {
+		switch {
+		case signature.Len() == 0 && bytes.HasPrefix(line, []byte(header+" ")):
+			inSignature = true
+			signature.Write(line[len(header)+1:])
+		case inSignature && bytes.HasPrefix(line, []byte(" ")):
+			signature.Write(line[1:])
+		default:
+			inSignature = false
+			payload.Write(line)
+		}
+	}
+	payload.Write(raw[headersEnd:])
+	return payload.Bytes(), signature.String()
+}
+
+// runGit runs git with the passed arguments in the passed repository and
+// returns its standard output.
+func runGit(ctx context.Context, repoDir string, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", repoDir}, args...)...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+/*
+LoadGitObject loads the signed git commit or tag identified by the passed
+revision from the git repository in repoDir, using the git executable.
+*/
+func LoadGitObject(ctx context.Context, repoDir string, revision string) (*GitObject, error) {
+	if err := validateGitReference(GitReference{Revision: revision}); err != nil {
+		return nil, err
+	}
+	id, err := runGit(ctx, repoDir, "rev-parse", "--verify", revision+"^{object}")
+	if err != nil {
+		return nil, err
+	}
+	objectID := strings.TrimSpace(string(id))
+	objectType, err := runGit(ctx, repoDir, "cat-file", "-t", objectID)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := runGit(ctx, repoDir, "cat-file", strings.TrimSpace(string(objectType)), objectID)
+	if err != nil {
+		return nil, err
+	}
+	object, err := ParseGitObject(strings.TrimSpace(string(objectType)), raw)
+	if err != nil {
+		return nil, fmt.Errorf("git object '%s': %w", revision, err)
+	}
+	object.ID = objectID
+	return object, nil
+}
+
+/*
+gitTreeArtifacts returns the sha256 digests of the files of the passed commit,
+by path relative to the root of the repository.  Symbolic links and
+submodules are skipped.
+*/
+func gitTreeArtifacts(ctx context.Context, repoDir string, commitID string) (map[string]HashObj, error) {
+	tree, err := runGit(ctx, repoDir, "ls-tree", "-r", "-z", "--full-tree", commitID)
+	if err != nil {
+		return nil, err
+	}
+	var ids, paths []string
+	for _, entry := range strings.Split(string(tree), "\x00") {
+		// <mode> SP <type> SP <object> TAB <path>
+		info, path, ok := strings.Cut(entry, "\t")
+		fields := strings.Fields(info)
+		if !ok || len(fields) != 3 || fields[1] != "blob" || fields[0] == "120000" {
+			continue
+		}
+		ids = append(ids, fields[2])
+		paths = append(paths, path)
+	}
+
+	cmd := exec.CommandContext(ctx, "git", "-C", repoDir, "cat-file", "--batch")
+	cmd.Stdin = strings.NewReader(strings.Join(ids, "\n") + "\n")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	artifacts := make(map[string]HashObj, len(paths))
+	reader := bufio.NewReader(stdout)
+	for _, path := range paths {
+		// <object> SP <type> SP <size> LF <contents> LF
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			break
+		}
+		fields := strings.Fields(header)
+		if len(fields) != 3 {
+			err = fmt.Errorf("git cat-file: unexpected output '%s'", strings.TrimSpace(header))
+			_ = cmd.Wait()
+			return nil, err
+		}
+		size, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			_ = cmd.Wait()
+			return nil, err
+		}
+		h := sha256.New()
+		if _, err := io.CopyN(h, reader, size); err != nil {
+			_ = cmd.Wait()
+			return nil, err
+		}
+		if _, err := reader.Discard(1); err != nil {
+			_ = cmd.Wait()
+			return nil, err
+		}
+		artifacts[path] = HashObj{"sha256": hex.EncodeToString(h.Sum(nil))}
+	}
+	if err := cmd.Wait(); err != nil {
+		return nil, fmt.Errorf("git cat-file: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	if len(artifacts) != len(paths) {
+		return nil, fmt.Errorf("git cat-file: read %d of %d files of '%s'", len(artifacts), len(paths), commitID)
+	}
+	return artifacts, nil
+}
+
+/*
+loadGitEvidence loads the git commit or tag referenced by the passed step from
+the git repository in repoDir, and returns it by the key ids of its signers
+among the passed keys, see GitObject.  Its payload is a link of the step,
+whose products are the files of the commit.
+*/
+func loadGitEvidence(ctx context.Context, step Step, keys map[string]Key, repoDir string) (map[string]Metadata, error) {
+	if repoDir == "" {
+		repoDir = "."
+	}
+	object, err := LoadGitObject(ctx, repoDir, step.Git.Revision)
+	if err != nil {
+		return nil, fmt.Errorf("git evidence of step '%s': %w", step.Name, err)
+	}
+	commitID, err := runGit(ctx, repoDir, "rev-parse", "--verify", object.ID+"^{commit}")
+	if err != nil {
+		return nil, fmt.Errorf("git evidence of step '%s': %w", step.Name, err)
+	}
+	products, err := gitTreeArtifacts(ctx, repoDir, strings.TrimSpace(string(commitID)))
+	if err != nil {
+		return nil, fmt.Errorf("git evidence of step '%s': %w", step.Name, err)
+	}
+	object.link = Link{
+		Type:      "link",
+		Name:      step.Name,
+		Materials: map[string]HashObj{},
+		Products:  products,
+		ByProducts: map[string]interface{}{
+			"git-object":      object.ID,
+			"git-object-type": object.Type,
+		},
+		Command:     []string{},
+		Environment: map[string]interface{}{},
+	}
+	object.identifySigners(keys)
+
+	linksPerStep := make(map[string]Metadata)
+	for _, sig := range object.sigs {
+		linksPerStep[sig.KeyID] = object
+	}
+	return linksPerStep, nil
+}
+
+/*
+identifySigners sets the signatures of the git object on which it was called
+to the passed keys that created its signature, without verifying it, see
+VerifySignature.  For GPG keys the key id of a signature is the fingerprint of
+the signing primary key or subkey.  For X.509 signatures it is the id of the
+key of the signing certificate, along with the certificate, so that signers
+can also be authorized by certificate constraints.
+*/
+func (o *GitObject) identifySigners(keys map[string]Key) {
+	o.sigs = nil
+	keyIDs := make([]string, 0, len(keys))
+	for keyID := range keys {
+		keyIDs = append(keyIDs, keyID)
+	}
+	sort.Strings(keyIDs)
+
+	switch {
+	case strings.HasPrefix(o.Signature, gitSSHSignatureArmor):
+		sig, err := parseSSHSignature(o.Signature)
+		if err != nil {
+			return
+		}
+		signer, err := sshCryptoPublicKey(sig.PublicKey)
+		if err != nil {
+			return
+		}
+		for _, keyID := range keyIDs {
+			if key, err := keys[keyID].CryptoPublicKey(); err == nil && publicKeysEqual(key, signer) {
+				o.sigs = append(o.sigs, Signature{KeyID: keyID})
+			}
+		}
+	case strings.HasPrefix(o.Signature, gitGPGSignatureArmor):
+		sig, err := parseGitGPGSignature(o.Signature)
+		if err != nil {
+			return
+		}
+		for _, keyID := range keyIDs {
+			if keys[keyID].KeyType != gpgKeyType {
+				continue
+			}
+			entity, err := parseGPGKey(keys[keyID])
+			if err != nil {
+				continue
+			}
+			if fingerprint := gpgIssuerFingerprint(entity, *sig.IssuerKeyId); fingerprint != "" {
+				o.sigs = append(o.sigs, Signature{KeyID: fingerprint})
+			}
+		}
+	case strings.HasPrefix(o.Signature, gitX509SignatureArmor):
+		cert, err := verifyGitX509Signature(o.Signature, o.Payload)
+		if err != nil {
+			return
+		}
+		certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+		var key Key
+		if err := key.LoadKeyReaderDefaults(bytes.NewReader(certPem)); err != nil {
+			return
+		}
+		o.sigs = append(o.sigs, Signature{KeyID: key.KeyID, Certificate: string(certPem)})
+	}
+}
+
+// Sign fails, git objects are signed with git.
+func (o *GitObject) Sign(key Key) error {
+	return fmt.Errorf("%w: git %s must be signed with git", ErrUnsupportedGitSignature, o.Type)
+}
+
+/*
+VerifySignature verifies the signature of the git object on which it was
+called with the passed key, i.e. its SSH, GPG or, for X.509 signatures, the
+key of its certificate.  Trust in the certificate of an X.509 signature must
+be established separately, e.g. by certificate constraints of a step.
+*/
+func (o *GitObject) VerifySignature(key Key) error {
+	var err error
+	switch {
+	case strings.HasPrefix(o.Signature, gitSSHSignatureArmor):
+		err = verifyGitSSHSignature(key, o.Signature, o.Payload)
+	case strings.HasPrefix(o.Signature, gitGPGSignatureArmor):
+		err = verifyGitGPGSignature(key, o.Signature, o.Payload)
+	case strings.HasPrefix(o.Signature, gitX509SignatureArmor):
+		var cert *x509.Certificate
+		if cert, err = verifyGitX509Signature(o.Signature, o.Payload); err == nil {
+			err = checkSignerKey(key, cert.PublicKey)
+		}
+	default:
+		return ErrUnsupportedGitSignature
+	}
+	if err != nil && !errors.Is(err, ErrInvalidGitSignature) {
+		return fmt.Errorf("%w: %w", ErrInvalidGitSignature, err)
+	}
+	return err
+}
+
+// GetPayload returns the link of the step the git object is evidence of.
+func (o *GitObject) GetPayload() any {
+	return o.link
+}
+
+// Sigs returns the signatures of the git object by the keys of its signers.
+func (o *GitObject) Sigs() []Signature {
+	return o.sigs
+}
+
+// GetSignatureForKeyID returns the signature of the git object by the signer
+// with the passed key id.
+func (o *GitObject) GetSignatureForKeyID(keyID string) (Signature, error) {
+	for _, s := range o.sigs {
+		if s.KeyID == keyID {
+			return s, nil
+		}
+	}
+	return Signature{}, fmt.Errorf("%w for key '%s'", ErrSignatureNotFound, keyID)
+}
+
+// Dump writes the raw git object to the passed path.
+func (o *GitObject) Dump(path string) error {
+	return writeMetadataFile(path, o.Raw, 0644)
+}
+
+// DumpTo writes the raw git object to the passed writer.
+func (o *GitObject) DumpTo(w io.Writer) error {
+	_, err := w.Write(o.Raw)
+	return err
+}
+
+// publicKeysEqual returns true if the passed public keys are equal.
+func publicKeysEqual(a, b crypto.PublicKey) bool {
+	key, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && key.Equal(b)
+}
+
+// checkSignerKey checks that the passed public key of the signer of a git
+// object is the public key of the passed key.
+func checkSignerKey(key Key, signer crypto.PublicKey) error {
+	public, err := key.CryptoPublicKey()
+	if err != nil {
+		return err
+	}
+	if !publicKeysEqual(public, signer) {
+		return fmt.Errorf("%w: signed by another key than '%s'", ErrInvalidGitSignature, key.KeyID)
+	}
+	return nil
+}
+
+// sshSignature is an SSH signature, see the PROTOCOL.sshsig file of OpenSSH.
+type sshSignature struct {
+	Version       uint32
+	PublicKey     []byte
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Signature     []byte
+}
+
+// parseSSHSignature parses the passed armored SSH signature.
+func parseSSHSignature(armored string) (*sshSignature, error) {
+	block, _ := pem.Decode([]byte(armored))
+	if block == nil || block.Type != "SSH SIGNATURE" || !bytes.HasPrefix(block.Bytes, []byte("SSHSIG")) {
+		return nil, fmt.Errorf("%w: malformed ssh signature", ErrInvalidGitSignature)
+	}
+	var sig sshSignature
+	if err := ssh.Unmarshal(block.Bytes[len("SSHSIG"):], &sig); err != nil {
+		return nil, fmt.Errorf("%w: malformed ssh signature: %s", ErrInvalidGitSignature, err)
+	}
+	if sig.Version != 1 {
+		return nil, fmt.Errorf("%w: unsupported ssh signature version %d", ErrInvalidGitSignature, sig.Version)
+	}
+	return &sig, nil
+}
+
+// sshCryptoPublicKey returns the public key of the passed SSH wire format
+// public key.
+func sshCryptoPublicKey(wire []byte) (crypto.PublicKey, error) {
+	public, err := ssh.ParsePublicKey(wire)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidKey, err)
+	}
+	cryptoKey, ok := public.(ssh.CryptoPublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: ssh key type '%s'", ErrUnsupportedKeyType, public.Type())
+	}
+	return cryptoKey.CryptoPublicKey(), nil
+}
+
+// verifyGitSSHSignature verifies the passed armored SSH signature over the
+// passed payload with the passed key, which must have created it.
+func verifyGitSSHSignature(key Key, armored string, payload []byte) error {
+	sig, err := parseSSHSignature(armored)
+	if err != nil {
+		return err
+	}
+	if sig.Namespace != gitSSHNamespace {
+		return fmt.Errorf("%w: ssh signature namespace '%s' is not '%s'", ErrInvalidGitSignature,
+			sig.Namespace, gitSSHNamespace)
+	}
+	public, err := ssh.ParsePublicKey(sig.PublicKey)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidGitSignature, err)
+	}
+	signer, err := sshCryptoPublicKey(sig.PublicKey)
+	if err != nil {
+		return err
+	}
+	if err := checkSignerKey(key, signer); err != nil {
+		return err
+	}
+
+	var digest []byte
+	switch sig.HashAlgorithm {
+	case "sha256":
+		sum := sha256.Sum256(payload)
+		digest = sum[:]
+	case "sha512":
+		sum := sha512.Sum512(payload)
+		digest = sum[:]
+	default:
+		return fmt.Errorf("%w: unsupported ssh signature hash '%s'", ErrInvalidGitSignature, sig.HashAlgorithm)
+	}
+	// The signature covers the magic preamble, the namespace, the hash
+	// algorithm and the digest of the payload
+	signed := append([]byte("SSHSIG"), ssh.Marshal(struct {
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Hash          []byte
+	}{sig.Namespace, sig.Reserved, sig.HashAlgorithm, digest})...)
+	var signature ssh.Signature
+	if err := ssh.Unmarshal(sig.Signature, &signature); err != nil {
+		return fmt.Errorf("%w: malformed ssh signature: %s", ErrInvalidGitSignature, err)
+	}
+	if err := public.Verify(signed, &signature); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidGitSignature, err)
+	}
+	return nil
+}
+
+// parseGitGPGSignature parses the passed armored OpenPGP signature, which
+// must be a v4 binary signature with an issuer.
+func parseGitGPGSignature(armored string) (*packet.Signature, error) {
+	block, err := armor.Decode(strings.NewReader(armored))
+	if err != nil || block.Type != openpgp.SignatureType {
+		return nil, fmt.Errorf("%w: malformed gpg signature", ErrInvalidGitSignature)
+	}
+	p, err := packet.Read(block.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed gpg signature: %s", ErrInvalidGitSignature, err)
+	}
+	sig, ok := p.(*packet.Signature)
+	if !ok || sig.IssuerKeyId == nil || sig.SigType != packet.SigTypeBinary {
+		return nil, fmt.Errorf("%w: unsupported gpg signature", ErrInvalidGitSignature)
+	}
+	return sig, nil
+}
+
+// gpgIssuerFingerprint returns the fingerprint of the primary key or subkey
+// of the passed entity with the passed 64-bit key id, or an empty string.
+func gpgIssuerFingerprint(entity *openpgp.Entity, issuer uint64) string {
+	if entity.PrimaryKey.KeyId == issuer {
+		return hex.EncodeToString(entity.PrimaryKey.Fingerprint[:])
+	}
+	for _, subkey := range entity.Subkeys {
+		if subkey.PublicKey.KeyId == issuer {
+			return hex.EncodeToString(subkey.PublicKey.Fingerprint[:])
+		}
+	}
+	return ""
+}
+
+// verifyGitGPGSignature verifies the passed armored OpenPGP signature over
+// the passed payload with the passed GPG key, or one of its signing subkeys.
+func verifyGitGPGSignature(key Key, armored string, payload []byte) error {
+	if key.KeyType != gpgKeyType {
+		return fmt.Errorf("%w: gpg signature, but key '%s' is not a gpg key", ErrInvalidGitSignature, key.KeyID)
+	}
+	sig, err := parseGitGPGSignature(armored)
+	if err != nil {
+		return err
+	}
+	entity, err := parseGPGKey(key)
+	if err != nil {
+		return err
+	}
+	fingerprint := gpgIssuerFingerprint(entity, *sig.IssuerKeyId)
+	if fingerprint == "" {
+		return fmt.Errorf("%w: signed by another key than '%s'", ErrInvalidGitSignature, key.KeyID)
+	}
+	publicKey, err := gpgSigningKey(entity, fingerprint, time.Now())
+	if err != nil {
+		return err
+	}
+	supported := false
+	for _, hash := range gpgHashes {
+		supported = supported || hash == sig.Hash
+	}
+	if !supported {
+		return fmt.Errorf("%w: unsupported gpg signature hash %s", ErrInvalidGitSignature, sig.Hash)
+	}
+	h := sig.Hash.New()
+	h.Write(payload)
+	if err := publicKey.VerifySignature(h, sig); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidGitSignature, err)
+	}
+	return nil
+}
+
+// verifyGitX509Signature verifies the passed armored CMS signature, e.g. as
+// created by gitsign, over the passed payload, and returns the certificate of
+// the signer.
+func verifyGitX509Signature(armored string, payload []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(armored))
+	if block == nil || block.Type != "SIGNED MESSAGE" {
+		return nil, fmt.Errorf("%w: malformed x509 signature", ErrInvalidGitSignature)
+	}
+	cert, err := verifyCMSDetachedSignature(block.Bytes, payload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidGitSignature, err)
+	}
+	return cert, nil
+}
@@ -0,0 +1,335 @@
+package in_toto
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+// sshSignGit returns the armored SSH signature of the passed payload in the
+// git namespace, like ssh-keygen -Y sign.
+func sshSignGit(t *testing.T, signer ssh.Signer, payload []byte) string {
+	digest := sha512.Sum512(payload)
+	signed := append([]byte("SSHSIG"), ssh.Marshal(struct {
+		Namespace, Reserved, HashAlgorithm string
+		Hash                               []byte
+	}{gitSSHNamespace, "", "sha512", digest[:]})...)
+	sig, err := signer.Sign(rand.Reader, signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob := append([]byte("SSHSIG"), ssh.Marshal(sshSignature{
+		Version:       1,
+		PublicKey:     signer.PublicKey().Marshal(),
+		Namespace:     gitSSHNamespace,
+		HashAlgorithm: "sha512",
+		Signature:     ssh.Marshal(sig),
+	})...)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "SSH SIGNATURE", Bytes: blob}))
+}
+
+// cmsSignGit returns the armored detached CMS signature of the passed payload
+// with signed attributes, like gitsign.
+func cmsSignGit(t *testing.T, cert *x509.Certificate, key *rsa.PrivateKey, payload []byte) string {
+	type attribute struct {
+		Type   asn1.ObjectIdentifier
+		Values asn1.RawValue
+	}
+	set := func(value interface{}) asn1.RawValue {
+		der, err := asn1.Marshal(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: der}
+	}
+	digest := sha256.Sum256(payload)
+	attrs, err := asn1.MarshalWithParams([]attribute{
+		{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}, set(oidCMSData)},
+		{oidCMSMessageDigest, set(digest[:])},
+	}, "set")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signedDigest := sha256.Sum256(attrs)
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, signedDigest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sid, err := asn1.Marshal(cmsIssuerAndSerialNumber{Issuer: asn1.RawValue{FullBytes: cert.RawIssuer},
+		SerialNumber: cert.SerialNumber})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var attrsSet asn1.RawValue
+	if _, err := asn1.Unmarshal(attrs, &attrsSet); err != nil {
+		t.Fatal(err)
+	}
+
+	sha256ID := pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}}
+	signedData, err := asn1.Marshal(struct {
+		Version          int
+		DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+		EncapContentInfo struct{ EContentType asn1.ObjectIdentifier }
+		Certificates     asn1.RawValue
+		SignerInfos      []struct {
+			Version            int
+			SID                asn1.RawValue
+			DigestAlgorithm    pkix.AlgorithmIdentifier
+			SignedAttrs        asn1.RawValue
+			SignatureAlgorithm pkix.AlgorithmIdentifier
+			Signature          []byte
+		} `asn1:"set"`
+	}{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{sha256ID},
+		EncapContentInfo: struct{ EContentType asn1.ObjectIdentifier }{oidCMSData},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: cert.Raw},
+		SignerInfos: []struct {
+			Version            int
+			SID                asn1.RawValue
+			DigestAlgorithm    pkix.AlgorithmIdentifier
+			SignedAttrs        asn1.RawValue
+			SignatureAlgorithm pkix.AlgorithmIdentifier
+			Signature          []byte
+		}{{
+			Version:         1,
+			SID:             asn1.RawValue{FullBytes: sid},
+			DigestAlgorithm: sha256ID,
+			SignedAttrs: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true,
+				Bytes: attrsSet.Bytes},
+			SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}},
+			Signature:          signature,
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	contentInfo, err := asn1.Marshal(struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue
+	}{oidCMSSignedData, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: signedData}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "SIGNED MESSAGE", Bytes: contentInfo}))
+}
+
+// signedCommit returns a raw commit of the passed tree, signed in the gpgsig
+// header by the passed function.
+func signedCommit(tree string, sign func(payload []byte) string) []byte {
+	headers := "tree " + tree + "\n" +
+		"author Alice <alice@example.com> 1700000000 +0000\n" +
+		"committer Alice <alice@example.com> 1700000000 +0000\n"
+	message := "\nAdd foo\n"
+	signature := sign([]byte(headers + message))
+	return []byte(headers + "gpgsig " + strings.ReplaceAll(strings.TrimSuffix(signature, "\n"), "\n", "\n ") +
+		"\n" + message)
+}
+
+// writeGitObject writes the passed raw object to the git repository in the
+// passed directory and returns its id.
+func writeGitObject(t *testing.T, dir string, objectType string, raw []byte) string {
+	cmd := exec.Command("git", "-C", dir, "hash-object", "-t", objectType, "-w", "--stdin")
+	cmd.Stdin = bytes.NewReader(raw)
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func TestParseGitObject(t *testing.T) {
+	object, err := ParseGitObject("commit", signedCommit("4b825dc642cb6eb9a060e54bf8d69288fbee4904",
+		func([]byte) string { return "-----BEGIN SSH SIGNATURE-----\nabc\n-----END SSH SIGNATURE-----\n" }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "-----BEGIN SSH SIGNATURE-----\nabc\n-----END SSH SIGNATURE-----\n", object.Signature)
+	assert.Equal(t, "tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n"+
+		"author Alice <alice@example.com> 1700000000 +0000\n"+
+		"committer Alice <alice@example.com> 1700000000 +0000\n\nAdd foo\n", string(object.Payload))
+
+	tag := "object 4b825dc642cb6eb9a060e54bf8d69288fbee4904\ntype commit\ntag v1\n\nRelease\n"
+	object, err = ParseGitObject("tag", []byte(tag+"-----BEGIN PGP SIGNATURE-----\nabc\n-----END PGP SIGNATURE-----\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, tag, string(object.Payload))
+	assert.True(t, strings.HasPrefix(object.Signature, gitGPGSignatureArmor))
+
+	_, err = ParseGitObject("commit", []byte("tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n\nUnsigned\n"))
+	assert.ErrorIs(t, err, ErrInvalidGitSignature)
+	_, err = ParseGitObject("blob", []byte("foo"))
+	assert.ErrorIs(t, err, ErrUnsupportedGitSignature)
+}
+
+func TestGitEvidence(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	pemBytes, err := os.ReadFile("carol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(pemBytes)
+	carolPrivate, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	carolSigner, err := ssh.NewSignerFromKey(carolPrivate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherSigner, err := ssh.NewSignerFromKey(otherPrivate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var alice, alicePub, carol Key
+	if err := alice.LoadKeyDefaults("alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := alicePub.LoadKeyDefaults("alice.pub"); err != nil {
+		t.Fatal(err)
+	}
+	if err := carol.LoadKey("carol.pub", "ed25519", []string{"sha256", "sha512"}); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	ctx := context.Background()
+	if _, err := runGit(ctx, ".", "init", "-q", dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "foo.py"), []byte("print('foo')\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runGit(ctx, dir, "add", "foo.py"); err != nil {
+		t.Fatal(err)
+	}
+	tree, err := runGit(ctx, dir, "write-tree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signWith := func(signer ssh.Signer) func([]byte) string {
+		return func(payload []byte) string { return sshSignGit(t, signer, payload) }
+	}
+	commit := writeGitObject(t, dir, "commit", signedCommit(strings.TrimSpace(string(tree)), signWith(carolSigner)))
+	otherCommit := writeGitObject(t, dir, "commit", signedCommit(strings.TrimSpace(string(tree)), signWith(otherSigner)))
+	tagPayload := "object " + commit + "\ntype commit\ntag v1\n" +
+		"tagger Alice <alice@example.com> 1700000000 +0000\n\nRelease\n"
+	tag := writeGitObject(t, dir, "tag", []byte(tagPayload+sshSignGit(t, carolSigner, []byte(tagPayload))))
+
+	layout, err := NewLayout().
+		Expires(time.Now().AddDate(0, 1, 0)).
+		AddFunctionary(carol).
+		AddStep("clone").
+		Functionaries(carol.KeyID).
+		ExpectedProducts([]string{"CREATE", "foo.py"}, []string{"DISALLOW", "*"}).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	layout.Steps[0].Git = &GitReference{Revision: "{REVISION}"}
+	layoutMb := &Metablock{Signed: layout}
+	if err := layoutMb.Sign(alice); err != nil {
+		t.Fatal(err)
+	}
+	layoutKeys := map[string]Key{alicePub.KeyID: alicePub}
+
+	for _, revision := range []string{commit, tag} {
+		summary, err := Verify(layoutMb, layoutKeys, ".", WithGitRepository(dir),
+			WithParameters(map[string]string{"REVISION": revision}))
+		if err != nil {
+			t.Fatalf("verify git revision '%s': %s", revision, err)
+		}
+		assert.Contains(t, summary.GetPayload().(Link).Products, "foo.py")
+	}
+
+	// Commits signed by other keys are no evidence of the step
+	_, err = Verify(layoutMb, layoutKeys, ".", WithGitRepository(dir),
+		WithParameters(map[string]string{"REVISION": otherCommit}))
+	assert.ErrorIs(t, err, ErrMissingEvidence)
+
+	object, err := LoadGitObject(ctx, dir, otherCommit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.ErrorIs(t, object.VerifySignature(carol), ErrInvalidGitSignature)
+	assert.NotNil(t, object.Sign(carol))
+}
+
+func TestGitX509Signature(t *testing.T) {
+	certPem, err := os.ReadFile("example.com.write-code.cert.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPem, err := os.ReadFile("example.com.write-code.key.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	certBlock, _ := pem.Decode(certPem)
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyBlock, _ := pem.Decode(keyPem)
+	private, err := x509.ParsePKCS1PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var certKey, carol Key
+	if err := certKey.LoadKeyReaderDefaults(bytes.NewReader(certPem)); err != nil {
+		t.Fatal(err)
+	}
+	if err := carol.LoadKey("carol.pub", "ed25519", []string{"sha256", "sha512"}); err != nil {
+		t.Fatal(err)
+	}
+
+	raw := signedCommit("4b825dc642cb6eb9a060e54bf8d69288fbee4904",
+		func(payload []byte) string { return cmsSignGit(t, cert, private, payload) })
+	object, err := ParseGitObject("commit", raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, object.VerifySignature(certKey))
+	assert.ErrorIs(t, object.VerifySignature(carol), ErrInvalidGitSignature)
+
+	// The signer is identified by its certificate
+	object.identifySigners(nil)
+	if assert.Len(t, object.Sigs(), 1) {
+		assert.Equal(t, certKey.KeyID, object.Sigs()[0].KeyID)
+		signer, err := object.Sigs()[0].GetCertificate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Nil(t, object.VerifySignature(signer))
+	}
+
+	// A tampered payload does not verify
+	object.Payload = append(object.Payload, '!')
+	err = object.VerifySignature(certKey)
+	assert.True(t, errors.Is(err, ErrInvalidGitSignature), "unexpected error: %v", err)
+}
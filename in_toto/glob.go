@@ -0,0 +1,273 @@
+package in_toto
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/shibumi/go-pathspec"
+)
+
+// ErrUnknownPatternSyntax is returned when no PatternMatcher is registered
+// for a pattern syntax.
+var ErrUnknownPatternSyntax = errors.New("unknown pattern syntax")
+
+const (
+	// PatternSyntaxFnmatch matches patterns like Python's fnmatch, i.e. '*'
+	// and '?' also match '/', and '[...]' and '[!...]' match character
+	// classes.  It is the default syntax of artifact rules.
+	PatternSyntaxFnmatch = "fnmatch"
+	// PatternSyntaxExtended matches patterns path segment-wise, i.e. '*' and
+	// '?' do not match '/', and '**' matches any number of path segments,
+	// e.g. 'dist/**/*.whl'.  In addition, it expands braces, e.g.
+	// '*.{tar.gz,zip}'.
+	PatternSyntaxExtended = "extended"
+)
+
+/*
+PatternMatcher reports whether an artifact path matches a pattern of a
+pattern syntax, see RegisterPatternSyntax.  Match must return an error for
+malformed patterns, also if the path is empty, so that patterns can be
+validated before they are used.
+*/
+type PatternMatcher interface {
+	Match(pattern, name string) (bool, error)
+}
+
+// PatternMatcherFunc is an adapter to use a function as PatternMatcher.
+type PatternMatcherFunc func(pattern, name string) (bool, error)
+
+// Match calls f(pattern, name).
+func (f PatternMatcherFunc) Match(pattern, name string) (bool, error) {
+	return f(pattern, name)
+}
+
+var (
+	patternMatchersMu sync.RWMutex
+	patternMatchers   = map[string]PatternMatcher{
+		PatternSyntaxFnmatch:  literalPrefixMatcher{PatternMatcherFunc(match)},
+		PatternSyntaxExtended: literalPrefixMatcher{PatternMatcherFunc(matchExtended)},
+	}
+)
+
+// literalPrefixMatcher is a PatternMatcher, whose patterns only match paths
+// starting with their literal prefix, see literalPatternPrefix, which allows
+// to index artifacts by path prefix, see artifactIndex.
+type literalPrefixMatcher struct {
+	PatternMatcherFunc
+}
+
+/*
+RegisterPatternSyntax registers the passed PatternMatcher for the passed
+pattern syntax, replacing the PatternMatcher registered before, if any.
+Passing nil unregisters the syntax.  Layouts select the syntax of their
+artifact rules with Layout.PatternSyntax, and artifact profiles the syntax of
+their exclude patterns with ArtifactProfile.ExcludePatternSyntax.
+*/
+func RegisterPatternSyntax(syntax string, m PatternMatcher) {
+	patternMatchersMu.Lock()
+	defer patternMatchersMu.Unlock()
+	if m == nil {
+		delete(patternMatchers, syntax)
+		return
+	}
+	patternMatchers[syntax] = m
+}
+
+// GetPatternMatcher returns the PatternMatcher registered for the passed
+// pattern syntax, or an ErrUnknownPatternSyntax.
+func GetPatternMatcher(syntax string) (PatternMatcher, error) {
+	patternMatchersMu.RLock()
+	defer patternMatchersMu.RUnlock()
+	m, ok := patternMatchers[syntax]
+	if !ok {
+		return nil, fmt.Errorf("%w: '%s'", ErrUnknownPatternSyntax, syntax)
+	}
+	return m, nil
+}
+
+/*
+matchExtended reports whether name matches the pattern in
+PatternSyntaxExtended.  Braces are expanded first, see expandBraces, and name
+matches if any of the expanded patterns matches.  Each expanded pattern is
+matched segment-wise, where a '**' segment matches any number of segments,
+including none, and all other segments are matched with match.
+*/
+func matchExtended(pattern, name string) (bool, error) {
+	patterns, err := expandBraces(pattern)
+	if err != nil {
+		return false, err
+	}
+	// Check all patterns first, because matching stops at the first match,
+	// and at the first mismatching segment
+	for _, p := range patterns {
+		for _, segment := range strings.Split(p, "/") {
+			if _, err := match(segment, ""); err != nil {
+				return false, err
+			}
+		}
+	}
+	names := strings.Split(name, "/")
+	for _, p := range patterns {
+		if matchSegments(strings.Split(p, "/"), names) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// matchSegments reports whether the passed path segments match the passed
+// pattern segments, see matchExtended.  The pattern segments must be valid.
+func matchSegments(patterns, names []string) bool {
+	for len(patterns) > 0 {
+		if patterns[0] == "**" {
+			for i := 0; i <= len(names); i++ {
+				if matchSegments(patterns[1:], names[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(names) == 0 {
+			return false
+		}
+		if matched, _ := match(patterns[0], names[0]); !matched {
+			return false
+		}
+		patterns, names = patterns[1:], names[1:]
+	}
+	return len(names) == 0
+}
+
+/*
+expandBraces returns the patterns the braces in the passed pattern expand to,
+e.g. 'a.{tar.gz,zip}' expands to 'a.tar.gz' and 'a.zip'.  Braces may be
+nested, and are literal if escaped with a backslash, or inside a character
+class.  Unbalanced braces are an errBadPattern.
+*/
+func expandBraces(pattern string) ([]string, error) {
+	start := -1
+	depth := 0
+	inClass := false
+	var commas []int
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '\\':
+			i++
+		case inClass:
+			if c == ']' {
+				inClass = false
+			}
+		case c == '[':
+			inClass = true
+			// A leading ']' is part of the class
+			if i+1 < len(pattern) && pattern[i+1] == ']' {
+				i++
+			}
+		case c == '{':
+			if depth == 0 {
+				start = i
+			}
+			depth++
+		case c == ',' && depth == 1:
+			commas = append(commas, i)
+		case c == '}':
+			if depth == 0 {
+				return nil, errBadPattern
+			}
+			depth--
+			if depth > 0 {
+				continue
+			}
+			prefix, suffix := pattern[:start], pattern[i+1:]
+			bounds := append(append([]int{start}, commas...), i)
+			var patterns []string
+			for j := 0; j < len(bounds)-1; j++ {
+				expanded, err := expandBraces(prefix + pattern[bounds[j]+1:bounds[j+1]] + suffix)
+				if err != nil {
+					return nil, err
+				}
+				patterns = append(patterns, expanded...)
+			}
+			return patterns, nil
+		}
+	}
+	if depth > 0 {
+		return nil, errBadPattern
+	}
+	return []string{pattern}, nil
+}
+
+/*
+isExcluded reports whether the passed path matches any of the passed exclude
+patterns of the passed syntax.  Without syntax, the patterns are matched with
+gitignore semantics.  Otherwise, they are matched against the slash-separated
+path with the PatternMatcher registered for the syntax.
+*/
+func isExcluded(syntax string, patterns []string, path string) (bool, error) {
+	if syntax == "" {
+		return pathspec.GitIgnore(patterns, path)
+	}
+	m, err := GetPatternMatcher(syntax)
+	if err != nil {
+		return false, err
+	}
+	name := filepath.ToSlash(filepath.Clean(path))
+	for _, pattern := range patterns {
+		matched, err := m.Match(pattern, name)
+		if err != nil {
+			return false, fmt.Errorf("invalid exclude pattern '%s': %w", pattern, err)
+		}
+		if matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// artifactMatcher matches artifact rule patterns against artifact paths,
+// with the pattern syntax and case sensitivity of a layout.  The zero value
+// matches with PatternSyntaxFnmatch, case-sensitively.
+type artifactMatcher struct {
+	matcher         PatternMatcher
+	caseInsensitive bool
+}
+
+// newArtifactMatcher returns the artifactMatcher for the artifact rules of
+// the passed layout, see Layout.GetPatternSyntax and
+// Layout.GetArtifactMatching.
+func newArtifactMatcher(layout Layout) (artifactMatcher, error) {
+	m, err := GetPatternMatcher(layout.GetPatternSyntax())
+	if err != nil {
+		return artifactMatcher{}, err
+	}
+	return artifactMatcher{
+		matcher:         m,
+		caseInsensitive: layout.GetArtifactMatching() == ArtifactMatchingCaseInsensitive,
+	}, nil
+}
+
+// matchesLiteralPrefix reports whether patterns only match artifact paths
+// starting with their literal prefix, see literalPrefixMatcher.
+func (m artifactMatcher) matchesLiteralPrefix() bool {
+	if m.matcher == nil {
+		return true
+	}
+	_, ok := m.matcher.(literalPrefixMatcher)
+	return ok
+}
+
+// match reports whether the artifact name matches the pattern.  If the
+// matcher is case-insensitive, pattern and name are compared in lower case.
+func (m artifactMatcher) match(pattern, name string) (bool, error) {
+	matcher := m.matcher
+	if matcher == nil {
+		matcher = PatternMatcherFunc(match)
+	}
+	if m.caseInsensitive {
+		return matcher.Match(strings.ToLower(pattern), strings.ToLower(name))
+	}
+	return matcher.Match(pattern, name)
+}
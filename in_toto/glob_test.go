@@ -0,0 +1,128 @@
+package in_toto
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchExtended(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		match         bool
+		err           error
+	}{
+		{"dist/**", "dist/a/b.whl", true, nil},
+		{"dist/**", "dist", true, nil},
+		{"dist/**/*.whl", "dist/b.whl", true, nil},
+		{"dist/**/*.whl", "dist/a/b/c.whl", true, nil},
+		{"dist/**/*.whl", "dist/a/b/c.tar.gz", false, nil},
+		{"**/*.pub", "a/b/c.pub", true, nil},
+		{"*.pub", "a/b.pub", false, nil},
+		{"*.pub", "b.pub", true, nil},
+		{"?.go", "a/.go", false, nil},
+		{"*.{tar.gz,zip}", "app.zip", true, nil},
+		{"*.{tar.gz,zip}", "app.tar.gz", true, nil},
+		{"*.{tar.gz,zip}", "app.tar", false, nil},
+		{"{bin,lib/{x,y}}/*", "lib/y/z", true, nil},
+		{"{bin,lib/{x,y}}/*", "lib/z/z", false, nil},
+		{"{a,}b", "b", true, nil},
+		{`\{a,b\}`, "{a,b}", true, nil},
+		{"[{]a", "{a", true, nil},
+		{"v[0-9].[!0-9]", "v1.x", true, nil},
+		{"v[0-9].[!0-9]", "v1.2", false, nil},
+		{"{a,b", "a", false, errBadPattern},
+		{"a}", "a}", false, errBadPattern},
+		{"a/[", "b/c", false, errBadPattern},
+	}
+	for _, tt := range tests {
+		matched, err := matchExtended(tt.pattern, tt.name)
+		assert.Equal(t, tt.match, matched, "%s %s", tt.pattern, tt.name)
+		assert.Equal(t, tt.err, err, "%s %s", tt.pattern, tt.name)
+	}
+}
+
+func TestPatternSyntaxRegistry(t *testing.T) {
+	m, err := GetPatternMatcher(PatternSyntaxFnmatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// fnmatch semantics: '*' matches '/', '[!...]' is negated
+	matched, err := m.Match("*.pub", "a/b.pub")
+	assert.True(t, matched)
+	assert.Nil(t, err)
+	matched, _ = m.Match("[!a]", "!")
+	assert.True(t, matched)
+
+	_, err = GetPatternMatcher("regex")
+	assert.ErrorIs(t, err, ErrUnknownPatternSyntax)
+
+	RegisterPatternSyntax("exact", PatternMatcherFunc(func(pattern, name string) (bool, error) {
+		return pattern == name, nil
+	}))
+	defer RegisterPatternSyntax("exact", nil)
+
+	layout := Layout{PatternSyntax: "exact", ArtifactMatching: ArtifactMatchingCaseInsensitive}
+	matcher, err := newArtifactMatcher(layout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, Set{"FOO*": {}}, Set{"FOO*": {}, "foo": {}}.filter("foo*", matcher))
+
+	layout.PatternSyntax = "regex"
+	assert.ErrorIs(t, validateLayout(layout), ErrUnknownPatternSyntax)
+	assert.ErrorIs(t, validateArtifactProfile("p", ArtifactProfile{ExcludePatternSyntax: "regex"}),
+		ErrUnknownPatternSyntax)
+}
+
+func TestVerifyArtifactsPatternSyntax(t *testing.T) {
+	digest := HashObj{"sha256": "aa"}
+	items := []interface{}{Step{SupplyChainItem: SupplyChainItem{
+		Name:             "build",
+		ExpectedProducts: [][]string{{"ALLOW", "dist/**/*.{whl,tar.gz}"}, {"DISALLOW", "*"}},
+	}}}
+	itemsMetadata := map[string]Metadata{"build": &Metablock{Signed: Link{
+		Name:     "build",
+		Products: map[string]HashObj{"dist/app.whl": digest, "dist/src/app.tar.gz": digest},
+	}}}
+
+	layout := Layout{PatternSyntax: PatternSyntaxExtended}
+	matcher, err := newArtifactMatcher(layout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, verifyArtifacts(context.Background(), items, itemsMetadata, matcher, nil, nil))
+	// Braces are literal in the default syntax
+	assert.NotNil(t, verifyArtifacts(context.Background(), items, itemsMetadata, artifactMatcher{}, nil, nil))
+}
+
+func TestRecordArtifactsExcludePatternSyntax(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.go", "a.pub", "sub/b.go", "sub/b.pub", "sub/c.key"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	profile := ArtifactProfile{
+		ExcludePatterns:      []string{"**/*.{pub,key}"},
+		ExcludePatternSyntax: PatternSyntaxExtended,
+		LStripPaths:          []string{dir + "/"},
+	}
+	artifacts, err := profile.RecordArtifacts([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.ElementsMatch(t, []string{"a.go", "sub/b.go"}, artifactsDictKeyStrings(artifacts))
+
+	profile.ExcludePatternSyntax = "regex"
+	_, err = profile.RecordArtifacts([]string{dir})
+	assert.ErrorIs(t, err, ErrUnknownPatternSyntax)
+}
@@ -0,0 +1,285 @@
+package in_toto
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/shibumi/go-pathspec"
+)
+
+// ErrMissingModuleSum is returned when a vendored Go module has no hash in
+// the go.sum file of the main module.
+var ErrMissingModuleSum = errors.New("missing go.sum entry of vendored module")
+
+// goVendorModulesFile is the name of the file that lists the vendored modules
+// and packages in a Go vendor directory.
+const goVendorModulesFile = "modules.txt"
+
+// vendoredModule is a module listed in the modules.txt file of a Go vendor
+// directory.  Replace is the replacement directory of local replacements.
+type vendoredModule struct {
+	Path     string
+	Version  string
+	Replace  string
+	Packages []string
+}
+
+/*
+RecordGoVendor records the Go vendor directory at the passed path by its
+vendored modules, instead of one artifact per vendored file, which cuts the
+size of links of repositories with vendored dependencies by orders of
+magnitude.  The returned artifacts are named relative to the vendor
+directory:
+
+  - "modules.txt" is the list of vendored modules and packages, hashed with
+    the passed hash algorithms like RecordArtifact.
+  - "<module path>@<version>" is a vendored module, e.g.
+    "github.com/spf13/cobra@v1.8.0", whose sha256 digest is its "h1" hash
+    from the go.sum file next to the vendor directory, in hex encoding.  For
+    modules replaced by another module version, the path and version of the
+    replacement are used.
+  - "<module path>/" is a module replaced by a local directory, which has no
+    go.sum entry.  Its vendored package files are hashed with the passed hash
+    algorithms like RecordDirectory.
+
+Modules without vendored packages are left out.  The vendored files of
+modules are not hashed, the digests record which module versions the vendor
+directory claims to contain.  That the vendored files match modules.txt is
+checked by the go command, e.g. with 'go mod vendor' followed by a diff.
+*/
+func RecordGoVendor(vendorDir string, hashAlgorithms []string) (map[string]HashObj, error) {
+	if err := validateHashAlgorithms(hashAlgorithms); err != nil {
+		return nil, err
+	}
+	modulesPath := filepath.Join(vendorDir, goVendorModulesFile)
+	modules, err := parseGoVendorModules(modulesPath)
+	if err != nil {
+		return nil, err
+	}
+
+	artifacts := map[string]HashObj{}
+	artifacts[goVendorModulesFile], err = RecordArtifact(modulesPath, hashAlgorithms, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var sums map[string]string
+	for _, module := range modules {
+		if len(module.Packages) == 0 {
+			continue
+		}
+		var name string
+		var digest HashObj
+		if module.Replace != "" {
+			name = module.Path + "/"
+			digest, err = hashVendoredPackages(vendorDir, module, hashAlgorithms)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			if sums == nil {
+				sums, err = parseGoSum(filepath.Join(filepath.Dir(filepath.Clean(vendorDir)), "go.sum"))
+				if err != nil {
+					return nil, err
+				}
+			}
+			name = module.Path + "@" + module.Version
+			sum, ok := sums[name]
+			if !ok {
+				return nil, fmt.Errorf("%w: %s", ErrMissingModuleSum, name)
+			}
+			digest = HashObj{"sha256": sum}
+		}
+		if _, exists := artifacts[name]; exists {
+			return nil, fmt.Errorf("%w: %s", ErrNonUniqueArtifactName, name)
+		}
+		artifacts[name] = digest
+	}
+	return artifacts, nil
+}
+
+/*
+parseGoVendorModules parses the modules.txt file at the passed path.  Module
+lines have the form
+
+	# <path> <version> [=> <replacement path> [<replacement version>]]
+
+where the version is left out for replacements of all versions, and are
+followed by the vendored packages of the module, one per line.  Lines
+starting with "##" annotate the module and are skipped.
+*/
+func parseGoVendorModules(modulesPath string) ([]vendoredModule, error) {
+	f, err := os.Open(modulesPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var modules []vendoredModule
+	scanner := bufio.NewScanner(f)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "##"):
+			continue
+		case strings.HasPrefix(line, "# "):
+			module, err := parseGoVendorModuleLine(strings.TrimPrefix(line, "# "))
+			if err != nil {
+				return nil, fmt.Errorf("invalid module in %s, line %d: %w", modulesPath, lineNumber, err)
+			}
+			modules = append(modules, module)
+		default:
+			if len(modules) == 0 {
+				return nil, fmt.Errorf("invalid package in %s, line %d: no module", modulesPath, lineNumber)
+			}
+			modules[len(modules)-1].Packages = append(modules[len(modules)-1].Packages, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return modules, nil
+}
+
+// parseGoVendorModuleLine parses a module line of a modules.txt file without
+// its "# " prefix, see parseGoVendorModules.
+func parseGoVendorModuleLine(line string) (vendoredModule, error) {
+	original, replacement, replaced := strings.Cut(line, "=>")
+	fields := strings.Fields(original)
+	if len(fields) < 1 || len(fields) > 2 || (len(fields) == 1 && !replaced) {
+		return vendoredModule{}, fmt.Errorf("'%s'", line)
+	}
+	module := vendoredModule{Path: fields[0]}
+	if len(fields) == 2 {
+		module.Version = fields[1]
+	}
+	if !replaced {
+		return module, nil
+	}
+
+	fields = strings.Fields(replacement)
+	switch {
+	case len(fields) == 1 && (strings.HasPrefix(fields[0], ".") || filepath.IsAbs(fields[0]) || path.IsAbs(fields[0])):
+		module.Replace = fields[0]
+	case len(fields) == 2:
+		// The vendored files are those of the replacement module
+		module.Path, module.Version = fields[0], fields[1]
+	default:
+		return vendoredModule{}, fmt.Errorf("'%s'", line)
+	}
+	return module, nil
+}
+
+/*
+parseGoSum parses the go.sum file at the passed path and returns the "h1"
+hashes of the module contents in hex encoding by "<module path>@<version>".
+Hashes of go.mod files are skipped.
+*/
+func parseGoSum(goSumPath string) (map[string]string, error) {
+	data, err := os.ReadFile(goSumPath)
+	if err != nil {
+		return nil, err
+	}
+	sums := map[string]string{}
+	for i, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("invalid line %d in %s", i+1, goSumPath)
+		}
+		if strings.HasSuffix(fields[1], "/go.mod") || !strings.HasPrefix(fields[2], "h1:") {
+			continue
+		}
+		sum, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(fields[2], "h1:"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid hash in line %d in %s: %w", i+1, goSumPath, err)
+		}
+		sums[fields[0]+"@"+fields[1]] = hex.EncodeToString(sum)
+	}
+	return sums, nil
+}
+
+/*
+hashVendoredPackages hashes the files of the vendored packages of the passed
+module in the passed vendor directory like RecordDirectory, with paths
+relative to the directory of the module.  Only the files directly in the
+package directories are hashed, like the go command vendors them.
+*/
+func hashVendoredPackages(vendorDir string, module vendoredModule, hashAlgorithms []string) (HashObj, error) {
+	moduleDir := filepath.Join(vendorDir, filepath.FromSlash(module.Path))
+	var names []string
+	for _, pkg := range module.Packages {
+		rel := strings.TrimPrefix(strings.TrimPrefix(pkg, module.Path), "/")
+		entries, err := os.ReadDir(filepath.Join(moduleDir, filepath.FromSlash(rel)))
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if entry.Type().IsRegular() {
+				names = append(names, path.Join(rel, entry.Name()))
+			}
+		}
+	}
+	sort.Strings(names)
+	return hashDirectoryFiles(moduleDir, names, hashAlgorithms)
+}
+
+/*
+recordGoVendorArtifacts replaces the directory artifacts in the passed
+artifact paths that match the GoVendorPatterns of the passed profile with the
+artifacts of their vendored modules, see RecordGoVendor.  The artifacts of a
+vendor directory are named after its artifact name, e.g.
+"vendor/github.com/spf13/cobra@v1.8.0" for the directory artifact "vendor/".
+It returns the artifacts of the vendor directories.
+*/
+func recordGoVendorArtifacts(artifactPaths map[string]string, hashAlgorithms []string, profile ArtifactProfile) (map[string]HashObj, error) {
+	artifacts := map[string]HashObj{}
+	if len(profile.GoVendorPatterns) == 0 {
+		return artifacts, nil
+	}
+	for name, artifactPath := range artifactPaths {
+		if !strings.HasSuffix(artifactPath, string(filepath.Separator)) {
+			continue
+		}
+		vendorDir := filepath.Clean(artifactPath)
+		vendored, err := isGoVendorDir(vendorDir, profile.GoVendorPatterns)
+		if err != nil {
+			return nil, err
+		}
+		if !vendored {
+			continue
+		}
+
+		delete(artifactPaths, name)
+		vendorArtifacts, err := RecordGoVendor(vendorDir, hashAlgorithms)
+		if err != nil {
+			return nil, err
+		}
+		prefix := filepath.ToSlash(name)
+		for vendorName, digest := range vendorArtifacts {
+			artifacts[prefix+vendorName] = digest
+		}
+	}
+	return artifacts, nil
+}
+
+// isGoVendorDir reports whether the directory at the passed path matches any
+// of the passed patterns and contains a modules.txt file.
+func isGoVendorDir(dir string, patterns []string) (bool, error) {
+	matched, err := pathspec.GitIgnore(patterns, dir)
+	if err != nil || !matched {
+		return false, err
+	}
+	info, err := os.Stat(filepath.Join(dir, goVendorModulesFile))
+	return err == nil && info.Mode().IsRegular(), nil
+}
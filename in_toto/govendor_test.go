@@ -0,0 +1,121 @@
+package in_toto
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTestGoVendor writes a Go module with a vendor directory to the passed
+// directory.
+func writeTestGoVendor(t *testing.T, dir string, goSum string) {
+	files := map[string]string{
+		"go.mod": "module example.com/main\n",
+		"go.sum": goSum,
+		"vendor/modules.txt": `# github.com/foo/bar v1.2.3
+## explicit; go 1.20
+github.com/foo/bar
+github.com/foo/bar/sub
+# github.com/unused/mod v0.1.0
+## explicit
+# github.com/old/mod v1.0.0 => github.com/new/mod v1.1.0
+## explicit
+github.com/old/mod
+# example.com/local => ./local
+## explicit
+example.com/local
+`,
+		"vendor/github.com/foo/bar/bar.go":     "package bar\n",
+		"vendor/github.com/foo/bar/sub/sub.go": "package sub\n",
+		"vendor/github.com/old/mod/mod.go":     "package mod\n",
+		"vendor/example.com/local/local.go":    "package local\n",
+		"vendor/example.com/local/LICENSE":     "license\n",
+		"main.go":                              "package main\n",
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRecordGoVendor(t *testing.T) {
+	barSum := strings.Repeat("ab", 32)
+	newSum := strings.Repeat("cd", 32)
+	h1 := func(sum string) string {
+		data, _ := hex.DecodeString(sum)
+		return "h1:" + base64.StdEncoding.EncodeToString(data)
+	}
+	goSum := "github.com/foo/bar v1.2.3 " + h1(barSum) + "\n" +
+		"github.com/foo/bar v1.2.3/go.mod " + h1(strings.Repeat("00", 32)) + "\n" +
+		"github.com/new/mod v1.1.0 " + h1(newSum) + "\n"
+
+	dir := t.TempDir()
+	writeTestGoVendor(t, dir, goSum)
+	vendorDir := filepath.Join(dir, "vendor")
+
+	artifacts, err := RecordGoVendor(vendorDir, []string{"sha256"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	local, err := RecordDirectory(filepath.Join(vendorDir, "example.com", "local"), []string{"sha256"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modulesTxt, err := RecordArtifact(filepath.Join(vendorDir, "modules.txt"), []string{"sha256"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, map[string]HashObj{
+		"modules.txt":               modulesTxt,
+		"github.com/foo/bar@v1.2.3": {"sha256": barSum},
+		"github.com/new/mod@v1.1.0": {"sha256": newSum},
+		"example.com/local/":        local,
+	}, artifacts)
+
+	// Vendor directories are recorded by module, if enabled in the profile
+	profile := ArtifactProfile{LStripPaths: []string{dir + "/"}, GoVendorPatterns: []string{"vendor"}}
+	artifacts, err = profile.RecordArtifacts([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, artifacts, "main.go")
+	assert.Contains(t, artifacts, "vendor/modules.txt")
+	assert.Equal(t, HashObj{"sha256": barSum}, artifacts["vendor/github.com/foo/bar@v1.2.3"])
+	assert.NotContains(t, artifacts, "vendor/github.com/foo/bar/bar.go")
+	assert.Len(t, artifacts, 7)
+
+	// Directories without modules.txt are recorded file by file
+	profile.GoVendorPatterns = []string{"github.com"}
+	artifacts, err = profile.RecordArtifacts([]string{vendorDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, artifacts, "vendor/github.com/foo/bar/bar.go")
+
+	// Vendored modules must be listed in go.sum
+	if err := os.WriteFile(filepath.Join(dir, "go.sum"), []byte("github.com/foo/bar v1.2.3 "+h1(barSum)+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = RecordGoVendor(vendorDir, []string{"sha256"})
+	assert.ErrorIs(t, err, ErrMissingModuleSum)
+
+	if err := os.WriteFile(filepath.Join(vendorDir, "modules.txt"), []byte("github.com/foo/bar\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = RecordGoVendor(vendorDir, []string{"sha256"})
+	assert.NotNil(t, err)
+	_, err = RecordGoVendor(dir, []string{"sha256"})
+	assert.True(t, os.IsNotExist(err))
+	_, err = RecordGoVendor(vendorDir, []string{"md5"})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,313 @@
+package in_toto
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/dsa" //nolint:staticcheck
+	"crypto/rsa"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/in-toto/in-toto-golang/in_toto/keys"
+	"golang.org/x/crypto/openpgp"        //nolint:staticcheck
+	"golang.org/x/crypto/openpgp/armor"  //nolint:staticcheck
+	"golang.org/x/crypto/openpgp/packet" //nolint:staticcheck
+)
+
+const (
+	gpgKeyType = "gpg"
+	// gpgRSAScheme and gpgDSAScheme are the signing methods of the
+	// securesystemslib for GPG keys
+	gpgRSAScheme = "pgp+rsa-pkcsv1.5"
+	gpgDSAScheme = "pgp+dsa-fips-180-2"
+)
+
+// ErrInvalidGPGSignature indicates a GPG signature that cannot be verified,
+// e.g. because it is malformed or was not created by the passed key.
+var ErrInvalidGPGSignature = errors.New("invalid gpg signature")
+
+// ErrGPGKeyExpired indicates a GPG signature by an expired or revoked key.
+var ErrGPGKeyExpired = errors.New("gpg key expired or revoked")
+
+/*
+getSupportedGPGSchemes returns a string slice of all supported schemes for
+GPG keys.
+*/
+func getSupportedGPGSchemes() []string {
+	return []string{gpgRSAScheme, gpgDSAScheme}
+}
+
+// GPG keys are supported by the keys package, but their signatures are
+// verified by VerifySignature, because they may be created by subkeys.
+func init() {
+	keys.RegisterKeyType(gpgKeyType, validateGPGKeyVal)
+	for _, scheme := range getSupportedGPGSchemes() {
+		keys.RegisterScheme(gpgKeyType, scheme, nil)
+	}
+}
+
+// validateGPGKeyVal validates the key value of GPG keys, which carry an ASCII
+// armored public key and are only used to verify signatures.
+func validateGPGKeyVal(key Key) error {
+	if _, err := parseGPGKey(key); err != nil {
+		return err
+	}
+	if key.KeyVal.Private != "" {
+		return fmt.Errorf("%w: gpg keys must not carry a private key", ErrInvalidKey)
+	}
+	return nil
+}
+
+/*
+LoadGPGKeys parses the GPG public keys at the passed path, which is either an
+ASCII armored public key block or a binary keyring export, e.g. as created by
+`gpg --export`.  It returns the keys by key ID, which is the lowercase hex
+encoded fingerprint of the primary key, like in the in-toto reference
+implementation.  Signatures by signing subkeys are verified with the key of
+their primary key.  Only RSA and DSA keys are supported.
+*/
+func LoadGPGKeys(path string) (map[string]Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return LoadGPGKeysReader(bytes.NewReader(data))
+}
+
+// LoadGPGKeysReader parses GPG public keys like LoadGPGKeys, but reads them
+// from the passed reader.
+func LoadGPGKeysReader(r io.Reader) (map[string]Key, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var entities openpgp.EntityList
+	if bytes.Contains(data, []byte("-----BEGIN PGP")) {
+		entities, err = openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+	} else {
+		entities, err = openpgp.ReadKeyRing(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse gpg keys: %w", err)
+	}
+
+	keys := make(map[string]Key, len(entities))
+	for _, entity := range entities {
+		key, err := newGPGKey(entity)
+		if err != nil {
+			return nil, err
+		}
+		keys[key.KeyID] = key
+	}
+	return keys, nil
+}
+
+// newGPGKey creates a Key carrying the ASCII armored public key of the passed
+// entity, including its subkeys.
+func newGPGKey(entity *openpgp.Entity) (Key, error) {
+	var scheme string
+	switch entity.PrimaryKey.PubKeyAlgo {
+	case packet.PubKeyAlgoRSA, packet.PubKeyAlgoRSASignOnly:
+		scheme = gpgRSAScheme
+	case packet.PubKeyAlgoDSA:
+		scheme = gpgDSAScheme
+	default:
+		return Key{}, fmt.Errorf("%w: gpg public key algorithm %d", ErrUnsupportedKeyType, entity.PrimaryKey.PubKeyAlgo)
+	}
+
+	var armored bytes.Buffer
+	w, err := armor.Encode(&armored, openpgp.PublicKeyType, nil)
+	if err != nil {
+		return Key{}, err
+	}
+	if err := entity.Serialize(w); err != nil {
+		return Key{}, err
+	}
+	if err := w.Close(); err != nil {
+		return Key{}, err
+	}
+
+	return Key{
+		KeyID:   hex.EncodeToString(entity.PrimaryKey.Fingerprint[:]),
+		KeyType: gpgKeyType,
+		Scheme:  scheme,
+		KeyVal:  KeyVal{Public: armored.String()},
+	}, nil
+}
+
+// parseGPGKey parses the armored public key of the passed GPG key.
+func parseGPGKey(key Key) (*openpgp.Entity, error) {
+	entities, err := openpgp.ReadArmoredKeyRing(strings.NewReader(key.KeyVal.Public))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidKey, err)
+	}
+	if len(entities) != 1 {
+		return nil, fmt.Errorf("%w: expected one gpg key, got %d", ErrInvalidKey, len(entities))
+	}
+	return entities[0], nil
+}
+
+/*
+gpgSigningKey returns the public key of the passed entity with the passed
+fingerprint, i.e. the primary key or a signing subkey.  It errors if the key
+was revoked, or if it or its primary key has expired.
+*/
+func gpgSigningKey(entity *openpgp.Entity, keyID string, now time.Time) (*packet.PublicKey, error) {
+	if len(entity.Revocations) > 0 {
+		return nil, ErrGPGKeyExpired
+	}
+	for _, identity := range entity.Identities {
+		if identity.SelfSignature != nil && identity.SelfSignature.KeyExpired(now) {
+			return nil, ErrGPGKeyExpired
+		}
+	}
+
+	if hex.EncodeToString(entity.PrimaryKey.Fingerprint[:]) == keyID {
+		return entity.PrimaryKey, nil
+	}
+	for _, subkey := range entity.Subkeys {
+		if hex.EncodeToString(subkey.PublicKey.Fingerprint[:]) != keyID {
+			continue
+		}
+		if subkey.Sig.FlagsValid && !subkey.Sig.FlagSign {
+			return nil, fmt.Errorf("%w: subkey '%s' is not a signing key", ErrInvalidGPGSignature, keyID)
+		}
+		if subkey.Sig.RevocationReason != nil || subkey.Sig.KeyExpired(now) {
+			return nil, ErrGPGKeyExpired
+		}
+		return subkey.PublicKey, nil
+	}
+	return nil, fmt.Errorf("%w: signature is from key '%s', which is not part of gpg key '%s'",
+		ErrInvalidGPGSignature, keyID, hex.EncodeToString(entity.PrimaryKey.Fingerprint[:]))
+}
+
+// gpgKeyIDs returns the fingerprints of the primary key and all subkeys of
+// the passed GPG key.
+func gpgKeyIDs(key Key) ([]string, error) {
+	entity, err := parseGPGKey(key)
+	if err != nil {
+		return nil, err
+	}
+	keyIDs := []string{hex.EncodeToString(entity.PrimaryKey.Fingerprint[:])}
+	for _, subkey := range entity.Subkeys {
+		keyIDs = append(keyIDs, hex.EncodeToString(subkey.PublicKey.Fingerprint[:]))
+	}
+	return keyIDs, nil
+}
+
+/*
+keyHasID returns true if the passed key ID identifies the passed key, i.e. if
+it is the ID of the key, or, for GPG keys, the fingerprint of a subkey.
+*/
+func keyHasID(key Key, keyID string) bool {
+	if key.KeyID == keyID {
+		return true
+	}
+	if key.KeyType != gpgKeyType {
+		return false
+	}
+	keyIDs, err := gpgKeyIDs(key)
+	if err != nil {
+		return false
+	}
+	return NewSet(keyIDs...).Has(keyID)
+}
+
+// gpgHashes maps OpenPGP hash algorithm IDs to hash functions.  SHA-1 is
+// deliberately not supported.
+var gpgHashes = map[byte]crypto.Hash{
+	8:  crypto.SHA256,
+	9:  crypto.SHA384,
+	10: crypto.SHA512,
+	11: crypto.SHA224,
+}
+
+/*
+verifyGPGSignature verifies a GPG signature in the format of the
+securesystemslib, i.e. the hex encoded signature value and the hex encoded
+hashed part of the OpenPGP v4 signature packet ("other_headers"), over the
+passed data with the passed GPG key.
+*/
+func verifyGPGSignature(key Key, sig Signature, data []byte) error {
+	entity, err := parseGPGKey(key)
+	if err != nil {
+		return err
+	}
+	publicKey, err := gpgSigningKey(entity, sig.KeyID, time.Now())
+	if err != nil {
+		return err
+	}
+
+	headers, err := hex.DecodeString(sig.OtherHeaders)
+	if err != nil || len(headers) < 6 {
+		return fmt.Errorf("%w: %w", ErrInvalidGPGSignature, malformedSignature("malformed signature headers"))
+	}
+	sigBytes, err := hex.DecodeString(sig.GPGSignature)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidGPGSignature, malformedSignature("signature is not hex encoded"))
+	}
+	if headers[0] != 4 {
+		return fmt.Errorf("%w: unsupported signature version %d", ErrInvalidGPGSignature, headers[0])
+	}
+	if packet.SignatureType(headers[1]) != packet.SigTypeBinary {
+		return fmt.Errorf("%w: unsupported signature type %d", ErrInvalidGPGSignature, headers[1])
+	}
+	hash, ok := gpgHashes[headers[3]]
+	if !ok {
+		return fmt.Errorf("%w: unsupported hash algorithm %d", ErrInvalidGPGSignature, headers[3])
+	}
+
+	// The signed hash covers the data, the hashed part of the signature packet
+	// and a trailer with the length of the latter, see RFC 4880, 5.2.4
+	h := hash.New()
+	h.Write(data)
+	h.Write(headers)
+	trailer := []byte{4, 0xff, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(trailer[2:], uint32(len(headers)))
+	h.Write(trailer)
+	digest := h.Sum(nil)
+
+	switch pub := publicKey.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if packet.PublicKeyAlgorithm(headers[2]) != packet.PubKeyAlgoRSA &&
+			packet.PublicKeyAlgorithm(headers[2]) != packet.PubKeyAlgoRSASignOnly {
+			return fmt.Errorf("%w: signature algorithm does not match key", ErrInvalidGPGSignature)
+		}
+		// Leading zeros of the signature value are not encoded
+		keySize := (pub.N.BitLen() + 7) / 8
+		if len(sigBytes) < keySize {
+			sigBytes = append(make([]byte, keySize-len(sigBytes)), sigBytes...)
+		}
+		if err := rsa.VerifyPKCS1v15(pub, hash, digest, sigBytes); err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidGPGSignature, err)
+		}
+	case *dsa.PublicKey:
+		if packet.PublicKeyAlgorithm(headers[2]) != packet.PubKeyAlgoDSA {
+			return fmt.Errorf("%w: signature algorithm does not match key", ErrInvalidGPGSignature)
+		}
+		// DSA signatures are DER encoded and the digest is truncated to the
+		// size of the subgroup
+		var rs struct{ R, S *big.Int }
+		if _, err := asn1.Unmarshal(sigBytes, &rs); err != nil {
+			return fmt.Errorf("%w: malformed dsa signature", ErrInvalidGPGSignature)
+		}
+		if subgroupSize := (pub.Q.BitLen() + 7) / 8; len(digest) > subgroupSize {
+			digest = digest[:subgroupSize]
+		}
+		if !dsa.Verify(pub, digest, rs.R, rs.S) { //nolint:staticcheck
+			return ErrInvalidGPGSignature
+		}
+	default:
+		return fmt.Errorf("%w: gpg public key algorithm %d", ErrUnsupportedKeyType, publicKey.PubKeyAlgo)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package in_toto
+
+import (
+	"testing"
+	"time"
+
+	"github.com/in-toto/in-toto-golang/in_toto/keys"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	gpgRSAKeyID    = "80b7c74115bde4990ec392b681a26fe98c8936aa"
+	gpgRSASubkeyID = "0f8ef343b196c4bd77a429815ae2a6ab7f387b95"
+	gpgDSAKeyID    = "f554df4fc3607e358cddcc7416dcaa327d694984"
+)
+
+func TestLoadGPGKeys(t *testing.T) {
+	gpgKeys, err := LoadGPGKeys("gpg-rsa.asc")
+	assert.Nil(t, err)
+	assert.Len(t, gpgKeys, 1)
+	key := gpgKeys[gpgRSAKeyID]
+	assert.Equal(t, gpgKeyType, key.KeyType)
+	assert.Equal(t, gpgRSAScheme, key.Scheme)
+	assert.Nil(t, keys.ValidatePublicKey(key))
+	assert.Nil(t, keys.ValidateKeyVal(key))
+	assert.True(t, keyHasID(key, gpgRSASubkeyID))
+	assert.False(t, keyHasID(key, gpgDSAKeyID))
+
+	gpgKeys, err = LoadGPGKeys("gpg-keyring.gpg")
+	assert.Nil(t, err)
+	assert.Len(t, gpgKeys, 2)
+	assert.Equal(t, key, gpgKeys[gpgRSAKeyID])
+	assert.Equal(t, gpgDSAScheme, gpgKeys[gpgDSAKeyID].Scheme)
+
+	_, err = LoadGPGKeys("alice.pub")
+	assert.NotNil(t, err)
+	_, err = LoadGPGKeys("does-not-exist")
+	assert.NotNil(t, err)
+}
+
+func TestVerifyGPGSignature(t *testing.T) {
+	keys, err := LoadGPGKeys("gpg-keyring.gpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		linkPath string
+		keyID    string
+	}{
+		{"build.0f8ef343.link", gpgRSAKeyID},
+		{"build.f554df4f.link", gpgDSAKeyID},
+	} {
+		linkEnv, err := LoadMetadata(test.linkPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Nil(t, ValidateMetablock(*linkEnv.(*Metablock)), test.linkPath)
+		assert.Nil(t, linkEnv.VerifySignature(keys[test.keyID]), test.linkPath)
+
+		// Signatures by other keys are not found
+		for keyID, key := range keys {
+			if keyID != test.keyID {
+				assert.NotNil(t, linkEnv.VerifySignature(key), test.linkPath)
+			}
+		}
+
+		// Tampered payload
+		link := linkEnv.GetPayload().(Link)
+		link.Name = "tampered"
+		mb := &Metablock{Signed: link, Signatures: linkEnv.Sigs()}
+		assert.ErrorIs(t, mb.VerifySignature(keys[test.keyID]), ErrInvalidGPGSignature, test.linkPath)
+	}
+
+	// Signature with SHA-1 is rejected
+	linkEnv, err := LoadMetadata("build.0f8ef343.link")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := linkEnv.Sigs()[0]
+	sig.OtherHeaders = sig.OtherHeaders[:6] + "02" + sig.OtherHeaders[8:]
+	payload, _ := linkEnv.(*Metablock).GetSignableRepresentation()
+	assert.ErrorIs(t, VerifySignature(keys[gpgRSAKeyID], sig, payload), ErrInvalidGPGSignature)
+}
+
+func TestInTotoVerifyGPG(t *testing.T) {
+	var layoutKey, layoutPubKey Key
+	if err := layoutKey.LoadKeyDefaults("alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := layoutPubKey.LoadKeyDefaults("alice.pub"); err != nil {
+		t.Fatal(err)
+	}
+	gpgKeys, err := LoadGPGKeys("gpg-keyring.gpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	layout := Layout{
+		Type:    "layout",
+		Expires: time.Now().Add(time.Hour).UTC().Format(ISO8601DateSchema),
+		Keys:    gpgKeys,
+		Steps: []Step{
+			{
+				SupplyChainItem: SupplyChainItem{Name: "build"},
+				PubKeys:         []string{gpgRSAKeyID, gpgDSAKeyID},
+				Threshold:       2,
+			},
+		},
+	}
+	layoutEnv := &Metablock{Signed: layout}
+	if err := layoutEnv.Sign(layoutKey); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = InTotoVerify(layoutEnv, map[string]Key{layoutPubKey.KeyID: layoutPubKey}, ".", "",
+		map[string]string{}, [][]byte{}, testOSisWindows())
+	assert.Nil(t, err)
+
+	// The threshold is not met, if only one of the keys is trusted
+	layout.Keys = map[string]Key{gpgDSAKeyID: gpgKeys[gpgDSAKeyID]}
+	layoutEnv = &Metablock{Signed: layout}
+	if err := layoutEnv.Sign(layoutKey); err != nil {
+		t.Fatal(err)
+	}
+	_, err = InTotoVerify(layoutEnv, map[string]Key{layoutPubKey.KeyID: layoutPubKey}, ".", "",
+		map[string]string{}, [][]byte{}, testOSisWindows())
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,306 @@
+package in_toto
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ErrInvalidHandoff is returned when a handoff bundle cannot be created,
+// loaded or imported, see HandoffBundle.
+var ErrInvalidHandoff = errors.New("invalid handoff bundle")
+
+// ErrHandoffSummaryMismatch is returned by VerifyHandoff, if the summary of a
+// handoff bundle does not match the summary of the verified supply chain.
+var ErrHandoffSummaryMismatch = errors.New("handoff summary does not match verified supply chain")
+
+/*
+HandoffBundle carries the evidence of a verified supply chain across an
+organizational boundary, e.g. from a vendor to a customer, whose own layout
+consumes the final products of the vendor as materials.  It holds the signed
+layout of the supply chain, the links of its steps by step name, and the
+bundles of its sublayouts by sublayout link directory name, see
+SublayoutLinkDirFormat.  Summary is the summary link of the verification by
+the exporting organization, see ExportHandoff, listing the final products.
+
+Customers can verify a bundle on its own with VerifyHandoff, or import it as
+evidence of a step of their own layout with Import, in which case the layout
+of the bundle is verified as sublayout of the step, and its summary link
+provides the products of the step, e.g. to match the materials of later steps
+against.  In both cases the layout of the bundle must be signed by keys the
+customer trusts, e.g. by listing them as functionary keys of the step.
+
+A HandoffBundle is a SublayoutLinkStore of its links.
+*/
+type HandoffBundle struct {
+	Type       string                       `json:"_type"`
+	Layout     json.RawMessage              `json:"layout"`
+	Links      map[string][]json.RawMessage `json:"links"`
+	Sublayouts map[string]*HandoffBundle    `json:"sublayouts,omitempty"`
+	Summary    *Link                        `json:"summary,omitempty"`
+}
+
+/*
+ExportHandoff verifies the supply chain of the passed layout with the links in
+the passed link directory, like VerifyContext, and on success returns a
+handoff bundle of the layout, its links and the resulting summary link, so
+that only verified supply chains are handed off.  Links of sublayouts are
+exported recursively.  Steps whose evidence is not loaded from link files,
+i.e. git references and referenced sublayouts, cannot be exported.
+*/
+func ExportHandoff(ctx context.Context, layoutEnv Metadata, layoutKeys map[string]Key, linkDir string,
+	opts ...VerifyOption) (*HandoffBundle, error) {
+	summary, err := VerifyContext(ctx, layoutEnv, layoutKeys, linkDir, opts...)
+	if err != nil {
+		return nil, err
+	}
+	bundle, err := newHandoffBundle(ctx, layoutEnv, linkDir)
+	if err != nil {
+		return nil, err
+	}
+	summaryLink := summary.GetPayload().(Link)
+	bundle.Summary = &summaryLink
+	return bundle, nil
+}
+
+// newHandoffBundle returns the handoff bundle of the passed layout and the
+// links of its steps in the passed link directory, see ExportHandoff.
+func newHandoffBundle(ctx context.Context, layoutEnv Metadata, linkDir string) (*HandoffBundle, error) {
+	layout, ok := layoutEnv.GetPayload().(Layout)
+	if !ok {
+		return nil, ErrNotLayout
+	}
+	layoutBytes, err := encodeHandoffMetadata(layoutEnv)
+	if err != nil {
+		return nil, err
+	}
+	bundle := &HandoffBundle{
+		Type:   "handoff",
+		Layout: layoutBytes,
+		Links:  make(map[string][]json.RawMessage, len(layout.Steps)),
+	}
+
+	store := &FileLinkStore{Dir: linkDir}
+	for _, step := range layout.Steps {
+		if step.Sublayout != nil || step.Git != nil {
+			return nil, fmt.Errorf("%w: evidence of step '%s' is not stored in link files", ErrInvalidHandoff, step.Name)
+		}
+		links, err := store.GetLinksForStep(ctx, step.Name)
+		if err != nil {
+			return nil, err
+		}
+		for _, linkEnv := range links {
+			linkBytes, err := encodeHandoffMetadata(linkEnv)
+			if err != nil {
+				return nil, err
+			}
+			bundle.Links[step.Name] = append(bundle.Links[step.Name], linkBytes)
+
+			if _, ok := linkEnv.GetPayload().(Layout); !ok {
+				continue
+			}
+			for _, sig := range linkEnv.Sigs() {
+				sublayoutDir := fmt.Sprintf(SublayoutLinkDirFormat, step.Name, sig.KeyID)
+				if _, ok := bundle.Sublayouts[sublayoutDir]; ok {
+					continue
+				}
+				sublayout, err := newHandoffBundle(ctx, linkEnv, filepath.Join(linkDir, sublayoutDir))
+				if err != nil {
+					return nil, fmt.Errorf("sublayout of step '%s': %w", step.Name, err)
+				}
+				if bundle.Sublayouts == nil {
+					bundle.Sublayouts = make(map[string]*HandoffBundle)
+				}
+				bundle.Sublayouts[sublayoutDir] = sublayout
+			}
+		}
+	}
+	return bundle, nil
+}
+
+// encodeHandoffMetadata returns the passed metadata as written to files, see
+// DumpMetadataTo.
+func encodeHandoffMetadata(metadata Metadata) (json.RawMessage, error) {
+	var buf bytes.Buffer
+	if err := DumpMetadataTo(metadata, &buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+/*
+LoadHandoffBundle loads a JSON encoded handoff bundle from the passed path,
+e.g. as written by Dump.
+*/
+func LoadHandoffBundle(path string) (*HandoffBundle, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var bundle HandoffBundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidHandoff, err)
+	}
+	if bundle.Type != "handoff" {
+		return nil, fmt.Errorf("%w: invalid Type value for handoff bundle: should be 'handoff'", ErrInvalidHandoff)
+	}
+	return &bundle, nil
+}
+
+// Dump JSON serializes and writes the handoff bundle to the passed path.
+func (b *HandoffBundle) Dump(path string) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeMetadataFile(path, data, 0644)
+}
+
+// GetLayout returns the signed layout of the handoff bundle.
+func (b *HandoffBundle) GetLayout() (Metadata, error) {
+	layoutEnv, err := decodeMetadata(b.Layout)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidHandoff, err)
+	}
+	if _, ok := layoutEnv.GetPayload().(Layout); !ok {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidHandoff, ErrNotLayout)
+	}
+	return layoutEnv, nil
+}
+
+// GetLinksForStep returns the links of the step of the passed name in the
+// handoff bundle.
+func (b *HandoffBundle) GetLinksForStep(ctx context.Context, stepName string) ([]Metadata, error) {
+	links := []Metadata{}
+	for _, linkBytes := range b.Links[stepName] {
+		linkEnv, err := decodeMetadata(linkBytes)
+		if err != nil {
+			return nil, fmt.Errorf("%w: link of step '%s': %s", ErrInvalidHandoff, stepName, err)
+		}
+		links = append(links, linkEnv)
+	}
+	return links, nil
+}
+
+// Sublayout returns the handoff bundle of the sublayout of the passed step
+// and key id, which is empty if the bundle has none.
+func (b *HandoffBundle) Sublayout(stepName string, keyID string) LinkStore {
+	if sublayout, ok := b.Sublayouts[fmt.Sprintf(SublayoutLinkDirFormat, stepName, keyID)]; ok {
+		return sublayout
+	}
+	return &HandoffBundle{}
+}
+
+/*
+VerifyHandoff verifies the supply chain of the passed handoff bundle, i.e. its
+layout with the passed layout keys and its links, like VerifyContext, and
+returns the summary link of the supply chain, whose products have trusted
+provenance.  Inspections of the layout are run like for any layout, e.g. in
+the directory passed with WithInspectionDir.  If the bundle carries a summary
+link, its materials and products must match the verified summary link, or an
+ErrHandoffSummaryMismatch is returned.
+*/
+func VerifyHandoff(ctx context.Context, bundle *HandoffBundle, layoutKeys map[string]Key,
+	opts ...VerifyOption) (Metadata, error) {
+	layoutEnv, err := bundle.GetLayout()
+	if err != nil {
+		return nil, err
+	}
+	summary, err := VerifyContext(ctx, layoutEnv, layoutKeys, "", append(opts, WithLinkStore(bundle))...)
+	if err != nil {
+		return nil, err
+	}
+	if bundle.Summary != nil {
+		summaryLink := summary.GetPayload().(Link)
+		if !artifactsEqual(bundle.Summary.Materials, summaryLink.Materials) ||
+			!artifactsEqual(bundle.Summary.Products, summaryLink.Products) {
+			return nil, ErrHandoffSummaryMismatch
+		}
+	}
+	return summary, nil
+}
+
+/*
+Import writes the layout of the handoff bundle to the passed link directory
+as link of the step of the passed name, once per signature, named after
+LinkNameFormat, and the links of the bundle to the sublayout link directory of
+the step and each signer, see SublayoutLinkDirFormat.  A layout that lists
+the signers of the bundle as functionaries of the step then verifies the
+supply chain of the bundle as sublayout of the step, and can match the
+materials of later steps against the final products of the bundle.
+*/
+func (b *HandoffBundle) Import(linkDir string, stepName string) error {
+	layoutEnv, err := b.GetLayout()
+	if err != nil {
+		return err
+	}
+	sigs := layoutEnv.Sigs()
+	if len(sigs) == 0 {
+		return fmt.Errorf("%w: layout is not signed", ErrInvalidHandoff)
+	}
+	for _, sig := range sigs {
+		if err := writeMetadataFile(filepath.Join(linkDir, fmt.Sprintf(LinkNameFormat, stepName, sig.KeyID)),
+			b.Layout, 0644); err != nil {
+			return err
+		}
+		if err := b.writeLinks(filepath.Join(linkDir, fmt.Sprintf(SublayoutLinkDirFormat, stepName, sig.KeyID))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeLinks writes the links of the handoff bundle to the passed directory,
+// named after LinkNameFormat and the first signature of each link, and the
+// links of its sublayouts to their sublayout link directories.
+func (b *HandoffBundle) writeLinks(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	stepNames := make([]string, 0, len(b.Links))
+	for stepName := range b.Links {
+		stepNames = append(stepNames, stepName)
+	}
+	sort.Strings(stepNames)
+	for _, stepName := range stepNames {
+		if !isHandoffFileName(stepName) {
+			return fmt.Errorf("%w: invalid step name '%s'", ErrInvalidHandoff, stepName)
+		}
+		links, err := b.GetLinksForStep(context.Background(), stepName)
+		if err != nil {
+			return err
+		}
+		for i, linkEnv := range links {
+			sigs := linkEnv.Sigs()
+			if len(sigs) == 0 {
+				return fmt.Errorf("%w: link of step '%s' is not signed", ErrInvalidHandoff, stepName)
+			}
+			path := filepath.Join(dir, fmt.Sprintf(LinkNameFormat, stepName, sigs[0].KeyID))
+			if err := writeMetadataFile(path, b.Links[stepName][i], 0644); err != nil {
+				return err
+			}
+		}
+	}
+	for sublayoutDir, sublayout := range b.Sublayouts {
+		if !isHandoffFileName(sublayoutDir) {
+			return fmt.Errorf("%w: invalid sublayout link directory '%s'", ErrInvalidHandoff, sublayoutDir)
+		}
+		if err := sublayout.writeLinks(filepath.Join(dir, sublayoutDir)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isHandoffFileName reports whether the passed step name or sublayout link
+// directory name of a handoff bundle can be used in a file name without
+// escaping the directory it is imported to.
+func isHandoffFileName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
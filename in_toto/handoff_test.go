@@ -0,0 +1,115 @@
+package in_toto
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandoff(t *testing.T) {
+	var key Key
+	if err := key.LoadKeyDefaults("alice"); err != nil {
+		t.Fatal(err)
+	}
+	layoutKeys := map[string]Key{key.KeyID: key}
+	var opts []VerifyOption
+	if testOSisWindows() {
+		opts = append(opts, WithLineNormalization())
+	}
+
+	// The vendor exports its verified supply chain
+	vendorDir := t.TempDir()
+	for _, link := range []string{"write-code.b7d643de.link", "package.d3ffd108.link"} {
+		if err := os.Link(link, filepath.Join(vendorDir, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	vendorLayoutEnv, err := LoadMetadata("sub_layout.70ca5750.link")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle, err := ExportHandoff(context.Background(), vendorLayoutEnv, layoutKeys, vendorDir, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, bundle.Links["write-code"], 1)
+	assert.Len(t, bundle.Links["package"], 1)
+	if assert.NotNil(t, bundle.Summary) {
+		assert.Contains(t, bundle.Summary.Products, "foo.tar.gz")
+	}
+	bundlePath := filepath.Join(t.TempDir(), "vendor.handoff")
+	if err := bundle.Dump(bundlePath); err != nil {
+		t.Fatal(err)
+	}
+
+	// Unverified supply chains are not exported
+	_, err = ExportHandoff(context.Background(), vendorLayoutEnv, layoutKeys, t.TempDir(), opts...)
+	assert.NotNil(t, err)
+
+	// The customer verifies the bundle on its own
+	bundle, err = LoadHandoffBundle(bundlePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary, err := VerifyHandoff(context.Background(), bundle, layoutKeys, opts...)
+	if assert.Nil(t, err) {
+		assert.Equal(t, bundle.Summary.Products, summary.GetPayload().(Link).Products)
+	}
+	_, err = VerifyHandoff(context.Background(), bundle, map[string]Key{}, opts...)
+	assert.NotNil(t, err)
+
+	tampered := *bundle
+	tampered.Summary = &Link{Products: map[string]HashObj{"foo.tar.gz": {"sha256": "aa"}}}
+	_, err = VerifyHandoff(context.Background(), &tampered, layoutKeys, opts...)
+	assert.ErrorIs(t, err, ErrHandoffSummaryMismatch)
+
+	// ... or imports it as evidence of a step of its own layout, whose later
+	// steps consume the products of the vendor
+	superLayoutMb, err := LoadMetadata("super.layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	layout := superLayoutMb.GetPayload().(Layout)
+	layout.Expires = time.Now().Add(time.Hour).UTC().Format(ISO8601DateSchema)
+	layoutMb := &Metablock{Signed: layout}
+	if err := layoutMb.Sign(key); err != nil {
+		t.Fatal(err)
+	}
+	customerDir := t.TempDir()
+	if err := bundle.Import(customerDir, "sub_layout"); err != nil {
+		t.Fatal(err)
+	}
+	summary, err = Verify(layoutMb, layoutKeys, customerDir, opts...)
+	if assert.Nil(t, err) {
+		assert.Contains(t, summary.GetPayload().(Link).Products, "foo.tar.gz")
+	}
+
+	// Sublayouts are exported with their links
+	superBundle, err := ExportHandoff(context.Background(), layoutMb, layoutKeys, customerDir, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sublayoutDir := fmt.Sprintf(SublayoutLinkDirFormat, "sub_layout", key.KeyID)
+	if assert.Contains(t, superBundle.Sublayouts, sublayoutDir) {
+		assert.Len(t, superBundle.Sublayouts[sublayoutDir].Links["package"], 1)
+	}
+	_, err = VerifyHandoff(context.Background(), superBundle, layoutKeys, opts...)
+	assert.Nil(t, err)
+
+	// Imported names must not escape the link directory
+	tampered = *bundle
+	tampered.Links = map[string][]json.RawMessage{"../package": bundle.Links["package"]}
+	assert.ErrorIs(t, tampered.Import(t.TempDir(), "sub_layout"), ErrInvalidHandoff)
+
+	if err := os.WriteFile(bundlePath, []byte(`{"_type": "link"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = LoadHandoffBundle(bundlePath)
+	assert.ErrorIs(t, err, ErrInvalidHandoff)
+}
@@ -1,30 +1,170 @@
 package in_toto
 
 import (
+	"bufio"
+	"bytes"
 	"crypto/sha256"
 	"crypto/sha512"
+	"errors"
+	"fmt"
 	"hash"
+	"io"
+	"sort"
+
+	"golang.org/x/crypto/blake2b"
 )
 
+/*
+ArtifactHashBufferSize is the size of the buffer in bytes, which is used to
+stream artifacts through the hash functions when recording them.  Artifacts are
+never read into memory as a whole, so that large artifacts, e.g. container
+image tarballs, can be recorded with constant memory.  Values smaller than one
+use the default buffer size of 32 KiB.
+*/
+var ArtifactHashBufferSize = 32 * 1024
+
 /*
 getHashMapping returns a mapping from hash algorithm to supported hash
-interface.
+interface.  The algorithm names are those of the in-toto specification, i.e.
+"blake2b" is BLAKE2b-512 and "blake2b-256" is BLAKE2b-256.
 */
 func getHashMapping() map[string]func() hash.Hash {
 	return map[string]func() hash.Hash{
-		"sha256": sha256.New,
-		"sha512": sha512.New,
-		"sha384": sha512.New384,
+		"sha256":      sha256.New,
+		"sha512":      sha512.New,
+		"sha384":      sha512.New384,
+		"blake2b":     newBlake2b512,
+		"blake2b-256": newBlake2b256,
+	}
+}
+
+// newBlake2b512 returns an unkeyed BLAKE2b-512 hash, which cannot fail.
+func newBlake2b512() hash.Hash {
+	h, _ := blake2b.New512(nil)
+	return h
+}
+
+// newBlake2b256 returns an unkeyed BLAKE2b-256 hash, which cannot fail.
+func newBlake2b256() hash.Hash {
+	h, _ := blake2b.New256(nil)
+	return h
+}
+
+/*
+SupportedHashAlgorithms returns the names of all hash algorithms that can be
+used to record artifacts, e.g. with RecordArtifacts, in lexical order.
+*/
+func SupportedHashAlgorithms() []string {
+	algorithms := make([]string, 0, len(getHashMapping()))
+	for algorithm := range getHashMapping() {
+		algorithms = append(algorithms, algorithm)
+	}
+	sort.Strings(algorithms)
+	return algorithms
+}
+
+// validateHashAlgorithms returns an ErrUnsupportedHashAlgorithm, if any of the
+// passed hash algorithms is not supported.
+func validateHashAlgorithms(hashAlgorithms []string) error {
+	supportedHashMappings := getHashMapping()
+	for _, algorithm := range hashAlgorithms {
+		if _, ok := supportedHashMappings[algorithm]; !ok {
+			return fmt.Errorf("%w: %s", ErrUnsupportedHashAlgorithm, algorithm)
+		}
+	}
+	return nil
+}
+
+/*
+lineNormalizingWriter converts all line separators of the data written to it
+to '\n' before writing the data to the underlying writer, i.e. "\r\n" and
+"\r" are replaced with "\n".  It keeps track of a trailing '\r', so that
+separators split across writes are normalized like in one write.
+*/
+type lineNormalizingWriter struct {
+	w io.Writer
+	// afterCR is true if the last byte written was '\r'
+	afterCR bool
+	buf     []byte
+}
+
+func (lw *lineNormalizingWriter) Write(p []byte) (int, error) {
+	lw.buf = lw.buf[:0]
+	for _, b := range p {
+		switch {
+		case b == '\r':
+			lw.buf = append(lw.buf, '\n')
+			lw.afterCR = true
+		case b == '\n' && lw.afterCR:
+			// Already written as part of "\r\n"
+			lw.afterCR = false
+		default:
+			lw.buf = append(lw.buf, b)
+			lw.afterCR = false
+		}
+	}
+	if _, err := lw.w.Write(lw.buf); err != nil {
+		return 0, err
 	}
+	return len(p), nil
 }
 
+// textSniffLen is the number of leading bytes inspected to tell text from
+// binary files, like git does.
+const textSniffLen = 8000
+
 /*
-hashToHex calculates the hash over data based on hash algorithm h.
+sniffText reports whether the contents of the passed reader are text, i.e.
+whether the first textSniffLen bytes contain no NUL byte, like git decides
+whether to convert line endings.  It returns a reader of the complete
+contents, including the inspected bytes.
 */
-func hashToHex(h hash.Hash, data []byte) []byte {
-	h.Write(data)
-	// We need to use h.Sum(nil) here, because otherwise hash.Sum() appends
-	// the hash to the passed data. So instead of having only the hash
-	// we would get: "dataHASH"
-	return h.Sum(nil)
+func sniffText(r io.Reader) (io.Reader, bool, error) {
+	br := bufio.NewReaderSize(r, textSniffLen)
+	prefix, err := br.Peek(textSniffLen)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, false, err
+	}
+	return br, bytes.IndexByte(prefix, 0) < 0, nil
+}
+
+/*
+hashReader streams the contents of the passed reader through the hash
+functions of the passed algorithms, optionally normalizing line separators,
+and returns the hex encoded digests by algorithm.
+*/
+func hashReader(r io.Reader, hashAlgorithms []string, lineNormalization bool) (HashObj, error) {
+	supportedHashMappings := getHashMapping()
+	hashes := make(map[string]hash.Hash, len(hashAlgorithms))
+	writers := make([]io.Writer, 0, len(hashAlgorithms))
+	for _, element := range hashAlgorithms {
+		hashFunc, ok := supportedHashMappings[element]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedHashAlgorithm, element)
+		}
+		h := hashFunc()
+		hashes[element] = h
+		writers = append(writers, h)
+	}
+
+	var w io.Writer = io.MultiWriter(writers...)
+	if lineNormalization {
+		w = &lineNormalizingWriter{w: w}
+	}
+
+	bufferSize := ArtifactHashBufferSize
+	if bufferSize < 1 {
+		bufferSize = 32 * 1024
+	}
+	// Hide any WriterTo implementation of the reader, e.g. of *os.File, so
+	// that the configured buffer is used
+	if _, err := io.CopyBuffer(w, struct{ io.Reader }{r}, make([]byte, bufferSize)); err != nil {
+		return nil, err
+	}
+
+	hashedContentsMap := make(HashObj, len(hashes))
+	for element, h := range hashes {
+		hashedContentsMap[element] = sumDigest(h).String()
+	}
+	return hashedContentsMap, nil
 }
@@ -0,0 +1,328 @@
+package in_toto
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ErrUnresolvedImage is returned when a container image is referenced by
+// tag, but no ImageResolver is available to resolve its digest.
+var ErrUnresolvedImage = errors.New("image reference has no digest")
+
+// ErrImageNotFound is returned when a container image is not found in an OCI
+// image layout, or the layout is invalid.
+var ErrImageNotFound = errors.New("image not found")
+
+// Image sources are written in the transport syntax of skopeo, see
+// RecordImage.
+const (
+	imageTransportRegistry   = "docker://"
+	imageTransportOCI        = "oci:"
+	imageTransportOCIArchive = "oci-archive:"
+	imageTransportDocker     = "docker-archive:"
+)
+
+// ociIndexFile is the name of the image index in an OCI image layout.
+const ociIndexFile = "index.json"
+
+// ociRefNameAnnotations are the annotations of the index of an OCI image
+// layout that hold the tag of an image.  Docker writes the full image name.
+var ociRefNameAnnotations = []string{"org.opencontainers.image.ref.name", "io.containerd.image.name"}
+
+/*
+ImageResolver resolves a container image reference, e.g.
+"registry.example.com/app:v1", to the digest of its manifest, e.g.
+"sha256:...".  Registry clients, e.g. crane.Digest of go-containerregistry,
+can be used by implementing this interface, or via ImageResolverFunc.
+*/
+type ImageResolver interface {
+	ResolveImage(ctx context.Context, ref string) (string, error)
+}
+
+// ImageResolverFunc is an adapter to use an ordinary function as
+// ImageResolver.
+type ImageResolverFunc func(ctx context.Context, ref string) (string, error)
+
+// ResolveImage calls f(ctx, ref).
+func (f ImageResolverFunc) ResolveImage(ctx context.Context, ref string) (string, error) {
+	return f(ctx, ref)
+}
+
+/*
+RecordImage records the container image at the passed source as an artifact,
+whose digest is the digest of the image manifest, i.e. the digest a registry
+serves the image under.  Hence, steps that produce or consume images can be
+expressed in layouts without hashing exported tarballs.  Sources are written
+in the transport syntax of skopeo:
+
+  - "docker://<ref>" is an image in a registry.  References with digest, e.g.
+    "docker://example.com/app@sha256:...", are recorded without registry
+    access, other references are resolved by the passed resolver, or fail
+    with ErrUnresolvedImage if it is nil.
+  - "oci:<dir>[:<tag>]" is an image in an OCI image layout directory.
+  - "oci-archive:<tar>[:<tag>]" and "docker-archive:<tar>[:<tag>]" are images
+    in a tarball of an OCI image layout, e.g. written by 'docker save'.
+
+If an OCI image layout holds several images, the tag selects the image by its
+ref name annotation, otherwise it is optional.  The manifest in the layout
+must match the digest in the index of the layout.
+*/
+func RecordImage(ctx context.Context, source string, resolver ImageResolver) (HashObj, error) {
+	var digest string
+	var err error
+	switch {
+	case strings.HasPrefix(source, imageTransportRegistry):
+		digest, err = resolveImageReference(ctx, strings.TrimPrefix(source, imageTransportRegistry), resolver)
+	case strings.HasPrefix(source, imageTransportOCI):
+		layoutPath, tag := splitImageTag(strings.TrimPrefix(source, imageTransportOCI))
+		digest, err = imageLayoutDigest(os.DirFS(layoutPath), tag)
+	case strings.HasPrefix(source, imageTransportOCIArchive), strings.HasPrefix(source, imageTransportDocker):
+		archive := strings.TrimPrefix(strings.TrimPrefix(source, imageTransportOCIArchive), imageTransportDocker)
+		archivePath, tag := splitImageTag(archive)
+		digest, err = imageArchiveDigest(archivePath, tag)
+	default:
+		return nil, fmt.Errorf("unsupported image source '%s', expected one of '%s', '%s', '%s' or '%s'", source,
+			imageTransportRegistry, imageTransportOCI, imageTransportOCIArchive, imageTransportDocker)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseImageDigest(digest)
+}
+
+/*
+recordImages records the images at the passed sources by artifact name, see
+RecordImage, and adds them to the passed artifacts.  It fails, if an image
+has the name of a recorded file.
+*/
+func recordImages(ctx context.Context, artifacts map[string]HashObj, images map[string]string, resolver ImageResolver) (map[string]HashObj, error) {
+	for name, source := range images {
+		if _, ok := artifacts[name]; ok {
+			return nil, fmt.Errorf("image '%s' has the name of a recorded artifact", name)
+		}
+		digest, err := RecordImage(ctx, source, resolver)
+		if err != nil {
+			return nil, fmt.Errorf("failed to record image '%s': %w", name, err)
+		}
+		artifacts[name] = digest
+	}
+	return artifacts, nil
+}
+
+// splitImageTag splits the passed OCI image layout path at the first colon
+// into path and tag, like skopeo does.
+func splitImageTag(source string) (string, string) {
+	layoutPath, tag, _ := strings.Cut(source, ":")
+	return layoutPath, tag
+}
+
+// resolveImageReference returns the digest of the passed registry image
+// reference, see RecordImage.
+func resolveImageReference(ctx context.Context, ref string, resolver ImageResolver) (string, error) {
+	if _, digest, ok := strings.Cut(ref, "@"); ok {
+		return digest, nil
+	}
+	if resolver == nil {
+		return "", fmt.Errorf("%w: '%s'", ErrUnresolvedImage, ref)
+	}
+	digest, err := resolver.ResolveImage(ctx, ref)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve image '%s': %w", ref, err)
+	}
+	return digest, nil
+}
+
+/*
+parseImageDigest converts the passed OCI digest, e.g. "sha256:...", to a
+HashObj.  The algorithm must be one of the SupportedHashAlgorithms.
+*/
+func parseImageDigest(digest string) (HashObj, error) {
+	algorithm, encoded, ok := strings.Cut(digest, ":")
+	if !ok {
+		return nil, fmt.Errorf("invalid image digest '%s'", digest)
+	}
+	newHash, ok := getHashMapping()[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("unsupported algorithm of image digest '%s'", digest)
+	}
+	if err := validateHexString(encoded); err != nil || len(encoded) != hex.EncodedLen(newHash().Size()) {
+		return nil, fmt.Errorf("invalid image digest '%s'", digest)
+	}
+	return HashObj{algorithm: strings.ToLower(encoded)}, nil
+}
+
+// ociIndex is the part of the index of an OCI image layout required to find
+// the digest of an image.
+type ociIndex struct {
+	Manifests []struct {
+		Digest      string            `json:"digest"`
+		Annotations map[string]string `json:"annotations"`
+	} `json:"manifests"`
+}
+
+/*
+selectImageManifest returns the digest of the manifest in the passed index of
+an OCI image layout, whose ref name annotation is the passed tag, or the only
+manifest, if the tag is empty.  Full image names in the annotation, e.g.
+"example.com/app:v1", match the tag "v1" as well.
+*/
+func selectImageManifest(indexData []byte, tag string) (string, error) {
+	var index ociIndex
+	if err := json.Unmarshal(indexData, &index); err != nil {
+		return "", fmt.Errorf("%w: invalid OCI image index: %s", ErrImageNotFound, err)
+	}
+	if tag == "" {
+		if len(index.Manifests) != 1 {
+			return "", fmt.Errorf("%w: OCI image layout holds %d images, a tag is required",
+				ErrImageNotFound, len(index.Manifests))
+		}
+		return index.Manifests[0].Digest, nil
+	}
+	for _, manifest := range index.Manifests {
+		for _, annotation := range ociRefNameAnnotations {
+			refName := manifest.Annotations[annotation]
+			if refName == tag || strings.HasSuffix(refName, ":"+tag) {
+				return manifest.Digest, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("%w: no image tagged '%s' in OCI image layout", ErrImageNotFound, tag)
+}
+
+// imageBlobPath returns the path of the blob of the passed digest in an OCI
+// image layout.
+func imageBlobPath(digest string) string {
+	algorithm, encoded, _ := strings.Cut(digest, ":")
+	return path.Join("blobs", algorithm, encoded)
+}
+
+// verifyImageBlob checks that the passed blob of an OCI image layout matches
+// the passed digest.
+func verifyImageBlob(blob io.Reader, digest string) error {
+	expected, err := parseImageDigest(digest)
+	if err != nil {
+		return err
+	}
+	for algorithm := range expected {
+		h := getHashMapping()[algorithm]()
+		if _, err := io.Copy(h, blob); err != nil {
+			return err
+		}
+		if !digestsMatch(expected, HashObj{algorithm: hex.EncodeToString(h.Sum(nil))}) {
+			return fmt.Errorf("%w: manifest does not match digest '%s'", ErrImageNotFound, digest)
+		}
+	}
+	return nil
+}
+
+// imageLayoutDigest returns the digest of the image of the passed tag in the
+// passed OCI image layout directory, see RecordImage.
+func imageLayoutDigest(layout fs.FS, tag string) (string, error) {
+	indexData, err := fs.ReadFile(layout, ociIndexFile)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrImageNotFound, err)
+	}
+	digest, err := selectImageManifest(indexData, tag)
+	if err != nil {
+		return "", err
+	}
+	if _, err := parseImageDigest(digest); err != nil {
+		return "", err
+	}
+
+	blob, err := layout.Open(imageBlobPath(digest))
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrImageNotFound, err)
+	}
+	defer blob.Close()
+	if err := verifyImageBlob(blob, digest); err != nil {
+		return "", err
+	}
+	return digest, nil
+}
+
+/*
+imageArchiveDigest returns the digest of the image of the passed tag in the
+tarball of an OCI image layout at the passed path, see RecordImage.  The
+tarball is read twice, first to find the index, and then to verify the
+manifest, so that layers are not held in memory.
+*/
+func imageArchiveDigest(archivePath string, tag string) (string, error) {
+	var indexData []byte
+	err := walkImageArchive(archivePath, func(name string, r io.Reader) (bool, error) {
+		if name != ociIndexFile {
+			return false, nil
+		}
+		data, err := io.ReadAll(r)
+		indexData = data
+		return true, err
+	})
+	if err != nil {
+		return "", err
+	}
+	if indexData == nil {
+		return "", fmt.Errorf("%w: no OCI image index in '%s'", ErrImageNotFound, archivePath)
+	}
+	digest, err := selectImageManifest(indexData, tag)
+	if err != nil {
+		return "", err
+	}
+	if _, err := parseImageDigest(digest); err != nil {
+		return "", err
+	}
+
+	found := false
+	err = walkImageArchive(archivePath, func(name string, r io.Reader) (bool, error) {
+		if name != imageBlobPath(digest) {
+			return false, nil
+		}
+		found = true
+		return true, verifyImageBlob(r, digest)
+	})
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", fmt.Errorf("%w: no manifest '%s' in '%s'", ErrImageNotFound, digest, archivePath)
+	}
+	return digest, nil
+}
+
+// walkImageArchive calls the passed function for the regular files in the
+// tarball at the passed path by their cleaned name, until it returns true or
+// an error.
+func walkImageArchive(archivePath string, fn func(name string, r io.Reader) (bool, error)) error {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read image archive '%s': %w", archivePath, err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		done, err := fn(path.Clean(filepath.ToSlash(hdr.Name)), tr)
+		if done || err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package in_toto
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTestImageLayout writes an OCI image layout with one manifest per
+// passed tag to the passed directory, and returns the manifest digests by tag.
+func writeTestImageLayout(t *testing.T, dir string, tags ...string) map[string]string {
+	digests := map[string]string{}
+	manifests := ""
+	for i, tag := range tags {
+		manifest := []byte(fmt.Sprintf(`{"schemaVersion":2,"annotations":{"tag":"%s"}}`, tag))
+		sum := sha256.Sum256(manifest)
+		encoded := hex.EncodeToString(sum[:])
+		if err := os.MkdirAll(filepath.Join(dir, "blobs", "sha256"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "blobs", "sha256", encoded), manifest, 0644); err != nil {
+			t.Fatal(err)
+		}
+		digests[tag] = "sha256:" + encoded
+		if i > 0 {
+			manifests += ","
+		}
+		manifests += fmt.Sprintf(`{"digest":"sha256:%s","annotations":{"org.opencontainers.image.ref.name":"%s"}}`,
+			encoded, tag)
+	}
+	index := fmt.Sprintf(`{"schemaVersion":2,"manifests":[%s]}`, manifests)
+	if err := os.WriteFile(filepath.Join(dir, "index.json"), []byte(index), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return digests
+}
+
+// writeTestImageArchive writes the files of the passed directory to a
+// tarball at the passed path.
+func writeTestImageArchive(t *testing.T, dir string, archivePath string) {
+	f, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tw := tar.NewWriter(f)
+	err = filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		name, _ := filepath.Rel(dir, p)
+		if err := tw.WriteHeader(&tar.Header{Name: "./" + filepath.ToSlash(name), Mode: 0644, Size: int64(len(data))}); err != nil {
+			return err
+		}
+		_, err = tw.Write(data)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecordImageLayout(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	single := filepath.Join(dir, "single")
+	multi := filepath.Join(dir, "multi")
+	digest := writeTestImageLayout(t, single, "v1")["v1"]
+	digests := writeTestImageLayout(t, multi, "v1", "v2")
+	expected := HashObj{"sha256": digest[len("sha256:"):]}
+
+	// The tag is optional for layouts with a single image
+	for _, source := range []string{"oci:" + single, "oci:" + single + ":v1"} {
+		artifact, err := RecordImage(ctx, source, nil)
+		assert.Nil(t, err, source)
+		assert.Equal(t, expected, artifact, source)
+	}
+	artifact, err := RecordImage(ctx, "oci:"+multi+":v2", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, HashObj{"sha256": digests["v2"][len("sha256:"):]}, artifact)
+
+	for _, source := range []string{"oci:" + multi, "oci:" + multi + ":v3", "oci:" + filepath.Join(dir, "missing")} {
+		_, err = RecordImage(ctx, source, nil)
+		assert.ErrorIs(t, err, ErrImageNotFound, source)
+	}
+
+	// Tarballs of layouts are read like directories
+	writeTestImageArchive(t, multi, filepath.Join(dir, "multi.tar"))
+	for _, source := range []string{"oci-archive:" + filepath.Join(dir, "multi.tar") + ":v2",
+		"docker-archive:" + filepath.Join(dir, "multi.tar") + ":v2"} {
+		artifact, err = RecordImage(ctx, source, nil)
+		assert.Nil(t, err, source)
+		assert.Equal(t, HashObj{"sha256": digests["v2"][len("sha256:"):]}, artifact, source)
+	}
+	_, err = RecordImage(ctx, "oci-archive:"+filepath.Join(dir, "multi.tar"), nil)
+	assert.ErrorIs(t, err, ErrImageNotFound)
+
+	// Manifests must match the digest in the index
+	if err := os.WriteFile(filepath.Join(single, "blobs", "sha256", expected["sha256"]), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = RecordImage(ctx, "oci:"+single, nil)
+	assert.ErrorIs(t, err, ErrImageNotFound)
+	writeTestImageArchive(t, single, filepath.Join(dir, "single.tar"))
+	_, err = RecordImage(ctx, "oci-archive:"+filepath.Join(dir, "single.tar"), nil)
+	assert.ErrorIs(t, err, ErrImageNotFound)
+}
+
+func TestRecordImageReference(t *testing.T) {
+	ctx := context.Background()
+	encoded := hex.EncodeToString(make([]byte, sha256.Size))
+	artifact, err := RecordImage(ctx, "docker://example.com/app@sha256:"+encoded, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, HashObj{"sha256": encoded}, artifact)
+
+	_, err = RecordImage(ctx, "docker://example.com/app:v1", nil)
+	assert.ErrorIs(t, err, ErrUnresolvedImage)
+
+	resolver := ImageResolverFunc(func(ctx context.Context, ref string) (string, error) {
+		if ref != "example.com/app:v1" {
+			return "", errors.New("not found")
+		}
+		return "sha256:" + encoded, nil
+	})
+	artifact, err = RecordImage(ctx, "docker://example.com/app:v1", resolver)
+	assert.Nil(t, err)
+	assert.Equal(t, HashObj{"sha256": encoded}, artifact)
+	_, err = RecordImage(ctx, "docker://example.com/app:v2", resolver)
+	assert.NotNil(t, err)
+
+	for _, source := range []string{
+		"example.com/app@sha256:" + encoded,
+		"docker://example.com/app@sha256:abc",
+		"docker://example.com/app@md5:" + encoded,
+		"docker://example.com/app@" + encoded,
+	} {
+		_, err = RecordImage(ctx, source, nil)
+		assert.NotNil(t, err, source)
+	}
+}
+
+func TestRunWithImages(t *testing.T) {
+	var key Key
+	if err := key.LoadKey("carol", "ed25519", []string{"sha256", "sha512"}); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	digest := writeTestImageLayout(t, dir, "v1")["v1"]
+	base := hex.EncodeToString(make([]byte, sha256.Size))
+
+	linkEnv, err := Run("build", nil, key, WithMaterials("foo.tar.gz"),
+		WithImageMaterials(map[string]string{"base": "docker://example.com/base@sha256:" + base}),
+		WithImageProducts(map[string]string{"app": "oci:" + dir + ":v1"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := linkEnv.GetPayload().(Link)
+	assert.Contains(t, link.Materials, "foo.tar.gz")
+	assert.Equal(t, HashObj{"sha256": base}, link.Materials["base"])
+	assert.Equal(t, HashObj{"sha256": digest[len("sha256:"):]}, link.Products["app"])
+
+	// Images must not shadow recorded files
+	_, err = Run("build", nil, key, WithMaterials("foo.tar.gz"),
+		WithImageMaterials(map[string]string{"foo.tar.gz": "docker://example.com/base@sha256:" + base}))
+	assert.NotNil(t, err)
+
+	// Tags are resolved by the resolver
+	_, err = Run("build", nil, key,
+		WithImageMaterials(map[string]string{"base": "docker://example.com/base:v1"}))
+	assert.ErrorIs(t, err, ErrUnresolvedImage)
+	_, err = Run("build", nil, key,
+		WithImageMaterials(map[string]string{"base": "docker://example.com/base:v1"}),
+		WithImageResolver(ImageResolverFunc(func(ctx context.Context, ref string) (string, error) {
+			return "sha256:" + base, nil
+		})))
+	assert.Nil(t, err)
+}
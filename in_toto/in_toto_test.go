@@ -1,6 +1,7 @@
 package in_toto
 
 import (
+	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -13,6 +14,14 @@ const testData = "../test/data"
 // This can be used for test setup and teardown, e.g. copy test data to a tmp
 // test dir, change to that dir and remove the and contents in the end
 func TestMain(m *testing.M) {
+	// Fuzz workers are started in the temp test dir of the coordinating
+	// process, which they use as is
+	flag.Parse()
+	if fuzzWorker := flag.Lookup("test.fuzzworker"); fuzzWorker != nil && fuzzWorker.Value.String() == "true" {
+		m.Run()
+		return
+	}
+
 	testDir, err := os.MkdirTemp("", "in_toto_test_dir")
 	if err != nil {
 		panic("Cannot create temp test dir")
@@ -53,3 +62,26 @@ func TestMain(m *testing.M) {
 	// Run tests
 	m.Run()
 }
+
+/*
+addFuzzSeeds adds the contents of the test data files matching the passed
+patterns as seed corpus to the passed fuzz test, e.g. keys and metadata created
+with the in-toto and securesystemslib reference implementations.  Fuzz tests
+run in the test data directory, see TestMain.
+*/
+func addFuzzSeeds(f *testing.F, patterns ...string) {
+	f.Helper()
+	for _, pattern := range patterns {
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			f.Fatal(err)
+		}
+		for _, path := range paths {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				f.Fatal(err)
+			}
+			f.Add(data)
+		}
+	}
+}
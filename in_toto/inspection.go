@@ -0,0 +1,191 @@
+package in_toto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrInspectionTimeout is returned when an inspection does not finish within
+// the timeout of its InspectionOptions.
+var ErrInspectionTimeout = errors.New("inspection timed out")
+
+/*
+CommandExecutor executes the commands of inspections instead of the verifier
+host, e.g. in a container or a remote sandbox.  Execute runs the passed
+command in the passed directory, which is where the artifacts of the
+inspection are recorded before and after the command, i.e. usually a directory
+that is mounted into the sandbox.  If env is not nil, it is the environment
+the command must be run with, in the "key=value" format of os.Environ.
+Execute must stop the command when the passed context is done.  It returns the
+byproducts of the command in the format of RunCommand, in particular with the
+exit code of the command as "return-value".
+*/
+type CommandExecutor interface {
+	Execute(ctx context.Context, cmdArgs []string, dir string, env []string) (map[string]interface{}, error)
+}
+
+// CommandExecutorFunc is an adapter to use an ordinary function as
+// CommandExecutor.
+type CommandExecutorFunc func(ctx context.Context, cmdArgs []string, dir string, env []string) (map[string]interface{}, error)
+
+// Execute calls f(ctx, cmdArgs, dir, env).
+func (f CommandExecutorFunc) Execute(ctx context.Context, cmdArgs []string, dir string, env []string) (map[string]interface{}, error) {
+	return f(ctx, cmdArgs, dir, env)
+}
+
+/*
+InspectionFunc implements an inspection natively, instead of the command in
+its Run field, see RegisterInspection.  It is passed the verified links of the
+steps of the layout by step name, and returns the link of the inspection,
+whose materials and products are verified against the artifact rules of the
+inspection, like the artifacts recorded by an inspection command.  Returning
+an error fails verification.
+*/
+type InspectionFunc func(links map[string]Metadata) (Link, error)
+
+var (
+	inspectionFuncsMu sync.RWMutex
+	// inspectionFuncs are the functions implementing inspections by
+	// inspection name, see RegisterInspection
+	inspectionFuncs = map[string]InspectionFunc{}
+)
+
+/*
+RegisterInspection registers the passed function to implement the inspections
+of the passed name, replacing the function registered before, if any.
+Verification in the current process calls the function, instead of executing
+the command of the inspection, e.g. to scan the products of a step for
+vulnerabilities in a service that embeds verification without shelling out.
+Passing nil unregisters the inspection.
+*/
+func RegisterInspection(name string, f InspectionFunc) {
+	inspectionFuncsMu.Lock()
+	defer inspectionFuncsMu.Unlock()
+	if f == nil {
+		delete(inspectionFuncs, name)
+		return
+	}
+	inspectionFuncs[name] = f
+}
+
+// getInspectionFunc returns the function registered for the inspection of
+// the passed name, if any.
+func getInspectionFunc(name string) (InspectionFunc, bool) {
+	inspectionFuncsMu.RLock()
+	defer inspectionFuncsMu.RUnlock()
+	f, ok := inspectionFuncs[name]
+	return f, ok
+}
+
+/*
+InspectionOptions constrain how inspections of a layout are run during
+verification.  The zero value runs inspections on the host, in the current
+working directory, with the environment of the current process and without
+timeout, like InTotoVerify.
+
+  - Dir is the directory inspections are run in, and their artifacts are
+    recorded in.
+  - Timeout limits the duration of each inspection.  Inspections that do not
+    finish in time are killed and fail verification with an
+    ErrInspectionTimeout.  Zero means no limit.  Registered inspection
+    functions, see RegisterInspection, cannot be killed, but verification
+    stops waiting for them.
+  - Env, if not nil, is the complete environment of inspection commands, in
+    the "key=value" format of os.Environ, e.g. []string{} for an empty
+    environment.  Otherwise commands inherit the environment of the current
+    process.
+  - Executor, if not nil, executes inspection commands instead of running
+    them on the host, see CommandExecutor.
+*/
+type InspectionOptions struct {
+	Dir      string
+	Timeout  time.Duration
+	Env      []string
+	Executor CommandExecutor
+}
+
+/*
+RunInspectionsWithOptions behaves like RunInspections, but runs inspections
+as constrained by the passed options.
+*/
+func RunInspectionsWithOptions(layout Layout, lineNormalization bool, useDSSE bool, opts InspectionOptions) (map[string]Metadata, error) {
+	return runInspections(context.Background(), layout, nil, lineNormalization, useDSSE, opts)
+}
+
+/*
+InTotoVerifyWithInspectionOptions provides the same functionality as
+InTotoVerify, but runs the inspections of the layout as constrained by the
+passed options.
+*/
+func InTotoVerifyWithInspectionOptions(layoutEnv Metadata, layoutKeys map[string]Key,
+	linkDir string, stepName string, parameterDictionary map[string]string, intermediatePems [][]byte, lineNormalization bool,
+	opts InspectionOptions) (Metadata, error) {
+	return inTotoVerify(context.Background(), layoutEnv, layoutKeys, linkDir, stepName,
+		parameterDictionary, intermediatePems, lineNormalization, verifyOptions{inspection: opts})
+}
+
+// executeCommand executes the passed command with the passed executor, and
+// checks that the returned byproducts report the exit code of the command.
+func executeCommand(ctx context.Context, executor CommandExecutor, cmdArgs []string, dir string, env []string) (map[string]interface{}, error) {
+	byProducts, err := executor.Execute(ctx, cmdArgs, dir, env)
+	if err != nil {
+		return nil, err
+	}
+	// Exit codes are compared as float64, like decoded from JSON
+	retVal, ok := LinkByproducts(byProducts).ReturnValue()
+	if !ok {
+		return nil, fmt.Errorf("executor did not report the exit code of command '%s'", cmdArgs)
+	}
+	byProducts[ReturnValueByproductKey] = float64(retVal)
+	return byProducts, nil
+}
+
+/*
+runInspectionFunc runs the passed registered function of the passed
+inspection with a copy of the passed step links, and returns the link it
+returns as unsigned metadata.  The type and name of the link are set to those
+of the inspection.  If the passed context is done before the function
+returns, the function is left running and the context error is returned.
+*/
+func runInspectionFunc(ctx context.Context, f InspectionFunc, inspection Inspection,
+	stepsMetadata map[string]Metadata, useDSSE bool) (Metadata, error) {
+	links := make(map[string]Metadata, len(stepsMetadata))
+	for name, linkEnv := range stepsMetadata {
+		links[name] = linkEnv
+	}
+
+	type result struct {
+		link Link
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		link, err := f(links)
+		done <- result{link, err}
+	}()
+
+	var res result
+	select {
+	case res = <-done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if res.err != nil {
+		return nil, fmt.Errorf("inspection '%s' failed: %w", inspection.Name, res.err)
+	}
+
+	link := res.link
+	link.Type = "link"
+	link.Name = inspection.Name
+	if useDSSE {
+		env := &Envelope{}
+		if err := env.SetPayload(link); err != nil {
+			return nil, err
+		}
+		return env, nil
+	}
+	return &Metablock{Signed: link, Signatures: []Signature{}}, nil
+}
@@ -0,0 +1,195 @@
+package in_toto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunInspectionsWithOptions(t *testing.T) {
+	defer os.Remove(fmt.Sprintf(LinkNameFormatShort, "inspect"))
+	newLayout := func(cmd ...string) Layout {
+		return Layout{Inspect: []Inspection{{SupplyChainItem: SupplyChainItem{Name: "inspect"}, Run: cmd}}}
+	}
+
+	// Inspections run and record artifacts in the passed directory
+	dir := t.TempDir()
+	result, err := RunInspectionsWithOptions(newLayout("sh", "-c", "echo foo > foo"), false, false,
+		InspectionOptions{Dir: dir})
+	if assert.Nil(t, err) {
+		assert.Contains(t, result["inspect"].GetPayload().(Link).Products, filepath.Join(dir, "foo"))
+	}
+
+	// Inspections are killed after the timeout
+	start := time.Now()
+	_, err = RunInspectionsWithOptions(newLayout("sh", "-c", "sleep 10"), false, false,
+		InspectionOptions{Timeout: 100 * time.Millisecond})
+	assert.ErrorIs(t, err, ErrInspectionTimeout)
+	assert.Less(t, time.Since(start), 10*time.Second)
+
+	// Inspections run with exactly the passed environment
+	_, err = RunInspectionsWithOptions(newLayout("sh", "-c", `test "$FOO" = bar && test -z "$HOME"`), false, false,
+		InspectionOptions{Env: []string{"FOO=bar"}})
+	assert.Nil(t, err)
+	_, err = RunInspectionsWithOptions(newLayout("sh", "-c", `test "$FOO" = bar`), false, false,
+		InspectionOptions{Env: []string{}})
+	assert.ErrorContains(t, err, "returned a non-zero value: 1")
+
+	// Inspections are executed by the passed executor instead of the host
+	var executed []string
+	var executedDir string
+	var executedEnv []string
+	executor := func(retVal interface{}) CommandExecutor {
+		return CommandExecutorFunc(func(ctx context.Context, cmdArgs []string, dir string, env []string) (map[string]interface{}, error) {
+			executed, executedDir, executedEnv = cmdArgs, dir, env
+			return map[string]interface{}{"return-value": retVal, "stdout": "sandboxed", "stderr": ""}, nil
+		})
+	}
+	result, err = RunInspectionsWithOptions(newLayout("rm", "-rf", "/"), false, false,
+		InspectionOptions{Dir: dir, Env: []string{"FOO=bar"}, Executor: executor(0)})
+	if assert.Nil(t, err) {
+		assert.Equal(t, []string{"rm", "-rf", "/"}, executed)
+		assert.Equal(t, dir, executedDir)
+		assert.Equal(t, []string{"FOO=bar"}, executedEnv)
+		byProducts := result["inspect"].GetPayload().(Link).ByProducts
+		assert.Equal(t, float64(0), byProducts["return-value"])
+		assert.Equal(t, "sandboxed", byProducts["stdout"])
+	}
+	_, err = RunInspectionsWithOptions(newLayout("false"), false, false, InspectionOptions{Executor: executor(float64(1))})
+	assert.ErrorContains(t, err, "returned a non-zero value: 1")
+	_, err = RunInspectionsWithOptions(newLayout("true"), false, false, InspectionOptions{Executor: executor(nil)})
+	assert.ErrorContains(t, err, "did not report the exit code")
+
+	// Executors are stopped when the timeout expires
+	_, err = RunInspectionsWithOptions(newLayout("true"), false, false, InspectionOptions{
+		Timeout: 10 * time.Millisecond,
+		Executor: CommandExecutorFunc(func(ctx context.Context, cmdArgs []string, dir string, env []string) (map[string]interface{}, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}),
+	})
+	assert.ErrorIs(t, err, ErrInspectionTimeout)
+}
+
+func TestInTotoVerifyWithInspectionOptions(t *testing.T) {
+	var key Key
+	if err := key.LoadKeyDefaults("alice"); err != nil {
+		t.Fatal(err)
+	}
+	layoutMb, err := LoadMetadata("demo.layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	layout := layoutMb.GetPayload().(Layout)
+	layout.Expires = time.Now().Add(time.Hour).UTC().Format(ISO8601DateSchema)
+	layoutMb = &Metablock{Signed: layout}
+	if err := layoutMb.Sign(key); err != nil {
+		t.Fatal(err)
+	}
+	untarLink := fmt.Sprintf(LinkNameFormatShort, "untar")
+	defer os.Remove(untarLink)
+
+	_, err = InTotoVerifyWithInspectionOptions(layoutMb, map[string]Key{key.KeyID: key}, ".", "", nil, nil, testOSisWindows(),
+		InspectionOptions{Timeout: time.Minute})
+	assert.Nil(t, err)
+
+	executed := false
+	_, err = InTotoVerifyWithInspectionOptions(layoutMb, map[string]Key{key.KeyID: key}, ".", "", nil, nil, testOSisWindows(),
+		InspectionOptions{Executor: CommandExecutorFunc(func(ctx context.Context, cmdArgs []string, dir string, env []string) (map[string]interface{}, error) {
+			executed = true
+			return RunCommand(cmdArgs, dir)
+		})})
+	assert.Nil(t, err)
+	assert.True(t, executed)
+}
+
+func TestRegisterInspection(t *testing.T) {
+	var key Key
+	if err := key.LoadKeyDefaults("alice"); err != nil {
+		t.Fatal(err)
+	}
+	layoutMb, err := LoadMetadata("demo.layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	layout := layoutMb.GetPayload().(Layout)
+	layout.Expires = time.Now().Add(time.Hour).UTC().Format(ISO8601DateSchema)
+	layoutMb = &Metablock{Signed: layout}
+	if err := layoutMb.Sign(key); err != nil {
+		t.Fatal(err)
+	}
+	untarLink := fmt.Sprintf(LinkNameFormatShort, "untar")
+	defer os.Remove(untarLink)
+	defer RegisterInspection("untar", nil)
+
+	// The registered function implements the inspection instead of its
+	// command, based on the links of the steps
+	var stepNames []string
+	untar := func(products HashObj) InspectionFunc {
+		return func(links map[string]Metadata) (Link, error) {
+			stepNames = nil
+			for name := range links {
+				stepNames = append(stepNames, name)
+			}
+			return Link{
+				Materials: links["package"].GetPayload().(Link).Products,
+				Products:  map[string]HashObj{"foo.py": products},
+			}, nil
+		}
+	}
+	writeCodeMb, err := LoadMetadata("write-code.b7d643de.link")
+	if err != nil {
+		t.Fatal(err)
+	}
+	RegisterInspection("untar", untar(writeCodeMb.GetPayload().(Link).Products["foo.py"]))
+
+	executed := false
+	opts := InspectionOptions{Executor: CommandExecutorFunc(func(ctx context.Context, cmdArgs []string, dir string, env []string) (map[string]interface{}, error) {
+		executed = true
+		return RunCommand(cmdArgs, dir)
+	})}
+	_, err = InTotoVerifyWithInspectionOptions(layoutMb, map[string]Key{key.KeyID: key}, ".", "", nil, nil, testOSisWindows(), opts)
+	assert.Nil(t, err)
+	assert.False(t, executed)
+	assert.ElementsMatch(t, []string{"write-code", "package"}, stepNames)
+	untarMb, err := LoadMetadata(untarLink)
+	if assert.Nil(t, err) {
+		assert.Equal(t, "untar", untarMb.GetPayload().(Link).Name)
+	}
+
+	// Artifacts of the returned link are verified against the rules of the
+	// inspection
+	RegisterInspection("untar", untar(HashObj{"sha256": "tampered"}))
+	_, err = InTotoVerifyWithInspectionOptions(layoutMb, map[string]Key{key.KeyID: key}, ".", "", nil, nil, testOSisWindows(), opts)
+	assert.ErrorContains(t, err, "disallowed by rule")
+
+	// Errors of the function fail verification
+	errScan := errors.New("vulnerable")
+	RegisterInspection("untar", func(links map[string]Metadata) (Link, error) {
+		return Link{}, errScan
+	})
+	_, err = InTotoVerifyWithInspectionOptions(layoutMb, map[string]Key{key.KeyID: key}, ".", "", nil, nil, testOSisWindows(), opts)
+	assert.ErrorIs(t, err, errScan)
+
+	// Verification stops waiting for functions after the timeout
+	block := make(chan struct{})
+	defer close(block)
+	RegisterInspection("untar", func(links map[string]Metadata) (Link, error) {
+		<-block
+		return Link{}, nil
+	})
+	_, err = RunInspectionsWithOptions(layout, false, false, InspectionOptions{Timeout: 10 * time.Millisecond})
+	assert.ErrorIs(t, err, ErrInspectionTimeout)
+
+	// Unregistered inspections execute their command again
+	RegisterInspection("untar", nil)
+	_, err = InTotoVerifyWithInspectionOptions(layoutMb, map[string]Key{key.KeyID: key}, ".", "", nil, nil, testOSisWindows(), opts)
+	assert.Nil(t, err)
+	assert.True(t, executed)
+}
@@ -0,0 +1,184 @@
+package in_toto
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Key IDs of the keys in the securesystemslib format of the Python reference
+// implementation, see test/data/README.md
+const (
+	judyKeyID = "30cd3b5b6926ab61482692390b9533595d689e0bfcb68021367e1b4346d210a1"
+	kenKeyID  = "a408284bd3ed44956a0e20e1e2f0b47fd69449567caf4d43649097d7c24fc18a"
+)
+
+func TestPythonInteropKeys(t *testing.T) {
+	tables := []struct {
+		path  string
+		keyID string
+	}{
+		// ecdsa keys of securesystemslib keep the trailing newline of their PEM
+		{"judy", judyKeyID},
+		{"judy.pub", judyKeyID},
+		// securesystemslib ignores the order of keyid_hash_algorithms
+		{"ken.pub", kenKeyID},
+		{"ivan.pub", ivanKeyID},
+	}
+	for _, table := range tables {
+		data, err := os.ReadFile(table.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var pythonKey Key
+		if err := json.Unmarshal(data, &pythonKey); err != nil {
+			t.Fatal(err)
+		}
+
+		var key Key
+		if err := key.LoadSSLibKey(table.path, nil); err != nil {
+			t.Errorf("failed to load '%s': %s", table.path, err)
+			continue
+		}
+		assert.Equal(t, table.keyID, key.KeyID, table.path)
+		assert.Equal(t, pythonKey.KeyVal.Public, key.KeyVal.Public, table.path)
+		assert.Equal(t, pythonKey.KeyIDHashAlgorithms, key.KeyIDHashAlgorithms, table.path)
+	}
+
+	// The public key PEM is only kept, if it is the one of the private key
+	judy, err := os.ReadFile("judy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var judyKey, kenKey Key
+	if err := json.Unmarshal(judy, &judyKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := kenKey.LoadSSLibKey("ken.pub", nil); err != nil {
+		t.Fatal(err)
+	}
+	judyKey.KeyID = ""
+	judyKey.KeyVal.Public = kenKey.KeyVal.Public
+	tampered, err := json.Marshal(judyKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var key Key
+	assert.ErrorIs(t, key.LoadSSLibKeyReader(bytes.NewReader(tampered), nil), ErrInvalidKey)
+}
+
+func TestPythonInteropMetadata(t *testing.T) {
+	var layoutKey, judy, judyPub Key
+	if err := layoutKey.LoadSSLibKey("ivan", []byte("123")); err != nil {
+		t.Fatal(err)
+	}
+	if err := judy.LoadSSLibKey("judy", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := judyPub.LoadSSLibKey("judy.pub", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tables := []struct {
+		path    string
+		signer  Key
+		pubKeys []Key
+	}{
+		{"python.layout", layoutKey, []Key{layoutKey}},
+		{"package.30cd3b5b.link", judy, []Key{judyPub}},
+	}
+	for _, table := range tables {
+		data, err := os.ReadFile(table.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var raw struct {
+			Signed     any         `json:"signed"`
+			Signatures []Signature `json:"signatures"`
+		}
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		if err := dec.Decode(&raw); err != nil {
+			t.Fatal(err)
+		}
+		pythonCanonical, err := EncodeCanonical(raw.Signed)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		metadata, err := LoadMetadata(table.path)
+		if err != nil {
+			t.Fatalf("failed to load '%s': %s", table.path, err)
+		}
+		mb := metadata.(*Metablock)
+
+		// Go must sign the same canonical bytes as Python
+		signable, err := mb.GetSignableRepresentation()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, string(pythonCanonical), string(signable), table.path)
+
+		// Signatures of Python verify in Go
+		for _, pubKey := range table.pubKeys {
+			assert.Nil(t, mb.VerifySignature(pubKey), table.path)
+		}
+
+		// Signatures of Go verify with the public keys of Python, and ed25519
+		// signatures are the same
+		resigned := Metablock{Signed: mb.Signed}
+		if err := resigned.Sign(table.signer); err != nil {
+			t.Fatal(err)
+		}
+		for _, pubKey := range table.pubKeys {
+			assert.Nil(t, resigned.VerifySignature(pubKey), table.path)
+		}
+		if table.signer.KeyType == ed25519KeyType {
+			assert.Equal(t, raw.Signatures, resigned.Signatures, table.path)
+		}
+	}
+}
+
+func TestPythonInteropVerify(t *testing.T) {
+	var layoutKey Key
+	if err := layoutKey.LoadSSLibKey("ivan.pub", nil); err != nil {
+		t.Fatal(err)
+	}
+	layout, err := LoadMetadata("python.layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	summary, err := InTotoVerify(layout, map[string]Key{layoutKey.KeyID: layoutKey}, ".", "",
+		nil, nil, false)
+	if err != nil {
+		t.Fatalf("verification of Python metadata failed: %s", err)
+	}
+	assert.Contains(t, summary.GetPayload().(Link).Products, "foo.tar.gz")
+
+	// Links signed in Go with a key of Python verify likewise
+	var judy Key
+	if err := judy.LoadSSLibKey("judy", nil); err != nil {
+		t.Fatal(err)
+	}
+	link, err := LoadMetadata("package.30cd3b5b.link")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resigned := &Metablock{Signed: link.GetPayload()}
+	if err := resigned.Sign(judy); err != nil {
+		t.Fatal(err)
+	}
+	linkDir := t.TempDir()
+	if _, err := DumpMetadata(resigned, linkDir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := InTotoVerify(layout, map[string]Key{layoutKey.KeyID: layoutKey}, linkDir, "",
+		nil, nil, false); err != nil {
+		t.Errorf("verification of metadata signed in Go failed: %s", err)
+	}
+	assert.Equal(t, judyKeyID, judy.KeyID)
+}
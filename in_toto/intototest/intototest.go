@@ -0,0 +1,212 @@
+/*
+Package intototest provides fixtures and assertions for integration tests
+against in-toto supply chains, e.g. ephemeral functionary keys, temporary
+layouts and links, and helpers that fail a test if verification does not
+behave as expected.
+
+A typical test creates keys, writes links for the steps of a layout and
+verifies the layout:
+
+	layoutKey, layoutPubKey := intototest.NewKey(t)
+	buildKey, buildPubKey := intototest.NewKey(t)
+
+	layout := intototest.NewLayout(t, []in_toto.Step{
+		intototest.NewStep("build", 1, buildPubKey),
+	}, nil, buildPubKey)
+	layoutEnv := intototest.SignLayout(t, layout, layoutKey)
+
+	dir := t.TempDir()
+	intototest.WriteLink(t, dir, intototest.NewLink("build", nil, products), buildKey)
+	intototest.RequireVerifies(t, layoutEnv, dir, layoutPubKey)
+*/
+package intototest
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/in-toto/in-toto-golang/in_toto"
+)
+
+// LayoutExpiry is the time until layouts created with NewLayout expire.
+const LayoutExpiry = time.Hour
+
+/*
+NewKey generates an ephemeral ed25519 key and returns it, together with its
+public part, which is used e.g. as layout or functionary key.  It fails the
+test if the key cannot be generated.
+*/
+func NewKey(tb testing.TB) (in_toto.Key, in_toto.Key) {
+	tb.Helper()
+
+	key, err := in_toto.GenerateEd25519Key()
+	if err != nil {
+		tb.Fatalf("failed to generate key: %s", err)
+	}
+	return key, PublicKey(key)
+}
+
+// PublicKey returns the passed key without its private part.
+func PublicKey(key in_toto.Key) in_toto.Key {
+	key.KeyVal = in_toto.KeyVal{Public: key.KeyVal.Public, Certificate: key.KeyVal.Certificate}
+	return key
+}
+
+/*
+NewStep returns a step with the passed name, threshold and functionary keys,
+which allows any materials and products.  Set the ExpectedMaterials and
+ExpectedProducts fields to test artifact rules.
+*/
+func NewStep(name string, threshold int, functionaries ...in_toto.Key) in_toto.Step {
+	step := in_toto.Step{
+		Type:      "step",
+		Threshold: threshold,
+		SupplyChainItem: in_toto.SupplyChainItem{
+			Name:              name,
+			ExpectedMaterials: [][]string{{"ALLOW", "*"}},
+			ExpectedProducts:  [][]string{{"ALLOW", "*"}},
+		},
+	}
+	for _, key := range functionaries {
+		step.PubKeys = append(step.PubKeys, key.KeyID)
+	}
+	return step
+}
+
+/*
+NewLayout returns a layout with the passed steps and inspections, which
+expires after LayoutExpiry and trusts the passed functionary keys.  Private
+parts of the keys are removed.
+*/
+func NewLayout(tb testing.TB, steps []in_toto.Step, inspections []in_toto.Inspection, functionaries ...in_toto.Key) in_toto.Layout {
+	tb.Helper()
+
+	layout := in_toto.Layout{
+		Type:    "layout",
+		Steps:   steps,
+		Inspect: inspections,
+		Keys:    map[string]in_toto.Key{},
+		Expires: time.Now().Add(LayoutExpiry).UTC().Format(in_toto.ISO8601DateSchema),
+	}
+	if layout.Steps == nil {
+		layout.Steps = []in_toto.Step{}
+	}
+	if layout.Inspect == nil {
+		layout.Inspect = []in_toto.Inspection{}
+	}
+	for _, key := range functionaries {
+		layout.Keys[key.KeyID] = PublicKey(key)
+	}
+	return layout
+}
+
+// SignLayout signs the passed layout with the passed keys and fails the test
+// if signing fails.
+func SignLayout(tb testing.TB, layout in_toto.Layout, keys ...in_toto.Key) in_toto.Metadata {
+	tb.Helper()
+
+	layoutEnv := &in_toto.Metablock{Signed: layout}
+	for _, key := range keys {
+		if err := layoutEnv.Sign(key); err != nil {
+			tb.Fatalf("failed to sign layout: %s", err)
+		}
+	}
+	return layoutEnv
+}
+
+/*
+WriteLayout signs the passed layout with the passed keys, writes it to a file
+named "root.layout" in the passed directory and returns the path of the file.
+*/
+func WriteLayout(tb testing.TB, dir string, layout in_toto.Layout, keys ...in_toto.Key) string {
+	tb.Helper()
+
+	path := filepath.Join(dir, "root.layout")
+	if err := SignLayout(tb, layout, keys...).Dump(path); err != nil {
+		tb.Fatalf("failed to write layout: %s", err)
+	}
+	return path
+}
+
+// NewLink returns a link for the step with the passed name, which reports the
+// passed materials and products.
+func NewLink(name string, materials, products map[string]in_toto.HashObj) in_toto.Link {
+	if materials == nil {
+		materials = map[string]in_toto.HashObj{}
+	}
+	if products == nil {
+		products = map[string]in_toto.HashObj{}
+	}
+	return in_toto.Link{
+		Type:        "link",
+		Name:        name,
+		Materials:   materials,
+		Products:    products,
+		ByProducts:  map[string]interface{}{},
+		Command:     []string{},
+		Environment: map[string]interface{}{},
+	}
+}
+
+/*
+WriteLink signs the passed link with the passed key and writes it to the
+passed directory, named after the step and key like links recorded with
+in-toto run, e.g. "build.<keyid prefix>.link".  It returns the path of the
+link file.
+*/
+func WriteLink(tb testing.TB, dir string, link in_toto.Link, key in_toto.Key) string {
+	tb.Helper()
+
+	linkEnv := &in_toto.Metablock{Signed: link}
+	if err := linkEnv.Sign(key); err != nil {
+		tb.Fatalf("failed to sign link: %s", err)
+	}
+	path := filepath.Join(dir, fmt.Sprintf(in_toto.LinkNameFormat, link.Name, key.KeyID))
+	if err := linkEnv.Dump(path); err != nil {
+		tb.Fatalf("failed to write link: %s", err)
+	}
+	return path
+}
+
+// layoutKeysMap returns the passed layout keys by key ID.
+func layoutKeysMap(layoutKeys []in_toto.Key) map[string]in_toto.Key {
+	keys := make(map[string]in_toto.Key, len(layoutKeys))
+	for _, key := range layoutKeys {
+		keys[key.KeyID] = PublicKey(key)
+	}
+	return keys
+}
+
+/*
+RequireVerifies verifies the passed layout with the passed layout keys and the
+links in the passed directory, see in_toto.InTotoVerify, and fails the test
+if verification fails.  It returns the summary link of the verification.
+*/
+func RequireVerifies(tb testing.TB, layoutEnv in_toto.Metadata, linkDir string, layoutKeys ...in_toto.Key) in_toto.Metadata {
+	tb.Helper()
+
+	summary, err := in_toto.InTotoVerify(layoutEnv, layoutKeysMap(layoutKeys), linkDir, "",
+		map[string]string{}, [][]byte{}, false)
+	if err != nil {
+		tb.Fatalf("expected verification to pass, got: %s", err)
+	}
+	return summary
+}
+
+/*
+RequireVerificationFails verifies the passed layout like RequireVerifies, but
+fails the test if verification passes.  It returns the verification error, to
+allow further assertions.
+*/
+func RequireVerificationFails(tb testing.TB, layoutEnv in_toto.Metadata, linkDir string, layoutKeys ...in_toto.Key) error {
+	tb.Helper()
+
+	_, err := in_toto.InTotoVerify(layoutEnv, layoutKeysMap(layoutKeys), linkDir, "",
+		map[string]string{}, [][]byte{}, false)
+	if err == nil {
+		tb.Fatalf("expected verification to fail")
+	}
+	return err
+}
@@ -0,0 +1,64 @@
+package intototest
+
+import (
+	"testing"
+
+	"github.com/in-toto/in-toto-golang/in_toto"
+	"github.com/stretchr/testify/assert"
+)
+
+// fatalRecorder records, instead of stopping the test on, calls to Fatalf.
+type fatalRecorder struct {
+	testing.TB
+	failed bool
+}
+
+func (r *fatalRecorder) Fatalf(format string, args ...any) {
+	r.failed = true
+}
+
+func TestSupplyChain(t *testing.T) {
+	layoutKey, layoutPubKey := NewKey(t)
+	buildKey, buildPubKey := NewKey(t)
+	assert.Equal(t, buildKey.KeyID, buildPubKey.KeyID)
+	assert.Empty(t, buildPubKey.KeyVal.Private)
+
+	products := map[string]in_toto.HashObj{
+		"foo.tar.gz": {"sha256": "52947cb78b91ad01fe81cd6aef42d1f6817e92b9e6936c1e5aabb7c98514f355"},
+	}
+	step := NewStep("build", 1, buildPubKey)
+	step.ExpectedProducts = [][]string{{"CREATE", "foo.tar.gz"}, {"DISALLOW", "*"}}
+	layout := NewLayout(t, []in_toto.Step{step}, nil, buildKey)
+	assert.Empty(t, layout.Keys[buildKey.KeyID].KeyVal.Private)
+
+	dir := t.TempDir()
+	WriteLink(t, dir, NewLink("build", nil, products), buildKey)
+
+	layoutPath := WriteLayout(t, dir, layout, layoutKey)
+	layoutEnv, err := in_toto.LoadMetadata(layoutPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary := RequireVerifies(t, layoutEnv, dir, layoutPubKey)
+	assert.Equal(t, products, summary.GetPayload().(in_toto.Link).Products)
+
+	// Untrusted layout key
+	_, otherPubKey := NewKey(t)
+	err = RequireVerificationFails(t, layoutEnv, dir, otherPubKey)
+	assert.NotNil(t, err)
+
+	// Disallowed product
+	otherDir := t.TempDir()
+	products["bar"] = products["foo.tar.gz"]
+	WriteLink(t, otherDir, NewLink("build", nil, products), buildKey)
+	RequireVerificationFails(t, SignLayout(t, layout, layoutKey), otherDir, layoutPubKey)
+
+	// The assertions fail the test on unexpected results
+	recorder := &fatalRecorder{TB: t}
+	RequireVerifies(recorder, layoutEnv, otherDir, layoutPubKey)
+	assert.True(t, recorder.failed)
+
+	recorder = &fatalRecorder{TB: t}
+	RequireVerificationFails(recorder, layoutEnv, dir, layoutPubKey)
+	assert.True(t, recorder.failed)
+}
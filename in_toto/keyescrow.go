@@ -0,0 +1,402 @@
+package in_toto
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/in-toto/in-toto-golang/in_toto/keys"
+	"golang.org/x/crypto/hkdf"
+)
+
+// ErrInvalidKeyShares is returned when key shares cannot be combined into the
+// escrowed key, e.g. because they belong to different keys or were modified.
+var ErrInvalidKeyShares = errors.New("invalid key shares")
+
+// ErrInsufficientKeyShares is returned when fewer key shares than the
+// threshold can be decrypted with the passed recipient keys.
+var ErrInsufficientKeyShares = errors.New("insufficient key shares")
+
+// keyShareInfo binds the keys derived for and the encryption of key shares to
+// their purpose.
+const keyShareInfo = "in-toto key share"
+
+/*
+KeyShare is a Shamir secret share of a private key, encrypted to the public
+key of a recipient for offline escrow, see SplitKey.  Any Threshold shares of
+the key with id KeyID can be combined into the private key, see
+CombineKeyShares.  Index is the evaluation point of the share and
+EncryptedShare the hex encoded AES-256-GCM encryption of the share value with
+a random key, which is wrapped to the recipient with id Recipient:
+
+  - RSA recipients: WrappedKey is the RSA-OAEP (SHA-256) encryption of the key.
+  - ECDSA recipients: WrappedKey is the public key of an ephemeral ECDH key,
+    the key is derived from the shared secret with HKDF-SHA256.
+*/
+type KeyShare struct {
+	KeyID          string `json:"keyid"`
+	Threshold      int    `json:"threshold"`
+	Index          int    `json:"index"`
+	Recipient      string `json:"recipient"`
+	WrappedKey     string `json:"wrapped_key"`
+	Nonce          string `json:"nonce"`
+	EncryptedShare string `json:"encrypted_share"`
+}
+
+// gfMul multiplies a and b in GF(2^8) with the AES reduction polynomial.
+func gfMul(a, b byte) byte {
+	var product byte
+	for i := 0; i < 8; i++ {
+		if b&1 == 1 {
+			product ^= a
+		}
+		carry := a & 0x80
+		a <<= 1
+		if carry != 0 {
+			a ^= 0x1b
+		}
+		b >>= 1
+	}
+	return product
+}
+
+// gfInv returns the multiplicative inverse of a != 0 in GF(2^8), i.e. a^254.
+func gfInv(a byte) byte {
+	inverse := byte(1)
+	for i := 0; i < 254; i++ {
+		inverse = gfMul(inverse, a)
+	}
+	return inverse
+}
+
+/*
+splitSecret splits the passed secret into n shares, any threshold of which
+reconstruct the secret, see combineSecret.  Each byte of the secret is the
+constant term of a random polynomial of degree threshold-1 over GF(2^8), and
+share i is the evaluation of all polynomials at x = i+1.
+*/
+func splitSecret(secret []byte, n int, threshold int) ([][]byte, error) {
+	if threshold < 1 || threshold > n || n > 255 {
+		return nil, fmt.Errorf("threshold must be between 1 and the number of at most 255 shares, got threshold %d of %d", threshold, n)
+	}
+	shares := make([][]byte, n)
+	for i := range shares {
+		shares[i] = make([]byte, len(secret))
+	}
+	coefficients := make([]byte, threshold)
+	for b, value := range secret {
+		coefficients[0] = value
+		if _, err := io.ReadFull(rand.Reader, coefficients[1:]); err != nil {
+			return nil, err
+		}
+		for i := range shares {
+			// Horner's method
+			x := byte(i + 1)
+			var y byte
+			for c := threshold - 1; c >= 0; c-- {
+				y = gfMul(y, x) ^ coefficients[c]
+			}
+			shares[i][b] = y
+		}
+	}
+	return shares, nil
+}
+
+// combineSecret reconstructs the secret from the passed shares by evaluation
+// point, using Lagrange interpolation at x = 0.
+func combineSecret(shares map[byte][]byte) []byte {
+	var secret []byte
+	for xi, yi := range shares {
+		// Lagrange basis polynomial of xi at 0, subtraction is XOR in GF(2^8)
+		basis := byte(1)
+		for xj := range shares {
+			if xj != xi {
+				basis = gfMul(basis, gfMul(xj, gfInv(xi^xj)))
+			}
+		}
+		if secret == nil {
+			secret = make([]byte, len(yi))
+		}
+		for b := range secret {
+			secret[b] ^= gfMul(yi[b], basis)
+		}
+	}
+	return secret
+}
+
+// keyShareAdditionalData returns the data authenticated with the encrypted
+// share, which binds the share to the escrowed key and its evaluation point.
+func keyShareAdditionalData(s KeyShare) []byte {
+	return []byte(fmt.Sprintf("%s:%s:%d:%d", keyShareInfo, s.KeyID, s.Threshold, s.Index))
+}
+
+// wrapShareKey returns a random share encryption key and its wrapping to the
+// passed recipient.
+func wrapShareKey(recipient Key) ([]byte, []byte, error) {
+	if recipient.KeyType != rsaKeyType && recipient.KeyType != ecdsaKeyType {
+		return nil, nil, fmt.Errorf("%w: key shares can only be encrypted to RSA or ECDSA keys, got '%s'",
+			ErrUnsupportedKeyType, recipient.KeyType)
+	}
+	_, publicKey, err := keys.DecodePublicKey(recipient.KeyVal.Public)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch publicKey := publicKey.(type) {
+	case *rsa.PublicKey:
+		shareKey := make([]byte, 32)
+		if _, err := io.ReadFull(rand.Reader, shareKey); err != nil {
+			return nil, nil, err
+		}
+		wrapped, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, shareKey, []byte(keyShareInfo))
+		if err != nil {
+			return nil, nil, err
+		}
+		return shareKey, wrapped, nil
+	case *ecdsa.PublicKey:
+		ecdhPublicKey, err := publicKey.ECDH()
+		if err != nil {
+			return nil, nil, err
+		}
+		ephemeral, err := ecdhPublicKey.Curve().GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		sharedSecret, err := ephemeral.ECDH(ecdhPublicKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		wrapped := ephemeral.PublicKey().Bytes()
+		shareKey, err := deriveShareKey(sharedSecret, wrapped)
+		return shareKey, wrapped, err
+	}
+	return nil, nil, fmt.Errorf("%w: key shares can only be encrypted to RSA or ECDSA keys, got '%s'",
+		ErrUnsupportedKeyType, recipient.KeyType)
+}
+
+// unwrapShareKey returns the share encryption key wrapped to the passed
+// recipient private key.
+func unwrapShareKey(recipient Key, wrapped []byte) ([]byte, error) {
+	if recipient.KeyType != rsaKeyType && recipient.KeyType != ecdsaKeyType {
+		return nil, fmt.Errorf("%w: key shares can only be decrypted with RSA or ECDSA keys, got '%s'",
+			ErrUnsupportedKeyType, recipient.KeyType)
+	}
+	_, privateKey, err := keys.DecodePEM([]byte(recipient.KeyVal.Private), nil)
+	if err != nil {
+		return nil, err
+	}
+	switch privateKey := privateKey.(type) {
+	case *rsa.PrivateKey:
+		return rsa.DecryptOAEP(sha256.New(), nil, privateKey, wrapped, []byte(keyShareInfo))
+	case *ecdsa.PrivateKey:
+		ecdhPrivateKey, err := privateKey.ECDH()
+		if err != nil {
+			return nil, err
+		}
+		ephemeral, err := ecdhPrivateKey.Curve().NewPublicKey(wrapped)
+		if err != nil {
+			return nil, err
+		}
+		sharedSecret, err := ecdhPrivateKey.ECDH(ephemeral)
+		if err != nil {
+			return nil, err
+		}
+		return deriveShareKey(sharedSecret, wrapped)
+	}
+	return nil, fmt.Errorf("%w: key shares can only be decrypted with RSA or ECDSA keys, got '%s'",
+		ErrUnsupportedKeyType, recipient.KeyType)
+}
+
+// deriveShareKey derives the share encryption key from the passed ECDH shared
+// secret, salted with the ephemeral public key.
+func deriveShareKey(sharedSecret []byte, ephemeralPublicKey []byte) ([]byte, error) {
+	shareKey := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, sharedSecret, ephemeralPublicKey, []byte(keyShareInfo)), shareKey); err != nil {
+		return nil, err
+	}
+	return shareKey, nil
+}
+
+/*
+SplitKey splits the private key of the passed key into one share per passed
+recipient, each encrypted to the recipient's public key, for offline escrow
+of long-lived keys, e.g. layout keys.  Any threshold shares reconstruct the
+key, see CombineKeyShares, fewer reveal nothing about it.  Recipients must be
+RSA or ECDSA keys.
+*/
+func SplitKey(key Key, threshold int, recipients []Key) ([]KeyShare, error) {
+	if key.KeyVal.Private == "" {
+		return nil, fmt.Errorf("%w: key '%s' has no private key", ErrInvalidKey, key.KeyID)
+	}
+	secret, err := json.Marshal(key)
+	if err != nil {
+		return nil, err
+	}
+	values, err := splitSecret(secret, len(recipients), threshold)
+	if err != nil {
+		return nil, err
+	}
+
+	shares := make([]KeyShare, 0, len(recipients))
+	for i, recipient := range recipients {
+		shareKey, wrapped, err := wrapShareKey(recipient)
+		if err != nil {
+			return nil, err
+		}
+		block, err := aes.NewCipher(shareKey)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		nonce := make([]byte, aead.NonceSize())
+		if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+			return nil, err
+		}
+		share := KeyShare{
+			KeyID:      key.KeyID,
+			Threshold:  threshold,
+			Index:      i + 1,
+			Recipient:  recipient.KeyID,
+			WrappedKey: hex.EncodeToString(wrapped),
+			Nonce:      hex.EncodeToString(nonce),
+		}
+		share.EncryptedShare = hex.EncodeToString(aead.Seal(nil, nonce, values[i], keyShareAdditionalData(share)))
+		shares = append(shares, share)
+	}
+	return shares, nil
+}
+
+// decryptKeyShare returns the share value of the passed share, decrypted with
+// the passed recipient private key.
+func decryptKeyShare(share KeyShare, recipient Key) ([]byte, error) {
+	wrapped, err := hex.DecodeString(share.WrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidKeyShares, err)
+	}
+	nonce, err := hex.DecodeString(share.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidKeyShares, err)
+	}
+	encrypted, err := hex.DecodeString(share.EncryptedShare)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidKeyShares, err)
+	}
+
+	shareKey, err := unwrapShareKey(recipient, wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("%w: share %d: %s", ErrInvalidKeyShares, share.Index, err)
+	}
+	block, err := aes.NewCipher(shareKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("%w: share %d has an invalid nonce", ErrInvalidKeyShares, share.Index)
+	}
+	value, err := aead.Open(nil, nonce, encrypted, keyShareAdditionalData(share))
+	if err != nil {
+		return nil, fmt.Errorf("%w: share %d: %s", ErrInvalidKeyShares, share.Index, err)
+	}
+	return value, nil
+}
+
+/*
+CombineKeyShares reconstructs the escrowed key from the passed shares, see
+SplitKey.  Each share is decrypted with the passed recipient key of the same
+key id, shares of other recipients are ignored.  It returns
+ErrInsufficientKeyShares if fewer than threshold shares can be decrypted and
+ErrInvalidKeyShares if the shares do not belong to the same key or the
+reconstructed key does not match the escrowed key id.
+*/
+func CombineKeyShares(shares []KeyShare, recipientKeys map[string]Key) (Key, error) {
+	if len(shares) == 0 {
+		return Key{}, fmt.Errorf("%w: no key shares", ErrInsufficientKeyShares)
+	}
+	keyID, threshold := shares[0].KeyID, shares[0].Threshold
+
+	values := make(map[byte][]byte)
+	length := -1
+	for _, share := range shares {
+		if share.KeyID != keyID || share.Threshold != threshold {
+			return Key{}, fmt.Errorf("%w: shares belong to different keys", ErrInvalidKeyShares)
+		}
+		if share.Index < 1 || share.Index > 255 {
+			return Key{}, fmt.Errorf("%w: invalid share index %d", ErrInvalidKeyShares, share.Index)
+		}
+		recipient, ok := recipientKeys[share.Recipient]
+		if !ok {
+			continue
+		}
+		value, err := decryptKeyShare(share, recipient)
+		if err != nil {
+			return Key{}, err
+		}
+		if length >= 0 && len(value) != length {
+			return Key{}, fmt.Errorf("%w: shares have different lengths", ErrInvalidKeyShares)
+		}
+		if previous, ok := values[byte(share.Index)]; ok && !bytes.Equal(previous, value) {
+			return Key{}, fmt.Errorf("%w: different shares with index %d", ErrInvalidKeyShares, share.Index)
+		}
+		length = len(value)
+		values[byte(share.Index)] = value
+	}
+	if len(values) < threshold {
+		return Key{}, fmt.Errorf("%w: %d of %d required shares of key '%s'",
+			ErrInsufficientKeyShares, len(values), threshold, keyID)
+	}
+
+	var key Key
+	if err := json.Unmarshal(combineSecret(values), &key); err != nil {
+		return Key{}, fmt.Errorf("%w: %s", ErrInvalidKeyShares, err)
+	}
+	// The key id is derived from the public key, which detects shares that
+	// combine into a different key than the escrowed one
+	expected := key.KeyID
+	if err := key.GenerateKeyID(); err != nil {
+		return Key{}, fmt.Errorf("%w: %s", ErrInvalidKeyShares, err)
+	}
+	if key.KeyID != expected || key.KeyID != keyID {
+		return Key{}, fmt.Errorf("%w: combined key does not match key '%s'", ErrInvalidKeyShares, keyID)
+	}
+	return key, nil
+}
+
+// Dump JSON serializes and writes the key share to the passed path with
+// permissions -rw-------.
+func (s KeyShare) Dump(path string) error {
+	jsonBytes, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, jsonBytes, 0600)
+}
+
+// LoadKeyShare loads a key share written with KeyShare.Dump from the passed
+// path.
+func LoadKeyShare(path string) (KeyShare, error) {
+	jsonBytes, err := os.ReadFile(path)
+	if err != nil {
+		return KeyShare{}, err
+	}
+	var share KeyShare
+	if err := json.Unmarshal(jsonBytes, &share); err != nil {
+		return KeyShare{}, fmt.Errorf("%w: %s", ErrInvalidKeyShares, err)
+	}
+	return share, nil
+}
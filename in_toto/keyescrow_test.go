@@ -0,0 +1,144 @@
+package in_toto
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitCombineSecret(t *testing.T) {
+	secret := []byte("the quick brown fox jumps over the lazy dog")
+	shares, err := splitSecret(secret, 5, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, shares, 5)
+
+	// Any three shares reconstruct the secret
+	for _, indexes := range [][]int{{0, 1, 2}, {4, 2, 0}, {1, 3, 4}, {0, 1, 2, 3, 4}} {
+		subset := map[byte][]byte{}
+		for _, i := range indexes {
+			subset[byte(i+1)] = shares[i]
+		}
+		assert.Equal(t, secret, combineSecret(subset), indexes)
+	}
+	// Two shares do not
+	assert.NotEqual(t, secret, combineSecret(map[byte][]byte{1: shares[0], 2: shares[1]}))
+
+	for _, params := range [][2]int{{3, 0}, {3, 4}, {256, 2}} {
+		_, err := splitSecret(secret, params[0], params[1])
+		assert.NotNil(t, err, params)
+	}
+}
+
+func TestGFInv(t *testing.T) {
+	for a := 1; a < 256; a++ {
+		assert.Equal(t, byte(1), gfMul(byte(a), gfInv(byte(a))), a)
+	}
+}
+
+func TestSplitKey(t *testing.T) {
+	loadKey := func(path string) Key {
+		var key Key
+		if err := key.LoadKeyDefaults(path); err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+	// RSA and ECDSA recipients
+	alice, dan, frank := loadKey("alice"), loadKey("dan"), loadKey("frank")
+	recipients := []Key{loadKey("alice.pub"), loadKey("dan.pub"), loadKey("frank.pub")}
+	recipientKeys := map[string]Key{alice.KeyID: alice, dan.KeyID: dan, frank.KeyID: frank}
+
+	for _, escrowed := range []Key{loadKey("carol"), alice, frank} {
+		shares, err := SplitKey(escrowed, 2, recipients)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Len(t, shares, 3)
+
+		for _, subset := range [][]KeyShare{shares, shares[:2], shares[1:], {shares[2], shares[0]}} {
+			combined, err := CombineKeyShares(subset, recipientKeys)
+			if assert.Nil(t, err, escrowed.KeyType) {
+				assert.Equal(t, escrowed.KeyID, combined.KeyID)
+				assert.Equal(t, escrowed.KeyVal.Private, combined.KeyVal.Private)
+			}
+		}
+
+		// The combined key can be loaded again from its PEM encoding
+		combined, err := CombineKeyShares(shares, recipientKeys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pemBytes, err := combined.EncodePrivateKeyPEM()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var reloaded Key
+		if err := reloaded.LoadKeyReaderDefaults(bytes.NewReader(pemBytes)); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, escrowed.KeyID, reloaded.KeyID, escrowed.KeyType)
+
+		// A single share or shares without recipient keys are insufficient
+		_, err = CombineKeyShares(shares[:1], recipientKeys)
+		assert.ErrorIs(t, err, ErrInsufficientKeyShares)
+		_, err = CombineKeyShares(shares, map[string]Key{alice.KeyID: alice})
+		assert.ErrorIs(t, err, ErrInsufficientKeyShares)
+	}
+
+	shares, err := SplitKey(alice, 2, recipients)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Shares survive dumping and loading
+	dir := t.TempDir()
+	loaded := []KeyShare{}
+	for i, share := range shares[:2] {
+		path := filepath.Join(dir, string(rune('a'+i))+".share")
+		if err := share.Dump(path); err != nil {
+			t.Fatal(err)
+		}
+		loadedShare, err := LoadKeyShare(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		loaded = append(loaded, loadedShare)
+	}
+	combined, err := CombineKeyShares(loaded, recipientKeys)
+	assert.Nil(t, err)
+	assert.Equal(t, alice.KeyID, combined.KeyID)
+
+	// Modified shares and shares of different keys are rejected
+	tampered := append([]KeyShare{}, shares...)
+	tampered[0].Index = 3
+	_, err = CombineKeyShares(tampered, recipientKeys)
+	assert.ErrorIs(t, err, ErrInvalidKeyShares)
+
+	otherShares, err := SplitKey(frank, 2, recipients)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = CombineKeyShares([]KeyShare{shares[0], otherShares[1]}, recipientKeys)
+	assert.ErrorIs(t, err, ErrInvalidKeyShares)
+
+	// Shares are decrypted with the private key of their recipient only
+	_, err = CombineKeyShares(shares[:2], map[string]Key{alice.KeyID: dan, dan.KeyID: dan})
+	assert.ErrorIs(t, err, ErrInvalidKeyShares)
+
+	// Ed25519 recipients and keys without private key are not supported
+	_, err = SplitKey(alice, 1, []Key{loadKey("carol.pub")})
+	assert.ErrorIs(t, err, ErrUnsupportedKeyType)
+	_, err = SplitKey(recipients[0], 1, recipients)
+	assert.ErrorIs(t, err, ErrInvalidKey)
+
+	if err := os.WriteFile(filepath.Join(dir, "invalid.share"), []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, err = LoadKeyShare(filepath.Join(dir, "invalid.share"))
+	assert.ErrorIs(t, err, ErrInvalidKeyShares)
+}
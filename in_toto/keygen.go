@@ -0,0 +1,61 @@
+package in_toto
+
+import (
+	"github.com/in-toto/in-toto-golang/in_toto/keys"
+)
+
+// DefaultRSAKeyBits is the size of RSA keys generated by GenerateKeyPair, if
+// no size is passed, see keys.DefaultRSAKeyBits.
+const DefaultRSAKeyBits = keys.DefaultRSAKeyBits
+
+// GenerateKeyPair generates a new key of the passed key type, see
+// keys.GenerateKeyPair, e.g. to write it with WriteKeyPair.
+func GenerateKeyPair(keyType string, bits int) (Key, error) {
+	return keys.GenerateKeyPair(keyType, bits)
+}
+
+// GenerateRSAKey generates a new RSA key of the passed size, see
+// keys.GenerateRSAKey.
+func GenerateRSAKey(bits int) (Key, error) {
+	return keys.GenerateRSAKey(bits)
+}
+
+// GenerateEd25519Key generates a new ed25519 key, see
+// keys.GenerateEd25519Key.
+func GenerateEd25519Key() (Key, error) {
+	return keys.GenerateEd25519Key()
+}
+
+// EncodePrivateKey returns the private key of the passed key in the format of
+// the securesystemslib tooling, like WriteKeystoreKey, see
+// keys.EncodePrivateKey.
+func EncodePrivateKey(key Key, passphrase []byte) ([]byte, error) {
+	return keys.EncodePrivateKey(key, passphrase)
+}
+
+// EncodePublicKey returns the public key of the passed key in the format of
+// the securesystemslib tooling, see keys.EncodePublicKey.
+func EncodePublicKey(key Key) ([]byte, error) {
+	return keys.EncodePublicKey(key)
+}
+
+/*
+WriteKeyPair writes the private key of the passed key to the passed path, and
+its public key to the path with ".pub" suffix, like `in-toto-keygen`, see
+EncodePrivateKey and EncodePublicKey.  The private key file is only readable
+by the owner.
+*/
+func WriteKeyPair(path string, key Key, passphrase []byte) error {
+	privateData, err := EncodePrivateKey(key, passphrase)
+	if err != nil {
+		return err
+	}
+	publicData, err := EncodePublicKey(key)
+	if err != nil {
+		return err
+	}
+	if err := writeMetadataFile(path, privateData, 0600); err != nil {
+		return err
+	}
+	return writeMetadataFile(path+keystorePublicKeySuffix, publicData, 0644)
+}
@@ -0,0 +1,90 @@
+package in_toto
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/in-toto/in-toto-golang/in_toto/keys"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateKeyPair(t *testing.T) {
+	dir := t.TempDir()
+	passphrase := []byte("correct horse")
+	signable := []byte("signable")
+
+	for _, tc := range []struct {
+		keyType string
+		bits    int
+		scheme  string
+	}{
+		{"ed25519", 0, "ed25519"},
+		{"rsa", 2048, "rsassa-pss-sha256"},
+	} {
+		key, err := GenerateKeyPair(tc.keyType, tc.bits)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, tc.keyType, key.KeyType)
+		assert.Equal(t, tc.scheme, key.Scheme)
+		assert.Equal(t, []string{"sha256", "sha512"}, key.KeyIDHashAlgorithms)
+		assert.Nil(t, keys.ValidateKey(key))
+
+		sig, err := GenerateSignature(signable, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Nil(t, VerifySignature(key, sig, signable))
+
+		// Written keys are loaded again, encrypted if a passphrase is passed
+		for _, pass := range [][]byte{nil, passphrase} {
+			path := filepath.Join(dir, tc.keyType)
+			if err := WriteKeyPair(path, key, pass); err != nil {
+				t.Fatal(err)
+			}
+			info, err := os.Stat(path)
+			if assert.Nil(t, err) && !testOSisWindows() {
+				assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+			}
+
+			var privateKey, publicKey Key
+			if tc.keyType == "rsa" {
+				if pass == nil {
+					assert.Nil(t, privateKey.LoadKeyDefaults(path))
+				} else {
+					data, err := os.ReadFile(path)
+					if err != nil {
+						t.Fatal(err)
+					}
+					privateKey, err = keys.DecodeKey(data, pass)
+					assert.Nil(t, err)
+				}
+				assert.Nil(t, publicKey.LoadKeyDefaults(path+".pub"))
+			} else {
+				assert.Nil(t, privateKey.LoadSSLibKey(path, pass))
+				assert.Nil(t, publicKey.LoadSSLibKey(path+".pub", nil))
+			}
+			assert.Equal(t, key.KeyID, privateKey.KeyID)
+			assert.Equal(t, key.KeyVal.Private, privateKey.KeyVal.Private)
+			assert.Equal(t, key.KeyID, publicKey.KeyID)
+			assert.Empty(t, publicKey.KeyVal.Private)
+		}
+	}
+
+	key, err := GenerateKeyPair("rsa", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "rsa", key.KeyType)
+
+	_, err = GenerateKeyPair("rsa", 1024)
+	assert.ErrorIs(t, err, ErrInvalidKey)
+	_, err = GenerateKeyPair("dsa", 0)
+	assert.ErrorIs(t, err, ErrUnsupportedKeyType)
+
+	// Public keys have no private key to encode
+	key.KeyVal.Private = ""
+	_, err = EncodePrivateKey(key, nil)
+	assert.ErrorIs(t, err, ErrInvalidKey)
+}
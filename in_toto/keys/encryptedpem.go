@@ -0,0 +1,216 @@
+package keys
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// pemEncryptedPrivateKey is the PEM type of encrypted PKCS8 private keys.
+const pemEncryptedPrivateKey string = "ENCRYPTED PRIVATE KEY"
+
+var (
+	oidPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+	oidAES128CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+// encryptedPrivateKeyInfo is the ASN.1 structure of encrypted PKCS8 keys,
+// see RFC 5208, section 6.
+type encryptedPrivateKeyInfo struct {
+	EncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedData       []byte
+}
+
+// pbes2Params holds the PBES2 parameters, see RFC 8018, appendix A.4.
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+// pbkdf2Params holds the PBKDF2 parameters, see RFC 8018, appendix A.2.
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+/*
+decryptPKCS8 decrypts an encrypted PKCS8 private key, as produced e.g. by
+`openssl genpkey -aes256` or `openssl pkcs8 -topk8`.  Only the PBES2 scheme
+with PBKDF2 and AES-CBC is supported, which is the default of current openssl
+versions.  On success it returns the DER encoded, unencrypted PKCS8 key.
+*/
+func decryptPKCS8(der []byte, passphrase []byte) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFailedPEMParsing, err)
+	}
+	if !info.EncryptionAlgorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("%w: unsupported encryption algorithm %s", ErrFailedPEMParsing, info.EncryptionAlgorithm.Algorithm)
+	}
+
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.EncryptionAlgorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFailedPEMParsing, err)
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("%w: unsupported key derivation function %s", ErrFailedPEMParsing, params.KeyDerivationFunc.Algorithm)
+	}
+	var kdfParams pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdfParams); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFailedPEMParsing, err)
+	}
+
+	var prf func() hash.Hash
+	switch {
+	case len(kdfParams.PRF.Algorithm) == 0, kdfParams.PRF.Algorithm.Equal(oidHMACWithSHA1):
+		prf = sha1.New
+	case kdfParams.PRF.Algorithm.Equal(oidHMACWithSHA256):
+		prf = sha256.New
+	case kdfParams.PRF.Algorithm.Equal(oidHMACWithSHA512):
+		prf = sha512.New
+	default:
+		return nil, fmt.Errorf("%w: unsupported pseudorandom function %s", ErrFailedPEMParsing, kdfParams.PRF.Algorithm)
+	}
+
+	var keyLength int
+	switch {
+	case params.EncryptionScheme.Algorithm.Equal(oidAES128CBC):
+		keyLength = 16
+	case params.EncryptionScheme.Algorithm.Equal(oidAES192CBC):
+		keyLength = 24
+	case params.EncryptionScheme.Algorithm.Equal(oidAES256CBC):
+		keyLength = 32
+	default:
+		return nil, fmt.Errorf("%w: unsupported encryption scheme %s", ErrFailedPEMParsing, params.EncryptionScheme.Algorithm)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil || len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf("%w: invalid iv", ErrFailedPEMParsing)
+	}
+	if len(info.EncryptedData) == 0 || len(info.EncryptedData)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("%w: invalid ciphertext length", ErrDecryptionFailed)
+	}
+
+	derivedKey := pbkdf2.Key(passphrase, kdfParams.Salt, kdfParams.IterationCount, keyLength, prf)
+	block, err := aes.NewCipher(derivedKey)
+	if err != nil {
+		return nil, err
+	}
+	plaintext := make([]byte, len(info.EncryptedData))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, info.EncryptedData)
+
+	// Remove the PKCS7 padding. An invalid padding is the first sign of a
+	// wrong passphrase.
+	padding := int(plaintext[len(plaintext)-1])
+	if padding == 0 || padding > aes.BlockSize {
+		return nil, ErrDecryptionFailed
+	}
+	for _, b := range plaintext[len(plaintext)-padding:] {
+		if int(b) != padding {
+			return nil, ErrDecryptionFailed
+		}
+	}
+	plaintext = plaintext[:len(plaintext)-padding]
+
+	if _, err := x509.ParsePKCS8PrivateKey(plaintext); err != nil {
+		return nil, ErrDecryptionFailed
+	}
+	return plaintext, nil
+}
+
+/*
+decryptPEMBlock decrypts the passed PEM block, which is either an encrypted
+PKCS8 private key ("ENCRYPTED PRIVATE KEY") or a legacy, passphrase protected
+PEM block with "Proc-Type" and "DEK-Info" headers, as produced e.g. by
+`openssl genrsa -aes256`.  Unencrypted blocks are returned as is.  The returned
+block carries the unencrypted key and no headers.
+*/
+func decryptPEMBlock(block *pem.Block, passphrase []byte) (*pem.Block, error) {
+	// Legacy PEM encryption is deprecated, but still emitted by common tooling
+	legacyEncrypted := x509.IsEncryptedPEMBlock(block) //nolint:staticcheck
+	if block.Type != pemEncryptedPrivateKey && !legacyEncrypted {
+		return block, nil
+	}
+	if len(passphrase) == 0 {
+		return nil, ErrEncryptedKeyNoPassphrase
+	}
+
+	if block.Type == pemEncryptedPrivateKey {
+		der, err := decryptPKCS8(block.Bytes, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		return &pem.Block{Type: pemPrivateKey, Bytes: der}, nil
+	}
+
+	der, err := x509.DecryptPEMBlock(block, passphrase) //nolint:staticcheck
+	if err != nil {
+		if errors.Is(err, x509.IncorrectPasswordError) {
+			return nil, ErrDecryptionFailed
+		}
+		return nil, fmt.Errorf("%w: %s", ErrDecryptionFailed, err)
+	}
+	return &pem.Block{Type: block.Type, Bytes: der}, nil
+}
+
+/*
+LoadKeyWithPassphrase behaves like LoadKey, but additionally supports private
+keys that are protected with the passed passphrase.  Supported are encrypted
+PKCS8 keys ("ENCRYPTED PRIVATE KEY", PBES2 with PBKDF2 and AES-CBC) and legacy
+encrypted PEM blocks with "Proc-Type" and "DEK-Info" headers.  For unencrypted
+keys the passphrase is ignored.  A wrong passphrase results in an
+ErrDecryptionFailed.
+*/
+func (k *Key) LoadKeyWithPassphrase(path string, passphrase []byte, scheme string, KeyIDHashAlgorithms []string) error {
+	pemFile, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer pemFile.Close()
+
+	err = k.LoadKeyReaderWithPassphrase(pemFile, passphrase, scheme, KeyIDHashAlgorithms)
+	if err != nil {
+		return err
+	}
+
+	return pemFile.Close()
+}
+
+// LoadKeyReaderWithPassphrase loads a possibly encrypted key from a supplied
+// reader. The logic matches LoadKeyWithPassphrase otherwise.
+func (k *Key) LoadKeyReaderWithPassphrase(r io.Reader, passphrase []byte, scheme string, KeyIDHashAlgorithms []string) error {
+	if r == nil {
+		return ErrNoPEMBlock
+	}
+	pemBytes, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	pemData, key, err := DecodePEM(pemBytes, passphrase)
+	if err != nil {
+		return err
+	}
+
+	return k.loadKey(key, pemData, scheme, KeyIDHashAlgorithms)
+}
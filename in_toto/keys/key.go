@@ -0,0 +1,704 @@
+/*
+Package keys implements the keys of in-toto and the securesystemslib, i.e.
+their JSON representation, loading them from PEM, securesystemslib JSON and
+OpenSSH formats, their key IDs, validation, and signing and verifying with
+them via a registry of signature schemes, see RegisterScheme.  It does not
+depend on the in-toto metadata model, so that other TUF and supply chain tools
+can share the key handling of in-toto.
+*/
+package keys
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/secure-systems-lab/go-securesystemslib/cjson"
+)
+
+// ErrFailedPEMParsing gets returned when PKCS1, PKCS8 or PKIX key parsing fails
+var ErrFailedPEMParsing = errors.New("failed parsing the PEM block: unsupported PEM type")
+
+// ErrNoPEMBlock gets triggered when there is no PEM block in the provided file
+var ErrNoPEMBlock = errors.New("failed to decode the data as PEM block (are you sure this is a pem file?)")
+
+// ErrUnsupportedKeyType is returned when we are dealing with a key type different to ed25519 or RSA
+var ErrUnsupportedKeyType = errors.New("unsupported key type")
+
+// ErrInvalidSignature is returned when the signature is invalid
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// ErrInvalidKey is returned when a given key is none of RSA, ECDSA or ED25519
+var ErrInvalidKey = errors.New("invalid key")
+
+// ErrCertificateKeyMismatch indicates that a certificate does not certify the
+// public key of a key it is attached to.
+var ErrCertificateKeyMismatch = errors.New("certificate does not match key")
+
+// Key types and signature schemes of the securesystemslib
+const (
+	RSAKeyType                 string = "rsa"
+	ECDSAKeyType               string = "ecdsa"
+	ED25519KeyType             string = "ed25519"
+	RSASSAPSSSHA256Scheme      string = "rsassa-pss-sha256"
+	RSASSAPSSSHA512Scheme      string = "rsassa-pss-sha512"
+	RSASSAPKCS1v15SHA256Scheme string = "rsassa-pkcs1v15-sha256"
+	RSASSAPKCS1v15SHA512Scheme string = "rsassa-pkcs1v15-sha512"
+	ECDSASHA2NISTP224Scheme    string = "ecdsa-sha2-nistp224"
+	ECDSASHA2NISTP256Scheme    string = "ecdsa-sha2-nistp256"
+	ECDSASHA2NISTP384Scheme    string = "ecdsa-sha2-nistp384"
+	ECDSASHA2NISTP521Scheme    string = "ecdsa-sha2-nistp521"
+	ED25519Scheme              string = "ed25519"
+	pemPublicKey               string = "PUBLIC KEY"
+	pemPrivateKey              string = "PRIVATE KEY"
+	pemRSAPrivateKey           string = "RSA PRIVATE KEY"
+	pemCertificate             string = "CERTIFICATE"
+)
+
+/*
+KeyVal contains the actual values of a key, as opposed to key metadata such as
+a key identifier or key type.  For RSA keys, the key value is a pair of public
+and private keys in PEM format stored as strings.  For public keys the Private
+field may be an empty string.
+*/
+type KeyVal struct {
+	Private     string `json:"private,omitempty"`
+	Public      string `json:"public"`
+	Certificate string `json:"certificate,omitempty"`
+}
+
+/*
+Key represents a generic in-toto key that contains key metadata, such as an
+identifier, supported hash algorithms to create the identifier, the key type
+and the supported signature scheme, and the actual key value.
+*/
+type Key struct {
+	KeyID               string   `json:"keyid"`
+	KeyIDHashAlgorithms []string `json:"keyid_hash_algorithms"`
+	KeyType             string   `json:"keytype"`
+	KeyVal              KeyVal   `json:"keyval"`
+	Scheme              string   `json:"scheme"`
+}
+
+// supportedKeyIDHashAlgorithms returns the supported keyid hash algorithms,
+// which are also the default keyid hash algorithms of keys.
+func supportedKeyIDHashAlgorithms() []string {
+	return []string{"sha256", "sha512"}
+}
+
+/*
+GenerateKeyID computes the key ID of the key based on its public part via the
+SHA256 method, and saves it in the key.  The key is validated afterwards, see
+ValidateKey.  On success GenerateKeyID returns nil, in case of errors while
+encoding or validating there will be an error.
+*/
+func (k *Key) GenerateKeyID() error {
+	keyID, err := computeKeyID(*k, k.KeyIDHashAlgorithms)
+	if err != nil {
+		return err
+	}
+	k.KeyID = keyID
+	return ValidateKey(*k)
+}
+
+// computeKeyID returns the key ID of the passed key, i.e. the hex encoded
+// sha256 digest of its public part with the passed keyid hash algorithms.
+func computeKeyID(k Key, keyIDHashAlgorithms []string) (string, error) {
+	// Create partial key map used to create the keyid
+	// Unfortunately, we can't use the Key object because this also carries
+	// yet unwanted fields, such as KeyID and KeyVal.Private and therefore
+	// produces a different hash. We generate the keyID exactly as we do in
+	// the securesystemslib  to keep interoperability between other in-toto
+	// implementations.
+	var keyToBeHashed = map[string]interface{}{
+		"keytype":               k.KeyType,
+		"scheme":                k.Scheme,
+		"keyid_hash_algorithms": keyIDHashAlgorithms,
+		"keyval": map[string]string{
+			"public": k.KeyVal.Public,
+		},
+	}
+	keyCanonical, err := cjson.EncodeCanonical(keyToBeHashed)
+	if err != nil {
+		return "", err
+	}
+	// calculate sha256 and return string representation of keyID
+	keyHashed := sha256.Sum256(keyCanonical)
+	return fmt.Sprintf("%x", keyHashed), nil
+}
+
+/*
+generatePEMBlock creates a PEM block from scratch via the keyBytes and the pemType.
+If successful it returns a PEM block as []byte slice. This function should always
+succeed, if keyBytes is empty the PEM block will have an empty byte block.
+Therefore only header and footer will exist.
+*/
+func generatePEMBlock(keyBytes []byte, pemType string) []byte {
+	// construct PEM block
+	pemBlock := &pem.Block{
+		Type:    pemType,
+		Headers: nil,
+		Bytes:   keyBytes,
+	}
+	return pem.EncodeToMemory(pemBlock)
+}
+
+/*
+setKeyComponents sets all components in our key object.
+Furthermore it makes sure to remove any trailing and leading whitespaces or newlines.
+We treat key types differently for interoperability reasons to the in-toto python
+implementation and the securesystemslib.
+*/
+func (k *Key) setKeyComponents(pubKeyBytes []byte, privateKeyBytes []byte, keyType string, scheme string, KeyIDHashAlgorithms []string) error {
+	// assume we have a privateKey if the key size is bigger than 0
+
+	switch keyType {
+	case RSAKeyType:
+		if len(privateKeyBytes) > 0 {
+			k.KeyVal = KeyVal{
+				Private: strings.TrimSpace(string(generatePEMBlock(privateKeyBytes, pemRSAPrivateKey))),
+				Public:  strings.TrimSpace(string(generatePEMBlock(pubKeyBytes, pemPublicKey))),
+			}
+		} else {
+			k.KeyVal = KeyVal{
+				Public: strings.TrimSpace(string(generatePEMBlock(pubKeyBytes, pemPublicKey))),
+			}
+		}
+	case ECDSAKeyType:
+		if len(privateKeyBytes) > 0 {
+			k.KeyVal = KeyVal{
+				Private: strings.TrimSpace(string(generatePEMBlock(privateKeyBytes, pemPrivateKey))),
+				Public:  strings.TrimSpace(string(generatePEMBlock(pubKeyBytes, pemPublicKey))),
+			}
+		} else {
+			k.KeyVal = KeyVal{
+				Public: strings.TrimSpace(string(generatePEMBlock(pubKeyBytes, pemPublicKey))),
+			}
+		}
+	case ED25519KeyType:
+		if len(privateKeyBytes) > 0 {
+			k.KeyVal = KeyVal{
+				Private: strings.TrimSpace(hex.EncodeToString(privateKeyBytes)),
+				Public:  strings.TrimSpace(hex.EncodeToString(pubKeyBytes)),
+			}
+		} else {
+			k.KeyVal = KeyVal{
+				Public: strings.TrimSpace(hex.EncodeToString(pubKeyBytes)),
+			}
+		}
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedKeyType, keyType)
+	}
+	k.KeyType = keyType
+	k.Scheme = scheme
+	k.KeyIDHashAlgorithms = KeyIDHashAlgorithms
+	if err := k.GenerateKeyID(); err != nil {
+		return err
+	}
+	return nil
+}
+
+/*
+parseKey tries to parse a PEM []byte slice. Using the following standards
+in the given order:
+
+  - PKCS8
+  - PKCS1
+  - PKIX
+
+On success it returns the parsed key and nil.
+On failure it returns nil and the error ErrFailedPEMParsing
+*/
+func parseKey(data []byte) (interface{}, error) {
+	key, err := x509.ParsePKCS8PrivateKey(data)
+	if err == nil {
+		return key, nil
+	}
+	key, err = x509.ParsePKCS1PrivateKey(data)
+	if err == nil {
+		return key, nil
+	}
+	key, err = x509.ParsePKIXPublicKey(data)
+	if err == nil {
+		return key, nil
+	}
+	key, err = x509.ParseCertificate(data)
+	if err == nil {
+		return key, nil
+	}
+	key, err = x509.ParseECPrivateKey(data)
+	if err == nil {
+		return key, nil
+	}
+	return nil, ErrFailedPEMParsing
+}
+
+/*
+DecodePEM decodes the first PEM block of the passed bytes, decrypts it with
+the passed passphrase, if it is encrypted, see LoadKeyWithPassphrase, and
+parses the key or certificate in it.  PKCS8, PKCS1 and SEC1 private keys, PKIX
+public keys and X.509 certificates are supported.  If any error occurs during
+this process, the function will return nil and an error, e.g. ErrNoPEMBlock,
+ErrFailedPEMParsing or ErrEncryptedKeyNoPassphrase.  On success it will return
+the decoded, and decrypted, PEM block and the parsed key, e.g. an
+*rsa.PrivateKey or an *x509.Certificate.
+*/
+func DecodePEM(pemBytes []byte, passphrase []byte) (*pem.Block, interface{}, error) {
+	// pem.Decode returns the parsed pem block and a rest.
+	// The rest is everything, that could not be parsed as PEM block.
+	// Therefore we can drop this via using the blank identifier "_"
+	data, _ := pem.Decode(pemBytes)
+	if data == nil {
+		return nil, nil, ErrNoPEMBlock
+	}
+
+	data, err := decryptPEMBlock(data, passphrase)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Try to load private key, if this fails try to load
+	// key as public key
+	key, err := parseKey(data.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, key, nil
+}
+
+/*
+DecodePublicKey behaves like DecodePEM for the public key value of an rsa or
+ecdsa key, i.e. KeyVal.Public.  Like securesystemslib, this package stores it
+PEM encoded, but keys of other tools may carry the DER encoded key instead,
+either hex encoded or as is, which is accepted as well.  The returned PEM
+block holds the DER encoded key in any case.  Key IDs are computed over the
+public key value as is, hence it is only decoded here.
+*/
+func DecodePublicKey(public string) (*pem.Block, interface{}, error) {
+	if strings.Contains(public, "-----BEGIN") {
+		return DecodePEM([]byte(public), nil)
+	}
+	der := []byte(public)
+	if decoded, err := hex.DecodeString(strings.TrimSpace(public)); err == nil {
+		der = decoded
+	}
+	key, err := parseKey(der)
+	if err != nil {
+		// Neither PEM nor DER
+		return nil, nil, ErrNoPEMBlock
+	}
+	return &pem.Block{Type: pemPublicKey, Bytes: der}, key, nil
+}
+
+/*
+publicKeyPEM returns the public key value of the passed rsa or ecdsa key PEM
+encoded, see DecodePublicKey, e.g. for signature verifiers of the
+securesystemslib, which only accept PEM encoded keys.
+*/
+func publicKeyPEM(key Key) (string, error) {
+	if strings.Contains(key.KeyVal.Public, "-----BEGIN") {
+		return key.KeyVal.Public, nil
+	}
+	pemData, _, err := DecodePublicKey(key.KeyVal.Public)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(pemData)), nil
+}
+
+/*
+LoadKey loads the key file at specified file path into the key object.
+It automatically derives the PEM type and the key type.
+Right now the following PEM types are supported:
+
+  - PKCS1 for private keys
+  - PKCS8	for private keys
+  - PKIX for public keys
+
+Encrypted private keys can be loaded via LoadKeyWithPassphrase.
+
+The following key types are supported and will be automatically assigned to
+the key type field:
+
+  - ed25519
+  - rsa
+  - ecdsa
+
+The following schemes are supported:
+
+  - ed25519 -> ed25519
+  - rsa -> rsassa-pss-sha256
+  - ecdsa -> ecdsa-sha256-nistp256
+
+Note that, this behavior is consistent with the securesystemslib, except for
+ecdsa. We do not use the scheme string as key type in in-toto-golang.
+Instead we are going with a ecdsa/ecdsa-sha2-nistp256 pair.
+
+On success it will return nil. The following errors can happen:
+
+  - path not found or not readable
+  - no PEM block in the loaded file
+  - no valid PKCS8/PKCS1 private key or PKIX public key
+  - errors while marshalling
+  - unsupported key types
+*/
+func (k *Key) LoadKey(path string, scheme string, KeyIDHashAlgorithms []string) error {
+	pemFile, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer pemFile.Close()
+
+	err = k.LoadKeyReader(pemFile, scheme, KeyIDHashAlgorithms)
+	if err != nil {
+		return err
+	}
+
+	return pemFile.Close()
+}
+
+func (k *Key) LoadKeyDefaults(path string) error {
+	pemFile, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer pemFile.Close()
+
+	err = k.LoadKeyReaderDefaults(pemFile)
+	if err != nil {
+		return err
+	}
+
+	return pemFile.Close()
+}
+
+// LoadKeyReader loads the key from a supplied reader. The logic matches LoadKey otherwise.
+func (k *Key) LoadKeyReader(r io.Reader, scheme string, KeyIDHashAlgorithms []string) error {
+	if r == nil {
+		return ErrNoPEMBlock
+	}
+	// Read key bytes
+	pemBytes, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	// DecodePEM returns the pemData for later use
+	// and a parsed key object (for operations on that key, like extracting the public Key)
+	pemData, key, err := DecodePEM(pemBytes, nil)
+	if err != nil {
+		return err
+	}
+
+	return k.loadKey(key, pemData, scheme, KeyIDHashAlgorithms)
+}
+
+// LoadKeyReaderDefaults loads the key from a supplied reader like
+// LoadKeyReader, with the default scheme and key id hash algorithms of the
+// key type.  Public keys in OpenSSH format are loaded with ParseSSHPublicKey.
+func (k *Key) LoadKeyReaderDefaults(r io.Reader) error {
+	if r == nil {
+		return ErrNoPEMBlock
+	}
+	// Read key bytes
+	pemBytes, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	// Public keys in OpenSSH format have their own default scheme
+	if trimmed := bytes.TrimSpace(pemBytes); isSSHPublicKey(trimmed) {
+		key, err := ParseSSHPublicKey(trimmed)
+		if err != nil {
+			return err
+		}
+		*k = key
+		return nil
+	}
+	// DecodePEM returns the pemData for later use
+	// and a parsed key object (for operations on that key, like extracting the public Key)
+	pemData, key, err := DecodePEM(pemBytes, nil)
+	if err != nil {
+		return err
+	}
+
+	scheme, keyIDHashAlgorithms, err := DefaultScheme(key)
+	if err != nil {
+		return err
+	}
+
+	return k.loadKey(key, pemData, scheme, keyIDHashAlgorithms)
+}
+
+/*
+DefaultScheme returns the default scheme and keyid hash algorithms of the
+passed public or private key, or certificate, as used by LoadKeyDefaults: the
+"rsassa-pss-sha256" scheme for RSA keys, "ecdsa-sha2-nistp256" for ECDSA keys
+and "ed25519" for ed25519 keys, and the "sha256" and "sha512" keyid hash
+algorithms.
+*/
+func DefaultScheme(key interface{}) (scheme string, keyIDHashAlgorithms []string, err error) {
+	keyIDHashAlgorithms = supportedKeyIDHashAlgorithms()
+
+	switch k := key.(type) {
+	case *rsa.PublicKey, *rsa.PrivateKey:
+		scheme = RSASSAPSSSHA256Scheme
+	case ed25519.PrivateKey, ed25519.PublicKey:
+		scheme = ED25519Scheme
+	case *ecdsa.PrivateKey, *ecdsa.PublicKey:
+		scheme = ECDSASHA2NISTP256Scheme
+	case *x509.Certificate:
+		return DefaultScheme(k.PublicKey)
+	default:
+		err = ErrUnsupportedKeyType
+	}
+
+	return scheme, keyIDHashAlgorithms, err
+}
+
+/*
+NewKey returns the key of the passed public or private RSA, ECDSA or ed25519
+key, or of the public key of the passed X.509 certificate, which is then
+attached to the key, with the passed scheme and keyid hash algorithms, e.g. to
+use keys generated or parsed by other libraries.  If the scheme is empty, the
+default scheme and keyid hash algorithms are used, see DefaultScheme.  Private
+RSA keys are stored PKCS1 encoded, private ECDSA keys PKCS8 encoded.
+*/
+func NewKey(cryptoKey interface{}, scheme string, keyIDHashAlgorithms []string) (Key, error) {
+	if scheme == "" {
+		var err error
+		scheme, keyIDHashAlgorithms, err = DefaultScheme(cryptoKey)
+		if err != nil {
+			return Key{}, err
+		}
+	}
+	var pemData *pem.Block
+	switch key := cryptoKey.(type) {
+	case *rsa.PrivateKey:
+		pemData = &pem.Block{Type: pemRSAPrivateKey, Bytes: x509.MarshalPKCS1PrivateKey(key)}
+	case *ecdsa.PrivateKey:
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return Key{}, err
+		}
+		pemData = &pem.Block{Type: pemPrivateKey, Bytes: der}
+	case *x509.Certificate:
+		pemData = &pem.Block{Type: pemCertificate, Bytes: key.Raw}
+	}
+	var key Key
+	if err := key.loadKey(cryptoKey, pemData, scheme, keyIDHashAlgorithms); err != nil {
+		return Key{}, err
+	}
+	return key, nil
+}
+
+func (k *Key) loadKey(keyObj interface{}, pemData *pem.Block, scheme string, keyIDHashAlgorithms []string) error {
+	switch key := keyObj.(type) {
+	case *rsa.PublicKey:
+		pubKeyBytes, err := x509.MarshalPKIXPublicKey(key)
+		if err != nil {
+			return err
+		}
+		if err := k.setKeyComponents(pubKeyBytes, []byte{}, RSAKeyType, scheme, keyIDHashAlgorithms); err != nil {
+			return err
+		}
+	case *rsa.PrivateKey:
+		// Note: RSA Public Keys will get stored as X.509 SubjectPublicKeyInfo (RFC5280)
+		// This behavior is consistent to the securesystemslib
+		pubKeyBytes, err := x509.MarshalPKIXPublicKey(key.Public())
+		if err != nil {
+			return err
+		}
+		// RSA private keys get stored as PKCS1 "RSA PRIVATE KEY", hence
+		// we need to convert keys that were loaded from a PKCS8 block.
+		privKeyBytes := pemData.Bytes
+		if pemData.Type != pemRSAPrivateKey {
+			privKeyBytes = x509.MarshalPKCS1PrivateKey(key)
+		}
+		if err := k.setKeyComponents(pubKeyBytes, privKeyBytes, RSAKeyType, scheme, keyIDHashAlgorithms); err != nil {
+			return err
+		}
+	case ed25519.PublicKey:
+		if err := k.setKeyComponents(key, []byte{}, ED25519KeyType, scheme, keyIDHashAlgorithms); err != nil {
+			return err
+		}
+	case ed25519.PrivateKey:
+		pubKeyBytes := key.Public()
+		if err := k.setKeyComponents(pubKeyBytes.(ed25519.PublicKey), key, ED25519KeyType, scheme, keyIDHashAlgorithms); err != nil {
+			return err
+		}
+	case *ecdsa.PrivateKey:
+		pubKeyBytes, err := x509.MarshalPKIXPublicKey(key.Public())
+		if err != nil {
+			return err
+		}
+		if err := k.setKeyComponents(pubKeyBytes, pemData.Bytes, ECDSAKeyType, scheme, keyIDHashAlgorithms); err != nil {
+			return err
+		}
+	case *ecdsa.PublicKey:
+		pubKeyBytes, err := x509.MarshalPKIXPublicKey(key)
+		if err != nil {
+			return err
+		}
+		if err := k.setKeyComponents(pubKeyBytes, []byte{}, ECDSAKeyType, scheme, keyIDHashAlgorithms); err != nil {
+			return err
+		}
+	case *x509.Certificate:
+		err := k.loadKey(key.PublicKey, pemData, scheme, keyIDHashAlgorithms)
+		if err != nil {
+			return err
+		}
+
+		k.KeyVal.Certificate = string(pem.EncodeToMemory(pemData))
+
+	default:
+		return fmt.Errorf("%w: %T", ErrUnsupportedKeyType, keyObj)
+	}
+
+	return nil
+}
+
+/*
+LoadPublicKeyReader loads a public key from the passed reader into the key
+object on which it was called, e.g. from an HTTP response or embedded bytes.
+The key may be PEM encoded, including as X.509 certificate, in
+securesystemslib JSON format, or in OpenSSH format, see DecodeKey, and is
+loaded with its default scheme and key id hash algorithms.  If the reader
+yields a private key, only its public part is loaded, so that keys used for
+verification never carry private key material.
+*/
+func (k *Key) LoadPublicKeyReader(r io.Reader) error {
+	if r == nil {
+		return ErrNoPEMBlock
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	key, err := DecodeKey(data, nil)
+	if err != nil {
+		return err
+	}
+	key.KeyVal.Private = ""
+	*k = key
+	return nil
+}
+
+/*
+DecodeKey decodes a key in securesystemslib JSON format, which may be
+encrypted, a PEM encoded key or certificate, which may be encrypted, too, or a
+public key in OpenSSH format.  Encrypted keys are decrypted with the passed
+passphrase, see IsEncrypted.  PEM encoded and OpenSSH keys are loaded with
+their default scheme and keyid hash algorithms, see DefaultScheme.
+*/
+func DecodeKey(data []byte, passphrase []byte) (Key, error) {
+	var key Key
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("{")) || isSSLibEncryptedKey(trimmed) {
+		err := key.LoadSSLibKeyReader(bytes.NewReader(trimmed), passphrase)
+		return key, err
+	}
+	if isSSHPublicKey(trimmed) {
+		return ParseSSHPublicKey(trimmed)
+	}
+	pemData, keyObj, err := DecodePEM(trimmed, passphrase)
+	if err != nil {
+		return Key{}, err
+	}
+	scheme, keyIDHashAlgorithms, err := DefaultScheme(keyObj)
+	if err != nil {
+		return Key{}, err
+	}
+	err = key.loadKey(keyObj, pemData, scheme, keyIDHashAlgorithms)
+	return key, err
+}
+
+// IsEncrypted reports whether the passed key data, as accepted by DecodeKey,
+// is encrypted and can only be decoded with a passphrase.
+func IsEncrypted(data []byte) bool {
+	return isSSLibEncryptedKey(data) || bytes.Contains(data, []byte("ENCRYPTED"))
+}
+
+/*
+AttachCertificate attaches the passed PEM encoded X.509 certificate to the key,
+e.g. a short-lived per-build certificate such as a SPIFFE X.509-SVID.  Signatures
+created with the key then carry the certificate, which allows to verify them
+against the root and intermediate CAs of a layout instead of pre-distributed
+public keys.  If the certificate does not certify the public key of the key,
+ErrCertificateKeyMismatch is returned and the key remains unchanged.
+*/
+func (k *Key) AttachCertificate(certPem []byte) error {
+	var cert Key
+	if err := cert.LoadKeyReaderDefaults(bytes.NewReader(certPem)); err != nil {
+		return err
+	}
+	if cert.KeyVal.Certificate == "" {
+		return fmt.Errorf("%w: no certificate", ErrFailedPEMParsing)
+	}
+	if cert.KeyType != k.KeyType || cert.KeyVal.Public != k.KeyVal.Public {
+		return ErrCertificateKeyMismatch
+	}
+
+	k.KeyVal.Certificate = cert.KeyVal.Certificate
+	return nil
+}
+
+/*
+LoadKeyWithCertificate loads the private key at keyPath with default scheme and
+key ID hash algorithms, and attaches the PEM encoded X.509 certificate at
+certPath, see AttachCertificate.
+*/
+func (k *Key) LoadKeyWithCertificate(keyPath string, certPath string) error {
+	var key Key
+	if err := key.LoadKeyDefaults(keyPath); err != nil {
+		return err
+	}
+	certPem, err := os.ReadFile(certPath)
+	if err != nil {
+		return err
+	}
+	if err := key.AttachCertificate(certPem); err != nil {
+		return err
+	}
+
+	*k = key
+	return nil
+}
+
+/*
+CryptoPublicKey returns the public key of the ed25519, rsa or ecdsa key, e.g.
+to compare it with keys used outside of in-toto, such as SSH keys.  For keys
+with a certificate, it is the public key of the certificate.
+*/
+func (k Key) CryptoPublicKey() (crypto.PublicKey, error) {
+	switch k.KeyType {
+	case ED25519KeyType:
+		public, err := hex.DecodeString(k.KeyVal.Public)
+		if err != nil || len(public) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%w: malformed ed25519 public key", ErrInvalidKey)
+		}
+		return ed25519.PublicKey(public), nil
+	case RSAKeyType, ECDSAKeyType:
+		_, parsed, err := DecodePublicKey(k.KeyVal.Public)
+		if err != nil {
+			return nil, err
+		}
+		switch key := parsed.(type) {
+		case *x509.Certificate:
+			return key.PublicKey, nil
+		case crypto.Signer:
+			return key.Public(), nil
+		}
+		return parsed, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedKeyType, k.KeyType)
+}
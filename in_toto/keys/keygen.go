@@ -0,0 +1,169 @@
+package keys
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+)
+
+// DefaultRSAKeyBits is the size of RSA keys generated by GenerateKeyPair, if
+// no size is passed.  It matches the default of the securesystemslib tooling.
+const DefaultRSAKeyBits = 3072
+
+// minRSAKeyBits is the smallest size of RSA keys generated by GenerateKeyPair.
+const minRSAKeyBits = 2048
+
+/*
+GenerateKeyPair generates a new key of the passed key type, i.e. "rsa" or
+"ed25519", with the default scheme and key id hash algorithms of the type, as
+if loaded with LoadKeyDefaults.  The passed bits are the size of RSA keys, and
+must be zero, i.e. DefaultRSAKeyBits, or at least 2048; they are ignored for
+ed25519 keys.  Use EncodePrivateKey and EncodePublicKey to store the key in
+the formats the key loaders accept.
+*/
+func GenerateKeyPair(keyType string, bits int) (Key, error) {
+	switch keyType {
+	case RSAKeyType:
+		return GenerateRSAKey(bits)
+	case ED25519KeyType:
+		return GenerateEd25519Key()
+	}
+	return Key{}, fmt.Errorf("%w: %s", ErrUnsupportedKeyType, keyType)
+}
+
+// GenerateRSAKey generates a new RSA key of the passed size, see
+// GenerateKeyPair.
+func GenerateRSAKey(bits int) (Key, error) {
+	if bits == 0 {
+		bits = DefaultRSAKeyBits
+	}
+	if bits < minRSAKeyBits {
+		return Key{}, fmt.Errorf("%w: rsa keys must have at least %d bits, got %d", ErrInvalidKey, minRSAKeyBits, bits)
+	}
+	privateKey, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return Key{}, err
+	}
+	return NewKey(privateKey, "", nil)
+}
+
+// GenerateEd25519Key generates a new ed25519 key, see GenerateKeyPair.
+func GenerateEd25519Key() (Key, error) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return Key{}, err
+	}
+	return NewKey(privateKey, "", nil)
+}
+
+/*
+EncodePrivateKey returns the private key of the passed key in the format of
+the securesystemslib tooling: RSA keys are PEM encoded, as accepted by
+LoadKeyDefaults, and encrypted with AES-256-CBC if a passphrase is passed;
+ed25519 and ecdsa keys are encoded in securesystemslib JSON format, as
+accepted by LoadSSLibKey, and encrypted in the securesystemslib format if a
+passphrase is passed.
+*/
+func EncodePrivateKey(key Key, passphrase []byte) ([]byte, error) {
+	if err := ValidateKey(key); err != nil {
+		return nil, err
+	}
+	if key.KeyVal.Private == "" {
+		return nil, fmt.Errorf("%w: no private key", ErrInvalidKey)
+	}
+	switch key.KeyType {
+	case RSAKeyType:
+		return encodeRSAPrivateKey(key, passphrase)
+	case ED25519KeyType, ECDSAKeyType:
+		return encodeSSLibPrivateKey(key, passphrase)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedKeyType, key.KeyType)
+}
+
+/*
+EncodePublicKey returns the public key of the passed key in the format of the
+securesystemslib tooling, see EncodePrivateKey: RSA keys are PEM encoded,
+ed25519 and ecdsa keys are encoded in securesystemslib JSON format.
+*/
+func EncodePublicKey(key Key) ([]byte, error) {
+	if err := ValidateKey(key); err != nil {
+		return nil, err
+	}
+	switch key.KeyType {
+	case RSAKeyType:
+		return []byte(key.KeyVal.Public + "\n"), nil
+	case ED25519KeyType, ECDSAKeyType:
+		publicKey := key
+		publicKey.KeyVal = KeyVal{Public: key.KeyVal.Public}
+		return json.Marshal(publicKey)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedKeyType, key.KeyType)
+}
+
+// encodeSSLibPrivateKey returns the passed ed25519 or ecdsa key in
+// securesystemslib JSON format, encrypted with the passed passphrase, if any.
+// Like securesystemslib, only the seed of ed25519 private keys is stored.
+func encodeSSLibPrivateKey(key Key, passphrase []byte) ([]byte, error) {
+	if key.KeyType == ED25519KeyType {
+		privateKey, err := hex.DecodeString(key.KeyVal.Private)
+		if err != nil || len(privateKey) < ed25519.SeedSize {
+			return nil, fmt.Errorf("%w: invalid ed25519 private key", ErrInvalidKey)
+		}
+		key.KeyVal = KeyVal{Public: key.KeyVal.Public, Private: hex.EncodeToString(privateKey[:ed25519.SeedSize])}
+	}
+	data, err := json.Marshal(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(passphrase) == 0 {
+		return data, nil
+	}
+	return encryptSSLibKey(data, passphrase)
+}
+
+// encodeRSAPrivateKey returns the PEM encoded private key of the passed rsa
+// key, encrypted with the passed passphrase, if any.
+func encodeRSAPrivateKey(key Key, passphrase []byte) ([]byte, error) {
+	block, _ := pem.Decode([]byte(key.KeyVal.Private))
+	if block == nil {
+		return nil, ErrNoPEMBlock
+	}
+	if len(passphrase) > 0 {
+		// Legacy PEM encryption is deprecated, but what securesystemslib emits
+		// for rsa keys, see decryptPEMBlock
+		var err error
+		block, err = x509.EncryptPEMBlock(rand.Reader, block.Type, block.Bytes, passphrase, x509.PEMCipherAES256) //nolint:staticcheck
+		if err != nil {
+			return nil, err
+		}
+	}
+	return pem.EncodeToMemory(block), nil
+}
+
+/*
+EncodePrivateKeyPEM returns the PEM encoding of the private key of the key on
+which it was called, which can be loaded again with LoadKey, e.g. after
+reconstructing the key from key shares.
+*/
+func (k Key) EncodePrivateKeyPEM() ([]byte, error) {
+	if k.KeyVal.Private == "" {
+		return nil, fmt.Errorf("%w: key '%s' has no private key", ErrInvalidKey, k.KeyID)
+	}
+	if k.KeyType != ED25519KeyType {
+		return []byte(k.KeyVal.Private + "\n"), nil
+	}
+	privateKey, err := hex.DecodeString(k.KeyVal.Private)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(ed25519.PrivateKey(privateKey))
+	if err != nil {
+		return nil, err
+	}
+	return generatePEMBlock(der, pemPrivateKey), nil
+}
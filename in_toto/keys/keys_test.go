@@ -0,0 +1,49 @@
+package keys
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testData = "../../test/data"
+
+// TestMain copies the test data to a temp test dir, changes to that dir, runs
+// all tests of this package and removes the dir in the end, like the tests of
+// the in_toto package.
+func TestMain(m *testing.M) {
+	testDir, err := os.MkdirTemp("", "keys_test_dir")
+	if err != nil {
+		panic("Cannot create temp test dir")
+	}
+
+	// Copy test files to temp test directory
+	// NOTE: Only works for a flat directory of files
+	testFiles, _ := filepath.Glob(filepath.Join(testData, "*"))
+	for _, inputPath := range testFiles {
+		input, err := os.ReadFile(inputPath)
+		if err != nil {
+			panic(fmt.Sprintf("Cannot copy test files (read error: %s)", err))
+		}
+		outputPath := filepath.Join(testDir, filepath.Base(inputPath))
+		err = os.WriteFile(outputPath, input, 0644)
+		if err != nil {
+			panic(fmt.Sprintf("Cannot copy test files (write error: %s)", err))
+		}
+	}
+
+	cwd, _ := os.Getwd()
+	if err := os.Chdir(testDir); err != nil {
+		fmt.Printf("Unable to change dir to %s: %s", testDir, err)
+	}
+	code := m.Run()
+
+	if err := os.Chdir(cwd); err != nil {
+		fmt.Printf("Unable to change to directory %s: %s", cwd, err)
+	}
+	if err := os.RemoveAll(testDir); err != nil {
+		fmt.Printf("Unable to remove directory %s: %s", testDir, err)
+	}
+	os.Exit(code)
+}
@@ -0,0 +1,139 @@
+package keys
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+)
+
+/*
+rsaSignerVerifier is a SignerVerifier for RSA keys, that signs and
+verifies according to the scheme of the key it was created from.  The
+following schemes are supported:
+
+  - rsassa-pss-sha256
+  - rsassa-pss-sha512
+  - rsassa-pkcs1v15-sha256
+  - rsassa-pkcs1v15-sha512
+
+RSASSA-PSS signatures are created with a salt of the length of the hash, which
+is consistent with the securesystemslib.  On verification the salt length is
+detected automatically, so that signatures created by other tooling verify as
+well.
+*/
+type rsaSignerVerifier struct {
+	keyID   string
+	hash    crypto.Hash
+	pss     bool
+	private *rsa.PrivateKey
+	public  *rsa.PublicKey
+}
+
+/*
+RSASchemeParameters returns the hash function of the passed RSA scheme and
+whether the scheme uses RSASSA-PSS (as opposed to RSASSA-PKCS1-v1_5).
+*/
+func RSASchemeParameters(scheme string) (crypto.Hash, bool, error) {
+	switch scheme {
+	case RSASSAPSSSHA256Scheme:
+		return crypto.SHA256, true, nil
+	case RSASSAPSSSHA512Scheme:
+		return crypto.SHA512, true, nil
+	case RSASSAPKCS1v15SHA256Scheme:
+		return crypto.SHA256, false, nil
+	case RSASSAPKCS1v15SHA512Scheme:
+		return crypto.SHA512, false, nil
+	}
+	return 0, false, fmt.Errorf("%w: %s", ErrSchemeKeyTypeMismatch, scheme)
+}
+
+/*
+newRSASignerVerifier creates an rsaSignerVerifier from the passed key.  The
+private key is optional, without it the returned rsaSignerVerifier can only
+verify signatures.
+*/
+func newRSASignerVerifier(key Key) (*rsaSignerVerifier, error) {
+	hash, pss, err := RSASchemeParameters(key.Scheme)
+	if err != nil {
+		return nil, err
+	}
+
+	_, publicParsedKey, err := DecodePublicKey(key.KeyVal.Public)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create RSA signerverifier: %w", err)
+	}
+	public, ok := publicParsedKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: public key is not an RSA key", ErrInvalidKey)
+	}
+
+	sv := &rsaSignerVerifier{
+		keyID:  key.KeyID,
+		hash:   hash,
+		pss:    pss,
+		public: public,
+	}
+
+	if len(key.KeyVal.Private) > 0 {
+		_, privateParsedKey, err := DecodePEM([]byte(key.KeyVal.Private), nil)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create RSA signerverifier: %w", err)
+		}
+		private, ok := privateParsedKey.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%w: private key is not an RSA key", ErrInvalidKey)
+		}
+		sv.private = private
+	}
+
+	return sv, nil
+}
+
+// Sign creates a signature for data according to the scheme of the key.
+func (sv *rsaSignerVerifier) Sign(ctx context.Context, data []byte) ([]byte, error) {
+	if sv.private == nil {
+		return nil, errors.New("signing requires a private key")
+	}
+
+	h := sv.hash.New()
+	h.Write(data)
+	hashed := h.Sum(nil)
+
+	if sv.pss {
+		return rsa.SignPSS(rand.Reader, sv.private, sv.hash, hashed,
+			&rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: sv.hash})
+	}
+	return rsa.SignPKCS1v15(rand.Reader, sv.private, sv.hash, hashed)
+}
+
+// Verify verifies sig over data according to the scheme of the key.
+func (sv *rsaSignerVerifier) Verify(ctx context.Context, data []byte, sig []byte) error {
+	h := sv.hash.New()
+	h.Write(data)
+	hashed := h.Sum(nil)
+
+	var err error
+	if sv.pss {
+		err = rsa.VerifyPSS(sv.public, sv.hash, hashed, sig,
+			&rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto, Hash: sv.hash})
+	} else {
+		err = rsa.VerifyPKCS1v15(sv.public, sv.hash, hashed, sig)
+	}
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// KeyID returns the ID of the key the rsaSignerVerifier was created from.
+func (sv *rsaSignerVerifier) KeyID() (string, error) {
+	return sv.keyID, nil
+}
+
+// Public returns the public key the rsaSignerVerifier was created from.
+func (sv *rsaSignerVerifier) Public() crypto.PublicKey {
+	return sv.public
+}
@@ -0,0 +1,39 @@
+package keys
+
+import (
+	"context"
+	"testing"
+
+	"github.com/secure-systems-lab/go-securesystemslib/signerverifier"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRSAPSSCompatibility(t *testing.T) {
+	// Signatures created via the securesystemslib must verify and vice versa
+	var key Key
+	if err := key.LoadKey("dan", RSASSAPSSSHA256Scheme, []string{"sha256", "sha512"}); err != nil {
+		t.Fatal(err)
+	}
+	sslibKey := sslibKeyFromKey(key)
+	sslibSV, err := signerverifier.NewRSAPSSSignerVerifierFromSSLibKey(&sslibKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv, err := newRSASignerVerifier(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte("signed data")
+	sslibSig, err := sslibSV.Sign(context.Background(), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, sv.Verify(context.Background(), data, sslibSig))
+
+	sig, err := sv.Sign(context.Background(), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, sslibSV.Verify(context.Background(), data, sig))
+}
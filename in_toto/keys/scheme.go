@@ -0,0 +1,175 @@
+package keys
+
+import (
+	"context"
+	"crypto"
+	"fmt"
+	"sync"
+
+	"github.com/secure-systems-lab/go-securesystemslib/signerverifier"
+)
+
+/*
+SignerVerifier signs and verifies data with a key according to its scheme.  It
+is the SignerVerifier of DSSE, see the dsse package of the securesystemslib,
+hence it can sign and verify DSSE envelopes as is.  Verify returns an error
+wrapping ErrInvalidSignature, if the signature was not created by the key.
+*/
+type SignerVerifier interface {
+	Sign(ctx context.Context, data []byte) ([]byte, error)
+	Verify(ctx context.Context, data []byte, sig []byte) error
+	KeyID() (string, error)
+	Public() crypto.PublicKey
+}
+
+/*
+SignerVerifierFunc returns the SignerVerifier of the passed key, which has the
+key type and scheme the function was registered for, see RegisterScheme.  The
+private key of the key is optional, without it the SignerVerifier can only
+verify signatures.
+*/
+type SignerVerifierFunc func(key Key) (SignerVerifier, error)
+
+// schemeRegistry holds the registered key types and schemes, see
+// RegisterScheme and RegisterKeyType.
+type schemeRegistry struct {
+	mu             sync.RWMutex
+	schemes        map[string][]string
+	signerVerifier map[string]SignerVerifierFunc
+	validateKeyVal map[string]func(Key) error
+}
+
+var registry = &schemeRegistry{
+	schemes:        make(map[string][]string),
+	signerVerifier: make(map[string]SignerVerifierFunc),
+	validateKeyVal: make(map[string]func(Key) error),
+}
+
+func init() {
+	RegisterKeyType(RSAKeyType, validatePEMKeyVal)
+	RegisterKeyType(ECDSAKeyType, validatePEMKeyVal)
+	RegisterKeyType(ED25519KeyType, validateEd25519KeyVal)
+	for _, scheme := range []string{RSASSAPSSSHA256Scheme, RSASSAPSSSHA512Scheme, RSASSAPKCS1v15SHA256Scheme,
+		RSASSAPKCS1v15SHA512Scheme} {
+		RegisterScheme(RSAKeyType, scheme, func(key Key) (SignerVerifier, error) {
+			sv, err := newRSASignerVerifier(key)
+			if err != nil {
+				return nil, err
+			}
+			return sv, nil
+		})
+	}
+	for _, scheme := range []string{ECDSASHA2NISTP224Scheme, ECDSASHA2NISTP256Scheme, ECDSASHA2NISTP384Scheme,
+		ECDSASHA2NISTP521Scheme} {
+		RegisterScheme(ECDSAKeyType, scheme, newECDSASignerVerifier)
+	}
+	RegisterScheme(ED25519KeyType, ED25519Scheme, newED25519SignerVerifier)
+}
+
+/*
+RegisterKeyType registers a key type, e.g. "gpg", with the function, which
+validates the key values of keys of that type, see ValidateKeyVal.  Keys of
+the type are only valid, if at least one scheme is registered for it, see
+RegisterScheme.  Registering a key type again replaces its validation
+function.
+*/
+func RegisterKeyType(keyType string, validateKeyVal func(key Key) error) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.validateKeyVal[keyType] = validateKeyVal
+}
+
+/*
+RegisterScheme registers a signature scheme of the passed key type, with the
+function, which returns the SignerVerifier of keys of that key type and
+scheme, see NewSignerVerifier.  The function may be nil for schemes, whose
+signatures cannot be created or verified with a SignerVerifier, e.g. because
+they are verified with other keys than the signing key.  Registering a scheme
+again replaces its function.  Keys of registered schemes are valid, see
+ValidateKey, hence registering allows other projects to support further
+signature schemes, without changes to this package.
+*/
+func RegisterScheme(keyType string, scheme string, newSignerVerifier SignerVerifierFunc) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	name := keyType + "/" + scheme
+	if _, ok := registry.signerVerifier[name]; !ok {
+		registry.schemes[keyType] = append(registry.schemes[keyType], scheme)
+	}
+	registry.signerVerifier[name] = newSignerVerifier
+}
+
+// SupportedSchemes returns the registered schemes of the passed key type in
+// order of registration, or nil, if the key type is not supported.
+func SupportedSchemes(keyType string) []string {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	return append([]string(nil), registry.schemes[keyType]...)
+}
+
+// keyValValidator returns the registered validation function of the key
+// values of the passed key type, or nil, see RegisterKeyType.
+func keyValValidator(keyType string) func(Key) error {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	return registry.validateKeyVal[keyType]
+}
+
+/*
+NewSignerVerifier returns the SignerVerifier of the passed key, as created by
+the function registered for its key type and scheme, see RegisterScheme.  For
+keys of unregistered key types or schemes, or of schemes without
+SignerVerifier, ErrUnsupportedKeyType is returned.
+*/
+func NewSignerVerifier(key Key) (SignerVerifier, error) {
+	registry.mu.RLock()
+	newSignerVerifier := registry.signerVerifier[key.KeyType+"/"+key.Scheme]
+	registry.mu.RUnlock()
+	if newSignerVerifier == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedKeyType, key.KeyType)
+	}
+	return newSignerVerifier(key)
+}
+
+// newED25519SignerVerifier returns the SignerVerifier of the securesystemslib
+// for the passed ed25519 key.
+func newED25519SignerVerifier(key Key) (SignerVerifier, error) {
+	sslibKey := sslibKeyFromKey(key)
+	sv, err := signerverifier.NewED25519SignerVerifierFromSSLibKey(&sslibKey)
+	if err != nil {
+		return nil, err
+	}
+	return sv, nil
+}
+
+// newECDSASignerVerifier returns the SignerVerifier of the securesystemslib
+// for the passed ecdsa key, whose public key must be PEM encoded.
+func newECDSASignerVerifier(key Key) (SignerVerifier, error) {
+	sslibKey := sslibKeyFromKey(key)
+	public, err := publicKeyPEM(key)
+	if err != nil {
+		return nil, err
+	}
+	sslibKey.KeyVal.Public = public
+	sv, err := signerverifier.NewECDSASignerVerifierFromSSLibKey(&sslibKey)
+	if err != nil {
+		return nil, err
+	}
+	return sv, nil
+}
+
+// sslibKeyFromKey returns the passed key as key of the signerverifier package
+// of the securesystemslib.
+func sslibKeyFromKey(key Key) signerverifier.SSLibKey {
+	return signerverifier.SSLibKey{
+		KeyType:             key.KeyType,
+		KeyIDHashAlgorithms: key.KeyIDHashAlgorithms,
+		KeyID:               key.KeyID,
+		Scheme:              key.Scheme,
+		KeyVal: signerverifier.KeyVal{
+			Public:      key.KeyVal.Public,
+			Private:     key.KeyVal.Private,
+			Certificate: key.KeyVal.Certificate,
+		},
+	}
+}
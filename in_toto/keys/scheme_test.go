@@ -0,0 +1,115 @@
+package keys
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// prefixSignerVerifier is a SignerVerifier of a test scheme, whose signatures
+// are the signed data prefixed with the public key.
+type prefixSignerVerifier struct {
+	key Key
+}
+
+func (sv prefixSignerVerifier) Sign(ctx context.Context, data []byte) ([]byte, error) {
+	return append([]byte(sv.key.KeyVal.Public), data...), nil
+}
+
+func (sv prefixSignerVerifier) Verify(ctx context.Context, data []byte, sig []byte) error {
+	if string(sig) != sv.key.KeyVal.Public+string(data) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func (sv prefixSignerVerifier) KeyID() (string, error) {
+	return sv.key.KeyID, nil
+}
+
+func (sv prefixSignerVerifier) Public() crypto.PublicKey {
+	return sv.key.KeyVal.Public
+}
+
+func TestRegisterScheme(t *testing.T) {
+	key := Key{
+		KeyID:   "abcd",
+		KeyType: "prefix",
+		Scheme:  "prefix-v1",
+		KeyVal:  KeyVal{Public: "public"},
+	}
+	assert.ErrorIs(t, ValidateKey(key), ErrUnsupportedKeyType)
+	_, err := NewSignerVerifier(key)
+	assert.ErrorIs(t, err, ErrUnsupportedKeyType)
+
+	RegisterKeyType("prefix", func(key Key) error {
+		if key.KeyVal.Public == "" {
+			return ErrInvalidKey
+		}
+		return nil
+	})
+	RegisterScheme("prefix", "prefix-v1", func(key Key) (SignerVerifier, error) {
+		return prefixSignerVerifier{key: key}, nil
+	})
+	RegisterScheme("prefix", "prefix-v0", nil)
+	assert.Equal(t, []string{"prefix-v1", "prefix-v0"}, SupportedSchemes("prefix"))
+
+	assert.Nil(t, ValidateKey(key))
+	assert.Nil(t, ValidateKeyVal(key))
+	assert.ErrorIs(t, ValidateKeyVal(Key{KeyType: "prefix"}), ErrInvalidKey)
+	otherScheme := key
+	otherScheme.Scheme = "prefix-v2"
+	assert.ErrorIs(t, ValidateKey(otherScheme), ErrSchemeKeyTypeMismatch)
+
+	sv, err := NewSignerVerifier(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := sv.Sign(context.Background(), []byte("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, sv.Verify(context.Background(), []byte("data"), sig))
+	assert.ErrorIs(t, sv.Verify(context.Background(), []byte("tampered"), sig), ErrInvalidSignature)
+
+	// Schemes without SignerVerifier are valid, but cannot sign
+	key.Scheme = "prefix-v0"
+	assert.Nil(t, ValidateKey(key))
+	_, err = NewSignerVerifier(key)
+	assert.ErrorIs(t, err, ErrUnsupportedKeyType)
+}
+
+func TestNewSignerVerifier(t *testing.T) {
+	for _, path := range []string{"dan", "carol", "frank"} {
+		var key Key
+		if err := key.LoadKeyDefaults(path); err != nil {
+			t.Fatal(err)
+		}
+		sv, err := NewSignerVerifier(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyID, err := sv.KeyID()
+		assert.Nil(t, err)
+		assert.Equal(t, key.KeyID, keyID, path)
+		public, err := key.CryptoPublicKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.True(t, public.(interface{ Equal(crypto.PublicKey) bool }).Equal(sv.Public()), path)
+
+		sig, err := sv.Sign(context.Background(), []byte("data"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Nil(t, sv.Verify(context.Background(), []byte("data"), sig), path)
+		err = sv.Verify(context.Background(), []byte("tampered"), sig)
+		assert.NotNil(t, err, path)
+		if key.KeyType == RSAKeyType {
+			assert.True(t, errors.Is(err, ErrInvalidSignature), path)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package keys
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rsa"
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/ssh"
+)
+
+/*
+ParseSSHPublicKey parses a public key in OpenSSH format, e.g. the contents of
+an 'id_ed25519.pub' file or a line of an 'authorized_keys' file, with or
+without options and comment.  ssh-ed25519, ssh-rsa and ecdsa-sha2-nistp* keys
+are supported.  The key is loaded with the default scheme and key id hash
+algorithms of its type, see LoadKeyDefaults, except for RSA keys, which use
+the "rsassa-pkcs1v15-sha256" scheme, because ssh-agents do not create
+RSASSA-PSS signatures.
+*/
+func ParseSSHPublicKey(data []byte) (Key, error) {
+	sshKey, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return Key{}, fmt.Errorf("%w: %s", ErrInvalidKey, err)
+	}
+	return sshPublicKeyToKey(sshKey)
+}
+
+/*
+LoadSSHPublicKeys loads all public keys of the OpenSSH 'authorized_keys'
+formatted file at the passed path, see ParseSSHPublicKey, and returns them by
+key id, e.g. to use them as functionary keys.  Empty lines and comments are
+skipped.
+*/
+func LoadSSHPublicKeys(path string) (map[string]Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]Key)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		key, err := ParseSSHPublicKey(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d of %s: %w", lineNumber, path, err)
+		}
+		keys[key.KeyID] = key
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// isSSHPublicKey reports whether the passed data starts like a public key in
+// OpenSSH format, i.e. with a key type, which PEM and JSON keys do not.
+func isSSHPublicKey(data []byte) bool {
+	for _, prefix := range []string{ssh.KeyAlgoED25519 + " ", ssh.KeyAlgoRSA + " ", "ecdsa-sha2-nistp"} {
+		if bytes.HasPrefix(data, []byte(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// sshPublicKeyToKey returns the key of the passed SSH public key, see
+// ParseSSHPublicKey.
+func sshPublicKeyToKey(sshKey ssh.PublicKey) (Key, error) {
+	public, ok := sshKey.(ssh.CryptoPublicKey)
+	if !ok {
+		return Key{}, fmt.Errorf("%w: ssh key type '%s'", ErrUnsupportedKeyType, sshKey.Type())
+	}
+	cryptoKey := public.CryptoPublicKey()
+	scheme, keyIDHashAlgorithms, err := DefaultScheme(cryptoKey)
+	if err != nil {
+		return Key{}, err
+	}
+	if _, ok := cryptoKey.(*rsa.PublicKey); ok {
+		scheme = RSASSAPKCS1v15SHA256Scheme
+	}
+	return NewKey(cryptoKey, scheme, keyIDHashAlgorithms)
+}
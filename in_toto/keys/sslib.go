@@ -0,0 +1,346 @@
+package keys
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// ErrEncryptedKeyNoPassphrase is returned when an encrypted key is loaded
+// without a passphrase.
+var ErrEncryptedKeyNoPassphrase = errors.New("key is encrypted but no passphrase was provided")
+
+// ErrDecryptionFailed is returned when an encrypted key cannot be decrypted,
+// e.g. because of a wrong passphrase or a corrupted key file.
+var ErrDecryptionFailed = errors.New("decryption failed: wrong passphrase or corrupted key")
+
+const (
+	// sslibEncryptionDelimiter separates the components of a key encrypted
+	// by securesystemslib.
+	sslibEncryptionDelimiter = "@@@@"
+	// sslibDerivedKeyLength is the length of the symmetric key securesystemslib
+	// derives from the passphrase (AES-256).
+	sslibDerivedKeyLength = 32
+	// sslibSaltSize and sslibIterations are the PBKDF2 parameters used by
+	// securesystemslib to encrypt keys.
+	sslibSaltSize   = 16
+	sslibIterations = 100000
+)
+
+// sslibKeyIDHashAlgorithms are the keyid hash algorithms securesystemslib
+// computes key IDs with, see loadSSLibKeyJSON.
+var sslibKeyIDHashAlgorithms = []string{"sha256", "sha512"}
+
+/*
+PassphraseFunc is called to obtain the passphrase of an encrypted key, e.g. by
+prompting the user.  It is only called, if the key to be loaded is encrypted.
+*/
+type PassphraseFunc func() ([]byte, error)
+
+/*
+decryptSSLibKey decrypts a key in the encrypted format produced by
+securesystemslib, e.g. via `in-toto-keygen -p`.  The format is:
+
+	<hex salt>@@@@<iterations>@@@@<hex iv>@@@@<hex ciphertext>@@@@<hex hmac>
+
+The symmetric key is derived from the passphrase via PBKDF2-HMAC-SHA256, the
+ciphertext is encrypted with AES-256-CTR and authenticated with HMAC-SHA256.
+On success decryptSSLibKey returns the plaintext, i.e. the JSON representation
+of the key.
+*/
+func decryptSSLibKey(encrypted []byte, passphrase []byte) ([]byte, error) {
+	parts := strings.Split(strings.TrimSpace(string(encrypted)), sslibEncryptionDelimiter)
+	if len(parts) != 5 {
+		return nil, fmt.Errorf("%w: invalid encrypted key format", ErrDecryptionFailed)
+	}
+
+	salt, err := hex.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid salt: %s", ErrDecryptionFailed, err)
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations < 1 {
+		return nil, fmt.Errorf("%w: invalid iterations '%s'", ErrDecryptionFailed, parts[1])
+	}
+	iv, err := hex.DecodeString(parts[2])
+	if err != nil || len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf("%w: invalid iv", ErrDecryptionFailed)
+	}
+	ciphertext, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid ciphertext: %s", ErrDecryptionFailed, err)
+	}
+	expectedMAC, err := hex.DecodeString(parts[4])
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid hmac: %s", ErrDecryptionFailed, err)
+	}
+
+	derivedKey := pbkdf2.Key(passphrase, salt, iterations, sslibDerivedKeyLength, sha256.New)
+
+	mac := hmac.New(sha256.New, derivedKey)
+	mac.Write(ciphertext)
+	if !hmac.Equal(mac.Sum(nil), expectedMAC) {
+		return nil, ErrDecryptionFailed
+	}
+
+	block, err := aes.NewCipher(derivedKey)
+	if err != nil {
+		return nil, err
+	}
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCTR(block, iv).XORKeyStream(plaintext, ciphertext)
+
+	return plaintext, nil
+}
+
+/*
+encryptSSLibKey encrypts the passed plaintext, i.e. the JSON representation of
+a key, with the passed passphrase in the format produced by securesystemslib,
+see decryptSSLibKey.
+*/
+func encryptSSLibKey(plaintext []byte, passphrase []byte) ([]byte, error) {
+	salt := make([]byte, sslibSaltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	iv := make([]byte, aes.BlockSize)
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, err
+	}
+
+	derivedKey := pbkdf2.Key(passphrase, salt, sslibIterations, sslibDerivedKeyLength, sha256.New)
+	block, err := aes.NewCipher(derivedKey)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext := make([]byte, len(plaintext))
+	cipher.NewCTR(block, iv).XORKeyStream(ciphertext, plaintext)
+
+	mac := hmac.New(sha256.New, derivedKey)
+	mac.Write(ciphertext)
+
+	return []byte(strings.Join([]string{
+		hex.EncodeToString(salt),
+		strconv.Itoa(sslibIterations),
+		hex.EncodeToString(iv),
+		hex.EncodeToString(ciphertext),
+		hex.EncodeToString(mac.Sum(nil)),
+	}, sslibEncryptionDelimiter)), nil
+}
+
+/*
+isSSLibEncryptedKey returns true if the passed key file contents look like a
+key encrypted by securesystemslib (as opposed to a plain JSON key).
+*/
+func isSSLibEncryptedKey(data []byte) bool {
+	return bytes.Contains(data, []byte(sslibEncryptionDelimiter))
+}
+
+/*
+loadSSLibKeyJSON loads a key in securesystemslib JSON format into the key
+object.  For ed25519 keys securesystemslib only stores the 32 byte seed as
+private key, which is expanded to the full private key as used by this
+library.  RSA and ECDSA keys store PEM encoded keys in the keyval field, or
+DER encoded public keys, see DecodePublicKey, and the public key value
+is kept as is, e.g. with trailing newline.  The key ID is
+regenerated and must match the key ID in the JSON, if there is one.  Like
+securesystemslib does, the key ID may also be computed with the sha256 and
+sha512 keyid hash algorithms, in this order, whatever the keyid hash
+algorithms of the key are, which is the key ID of keys without one in the
+JSON.
+*/
+func (k *Key) loadSSLibKeyJSON(data []byte) error {
+	var sslibKey Key
+	if err := json.Unmarshal(data, &sslibKey); err != nil {
+		return fmt.Errorf("failed to decode securesystemslib key: %w", err)
+	}
+
+	switch sslibKey.KeyType {
+	case ED25519KeyType:
+		pubKeyBytes, err := hex.DecodeString(sslibKey.KeyVal.Public)
+		if err != nil || len(pubKeyBytes) != ed25519.PublicKeySize {
+			return fmt.Errorf("%w: invalid ed25519 public key", ErrInvalidKey)
+		}
+		var privKeyBytes []byte
+		if sslibKey.KeyVal.Private != "" {
+			privKeyBytes, err = hex.DecodeString(sslibKey.KeyVal.Private)
+			if err != nil {
+				return fmt.Errorf("%w: invalid ed25519 private key", ErrInvalidKey)
+			}
+			switch len(privKeyBytes) {
+			case ed25519.SeedSize:
+				privKeyBytes = ed25519.NewKeyFromSeed(privKeyBytes)
+			case ed25519.PrivateKeySize:
+			default:
+				return fmt.Errorf("%w: invalid ed25519 private key size", ErrInvalidKey)
+			}
+			derivedPubKey := ed25519.PrivateKey(privKeyBytes).Public().(ed25519.PublicKey)
+			if !bytes.Equal(derivedPubKey, pubKeyBytes) {
+				return fmt.Errorf("%w: ed25519 private and public key do not match", ErrInvalidKey)
+			}
+		}
+		if err := k.setKeyComponents(pubKeyBytes, privKeyBytes, ED25519KeyType, sslibKey.Scheme, sslibKey.KeyIDHashAlgorithms); err != nil {
+			return err
+		}
+	case RSAKeyType, ECDSAKeyType:
+		var pemData *pem.Block
+		var keyObj interface{}
+		var err error
+		if sslibKey.KeyVal.Private != "" {
+			pemData, keyObj, err = DecodePEM([]byte(sslibKey.KeyVal.Private), nil)
+		} else {
+			pemData, keyObj, err = DecodePublicKey(sslibKey.KeyVal.Public)
+		}
+		if err != nil {
+			return err
+		}
+		if err := k.loadKey(keyObj, pemData, sslibKey.Scheme, sslibKey.KeyIDHashAlgorithms); err != nil {
+			return err
+		}
+		// securesystemslib keeps the public key value as is, e.g. with the
+		// trailing newline of the PEM of its ecdsa keys, or hex encoded DER
+		// of other tools, which is part of the key ID
+		if public := sslibKey.KeyVal.Public; public != "" && public != k.KeyVal.Public {
+			if err := k.setSSLibPublicKey(public); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedKeyType, sslibKey.KeyType)
+	}
+
+	// securesystemslib computes key IDs with its default keyid hash
+	// algorithms, whatever the keyid hash algorithms of the key are, unlike
+	// this library, which only differs for keys with other algorithms
+	if sslibKey.KeyID != k.KeyID {
+		keyID, err := computeKeyID(*k, sslibKeyIDHashAlgorithms)
+		if err != nil {
+			return err
+		}
+		k.KeyID = keyID
+	}
+
+	if sslibKey.KeyID != "" && sslibKey.KeyID != k.KeyID {
+		return fmt.Errorf("%w: key ID '%s' does not match computed key ID '%s'",
+			ErrInvalidKey, sslibKey.KeyID, k.KeyID)
+	}
+
+	return nil
+}
+
+/*
+setSSLibPublicKey replaces the PEM encoded public key of the rsa or ecdsa key
+with the passed public key value, as stored by securesystemslib, if both
+encode the same public key, see DecodePublicKey.  Otherwise, an ErrInvalidKey is returned.
+*/
+func (k *Key) setSSLibPublicKey(public string) error {
+	expected, err := k.CryptoPublicKey()
+	if err != nil {
+		return err
+	}
+	actual, err := Key{KeyType: k.KeyType, KeyVal: KeyVal{Public: public}}.CryptoPublicKey()
+	if err != nil {
+		return err
+	}
+	equal, ok := expected.(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !equal.Equal(actual) {
+		return fmt.Errorf("%w: private and public key do not match", ErrInvalidKey)
+	}
+	k.KeyVal.Public = public
+	return nil
+}
+
+/*
+LoadSSLibKey loads a key in securesystemslib JSON format from the passed path
+into the key object, as written by the Python in-toto and securesystemslib
+tooling, e.g. `in-toto-keygen`.  The key may be stored as plain JSON or
+encrypted, e.g. via `in-toto-keygen -p`, in which case the passed passphrase
+is used for decryption.  See LoadSSLibKeyReader for details.
+*/
+func (k *Key) LoadSSLibKey(path string, passphrase []byte) error {
+	keyFile, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer keyFile.Close()
+
+	if err := k.LoadSSLibKeyReader(keyFile, passphrase); err != nil {
+		return err
+	}
+
+	return keyFile.Close()
+}
+
+/*
+LoadSSLibKeyWithPassphraseFunc behaves like LoadSSLibKey, but obtains the
+passphrase from the passed function, which is only called if the key at the
+passed path is encrypted.  This is useful for interactive prompts.
+*/
+func (k *Key) LoadSSLibKeyWithPassphraseFunc(path string, passphraseFunc PassphraseFunc) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var passphrase []byte
+	if isSSLibEncryptedKey(data) {
+		if passphraseFunc == nil {
+			return ErrEncryptedKeyNoPassphrase
+		}
+		passphrase, err = passphraseFunc()
+		if err != nil {
+			return err
+		}
+	}
+
+	return k.LoadSSLibKeyReader(bytes.NewReader(data), passphrase)
+}
+
+/*
+LoadSSLibKeyReader loads a key in securesystemslib JSON format from the passed
+reader into the key object.  Encrypted keys are decrypted using the passed
+passphrase, an ErrEncryptedKeyNoPassphrase is returned if the passphrase is
+empty, and an ErrDecryptionFailed if the passphrase is wrong.  For plain JSON
+keys the passphrase is ignored.  The following key types are supported:
+
+  - ed25519 (hex encoded keys)
+  - rsa (PEM encoded keys, or hex encoded DER public keys)
+  - ecdsa (PEM encoded keys, or hex encoded DER public keys)
+*/
+func (k *Key) LoadSSLibKeyReader(r io.Reader, passphrase []byte) error {
+	if r == nil {
+		return ErrInvalidKey
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	if isSSLibEncryptedKey(data) {
+		if len(passphrase) == 0 {
+			return ErrEncryptedKeyNoPassphrase
+		}
+		data, err = decryptSSLibKey(data, passphrase)
+		if err != nil {
+			return err
+		}
+	}
+
+	return k.loadSSLibKeyJSON(data)
+}
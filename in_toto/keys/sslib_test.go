@@ -0,0 +1,20 @@
+package keys
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryptSSLibKey(t *testing.T) {
+	encrypted, err := encryptSSLibKey([]byte(`{"keytype": "ed25519"}`), []byte("123"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, isSSLibEncryptedKey(encrypted))
+	decrypted, err := decryptSSLibKey(encrypted, []byte("123"))
+	assert.Nil(t, err)
+	assert.Equal(t, `{"keytype": "ed25519"}`, string(decrypted))
+	_, err = decryptSSLibKey(encrypted, []byte("1234"))
+	assert.ErrorIs(t, err, ErrDecryptionFailed)
+}
@@ -0,0 +1,246 @@
+package keys
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrEmptyKeyField will be thrown if a field in our Key struct is empty.
+var ErrEmptyKeyField = errors.New("empty field in key")
+
+// ErrInvalidHexString will be thrown, if a string doesn't match a hex string.
+var ErrInvalidHexString = errors.New("invalid hex string")
+
+// ErrSchemeKeyTypeMismatch will be thrown, if the given scheme and key type are not supported together.
+var ErrSchemeKeyTypeMismatch = errors.New("the scheme and key type are not supported together")
+
+// ErrUnsupportedKeyIDHashAlgorithms will be thrown, if the specified KeyIDHashAlgorithms is not supported.
+var ErrUnsupportedKeyIDHashAlgorithms = errors.New("the given keyID hash algorithm is not supported")
+
+// ErrKeyKeyTypeMismatch will be thrown, if the specified keyType does not match the key
+var ErrKeyKeyTypeMismatch = errors.New("the given key does not match its key type")
+
+// ErrNoPublicKey gets returned when the private key value is not empty.
+var ErrNoPublicKey = errors.New("the given key is not a public key")
+
+// ErrCurveSizeSchemeMismatch gets returned, when the scheme and curve size are incompatible
+// for example: curve size = "521" and scheme = "ecdsa-sha2-nistp224"
+var ErrCurveSizeSchemeMismatch = errors.New("the scheme does not match the curve size")
+
+/*
+MatchECDSAScheme checks if the scheme suffix, matches the ecdsa key
+curve size. We do not need a full regex match here, because
+our ValidateKey function is already checking for a valid scheme string.
+*/
+func MatchECDSAScheme(curveSize int, scheme string) error {
+	if !strings.HasSuffix(scheme, strconv.Itoa(curveSize)) {
+		return ErrCurveSizeSchemeMismatch
+	}
+	return nil
+}
+
+/*
+validateHexString is used to validate that a string passed to it contains
+only valid hexadecimal characters.
+*/
+func validateHexString(str string) error {
+	if str == "" || strings.Trim(str, "0123456789abcdefABCDEF") != "" {
+		return fmt.Errorf("%w: %s", ErrInvalidHexString, str)
+	}
+	return nil
+}
+
+/*
+ValidateKeyVal validates the KeyVal struct. In case of an ed25519 key,
+it will check for a hex string for private and public key. In case of rsa
+and ecdsa keys, ValidateKeyVal will try to decode the PEM block, or the DER
+encoded public key, see DecodePublicKey. If this succeeds, we have a valid
+key in our KeyVal struct.  Key values of other key types are validated by the
+function passed to RegisterKeyType.  On success it will return nil
+on failure it will return the corresponding error. This can be either
+an ErrInvalidHexString, an ErrNoPEMBlock or an ErrUnsupportedKeyType
+if the KeyType is unknown.
+*/
+func ValidateKeyVal(key Key) error {
+	validate := keyValValidator(key.KeyType)
+	if validate == nil {
+		return ErrUnsupportedKeyType
+	}
+	return validate(key)
+}
+
+// validateEd25519KeyVal validates the hex encoded key value of ed25519 keys,
+// see ValidateKeyVal.
+func validateEd25519KeyVal(key Key) error {
+	// We cannot use matchPublicKeyKeyType or matchPrivateKeyKeyType here,
+	// because we retrieve the key not from PEM. Hence we are dealing with
+	// plain ed25519 key bytes. These bytes can't be typechecked like in the
+	// matchKeyKeytype functions.
+	err := validateHexString(key.KeyVal.Public)
+	if err != nil {
+		return err
+	}
+	if key.KeyVal.Private != "" {
+		err := validateHexString(key.KeyVal.Private)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validatePEMKeyVal validates the PEM encoded key value of rsa and ecdsa
+// keys, see ValidateKeyVal.
+func validatePEMKeyVal(key Key) error {
+	// We do not need the pemData here, so we can throw it away via '_'
+	_, parsedKey, err := DecodePublicKey(key.KeyVal.Public)
+	if err != nil {
+		return err
+	}
+	err = matchPublicKeyKeyType(parsedKey, key.KeyType)
+	if err != nil {
+		return err
+	}
+	if key.KeyVal.Private != "" {
+		// We do not need the pemData here, so we can throw it away via '_'
+		_, parsedKey, err := DecodePEM([]byte(key.KeyVal.Private), nil)
+		if err != nil {
+			return err
+		}
+		err = matchPrivateKeyKeyType(parsedKey, key.KeyType)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+matchPublicKeyKeyType validates an interface if it can be asserted to a
+the RSA or ECDSA public key type. We can only check RSA and ECDSA this way,
+because we are storing them in PEM format. Ed25519 keys are stored as plain
+ed25519 keys encoded as hex strings, thus we have no metadata for them.
+This function will return nil on success. If the key type does not match
+it will return an ErrKeyKeyTypeMismatch.
+*/
+func matchPublicKeyKeyType(key interface{}, keyType string) error {
+	switch key.(type) {
+	case *rsa.PublicKey:
+		if keyType != RSAKeyType {
+			return ErrKeyKeyTypeMismatch
+		}
+	case *ecdsa.PublicKey:
+		if keyType != ECDSAKeyType {
+			return ErrKeyKeyTypeMismatch
+		}
+	default:
+		return ErrInvalidKey
+	}
+	return nil
+}
+
+/*
+matchPrivateKeyKeyType validates an interface if it can be asserted to a
+the RSA or ECDSA private key type. We can only check RSA and ECDSA this way,
+because we are storing them in PEM format. Ed25519 keys are stored as plain
+ed25519 keys encoded as hex strings, thus we have no metadata for them.
+This function will return nil on success. If the key type does not match
+it will return an ErrKeyKeyTypeMismatch.
+*/
+func matchPrivateKeyKeyType(key interface{}, keyType string) error {
+	// we can only check RSA and ECDSA this way, because we are storing them in PEM
+	// format. ed25519 keys are stored as plain ed25519 keys encoded as hex strings
+	// so we have no metadata for them.
+	switch key.(type) {
+	case *rsa.PrivateKey:
+		if keyType != RSAKeyType {
+			return ErrKeyKeyTypeMismatch
+		}
+	case *ecdsa.PrivateKey:
+		if keyType != ECDSAKeyType {
+			return ErrKeyKeyTypeMismatch
+		}
+	default:
+		return ErrInvalidKey
+	}
+	return nil
+}
+
+/*
+MatchKeyTypeScheme checks if the specified scheme matches our specified
+keyType, i.e. if it is registered for the key type, see RegisterScheme. If
+the keyType is not supported it will return an ErrUnsupportedKeyType. If the
+keyType and scheme do not match it will return an ErrSchemeKeyTypeMismatch.
+If the specified keyType and scheme are compatible MatchKeyTypeScheme will
+return nil.
+*/
+func MatchKeyTypeScheme(key Key) error {
+	schemes := SupportedSchemes(key.KeyType)
+	if len(schemes) == 0 {
+		return fmt.Errorf("%w: %s", ErrUnsupportedKeyType, key.KeyType)
+	}
+	for _, scheme := range schemes {
+		if key.Scheme == scheme {
+			return nil
+		}
+	}
+	return ErrSchemeKeyTypeMismatch
+}
+
+/*
+ValidateKey checks the outer key object (everything, except the KeyVal struct).
+It verifies the keyID for being a hex string and checks for empty fields.
+On success it will return nil, on error it will return the corresponding error.
+Either: ErrEmptyKeyField or ErrInvalidHexString.
+*/
+func ValidateKey(key Key) error {
+	err := validateHexString(key.KeyID)
+	if err != nil {
+		return err
+	}
+	// This probably can be done more elegant with reflection
+	// but we care about performance, do we?!
+	if key.KeyType == "" {
+		return fmt.Errorf("%w: keytype", ErrEmptyKeyField)
+	}
+	if key.KeyVal.Public == "" && key.KeyVal.Certificate == "" {
+		return fmt.Errorf("%w: keyval.public and keyval.certificate cannot both be blank", ErrEmptyKeyField)
+	}
+	if key.Scheme == "" {
+		return fmt.Errorf("%w: scheme", ErrEmptyKeyField)
+	}
+	err = MatchKeyTypeScheme(key)
+	if err != nil {
+		return err
+	}
+	// only check for supported KeyIDHashAlgorithms, if the variable has been set
+	if key.KeyIDHashAlgorithms != nil {
+		supported := make(map[string]bool)
+		for _, algorithm := range supportedKeyIDHashAlgorithms() {
+			supported[algorithm] = true
+		}
+		for _, algorithm := range key.KeyIDHashAlgorithms {
+			if !supported[algorithm] {
+				return fmt.Errorf("%w: %#v, supported are: %#v", ErrUnsupportedKeyIDHashAlgorithms,
+					key.KeyIDHashAlgorithms, supportedKeyIDHashAlgorithms())
+			}
+		}
+	}
+	return nil
+}
+
+/*
+ValidatePublicKey is a wrapper around ValidateKey. It test if the private key
+value in the key is empty and then validates the key via calling ValidateKey.
+On success it will return nil, on error it will return an ErrNoPublicKey error.
+*/
+func ValidatePublicKey(key Key) error {
+	if key.KeyVal.Private != "" {
+		return ErrNoPublicKey
+	}
+	return ValidateKey(key)
+}
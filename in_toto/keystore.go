@@ -0,0 +1,164 @@
+package in_toto
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/in-toto/in-toto-golang/in_toto/keys"
+)
+
+// ErrKeyNotInKeystore is returned when a keystore directory has no key file
+// for the requested key id.
+var ErrKeyNotInKeystore = errors.New("key not found in keystore")
+
+// keystorePublicKeySuffix is the file name suffix of public key files in a
+// keystore directory.
+const keystorePublicKeySuffix = ".pub"
+
+// keystoreKeyIDRegexp matches the file names of keystore key files, which are
+// named by key id.
+var keystoreKeyIDRegexp = regexp.MustCompile("^[0-9a-f]{64}$")
+
+/*
+LoadKeystorePublicKeys loads the public keys of a keystore directory, as
+written by the Python securesystemslib and in-toto tooling, e.g.
+`in-toto-keygen`, or by WriteKeystoreKey.  Public keys are stored in files
+with a ".pub" suffix, either in securesystemslib JSON format (ed25519 and
+ecdsa keys) or PEM encoded (rsa keys).  Key files that are named by key id,
+i.e. '<keyid>.pub', must contain the key of that id.  The keys are returned
+by key id, e.g. for use as layout keys.  All key files are loaded, and the
+failures of all invalid key files are returned, see MultiError.
+*/
+func LoadKeystorePublicKeys(dir string) (map[string]Key, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+keystorePublicKeySuffix))
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]Key, len(paths))
+	errs := &MultiError{}
+	for _, path := range paths {
+		key, err := loadKeystorePublicKey(path)
+		if err != nil {
+			errs.add(err)
+			continue
+		}
+		keys[key.KeyID] = key
+	}
+	if err := errs.err(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// loadKeystorePublicKey loads the public key file at the passed path of a
+// keystore directory, see LoadKeystorePublicKeys.
+func loadKeystorePublicKey(path string) (Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Key{}, err
+	}
+	key, err := keys.DecodeKey(data, nil)
+	if err != nil {
+		return Key{}, fmt.Errorf("invalid public key at %s: %w", path, err)
+	}
+	if err := checkKeystoreKeyID(path, key); err != nil {
+		return Key{}, err
+	}
+	// Public key files of private keys are not expected, but we must not
+	// return private keys as public keys
+	key.KeyVal.Private = ""
+	return key, nil
+}
+
+/*
+LoadKeystorePrivateKey loads the private key of the passed key id from a
+keystore directory, i.e. from the file named by the key id.  Like public keys,
+private keys are stored in securesystemslib JSON format, which may be
+encrypted, or PEM encoded, which may be encrypted, too, see
+LoadKeyWithPassphrase.  The passed function is only called for encrypted keys,
+to obtain the passphrase.  An ErrKeyNotInKeystore is returned if there is no
+key file for the key id.
+*/
+func LoadKeystorePrivateKey(dir string, keyID string, passphraseFunc PassphraseFunc) (Key, error) {
+	if !keystoreKeyIDRegexp.MatchString(keyID) {
+		return Key{}, fmt.Errorf("%w: invalid key id '%s'", ErrKeyNotInKeystore, keyID)
+	}
+	path := filepath.Join(dir, keyID)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Key{}, fmt.Errorf("%w: %s", ErrKeyNotInKeystore, keyID)
+	}
+	if err != nil {
+		return Key{}, err
+	}
+
+	var passphrase []byte
+	if keys.IsEncrypted(data) {
+		if passphraseFunc == nil {
+			return Key{}, ErrEncryptedKeyNoPassphrase
+		}
+		passphrase, err = passphraseFunc()
+		if err != nil {
+			return Key{}, err
+		}
+	}
+
+	key, err := keys.DecodeKey(data, passphrase)
+	if err != nil {
+		return Key{}, fmt.Errorf("invalid private key at %s: %w", path, err)
+	}
+	if key.KeyVal.Private == "" {
+		return Key{}, fmt.Errorf("%w: no private key at %s", ErrInvalidKey, path)
+	}
+	if err := checkKeystoreKeyID(path, key); err != nil {
+		return Key{}, err
+	}
+	return key, nil
+}
+
+// checkKeystoreKeyID checks that a key file named by key id contains the key
+// of that id.
+func checkKeystoreKeyID(path string, key Key) error {
+	name := strings.TrimSuffix(filepath.Base(path), keystorePublicKeySuffix)
+	if keystoreKeyIDRegexp.MatchString(name) && name != key.KeyID {
+		return fmt.Errorf("%w: key file %s contains key '%s'", ErrInvalidKey, path, key.KeyID)
+	}
+	return nil
+}
+
+/*
+WriteKeystoreKey writes the passed key to a keystore directory, using the
+conventions of the Python securesystemslib tooling: the public key is written
+to '<keyid>.pub', and, if the key has a private key, the private key to
+'<keyid>'.  Ed25519 and ecdsa keys are stored in securesystemslib JSON format,
+and private keys are encrypted in the securesystemslib format if a passphrase
+is passed.  RSA keys are stored PEM encoded, and private keys are encrypted
+with AES-256-CBC if a passphrase is passed.  Private key files are only
+readable by the owner.
+*/
+func WriteKeystoreKey(dir string, key Key, passphrase []byte) error {
+	publicData, err := EncodePublicKey(key)
+	if err != nil {
+		return err
+	}
+	var privateData []byte
+	if key.KeyVal.Private != "" {
+		privateData, err = EncodePrivateKey(key, passphrase)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := writeMetadataFile(filepath.Join(dir, key.KeyID+keystorePublicKeySuffix), publicData, 0644); err != nil {
+		return err
+	}
+	if privateData == nil {
+		return nil
+	}
+	return writeMetadataFile(filepath.Join(dir, key.KeyID), privateData, 0600)
+}
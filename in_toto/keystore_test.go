@@ -0,0 +1,127 @@
+package in_toto
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeystore(t *testing.T) {
+	dir := t.TempDir()
+	passphrase := []byte("correct horse")
+	passphraseFunc := func() ([]byte, error) { return passphrase, nil }
+
+	keys := map[string]Key{}
+	for _, path := range []string{"alice", "carol", "frank"} {
+		var key Key
+		if err := key.LoadKeyDefaults(path); err != nil {
+			t.Fatal(err)
+		}
+		keys[key.KeyID] = key
+	}
+	// Key files are named by key id, encrypted if a passphrase is passed
+	for keyID, key := range keys {
+		if err := WriteKeystoreKey(dir, key, passphrase); err != nil {
+			t.Fatal(err)
+		}
+		assert.FileExists(t, filepath.Join(dir, keyID+".pub"))
+		info, err := os.Stat(filepath.Join(dir, keyID))
+		if assert.Nil(t, err) && !testOSisWindows() {
+			assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+		}
+	}
+	// Keys without private key are stored as public key only
+	var ivan Key
+	if err := ivan.LoadSSLibKey("ivan.pub", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteKeystoreKey(dir, ivan, passphrase); err != nil {
+		t.Fatal(err)
+	}
+	assert.NoFileExists(t, filepath.Join(dir, ivan.KeyID))
+
+	publicKeys, err := LoadKeystorePublicKeys(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, publicKeys, 4)
+	assert.Contains(t, publicKeys, ivan.KeyID)
+	for keyID, key := range keys {
+		if assert.Contains(t, publicKeys, keyID) {
+			assert.Equal(t, key.KeyVal.Public, publicKeys[keyID].KeyVal.Public)
+			assert.Empty(t, publicKeys[keyID].KeyVal.Private)
+		}
+
+		privateKey, err := LoadKeystorePrivateKey(dir, keyID, passphraseFunc)
+		if assert.Nil(t, err, key.KeyType) {
+			assert.Equal(t, key.KeyVal.Private, privateKey.KeyVal.Private)
+			assert.Equal(t, keyID, privateKey.KeyID)
+		}
+
+		_, err = LoadKeystorePrivateKey(dir, keyID, nil)
+		assert.ErrorIs(t, err, ErrEncryptedKeyNoPassphrase)
+		_, err = LoadKeystorePrivateKey(dir, keyID, func() ([]byte, error) { return []byte("wrong"), nil })
+		assert.ErrorIs(t, err, ErrDecryptionFailed)
+	}
+
+	// Private keys are written unencrypted without passphrase
+	carolKeyID := "be6371bc627318218191ce0780fd3183cce6c36da02938a477d2e4dfae1804a6"
+	if err := WriteKeystoreKey(dir, keys[carolKeyID], nil); err != nil {
+		t.Fatal(err)
+	}
+	carol, err := LoadKeystorePrivateKey(dir, carolKeyID, nil)
+	if assert.Nil(t, err) {
+		assert.Equal(t, keys[carolKeyID].KeyVal.Private, carol.KeyVal.Private)
+	}
+
+	_, err = LoadKeystorePrivateKey(dir, ivan.KeyID, passphraseFunc)
+	assert.ErrorIs(t, err, ErrKeyNotInKeystore)
+	_, err = LoadKeystorePrivateKey(dir, "../alice", passphraseFunc)
+	assert.ErrorIs(t, err, ErrKeyNotInKeystore)
+	passphraseErr := errors.New("no tty")
+	_, err = LoadKeystorePrivateKey(dir, "70ca5750c2eda80b18f41f4ec5f92146789b5d68dd09577be422a0159bd13680",
+		func() ([]byte, error) { return nil, passphraseErr })
+	assert.ErrorIs(t, err, passphraseErr)
+
+	// Key files named by key id must contain the key of that id
+	if err := os.Rename(filepath.Join(dir, carolKeyID), filepath.Join(dir, ivan.KeyID)); err != nil {
+		t.Fatal(err)
+	}
+	_, err = LoadKeystorePrivateKey(dir, ivan.KeyID, nil)
+	assert.ErrorIs(t, err, ErrInvalidKey)
+	if err := os.Rename(filepath.Join(dir, carolKeyID+".pub"), filepath.Join(dir, ivan.KeyID+".pub")); err != nil {
+		t.Fatal(err)
+	}
+	_, err = LoadKeystorePublicKeys(dir)
+	assert.ErrorIs(t, err, ErrInvalidKey)
+}
+
+func TestLoadKeystorePythonKeys(t *testing.T) {
+	// Keys written by the Python tooling, named by key id
+	dir := t.TempDir()
+	for src, dst := range map[string]string{"ivan": ivanKeyID, "ivan.pub": ivanKeyID + ".pub",
+		"alice.pub": "70ca5750c2eda80b18f41f4ec5f92146789b5d68dd09577be422a0159bd13680.pub"} {
+		data, err := os.ReadFile(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, dst), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	publicKeys, err := LoadKeystorePublicKeys(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, publicKeys, 2)
+	assert.Contains(t, publicKeys, ivanKeyID)
+
+	key, err := LoadKeystorePrivateKey(dir, ivanKeyID, func() ([]byte, error) { return []byte("123"), nil })
+	if assert.Nil(t, err) {
+		assert.Equal(t, ivanKeyID, key.KeyID)
+	}
+}
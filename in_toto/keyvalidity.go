@@ -0,0 +1,177 @@
+package in_toto
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrKeyRevoked is returned when a link is signed with a functionary key,
+// which the layout marks as revoked.
+var ErrKeyRevoked = errors.New("functionary key revoked")
+
+// ErrKeyNotValid is returned when a link is signed with a functionary key
+// outside of the validity window of the key in the layout.
+var ErrKeyNotValid = errors.New("functionary key not valid")
+
+/*
+KeyValidity restricts the use of a functionary key of a layout.  Links signed
+with the key are only accepted between NotBefore and NotAfter, if set, which
+are in ISO8601DateSchema format.  A Revoked key is not accepted at all, e.g.
+because it was compromised, and Reason optionally documents why.  Validity is
+recorded in the KeyValidity of a layout by key ID, so that a key can be
+revoked by re-signing the layout, instead of shipping a new one, e.g.:
+
+	"key_validity": {
+	  "<keyid>": {
+	    "not_after": "2030-01-01T00:00:00Z"
+	  },
+	  "<keyid>": {
+	    "revoked": true,
+	    "reason": "key compromise"
+	  }
+	}
+*/
+type KeyValidity struct {
+	NotBefore string `json:"not_before,omitempty"`
+	NotAfter  string `json:"not_after,omitempty"`
+	Revoked   bool   `json:"revoked,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// validateKeyValidity checks that the passed validity is for one of the passed
+// layout keys and that its validity window is well-formed.
+func validateKeyValidity(keyID string, validity KeyValidity, keys map[string]Key) error {
+	if _, ok := keys[keyID]; !ok {
+		return fmt.Errorf("validity for unknown functionary key '%s'", keyID)
+	}
+	var notBefore, notAfter time.Time
+	var err error
+	if validity.NotBefore != "" {
+		if notBefore, err = time.Parse(ISO8601DateSchema, validity.NotBefore); err != nil {
+			return atPointer(fmt.Errorf("invalid not_before time of key '%s'", keyID),
+				[]interface{}{"not_before"}, "")
+		}
+	}
+	if validity.NotAfter != "" {
+		if notAfter, err = time.Parse(ISO8601DateSchema, validity.NotAfter); err != nil {
+			return atPointer(fmt.Errorf("invalid not_after time of key '%s'", keyID),
+				[]interface{}{"not_after"}, "")
+		}
+	}
+	if !notBefore.IsZero() && !notAfter.IsZero() && notAfter.Before(notBefore) {
+		return atPointer(fmt.Errorf("not_after time of key '%s' is before its not_before time", keyID),
+			[]interface{}{"not_after"}, "")
+	}
+	return nil
+}
+
+/*
+checkKeyValidity checks that the functionary key with the passed key ID is
+not revoked and valid at the passed time, i.e. when a link was signed with it,
+tolerating the passed clock skew, see KeyValidity.  A zero time is the current
+time.  Keys without validity are always valid.
+*/
+func (l *Layout) checkKeyValidity(keyID string, at time.Time, clockSkew time.Duration) error {
+	validity, ok := l.KeyValidity[keyID]
+	if !ok {
+		return nil
+	}
+	if validity.Revoked {
+		if validity.Reason != "" {
+			return fmt.Errorf("%w: '%s': %s", ErrKeyRevoked, keyID, validity.Reason)
+		}
+		return fmt.Errorf("%w: '%s'", ErrKeyRevoked, keyID)
+	}
+	if at.IsZero() {
+		at = time.Now()
+	}
+	if validity.NotBefore != "" {
+		notBefore, err := time.Parse(ISO8601DateSchema, validity.NotBefore)
+		if err != nil {
+			return err
+		}
+		if at.Add(clockSkew).Before(notBefore) {
+			return fmt.Errorf("%w: '%s' is not valid before %s", ErrKeyNotValid, keyID, validity.NotBefore)
+		}
+	}
+	if validity.NotAfter != "" {
+		notAfter, err := time.Parse(ISO8601DateSchema, validity.NotAfter)
+		if err != nil {
+			return err
+		}
+		if at.Add(-clockSkew).After(notAfter) {
+			return fmt.Errorf("%w: '%s' is not valid after %s", ErrKeyNotValid, keyID, validity.NotAfter)
+		}
+	}
+	return nil
+}
+
+/*
+RevokeKey marks the functionary key with the passed key ID as revoked, with an
+optional reason, so that links signed with it fail verification.  The key is
+kept in the layout, so that the revocation is documented.  The layout must be
+re-signed afterwards, see SetLayout.
+*/
+func (l *Layout) RevokeKey(keyID string, reason string) error {
+	if _, ok := l.Keys[keyID]; !ok {
+		return fmt.Errorf("cannot revoke unknown functionary key '%s'", keyID)
+	}
+	if l.KeyValidity == nil {
+		l.KeyValidity = map[string]KeyValidity{}
+	}
+	validity := l.KeyValidity[keyID]
+	validity.Revoked = true
+	validity.Reason = reason
+	l.KeyValidity[keyID] = validity
+	return nil
+}
+
+/*
+SetKeyValidity restricts links signed with the functionary key with the passed
+key ID to the passed validity window.  A zero time leaves the window open on
+that side.  The layout must be re-signed afterwards, see SetLayout.
+*/
+func (l *Layout) SetKeyValidity(keyID string, notBefore, notAfter time.Time) error {
+	if _, ok := l.Keys[keyID]; !ok {
+		return fmt.Errorf("cannot set validity of unknown functionary key '%s'", keyID)
+	}
+	if !notBefore.IsZero() && !notAfter.IsZero() && notAfter.Before(notBefore) {
+		return fmt.Errorf("validity of key '%s' ends before it starts", keyID)
+	}
+	if l.KeyValidity == nil {
+		l.KeyValidity = map[string]KeyValidity{}
+	}
+	validity := l.KeyValidity[keyID]
+	validity.NotBefore, validity.NotAfter = "", ""
+	if !notBefore.IsZero() {
+		validity.NotBefore = notBefore.UTC().Format(ISO8601DateSchema)
+	}
+	if !notAfter.IsZero() {
+		validity.NotAfter = notAfter.UTC().Format(ISO8601DateSchema)
+	}
+	l.KeyValidity[keyID] = validity
+	return nil
+}
+
+/*
+SetLayout replaces the layout of the passed Metablock or Envelope with the
+passed layout, e.g. after revoking a key with RevokeKey.  All signatures are
+removed, because they do not cover the new layout, so the metadata must be
+signed again, e.g. via Resign.
+*/
+func SetLayout(layoutEnv Metadata, layout Layout) error {
+	if _, ok := layoutEnv.GetPayload().(Layout); !ok {
+		return ErrNotLayout
+	}
+	switch m := layoutEnv.(type) {
+	case *Metablock:
+		m.Signed = layout
+		m.Signatures = []Signature{}
+	case *Envelope:
+		return m.SetPayload(layout)
+	default:
+		return ErrUnknownMetadataType
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package in_toto
+
+import (
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyLinkSignatureThresholdsKeyValidity(t *testing.T) {
+	keyID1 := "b7d643dec0a051096ee5d87221b5d91a33daa658699d30903e1cefb90c418401"
+	keyID2 := "d3ffd1086938b3698618adf088bf14b13db4c8ae19e4e78d73da49ee88492710"
+
+	mb, err := LoadMetadata("demo.layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	layout := mb.GetPayload().(Layout)
+	layout.Steps = []Step{{SupplyChainItem: SupplyChainItem{Name: "foo"},
+		Threshold: 2, PubKeys: []string{keyID1, keyID2}}}
+
+	link1, err := LoadMetadata("foo.b7d643de.link")
+	if err != nil {
+		t.Fatal(err)
+	}
+	link2, err := LoadMetadata("foo.d3ffd108.link")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stepsMetadata := map[string]map[string]Metadata{"foo": {keyID1: link1, keyID2: link2}}
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	verify := func(layout Layout, clockSkew time.Duration) error {
+		_, err := verifyLinkSignatureThresholds(layout, stepsMetadata, x509.NewCertPool(), x509.NewCertPool(),
+			now, clockSkew, nil, nil, nil)
+		return err
+	}
+
+	assert.Nil(t, verify(layout, 0))
+
+	// Links count only within the validity window of their key
+	if err := layout.SetKeyValidity(keyID2, now.Add(-time.Hour), now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, verify(layout, 0))
+	if err := layout.SetKeyValidity(keyID2, time.Time{}, now.Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	err = verify(layout, 0)
+	assert.ErrorIs(t, err, ErrThresholdNotMet)
+	assert.ErrorIs(t, err, ErrKeyNotValid)
+	assert.Nil(t, verify(layout, 5*time.Minute))
+	if err := layout.SetKeyValidity(keyID2, now.Add(time.Minute), time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	assert.ErrorIs(t, verify(layout, 0), ErrKeyNotValid)
+	assert.Equal(t, KeyValidity{NotBefore: "2025-06-01T00:01:00Z"}, layout.KeyValidity[keyID2])
+
+	// Links of revoked keys never count
+	if err := layout.SetKeyValidity(keyID2, time.Time{}, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := layout.RevokeKey(keyID2, "key compromise"); err != nil {
+		t.Fatal(err)
+	}
+	err = verify(layout, 0)
+	assert.ErrorIs(t, err, ErrKeyRevoked)
+	assert.ErrorContains(t, err, "key compromise")
+
+	assert.NotNil(t, layout.RevokeKey("abcd", ""))
+	assert.NotNil(t, layout.SetKeyValidity(keyID1, now, now.Add(-time.Hour)))
+}
+
+func TestValidateLayoutKeyValidity(t *testing.T) {
+	mb, err := LoadMetadata("demo.layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	layout := mb.GetPayload().(Layout)
+	keyID := layout.Steps[0].PubKeys[0]
+
+	layout.KeyValidity = map[string]KeyValidity{
+		keyID: {NotBefore: "2020-01-01T00:00:00Z", NotAfter: "2030-01-01T00:00:00Z"},
+	}
+	assert.Nil(t, validateLayout(layout))
+
+	invalid := []map[string]KeyValidity{
+		{"abcd": {Revoked: true}},
+		{keyID: {NotBefore: "yesterday"}},
+		{keyID: {NotAfter: "tomorrow"}},
+		{keyID: {NotBefore: "2030-01-01T00:00:00Z", NotAfter: "2020-01-01T00:00:00Z"}},
+	}
+	for _, keyValidity := range invalid {
+		layout.KeyValidity = keyValidity
+		assert.NotNil(t, validateLayout(layout), keyValidity)
+	}
+}
+
+func TestSetLayout(t *testing.T) {
+	var key Key
+	if err := key.LoadKeyDefaults("alice"); err != nil {
+		t.Fatal(err)
+	}
+	mb, err := LoadMetadata("demo.layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	layout := mb.GetPayload().(Layout)
+	keyID := layout.Steps[0].PubKeys[0]
+	if err := layout.RevokeKey(keyID, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	env, err := WrapMetablock(mb.(*Metablock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.Sign(key); err != nil {
+		t.Fatal(err)
+	}
+	for _, layoutEnv := range []Metadata{mb, env} {
+		if err := SetLayout(layoutEnv, layout); err != nil {
+			t.Fatal(err)
+		}
+		assert.Empty(t, layoutEnv.Sigs())
+		assert.True(t, layoutEnv.GetPayload().(Layout).KeyValidity[keyID].Revoked)
+		if err := Resign(layoutEnv, key, true); err != nil {
+			t.Fatal(err)
+		}
+		assert.Nil(t, layoutEnv.VerifySignature(key))
+	}
+
+	link, err := LoadMetadata("write-code.b7d643de.link")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.ErrorIs(t, SetLayout(link, layout), ErrNotLayout)
+}
@@ -0,0 +1,341 @@
+package in_toto
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/in-toto/in-toto-golang/in_toto/keys"
+)
+
+// ErrInvalidLayoutBuilder is returned by LayoutBuilder.Build, joined with the
+// errors found while the layout was built.
+var ErrInvalidLayoutBuilder = errors.New("invalid layout")
+
+/*
+LayoutBuilder constructs a Layout programmatically, validating each addition
+as it goes, i.e. the syntax of artifact rules, references to functionary keys
+and the uniqueness of step and inspection names.  Errors do not interrupt the
+chain of calls, they are collected and returned by Build, located with JSON
+pointers into the layout, see PointerError.  For example:
+
+	layout, err := NewLayout().
+		Expires(time.Now().AddDate(0, 1, 0)).
+		AddFunctionary(alice).
+		AddFunctionary(bob).
+		AddStep("build").
+		ExpectedCommand("go", "build", "./...").
+		ExpectedMaterials([]string{"ALLOW", "*"}).
+		ExpectedProducts([]string{"CREATE", "app"}).
+		Functionaries(alice.KeyID, bob.KeyID).
+		Threshold(2).
+		AddInspection("untar", "tar", "xfz", "app.tar.gz").
+		ExpectedMaterials([]string{"MATCH", "app", "WITH", "PRODUCTS", "FROM", "build"}).
+		Build()
+
+Functionaries must be added to the layout before steps reference them.  The
+built layout can be signed in a Metablock or an Envelope.
+*/
+type LayoutBuilder struct {
+	layout Layout
+	errs   []error
+}
+
+// NewLayout returns a LayoutBuilder for an empty layout.
+func NewLayout() *LayoutBuilder {
+	return &LayoutBuilder{layout: Layout{
+		Type:    "layout",
+		Steps:   []Step{},
+		Inspect: []Inspection{},
+		Keys:    map[string]Key{},
+	}}
+}
+
+// fail records the passed error located at the passed reference tokens.
+func (b *LayoutBuilder) fail(err error, tokens ...interface{}) {
+	b.errs = append(b.errs, atPointer(err, tokens, ""))
+}
+
+// Expires sets the expiration date of the layout.
+func (b *LayoutBuilder) Expires(expires time.Time) *LayoutBuilder {
+	b.layout.Expires = expires.UTC().Format(ISO8601DateSchema)
+	return b
+}
+
+// Readme sets the human readable description of the layout.
+func (b *LayoutBuilder) Readme(readme string) *LayoutBuilder {
+	b.layout.Readme = readme
+	return b
+}
+
+// ArtifactMatching sets the artifact matching mode of the layout, see
+// Layout.GetArtifactMatching.
+func (b *LayoutBuilder) ArtifactMatching(mode string) *LayoutBuilder {
+	b.layout.ArtifactMatching = mode
+	return b
+}
+
+// PatternSyntax sets the syntax of the artifact rule patterns of the layout,
+// see Layout.GetPatternSyntax.
+func (b *LayoutBuilder) PatternSyntax(syntax string) *LayoutBuilder {
+	b.layout.PatternSyntax = syntax
+	return b
+}
+
+/*
+AddFunctionary adds the public part of the passed key to the keys of the
+layout, so that steps can reference it, see StepBuilder.Functionaries.  A
+private key is accepted, e.g. a key also used to sign links, but only its
+public part is added.
+*/
+func (b *LayoutBuilder) AddFunctionary(key Key) *LayoutBuilder {
+	key.KeyVal.Private = ""
+	if err := keys.ValidatePublicKey(key); err != nil {
+		b.fail(fmt.Errorf("invalid functionary key '%s': %w", key.KeyID, err), "keys", key.KeyID)
+		return b
+	}
+	if _, ok := b.layout.Keys[key.KeyID]; ok {
+		b.fail(fmt.Errorf("functionary key '%s' added twice", key.KeyID), "keys", key.KeyID)
+		return b
+	}
+	b.layout.Keys[key.KeyID] = key
+	return b
+}
+
+/*
+AddRole adds a functionary role with the passed name, threshold and key ids,
+which must have been added with AddFunctionary, to the layout, so that steps
+can reference it, see StepBuilder.Role and FunctionaryRole.
+*/
+func (b *LayoutBuilder) AddRole(name string, threshold int, keyIDs ...string) *LayoutBuilder {
+	if _, ok := b.layout.Roles[name]; ok {
+		b.fail(fmt.Errorf("functionary role '%s' added twice", name), "roles", name)
+		return b
+	}
+	role := FunctionaryRole{KeyIDs: append([]string{}, keyIDs...), Threshold: threshold}
+	if err := validateRole(name, role, b.layout.Keys); err != nil {
+		b.fail(err, "roles", name)
+	}
+	if b.layout.Roles == nil {
+		b.layout.Roles = map[string]FunctionaryRole{}
+	}
+	b.layout.Roles[name] = role
+	return b
+}
+
+// addItemName checks that no step or inspection of the layout has the passed
+// name yet.
+func (b *LayoutBuilder) addItemName(name string, tokens ...interface{}) {
+	if name == "" {
+		b.fail(fmt.Errorf("name cannot be empty"), tokens...)
+		return
+	}
+	for _, step := range b.layout.Steps {
+		if step.Name == name {
+			b.fail(fmt.Errorf("non unique step or inspection name found: %s", name), tokens...)
+			return
+		}
+	}
+	for _, inspection := range b.layout.Inspect {
+		if inspection.Name == name {
+			b.fail(fmt.Errorf("non unique step or inspection name found: %s", name), tokens...)
+			return
+		}
+	}
+}
+
+/*
+AddStep adds a step with the passed name and a threshold of 1 to the layout and
+returns a StepBuilder to configure it.  The StepBuilder continues the chain of
+calls of the layout, e.g. to add further steps or to build the layout.
+*/
+func (b *LayoutBuilder) AddStep(name string) *StepBuilder {
+	i := len(b.layout.Steps)
+	b.addItemName(name, "steps", i, "name")
+	b.layout.Steps = append(b.layout.Steps, Step{
+		Type:            "step",
+		PubKeys:         []string{},
+		ExpectedCommand: []string{},
+		Threshold:       1,
+		SupplyChainItem: SupplyChainItem{
+			Name:              name,
+			ExpectedMaterials: [][]string{},
+			ExpectedProducts:  [][]string{},
+		},
+	})
+	return &StepBuilder{LayoutBuilder: b, index: i}
+}
+
+/*
+AddInspection adds an inspection with the passed name, which executes the
+passed command during verification, to the layout and returns an
+InspectionBuilder to configure it.  The InspectionBuilder continues the chain
+of calls of the layout.
+*/
+func (b *LayoutBuilder) AddInspection(name string, run ...string) *InspectionBuilder {
+	i := len(b.layout.Inspect)
+	b.addItemName(name, "inspect", i, "name")
+	if len(run) == 0 {
+		b.fail(fmt.Errorf("inspection '%s' has no command", name), "inspect", i, "run")
+	}
+	b.layout.Inspect = append(b.layout.Inspect, Inspection{
+		Type: "inspection",
+		Run:  run,
+		SupplyChainItem: SupplyChainItem{
+			Name:              name,
+			ExpectedMaterials: [][]string{},
+			ExpectedProducts:  [][]string{},
+		},
+	})
+	return &InspectionBuilder{LayoutBuilder: b, index: i}
+}
+
+/*
+Build returns the built layout, after validating it as a whole.  If any call
+of the builder failed, or the layout is not valid, e.g. because no expiration
+date was set, it returns an ErrInvalidLayoutBuilder joined with all errors.
+*/
+func (b *LayoutBuilder) Build() (Layout, error) {
+	errs := b.errs
+	if len(errs) == 0 {
+		if err := validateLayout(b.layout); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return Layout{}, fmt.Errorf("%w: %w", ErrInvalidLayoutBuilder, errors.Join(errs...))
+	}
+	return b.layout, nil
+}
+
+// addRules validates and appends the passed artifact rules to the passed
+// rules, which are located at the passed reference tokens.
+func (b *LayoutBuilder) addRules(rules *[][]string, newRules [][]string, kind string, tokens ...interface{}) {
+	for _, rule := range newRules {
+		if err := validateArtifactRule(rule); err != nil {
+			b.errs = append(b.errs, atPointer(err, append(tokens, len(*rules)), "invalid %s rule: %w", kind))
+		}
+		*rules = append(*rules, append([]string{}, rule...))
+	}
+}
+
+// StepBuilder configures a step added by LayoutBuilder.AddStep.
+type StepBuilder struct {
+	*LayoutBuilder
+	index int
+}
+
+func (s *StepBuilder) step() *Step {
+	return &s.layout.Steps[s.index]
+}
+
+// ExpectedCommand sets the command the functionaries are expected to run.
+func (s *StepBuilder) ExpectedCommand(command ...string) *StepBuilder {
+	s.step().ExpectedCommand = append([]string{}, command...)
+	return s
+}
+
+// ExpectedMaterials appends the passed material rules, e.g.
+// []string{"MATCH", "*", "WITH", "PRODUCTS", "FROM", "clone"}.
+func (s *StepBuilder) ExpectedMaterials(rules ...[]string) *StepBuilder {
+	s.addRules(&s.step().ExpectedMaterials, rules, "material", "steps", s.index, "expected_materials")
+	return s
+}
+
+// ExpectedProducts appends the passed product rules, e.g.
+// []string{"CREATE", "app"}.
+func (s *StepBuilder) ExpectedProducts(rules ...[]string) *StepBuilder {
+	s.addRules(&s.step().ExpectedProducts, rules, "product", "steps", s.index, "expected_products")
+	return s
+}
+
+// Functionaries authorizes the functionaries with the passed key ids, which
+// must have been added with AddFunctionary, to perform the step.
+func (s *StepBuilder) Functionaries(keyIDs ...string) *StepBuilder {
+	step := s.step()
+	for _, keyID := range keyIDs {
+		if _, ok := s.layout.Keys[keyID]; !ok {
+			s.fail(fmt.Errorf("step '%s' references unknown functionary key '%s'", step.Name, keyID),
+				"steps", s.index, "pubkeys", len(step.PubKeys))
+		}
+		step.PubKeys = append(step.PubKeys, keyID)
+	}
+	return s
+}
+
+// Role authorizes the functionaries of the role with the passed name, which
+// must have been added with AddRole, to perform the step.
+func (s *StepBuilder) Role(name string) *StepBuilder {
+	if _, ok := s.layout.Roles[name]; !ok {
+		s.fail(fmt.Errorf("%w '%s' of step '%s'", ErrUnknownRole, name, s.step().Name),
+			"steps", s.index, "role")
+	}
+	s.step().Role = name
+	return s
+}
+
+// CertificateConstraints appends the passed constraints, which authorize
+// functionaries with certificates to perform the step.
+func (s *StepBuilder) CertificateConstraints(constraints ...CertificateConstraint) *StepBuilder {
+	s.step().CertificateConstraints = append(s.step().CertificateConstraints, constraints...)
+	return s
+}
+
+// Threshold sets the number of distinct functionaries required to perform the
+// step, which must be at least 1.
+func (s *StepBuilder) Threshold(threshold int) *StepBuilder {
+	if threshold < 1 {
+		s.fail(fmt.Errorf("threshold of step '%s' must be at least 1, got '%d'", s.step().Name, threshold),
+			"steps", s.index, "threshold")
+	}
+	s.step().Threshold = threshold
+	return s
+}
+
+// ExpectedToolchain approves the passed version patterns of the toolchain of
+// the passed name, e.g. "go1.21.*", see Step.ExpectedToolchains.
+func (s *StepBuilder) ExpectedToolchain(name string, versionPatterns ...string) *StepBuilder {
+	step := s.step()
+	if step.ExpectedToolchains == nil {
+		step.ExpectedToolchains = make(map[string][]string)
+	}
+	step.ExpectedToolchains[name] = append(step.ExpectedToolchains[name], versionPatterns...)
+	return s
+}
+
+// ArtifactProfile sets the name of the artifact profile of the layout used to
+// record the artifacts of the step, see ArtifactProfile.
+func (s *StepBuilder) ArtifactProfile(name string) *StepBuilder {
+	s.step().ArtifactProfile = name
+	return s
+}
+
+// InspectionBuilder configures an inspection added by
+// LayoutBuilder.AddInspection.
+type InspectionBuilder struct {
+	*LayoutBuilder
+	index int
+}
+
+func (i *InspectionBuilder) inspection() *Inspection {
+	return &i.layout.Inspect[i.index]
+}
+
+// ExpectedMaterials appends the passed material rules.
+func (i *InspectionBuilder) ExpectedMaterials(rules ...[]string) *InspectionBuilder {
+	i.addRules(&i.inspection().ExpectedMaterials, rules, "material", "inspect", i.index, "expected_materials")
+	return i
+}
+
+// ExpectedProducts appends the passed product rules.
+func (i *InspectionBuilder) ExpectedProducts(rules ...[]string) *InspectionBuilder {
+	i.addRules(&i.inspection().ExpectedProducts, rules, "product", "inspect", i.index, "expected_products")
+	return i
+}
+
+// ArtifactProfile sets the name of the artifact profile of the layout used to
+// record the artifacts of the inspection, see ArtifactProfile.
+func (i *InspectionBuilder) ArtifactProfile(name string) *InspectionBuilder {
+	i.inspection().ArtifactProfile = name
+	return i
+}
@@ -0,0 +1,132 @@
+package in_toto
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLayoutBuilder(t *testing.T) {
+	var alice, carol Key
+	if err := alice.LoadKeyDefaults("alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := carol.LoadKey("carol", "ed25519", []string{"sha256", "sha512"}); err != nil {
+		t.Fatal(err)
+	}
+
+	layout, err := NewLayout().
+		Expires(time.Now().AddDate(0, 1, 0)).
+		Readme("demo").
+		AddFunctionary(alice).
+		AddFunctionary(carol).
+		AddStep("build").
+		ExpectedCommand("go", "build").
+		ExpectedMaterials([]string{"ALLOW", "*"}).
+		ExpectedProducts([]string{"CREATE", "app"}, []string{"DISALLOW", "*"}).
+		Functionaries(alice.KeyID, carol.KeyID).
+		Threshold(2).
+		AddInspection("check", "ls").
+		ExpectedMaterials([]string{"MATCH", "app", "WITH", "PRODUCTS", "FROM", "build"}).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, layout.Keys, 2)
+	assert.Equal(t, "", layout.Keys[alice.KeyID].KeyVal.Private)
+	assert.Equal(t, "demo", layout.Readme)
+	if assert.Len(t, layout.Steps, 1) {
+		step := layout.Steps[0]
+		assert.Equal(t, "step", step.Type)
+		assert.Equal(t, 2, step.Threshold)
+		assert.Equal(t, []string{alice.KeyID, carol.KeyID}, step.PubKeys)
+		assert.Equal(t, [][]string{{"CREATE", "app"}, {"DISALLOW", "*"}}, step.ExpectedProducts)
+	}
+	if assert.Len(t, layout.Inspect, 1) {
+		assert.Equal(t, []string{"ls"}, layout.Inspect[0].Run)
+	}
+
+	// The built layout is signable
+	mb := Metablock{Signed: layout}
+	if err := mb.Sign(alice); err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, mb.VerifySignature(alice))
+	assert.Nil(t, ValidateMetablock(mb))
+}
+
+func TestLayoutBuilderErrors(t *testing.T) {
+	var alice Key
+	if err := alice.LoadKeyDefaults("alice"); err != nil {
+		t.Fatal(err)
+	}
+	expires := time.Now().AddDate(0, 1, 0)
+
+	tables := []struct {
+		name    string
+		builder *LayoutBuilder
+		pointer string
+		errMsg  string
+	}{
+		{
+			"invalid rule",
+			NewLayout().Expires(expires).AddStep("build").
+				ExpectedMaterials([]string{"ALLOW", "*"}, []string{"ALLOW"}).LayoutBuilder,
+			"/steps/0/expected_materials/1/1",
+			"invalid material rule",
+		},
+		{
+			"unknown key",
+			NewLayout().Expires(expires).AddStep("build").Functionaries(alice.KeyID).LayoutBuilder,
+			"/steps/0/pubkeys/0",
+			"unknown functionary key",
+		},
+		{
+			"duplicate name",
+			NewLayout().Expires(expires).AddStep("build").AddInspection("build", "ls").LayoutBuilder,
+			"/inspect/0/name",
+			"non unique step or inspection name",
+		},
+		{
+			"invalid threshold",
+			NewLayout().Expires(expires).AddStep("build").Threshold(0).LayoutBuilder,
+			"/steps/0/threshold",
+			"must be at least 1",
+		},
+		{
+			"missing expiry",
+			NewLayout().AddStep("build").LayoutBuilder,
+			"/expires",
+			"expiry time parsed incorrectly",
+		},
+	}
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			_, err := table.builder.Build()
+			assert.ErrorIs(t, err, ErrInvalidLayoutBuilder)
+			assert.Equal(t, table.pointer, ErrorPointer(err))
+			if err == nil || !strings.Contains(err.Error(), table.errMsg) {
+				t.Errorf("expected error containing '%s', got: %v", table.errMsg, err)
+			}
+		})
+	}
+
+	// Errors are collected, and do not interrupt the chain of calls
+	_, err := NewLayout().Expires(expires).
+		AddStep("").Threshold(-1).
+		AddStep("build").ExpectedProducts([]string{"FOO"}).
+		Build()
+	var pointers []string
+	for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+		var joined interface{ Unwrap() []error }
+		if errors.As(e, &joined) {
+			for _, inner := range joined.Unwrap() {
+				pointers = append(pointers, ErrorPointer(inner))
+			}
+		}
+	}
+	assert.Equal(t, []string{"/steps/0/name", "/steps/0/threshold", "/steps/1/expected_products/0/0"}, pointers)
+}
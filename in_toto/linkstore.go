@@ -0,0 +1,106 @@
+package in_toto
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+/*
+LinkStore provides the link metadata of the steps of a layout during
+verification, e.g. from a local directory, see FileLinkStore, or from object
+storage, an OCI registry or a metadata service.  GetLinksForStep returns all
+available links for the step of the passed name.  Links that are not signed
+by an authorized functionary, or that do not pass verification otherwise, are
+rejected by the verification, hence a store does not need to filter them.
+*/
+type LinkStore interface {
+	GetLinksForStep(ctx context.Context, stepName string) ([]Metadata, error)
+}
+
+/*
+SublayoutLinkStore is optionally implemented by a LinkStore, which also
+provides the links of sublayouts.  Sublayout returns the store of the links of
+the sublayout of the passed step, signed by the functionary of the passed key
+id.  If a LinkStore does not implement SublayoutLinkStore, the links of
+sublayouts are loaded from the link directory passed to verification, see
+SublayoutLinkDirFormat.
+*/
+type SublayoutLinkStore interface {
+	LinkStore
+	Sublayout(stepName string, keyID string) LinkStore
+}
+
+// LinkStoreFunc is an adapter to use an ordinary function as LinkStore.
+type LinkStoreFunc func(ctx context.Context, stepName string) ([]Metadata, error)
+
+// GetLinksForStep calls f(ctx, stepName).
+func (f LinkStoreFunc) GetLinksForStep(ctx context.Context, stepName string) ([]Metadata, error) {
+	return f(ctx, stepName)
+}
+
+/*
+FileLinkStore loads links from files in Dir named after LinkNameFormat, like
+InTotoVerify does by default.  Files that cannot be loaded, or whose name does
+not match the key id of one of their signatures, are skipped.
+*/
+type FileLinkStore struct {
+	Dir string
+}
+
+// GetLinksForStep returns the links of the step of the passed name in the
+// directory of the store.
+func (s *FileLinkStore) GetLinksForStep(ctx context.Context, stepName string) ([]Metadata, error) {
+	linkFiles, err := filepath.Glob(filepath.Join(s.Dir, fmt.Sprintf(LinkGlobFormat, stepName)))
+	if err != nil {
+		return nil, err
+	}
+
+	links := []Metadata{}
+	for _, linkPath := range linkFiles {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		linkEnv, err := LoadMetadata(linkPath)
+		if err != nil {
+			continue
+		}
+		signerShortKeyID := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(linkPath), stepName+"."), ".link")
+		for _, sig := range linkEnv.Sigs() {
+			if strings.HasPrefix(sig.KeyID, signerShortKeyID) {
+				links = append(links, linkEnv)
+				break
+			}
+		}
+	}
+	return links, nil
+}
+
+// Sublayout returns a FileLinkStore for the sublayout link directory of the
+// passed step and key id, see SublayoutLinkDirFormat.
+func (s *FileLinkStore) Sublayout(stepName string, keyID string) LinkStore {
+	return &FileLinkStore{Dir: filepath.Join(s.Dir, fmt.Sprintf(SublayoutLinkDirFormat, stepName, keyID))}
+}
+
+/*
+loadLinksFromStore returns the links of the step of the passed name from the
+passed store by the key ids of their signers.  A link with signatures of
+several functionaries is returned for each of them, whether or not a signature
+is valid is verified later.
+*/
+func loadLinksFromStore(ctx context.Context, store LinkStore, stepName string) (map[string]Metadata, error) {
+	links, err := store.GetLinksForStep(ctx, stepName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load links of step '%s': %w", stepName, err)
+	}
+	linksPerStep := make(map[string]Metadata)
+	for _, linkEnv := range links {
+		for _, sig := range linkEnv.Sigs() {
+			if _, ok := linksPerStep[sig.KeyID]; !ok {
+				linksPerStep[sig.KeyID] = linkEnv
+			}
+		}
+	}
+	return linksPerStep, nil
+}
@@ -0,0 +1,133 @@
+package in_toto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInTotoVerifyWithLinkStore(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := GenerateTestVectors(dir, []byte("link store")); err != nil {
+		t.Fatal(err)
+	}
+	var ownerKey Key
+	if err := ownerKey.LoadKeyDefaults(filepath.Join(dir, "keys", "owner.pub")); err != nil {
+		t.Fatal(err)
+	}
+	layoutKeys := map[string]Key{ownerKey.KeyID: ownerKey}
+	layoutEnv, err := LoadMetadata(filepath.Join(dir, "valid", RootLayoutName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fileStore := &FileLinkStore{Dir: filepath.Join(dir, "valid")}
+	_, err = InTotoVerifyWithLinkStore(layoutEnv, layoutKeys, fileStore, "", nil, nil, false)
+	assert.Nil(t, err)
+	_, err = Verify(layoutEnv, layoutKeys, "", WithLinkStore(fileStore))
+	assert.Nil(t, err)
+
+	// Links can be provided by any store, e.g. from memory
+	links := map[string][]Metadata{}
+	for _, step := range []string{"write-code", "package"} {
+		stepLinks, err := fileStore.GetLinksForStep(context.Background(), step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Len(t, stepLinks, 1)
+		links[step] = stepLinks
+	}
+	memoryStore := LinkStoreFunc(func(ctx context.Context, stepName string) ([]Metadata, error) {
+		return links[stepName], nil
+	})
+	_, err = InTotoVerifyWithLinkStore(layoutEnv, layoutKeys, memoryStore, "", nil, nil, false)
+	assert.Nil(t, err)
+
+	// Missing links are reported like for link directories
+	delete(links, "package")
+	_, err = InTotoVerifyWithLinkStore(layoutEnv, layoutKeys, memoryStore, "", nil, nil, false)
+	assert.ErrorIs(t, err, ErrThresholdNotMet)
+	var missingErr *MissingEvidenceError
+	assert.ErrorAs(t, err, &missingErr)
+
+	// Errors of the store fail verification
+	storeErr := errors.New("bucket not found")
+	_, err = InTotoVerifyWithLinkStore(layoutEnv, layoutKeys, LinkStoreFunc(
+		func(ctx context.Context, stepName string) ([]Metadata, error) {
+			return nil, storeErr
+		}), "", nil, nil, false)
+	assert.ErrorIs(t, err, storeErr)
+
+	// The file store skips links not named after one of their signers
+	stepLinks, err := (&FileLinkStore{Dir: t.TempDir()}).GetLinksForStep(context.Background(), "package")
+	assert.Nil(t, err)
+	assert.Empty(t, stepLinks)
+	packageLinks, err := filepath.Glob(filepath.Join(dir, "valid", "package.*.link"))
+	if err != nil || len(packageLinks) != 1 {
+		t.Fatalf("expected one package link, got %v: %v", packageLinks, err)
+	}
+	renamedDir := t.TempDir()
+	if err := os.Link(packageLinks[0], filepath.Join(renamedDir, "package.00000000.link")); err != nil {
+		t.Fatal(err)
+	}
+	stepLinks, err = (&FileLinkStore{Dir: renamedDir}).GetLinksForStep(context.Background(), "package")
+	assert.Nil(t, err)
+	assert.Empty(t, stepLinks)
+}
+
+func TestInTotoVerifyWithLinkStoreSublayout(t *testing.T) {
+	var key Key
+	if err := key.LoadKeyDefaults("alice"); err != nil {
+		t.Fatal(err)
+	}
+	layoutKeys := map[string]Key{key.KeyID: key}
+
+	superLayoutMb, err := LoadMetadata("super.layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	layout := superLayoutMb.GetPayload().(Layout)
+	layout.Expires = time.Now().Add(time.Hour).UTC().Format(ISO8601DateSchema)
+	layoutMb := &Metablock{Signed: layout}
+	if err := layoutMb.Sign(key); err != nil {
+		t.Fatal(err)
+	}
+
+	linkDir := t.TempDir()
+	sublayoutLinkDir := filepath.Join(linkDir, fmt.Sprintf(SublayoutLinkDirFormat, "sub_layout", key.KeyID))
+	if err := os.Mkdir(sublayoutLinkDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link("sub_layout.70ca5750.link", filepath.Join(linkDir, "sub_layout.70ca5750.link")); err != nil {
+		t.Fatal(err)
+	}
+	for _, link := range []string{"write-code.b7d643de.link", "package.d3ffd108.link"} {
+		if err := os.Link(link, filepath.Join(sublayoutLinkDir, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The file store provides the links of sublayouts
+	summary, err := InTotoVerifyWithLinkStore(layoutMb, layoutKeys, &FileLinkStore{Dir: linkDir}, "", nil, nil,
+		testOSisWindows())
+	if assert.Nil(t, err) {
+		assert.Contains(t, summary.GetPayload().(Link).Products, "foo.tar.gz")
+	}
+
+	// Other stores do not, and the links of sublayouts are not found
+	sublayoutEnv, err := LoadMetadata(filepath.Join(linkDir, "sub_layout.70ca5750.link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = InTotoVerifyWithLinkStore(layoutMb, layoutKeys, LinkStoreFunc(
+		func(ctx context.Context, stepName string) ([]Metadata, error) {
+			return []Metadata{sublayoutEnv}, nil
+		}), "", nil, nil, testOSisWindows())
+	assert.ErrorIs(t, err, ErrThresholdNotMet)
+}
@@ -0,0 +1,405 @@
+package in_toto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// ErrUnsupportedLockfile is returned when materials are requested for a
+// lockfile of unknown format.
+var ErrUnsupportedLockfile = errors.New("unsupported lockfile")
+
+// ErrInvalidLockfile is returned when a lockfile cannot be parsed.
+var ErrInvalidLockfile = errors.New("invalid lockfile")
+
+const (
+	goProxyURL         = "https://proxy.golang.org"
+	cratesIOIndex      = "registry+https://github.com/rust-lang/crates.io-index"
+	cratesIODownload   = "https://crates.io/api/v1/crates"
+	pypiSimpleIndexURL = "https://pypi.org/simple"
+)
+
+/*
+LockfileParser parses the contents of a lockfile into material entries.  The
+material names are registry URLs of the locked dependencies and the hash
+objects carry the hex encoded digests recorded in the lockfile.
+*/
+type LockfileParser func(data []byte) (map[string]HashObj, error)
+
+/*
+getLockfileParsers returns the supported lockfile parsers by file name.  We
+need to use this function instead of a global map to prevent modification.
+*/
+func getLockfileParsers() map[string]LockfileParser {
+	return map[string]LockfileParser{
+		"go.sum":            ParseGoSum,
+		"package-lock.json": ParsePackageLock,
+		"poetry.lock":       ParsePoetryLock,
+		"Cargo.lock":        ParseCargoLock,
+	}
+}
+
+/*
+RecordLockfileMaterials parses the lockfiles at the passed paths and returns
+the locked dependencies as material entries, which can be added to the
+materials of a link.  The lockfile format is detected by file name, supported
+are go.sum, package-lock.json, poetry.lock and Cargo.lock.  This allows to
+verify dependency sets without hashing vendored dependency trees.
+*/
+func RecordLockfileMaterials(paths []string) (map[string]HashObj, error) {
+	materials := map[string]HashObj{}
+	for _, path := range paths {
+		parser, ok := getLockfileParsers()[filepath.Base(path)]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedLockfile, path)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		entries, err := parser(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		for name, hashObj := range entries {
+			materials[name] = hashObj
+		}
+	}
+	return materials, nil
+}
+
+/*
+escapeGoModulePath escapes the passed module path or version for use in Go
+module proxy URLs, i.e. each upper case letter is replaced by an exclamation
+mark followed by the lower case letter.
+*/
+func escapeGoModulePath(path string) string {
+	var escaped strings.Builder
+	for _, r := range path {
+		if unicode.IsUpper(r) {
+			escaped.WriteRune('!')
+			escaped.WriteRune(unicode.ToLower(r))
+		} else {
+			escaped.WriteRune(r)
+		}
+	}
+	return escaped.String()
+}
+
+/*
+ParseGoSum parses a go.sum file.  Each module is recorded with the URL of its
+zip file and each go.mod file with its URL, both on the Go module proxy.  The
+"h1" hash, i.e. the SHA-256 based directory hash of Go modules, is recorded
+hex encoded as algorithm "h1".
+*/
+func ParseGoSum(data []byte) (map[string]HashObj, error) {
+	materials := map[string]HashObj{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 3 || !strings.HasPrefix(fields[2], "h1:") {
+			return nil, fmt.Errorf("%w: malformed go.sum line %d", ErrInvalidLockfile, lineNumber)
+		}
+		digest, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(fields[2], "h1:"))
+		if err != nil {
+			return nil, fmt.Errorf("%w: malformed hash in go.sum line %d", ErrInvalidLockfile, lineNumber)
+		}
+
+		module, version := escapeGoModulePath(fields[0]), fields[1]
+		suffix := ".zip"
+		if strings.HasSuffix(version, "/go.mod") {
+			version = strings.TrimSuffix(version, "/go.mod")
+			suffix = ".mod"
+		}
+		url := fmt.Sprintf("%s/%s/@v/%s%s", goProxyURL, module, escapeGoModulePath(version), suffix)
+		materials[url] = HashObj{"h1": hex.EncodeToString(digest)}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return materials, nil
+}
+
+// packageLockPackage is a package entry of a package-lock.json file.
+type packageLockPackage struct {
+	Resolved  string `json:"resolved"`
+	Integrity string `json:"integrity"`
+}
+
+// packageLockDependency is a dependency entry of a version 1
+// package-lock.json file, which may nest further dependencies.
+type packageLockDependency struct {
+	packageLockPackage
+	Dependencies map[string]packageLockDependency `json:"dependencies"`
+}
+
+/*
+parseSRI parses the passed subresource integrity string, e.g.
+"sha512-<base64>", into a hash object with hex encoded digests.
+*/
+func parseSRI(integrity string) (HashObj, error) {
+	hashObj := HashObj{}
+	for _, entry := range strings.Fields(integrity) {
+		algorithm, encoded, ok := strings.Cut(entry, "-")
+		if !ok {
+			return nil, fmt.Errorf("%w: malformed integrity '%s'", ErrInvalidLockfile, entry)
+		}
+		// Options, e.g. "sha512-<base64>?foo", are not relevant to us
+		encoded, _, _ = strings.Cut(encoded, "?")
+		digest, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("%w: malformed integrity '%s'", ErrInvalidLockfile, entry)
+		}
+		hashObj[algorithm] = hex.EncodeToString(digest)
+	}
+	return hashObj, nil
+}
+
+/*
+ParsePackageLock parses a package-lock.json file of any lockfile version.
+Each dependency is recorded with its resolved URL and the digests of its
+integrity field.  Dependencies without resolved URL or integrity, e.g. linked
+local packages, are skipped.
+*/
+func ParsePackageLock(data []byte) (map[string]HashObj, error) {
+	var lock struct {
+		Packages     map[string]packageLockPackage    `json:"packages"`
+		Dependencies map[string]packageLockDependency `json:"dependencies"`
+	}
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidLockfile, err)
+	}
+
+	materials := map[string]HashObj{}
+	add := func(pkg packageLockPackage) error {
+		if pkg.Resolved == "" || pkg.Integrity == "" {
+			return nil
+		}
+		hashObj, err := parseSRI(pkg.Integrity)
+		if err != nil {
+			return err
+		}
+		materials[pkg.Resolved] = hashObj
+		return nil
+	}
+
+	// Lockfile version 2 and 3 list all packages in "packages", version 2
+	// additionally carries the version 1 "dependencies" for compatibility.
+	if lock.Packages != nil {
+		for _, pkg := range lock.Packages {
+			if err := add(pkg); err != nil {
+				return nil, err
+			}
+		}
+		return materials, nil
+	}
+
+	var addDependencies func(dependencies map[string]packageLockDependency) error
+	addDependencies = func(dependencies map[string]packageLockDependency) error {
+		for _, dependency := range dependencies {
+			if err := add(dependency.packageLockPackage); err != nil {
+				return err
+			}
+			if err := addDependencies(dependency.Dependencies); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := addDependencies(lock.Dependencies); err != nil {
+		return nil, err
+	}
+	return materials, nil
+}
+
+// tomlTable holds the string values of a table of a TOML document, and the
+// raw values of other types.
+type tomlTable map[string]string
+
+// tomlInlineTablePattern matches inline tables, e.g. {file = "a", hash = "b"}
+var tomlInlineTablePattern = regexp.MustCompile(`\{[^{}]*\}`)
+
+// tomlKeyValuePattern matches key value pairs with basic string values.
+var tomlKeyValuePattern = regexp.MustCompile(`("[^"]*"|[A-Za-z0-9_.-]+)\s*=\s*"((?:[^"\\]|\\.)*)"`)
+
+/*
+parseTOMLInlineTables returns the key value pairs of the inline tables in the
+passed raw TOML value, e.g. an array of inline tables.
+*/
+func parseTOMLInlineTables(raw string) []tomlTable {
+	tables := []tomlTable{}
+	for _, inline := range tomlInlineTablePattern.FindAllString(raw, -1) {
+		table := tomlTable{}
+		for _, match := range tomlKeyValuePattern.FindAllStringSubmatch(inline, -1) {
+			table[strings.Trim(match[1], `"`)] = match[2]
+		}
+		tables = append(tables, table)
+	}
+	return tables
+}
+
+/*
+parseLockfileTOML parses the subset of TOML used by Cargo.lock and poetry.lock
+files.  It returns the tables of the document in order, keyed by their
+header, e.g. "package" for array of tables entries. String values are stored
+unquoted and multi-line values, e.g. arrays, are stored raw.  This is not a
+general purpose TOML parser.
+*/
+func parseLockfileTOML(data []byte) ([]string, []tomlTable, error) {
+	headers := []string{""}
+	tables := []tomlTable{{}}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var pendingKey string
+	var pendingValue strings.Builder
+	depth := 0
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+
+		// Continue multi-line values, e.g. arrays, until brackets are balanced
+		if depth > 0 {
+			pendingValue.WriteString(line + "\n")
+			depth += strings.Count(line, "[") - strings.Count(line, "]")
+			if depth <= 0 {
+				tables[len(tables)-1][pendingKey] = pendingValue.String()
+				depth = 0
+			}
+			continue
+		}
+
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "[[") && strings.HasSuffix(line, "]]"):
+			headers = append(headers, strings.TrimSpace(line[2:len(line)-2]))
+			tables = append(tables, tomlTable{})
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			headers = append(headers, strings.TrimSpace(line[1:len(line)-1]))
+			tables = append(tables, tomlTable{})
+		default:
+			key, value, ok := strings.Cut(line, "=")
+			if !ok {
+				return nil, nil, fmt.Errorf("%w: malformed line %d", ErrInvalidLockfile, lineNumber)
+			}
+			key = strings.Trim(strings.TrimSpace(key), `"`)
+			value = strings.TrimSpace(value)
+			if strings.HasPrefix(value, "[") {
+				depth = strings.Count(value, "[") - strings.Count(value, "]")
+				if depth > 0 {
+					pendingKey = key
+					pendingValue.Reset()
+					pendingValue.WriteString(value + "\n")
+					continue
+				}
+			}
+			if strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`) && len(value) > 1 {
+				value = value[1 : len(value)-1]
+			}
+			tables[len(tables)-1][key] = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	if depth > 0 {
+		return nil, nil, fmt.Errorf("%w: unterminated value of '%s'", ErrInvalidLockfile, pendingKey)
+	}
+	return headers, tables, nil
+}
+
+/*
+ParseCargoLock parses a Cargo.lock file.  Each package from a registry with
+a checksum is recorded with its download URL, for crates.io packages the
+crates.io download URL, and its SHA-256 checksum.  Packages without checksum,
+e.g. path or git dependencies, are skipped.
+*/
+func ParseCargoLock(data []byte) (map[string]HashObj, error) {
+	headers, tables, err := parseLockfileTOML(data)
+	if err != nil {
+		return nil, err
+	}
+
+	materials := map[string]HashObj{}
+	for i, header := range headers {
+		pkg := tables[i]
+		if header != "package" || pkg["checksum"] == "" {
+			continue
+		}
+		if pkg["name"] == "" || pkg["version"] == "" {
+			return nil, fmt.Errorf("%w: package without name or version", ErrInvalidLockfile)
+		}
+		url := fmt.Sprintf("%s#%s@%s", pkg["source"], pkg["name"], pkg["version"])
+		if pkg["source"] == cratesIOIndex {
+			url = fmt.Sprintf("%s/%s/%s/download", cratesIODownload, pkg["name"], pkg["version"])
+		}
+		materials[url] = HashObj{"sha256": pkg["checksum"]}
+	}
+	return materials, nil
+}
+
+// pythonPackageNameSeparators matches runs of separators in Python package names.
+var pythonPackageNameSeparators = regexp.MustCompile(`[-_.]+`)
+
+// normalizePythonPackageName normalizes the passed package name as used in
+// PyPI simple index URLs, see PEP 503.
+func normalizePythonPackageName(name string) string {
+	return strings.ToLower(pythonPackageNameSeparators.ReplaceAllString(name, "-"))
+}
+
+/*
+ParsePoetryLock parses a poetry.lock file.  Each distribution file of a
+package is recorded with its URL on the PyPI simple index and its hash.  Both
+the "files" array of packages of newer lockfiles and the "metadata.files"
+table of older lockfiles are supported.
+*/
+func ParsePoetryLock(data []byte) (map[string]HashObj, error) {
+	headers, tables, err := parseLockfileTOML(data)
+	if err != nil {
+		return nil, err
+	}
+
+	materials := map[string]HashObj{}
+	addFiles := func(name string, rawFiles string) error {
+		for _, file := range parseTOMLInlineTables(rawFiles) {
+			algorithm, digest, ok := strings.Cut(file["hash"], ":")
+			if file["file"] == "" || !ok {
+				return fmt.Errorf("%w: malformed file entry of package '%s'", ErrInvalidLockfile, name)
+			}
+			url := fmt.Sprintf("%s/%s/#%s", pypiSimpleIndexURL, normalizePythonPackageName(name), file["file"])
+			materials[url] = HashObj{algorithm: digest}
+		}
+		return nil
+	}
+
+	for i, header := range headers {
+		table := tables[i]
+		switch header {
+		case "package":
+			if files, ok := table["files"]; ok {
+				if err := addFiles(table["name"], files); err != nil {
+					return nil, err
+				}
+			}
+		case "metadata.files":
+			for name, files := range table {
+				if err := addFiles(name, files); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return materials, nil
+}
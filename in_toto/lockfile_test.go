@@ -0,0 +1,195 @@
+package in_toto
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseGoSum(t *testing.T) {
+	goSum := `github.com/BurntSushi/toml v1.3.2 h1:o7IhLm0Msx3BaB+n3Ag7L8EVlByGnpq14C4YWiu/gL8=
+github.com/BurntSushi/toml v1.3.2/go.mod h1:CxXYINrC8qIiEnFrOxCa7Jy5BFHlXnUU2pbicEuybxQ=
+
+golang.org/x/sys v0.15.0 h1:h48lPFYpsTvQJZF4EKyI4aLHaev3CxivZmv7yZig9pc=
+`
+	materials, err := ParseGoSum([]byte(goSum))
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]HashObj{
+		"https://proxy.golang.org/github.com/!burnt!sushi/toml/@v/v1.3.2.zip": {"h1": "a3b2212e6d0cb31dc1681fa7dc083b2fc115941c869e9ab5e02e185a2bbf80bf"},
+		"https://proxy.golang.org/github.com/!burnt!sushi/toml/@v/v1.3.2.mod": {"h1": "0b15d820dac2f2a22212716b3b109aec9cb90451e55e7514da96e2704bb26f14"},
+		"https://proxy.golang.org/golang.org/x/sys/@v/v0.15.0.zip":            {"h1": "878f253c5629b13bd025917810ac88e1a2c769ebf70b18af666bfbc998a0f697"},
+	}, materials)
+
+	for _, invalid := range []string{"foo v1.0.0", "foo v1.0.0 sha256:abcd", "foo v1.0.0 h1:###"} {
+		_, err := ParseGoSum([]byte(invalid))
+		assert.ErrorIs(t, err, ErrInvalidLockfile, invalid)
+	}
+}
+
+func TestParsePackageLock(t *testing.T) {
+	expected := map[string]HashObj{
+		"https://registry.npmjs.org/left-pad/-/left-pad-1.3.0.tgz": {
+			"sha512": "5d1720961877a7694702ee20160ef98b9a30677feeb6d219875d622a3f96d9fa9ce08bbc3afc081e40d27ed6b0e20511a34580d9f4f6a20bb04dae070a12f027",
+		},
+		"https://registry.npmjs.org/nested/-/nested-1.0.0.tgz": {
+			"sha1": "16c385a6cbd7c6ad06cd6a7195aafae4932fcf3d",
+		},
+	}
+
+	v3 := `{
+  "name": "app",
+  "lockfileVersion": 3,
+  "packages": {
+    "": {"name": "app", "dependencies": {"left-pad": "^1.3.0"}},
+    "node_modules/left-pad": {
+      "version": "1.3.0",
+      "resolved": "https://registry.npmjs.org/left-pad/-/left-pad-1.3.0.tgz",
+      "integrity": "sha512-XRcglhh3p2lHAu4gFg75i5owZ3/uttIZh11iKj+W2fqc4Iu8OvwIHkDSftaw4gURo0WA2fT2oguwTa4HChLwJw==",
+      "dependencies": {"nested": "^1.0.0"}
+    },
+    "node_modules/nested": {
+      "version": "1.0.0",
+      "resolved": "https://registry.npmjs.org/nested/-/nested-1.0.0.tgz",
+      "integrity": "sha1-FsOFpsvXxq0GzWpxlar65JMvzz0="
+    },
+    "node_modules/local": {"resolved": "../local", "link": true}
+  }
+}`
+	materials, err := ParsePackageLock([]byte(v3))
+	assert.Nil(t, err)
+	assert.Equal(t, expected, materials)
+
+	v1 := `{
+  "name": "app",
+  "lockfileVersion": 1,
+  "dependencies": {
+    "left-pad": {
+      "version": "1.3.0",
+      "resolved": "https://registry.npmjs.org/left-pad/-/left-pad-1.3.0.tgz",
+      "integrity": "sha512-XRcglhh3p2lHAu4gFg75i5owZ3/uttIZh11iKj+W2fqc4Iu8OvwIHkDSftaw4gURo0WA2fT2oguwTa4HChLwJw==",
+      "requires": {"nested": "^1.0.0"},
+      "dependencies": {
+        "nested": {
+          "version": "1.0.0",
+          "resolved": "https://registry.npmjs.org/nested/-/nested-1.0.0.tgz",
+          "integrity": "sha1-FsOFpsvXxq0GzWpxlar65JMvzz0="
+        }
+      }
+    }
+  }
+}`
+	materials, err = ParsePackageLock([]byte(v1))
+	assert.Nil(t, err)
+	assert.Equal(t, expected, materials)
+
+	_, err = ParsePackageLock([]byte("not json"))
+	assert.ErrorIs(t, err, ErrInvalidLockfile)
+	_, err = ParsePackageLock([]byte(`{"packages": {"a": {"resolved": "x", "integrity": "sha512"}}}`))
+	assert.ErrorIs(t, err, ErrInvalidLockfile)
+}
+
+func TestParseCargoLock(t *testing.T) {
+	cargoLock := `# This file is automatically @generated by Cargo.
+# It is not intended for manual editing.
+version = 3
+
+[[package]]
+name = "app"
+version = "0.1.0"
+dependencies = [
+ "libc",
+]
+
+[[package]]
+name = "libc"
+version = "0.2.150"
+source = "registry+https://github.com/rust-lang/crates.io-index"
+checksum = "89d92a4743f9a61002fae18374ed11e7973f530cb3a3255fb354818118b2203c"
+
+[[package]]
+name = "private"
+version = "1.0.0"
+source = "registry+https://example.com/index"
+checksum = "0000000000000000000000000000000000000000000000000000000000000000"
+`
+	materials, err := ParseCargoLock([]byte(cargoLock))
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]HashObj{
+		"https://crates.io/api/v1/crates/libc/0.2.150/download": {"sha256": "89d92a4743f9a61002fae18374ed11e7973f530cb3a3255fb354818118b2203c"},
+		"registry+https://example.com/index#private@1.0.0":      {"sha256": "0000000000000000000000000000000000000000000000000000000000000000"},
+	}, materials)
+
+	_, err = ParseCargoLock([]byte("[[package]]\nname = \"a\"\ndependencies = [\n"))
+	assert.ErrorIs(t, err, ErrInvalidLockfile)
+	_, err = ParseCargoLock([]byte("[[package]]\nchecksum = \"abcd\"\n"))
+	assert.ErrorIs(t, err, ErrInvalidLockfile)
+	_, err = ParseCargoLock([]byte("no key value\n"))
+	assert.ErrorIs(t, err, ErrInvalidLockfile)
+}
+
+func TestParsePoetryLock(t *testing.T) {
+	expected := map[string]HashObj{
+		"https://pypi.org/simple/typing-extensions/#typing_extensions-4.8.0-py3-none-any.whl": {"sha256": "8f92fc8806f9a6b641eaa5318da32b44d401efaac0f6678c9bc448ba3605faa0"},
+		"https://pypi.org/simple/typing-extensions/#typing_extensions-4.8.0.tar.gz":           {"sha256": "df8e4339e9cb77357558cbdbceca33c303714cf861d1eef15e1070055ae8b7ef"},
+	}
+
+	newFormat := `[[package]]
+name = "typing_extensions"
+version = "4.8.0"
+description = "Backported and Experimental Type Hints for Python 3.8+"
+optional = false
+python-versions = ">=3.8"
+files = [
+    {file = "typing_extensions-4.8.0-py3-none-any.whl", hash = "sha256:8f92fc8806f9a6b641eaa5318da32b44d401efaac0f6678c9bc448ba3605faa0"},
+    {file = "typing_extensions-4.8.0.tar.gz", hash = "sha256:df8e4339e9cb77357558cbdbceca33c303714cf861d1eef15e1070055ae8b7ef"},
+]
+
+[metadata]
+lock-version = "2.0"
+python-versions = "^3.8"
+content-hash = "abcd"
+`
+	materials, err := ParsePoetryLock([]byte(newFormat))
+	assert.Nil(t, err)
+	assert.Equal(t, expected, materials)
+
+	oldFormat := `[[package]]
+name = "typing-extensions"
+version = "4.8.0"
+category = "main"
+
+[metadata]
+lock-version = "1.1"
+
+[metadata.files]
+typing-extensions = [
+    {file = "typing_extensions-4.8.0-py3-none-any.whl", hash = "sha256:8f92fc8806f9a6b641eaa5318da32b44d401efaac0f6678c9bc448ba3605faa0"},
+    {file = "typing_extensions-4.8.0.tar.gz", hash = "sha256:df8e4339e9cb77357558cbdbceca33c303714cf861d1eef15e1070055ae8b7ef"},
+]
+`
+	materials, err = ParsePoetryLock([]byte(oldFormat))
+	assert.Nil(t, err)
+	assert.Equal(t, expected, materials)
+
+	_, err = ParsePoetryLock([]byte("[[package]]\nname = \"a\"\nfiles = [{file = \"a.whl\", hash = \"abcd\"}]\n"))
+	assert.ErrorIs(t, err, ErrInvalidLockfile)
+}
+
+func TestRecordLockfileMaterials(t *testing.T) {
+	dir := t.TempDir()
+	goSum := filepath.Join(dir, "go.sum")
+	if err := os.WriteFile(goSum, []byte("golang.org/x/sys v0.15.0 h1:h48lPFYpsTvQJZF4EKyI4aLHaev3CxivZmv7yZig9pc=\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	materials, err := RecordLockfileMaterials([]string{goSum})
+	assert.Nil(t, err)
+	assert.Contains(t, materials, "https://proxy.golang.org/golang.org/x/sys/@v/v0.15.0.zip")
+
+	_, err = RecordLockfileMaterials([]string{filepath.Join(dir, "yarn.lock")})
+	assert.ErrorIs(t, err, ErrUnsupportedLockfile)
+	_, err = RecordLockfileMaterials([]string{filepath.Join(dir, "Cargo.lock")})
+	assert.NotNil(t, err)
+}
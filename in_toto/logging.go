@@ -0,0 +1,67 @@
+package in_toto
+
+import (
+	"context"
+	"sync"
+)
+
+/*
+Logger receives debug messages of the run and verify paths, e.g. about
+signature checks, the artifacts consumed by each artifact rule, or why a
+MATCH rule did not consume an artifact, and about which artifacts are
+excluded or hashed while recording.  Messages come with alternating keys and
+values, e.g. "step", "build", "keyid", "<keyid>".  The signature of Debug is
+that of slog.Logger, hence a *slog.Logger can be used as Logger as is.
+Loggers must be safe for concurrent use, since artifacts are hashed
+concurrently.
+
+By default nothing is logged.  A Logger is registered for all operations with
+SetLogger, or for single operations with WithLogger or WithVerificationLogger.
+*/
+type Logger interface {
+	Debug(msg string, keysAndValues ...interface{})
+}
+
+var (
+	loggerMu sync.RWMutex
+	logger   Logger
+)
+
+// SetLogger registers the passed Logger for all subsequent operations, which
+// are not passed a Logger.  Passing nil disables logging.
+func SetLogger(l Logger) {
+	loggerMu.Lock()
+	defer loggerMu.Unlock()
+	logger = l
+}
+
+// loggerKey is the context key of the Logger of an operation.
+type loggerKey struct{}
+
+// withLogger returns a context, which logs to the passed Logger, or the
+// passed context, if the Logger is nil.
+func withLogger(ctx context.Context, l Logger) context.Context {
+	if l == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// loggerFromContext returns the Logger of the passed context, or the
+// registered Logger, see SetLogger, or nil, if nothing is logged.
+func loggerFromContext(ctx context.Context) Logger {
+	if l, ok := ctx.Value(loggerKey{}).(Logger); ok {
+		return l
+	}
+	loggerMu.RLock()
+	defer loggerMu.RUnlock()
+	return logger
+}
+
+// logDebug logs the passed message and key value pairs to the passed Logger,
+// if it is not nil.
+func logDebug(l Logger, msg string, keysAndValues ...interface{}) {
+	if l != nil {
+		l.Debug(msg, keysAndValues...)
+	}
+}
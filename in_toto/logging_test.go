@@ -0,0 +1,102 @@
+package in_toto
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingLogger records the logged messages with their key value pairs.
+type recordingLogger struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (l *recordingLogger) Debug(msg string, keysAndValues ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		msg += fmt.Sprintf(" %v=%v", keysAndValues[i], keysAndValues[i+1])
+	}
+	l.messages = append(l.messages, msg)
+}
+
+func TestVerifyArtifactsLogging(t *testing.T) {
+	items := []interface{}{Step{SupplyChainItem: SupplyChainItem{
+		Name:              "package",
+		ExpectedMaterials: [][]string{{"MATCH", "*", "WITH", "PRODUCTS", "FROM", "build"}},
+	}}}
+	itemsMetadata := map[string]Metadata{
+		"build": &Metablock{Signed: Link{Name: "build", Products: map[string]HashObj{
+			"foo": {"sha256": "aa"},
+		}}},
+		"package": &Metablock{Signed: Link{Name: "package", Materials: map[string]HashObj{
+			"foo": {"sha256": "bb"},
+			"bar": {"sha256": "cc"},
+		}}},
+	}
+
+	logger := &recordingLogger{}
+	ctx := withLogger(context.Background(), logger)
+	if err := verifyArtifacts(ctx, items, itemsMetadata, artifactMatcher{}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{
+		"verifying artifact rules item=package type=materials queue=[bar foo]",
+		"MATCH rule found no destination artifact artifact=bar destination=build destination_type=products destination_artifact=bar",
+		"MATCH rule found different destination artifact hashes artifact=foo destination=build destination_type=products" +
+			" destination_artifact=foo hashes=map[sha256:bb] destination_hashes=map[sha256:aa]",
+		"applied artifact rule item=package type=materials rule=MATCH * WITH PRODUCTS FROM build consumed=[]",
+		"artifacts not consumed by any rule item=package type=materials queue=[bar foo]",
+		"verifying artifact rules item=package type=products queue=[]",
+	}, logger.messages)
+}
+
+func TestRunLogging(t *testing.T) {
+	var key Key
+	if err := key.LoadKey("carol", "ed25519", []string{"sha256", "sha512"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The registered Logger is used, unless a Logger is passed
+	global := &recordingLogger{}
+	SetLogger(global)
+	defer SetLogger(nil)
+	_, err := Run("build", []string{"sh", "-c", "true"}, key, WithMaterials("alice.pub", "carol.pub"),
+		WithArtifactProfile(ArtifactProfile{ExcludePatterns: []string{"carol.*"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, global.messages, 2) {
+		assert.Equal(t, "excluded artifact path=carol.pub", global.messages[0])
+		assert.Contains(t, global.messages[1], "hashed artifact artifact=alice.pub path=alice.pub hashes=map[sha256:")
+	}
+
+	logger := &recordingLogger{}
+	_, err = Run("build", []string{"sh", "-c", "true"}, key, WithMaterials("alice.pub"), WithLogger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, global.messages, 2)
+	assert.Len(t, logger.messages, 1)
+}
+
+func TestVerifyLayoutSignaturesLogging(t *testing.T) {
+	var key Key
+	if err := key.LoadKeyDefaults("alice.pub"); err != nil {
+		t.Fatal(err)
+	}
+	mb, err := LoadMetadata("demo.layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := &recordingLogger{}
+	if err := verifyLayoutSignatures(mb, map[string]Key{key.KeyID: key}, newSignableMemo(), logger); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"verified layout signature keyid=" + key.KeyID + " error=<nil>"}, logger.messages)
+}
@@ -22,8 +22,9 @@ var errBadPattern = errors.New("syntax error in pattern")
 //	term:
 //		'*'         matches any sequence of non-/ characters
 //		'?'         matches any single non-/ character
-//		'[' [ '^' ] { character-range } ']'
-//		            character class (must be non-empty)
+//		'[' [ '^' | '!' ] { character-range } ']'
+//		            character class (must be non-empty), negated
+//		            with '^' or, like Python's fnmatch, with '!'
 //		c           matches character c (c != '*', '?', '\\', '[')
 //		'\\' c      matches character c
 //
@@ -141,7 +142,7 @@ func matchChunk(chunk, s string) (rest string, ok bool, err error) {
 			chunk = chunk[1:]
 			// possibly negated
 			negated := false
-			if len(chunk) > 0 && chunk[0] == '^' {
+			if len(chunk) > 0 && (chunk[0] == '^' || chunk[0] == '!') {
 				negated = true
 				chunk = chunk[1:]
 			}
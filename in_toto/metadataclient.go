@@ -0,0 +1,261 @@
+package in_toto
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrMetadataService is returned when a request to a metadata service fails,
+// see MetadataClient.
+var ErrMetadataService = errors.New("metadata service request failed")
+
+// MetadataContentType is the media type of metadata sent to and received from
+// a metadata service.
+const MetadataContentType = "application/json"
+
+/*
+Authenticator authenticates requests to a metadata service, e.g. by setting
+an Authorization header with a short-lived token of a CI runner.  It is
+called before each attempt of a request, so that expired tokens can be
+refreshed between retries.
+*/
+type Authenticator interface {
+	Authenticate(req *http.Request) error
+}
+
+// AuthenticatorFunc is an adapter to use an ordinary function as
+// Authenticator.
+type AuthenticatorFunc func(req *http.Request) error
+
+// Authenticate calls f(req).
+func (f AuthenticatorFunc) Authenticate(req *http.Request) error {
+	return f(req)
+}
+
+// BearerToken returns an Authenticator that sets the passed token as bearer
+// token in the Authorization header of requests.
+func BearerToken(token string) Authenticator {
+	return AuthenticatorFunc(func(req *http.Request) error {
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	})
+}
+
+/*
+RetryPolicy configures how often and when failed requests to a metadata
+service are retried.  Requests are retried on network errors and on response
+status 429 and 5xx, waiting InitialBackoff before the first retry and doubling
+the wait before each further retry, up to MaxBackoff.  A Retry-After header in
+seconds takes precedence over the backoff.  MaxAttempts includes the first
+attempt, values smaller than one mean a single attempt.
+*/
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// DefaultRetryPolicy is used by a MetadataClient without RetryPolicy.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    4,
+	InitialBackoff: 500 * time.Millisecond,
+	MaxBackoff:     10 * time.Second,
+}
+
+/*
+MetadataClient submits link metadata to, and fetches links and layouts from,
+a remote metadata service, so that steps running on ephemeral CI runners do
+not need shared filesystem access to collect links.  The service is expected
+to provide the following endpoints relative to BaseURL:
+
+  - POST links: stores the link metadata in the request body.
+  - GET links/<step name>: returns a JSON array of the link metadata of the
+    step.
+  - GET layouts/<name>: returns the layout metadata of the passed name.
+
+Metadata is exchanged in its JSON encoding, as written by DumpMetadataTo.
+MetadataClient implements LinkStore, hence links can be verified from the
+service with InTotoVerifyWithLinkStore.  If Client is nil, http.DefaultClient
+is used, if Retry is zero, DefaultRetryPolicy.
+*/
+type MetadataClient struct {
+	BaseURL string
+	Client  *http.Client
+	Auth    Authenticator
+	Retry   RetryPolicy
+}
+
+// NewMetadataClient creates a MetadataClient for the service at the passed
+// base URL, which authenticates requests with the passed authenticator.
+func NewMetadataClient(baseURL string, auth Authenticator) *MetadataClient {
+	return &MetadataClient{BaseURL: baseURL, Auth: auth}
+}
+
+/*
+SubmitLink posts the passed link metadata to the service.  It returns an
+ErrNotLink, if the metadata is not a link, and an ErrMetadataService, if the
+service does not accept the link after all retries.
+*/
+func (c *MetadataClient) SubmitLink(ctx context.Context, linkEnv Metadata) (err error) {
+	ctx, span := startSpan(ctx, "in_toto.MetadataClient.SubmitLink")
+	defer func() { endSpan(span, err) }()
+
+	link, ok := linkEnv.GetPayload().(Link)
+	if !ok {
+		return ErrNotLink
+	}
+	span.SetAttribute("in_toto.step", link.Name)
+
+	var body bytes.Buffer
+	if err := DumpMetadataTo(linkEnv, &body); err != nil {
+		return err
+	}
+	_, err = c.do(ctx, http.MethodPost, "links", body.Bytes())
+	return err
+}
+
+// GetLinksForStep returns the links of the step of the passed name from the
+// service.
+func (c *MetadataClient) GetLinksForStep(ctx context.Context, stepName string) (links []Metadata, err error) {
+	ctx, span := startSpan(ctx, "in_toto.MetadataClient.GetLinksForStep")
+	span.SetAttribute("in_toto.step", stepName)
+	defer func() { endSpan(span, err) }()
+
+	data, err := c.do(ctx, http.MethodGet, "links/"+url.PathEscape(stepName), nil)
+	if err != nil {
+		return nil, err
+	}
+	var rawLinks []json.RawMessage
+	if err := json.Unmarshal(data, &rawLinks); err != nil {
+		return nil, fmt.Errorf("%w: invalid links of step '%s': %s", ErrMetadataService, stepName, err)
+	}
+	links = make([]Metadata, 0, len(rawLinks))
+	for _, rawLink := range rawLinks {
+		linkEnv, err := decodeMetadata(rawLink)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid link of step '%s': %s", ErrMetadataService, stepName, err)
+		}
+		links = append(links, linkEnv)
+	}
+	return links, nil
+}
+
+/*
+FetchLayout returns the layout metadata of the passed name from the service.
+The signatures of the layout are not verified, see InTotoVerify.
+*/
+func (c *MetadataClient) FetchLayout(ctx context.Context, name string) (layoutEnv Metadata, err error) {
+	ctx, span := startSpan(ctx, "in_toto.MetadataClient.FetchLayout")
+	defer func() { endSpan(span, err) }()
+
+	data, err := c.do(ctx, http.MethodGet, "layouts/"+url.PathEscape(name), nil)
+	if err != nil {
+		return nil, err
+	}
+	layoutEnv, err = decodeMetadata(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid layout '%s': %s", ErrMetadataService, name, err)
+	}
+	if _, ok := layoutEnv.GetPayload().(Layout); !ok {
+		return nil, ErrNotLayout
+	}
+	return layoutEnv, nil
+}
+
+/*
+do sends a request with the passed method and body to the passed path
+relative to the base URL of the service, retrying it according to the retry
+policy of the client, and returns the response body.
+*/
+func (c *MetadataClient) do(ctx context.Context, method string, path string, body []byte) ([]byte, error) {
+	endpoint := strings.TrimSuffix(c.BaseURL, "/") + "/" + path
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	policy := c.Retry
+	if policy == (RetryPolicy{}) {
+		policy = DefaultRetryPolicy
+	}
+
+	backoff := policy.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		data, retryAfter, err := c.attempt(ctx, client, method, endpoint, body)
+		if err == nil || retryAfter < 0 || attempt >= policy.MaxAttempts {
+			return data, err
+		}
+
+		wait := backoff
+		if retryAfter > 0 {
+			wait = retryAfter
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w: %s", ErrMetadataService, ctx.Err())
+		case <-time.After(wait):
+		}
+		backoff *= 2
+		if policy.MaxBackoff > 0 && backoff > policy.MaxBackoff {
+			backoff = policy.MaxBackoff
+		}
+	}
+}
+
+/*
+attempt sends a single request, see do.  If the request failed, the second
+return value is negative, if the request must not be retried, zero, if it
+may be retried after the backoff, or the wait requested by the service.
+*/
+func (c *MetadataClient) attempt(ctx context.Context, client *http.Client, method string, endpoint string, body []byte) ([]byte, time.Duration, error) {
+	var bodyReader io.Reader
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bodyReader)
+	if err != nil {
+		return nil, -1, err
+	}
+	req.Header.Set("Accept", MetadataContentType)
+	if body != nil {
+		req.Header.Set("Content-Type", MetadataContentType)
+	}
+	if c.Auth != nil {
+		if err := c.Auth.Authenticate(req); err != nil {
+			return nil, -1, fmt.Errorf("%w: authentication: %s", ErrMetadataService, err)
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, -1, fmt.Errorf("%w: %s", ErrMetadataService, err)
+		}
+		return nil, 0, fmt.Errorf("%w: %s", ErrMetadataService, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %s", ErrMetadataService, err)
+	}
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode <= 299:
+		return data, 0, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		var retryAfter time.Duration
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			retryAfter = time.Duration(seconds) * time.Second
+		}
+		return nil, retryAfter, fmt.Errorf("%w: %s %s responded with status %d", ErrMetadataService, method, endpoint, resp.StatusCode)
+	}
+	return nil, -1, fmt.Errorf("%w: %s %s responded with status %d", ErrMetadataService, method, endpoint, resp.StatusCode)
+}
@@ -0,0 +1,146 @@
+package in_toto
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testMetadataService is an in-memory metadata service, see MetadataClient.
+type testMetadataService struct {
+	mu       sync.Mutex
+	links    map[string][][]byte
+	layouts  map[string][]byte
+	failures int
+	requests int
+}
+
+func (s *testMetadataService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if s.failures > 0 {
+		s.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/api/links":
+		data, _ := io.ReadAll(r.Body)
+		linkEnv, err := LoadMetadataFrom(bytes.NewReader(data))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		name := linkEnv.GetPayload().(Link).Name
+		s.links[name] = append(s.links[name], data)
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/api/links/"):
+		links := s.links[strings.TrimPrefix(r.URL.Path, "/api/links/")]
+		w.Write([]byte("[" + string(bytes.Join(links, []byte(","))) + "]")) //nolint:errcheck
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/api/layouts/"):
+		layout, ok := s.layouts[strings.TrimPrefix(r.URL.Path, "/api/layouts/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(layout) //nolint:errcheck
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestMetadataClient(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := GenerateTestVectors(dir, []byte("metadata client")); err != nil {
+		t.Fatal(err)
+	}
+	var ownerKey Key
+	if err := ownerKey.LoadKeyDefaults(filepath.Join(dir, "keys", "owner.pub")); err != nil {
+		t.Fatal(err)
+	}
+	layoutKeys := map[string]Key{ownerKey.KeyID: ownerKey}
+	var layout bytes.Buffer
+	layoutEnv, err := LoadMetadata(filepath.Join(dir, "valid", RootLayoutName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := DumpMetadataTo(layoutEnv, &layout); err != nil {
+		t.Fatal(err)
+	}
+
+	service := &testMetadataService{links: map[string][][]byte{}, layouts: map[string][]byte{"root": layout.Bytes()}}
+	server := httptest.NewServer(service)
+	defer server.Close()
+	client := NewMetadataClient(server.URL+"/api/", BearerToken("secret"))
+	client.Retry = RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+	ctx := context.Background()
+
+	// Links are submitted from the runners and verified from the service
+	fileStore := &FileLinkStore{Dir: filepath.Join(dir, "valid")}
+	for _, step := range []string{"write-code", "package"} {
+		links, err := fileStore.GetLinksForStep(ctx, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, linkEnv := range links {
+			assert.Nil(t, client.SubmitLink(ctx, linkEnv))
+		}
+	}
+	links, err := client.GetLinksForStep(ctx, "package")
+	assert.Nil(t, err)
+	assert.Len(t, links, 1)
+	fetched, err := client.FetchLayout(ctx, "root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = InTotoVerifyWithLinkStore(fetched, layoutKeys, client, "", nil, nil, false)
+	assert.Nil(t, err)
+
+	assert.ErrorIs(t, client.SubmitLink(ctx, layoutEnv), ErrNotLink)
+	_, err = client.FetchLayout(ctx, "missing")
+	assert.ErrorIs(t, err, ErrMetadataService)
+
+	// Unavailable services are retried, other errors are not
+	service.failures = 2
+	service.requests = 0
+	_, err = client.GetLinksForStep(ctx, "package")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, service.requests)
+
+	service.failures = 3
+	service.requests = 0
+	_, err = client.GetLinksForStep(ctx, "package")
+	assert.ErrorIs(t, err, ErrMetadataService)
+	assert.Equal(t, 3, service.requests)
+	service.failures = 0
+
+	service.requests = 0
+	unauthorized := NewMetadataClient(server.URL+"/api", BearerToken("wrong"))
+	_, err = unauthorized.GetLinksForStep(ctx, "package")
+	assert.ErrorIs(t, err, ErrMetadataService)
+	assert.Contains(t, err.Error(), "401")
+	assert.Equal(t, 1, service.requests)
+
+	// Retries stop when the context is done
+	service.failures = 10
+	client.Retry = RetryPolicy{MaxAttempts: 10, InitialBackoff: time.Hour}
+	cancelCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = client.GetLinksForStep(cancelCtx, "package")
+	assert.ErrorIs(t, err, ErrMetadataService)
+}
@@ -0,0 +1,177 @@
+package in_toto
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// LinkFilename returns the file name of the passed link signed by the passed
+// key, i.e. '<name>.<keyid prefix>.link', see LinkNameFormat.
+func LinkFilename(metadata Metadata, key Key) (string, error) {
+	link, ok := metadata.GetPayload().(Link)
+	if !ok {
+		return "", ErrNotLink
+	}
+	return fmt.Sprintf(LinkNameFormat, link.Name, key.KeyID), nil
+}
+
+/*
+MetadataFilename returns the conventional file name of the passed Metablock or
+Envelope, i.e. for links '<name>.<keyid prefix>.link' with the key id of
+their signature, see LinkNameFormat, or '<name>.link' if unsigned, see
+LinkNameFormatShort, and RootLayoutName for layouts.  Links with several
+signatures have no conventional file name, and an error is returned.
+*/
+func MetadataFilename(metadata Metadata) (string, error) {
+	switch payload := metadata.GetPayload().(type) {
+	case Link:
+		sigs := metadata.Sigs()
+		switch len(sigs) {
+		case 0:
+			return fmt.Sprintf(LinkNameFormatShort, payload.Name), nil
+		case 1:
+			return fmt.Sprintf(LinkNameFormat, payload.Name, sigs[0].KeyID), nil
+		}
+		return "", fmt.Errorf("link '%s' has %d signatures, expected one", payload.Name, len(sigs))
+	case Layout:
+		return RootLayoutName, nil
+	}
+	return "", ErrUnknownMetadataType
+}
+
+/*
+DumpMetadata writes the passed metadata to the passed directory under its
+conventional file name, see MetadataFilename, and returns the path of the
+written file.  Like Dump, it replaces the file atomically, so that a writer
+killed mid-write leaves the previous file intact.
+*/
+func DumpMetadata(metadata Metadata, dir string) (string, error) {
+	name, err := MetadataFilename(metadata)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, name)
+	if err := metadata.Dump(path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+/*
+DumpMetadataTo writes the passed metadata to the passed writer, in the same
+format as its Dump method writes it to a file, e.g. to serve it in an HTTP
+response.  An ErrUnknownMetadataType is returned for metadata types that cannot
+be written to a writer.
+
+Metablocks and envelopes are written in a canonical on-disk format, so that
+the same metadata is written byte for byte alike across runs and Go versions,
+e.g. to compare link files of two runs with diff:
+
+  - JSON indented with two spaces, without trailing newline,
+  - object keys sorted by their UTF-8 bytes on all nesting levels, including
+    fields of structs, e.g. of custom byproducts, see LinkByproducts,
+  - signatures sorted by keyid, and by signature for the same keyid,
+  - numbers with integral value up to 2^53 written as integers, e.g. 0 for
+    the return value byproduct, other numbers in the shortest form that
+    decodes to the same float64,
+  - strings escaped like encoding/json does, but without escaping HTML
+    characters, i.e. '<', '>' and '&' are written verbatim.
+
+The format is independent of the canonical JSON the signatures are created
+over, see EncodeCanonical, i.e. reformatting a file does not affect its
+signatures.
+*/
+func DumpMetadataTo(metadata Metadata, w io.Writer) error {
+	dumper, ok := metadata.(interface{ DumpTo(io.Writer) error })
+	if !ok {
+		return ErrUnknownMetadataType
+	}
+	return dumper.DumpTo(w)
+}
+
+/*
+encodeMetadataFile returns the passed value encoded in the canonical on-disk
+format of metadata, see DumpMetadataTo.  Signatures must be sorted by the
+caller, see sortSignatures.
+*/
+func encodeMetadataFile(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+
+	// Decoding to generic values sorts the fields of structs like map keys
+	var value any
+	dec := json.NewDecoder(&buf)
+	dec.UseNumber()
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+	value, err := normalizeNumbers(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var result bytes.Buffer
+	enc = json.NewEncoder(&result)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(value); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(result.Bytes(), []byte("\n")), nil
+}
+
+// normalizeNumbers rewrites the numbers in the passed value, as decoded by
+// encoding/json with UseNumber, in the format of DumpMetadataTo.
+func normalizeNumbers(value any) (any, error) {
+	switch v := value.(type) {
+	case json.Number:
+		f, err := strconv.ParseFloat(string(v), 64)
+		if err != nil {
+			return nil, err
+		}
+		if f == math.Trunc(f) && math.Abs(f) <= 1<<53 {
+			return json.Number(strconv.FormatInt(int64(f), 10)), nil
+		}
+		return json.Number(strconv.FormatFloat(f, 'g', -1, 64)), nil
+	case map[string]any:
+		for key, item := range v {
+			normalized, err := normalizeNumbers(item)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = normalized
+		}
+	case []any:
+		for i, item := range v {
+			normalized, err := normalizeNumbers(item)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = normalized
+		}
+	}
+	return value, nil
+}
+
+// sortSignatures returns a copy of the passed signatures sorted by keyid and
+// signature, see DumpMetadataTo.
+func sortSignatures(sigs []Signature) []Signature {
+	sorted := append([]Signature{}, sigs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].KeyID != sorted[j].KeyID {
+			return sorted[i].KeyID < sorted[j].KeyID
+		}
+		return sorted[i].Sig < sorted[j].Sig
+	})
+	return sorted
+}
@@ -0,0 +1,171 @@
+package in_toto
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDumpMetadata(t *testing.T) {
+	dir := t.TempDir()
+	for _, table := range []struct {
+		path     string
+		expected string
+	}{
+		{"package.d3ffd108.link", "package.d3ffd108.link"},
+		{"demo.layout", RootLayoutName},
+		{"demo.dsse.layout", RootLayoutName},
+	} {
+		metadata, err := LoadMetadata(table.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path, err := DumpMetadata(metadata, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, filepath.Join(dir, table.expected), path)
+
+		// The dumped metadata is loaded with the same payload type
+		loaded, err := LoadMetadata(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.IsType(t, metadata.GetPayload(), loaded.GetPayload())
+	}
+
+	// No temporary files are left behind
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	assert.Equal(t, []string{metadataDirLockName, "package.d3ffd108.link", RootLayoutName}, names)
+
+	unsigned := &Metablock{Signed: Link{Type: "link", Name: "build"}}
+	name, err := MetadataFilename(unsigned)
+	assert.Nil(t, err)
+	assert.Equal(t, "build.link", name)
+
+	unsigned.Signatures = []Signature{{KeyID: "a"}, {KeyID: "b"}}
+	_, err = MetadataFilename(unsigned)
+	assert.NotNil(t, err)
+}
+
+func TestLoadMetadataFromDumpMetadataTo(t *testing.T) {
+	for _, path := range []string{"package.d3ffd108.link", "demo.layout", "demo.dsse.layout"} {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		metadata, err := LoadMetadataFrom(f)
+		f.Close()
+		if !assert.Nil(t, err, path) {
+			continue
+		}
+
+		// Writing to a writer yields the same bytes as dumping to a file
+		var buf bytes.Buffer
+		assert.Nil(t, DumpMetadataTo(metadata, &buf), path)
+		dumpPath := filepath.Join(t.TempDir(), path)
+		if err := metadata.Dump(dumpPath); err != nil {
+			t.Fatal(err)
+		}
+		dumped, err := os.ReadFile(dumpPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, dumped, buf.Bytes(), path)
+
+		loaded, err := LoadMetadataFrom(&buf)
+		assert.Nil(t, err, path)
+		assert.Equal(t, metadata.GetPayload(), loaded.GetPayload(), path)
+	}
+
+	_, err := LoadMetadataFrom(bytes.NewReader([]byte("not json")))
+	assert.NotNil(t, err)
+}
+
+func TestDumpMetadataReproducible(t *testing.T) {
+	// Keys with deterministic signatures, unlike RSA-PSS
+	var carol Key
+	if err := carol.LoadKeyDefaults("carol"); err != nil {
+		t.Fatal(err)
+	}
+	erika, err := GenerateEd25519Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	type custom struct {
+		Zulu  string `json:"zulu"`
+		Alpha string `json:"alpha"`
+	}
+	newLink := func() Link {
+		link := Link{Type: "link", Name: "build", Command: []string{"make", "a<b&c>d"},
+			Materials: map[string]HashObj{}, Products: map[string]HashObj{}}
+		link.ByProducts.SetReturnValue(0)
+		link.Environment.SetCustom("ci", custom{Zulu: "z", Alpha: "a"})
+		return link
+	}
+
+	dump := func(metadata Metadata) string {
+		var buf bytes.Buffer
+		if err := DumpMetadataTo(metadata, &buf); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+	for _, envelope := range []bool{false, true} {
+		// Signing order does not matter
+		var dumped []string
+		for _, keys := range [][]Key{{erika, carol}, {carol, erika}} {
+			var metadata Metadata = &Metablock{Signed: newLink()}
+			if envelope {
+				metadata = &Envelope{}
+				if err := metadata.(*Envelope).SetPayload(newLink()); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, key := range keys {
+				if err := metadata.Sign(key); err != nil {
+					t.Fatal(err)
+				}
+			}
+			dumped = append(dumped, dump(metadata))
+		}
+		assert.Equal(t, dumped[0], dumped[1])
+
+		// Loading and dumping again does not change the file
+		loaded, err := decodeMetadata([]byte(dumped[0]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, dumped[0], dump(loaded))
+		if !envelope {
+			assert.Contains(t, dumped[0], `"a<b&c>d"`)
+			assert.Contains(t, dumped[0], `"return-value": 0`)
+			assert.Regexp(t, `(?s)"alpha": "a",\s*"zulu": "z"`, dumped[0])
+			assert.Regexp(t, `(?s)"byproducts".*"command".*"environment".*"materials"`, dumped[0])
+			assert.False(t, strings.HasSuffix(dumped[0], "\n"))
+		}
+	}
+
+	// Numbers are written alike, regardless of how they were written before
+	encoded, err := encodeMetadataFile(map[string]any{"count": json.Number("2.0"), "exp": json.Number("1E2"),
+		"ratio": 1.5, "big": 1e21, "int": 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "{\n  \"big\": 1e+21,\n  \"count\": 2,\n  \"exp\": 100,\n  \"int\": 3,\n  \"ratio\": 1.5\n}",
+		string(encoded))
+}
@@ -1,283 +1,57 @@
 package in_toto
 
 import (
-	"context"
-	"crypto/ecdsa"
-	"crypto/rsa"
 	"crypto/x509"
-	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"reflect"
-	"regexp"
-	"strconv"
+	"sort"
 	"strings"
 	"time"
 
-	"github.com/secure-systems-lab/go-securesystemslib/cjson"
+	"github.com/in-toto/in-toto-golang/in_toto/keys"
 	"github.com/secure-systems-lab/go-securesystemslib/dsse"
 )
 
 type HashObj = map[string]string
 
-/*
-KeyVal contains the actual values of a key, as opposed to key metadata such as
-a key identifier or key type.  For RSA keys, the key value is a pair of public
-and private keys in PEM format stored as strings.  For public keys the Private
-field may be an empty string.
-*/
-type KeyVal struct {
-	Private     string `json:"private,omitempty"`
-	Public      string `json:"public"`
-	Certificate string `json:"certificate,omitempty"`
-}
-
-/*
-Key represents a generic in-toto key that contains key metadata, such as an
-identifier, supported hash algorithms to create the identifier, the key type
-and the supported signature scheme, and the actual key value.
-*/
-type Key struct {
-	KeyID               string   `json:"keyid"`
-	KeyIDHashAlgorithms []string `json:"keyid_hash_algorithms"`
-	KeyType             string   `json:"keytype"`
-	KeyVal              KeyVal   `json:"keyval"`
-	Scheme              string   `json:"scheme"`
-}
-
-// ErrEmptyKeyField will be thrown if a field in our Key struct is empty.
-var ErrEmptyKeyField = errors.New("empty field in key")
-
-// ErrInvalidHexString will be thrown, if a string doesn't match a hex string.
-var ErrInvalidHexString = errors.New("invalid hex string")
+// ErrInvalidKeyID is returned when a key ID in metadata is neither a hex
+// encoded SHA-256 digest nor an OpenPGP v4 fingerprint.
+var ErrInvalidKeyID = errors.New("invalid key id")
 
-// ErrSchemeKeyTypeMismatch will be thrown, if the given scheme and key type are not supported together.
-var ErrSchemeKeyTypeMismatch = errors.New("the scheme and key type are not supported together")
+// ErrDuplicateSignature is returned when a Metablock is signed with a key,
+// whose signature it already has.
+var ErrDuplicateSignature = errors.New("duplicate signature")
 
-// ErrUnsupportedKeyIDHashAlgorithms will be thrown, if the specified KeyIDHashAlgorithms is not supported.
-var ErrUnsupportedKeyIDHashAlgorithms = errors.New("the given keyID hash algorithm is not supported")
-
-// ErrKeyKeyTypeMismatch will be thrown, if the specified keyType does not match the key
-var ErrKeyKeyTypeMismatch = errors.New("the given key does not match its key type")
-
-// ErrNoPublicKey gets returned when the private key value is not empty.
-var ErrNoPublicKey = errors.New("the given key is not a public key")
-
-// ErrCurveSizeSchemeMismatch gets returned, when the scheme and curve size are incompatible
-// for example: curve size = "521" and scheme = "ecdsa-sha2-nistp224"
-var ErrCurveSizeSchemeMismatch = errors.New("the scheme does not match the curve size")
-
-/*
-matchEcdsaScheme checks if the scheme suffix, matches the ecdsa key
-curve size. We do not need a full regex match here, because
-our validateKey functions are already checking for a valid scheme string.
-*/
-func matchEcdsaScheme(curveSize int, scheme string) error {
-	if !strings.HasSuffix(scheme, strconv.Itoa(curveSize)) {
-		return ErrCurveSizeSchemeMismatch
-	}
-	return nil
-}
+// ErrInvalidMetadata is returned by LoadMetadata and LoadMetadataFrom, if the
+// loaded layout or link is malformed, see ValidateMetadata.
+var ErrInvalidMetadata = errors.New("invalid metadata")
 
 /*
 validateHexString is used to validate that a string passed to it contains
 only valid hexadecimal characters.
 */
 func validateHexString(str string) error {
-	formatCheck, _ := regexp.MatchString("^[a-fA-F0-9]+$", str)
-	if !formatCheck {
+	if !isHexString(str) {
 		return fmt.Errorf("%w: %s", ErrInvalidHexString, str)
 	}
 	return nil
 }
 
 /*
-validateKeyVal validates the KeyVal struct. In case of an ed25519 key,
-it will check for a hex string for private and public key. In any other
-case, validateKeyVal will try to decode the PEM block. If this succeeds,
-we have a valid PEM block in our KeyVal struct. On success it will return nil
-on failure it will return the corresponding error. This can be either
-an ErrInvalidHexString, an ErrNoPEMBlock or an ErrUnsupportedKeyType
-if the KeyType is unknown.
+validateKeyID checks that the passed key ID of a functionary or signature is
+hex encoded, and 64 characters long like SHA-256 key IDs, or 40 characters
+long like the fingerprints of GPG keys, or returns an ErrInvalidKeyID.
 */
-func validateKeyVal(key Key) error {
-	switch key.KeyType {
-	case ed25519KeyType:
-		// We cannot use matchPublicKeyKeyType or matchPrivateKeyKeyType here,
-		// because we retrieve the key not from PEM. Hence we are dealing with
-		// plain ed25519 key bytes. These bytes can't be typechecked like in the
-		// matchKeyKeytype functions.
-		err := validateHexString(key.KeyVal.Public)
-		if err != nil {
-			return err
-		}
-		if key.KeyVal.Private != "" {
-			err := validateHexString(key.KeyVal.Private)
-			if err != nil {
-				return err
-			}
-		}
-	case rsaKeyType, ecdsaKeyType:
-		// We do not need the pemData here, so we can throw it away via '_'
-		_, parsedKey, err := decodeAndParse([]byte(key.KeyVal.Public))
-		if err != nil {
-			return err
-		}
-		err = matchPublicKeyKeyType(parsedKey, key.KeyType)
-		if err != nil {
-			return err
-		}
-		if key.KeyVal.Private != "" {
-			// We do not need the pemData here, so we can throw it away via '_'
-			_, parsedKey, err := decodeAndParse([]byte(key.KeyVal.Private))
-			if err != nil {
-				return err
-			}
-			err = matchPrivateKeyKeyType(parsedKey, key.KeyType)
-			if err != nil {
-				return err
-			}
-		}
-	default:
-		return ErrUnsupportedKeyType
+func validateKeyID(keyID string) error {
+	if err := validateHexString(keyID); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidKeyID, err)
 	}
-	return nil
-}
-
-/*
-matchPublicKeyKeyType validates an interface if it can be asserted to a
-the RSA or ECDSA public key type. We can only check RSA and ECDSA this way,
-because we are storing them in PEM format. Ed25519 keys are stored as plain
-ed25519 keys encoded as hex strings, thus we have no metadata for them.
-This function will return nil on success. If the key type does not match
-it will return an ErrKeyKeyTypeMismatch.
-*/
-func matchPublicKeyKeyType(key interface{}, keyType string) error {
-	switch key.(type) {
-	case *rsa.PublicKey:
-		if keyType != rsaKeyType {
-			return ErrKeyKeyTypeMismatch
-		}
-	case *ecdsa.PublicKey:
-		if keyType != ecdsaKeyType {
-			return ErrKeyKeyTypeMismatch
-		}
-	default:
-		return ErrInvalidKey
-	}
-	return nil
-}
-
-/*
-matchPrivateKeyKeyType validates an interface if it can be asserted to a
-the RSA or ECDSA private key type. We can only check RSA and ECDSA this way,
-because we are storing them in PEM format. Ed25519 keys are stored as plain
-ed25519 keys encoded as hex strings, thus we have no metadata for them.
-This function will return nil on success. If the key type does not match
-it will return an ErrKeyKeyTypeMismatch.
-*/
-func matchPrivateKeyKeyType(key interface{}, keyType string) error {
-	// we can only check RSA and ECDSA this way, because we are storing them in PEM
-	// format. ed25519 keys are stored as plain ed25519 keys encoded as hex strings
-	// so we have no metadata for them.
-	switch key.(type) {
-	case *rsa.PrivateKey:
-		if keyType != rsaKeyType {
-			return ErrKeyKeyTypeMismatch
-		}
-	case *ecdsa.PrivateKey:
-		if keyType != ecdsaKeyType {
-			return ErrKeyKeyTypeMismatch
-		}
-	default:
-		return ErrInvalidKey
-	}
-	return nil
-}
-
-/*
-matchKeyTypeScheme checks if the specified scheme matches our specified
-keyType. If the keyType is not supported it will return an
-ErrUnsupportedKeyType. If the keyType and scheme do not match it will return
-an ErrSchemeKeyTypeMismatch. If the specified keyType and scheme are
-compatible matchKeyTypeScheme will return nil.
-*/
-func matchKeyTypeScheme(key Key) error {
-	switch key.KeyType {
-	case rsaKeyType:
-		for _, scheme := range getSupportedRSASchemes() {
-			if key.Scheme == scheme {
-				return nil
-			}
-		}
-	case ed25519KeyType:
-		for _, scheme := range getSupportedEd25519Schemes() {
-			if key.Scheme == scheme {
-				return nil
-			}
-		}
-	case ecdsaKeyType:
-		for _, scheme := range getSupportedEcdsaSchemes() {
-			if key.Scheme == scheme {
-				return nil
-			}
-		}
-	default:
-		return fmt.Errorf("%w: %s", ErrUnsupportedKeyType, key.KeyType)
-	}
-	return ErrSchemeKeyTypeMismatch
-}
-
-/*
-validateKey checks the outer key object (everything, except the KeyVal struct).
-It verifies the keyID for being a hex string and checks for empty fields.
-On success it will return nil, on error it will return the corresponding error.
-Either: ErrEmptyKeyField or ErrInvalidHexString.
-*/
-func validateKey(key Key) error {
-	err := validateHexString(key.KeyID)
-	if err != nil {
-		return err
-	}
-	// This probably can be done more elegant with reflection
-	// but we care about performance, do we?!
-	if key.KeyType == "" {
-		return fmt.Errorf("%w: keytype", ErrEmptyKeyField)
-	}
-	if key.KeyVal.Public == "" && key.KeyVal.Certificate == "" {
-		return fmt.Errorf("%w: keyval.public and keyval.certificate cannot both be blank", ErrEmptyKeyField)
-	}
-	if key.Scheme == "" {
-		return fmt.Errorf("%w: scheme", ErrEmptyKeyField)
-	}
-	err = matchKeyTypeScheme(key)
-	if err != nil {
-		return err
-	}
-	// only check for supported KeyIDHashAlgorithms, if the variable has been set
-	if key.KeyIDHashAlgorithms != nil {
-		supportedKeyIDHashAlgorithms := getSupportedKeyIDHashAlgorithms()
-		if !supportedKeyIDHashAlgorithms.IsSubSet(NewSet(key.KeyIDHashAlgorithms...)) {
-			return fmt.Errorf("%w: %#v, supported are: %#v", ErrUnsupportedKeyIDHashAlgorithms, key.KeyIDHashAlgorithms, getSupportedKeyIDHashAlgorithms())
-		}
-	}
-	return nil
-}
-
-/*
-validatePublicKey is a wrapper around validateKey. It test if the private key
-value in the key is empty and then validates the key via calling validateKey.
-On success it will return nil, on error it will return an ErrNoPublicKey error.
-*/
-func validatePublicKey(key Key) error {
-	if key.KeyVal.Private != "" {
-		return ErrNoPublicKey
-	}
-	err := validateKey(key)
-	if err != nil {
-		return err
+	if len(keyID) != 64 && len(keyID) != 40 {
+		return fmt.Errorf("%w: '%s' has %d instead of 64 or 40 hex digits", ErrInvalidKeyID, keyID, len(keyID))
 	}
 	return nil
 }
@@ -288,9 +62,14 @@ of the Key, which was used to create the signature and the signature data.  The
 used signature scheme is found in the corresponding Key.
 */
 type Signature struct {
-	KeyID       string `json:"keyid"`
-	Sig         string `json:"sig"`
-	Certificate string `json:"cert,omitempty"`
+	KeyID       string      `json:"keyid"`
+	Sig         string      `json:"sig"`
+	Certificate string      `json:"cert,omitempty"`
+	Timestamps  []Timestamp `json:"timestamps,omitempty"`
+	// GPGSignature and OtherHeaders hold GPG signatures in the format of the
+	// in-toto reference implementation, see verifyGPGSignature
+	GPGSignature string `json:"signature,omitempty"`
+	OtherHeaders string `json:"other_headers,omitempty"`
 }
 
 // GetCertificate returns the parsed x509 certificate attached to the signature,
@@ -310,11 +89,20 @@ validateSignature is a function used to check if a passed signature is valid,
 by inspecting the key ID and the signature itself.
 */
 func validateSignature(signature Signature) error {
-	if err := validateHexString(signature.KeyID); err != nil {
-		return err
+	if err := validateKeyID(signature.KeyID); err != nil {
+		return atPointer(err, []interface{}{"keyid"}, "")
+	}
+	if signature.OtherHeaders != "" {
+		if err := validateHexString(signature.OtherHeaders); err != nil {
+			return atPointer(err, []interface{}{"other_headers"}, "")
+		}
+		if err := validateHexString(signature.GPGSignature); err != nil {
+			return atPointer(err, []interface{}{"signature"}, "")
+		}
+		return nil
 	}
 	if err := validateHexString(signature.Sig); err != nil {
-		return err
+		return atPointer(err, []interface{}{"sig"}, "")
 	}
 	return nil
 }
@@ -324,9 +112,9 @@ validateSliceOfSignatures is a helper function used to validate multiple
 signatures stored in a slice.
 */
 func validateSliceOfSignatures(slice []Signature) error {
-	for _, signature := range slice {
+	for i, signature := range slice {
 		if err := validateSignature(signature); err != nil {
-			return err
+			return atPointer(err, []interface{}{i}, "")
 		}
 	}
 	return nil
@@ -339,13 +127,17 @@ functionality for signing and signature verification, and reading from and
 writing to disk.
 */
 type Link struct {
-	Type        string                 `json:"_type"`
-	Name        string                 `json:"name"`
-	Materials   map[string]HashObj     `json:"materials"`
-	Products    map[string]HashObj     `json:"products"`
-	ByProducts  map[string]interface{} `json:"byproducts"`
-	Command     []string               `json:"command"`
-	Environment map[string]interface{} `json:"environment"`
+	Type        string             `json:"_type"`
+	Name        string             `json:"name"`
+	Materials   map[string]HashObj `json:"materials"`
+	Products    map[string]HashObj `json:"products"`
+	ByProducts  LinkByproducts     `json:"byproducts"`
+	Command     []string           `json:"command"`
+	Environment LinkEnvironment    `json:"environment"`
+	// AbsentProducts are patterns of paths, which the functionary asserts that
+	// no product matched after the step, see WithAbsentProducts and the ABSENT
+	// artifact rule
+	AbsentProducts []string `json:"absent_products,omitempty"`
 }
 
 /*
@@ -353,13 +145,10 @@ validateArtifacts is a general function used to validate products and materials.
 */
 func validateArtifacts(artifacts map[string]HashObj) error {
 	for artifactName, artifact := range artifacts {
-		artifactValue := reflect.ValueOf(artifact).MapRange()
-		for artifactValue.Next() {
-			value := artifactValue.Value().Interface().(string)
-			hashType := artifactValue.Key().Interface().(string)
+		for hashType, value := range artifact {
 			if err := validateHexString(value); err != nil {
-				return fmt.Errorf("in artifact '%s', %s hash value: %s",
-					artifactName, hashType, err.Error())
+				return atPointer(fmt.Errorf("in artifact '%s', %s hash value: %s",
+					artifactName, hashType, err.Error()), []interface{}{artifactName, hashType}, "")
 			}
 		}
 	}
@@ -372,23 +161,41 @@ matches the necessary format.
 */
 func validateLink(link Link) error {
 	if link.Type != "link" {
-		return fmt.Errorf("invalid type for link '%s': should be 'link'",
-			link.Name)
+		return atPointer(fmt.Errorf("invalid type for link '%s': should be 'link'",
+			link.Name), []interface{}{"_type"}, "")
+	}
+
+	if link.Name == "" {
+		return atPointer(fmt.Errorf("name of link cannot be empty"), []interface{}{"name"}, "")
 	}
 
 	if err := validateArtifacts(link.Materials); err != nil {
-		return fmt.Errorf("in materials of link '%s': %s", link.Name,
-			err.Error())
+		return atPointer(err, []interface{}{"materials"}, "in materials of link '%s': %w", link.Name)
 	}
 
 	if err := validateArtifacts(link.Products); err != nil {
-		return fmt.Errorf("in products of link '%s': %s", link.Name,
-			err.Error())
+		return atPointer(err, []interface{}{"products"}, "in products of link '%s': %w", link.Name)
+	}
+
+	for i, pattern := range link.AbsentProducts {
+		if _, err := match(pattern, ""); err != nil {
+			return atPointer(fmt.Errorf("invalid absent product pattern '%s' for link '%s': %w",
+				pattern, link.Name, err), []interface{}{"absent_products", i}, "")
+		}
 	}
 
 	return nil
 }
 
+/*
+Validate checks that the link conforms to the in-toto metadata specification,
+e.g. that it has a name and hex encoded artifact digests.  Invalid fields are
+located with a PointerError, see ErrorPointer.
+*/
+func (link Link) Validate() error {
+	return validateLink(link)
+}
+
 /*
 LinkNameFormat represents a format string used to create the filename for a
 signed Link (wrapped in a Metablock). It consists of the name of the link and
@@ -410,6 +217,9 @@ LinkNameFormatShort is for links that are not signed, e.g.:
 const LinkNameFormatShort = "%s.link"
 const LinkGlobFormat = "%s.????????.link"
 
+// RootLayoutName is the conventional file name of a root layout.
+const RootLayoutName = "root.layout"
+
 /*
 SublayoutLinkDirFormat represents the format of the name of the directory for
 sublayout links during the verification workflow.
@@ -424,14 +234,17 @@ type SupplyChainItem struct {
 	Name              string     `json:"name"`
 	ExpectedMaterials [][]string `json:"expected_materials"`
 	ExpectedProducts  [][]string `json:"expected_products"`
+	// ArtifactProfile is the name of the artifact profile of the layout, used
+	// to record the artifacts of the item, see ArtifactProfile
+	ArtifactProfile string `json:"artifact_profile,omitempty"`
 }
 
 /*
-validateArtifactRule calls UnpackRule to validate that the passed rule conforms
-with any of the available rule formats.
+validateArtifactRule calls parseArtifactRule to validate that the passed rule
+conforms with any of the available rule formats.
 */
 func validateArtifactRule(rule []string) error {
-	if _, err := UnpackRule(rule); err != nil {
+	if _, err := parseArtifactRule(rule); err != nil {
 		return err
 	}
 	return nil
@@ -441,9 +254,9 @@ func validateArtifactRule(rule []string) error {
 validateSliceOfArtifactRules iterates over passed rules to validate them.
 */
 func validateSliceOfArtifactRules(rules [][]string) error {
-	for _, rule := range rules {
+	for i, rule := range rules {
 		if err := validateArtifactRule(rule); err != nil {
-			return err
+			return atPointer(err, []interface{}{i}, "")
 		}
 	}
 	return nil
@@ -456,14 +269,14 @@ a supply chain item isn't empty.
 */
 func validateSupplyChainItem(item SupplyChainItem) error {
 	if item.Name == "" {
-		return fmt.Errorf("name cannot be empty")
+		return atPointer(fmt.Errorf("name cannot be empty"), []interface{}{"name"}, "")
 	}
 
 	if err := validateSliceOfArtifactRules(item.ExpectedMaterials); err != nil {
-		return fmt.Errorf("invalid material rule: %s", err)
+		return atPointer(err, []interface{}{"expected_materials"}, "invalid material rule: %w")
 	}
 	if err := validateSliceOfArtifactRules(item.ExpectedProducts); err != nil {
-		return fmt.Errorf("invalid product rule: %s", err)
+		return atPointer(err, []interface{}{"expected_products"}, "invalid product rule: %w")
 	}
 	return nil
 }
@@ -487,11 +300,11 @@ necessary format of an inspection.
 */
 func validateInspection(inspection Inspection) error {
 	if err := validateSupplyChainItem(inspection.SupplyChainItem); err != nil {
-		return fmt.Errorf("inspection %s", err.Error())
+		return atPointer(err, nil, "inspection %w")
 	}
 	if inspection.Type != "inspection" {
-		return fmt.Errorf("invalid Type value for inspection '%s': should be "+
-			"'inspection'", inspection.SupplyChainItem.Name)
+		return atPointer(fmt.Errorf("invalid Type value for inspection '%s': should be "+
+			"'inspection'", inspection.SupplyChainItem.Name), []interface{}{"_type"}, "")
 	}
 	return nil
 }
@@ -510,17 +323,41 @@ type Step struct {
 	CertificateConstraints []CertificateConstraint `json:"cert_constraints,omitempty"`
 	ExpectedCommand        []string                `json:"expected_command"`
 	Threshold              int                     `json:"threshold"`
+	// Sublayout optionally references the sublayout of the step by URI and
+	// digest, which is then fetched instead of loaded from the link
+	// directory, see SublayoutReference.
+	Sublayout *SublayoutReference `json:"sublayout,omitempty"`
+	// Git optionally references a signed git commit or tag, whose signature
+	// is verified as evidence of the step instead of link metadata, see
+	// GitReference.
+	Git *GitReference `json:"git,omitempty"`
+	// Role is the name of the functionary role of the layout, whose keys are
+	// authorized to perform the step, see FunctionaryRole
+	Role string `json:"role,omitempty"`
+	// ExpectedToolchains optionally lists the approved version patterns of
+	// the toolchains used by the step by toolchain name, e.g.
+	// {"go": ["go1.21.*"]}, which its links must record, see
+	// CollectToolchainVersions
+	ExpectedToolchains map[string][]string `json:"expected_toolchains,omitempty"`
 	SupplyChainItem
 }
 
 // CheckCertConstraints returns true if the provided certificate matches at least one
 // of the constraints for this step.
 func (s Step) CheckCertConstraints(key Key, rootCAIDs []string, rootCertPool, intermediateCertPool *x509.CertPool) error {
+	return s.checkCertConstraintsAt(key, rootCAIDs, rootCertPool, intermediateCertPool, time.Time{}, 0)
+}
+
+// checkCertConstraintsAt is like CheckCertConstraints, but verifies the trust
+// chain of the certificate at the passed time with the passed clock skew
+// tolerance, see VerifyCertificateTrustAt.
+func (s Step) checkCertConstraintsAt(key Key, rootCAIDs []string, rootCertPool, intermediateCertPool *x509.CertPool,
+	now time.Time, clockSkew time.Duration) error {
 	if len(s.CertificateConstraints) == 0 {
 		return fmt.Errorf("no constraints found")
 	}
 
-	_, possibleCert, err := decodeAndParse([]byte(key.KeyVal.Certificate))
+	_, possibleCert, err := keys.DecodePEM([]byte(key.KeyVal.Certificate), nil)
 	if err != nil {
 		return err
 	}
@@ -531,7 +368,7 @@ func (s Step) CheckCertConstraints(key Key, rootCAIDs []string, rootCertPool, in
 	}
 
 	for _, constraint := range s.CertificateConstraints {
-		err = constraint.Check(cert, rootCAIDs, rootCertPool, intermediateCertPool)
+		err = constraint.checkAt(cert, rootCAIDs, rootCertPool, intermediateCertPool, now, clockSkew)
 		if err == nil {
 			return nil
 		}
@@ -550,17 +387,37 @@ necessary format of an step.
 */
 func validateStep(step Step) error {
 	if err := validateSupplyChainItem(step.SupplyChainItem); err != nil {
-		return fmt.Errorf("step %s", err.Error())
+		return atPointer(err, nil, "step %w")
 	}
 	if step.Type != "step" {
-		return fmt.Errorf("invalid Type value for step '%s': should be 'step'",
-			step.SupplyChainItem.Name)
+		return atPointer(fmt.Errorf("invalid Type value for step '%s': should be 'step'",
+			step.SupplyChainItem.Name), []interface{}{"_type"}, "")
 	}
-	for _, keyID := range step.PubKeys {
-		if err := validateHexString(keyID); err != nil {
-			return err
+	for i, keyID := range step.PubKeys {
+		if err := validateKeyID(keyID); err != nil {
+			return atPointer(err, []interface{}{"pubkeys", i}, "")
 		}
 	}
+	if step.Sublayout != nil {
+		if err := validateSublayoutReference(*step.Sublayout); err != nil {
+			return atPointer(err, []interface{}{"sublayout"}, "invalid sublayout of step '%s': %w",
+				step.SupplyChainItem.Name)
+		}
+	}
+	if step.Git != nil {
+		if step.Sublayout != nil {
+			return atPointer(fmt.Errorf("step '%s' references both a sublayout and a git object",
+				step.SupplyChainItem.Name), []interface{}{"git"}, "")
+		}
+		if err := validateGitReference(*step.Git); err != nil {
+			return atPointer(err, []interface{}{"git"}, "invalid git reference of step '%s': %w",
+				step.SupplyChainItem.Name)
+		}
+	}
+	if err := validateExpectedToolchains(step.ExpectedToolchains); err != nil {
+		return atPointer(err, []interface{}{"expected_toolchains"}, "invalid expected toolchains of step '%s': %w",
+			step.SupplyChainItem.Name)
+	}
 	return nil
 }
 
@@ -588,6 +445,65 @@ type Layout struct {
 	IntermediateCas map[string]Key `json:"intermediatecas,omitempty"`
 	Expires         string         `json:"expires"`
 	Readme          string         `json:"readme"`
+	// ArtifactProfiles are named artifact handling options, which steps and
+	// inspections can reference, see ArtifactProfile
+	ArtifactProfiles map[string]ArtifactProfile `json:"artifact_profiles,omitempty"`
+	// ArtifactMatching is the mode used to match artifact rules against
+	// artifact paths, see GetArtifactMatching
+	ArtifactMatching string `json:"artifact_matching,omitempty"`
+	// PatternSyntax is the syntax of artifact rule patterns, see
+	// GetPatternSyntax
+	PatternSyntax string `json:"pattern_syntax,omitempty"`
+	// Roles are named groups of functionary keys, which steps can reference,
+	// see FunctionaryRole
+	Roles map[string]FunctionaryRole `json:"roles,omitempty"`
+	// KeyValidity restricts or revokes functionary keys by key ID, see
+	// KeyValidity
+	KeyValidity map[string]KeyValidity `json:"key_validity,omitempty"`
+}
+
+const (
+	// ArtifactMatchingCaseSensitive matches artifact rules case-sensitively,
+	// which is the default
+	ArtifactMatchingCaseSensitive = "case-sensitive"
+	// ArtifactMatchingCaseInsensitive matches artifact rule patterns, path
+	// prefixes and MATCH rule destinations case-insensitively, e.g. for
+	// artifacts produced on case-insensitive filesystems
+	ArtifactMatchingCaseInsensitive = "case-insensitive"
+)
+
+// GetArtifactMatching returns the artifact matching mode of the layout, or
+// ArtifactMatchingCaseSensitive, if the layout does not set a mode.
+func (l *Layout) GetArtifactMatching() string {
+	if l.ArtifactMatching == "" {
+		return ArtifactMatchingCaseSensitive
+	}
+	return l.ArtifactMatching
+}
+
+// GetPatternSyntax returns the syntax of the artifact rule patterns of the
+// layout, or PatternSyntaxFnmatch, if the layout does not set a syntax, see
+// RegisterPatternSyntax.
+func (l *Layout) GetPatternSyntax() string {
+	if l.PatternSyntax == "" {
+		return PatternSyntaxFnmatch
+	}
+	return l.PatternSyntax
+}
+
+// SetExpiration sets the layout to expire the passed duration from now.
+func (l *Layout) SetExpiration(d time.Duration) {
+	l.Expires = time.Now().Add(d).UTC().Format(ISO8601DateSchema)
+}
+
+// IsExpired reports whether the layout has expired at the passed time.  A
+// layout with a malformed expiration date is considered expired.
+func (l *Layout) IsExpired(now time.Time) bool {
+	expires, err := time.Parse(ISO8601DateSchema, l.Expires)
+	if err != nil {
+		return true
+	}
+	return now.After(expires)
 }
 
 // Go does not allow to pass `[]T` (slice with certain type) to a function
@@ -619,14 +535,17 @@ func (l *Layout) RootCAIDs() []string {
 	return rootCAIDs
 }
 
-func validateLayoutKeys(keys map[string]Key) error {
-	for keyID, key := range keys {
+func validateLayoutKeys(layoutKeys map[string]Key) error {
+	for keyID, key := range layoutKeys {
 		if key.KeyID != keyID {
-			return fmt.Errorf("invalid key found")
+			return atPointer(fmt.Errorf("invalid key found"), []interface{}{keyID, "keyid"}, "")
 		}
-		err := validatePublicKey(key)
+		err := keys.ValidatePublicKey(key)
 		if err != nil {
-			return err
+			return atPointer(err, []interface{}{keyID}, "")
+		}
+		if err := validateKeyID(keyID); err != nil {
+			return atPointer(err, []interface{}{keyID, "keyid"}, "")
 		}
 	}
 
@@ -635,48 +554,148 @@ func validateLayoutKeys(keys map[string]Key) error {
 
 /*
 validateLayout is a function used to ensure that a passed item of type Layout
-matches the necessary format.
+matches the necessary format.  All invalid fields are reported, aggregated in
+a MultiError if there is more than one.
 */
 func validateLayout(layout Layout) error {
+	errs := &MultiError{}
 	if layout.Type != "layout" {
-		return fmt.Errorf("invalid Type value for layout: should be 'layout'")
+		errs.add(atPointer(fmt.Errorf("invalid Type value for layout: should be 'layout'"), []interface{}{"_type"}, ""))
 	}
 
 	if _, err := time.Parse(ISO8601DateSchema, layout.Expires); err != nil {
-		return fmt.Errorf("expiry time parsed incorrectly - date either" +
-			" invalid or of incorrect format")
+		errs.add(atPointer(fmt.Errorf("expiry time parsed incorrectly - date either"+
+			" invalid or of incorrect format"), []interface{}{"expires"}, ""))
 	}
 
 	if err := validateLayoutKeys(layout.Keys); err != nil {
-		return err
+		errs.add(atPointer(err, []interface{}{"keys"}, ""))
 	}
 
 	if err := validateLayoutKeys(layout.RootCas); err != nil {
-		return err
+		errs.add(atPointer(err, []interface{}{"rootcas"}, ""))
 	}
 
 	if err := validateLayoutKeys(layout.IntermediateCas); err != nil {
-		return err
+		errs.add(atPointer(err, []interface{}{"intermediatecas"}, ""))
 	}
 
 	var namesSeen = make(map[string]bool)
-	for _, step := range layout.Steps {
+	for i, step := range layout.Steps {
 		if namesSeen[step.Name] {
-			return fmt.Errorf("non unique step or inspection name found")
+			errs.add(atPointer(fmt.Errorf("non unique step or inspection name found"), []interface{}{"steps", i, "name"}, ""))
 		}
 
 		namesSeen[step.Name] = true
 
 		if err := validateStep(step); err != nil {
-			return err
+			errs.add(atPointer(err, []interface{}{"steps", i}, ""))
+		}
+
+		// Functionaries must be trusted by the layout, or their links can
+		// never be verified
+		for j, keyID := range step.PubKeys {
+			if _, ok := layout.Keys[keyID]; !ok {
+				errs.add(atPointer(fmt.Errorf("functionary key '%s' of step '%s' not found in layout keys",
+					keyID, step.Name), []interface{}{"steps", i, "pubkeys", j}, ""))
+			}
 		}
 	}
-	for _, inspection := range layout.Inspect {
+	for i, inspection := range layout.Inspect {
 		if namesSeen[inspection.Name] {
-			return fmt.Errorf("non unique step or inspection name found")
+			errs.add(atPointer(fmt.Errorf("non unique step or inspection name found"), []interface{}{"inspect", i, "name"}, ""))
 		}
 
 		namesSeen[inspection.Name] = true
+
+		if err := validateInspection(inspection); err != nil {
+			errs.add(atPointer(err, []interface{}{"inspect", i}, ""))
+		}
+	}
+
+	switch layout.ArtifactMatching {
+	case "", ArtifactMatchingCaseSensitive, ArtifactMatchingCaseInsensitive:
+	default:
+		errs.add(atPointer(fmt.Errorf("invalid artifact matching mode '%s', must be one of '%s' or '%s'",
+			layout.ArtifactMatching, ArtifactMatchingCaseSensitive, ArtifactMatchingCaseInsensitive),
+			[]interface{}{"artifact_matching"}, ""))
+	}
+	if _, err := GetPatternMatcher(layout.GetPatternSyntax()); err != nil {
+		errs.add(atPointer(err, []interface{}{"pattern_syntax"}, ""))
+	}
+
+	// Maps are validated in name order, so that errors are reported
+	// deterministically
+	profileNames := make([]string, 0, len(layout.ArtifactProfiles))
+	for name := range layout.ArtifactProfiles {
+		profileNames = append(profileNames, name)
+	}
+	sort.Strings(profileNames)
+	for _, name := range profileNames {
+		if err := validateArtifactProfile(name, layout.ArtifactProfiles[name]); err != nil {
+			errs.add(atPointer(err, []interface{}{"artifact_profiles", name}, ""))
+		}
+	}
+	for i, step := range layout.Steps {
+		if err := validateItemArtifactProfile(layout, step.SupplyChainItem); err != nil {
+			errs.add(atPointer(err, []interface{}{"steps", i, "artifact_profile"}, ""))
+		}
+	}
+
+	roleNames := make([]string, 0, len(layout.Roles))
+	for name := range layout.Roles {
+		roleNames = append(roleNames, name)
+	}
+	sort.Strings(roleNames)
+	for _, name := range roleNames {
+		if err := validateRole(name, layout.Roles[name], layout.Keys); err != nil {
+			errs.add(atPointer(err, []interface{}{"roles", name}, ""))
+		}
+	}
+	validityKeyIDs := make([]string, 0, len(layout.KeyValidity))
+	for keyID := range layout.KeyValidity {
+		validityKeyIDs = append(validityKeyIDs, keyID)
+	}
+	sort.Strings(validityKeyIDs)
+	for _, keyID := range validityKeyIDs {
+		if err := validateKeyValidity(keyID, layout.KeyValidity[keyID], layout.Keys); err != nil {
+			errs.add(atPointer(err, []interface{}{"key_validity", keyID}, ""))
+		}
+	}
+	for i, step := range layout.Steps {
+		if _, ok := layout.Roles[step.Role]; step.Role != "" && !ok {
+			errs.add(atPointer(fmt.Errorf("%w '%s' of step '%s'", ErrUnknownRole, step.Role, step.Name),
+				[]interface{}{"steps", i, "role"}, ""))
+		}
+	}
+	for i, inspection := range layout.Inspect {
+		if err := validateItemArtifactProfile(layout, inspection.SupplyChainItem); err != nil {
+			errs.add(atPointer(err, []interface{}{"inspect", i, "artifact_profile"}, ""))
+		}
+	}
+	return errs.err()
+}
+
+/*
+Validate checks that the layout conforms to the in-toto metadata
+specification, e.g. that its expiration date is in ISO 8601 format, its
+artifact rules are well-formed, its step and inspection names are unique and
+the functionary keys of its steps are layout keys.  All invalid fields are
+reported, located with a PointerError, and aggregated in a MultiError if there
+is more than one.
+*/
+func (l Layout) Validate() error {
+	return validateLayout(l)
+}
+
+// validateItemArtifactProfile checks that the artifact profile referenced by
+// the passed step or inspection, if any, is defined in the passed layout.
+func validateItemArtifactProfile(layout Layout, item SupplyChainItem) error {
+	if item.ArtifactProfile == "" {
+		return nil
+	}
+	if _, err := ResolveArtifactProfile(layout.ArtifactProfiles, item.ArtifactProfile); err != nil {
+		return fmt.Errorf("invalid step or inspection '%s': %w", item.Name, err)
 	}
 	return nil
 }
@@ -690,12 +709,51 @@ type Metadata interface {
 	Dump(string) error
 }
 
+/*
+LoadMetadata reads JSON formatted metadata, i.e. a Metablock or a DSSE
+envelope, from the passed path.  Malformed layouts and links are rejected with
+an ErrInvalidMetadata, that locates the invalid fields, see ValidateMetadata.
+*/
 func LoadMetadata(path string) (Metadata, error) {
 	jsonBytes, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
+	return decodeMetadata(jsonBytes)
+}
+
+/*
+LoadMetadataFrom reads JSON formatted metadata from the passed reader, e.g. an
+HTTP response body, object storage or stdin, like LoadMetadata.  The reader is
+read until EOF, but not closed.
+*/
+func LoadMetadataFrom(r io.Reader) (Metadata, error) {
+	jsonBytes, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return decodeMetadata(jsonBytes)
+}
+
+/*
+decodeMetadata decodes the passed JSON encoded Metablock or DSSE envelope,
+e.g. as read by LoadMetadata, and rejects malformed layouts and links with an
+ErrInvalidMetadata, see ValidateMetadata.
+*/
+func decodeMetadata(jsonBytes []byte) (Metadata, error) {
+	metadata, err := decodeUnvalidatedMetadata(jsonBytes)
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidateMetadata(metadata); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidMetadata, err)
+	}
+	return metadata, nil
+}
 
+// decodeUnvalidatedMetadata decodes the passed JSON encoded Metablock or DSSE
+// envelope, without validating its payload.
+func decodeUnvalidatedMetadata(jsonBytes []byte) (Metadata, error) {
 	var rawData map[string]*json.RawMessage
 	if err := json.Unmarshal(jsonBytes, &rawData); err != nil {
 		return nil, err
@@ -715,6 +773,22 @@ func LoadMetadata(path string) (Metadata, error) {
 			return nil, ErrInvalidPayloadType
 		}
 
+		if rawData["payload_digest"] != nil {
+			payload, err := dsseEnv.DecodeB64Payload()
+			if err != nil {
+				return nil, err
+			}
+			if err := verifySelfDigest(payload, *rawData["payload_digest"]); err != nil {
+				return nil, err
+			}
+			env, err := loadEnvelope(dsseEnv)
+			if err != nil {
+				return nil, err
+			}
+			env.selfDigest = true
+			return env, nil
+		}
+
 		return loadEnvelope(dsseEnv)
 	}
 
@@ -739,6 +813,17 @@ func LoadMetadata(path string) (Metadata, error) {
 
 	mb.Signed = payload
 
+	if rawData["signed_digest"] != nil {
+		signable, err := mb.GetSignableRepresentation()
+		if err != nil {
+			return nil, err
+		}
+		if err := verifySelfDigest(signable, *rawData["signed_digest"]); err != nil {
+			return nil, err
+		}
+		mb.selfDigest = true
+	}
+
 	return mb, nil
 }
 
@@ -761,6 +846,8 @@ type Metablock struct {
 	// turn out to be a layout (sublayout)
 	Signed     interface{} `json:"signed"`
 	Signatures []Signature `json:"signatures"`
+	// selfDigest embeds a digest of Signed when dumped, see SetSelfDigest
+	selfDigest bool
 }
 
 type jsonField struct {
@@ -846,23 +933,35 @@ func (mb *Metablock) Load(path string) error {
 
 	mb.Signed = payload
 
+	if rawMb["signed_digest"] != nil {
+		signable, err := mb.GetSignableRepresentation()
+		if err != nil {
+			return err
+		}
+		if err := verifySelfDigest(signable, *rawMb["signed_digest"]); err != nil {
+			return err
+		}
+		mb.selfDigest = true
+	}
+
 	return nil
 }
 
 /*
 Dump JSON serializes and writes the Metablock on which it was called to the
-passed path.  It returns an error if JSON serialization or writing fails.
+passed path, in the canonical on-disk format described at DumpMetadataTo.
+The file is replaced atomically while holding a lock on its directory, so that
+concurrent writers, e.g. parallel recorder processes, do not corrupt metadata
+files.  It returns an error if JSON serialization or writing fails.
 */
 func (mb *Metablock) Dump(path string) error {
-	// JSON encode Metablock formatted with newlines and indentation
-	// TODO: parametrize format
-	jsonBytes, err := json.MarshalIndent(mb, "", "  ")
+	jsonBytes, err := marshalMetablock(mb)
 	if err != nil {
 		return err
 	}
 
 	// Write JSON bytes to the passed path with permissions (-rw-r--r--)
-	err = os.WriteFile(path, jsonBytes, 0644)
+	err = writeMetadataFile(path, jsonBytes, 0644)
 	if err != nil {
 		return err
 	}
@@ -870,13 +969,35 @@ func (mb *Metablock) Dump(path string) error {
 	return nil
 }
 
+/*
+DumpTo JSON serializes the Metablock on which it was called like Dump, and
+writes it to the passed writer, e.g. an HTTP request body or stdout.
+*/
+func (mb *Metablock) DumpTo(w io.Writer) error {
+	jsonBytes, err := marshalMetablock(mb)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(jsonBytes)
+	return err
+}
+
 /*
 GetSignableRepresentation returns the canonical JSON representation of the
-Signed field of the Metablock on which it was called.  If canonicalization
-fails the first return value is nil and the second return value is the error.
+Signed field of the Metablock on which it was called, as prepared by the
+Canonicalizer of the spec version of Metablocks.  If canonicalization fails
+the first return value is nil and the second return value is the error.
 */
 func (mb *Metablock) GetSignableRepresentation() ([]byte, error) {
-	return cjson.EncodeCanonical(mb.Signed)
+	c, err := GetCanonicalizer(metablockSpecVersion)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := c.EncodePayload(mb.Signed)
+	if err != nil {
+		return nil, err
+	}
+	return c.SignableBytes(PayloadType, payload), nil
 }
 
 func (mb *Metablock) GetPayload() any {
@@ -895,12 +1016,7 @@ the passed Key, the object in Signed cannot be canonicalized, or the Signature
 is invalid.
 */
 func (mb *Metablock) VerifySignature(key Key) error {
-	sig, err := mb.GetSignatureForKeyID(key.KeyID)
-	if err != nil {
-		return err
-	}
-
-	verifier, err := getSignerVerifierFromKey(key)
+	sig, err := mb.getSignatureForKey(key)
 	if err != nil {
 		return err
 	}
@@ -910,17 +1026,30 @@ func (mb *Metablock) VerifySignature(key Key) error {
 		return err
 	}
 
-	sigBytes, err := hex.DecodeString(sig.Sig)
-	if err != nil {
-		return err
-	}
+	return VerifySignature(key, sig, payload)
+}
 
-	err = verifier.Verify(context.Background(), payload, sigBytes)
-	if err != nil {
-		return err
+/*
+VerifySignatureWithKeys verifies the signatures of the metablock with the
+passed keys, like VerifySignature, and returns the first key whose signature
+verifies, e.g. to accept metadata signed by any of several trusted owners.
+If no signature verifies, the errors of all keys are returned, e.g. an
+ErrSignatureNotFound for keys without signature, aggregated in a MultiError
+if there is more than one.
+*/
+func (mb *Metablock) VerifySignatureWithKeys(keys []Key) (Key, error) {
+	errs := &MultiError{}
+	for _, key := range keys {
+		err := mb.VerifySignature(key)
+		if err == nil {
+			return key, nil
+		}
+		errs.add(err)
 	}
-
-	return nil
+	if len(errs.Errs) == 0 {
+		return Key{}, fmt.Errorf("%w: no keys passed", ErrSignatureNotFound)
+	}
+	return Key{}, errs.err()
 }
 
 // GetSignatureForKeyID returns the signature that was created by the provided keyID, if it exists.
@@ -931,7 +1060,19 @@ func (mb *Metablock) GetSignatureForKeyID(keyID string) (Signature, error) {
 		}
 	}
 
-	return Signature{}, fmt.Errorf("no signature found for key '%s'", keyID)
+	return Signature{}, fmt.Errorf("%w for key '%s'", ErrSignatureNotFound, keyID)
+}
+
+// getSignatureForKey returns the signature that was created by the provided
+// key, or, for GPG keys, by one of its subkeys, if it exists.
+func (mb *Metablock) getSignatureForKey(key Key) (Signature, error) {
+	for _, s := range mb.Signatures {
+		if keyHasID(key, s.KeyID) {
+			return s, nil
+		}
+	}
+
+	return Signature{}, fmt.Errorf("%w for key '%s'", ErrSignatureNotFound, key.KeyID)
 }
 
 /*
@@ -942,34 +1083,76 @@ func ValidateMetablock(mb Metablock) error {
 	switch mbSignedType := mb.Signed.(type) {
 	case Layout:
 		if err := validateLayout(mb.Signed.(Layout)); err != nil {
-			return err
+			return atPointer(err, []interface{}{"signed"}, "")
 		}
 	case Link:
 		if err := validateLink(mb.Signed.(Link)); err != nil {
-			return err
+			return atPointer(err, []interface{}{"signed"}, "")
 		}
 	default:
-		return fmt.Errorf("unknown type '%s', should be 'layout' or 'link'",
-			mbSignedType)
+		return atPointer(fmt.Errorf("unknown type '%s', should be 'layout' or 'link'",
+			mbSignedType), []interface{}{"signed", "_type"}, "")
 	}
 
 	if err := validateSliceOfSignatures(mb.Signatures); err != nil {
-		return err
+		return atPointer(err, []interface{}{"signatures"}, "")
 	}
 
 	return nil
 }
 
+/*
+ValidateMetadata validates the layout or link of the passed metadata, see
+Layout.Validate and Link.Validate, and, for Metablocks, the key IDs and values
+of its signatures.  Errors are located in the metadata, e.g. at
+"/signed/steps/0/pubkeys/1" for Metablocks, see PointerError.  LoadMetadata
+validates loaded metadata, hence it is only needed for metadata created or
+modified otherwise.  Other payloads, e.g. denylists, are not validated.
+*/
+func ValidateMetadata(metadata Metadata) error {
+	if mb, ok := metadata.(*Metablock); ok {
+		switch mb.Signed.(type) {
+		case Layout, Link:
+			return ValidateMetablock(*mb)
+		}
+		return nil
+	}
+	var err error
+	switch payload := metadata.GetPayload().(type) {
+	case Layout:
+		err = validateLayout(payload)
+	case Link:
+		err = validateLink(payload)
+	}
+	return locateInMetadata(metadata, err)
+}
+
 /*
 Sign creates a signature over the signed portion of the metablock using the Key
 object provided. It then appends the resulting signature to the signatures
 field as provided. It returns an error if the Signed object cannot be
-canonicalized, or if the key is invalid or not supported.
+canonicalized, or if the key is invalid or not supported, and an
+ErrDuplicateSignature if the metablock already has a signature of the key.
 */
 func (mb *Metablock) Sign(key Key) error {
-	signer, err := getSignerVerifierFromKey(key)
-	if err != nil {
-		return err
+	return mb.SignWithKeys([]Key{key})
+}
+
+/*
+SignWithKeys signs the metablock with each of the passed keys, e.g. of all
+owners of a layout, and appends the signatures to the existing signatures.
+If the metablock already has a signature of one of the keys, or a key is
+passed more than once, an ErrDuplicateSignature is returned.  Signatures are
+only appended if all keys signed, hence a failed call leaves the metablock
+unchanged and can be retried.  Use Resign to replace a signature.
+*/
+func (mb *Metablock) SignWithKeys(keys []Key) error {
+	keyIDs := NewSet()
+	for _, key := range keys {
+		if _, err := mb.getSignatureForKey(key); err == nil || keyIDs.Has(key.KeyID) {
+			return fmt.Errorf("%w of key '%s'", ErrDuplicateSignature, key.KeyID)
+		}
+		keyIDs.Add(key.KeyID)
 	}
 
 	payload, err := mb.GetSignableRepresentation()
@@ -977,16 +1160,16 @@ func (mb *Metablock) Sign(key Key) error {
 		return err
 	}
 
-	signature, err := signer.Sign(context.Background(), payload)
-	if err != nil {
-		return err
+	signatures := make([]Signature, 0, len(keys))
+	for _, key := range keys {
+		signature, err := GenerateSignature(payload, key)
+		if err != nil {
+			return err
+		}
+		signatures = append(signatures, signature)
 	}
 
-	mb.Signatures = append(mb.Signatures, Signature{
-		KeyID:       key.KeyID,
-		Sig:         hex.EncodeToString(signature),
-		Certificate: key.KeyVal.Certificate,
-	})
+	mb.Signatures = append(mb.Signatures, signatures...)
 
 	return nil
 }
@@ -9,10 +9,12 @@ import (
 	"fmt"
 	"os"
 	"reflect"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/in-toto/in-toto-golang/in_toto/keys"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -24,7 +26,7 @@ func init() {
 func TestMatchEcdsaScheme(t *testing.T) {
 	curveSize := 224
 	scheme := "ecdsa-sha2-nistp512"
-	if err := matchEcdsaScheme(curveSize, scheme); err == nil {
+	if err := keys.MatchECDSAScheme(curveSize, scheme); err == nil {
 		t.Errorf("matchEcdsaScheme should have failed with curveSize: %d and scheme: %s", curveSize, scheme)
 	}
 }
@@ -214,7 +216,7 @@ func TestMetablockLoadDumpLoad(t *testing.T) {
 			t.Errorf("could not parse Metablock: %s", err)
 		}
 		if !reflect.DeepEqual(mbMemory, mbFile) {
-			t.Errorf("dumped and Loaded Metablocks are not equal: \n%s\n\n\n%s\n",
+			t.Errorf("dumped and Loaded Metablocks are not equal: \n%v\n\n\n%v\n",
 				mbMemory, mbFile)
 		}
 	}
@@ -337,6 +339,7 @@ func TestValidateLink(t *testing.T) {
 	if err.Error() != "invalid type for link 'test_type': should be 'link'" {
 		t.Error("validateLink error - incorrect type not detected")
 	}
+	assert.Equal(t, "/_type", ErrorPointer(err))
 
 	testMb = Metablock{
 		Signed: Link{
@@ -408,6 +411,19 @@ func TestValidateLink(t *testing.T) {
 		"'foo.tar.gz', sha256 hash value: invalid hex string: !@#$%" {
 		t.Error("validateLink error - invalid hashes not detected")
 	}
+
+	testMb = Metablock{
+		Signed: Link{
+			Type:           "link",
+			Name:           "test_absent_products",
+			AbsentProducts: []string{"*.pem", "[.key"},
+		},
+	}
+
+	err = validateLink(testMb.Signed.(Link))
+	if err == nil || ErrorPointer(err) != "/absent_products/1" {
+		t.Error("validateLink error - invalid absent product pattern not detected")
+	}
 }
 
 func TestValidateLayout(t *testing.T) {
@@ -726,7 +742,7 @@ func TestValidatePubKey(t *testing.T) {
 		Scheme: "rsassa-pss-sha256",
 	}
 
-	err := validatePublicKey(testKey)
+	err := keys.ValidatePublicKey(testKey)
 	if !errors.Is(err, nil) {
 		t.Errorf("error validating public key: %s", err)
 	}
@@ -751,7 +767,7 @@ func TestValidatePubKey(t *testing.T) {
 		Scheme: "rsassa-pss-sha256",
 	}
 
-	err = validateKey(testKey)
+	err = keys.ValidateKey(testKey)
 	if !errors.Is(err, ErrInvalidHexString) {
 		t.Error("validateKey error - invalid key ID not detected")
 	}
@@ -776,7 +792,7 @@ func TestValidatePubKey(t *testing.T) {
 		Scheme: "rsassa-pss-sha256",
 	}
 
-	err = validatePublicKey(testKey)
+	err = keys.ValidatePublicKey(testKey)
 	if !errors.Is(err, ErrNoPublicKey) {
 		t.Error("validateKey error - private key not detected")
 	}
@@ -791,7 +807,7 @@ func TestValidatePubKey(t *testing.T) {
 		Scheme: "rsassa-pss-sha256",
 	}
 
-	err = validateKey(testKey)
+	err = keys.ValidateKey(testKey)
 	if !errors.Is(err, ErrEmptyKeyField) {
 		t.Error("validateKey error - empty public key not detected")
 	}
@@ -1154,6 +1170,44 @@ func TestMetaBlockSignWithEcdsa(t *testing.T) {
 	}
 }
 
+func TestMetablockSignWithKeys(t *testing.T) {
+	var keys []Key
+	for i := 0; i < 3; i++ {
+		key, err := GenerateEd25519Key()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, key)
+	}
+	mb := Metablock{Signed: Link{Type: "link", Name: "build"}}
+
+	if err := mb.SignWithKeys(keys[:2]); err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, mb.Signatures, 2)
+
+	// Duplicate keys are refused, without adding any signature
+	assert.ErrorIs(t, mb.SignWithKeys([]Key{keys[2], keys[0]}), ErrDuplicateSignature)
+	assert.ErrorIs(t, mb.Sign(keys[1]), ErrDuplicateSignature)
+	assert.Len(t, mb.Signatures, 2)
+	other := Metablock{Signed: mb.Signed}
+	assert.ErrorIs(t, other.SignWithKeys([]Key{keys[2], keys[2]}), ErrDuplicateSignature)
+	assert.Empty(t, other.Signatures)
+
+	key, err := mb.VerifySignatureWithKeys([]Key{keys[2], keys[1]})
+	assert.Nil(t, err)
+	assert.Equal(t, keys[1].KeyID, key.KeyID)
+
+	_, err = mb.VerifySignatureWithKeys([]Key{keys[2]})
+	assert.ErrorIs(t, err, ErrSignatureNotFound)
+	_, err = mb.VerifySignatureWithKeys(nil)
+	assert.ErrorIs(t, err, ErrSignatureNotFound)
+
+	mb.Signed = Link{Type: "link", Name: "test"}
+	_, err = mb.VerifySignatureWithKeys(keys)
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+}
+
 func TestValidateKeyErrors(t *testing.T) {
 	invalidTables := []struct {
 		name string
@@ -1232,7 +1286,7 @@ func TestValidateKeyErrors(t *testing.T) {
 	}
 
 	for _, table := range invalidTables {
-		err := validateKey(table.key)
+		err := keys.ValidateKey(table.key)
 		if !errors.Is(err, table.err) {
 			t.Errorf("test '%s' failed, expected error: '%s', got '%s'", table.name, table.err, err)
 		}
@@ -1412,7 +1466,7 @@ func TestValidateKeyVal(t *testing.T) {
 		},
 	}
 	for _, table := range tables {
-		err := validateKeyVal(table.key)
+		err := keys.ValidateKeyVal(table.key)
 		if !errors.Is(err, table.err) {
 			t.Errorf("test '%s' failed, expected error: '%s', got '%s'", table.name, table.err, err)
 		}
@@ -1448,7 +1502,7 @@ func TestMatchKeyTypeScheme(t *testing.T) {
 		},
 	}
 	for _, table := range tables {
-		err := matchKeyTypeScheme(table.key)
+		err := keys.MatchKeyTypeScheme(table.key)
 		if !errors.Is(err, table.err) {
 			t.Errorf("%s returned wrong error. We got: %s, we should have got: %s", table.name, err, table.err)
 		}
@@ -1475,7 +1529,7 @@ func TestValidatePublicKey(t *testing.T) {
 		},
 	}
 	for _, table := range validTables {
-		err := validatePublicKey(table.key)
+		err := keys.ValidatePublicKey(table.key)
 		if err != nil {
 			t.Errorf("%s returned error %s, instead of nil", table.name, err)
 		}
@@ -1502,7 +1556,7 @@ func TestValidatePublicKey(t *testing.T) {
 		},
 	}
 	for _, table := range invalidTables {
-		err := validatePublicKey(table.key)
+		err := keys.ValidatePublicKey(table.key)
 		if err != table.err {
 			t.Errorf("%s returned unexpected error %s, we should got: %s", table.name, err, table.err)
 		}
@@ -1704,3 +1758,133 @@ func TestLoadMetadata(t *testing.T) {
 		}
 	}
 }
+
+func TestValidateMetadata(t *testing.T) {
+	var key Key
+	if err := key.LoadKeyDefaults("alice.pub"); err != nil {
+		t.Fatal(err)
+	}
+	otherKeyID := "b7d643dec0a051096ee5d87221b5d91a33daa658699d30903e1cefb90c418401"
+	layout := Layout{
+		Type:    "layout",
+		Expires: "2030-01-01T00:00:00Z",
+		Keys:    map[string]Key{key.KeyID: key},
+		Steps: []Step{{Type: "step", PubKeys: []string{key.KeyID}, Threshold: 1,
+			SupplyChainItem: SupplyChainItem{Name: "build"}}},
+		Inspect: []Inspection{{Type: "inspection", SupplyChainItem: SupplyChainItem{Name: "untar"}}},
+	}
+	assert.Nil(t, layout.Validate())
+	assert.Nil(t, ValidateMetadata(&Metablock{Signed: layout}))
+
+	// Functionary keys must be layout keys
+	layout.Steps[0].PubKeys = []string{key.KeyID, otherKeyID}
+	err := layout.Validate()
+	assert.Equal(t, "/steps/0/pubkeys/1", ErrorPointer(err))
+	assert.Equal(t, "/signed/steps/0/pubkeys/1", ErrorPointer(ValidateMetadata(&Metablock{Signed: layout})))
+
+	env := &Envelope{}
+	if err := env.SetPayload(layout); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "/steps/0/pubkeys/1", ErrorPointer(ValidateMetadata(env)))
+
+	// Key IDs must be hex encoded and have the length of a key ID
+	layout.Steps[0].PubKeys = []string{"abcd"}
+	assert.ErrorIs(t, layout.Validate(), ErrInvalidKeyID)
+	layout.Steps[0].PubKeys = []string{key.KeyID}
+
+	// Inspections are validated
+	layout.Inspect[0].ExpectedMaterials = [][]string{{"INVALID"}}
+	assert.Equal(t, "/inspect/0/expected_materials/0/0", ErrorPointer(layout.Validate()))
+	layout.Inspect[0].ExpectedMaterials = nil
+
+	link := Link{Type: "link", Name: "build"}
+	assert.Nil(t, link.Validate())
+	err = ValidateMetadata(&Metablock{Signed: link, Signatures: []Signature{{KeyID: "abcd", Sig: "abcd"}}})
+	assert.ErrorIs(t, err, ErrInvalidKeyID)
+	assert.Equal(t, "/signatures/0/keyid", ErrorPointer(err))
+	link.Name = ""
+	assert.Equal(t, "/name", ErrorPointer(link.Validate()))
+
+	// Malformed metadata is rejected on load
+	layout.Steps[0].PubKeys = []string{otherKeyID}
+	var buf bytes.Buffer
+	if err := (&Metablock{Signed: layout, Signatures: []Signature{}}).DumpTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	_, err = LoadMetadataFrom(&buf)
+	assert.ErrorIs(t, err, ErrInvalidMetadata)
+	assert.Equal(t, "/signed/steps/0/pubkeys/0", ErrorPointer(err))
+}
+
+func FuzzLoadMetadataFrom(f *testing.F) {
+	addFuzzSeeds(f, "*.link", "*.layout")
+	f.Fuzz(func(t *testing.T, data []byte) {
+		metadata, err := LoadMetadataFrom(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+
+		// Loaded metadata is written and loaded again with the same signatures
+		var buf bytes.Buffer
+		if err := DumpMetadataTo(metadata, &buf); err != nil {
+			return
+		}
+		reloaded, err := LoadMetadataFrom(&buf)
+		if err != nil {
+			t.Fatalf("failed to load written metadata: %s", err)
+		}
+		digest, err := signingDigest(metadata)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reloadedDigest, err := signingDigest(reloaded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !digestsMatch(digest, reloadedDigest) {
+			t.Fatalf("signed bytes of written metadata differ")
+		}
+		assert.ElementsMatch(t, metadata.Sigs(), reloaded.Sigs())
+	})
+}
+
+func BenchmarkMetablockSign(b *testing.B) {
+	var key Key
+	if err := key.LoadKey("carol", "ed25519", []string{"sha256", "sha512"}); err != nil {
+		b.Fatal(err)
+	}
+	for _, artifacts := range []int{10, 1000, 10000} {
+		mb := Metablock{Signed: benchmarkLink(artifacts)}
+		b.Run(strconv.Itoa(artifacts), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				mb.Signatures = nil
+				if err := mb.Sign(key); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkMetablockVerifySignature(b *testing.B) {
+	var key Key
+	if err := key.LoadKey("carol", "ed25519", []string{"sha256", "sha512"}); err != nil {
+		b.Fatal(err)
+	}
+	for _, artifacts := range []int{10, 1000, 10000} {
+		mb := Metablock{Signed: benchmarkLink(artifacts)}
+		if err := mb.Sign(key); err != nil {
+			b.Fatal(err)
+		}
+		b.Run(strconv.Itoa(artifacts), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := mb.VerifySignature(key); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package in_toto
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+MultiError aggregates independent failures, e.g. of several steps of a layout
+or of several key files in a directory, so that all of them are reported at
+once instead of only the first one.  The individual errors keep their types:
+errors.Is and errors.As match any of them, e.g. errors.As with a PointerError
+obtains the location of the first failure.  Functions that return a
+MultiError return a single failure as is, not wrapped in a MultiError.
+*/
+type MultiError struct {
+	Errs []error
+}
+
+func (e *MultiError) Error() string {
+	msgs := make([]string, 0, len(e.Errs))
+	for _, err := range e.Errs {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("%d errors occurred: %s", len(e.Errs), strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the aggregated errors.
+func (e *MultiError) Unwrap() []error {
+	return e.Errs
+}
+
+// add appends the passed error, if it is not nil.  The errors of a passed
+// MultiError are appended individually.
+func (e *MultiError) add(err error) {
+	if err == nil {
+		return
+	}
+	if multiErr, ok := err.(*MultiError); ok {
+		e.Errs = append(e.Errs, multiErr.Errs...)
+		return
+	}
+	e.Errs = append(e.Errs, err)
+}
+
+// err returns nil, if no errors were added, the added error, if only one was
+// added, and the MultiError otherwise.
+func (e *MultiError) err() error {
+	switch len(e.Errs) {
+	case 0:
+		return nil
+	case 1:
+		return e.Errs[0]
+	}
+	return e
+}
@@ -0,0 +1,85 @@
+package in_toto
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMultiError(t *testing.T) {
+	errA := errors.New("a")
+	errB := errors.New("b")
+
+	errs := &MultiError{}
+	assert.Nil(t, errs.err())
+	errs.add(nil)
+	errs.add(errA)
+	assert.Equal(t, errA, errs.err())
+
+	// Nested MultiErrors are flattened
+	errs.add(&MultiError{Errs: []error{errB, ErrUnknownRole}})
+	err := errs.err()
+	assert.Equal(t, "3 errors occurred: a; b; unknown functionary role", err.Error())
+	assert.ErrorIs(t, err, errA)
+	assert.ErrorIs(t, err, ErrUnknownRole)
+	var multiErr *MultiError
+	if assert.ErrorAs(t, err, &multiErr) {
+		assert.Len(t, multiErr.Errs, 3)
+	}
+
+	// The errors are located individually
+	err = atPointer(err, []interface{}{"steps", 0}, "")
+	assert.Equal(t, "/steps/0", ErrorPointer(err))
+	assert.Equal(t, "/signed/steps/0", ErrorPointer(locateInMetadata(&Metablock{}, err)))
+	assert.ErrorIs(t, locateInMetadata(&Metablock{}, err), errB)
+}
+
+func TestValidateLayoutMultiError(t *testing.T) {
+	layout := Layout{
+		Type:    "layout",
+		Expires: "never",
+		Steps: []Step{
+			{Type: "step", SupplyChainItem: SupplyChainItem{Name: "build"}, Role: "builder"},
+			{Type: "step", SupplyChainItem: SupplyChainItem{Name: "build"}},
+		},
+	}
+	err := ValidateMetablock(Metablock{Signed: layout})
+	var multiErr *MultiError
+	if !assert.ErrorAs(t, err, &multiErr) {
+		t.FailNow()
+	}
+	pointers := []string{}
+	for _, err := range multiErr.Errs {
+		pointers = append(pointers, ErrorPointer(err))
+	}
+	assert.Equal(t, []string{"/signed/expires", "/signed/steps/1/name", "/signed/steps/0/role"}, pointers)
+	assert.ErrorIs(t, err, ErrUnknownRole)
+	assert.Equal(t, "/signed/expires", ErrorPointer(err))
+}
+
+func TestLoadKeystorePublicKeysMultiError(t *testing.T) {
+	dir := t.TempDir()
+	var key Key
+	if err := key.LoadKeyDefaults("alice.pub"); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteKeystoreKey(dir, key, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"invalid.pub", "empty.pub"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("{"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := LoadKeystorePublicKeys(dir)
+	var multiErr *MultiError
+	if assert.ErrorAs(t, err, &multiErr) {
+		assert.Len(t, multiErr.Errs, 2)
+		assert.Contains(t, err.Error(), "empty.pub")
+		assert.Contains(t, err.Error(), "invalid.pub")
+	}
+}
@@ -0,0 +1,95 @@
+package in_toto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrNoLayoutVerified indicates that the supply chain verifies against none of
+// the layouts passed to VerifyLayouts.
+var ErrNoLayoutVerified = errors.New("supply chain does not verify against any layout")
+
+/*
+LayoutCandidate is a layout to verify a supply chain against with
+VerifyLayouts, e.g. the current or the previous version of a layout during a
+rotation window.
+*/
+type LayoutCandidate struct {
+	// Name identifies the layout in the result and errors of VerifyLayouts,
+	// e.g. its version or path
+	Name string
+	// Layout is the signed layout
+	Layout Metadata
+	// LayoutKeys are the keys the layout signatures are verified with
+	LayoutKeys map[string]Key
+}
+
+// LayoutError is the reason, why the supply chain does not verify against the
+// candidate layout of the name Name, see VerifyLayouts.
+type LayoutError struct {
+	Name string
+	Err  error
+}
+
+func (e *LayoutError) Error() string {
+	return fmt.Sprintf("layout '%s': %s", e.Name, e.Err)
+}
+
+// Unwrap returns the verification error of the layout.
+func (e *LayoutError) Unwrap() error {
+	return e.Err
+}
+
+/*
+VerifyLayouts verifies the supply chain, i.e. the links in the passed link
+directory, against each of the passed candidate layouts in order, like
+VerifyContext with the passed options, until it verifies against one of them.
+It returns the name of that layout and the summary link.  Later candidates are
+not verified, hence the preferred layout, e.g. the current version, is passed
+first.
+
+If the supply chain verifies against none of the layouts, an error wrapping
+ErrNoLayoutVerified and a LayoutError per layout is returned, so that
+errors.Is and errors.As match the failure reasons of each layout, see
+MultiError.  Candidates must have distinct, non-empty names.  Options apply to
+every verification, e.g. inspections are run once per verified layout.
+*/
+func VerifyLayouts(ctx context.Context, candidates []LayoutCandidate, linkDir string,
+	opts ...VerifyOption) (string, Metadata, error) {
+	if len(candidates) == 0 {
+		return "", nil, fmt.Errorf("%w: no layouts passed", ErrNoLayoutVerified)
+	}
+	names := NewSet()
+	for _, candidate := range candidates {
+		if candidate.Name == "" {
+			return "", nil, fmt.Errorf("layout candidates must have a name")
+		}
+		if names.Has(candidate.Name) {
+			return "", nil, fmt.Errorf("layout candidate '%s' is passed more than once", candidate.Name)
+		}
+		names.Add(candidate.Name)
+	}
+
+	c := verifyConfig{}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	log := loggerFromContext(withLogger(ctx, c.logger))
+
+	errs := &MultiError{}
+	for _, candidate := range candidates {
+		summary, err := VerifyContext(ctx, candidate.Layout, candidate.LayoutKeys, linkDir, opts...)
+		if err == nil {
+			logDebug(log, "verified supply chain against layout", "layout", candidate.Name)
+			return candidate.Name, summary, nil
+		}
+		// Later layouts fail the same way, once the context is done
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return "", nil, ctxErr
+		}
+		logDebug(log, "supply chain does not verify against layout", "layout", candidate.Name, "error", err)
+		errs.add(&LayoutError{Name: candidate.Name, Err: err})
+	}
+	return "", nil, fmt.Errorf("%w: %w", ErrNoLayoutVerified, errs.err())
+}
@@ -0,0 +1,96 @@
+package in_toto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyLayouts(t *testing.T) {
+	var layoutKey, key Key
+	if err := layoutKey.LoadKeyDefaults("alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := key.LoadKey("carol", "ed25519", []string{"sha256", "sha512"}); err != nil {
+		t.Fatal(err)
+	}
+	pubKey := key
+	pubKey.KeyVal.Private = ""
+	layoutKeys := map[string]Key{layoutKey.KeyID: layoutKey}
+
+	command := []string{"sh", "-c", "true"}
+	linkDir := t.TempDir()
+	linkEnv, err := Run("build", command, key, WithProducts("foo.tar.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := linkEnv.Dump(filepath.Join(linkDir, fmt.Sprintf(LinkNameFormat, "build", key.KeyID))); err != nil {
+		t.Fatal(err)
+	}
+
+	newLayout := func(name string, expectedCommand []string, expires time.Time) LayoutCandidate {
+		layoutMb := &Metablock{Signed: Layout{
+			Type:    "layout",
+			Expires: expires.UTC().Format(ISO8601DateSchema),
+			Keys:    map[string]Key{pubKey.KeyID: pubKey},
+			Steps: []Step{{
+				Type:            "step",
+				PubKeys:         []string{pubKey.KeyID},
+				ExpectedCommand: expectedCommand,
+				Threshold:       1,
+				SupplyChainItem: SupplyChainItem{
+					Name:             "build",
+					ExpectedProducts: [][]string{{"CREATE", "foo.tar.gz"}, {"DISALLOW", "*"}},
+				},
+			}},
+			Inspect: []Inspection{},
+		}}
+		if err := layoutMb.Sign(layoutKey); err != nil {
+			t.Fatal(err)
+		}
+		return LayoutCandidate{Name: name, Layout: layoutMb, LayoutKeys: layoutKeys}
+	}
+	current := newLayout("v2", []string{"make"}, time.Now().Add(time.Hour))
+	previous := newLayout("v1", command, time.Now().Add(time.Hour))
+	expired := newLayout("v0", command, time.Now().Add(-time.Hour))
+
+	// The first layout the supply chain verifies against is returned
+	name, summary, err := VerifyLayouts(context.Background(), []LayoutCandidate{current, previous, expired}, linkDir,
+		WithStepName("summary"))
+	if assert.Nil(t, err) {
+		assert.Equal(t, "v1", name)
+		assert.Equal(t, "summary", summary.GetPayload().(Link).Name)
+	}
+	name, _, err = VerifyLayouts(context.Background(), []LayoutCandidate{previous, current}, linkDir)
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", name)
+
+	// Otherwise the failure reasons of all layouts are returned
+	_, _, err = VerifyLayouts(context.Background(), []LayoutCandidate{current, expired}, linkDir)
+	assert.ErrorIs(t, err, ErrNoLayoutVerified)
+	assert.ErrorIs(t, err, ErrCommandMisalignment)
+	assert.ErrorIs(t, err, ErrLayoutExpired)
+	var layoutErr *LayoutError
+	if assert.True(t, errors.As(err, &layoutErr)) {
+		assert.Equal(t, "v2", layoutErr.Name)
+	}
+	assert.ErrorContains(t, err, "layout 'v0'")
+
+	_, _, err = VerifyLayouts(context.Background(), nil, linkDir)
+	assert.ErrorIs(t, err, ErrNoLayoutVerified)
+	_, _, err = VerifyLayouts(context.Background(), []LayoutCandidate{previous, previous}, linkDir)
+	assert.NotNil(t, err)
+	_, _, err = VerifyLayouts(context.Background(), []LayoutCandidate{{Layout: previous.Layout}}, linkDir)
+	assert.NotNil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err = VerifyLayouts(ctx, []LayoutCandidate{current, previous}, linkDir)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.NotErrorIs(t, err, ErrNoLayoutVerified)
+}
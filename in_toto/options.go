@@ -0,0 +1,657 @@
+package in_toto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// ErrCommandMisalignment is returned by Verify, if the command reported by a
+// link differs from the expected command of its step.
+var ErrCommandMisalignment = errors.New("executed command does not match expected command")
+
+// ErrLinkNameMismatch is returned by Verify, if a link loaded for a step
+// reports the name of another step.
+var ErrLinkNameMismatch = errors.New("link name does not match step name")
+
+// ErrUnsignedLink is returned by Run, RecordStart and RecordStop, if no
+// signing key is passed and unsigned links are not allowed, see
+// WithUnsignedLink.
+var ErrUnsignedLink = errors.New("no key to sign link")
+
+// ErrTimestampRequiresMetablock is returned by Run and RecordStop, if links
+// are timestamped, but not in the legacy signature wrapper, see
+// WithTimestamper.
+var ErrTimestampRequiresMetablock = errors.New("timestamps require links in the legacy signature wrapper")
+
+// defaultOptionHashAlgorithms are used by Run, RecordStart and RecordStop, if
+// no hash algorithms are configured.
+var defaultOptionHashAlgorithms = []string{"sha256", "sha512"}
+
+// runConfig holds the settings of Run, RecordStart and RecordStop.
+type runConfig struct {
+	runDir         string
+	materialPaths  []string
+	productPaths   []string
+	absentProducts []string
+	profile        ArtifactProfile
+	byproducts     ByproductOptions
+	useMetablock   bool
+	allowUnsigned  bool
+	imageMaterials map[string]string
+	imageProducts  map[string]string
+	imageResolver  ImageResolver
+	selfDigest     bool
+	signer         Signer
+	toolchains     []string
+	timestamper    Timestamper
+	materials      []map[string]HashObj
+	products       []map[string]HashObj
+	progress       ProgressFunc
+	logger         Logger
+}
+
+/*
+RunOption configures Run, RecordStart and RecordStop.  Without options, links
+are signed DSSE envelopes and artifacts are hashed with sha256 and sha512.
+*/
+type RunOption func(*runConfig)
+
+// WithRunDir sets the directory the command of Run is executed in.
+func WithRunDir(dir string) RunOption {
+	return func(c *runConfig) { c.runDir = dir }
+}
+
+// WithMaterials sets the paths of the materials recorded by Run and
+// RecordStart.
+func WithMaterials(paths ...string) RunOption {
+	return func(c *runConfig) { c.materialPaths = paths }
+}
+
+// WithProducts sets the paths of the products recorded by Run and RecordStop.
+func WithProducts(paths ...string) RunOption {
+	return func(c *runConfig) { c.productPaths = paths }
+}
+
+/*
+WithAbsentProducts asserts in the link of Run and RecordStop that no recorded
+product matches any of the passed patterns after the step, e.g. "*.pem", and
+fails with ErrAbsentProductRecorded otherwise.  Layouts can require such
+assertions with ABSENT rules.
+*/
+func WithAbsentProducts(patterns ...string) RunOption {
+	return func(c *runConfig) { c.absentProducts = patterns }
+}
+
+/*
+WithImageMaterials records the container images at the passed sources as
+materials of Run by artifact name, e.g.
+{"base-image": "docker://example.com/base@sha256:..."}.  The digest of an
+image is the digest of its manifest, see RecordImage for the supported
+sources.
+*/
+func WithImageMaterials(images map[string]string) RunOption {
+	return func(c *runConfig) { c.imageMaterials = images }
+}
+
+// WithImageProducts records the container images at the passed sources as
+// products of Run by artifact name, e.g. {"app-image": "oci:build/oci"},
+// see WithImageMaterials.
+func WithImageProducts(images map[string]string) RunOption {
+	return func(c *runConfig) { c.imageProducts = images }
+}
+
+/*
+WithMaterialArtifacts adds the passed artifacts, e.g. as recorded in memory
+with RecordArtifactBytes or RecordArtifactReader, to the materials recorded by
+Run and RecordStart.  Their hash algorithms should match the hash algorithms
+of the run, see WithHashAlgorithms.  An artifact name may only be recorded
+once.
+*/
+func WithMaterialArtifacts(artifacts ...map[string]HashObj) RunOption {
+	return func(c *runConfig) { c.materials = artifacts }
+}
+
+// WithProductArtifacts adds the passed artifacts to the products recorded by
+// Run and RecordStop, see WithMaterialArtifacts.
+func WithProductArtifacts(artifacts ...map[string]HashObj) RunOption {
+	return func(c *runConfig) { c.products = artifacts }
+}
+
+/*
+WithProgress reports the progress of Run, RecordStart and RecordStop to the
+passed function, i.e. each hashed artifact and the start and end of recording
+artifacts and of running the command, see ProgressEvent.
+*/
+func WithProgress(f ProgressFunc) RunOption {
+	return func(c *runConfig) { c.progress = f }
+}
+
+// WithLogger logs debug messages of Run, RecordStart and RecordStop to the
+// passed Logger, instead of the Logger registered with SetLogger.
+func WithLogger(l Logger) RunOption {
+	return func(c *runConfig) { c.logger = l }
+}
+
+// context returns the passed context, which additionally reports progress
+// and logs as configured, see WithProgress and WithLogger.
+func (c *runConfig) context(ctx context.Context) context.Context {
+	return withLogger(withProgress(ctx, c.progress), c.logger)
+}
+
+// WithImageResolver resolves the digests of container images that are
+// referenced by tag, see WithImageMaterials and ImageResolver.
+func WithImageResolver(resolver ImageResolver) RunOption {
+	return func(c *runConfig) { c.imageResolver = resolver }
+}
+
+/*
+WithToolchains records the versions of the toolchains of the passed names,
+e.g. "go" or "gcc", in the link of Run, as printed by their version commands
+in the run directory before the command is executed, see
+CollectToolchainVersions.
+*/
+func WithToolchains(names ...string) RunOption {
+	return func(c *runConfig) { c.toolchains = names }
+}
+
+// WithArtifactProfile records artifacts with the options of the passed
+// profile.  Hash algorithms of the profile take precedence over the defaults.
+func WithArtifactProfile(profile ArtifactProfile) RunOption {
+	return func(c *runConfig) {
+		hashAlgorithms := c.profile.HashAlgorithms
+		c.profile = profile
+		if len(c.profile.HashAlgorithms) == 0 {
+			c.profile.HashAlgorithms = hashAlgorithms
+		}
+	}
+}
+
+// WithHashAlgorithms sets the hash algorithms artifacts are hashed with, see
+// SupportedHashAlgorithms.
+func WithHashAlgorithms(hashAlgorithms ...string) RunOption {
+	return func(c *runConfig) { c.profile.HashAlgorithms = hashAlgorithms }
+}
+
+// WithByproducts configures the capture of the byproducts of the command of
+// Run.
+func WithByproducts(byproducts ByproductOptions) RunOption {
+	return func(c *runConfig) { c.byproducts = byproducts }
+}
+
+/*
+WithMetablock creates links in the legacy metablock format instead of DSSE
+envelopes.  RecordStop ignores this option and always keeps the format of the
+passed unfinished link.
+*/
+func WithMetablock() RunOption {
+	return func(c *runConfig) { c.useMetablock = true }
+}
+
+// WithUnsignedLink allows creating links without signing key, e.g. to sign
+// them later with a separate signer.
+func WithUnsignedLink() RunOption {
+	return func(c *runConfig) { c.allowUnsigned = true }
+}
+
+// WithSelfDigest embeds a digest of the signed portion of links when they are
+// written, so that corrupted link files are detected, see SetSelfDigest.
+func WithSelfDigest() RunOption {
+	return func(c *runConfig) { c.selfDigest = true }
+}
+
+/*
+WithSigner signs the links of Run, RecordStart and RecordStop with the passed
+Signer, e.g. of NewSSHAgentSigner or NewCryptoSigner, instead of the passed
+key, which is ignored and may be empty.  RecordStop verifies the unfinished
+link with the public key of the Signer.
+*/
+func WithSigner(signer Signer) RunOption {
+	return func(c *runConfig) { c.signer = signer }
+}
+
+/*
+WithTimestamper timestamps the signatures of the links of Run and RecordStop
+with the passed Timestamper, e.g. an RFC3161Timestamper, which proves that
+the links were signed while the signing key was valid, see
+WithTimestampVerifiers.  Timestamps require links in the legacy signature
+wrapper, see WithMetablock, and fail with an ErrTimestampRequiresMetablock
+otherwise.
+*/
+func WithTimestamper(timestamper Timestamper) RunOption {
+	return func(c *runConfig) { c.timestamper = timestamper }
+}
+
+// signingKey returns the key links are signed with, i.e. no key, if links are
+// signed with a Signer, see signWithSigner.
+func (c runConfig) signingKey(key Key) Key {
+	if c.signer != nil {
+		return Key{}
+	}
+	return key
+}
+
+// signWithSigner signs the passed link with the configured Signer, if any.
+func (c runConfig) signWithSigner(linkEnv Metadata, err error) (Metadata, error) {
+	if err != nil || c.signer == nil {
+		return linkEnv, err
+	}
+	switch m := linkEnv.(type) {
+	case *Metablock:
+		err = m.SignWith(c.signer)
+	case *Envelope:
+		err = m.SignWith(c.signer)
+	default:
+		err = ErrUnknownMetadataType
+	}
+	if err != nil {
+		return nil, err
+	}
+	return linkEnv, nil
+}
+
+// applyTimestamps timestamps the signatures of the passed link with the
+// configured Timestamper, if any.
+func (c runConfig) applyTimestamps(linkEnv Metadata, err error) (Metadata, error) {
+	if err != nil || c.timestamper == nil {
+		return linkEnv, err
+	}
+	mb, ok := linkEnv.(*Metablock)
+	if !ok {
+		return nil, ErrTimestampRequiresMetablock
+	}
+	for _, sig := range mb.Signatures {
+		if err := mb.AddTimestamp(sig.KeyID, c.timestamper); err != nil {
+			return nil, err
+		}
+	}
+	return mb, nil
+}
+
+// applySelfDigest enables the self digest of the passed link, if configured.
+func (c runConfig) applySelfDigest(linkEnv Metadata, err error) (Metadata, error) {
+	if err != nil || !c.selfDigest {
+		return linkEnv, err
+	}
+	if err := SetSelfDigest(linkEnv, true); err != nil {
+		return nil, err
+	}
+	return linkEnv, nil
+}
+
+// newRunConfig applies the passed options to the default settings.
+func newRunConfig(key Key, opts []RunOption) (runConfig, error) {
+	c := runConfig{profile: ArtifactProfile{HashAlgorithms: defaultOptionHashAlgorithms}}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	if !c.allowUnsigned && c.signer == nil && reflect.ValueOf(key).IsZero() {
+		return runConfig{}, ErrUnsignedLink
+	}
+	return c, nil
+}
+
+/*
+Run executes the passed command and returns a link, which records the
+materials before and the products after the command, its byproducts, and is
+signed with the passed key, like InTotoRun.  See RunOption for the defaults
+and how to change them.
+*/
+func Run(name string, cmdArgs []string, key Key, opts ...RunOption) (Metadata, error) {
+	return RunContext(context.Background(), name, cmdArgs, key, opts...)
+}
+
+// RunContext behaves like Run, but kills the command and stops recording
+// artifacts when the passed context is done, see InTotoRunContext.
+func RunContext(ctx context.Context, name string, cmdArgs []string, key Key, opts ...RunOption) (Metadata, error) {
+	c, err := newRunConfig(key, opts)
+	if err != nil {
+		return nil, err
+	}
+	// Fail before the command is executed
+	if c.timestamper != nil && !c.useMetablock {
+		return nil, ErrTimestampRequiresMetablock
+	}
+	ctx = c.context(ctx)
+	return c.applySelfDigest(c.applyTimestamps(c.signWithSigner(inTotoRun(ctx, name, c.runDir, c.materialPaths, c.productPaths, c.absentProducts, cmdArgs,
+		c.signingKey(key), c.profile.GetHashAlgorithms(), c.profile, commandOptions{
+			byproducts:     c.byproducts,
+			imageMaterials: c.imageMaterials,
+			imageProducts:  c.imageProducts,
+			imageResolver:  c.imageResolver,
+			toolchains:     c.toolchains,
+			materials:      c.materials,
+			products:       c.products,
+		}, !c.useMetablock))))
+}
+
+/*
+RecordStart returns a signed unfinished link, which records the materials of
+a step that cannot be carried out by a single command, like
+InTotoRecordStart.  The step is finished with RecordStop.
+*/
+func RecordStart(name string, key Key, opts ...RunOption) (Metadata, error) {
+	c, err := newRunConfig(key, opts)
+	if err != nil {
+		return nil, err
+	}
+	return c.applySelfDigest(c.signWithSigner(inTotoRecordStart(c.context(context.Background()), name, c.materialPaths, c.materials, c.signingKey(key), c.profile.GetHashAlgorithms(), c.profile, !c.useMetablock)))
+}
+
+/*
+RecordStop verifies the signature of the passed unfinished link created with
+RecordStart, and returns the finished link, which additionally records the
+products, signed with the passed key, like InTotoRecordStop.
+*/
+func RecordStop(prelimLinkEnv Metadata, key Key, opts ...RunOption) (Metadata, error) {
+	c, err := newRunConfig(key, opts)
+	if err != nil {
+		return nil, err
+	}
+	_, useDSSE := prelimLinkEnv.(*Envelope)
+	ctx := c.context(context.Background())
+	if c.signer == nil {
+		return c.applySelfDigest(c.applyTimestamps(inTotoRecordStop(ctx, prelimLinkEnv, c.productPaths, c.products, c.absentProducts, key, c.profile.GetHashAlgorithms(), c.profile, useDSSE)))
+	}
+	if err := prelimLinkEnv.VerifySignature(c.signer.Public()); err != nil {
+		return nil, err
+	}
+	return c.applySelfDigest(c.applyTimestamps(c.signWithSigner(recordStopLink(ctx, prelimLinkEnv, c.productPaths, c.products, c.absentProducts, Key{}, c.profile.GetHashAlgorithms(), c.profile, useDSSE))))
+}
+
+/*
+RecordStartFile behaves like RecordStart, and writes the unfinished link to
+the passed directory, named after PreliminaryLinkNameFormat, like
+InTotoRecordStartFile.  It returns the path of the unfinished link file.
+*/
+func RecordStartFile(dir string, name string, key Key, opts ...RunOption) (string, error) {
+	prelimLinkEnv, err := RecordStart(name, key, opts...)
+	if err != nil {
+		return "", err
+	}
+
+	prelimLinkPath := filepath.Join(dir, fmt.Sprintf(PreliminaryLinkNameFormat, name, key.KeyID))
+	if err := prelimLinkEnv.Dump(prelimLinkPath); err != nil {
+		return "", err
+	}
+	return prelimLinkPath, nil
+}
+
+/*
+RecordStopFile finishes the unfinished link of the passed step name and key in
+the passed directory, as written by InTotoRecordStartFile, like RecordStop.
+The finished link is written to the directory, named after LinkNameFormat,
+and the unfinished link file is removed.  It returns the path of the link
+file.
+*/
+func RecordStopFile(dir string, name string, key Key, opts ...RunOption) (string, error) {
+	return recordStopFile(dir, name, key, func(prelimLinkEnv Metadata) (Metadata, error) {
+		return RecordStop(prelimLinkEnv, key, opts...)
+	})
+}
+
+// verifyConfig holds the settings of Verify.
+type verifyConfig struct {
+	stepName            string
+	parameterDictionary map[string]string
+	intermediatePems    [][]byte
+	lineNormalization   bool
+	opts                verifyOptions
+
+	allowCommandMisalignment bool
+	allowLinkNameMismatch    bool
+	progress                 ProgressFunc
+	logger                   Logger
+}
+
+/*
+VerifyOption configures Verify.  Without options, Verify rejects links whose
+executed command differs from the expected command of their step, links that
+report the name of another step, and layouts that expired, without tolerance.
+*/
+type VerifyOption func(*verifyConfig)
+
+// WithStepName sets the name of the summary link returned by Verify, see
+// GetSummaryLink.
+func WithStepName(stepName string) VerifyOption {
+	return func(c *verifyConfig) { c.stepName = stepName }
+}
+
+// WithParameters sets the values of the parameters substituted in the
+// layout, see SubstituteParameters.
+func WithParameters(parameterDictionary map[string]string) VerifyOption {
+	return func(c *verifyConfig) { c.parameterDictionary = parameterDictionary }
+}
+
+// WithIntermediateCertificates passes PEM encoded intermediate certificates
+// to verify the certificates of link signers with.
+func WithIntermediateCertificates(intermediatePems ...[]byte) VerifyOption {
+	return func(c *verifyConfig) { c.intermediatePems = intermediatePems }
+}
+
+// WithLineNormalization normalizes line endings of artifacts recorded by
+// inspections.
+func WithLineNormalization() VerifyOption {
+	return func(c *verifyConfig) { c.lineNormalization = true }
+}
+
+// WithInspectionDir sets the directory inspections are run in.
+func WithInspectionDir(dir string) VerifyOption {
+	return func(c *verifyConfig) { c.opts.inspection.Dir = dir }
+}
+
+// WithInspectionOptions constrains how inspections are run, see
+// InspectionOptions.  It overrides the directory set by WithInspectionDir.
+func WithInspectionOptions(opts InspectionOptions) VerifyOption {
+	return func(c *verifyConfig) { c.opts.inspection = opts }
+}
+
+// WithExpiryTolerance accepts layouts that expired at most the passed
+// duration ago, e.g. to allow for clock skew.
+func WithExpiryTolerance(tolerance time.Duration) VerifyOption {
+	return func(c *verifyConfig) { c.opts.expiryTolerance = tolerance }
+}
+
+/*
+WithVerificationProgress reports the progress of Verify to the passed
+function, i.e. the start and end of each verification stage, of the
+verification of the artifact rules of each step and inspection, and of running
+each inspection, including the artifacts hashed by inspections, see
+ProgressEvent.
+*/
+func WithVerificationProgress(f ProgressFunc) VerifyOption {
+	return func(c *verifyConfig) { c.progress = f }
+}
+
+// WithVerificationLogger logs debug messages of Verify to the passed Logger,
+// instead of the Logger registered with SetLogger.
+func WithVerificationLogger(l Logger) VerifyOption {
+	return func(c *verifyConfig) { c.logger = l }
+}
+
+/*
+WithClockSkewTolerance tolerates clocks of signers and the verifier that
+disagree by at most the passed duration.  The tolerance is applied uniformly:
+layouts are accepted for the passed duration after their expiry, in addition
+to any WithExpiryTolerance, and certificates of link signers are accepted for
+the passed duration before and after their validity window.
+*/
+func WithClockSkewTolerance(tolerance time.Duration) VerifyOption {
+	return func(c *verifyConfig) { c.opts.clockSkew = tolerance }
+}
+
+/*
+WithContentTypeHook calls the passed hook for each material and product of
+the links of the layout's steps, whose content type matches the passed
+pattern, e.g. "application/*", see path.Match.  Content types are recorded by
+functionaries with DetectContentTypes set in their artifact profile.  The
+pattern "*" also matches artifacts without recorded content type, whose
+ContentType is empty.  Several hooks may be registered, they are called in
+the order of registration.
+*/
+func WithContentTypeHook(pattern string, hook ContentTypeHook) VerifyOption {
+	return func(c *verifyConfig) {
+		c.opts.contentTypeHooks = append(c.opts.contentTypeHooks, contentTypeHook{pattern: pattern, hook: hook})
+	}
+}
+
+/*
+WithAllowedProductContentTypes fails verification with an
+ErrContentTypeNotAllowed, if a product of the step of the passed name has a
+content type that matches none of the passed patterns, e.g. to require that
+all products of a signing step are detached signatures or archives:
+
+	WithAllowedProductContentTypes("sign", "application/pgp-signature", "application/gzip")
+
+Products without recorded content type are not allowed.
+*/
+func WithAllowedProductContentTypes(stepName string, patterns ...string) VerifyOption {
+	return WithContentTypeHook("*", allowedProductContentTypes(stepName, patterns))
+}
+
+// WithVerificationTime verifies the layout expiration and certificates at the
+// passed time instead of the current time, e.g. to verify historical layouts
+// or in environments without a trusted clock.
+func WithVerificationTime(now time.Time) VerifyOption {
+	return func(c *verifyConfig) { c.opts.now = now }
+}
+
+/*
+WithTimestampVerifiers requires the signatures of links to carry a timestamp,
+e.g. an RFC 3161 time-stamp token or a Rekor log entry, that passes
+verification with one of the passed verifiers, see VerifySignatureTimestamp.
+Links without such a timestamp, or whose timestamp attests a time after the
+expiration of the layout, with an ErrTimestampAfterExpiry, or after the
+verification time, with an ErrTimestampInFuture, do not count towards the
+threshold of their step.  The certificates of link signers are verified at
+the timestamped time, instead of the verification time, which proves that
+links were signed while the certificate was valid.  Links in DSSE envelopes
+cannot carry timestamps.
+*/
+func WithTimestampVerifiers(verifiers ...TimestampVerifier) VerifyOption {
+	return func(c *verifyConfig) { c.opts.timestampVerifiers = verifiers }
+}
+
+// WithDenylist ignores links revoked by the passed denylist, see
+// InTotoVerifyWithDenylist.
+func WithDenylist(denylist *Denylist) VerifyOption {
+	return func(c *verifyConfig) { c.opts.denylist = denylist }
+}
+
+// WithFetcher fetches referenced sublayouts with the passed fetcher, see
+// InTotoVerifyWithFetcher.
+func WithFetcher(fetcher Fetcher) VerifyOption {
+	return func(c *verifyConfig) { c.opts.fetcher = fetcher }
+}
+
+// WithGitRepository loads the git commits and tags referenced by steps from
+// the git repository in the passed directory, see GitReference.
+func WithGitRepository(dir string) VerifyOption {
+	return func(c *verifyConfig) { c.opts.gitDir = dir }
+}
+
+// WithLinkStore loads the links of steps from the passed link store instead of
+// the link directory passed to Verify, see InTotoVerifyWithLinkStore.
+func WithLinkStore(store LinkStore) VerifyOption {
+	return func(c *verifyConfig) { c.opts.linkStore = store }
+}
+
+// WithEvidence collects the evidence of the verification in the passed
+// value, see InTotoVerifyWithEvidence.
+func WithEvidence(evidence *VerificationEvidence) VerifyOption {
+	return func(c *verifyConfig) { c.opts.evidence = evidence }
+}
+
+/*
+WithPreviousEvidence re-verifies only what changed since the previous
+verification the passed evidence was gathered in, e.g. after a single step of
+a long pipeline was run again.  Layout signatures and expiration, and the
+signatures and thresholds of all links are verified as usual.  The artifact
+rules of steps are only verified again, if their link or the link of a step
+or inspection they match artifacts from changed.  Inspections check the local
+filesystem, hence they are always run and verified again.  If the evidence is of another layout, e.g. with other parameters,
+or of a failed verification, everything is verified.  The reused items are
+reported by VerificationEvidence.ReusedItems, see WithEvidence.
+*/
+func WithPreviousEvidence(previous *VerificationEvidence) VerifyOption {
+	return func(c *verifyConfig) { c.opts.previous = previous }
+}
+
+// AllowCommandMisalignment only warns about links whose executed command
+// differs from the expected command of their step, like InTotoVerify.
+func AllowCommandMisalignment() VerifyOption {
+	return func(c *verifyConfig) { c.allowCommandMisalignment = true }
+}
+
+// AllowLinkNameMismatch accepts links that report the name of another step
+// than the one they were loaded for, like InTotoVerify.
+func AllowLinkNameMismatch() VerifyOption {
+	return func(c *verifyConfig) { c.allowLinkNameMismatch = true }
+}
+
+/*
+Verify performs in-toto supply chain verification of the passed layout, signed
+by the passed layout keys, with the links in the passed directory, like
+InTotoVerify, and returns the summary link.  See VerifyOption for the defaults
+and how to change them.
+*/
+func Verify(layoutEnv Metadata, layoutKeys map[string]Key, linkDir string, opts ...VerifyOption) (Metadata, error) {
+	return VerifyContext(context.Background(), layoutEnv, layoutKeys, linkDir, opts...)
+}
+
+// VerifyContext behaves like Verify, but stops the verification when the
+// passed context is done, see InTotoVerifyContext.
+func VerifyContext(ctx context.Context, layoutEnv Metadata, layoutKeys map[string]Key, linkDir string, opts ...VerifyOption) (Metadata, error) {
+	c := verifyConfig{}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	c.opts.strictCommandAlignment = !c.allowCommandMisalignment
+	c.opts.checkLinkNames = !c.allowLinkNameMismatch
+	return inTotoVerify(withLogger(withProgress(ctx, c.progress), c.logger), layoutEnv, layoutKeys, linkDir, c.stepName, c.parameterDictionary,
+		c.intermediatePems, c.lineNormalization, c.opts)
+}
+
+// verifyLinkNames checks that the links of each step of the passed layout
+// report the name of the step.  Sublayouts are skipped.
+func verifyLinkNames(layout Layout, stepsMetadata map[string]map[string]Metadata) error {
+	errs := &MultiError{}
+	for _, step := range layout.Steps {
+		for _, signerKeyID := range sortedKeyIDs(stepsMetadata[step.Name]) {
+			link, ok := stepsMetadata[step.Name][signerKeyID].GetPayload().(Link)
+			if !ok {
+				continue
+			}
+			if link.Name != step.Name {
+				errs.add(fmt.Errorf("%w: '%s' reports name '%s'", ErrLinkNameMismatch,
+					fmt.Sprintf(LinkNameFormat, step.Name, signerKeyID), link.Name))
+			}
+		}
+	}
+	return errs.err()
+}
+
+// verifyStepCommandAlignmentStrict checks that the links of each step of the
+// passed layout report the expected command of the step.  Steps without
+// expected command are skipped.
+func verifyStepCommandAlignmentStrict(layout Layout, stepsMetadata map[string]map[string]Metadata) error {
+	errs := &MultiError{}
+	for _, step := range layout.Steps {
+		if len(step.ExpectedCommand) == 0 {
+			continue
+		}
+		for _, signerKeyID := range sortedKeyIDs(stepsMetadata[step.Name]) {
+			executedCommand := stepsMetadata[step.Name][signerKeyID].GetPayload().(Link).Command
+			if !CommandsEqual(step.ExpectedCommand, executedCommand) {
+				errs.add(fmt.Errorf("%w: step '%s' expects '%s', '%s' reports '%s'",
+					ErrCommandMisalignment, step.Name, strings.Join(step.ExpectedCommand, " "),
+					fmt.Sprintf(LinkNameFormat, step.Name, signerKeyID), strings.Join(executedCommand, " ")))
+			}
+		}
+	}
+	return errs.err()
+}
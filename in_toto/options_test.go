@@ -0,0 +1,270 @@
+package in_toto
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunOptions(t *testing.T) {
+	var key Key
+	if err := key.LoadKey("carol", "ed25519", []string{"sha256", "sha512"}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := Run("step", []string{"sh", "-c", "true"}, Key{})
+	assert.ErrorIs(t, err, ErrUnsignedLink)
+	linkEnv, err := Run("step", []string{"sh", "-c", "true"}, Key{}, WithUnsignedLink())
+	if assert.Nil(t, err) {
+		assert.Empty(t, linkEnv.Sigs())
+	}
+
+	// Links are signed DSSE envelopes with sha256 and sha512 digests by default
+	linkEnv, err = Run("step", []string{"sh", "-c", "true"}, key, WithMaterials("alice.pub"), WithProducts("foo.tar.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.IsType(t, &Envelope{}, linkEnv)
+	assert.Nil(t, linkEnv.VerifySignature(key))
+	link := linkEnv.GetPayload().(Link)
+	assert.Equal(t, []string{"sh", "-c", "true"}, link.Command)
+	assert.Len(t, link.Materials["alice.pub"], 2)
+	assert.Len(t, link.Products["foo.tar.gz"], 2)
+	assert.Equal(t, float64(0), link.ByProducts["return-value"])
+
+	linkEnv, err = Run("step", []string{"sh", "-c", "true"}, key, WithMaterials("alice.pub"),
+		WithHashAlgorithms("sha256"), WithMetablock(), WithByproducts(ByproductOptions{DisableCapture: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.IsType(t, &Metablock{}, linkEnv)
+	link = linkEnv.GetPayload().(Link)
+	assert.Equal(t, HashObj{"sha256": "f051e8b561835b7b2aa7791db7bc72f2613411b0b7d428a0ac33d45b8c518039"}, link.Materials["alice.pub"])
+	assert.Equal(t, "", link.ByProducts["stdout"])
+
+	// Hash algorithms of the profile take precedence over the defaults
+	linkEnv, err = Run("step", []string{"sh", "-c", "true"}, key, WithMaterials("alice.pub"),
+		WithArtifactProfile(ArtifactProfile{HashAlgorithms: []string{"sha512"}}))
+	if assert.Nil(t, err) {
+		assert.Contains(t, linkEnv.GetPayload().(Link).Materials["alice.pub"], "sha512")
+		assert.NotContains(t, linkEnv.GetPayload().(Link).Materials["alice.pub"], "sha256")
+	}
+	linkEnv, err = Run("step", []string{"sh", "-c", "true"}, key, WithMaterials("alice.pub"),
+		WithArtifactProfile(ArtifactProfile{LStripPaths: []string{"alice."}}))
+	if assert.Nil(t, err) {
+		assert.Len(t, linkEnv.GetPayload().(Link).Materials["pub"], 2)
+	}
+
+	// Absent products are asserted in the link, if no product matches
+	linkEnv, err = Run("step", []string{"sh", "-c", "true"}, key, WithProducts("foo.tar.gz"),
+		WithAbsentProducts("*.pem", "*.key"))
+	if assert.Nil(t, err) {
+		assert.Equal(t, []string{"*.pem", "*.key"}, linkEnv.GetPayload().(Link).AbsentProducts)
+		assert.Nil(t, validateLink(linkEnv.GetPayload().(Link)))
+	}
+	_, err = Run("step", []string{"sh", "-c", "true"}, key, WithProducts("alice.pub"),
+		WithAbsentProducts("*.pub"))
+	assert.ErrorIs(t, err, ErrAbsentProductRecorded)
+	_, err = Run("step", []string{"sh", "-c", "true"}, key, WithAbsentProducts("["))
+	assert.NotNil(t, err)
+}
+
+func TestRecordOptions(t *testing.T) {
+	var key Key
+	if err := key.LoadKey("carol", "ed25519", []string{"sha256", "sha512"}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := RecordStart("step", Key{}, WithMaterials("alice.pub"))
+	assert.ErrorIs(t, err, ErrUnsignedLink)
+
+	for _, opts := range [][]RunOption{{}, {WithMetablock()}} {
+		prelimLinkEnv, err := RecordStart("step", key, append(opts, WithMaterials("alice.pub"))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The finished link keeps the format of the unfinished link
+		linkEnv, err := RecordStop(prelimLinkEnv, key, WithProducts("foo.tar.gz"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.IsType(t, prelimLinkEnv, linkEnv)
+		link := linkEnv.GetPayload().(Link)
+		assert.Len(t, link.Materials["alice.pub"], 2)
+		assert.Len(t, link.Products["foo.tar.gz"], 2)
+	}
+
+	prelimLinkEnv, err := RecordStart("step", key, WithMaterials("alice.pub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = RecordStop(prelimLinkEnv, key, WithProducts("alice.pub"), WithAbsentProducts("alice.*"))
+	assert.ErrorIs(t, err, ErrAbsentProductRecorded)
+	linkEnv, err := RecordStop(prelimLinkEnv, key, WithProducts("alice.pub"), WithAbsentProducts("*.key"))
+	if assert.Nil(t, err) {
+		assert.Equal(t, []string{"*.key"}, linkEnv.GetPayload().(Link).AbsentProducts)
+	}
+}
+
+func TestRunOptionsArtifacts(t *testing.T) {
+	var key Key
+	if err := key.LoadKey("carol", "ed25519", []string{"sha256", "sha512"}); err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := RecordArtifactBytes("manifest.yaml", []byte("kind: Deployment\n"), []string{"sha256", "sha512"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob, err := RecordArtifactBytes("app.wasm", []byte{0x00, 0x61, 0x73, 0x6d}, []string{"sha256", "sha512"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	linkEnv, err := Run("step", []string{"sh", "-c", "true"}, key, WithMaterials("alice.pub"),
+		WithMaterialArtifacts(manifest), WithProducts("foo.tar.gz"), WithProductArtifacts(manifest, blob))
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := linkEnv.GetPayload().(Link)
+	assert.Equal(t, manifest["manifest.yaml"], link.Materials["manifest.yaml"])
+	assert.Len(t, link.Materials, 2)
+	assert.Equal(t, blob["app.wasm"], link.Products["app.wasm"])
+	assert.Len(t, link.Products, 3)
+
+	prelimLinkEnv, err := RecordStart("step", key, WithMaterialArtifacts(manifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	linkEnv, err = RecordStop(prelimLinkEnv, key, WithProductArtifacts(blob))
+	if err != nil {
+		t.Fatal(err)
+	}
+	link = linkEnv.GetPayload().(Link)
+	assert.Equal(t, manifest, link.Materials)
+	assert.Equal(t, blob, link.Products)
+
+	// Artifact names are recorded only once, and may be asserted absent
+	_, err = Run("step", []string{"sh", "-c", "true"}, key, WithMaterialArtifacts(manifest, manifest))
+	assert.ErrorContains(t, err, "'manifest.yaml' is recorded more than once")
+	conflict, err := RecordArtifactBytes("alice.pub", []byte("alice"), []string{"sha256"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Run("step", []string{"sh", "-c", "true"}, key, WithMaterials("alice.pub"), WithMaterialArtifacts(conflict))
+	assert.NotNil(t, err)
+	_, err = RecordStop(prelimLinkEnv, key, WithProductArtifacts(blob), WithAbsentProducts("*.wasm"))
+	assert.ErrorIs(t, err, ErrAbsentProductRecorded)
+}
+
+func TestVerifyOptions(t *testing.T) {
+	var layoutKey, key Key
+	if err := layoutKey.LoadKeyDefaults("alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := key.LoadKey("carol", "ed25519", []string{"sha256", "sha512"}); err != nil {
+		t.Fatal(err)
+	}
+	pubKey := key
+	pubKey.KeyVal.Private = ""
+	layoutKeys := map[string]Key{layoutKey.KeyID: layoutKey}
+
+	command := []string{"sh", "-c", "true"}
+	linkDir := t.TempDir()
+	linkEnv, err := Run("build", command, key, WithProducts("foo.tar.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := linkEnv.Dump(filepath.Join(linkDir, fmt.Sprintf(LinkNameFormat, "build", key.KeyID))); err != nil {
+		t.Fatal(err)
+	}
+
+	newLayout := func(expectedCommand []string, steps ...string) Metadata {
+		layout := Layout{
+			Type:    "layout",
+			Expires: time.Now().Add(time.Hour).UTC().Format(ISO8601DateSchema),
+			Keys:    map[string]Key{pubKey.KeyID: pubKey},
+			Inspect: []Inspection{},
+		}
+		for _, step := range steps {
+			layout.Steps = append(layout.Steps, Step{
+				Type:            "step",
+				PubKeys:         []string{pubKey.KeyID},
+				ExpectedCommand: expectedCommand,
+				Threshold:       1,
+				SupplyChainItem: SupplyChainItem{
+					Name:             step,
+					ExpectedProducts: [][]string{{"CREATE", "foo.tar.gz"}, {"DISALLOW", "*"}},
+				},
+			})
+		}
+		layoutMb := &Metablock{Signed: layout}
+		if err := layoutMb.Sign(layoutKey); err != nil {
+			t.Fatal(err)
+		}
+		return layoutMb
+	}
+
+	summary, err := Verify(newLayout(command, "build"), layoutKeys, linkDir, WithStepName("summary"))
+	if assert.Nil(t, err) {
+		assert.Equal(t, "summary", summary.GetPayload().(Link).Name)
+		assert.Contains(t, summary.GetPayload().(Link).Products, "foo.tar.gz")
+	}
+
+	// Command misalignment fails verification, unless allowed
+	_, err = Verify(newLayout([]string{"make"}, "build"), layoutKeys, linkDir)
+	assert.ErrorIs(t, err, ErrCommandMisalignment)
+	_, err = Verify(newLayout([]string{"make"}, "build"), layoutKeys, linkDir, AllowCommandMisalignment())
+	assert.Nil(t, err)
+	_, err = Verify(newLayout(nil, "build"), layoutKeys, linkDir)
+	assert.Nil(t, err)
+
+	// Links of another step fail verification, unless allowed
+	linkBytes, err := os.ReadFile(filepath.Join(linkDir, fmt.Sprintf(LinkNameFormat, "build", key.KeyID)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(linkDir, fmt.Sprintf(LinkNameFormat, "test", key.KeyID)), linkBytes, 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = Verify(newLayout(command, "build", "test"), layoutKeys, linkDir)
+	assert.ErrorIs(t, err, ErrLinkNameMismatch)
+	_, err = Verify(newLayout(command, "build", "test"), layoutKeys, linkDir, AllowLinkNameMismatch())
+	assert.Nil(t, err)
+
+	// Links of unauthorized keys are ignored, whatever name they report
+	junk := &Metablock{Signed: Link{Type: "link", Name: "junk"}}
+	if err := junk.Sign(layoutKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := junk.Dump(filepath.Join(linkDir, fmt.Sprintf(LinkNameFormat, "build", layoutKey.KeyID))); err != nil {
+		t.Fatal(err)
+	}
+	_, err = Verify(newLayout(command, "build"), layoutKeys, linkDir)
+	assert.Nil(t, err)
+
+	// Layout expiration is verified at the verification time, if passed
+	_, err = Verify(newLayout(command, "build"), layoutKeys, linkDir,
+		WithVerificationTime(time.Now().Add(2*time.Hour)))
+	assert.ErrorContains(t, err, "layout has expired")
+	_, err = Verify(newLayout(command, "build"), layoutKeys, linkDir,
+		WithVerificationTime(time.Now().Add(2*time.Hour)), WithExpiryTolerance(2*time.Hour))
+	assert.Nil(t, err)
+	_, err = Verify(newLayout(command, "build"), layoutKeys, linkDir,
+		WithVerificationTime(time.Now().Add(2*time.Hour)), WithClockSkewTolerance(2*time.Hour))
+	assert.Nil(t, err)
+	_, err = Verify(newLayout(command, "build"), layoutKeys, linkDir,
+		WithVerificationTime(time.Now().Add(2*time.Hour)), WithExpiryTolerance(20*time.Minute),
+		WithClockSkewTolerance(20*time.Minute))
+	assert.ErrorIs(t, err, ErrLayoutExpired)
+
+	// Options of the variants of InTotoVerify are available, too
+	evidence := &VerificationEvidence{}
+	_, err = Verify(newLayout(command, "build"), layoutKeys, linkDir, WithEvidence(evidence),
+		WithExpiryTolerance(time.Minute), WithFetcher(&URIFetcher{BaseDir: linkDir}),
+		WithDenylist(&Denylist{}), WithParameters(map[string]string{}), WithLineNormalization())
+	assert.Nil(t, err)
+}
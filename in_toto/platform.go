@@ -0,0 +1,160 @@
+package in_toto
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ErrInvalidPlatform is returned when a platform does not consist of a known
+// operating system and architecture.
+var ErrInvalidPlatform = errors.New("invalid platform")
+
+/*
+Platform identifies an operating system and architecture combination, which
+software is built for, e.g. linux/amd64.  Operating systems and architectures
+are named like GOOS and GOARCH values of the Go toolchain.
+*/
+type Platform struct {
+	OS   string
+	Arch string
+}
+
+// knownPlatformOS and knownPlatformArch list the supported values of
+// Platform.OS and Platform.Arch.
+var (
+	knownPlatformOS = []string{
+		"aix", "android", "darwin", "dragonfly", "freebsd", "illumos", "ios",
+		"js", "linux", "netbsd", "openbsd", "plan9", "solaris", "wasip1",
+		"windows",
+	}
+	knownPlatformArch = []string{
+		"386", "amd64", "arm", "arm64", "loong64", "mips", "mips64",
+		"mips64le", "mipsle", "ppc64", "ppc64le", "riscv64", "s390x", "wasm",
+	}
+)
+
+// platformArtifactRegexp matches the '-<os>-<arch>' segment of a platform
+// artifact name, which is followed either by the end of the name or by a file
+// extension.
+var platformArtifactRegexp = regexp.MustCompile(
+	"-(" + strings.Join(knownPlatformOS, "|") + ")-(" +
+		strings.Join(knownPlatformArch, "|") + `)(\.[^/]*)?$`)
+
+// String returns the platform in the '<os>/<arch>' notation.
+func (p Platform) String() string {
+	return p.OS + "/" + p.Arch
+}
+
+// validatePlatform checks that OS and Arch of the passed platform are known.
+func validatePlatform(p Platform) error {
+	if !NewSet(knownPlatformOS...).Has(p.OS) || !NewSet(knownPlatformArch...).Has(p.Arch) {
+		return fmt.Errorf("%w: '%s'", ErrInvalidPlatform, p)
+	}
+	return nil
+}
+
+/*
+ParsePlatform parses a platform in the '<os>/<arch>' notation, e.g.
+"linux/amd64".  It returns an error if the operating system or architecture is
+unknown.
+*/
+func ParsePlatform(s string) (Platform, error) {
+	goos, goarch, found := strings.Cut(s, "/")
+	if !found {
+		return Platform{}, fmt.Errorf("%w: '%s'", ErrInvalidPlatform, s)
+	}
+	p := Platform{OS: goos, Arch: goarch}
+	if err := validatePlatform(p); err != nil {
+		return Platform{}, err
+	}
+	return p, nil
+}
+
+/*
+PlatformArtifactName returns the name of the artifact of the passed platform
+for the passed logical artifact name.  The logical name may contain '{os}' and
+'{arch}' markers, which are replaced by the OS and architecture of the
+platform, e.g. "dist/tool-{os}-{arch}.tar.gz".  Without markers
+'-<os>-<arch>' is appended, e.g. "dist/tool" becomes "dist/tool-linux-amd64".
+*/
+func PlatformArtifactName(name string, p Platform) string {
+	if !strings.Contains(name, "{os}") && !strings.Contains(name, "{arch}") {
+		return name + "-" + p.OS + "-" + p.Arch
+	}
+	return strings.NewReplacer("{os}", p.OS, "{arch}", p.Arch).Replace(name)
+}
+
+/*
+ParsePlatformArtifact splits the passed artifact name into the logical
+artifact name and the platform it was built for.  The platform is identified
+by a '-<os>-<arch>' segment at the end of the name or before its file
+extension, which is removed from the logical name, e.g.
+"dist/tool-darwin-arm64.tar.gz" yields "dist/tool.tar.gz" and darwin/arm64.
+The last return value is false if the name does not identify a platform.
+*/
+func ParsePlatformArtifact(name string) (string, Platform, bool) {
+	loc := platformArtifactRegexp.FindStringSubmatchIndex(name)
+	// The logical name must not be empty, i.e. "-linux-amd64" is no platform
+	// artifact
+	if loc == nil || loc[0] == 0 || name[loc[0]-1] == '/' {
+		return "", Platform{}, false
+	}
+	p := Platform{OS: name[loc[2]:loc[3]], Arch: name[loc[4]:loc[5]]}
+	return name[:loc[0]] + name[loc[1]-(loc[7]-loc[6]):], p, true
+}
+
+/*
+GroupPlatformArtifacts groups the passed artifacts, e.g. the products of a
+link, by logical artifact name.  For each logical name, see
+ParsePlatformArtifact, it returns the names of the artifacts by platform.
+Artifacts whose names do not identify a platform are omitted.
+*/
+func GroupPlatformArtifacts(artifacts map[string]HashObj) map[string]map[Platform]string {
+	groups := make(map[string]map[Platform]string)
+	for name := range artifacts {
+		logicalName, platform, ok := ParsePlatformArtifact(name)
+		if !ok {
+			continue
+		}
+		if groups[logicalName] == nil {
+			groups[logicalName] = make(map[Platform]string)
+		}
+		groups[logicalName][platform] = name
+	}
+	return groups
+}
+
+/*
+PlatformArtifactRules creates artifact rules that require the artifact of the
+passed logical name for each of the passed platforms and match it with the
+products of the step that built it, see PlatformArtifactName for the naming
+of platform artifacts.  The step name may contain '{os}' and '{arch}' markers
+as well, for layouts with one build step per platform, e.g. "build-{os}-{arch}".
+The rules are meant as expected materials of a step or inspection that
+consumes a matrix build, e.g.:
+
+	rules, _ := PlatformArtifactRules("dist/tool", platforms, "build-{os}-{arch}")
+	release.ExpectedMaterials = append(rules, []string{"DISALLOW", "*"})
+
+It returns an error if no or an invalid platform is passed.
+*/
+func PlatformArtifactRules(name string, platforms []Platform, step string) ([][]string, error) {
+	if len(platforms) == 0 {
+		return nil, fmt.Errorf("%w: no platforms for artifact '%s'", ErrInvalidPlatform, name)
+	}
+	rules := make([][]string, 0, 2*len(platforms))
+	for _, p := range platforms {
+		if err := validatePlatform(p); err != nil {
+			return nil, err
+		}
+		artifact := PlatformArtifactName(name, p)
+		stepName := strings.NewReplacer("{os}", p.OS, "{arch}", p.Arch).Replace(step)
+		rules = append(rules,
+			[]string{"REQUIRE", artifact},
+			[]string{"MATCH", artifact, "WITH", "PRODUCTS", "FROM", stepName},
+		)
+	}
+	return rules, nil
+}
@@ -0,0 +1,116 @@
+package in_toto
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePlatform(t *testing.T) {
+	p, err := ParsePlatform("linux/amd64")
+	assert.Nil(t, err)
+	assert.Equal(t, Platform{OS: "linux", Arch: "amd64"}, p)
+	assert.Equal(t, "linux/amd64", p.String())
+
+	for _, invalid := range []string{"", "linux", "linux-amd64", "linux/x86", "beos/amd64"} {
+		_, err := ParsePlatform(invalid)
+		assert.ErrorIs(t, err, ErrInvalidPlatform, invalid)
+	}
+}
+
+func TestPlatformArtifactName(t *testing.T) {
+	darwin := Platform{OS: "darwin", Arch: "arm64"}
+	assert.Equal(t, "dist/tool-darwin-arm64", PlatformArtifactName("dist/tool", darwin))
+	assert.Equal(t, "dist/tool-darwin-arm64.tar.gz", PlatformArtifactName("dist/tool-{os}-{arch}.tar.gz", darwin))
+	assert.Equal(t, "darwin/arm64/tool", PlatformArtifactName("{os}/{arch}/tool", darwin))
+}
+
+func TestParsePlatformArtifact(t *testing.T) {
+	tests := []struct {
+		name        string
+		logicalName string
+		platform    Platform
+		ok          bool
+	}{
+		{"binary-linux-amd64", "binary", Platform{"linux", "amd64"}, true},
+		{"dist/binary-darwin-arm64.tar.gz", "dist/binary.tar.gz", Platform{"darwin", "arm64"}, true},
+		{"binary-windows-386.exe", "binary.exe", Platform{"windows", "386"}, true},
+		{"binary-linux-mips64le", "binary", Platform{"linux", "mips64le"}, true},
+		{"my-tool-linux-arm", "my-tool", Platform{"linux", "arm"}, true},
+		{"binary", "", Platform{}, false},
+		{"binary-linux", "", Platform{}, false},
+		{"binary-linux-amd64-debug", "", Platform{}, false},
+		{"-linux-amd64", "", Platform{}, false},
+		{"dist/-linux-amd64", "", Platform{}, false},
+		{"binary-linux-amd64.d/README", "", Platform{}, false},
+	}
+	for _, test := range tests {
+		logicalName, platform, ok := ParsePlatformArtifact(test.name)
+		assert.Equal(t, test.ok, ok, test.name)
+		assert.Equal(t, test.logicalName, logicalName, test.name)
+		assert.Equal(t, test.platform, platform, test.name)
+	}
+}
+
+func TestGroupPlatformArtifacts(t *testing.T) {
+	artifacts := map[string]HashObj{
+		"binary-linux-amd64":       {},
+		"binary-darwin-arm64":      {},
+		"lib-linux-amd64.tar.gz":   {},
+		"lib-windows-amd64.tar.gz": {},
+		"README.md":                {},
+	}
+	expected := map[string]map[Platform]string{
+		"binary": {
+			{"linux", "amd64"}:  "binary-linux-amd64",
+			{"darwin", "arm64"}: "binary-darwin-arm64",
+		},
+		"lib.tar.gz": {
+			{"linux", "amd64"}:   "lib-linux-amd64.tar.gz",
+			{"windows", "amd64"}: "lib-windows-amd64.tar.gz",
+		},
+	}
+	assert.Equal(t, expected, GroupPlatformArtifacts(artifacts))
+}
+
+func TestPlatformArtifactRules(t *testing.T) {
+	platforms := []Platform{{"linux", "amd64"}, {"darwin", "arm64"}}
+	rules, err := PlatformArtifactRules("binary", platforms, "build-{os}-{arch}")
+	assert.Nil(t, err)
+	assert.Equal(t, [][]string{
+		{"REQUIRE", "binary-linux-amd64"},
+		{"MATCH", "binary-linux-amd64", "WITH", "PRODUCTS", "FROM", "build-linux-amd64"},
+		{"REQUIRE", "binary-darwin-arm64"},
+		{"MATCH", "binary-darwin-arm64", "WITH", "PRODUCTS", "FROM", "build-darwin-arm64"},
+	}, rules)
+	for _, rule := range rules {
+		_, err := UnpackRule(rule)
+		assert.Nil(t, err)
+	}
+
+	_, err = PlatformArtifactRules("binary", nil, "build")
+	assert.ErrorIs(t, err, ErrInvalidPlatform)
+	_, err = PlatformArtifactRules("binary", []Platform{{"linux", "x86"}}, "build")
+	assert.ErrorIs(t, err, ErrInvalidPlatform)
+
+	// The rules require the artifact of each platform from its build step
+	items := []interface{}{
+		Step{SupplyChainItem: SupplyChainItem{Name: "release", ExpectedMaterials: append(rules, []string{"DISALLOW", "*"})}},
+	}
+	products := func(name string) map[string]HashObj {
+		return map[string]HashObj{name: {"sha256": "abc"}}
+	}
+	itemsMetadata := map[string]Metadata{
+		"release": &Metablock{Signed: Link{Name: "release", Materials: map[string]HashObj{
+			"binary-linux-amd64":  {"sha256": "abc"},
+			"binary-darwin-arm64": {"sha256": "abc"},
+		}}},
+		"build-linux-amd64":  &Metablock{Signed: Link{Name: "build-linux-amd64", Products: products("binary-linux-amd64")}},
+		"build-darwin-arm64": &Metablock{Signed: Link{Name: "build-darwin-arm64", Products: products("binary-darwin-arm64")}},
+	}
+	assert.Nil(t, verifyArtifacts(context.Background(), items, itemsMetadata, artifactMatcher{}, nil, nil))
+
+	delete(itemsMetadata["release"].(*Metablock).Signed.(Link).Materials, "binary-darwin-arm64")
+	assert.NotNil(t, verifyArtifacts(context.Background(), items, itemsMetadata, artifactMatcher{}, nil, nil))
+}
@@ -0,0 +1,100 @@
+package in_toto
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+/*
+PointerError locates a metadata validation or verification error in the
+offending metadata with a JSON pointer, see RFC 6901, e.g.
+"/signed/steps/2/expected_products/4" for the fifth product rule of the third
+step of a layout in a Metablock.  Pointers into DSSE envelopes locate the error
+in the decoded payload, e.g. "/steps/2/expected_products/4", because the
+payload is base64 encoded.  Use ErrorPointer to obtain the pointer of an error,
+e.g. to highlight the offending line in an editor.
+*/
+type PointerError struct {
+	Pointer string
+	Err     error
+}
+
+// Error returns the message of the located error, the pointer is only
+// available as field, so that error messages do not change.
+func (e *PointerError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the located error.
+func (e *PointerError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorPointer returns the JSON pointer of the passed error, if it wraps a
+// PointerError, and an empty string otherwise.
+func ErrorPointer(err error) string {
+	var pointerErr *PointerError
+	if errors.As(err, &pointerErr) {
+		return pointerErr.Pointer
+	}
+	return ""
+}
+
+/*
+atPointer locates the passed error at the JSON pointer of the passed reference
+tokens, i.e. field names, map keys or slice indices.  If the passed error is a
+PointerError, e.g. returned by the validation of a nested object, the tokens
+are prepended to its pointer instead.  If format is not empty, the located
+error is wrapped with it, with the error as last argument, e.g. to add
+context.  The errors of a MultiError are located individually.
+*/
+func atPointer(err error, tokens []interface{}, format string, args ...interface{}) error {
+	if multiErr, ok := err.(*MultiError); ok {
+		located := &MultiError{}
+		for _, err := range multiErr.Errs {
+			located.add(atPointer(err, tokens, format, args...))
+		}
+		return located
+	}
+	pointer := ""
+	if pointerErr, ok := err.(*PointerError); ok {
+		err, pointer = pointerErr.Err, pointerErr.Pointer
+	}
+	if format != "" {
+		err = fmt.Errorf(format, append(args, err)...)
+	}
+	return &PointerError{Pointer: jsonPointer(tokens...) + pointer, Err: err}
+}
+
+// locateInMetadata prepends the pointer of the payload of the passed metadata
+// to the pointer of the passed error, if it is a PointerError that locates the
+// error in the payload, e.g. "/signed" for Metablocks.
+func locateInMetadata(metadata Metadata, err error) error {
+	if multiErr, ok := err.(*MultiError); ok {
+		located := &MultiError{}
+		for _, err := range multiErr.Errs {
+			located.add(locateInMetadata(metadata, err))
+		}
+		return located
+	}
+	if _, ok := err.(*PointerError); !ok {
+		return err
+	}
+	if _, ok := metadata.(*Metablock); ok {
+		return atPointer(err, []interface{}{"signed"}, "")
+	}
+	return err
+}
+
+// jsonPointer returns the JSON pointer of the passed reference tokens,
+// escaping "~" and "/" in tokens as required by RFC 6901.
+func jsonPointer(tokens ...interface{}) string {
+	var sb strings.Builder
+	for _, token := range tokens {
+		sb.WriteString("/")
+		escaped := strings.ReplaceAll(fmt.Sprint(token), "~", "~0")
+		sb.WriteString(strings.ReplaceAll(escaped, "/", "~1"))
+	}
+	return sb.String()
+}
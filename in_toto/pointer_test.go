@@ -0,0 +1,59 @@
+package in_toto
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAtPointer(t *testing.T) {
+	reason := errors.New("invalid rule")
+	err := atPointer(reason, []interface{}{"expected_products", 4}, "")
+	assert.Equal(t, "/expected_products/4", ErrorPointer(err))
+	assert.ErrorIs(t, err, reason)
+
+	// Pointers of nested objects are prefixed, and context is added to the
+	// located error
+	err = atPointer(err, []interface{}{"steps", 2}, "step '%s': %w", "build")
+	assert.Equal(t, "/steps/2/expected_products/4", ErrorPointer(err))
+	assert.Equal(t, "step 'build': invalid rule", err.Error())
+	assert.ErrorIs(t, err, reason)
+
+	// Reference tokens are escaped
+	err = atPointer(reason, []interface{}{"materials", "src/~foo", "sha256"}, "")
+	assert.Equal(t, "/materials/src~1~0foo/sha256", ErrorPointer(err))
+
+	assert.Empty(t, ErrorPointer(reason))
+	assert.Equal(t, "/products", ErrorPointer(fmt.Errorf("failed: %w", atPointer(reason, []interface{}{"products"}, ""))))
+
+	// Pointers into Metablocks start at the signed part
+	err = atPointer(reason, []interface{}{"expires"}, "")
+	assert.Equal(t, "/signed/expires", ErrorPointer(locateInMetadata(&Metablock{}, err)))
+	assert.Equal(t, "/expires", ErrorPointer(locateInMetadata(&Envelope{}, err)))
+	assert.Equal(t, reason, locateInMetadata(&Metablock{}, reason))
+}
+
+func TestValidateMetablockPointer(t *testing.T) {
+	layout := Layout{
+		Type:    "layout",
+		Expires: "2030-01-01T00:00:00Z",
+		Steps: []Step{
+			{Type: "step", SupplyChainItem: SupplyChainItem{Name: "build"}},
+			{Type: "step", SupplyChainItem: SupplyChainItem{Name: "test",
+				ExpectedProducts: [][]string{{"ALLOW", "*"}, {"INVALID"}}}},
+		},
+	}
+	err := ValidateMetablock(Metablock{Signed: layout})
+	assert.Equal(t, "/signed/steps/1/expected_products/1/0", ErrorPointer(err))
+	assert.Contains(t, err.Error(), "step invalid product rule: ")
+
+	link := Link{Type: "link", Name: "build", Materials: map[string]HashObj{"foo": {"sha256": "xyz"}}}
+	err = ValidateMetablock(Metablock{Signed: link})
+	assert.Equal(t, "/signed/materials/foo/sha256", ErrorPointer(err))
+
+	keyID := "b7d643dec0a051096ee5d87221b5d91a33daa658699d30903e1cefb90c418401"
+	err = ValidateMetablock(Metablock{Signed: Link{Type: "link", Name: "build"}, Signatures: []Signature{{KeyID: keyID, Sig: "xyz"}}})
+	assert.Equal(t, "/signatures/0/sig", ErrorPointer(err))
+}
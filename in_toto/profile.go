@@ -0,0 +1,179 @@
+package in_toto
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrUnknownArtifactProfile is returned when an artifact profile is referenced
+// that is not defined.
+var ErrUnknownArtifactProfile = errors.New("unknown artifact profile")
+
+// defaultProfileHashAlgorithms are used by artifact profiles that do not set
+// any hash algorithms, like in-toto run and inspections do by default.
+var defaultProfileHashAlgorithms = []string{"sha256"}
+
+/*
+ArtifactProfile is a named set of artifact handling options, which is applied
+identically when recording artifacts of a step, e.g. with in-toto run, and
+when the verifier records artifacts of an inspection.  Sharing a profile
+avoids mismatches between links and inspections caused by divergent flags.
+
+Profiles are defined in the ArtifactProfiles of a layout, or in a standalone
+JSON file, see LoadArtifactProfiles, and referenced from steps and
+inspections by name, e.g.:
+
+	"artifact_profiles": {
+	  "source": {
+	    "exclude_patterns": [".git"],
+	    "lstrip_paths": ["src/"],
+	    "normalize_line_endings": true,
+	    "hash_algorithms": ["sha256", "sha512"]
+	  }
+	}
+*/
+type ArtifactProfile struct {
+	// ExcludePatterns are gitignore-style patterns of paths not to record,
+	// unless ExcludePatternSyntax is set
+	ExcludePatterns   []string `json:"exclude_patterns,omitempty"`
+	LStripPaths       []string `json:"lstrip_paths,omitempty"`
+	LineNormalization bool     `json:"normalize_line_endings,omitempty"`
+	HashAlgorithms    []string `json:"hash_algorithms,omitempty"`
+	// FollowSymlinkDirs records the contents of symlinked directories, which
+	// are skipped otherwise.  Symlinked files are recorded with the contents
+	// of their target, unless SkipSymlinks is set.
+	FollowSymlinkDirs bool `json:"follow_symlink_dirs,omitempty"`
+	// SkipSymlinks skips all symlinks, i.e. neither symlinked files nor
+	// directories are recorded
+	SkipSymlinks bool `json:"skip_symlinks,omitempty"`
+	// RecordEmptyDirs records empty directories as artifacts without digests,
+	// whose names end with a slash, e.g. "logs/"
+	RecordEmptyDirs bool `json:"record_empty_dirs,omitempty"`
+	// DirHashPatterns are gitignore-style patterns of directories to record
+	// as a single artifact, whose name ends with a slash, e.g. "dist/", instead
+	// of one artifact per file, see RecordDirectory
+	DirHashPatterns []string `json:"dirhash_patterns,omitempty"`
+	// GoVendorPatterns are gitignore-style patterns of Go vendor directories,
+	// e.g. "vendor", to record by their vendored modules instead of one
+	// artifact per file, see RecordGoVendor
+	GoVendorPatterns []string `json:"go_vendor_patterns,omitempty"`
+	// DetectContentTypes records the content types of artifacts in the
+	// Environment of the link, see ArtifactContentTypes
+	DetectContentTypes bool `json:"detect_content_types,omitempty"`
+	// ExcludePatternSyntax is the syntax of ExcludePatterns, e.g.
+	// PatternSyntaxExtended, see RegisterPatternSyntax.  The patterns are
+	// then matched against the slash-separated paths as walked, before
+	// left-stripping.  Without syntax, gitignore semantics apply.
+	ExcludePatternSyntax string `json:"exclude_pattern_syntax,omitempty"`
+	// TextLineNormalization normalizes line separators like
+	// LineNormalization, but only of text files, i.e. files without NUL
+	// bytes in their first 8000 bytes, like git converts line endings of
+	// CRLF checkouts.  Binary files are hashed as is.
+	TextLineNormalization bool `json:"normalize_text_line_endings,omitempty"`
+	// DirHashMode is the mode directories matched by DirHashPatterns are
+	// hashed with, i.e. DirHashModeDirhash, the default, or
+	// DirHashModeMerkle, see RecordDirectoryTree
+	DirHashMode string `json:"dirhash_mode,omitempty"`
+	// SymlinkCyclePolicy is the handling of symlinks, which lead to a cycle,
+	// i.e. ArtifactPolicyError, the default, ArtifactPolicySkip or
+	// ArtifactPolicyRecordTarget
+	SymlinkCyclePolicy string `json:"symlink_cycle_policy,omitempty"`
+	// SpecialFilePolicy is the handling of device files, sockets and FIFOs,
+	// i.e. ArtifactPolicySkip, the default, or ArtifactPolicyError
+	SpecialFilePolicy string `json:"special_file_policy,omitempty"`
+}
+
+// GetHashAlgorithms returns the hash algorithms of the profile, or the
+// default hash algorithms, if the profile does not set any.
+func (p ArtifactProfile) GetHashAlgorithms() []string {
+	if len(p.HashAlgorithms) == 0 {
+		return defaultProfileHashAlgorithms
+	}
+	return p.HashAlgorithms
+}
+
+/*
+RecordArtifacts records the artifacts at the passed paths like the package
+function RecordArtifacts, using the options of the profile.
+*/
+func (p ArtifactProfile) RecordArtifacts(paths []string) (map[string]HashObj, error) {
+	return recordArtifactsWithProfile(paths, p.GetHashAlgorithms(), p)
+}
+
+// validateArtifactProfile checks that the passed profile only uses supported
+// hash algorithms, a registered exclude pattern syntax and known policies.
+func validateArtifactProfile(name string, profile ArtifactProfile) error {
+	if err := validateHashAlgorithms(profile.HashAlgorithms); err != nil {
+		return fmt.Errorf("invalid artifact profile '%s': %w", name, err)
+	}
+	if profile.ExcludePatternSyntax != "" {
+		if _, err := GetPatternMatcher(profile.ExcludePatternSyntax); err != nil {
+			return fmt.Errorf("invalid artifact profile '%s': %w", name, err)
+		}
+	}
+	if err := validateDirHashMode(profile.DirHashMode); err != nil {
+		return fmt.Errorf("invalid artifact profile '%s': %w", name, err)
+	}
+	if err := validateArtifactPolicies(profile); err != nil {
+		return fmt.Errorf("invalid artifact profile '%s': %w", name, err)
+	}
+	if profile.LineNormalization && profile.TextLineNormalization {
+		return fmt.Errorf("invalid artifact profile '%s': 'normalize_line_endings' and 'normalize_text_line_endings' are exclusive", name)
+	}
+	return nil
+}
+
+/*
+ResolveArtifactProfile returns the profile with the passed name from the
+passed profiles.  It returns an ErrUnknownArtifactProfile, if the profile is
+not defined.
+*/
+func ResolveArtifactProfile(profiles map[string]ArtifactProfile, name string) (ArtifactProfile, error) {
+	profile, ok := profiles[name]
+	if !ok {
+		return ArtifactProfile{}, fmt.Errorf("%w: '%s'", ErrUnknownArtifactProfile, name)
+	}
+	return profile, nil
+}
+
+/*
+LoadArtifactProfiles loads artifact profiles from the passed path, which is
+either a layout, whose ArtifactProfiles are returned, or a JSON file that maps
+profile names to profiles.  The signature of a layout is not verified.
+*/
+func LoadArtifactProfiles(path string) (map[string]ArtifactProfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rawData map[string]*json.RawMessage
+	if err := json.Unmarshal(data, &rawData); err != nil {
+		return nil, fmt.Errorf("failed to parse artifact profiles: %w", err)
+	}
+	// Metablocks carry a 'signed' and DSSE envelopes a 'payload' part
+	if _, ok := rawData["signed"]; ok || rawData["payload"] != nil {
+		metadata, err := LoadMetadata(path)
+		if err != nil {
+			return nil, err
+		}
+		layout, ok := metadata.GetPayload().(Layout)
+		if !ok {
+			return nil, fmt.Errorf("%w: metadata at %s", ErrNotLayout, path)
+		}
+		return layout.ArtifactProfiles, nil
+	}
+
+	var profiles map[string]ArtifactProfile
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("failed to parse artifact profiles: %w", err)
+	}
+	for name, profile := range profiles {
+		if err := validateArtifactProfile(name, profile); err != nil {
+			return nil, err
+		}
+	}
+	return profiles, nil
+}
@@ -0,0 +1,131 @@
+package in_toto
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadArtifactProfiles(t *testing.T) {
+	profiles := map[string]ArtifactProfile{
+		"source": {
+			ExcludePatterns:   []string{"*.link"},
+			LStripPaths:       []string{"src/"},
+			LineNormalization: true,
+			HashAlgorithms:    []string{"sha256", "sha512"},
+		},
+		"default": {},
+	}
+
+	path := filepath.Join(t.TempDir(), "profiles.json")
+	assert.Nil(t, os.WriteFile(path, []byte(`{
+		"source": {
+			"exclude_patterns": ["*.link"],
+			"lstrip_paths": ["src/"],
+			"normalize_line_endings": true,
+			"hash_algorithms": ["sha256", "sha512"]
+		},
+		"default": {}
+	}`), 0644))
+	loaded, err := LoadArtifactProfiles(path)
+	assert.Nil(t, err)
+	assert.Equal(t, profiles, loaded)
+	assert.Equal(t, []string{"sha256"}, loaded["default"].GetHashAlgorithms())
+
+	profile, err := ResolveArtifactProfile(loaded, "source")
+	assert.Nil(t, err)
+	assert.Equal(t, profiles["source"], profile)
+	_, err = ResolveArtifactProfile(loaded, "does-not-exist")
+	assert.ErrorIs(t, err, ErrUnknownArtifactProfile)
+
+	// Profiles defined in a layout
+	mb, err := LoadMetadata("demo.layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	layout := mb.GetPayload().(Layout)
+	layout.ArtifactProfiles = profiles
+	var key Key
+	if err := key.LoadKeyDefaults("alice"); err != nil {
+		t.Fatal(err)
+	}
+	layoutEnv := &Metablock{Signed: layout}
+	assert.Nil(t, layoutEnv.Sign(key))
+	layoutPath := filepath.Join(t.TempDir(), "profiles.layout")
+	assert.Nil(t, layoutEnv.Dump(layoutPath))
+	loaded, err = LoadArtifactProfiles(layoutPath)
+	assert.Nil(t, err)
+	assert.Equal(t, profiles, loaded)
+
+	// Links do not define profiles
+	_, err = LoadArtifactProfiles("write-code.b7d643de.link")
+	assert.ErrorIs(t, err, ErrNotLayout)
+
+	assert.Nil(t, os.WriteFile(path, []byte(`{"weak": {"hash_algorithms": ["md5"]}}`), 0644))
+	_, err = LoadArtifactProfiles(path)
+	assert.ErrorIs(t, err, ErrUnsupportedHashAlgorithm)
+
+	_, err = LoadArtifactProfiles("does-not-exist")
+	assert.NotNil(t, err)
+}
+
+func TestValidateLayoutArtifactProfiles(t *testing.T) {
+	mb, err := LoadMetadata("demo.layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	layout := mb.GetPayload().(Layout)
+	layout.ArtifactProfiles = map[string]ArtifactProfile{"source": {}}
+	layout.Steps[0].ArtifactProfile = "source"
+	layout.Inspect[0].ArtifactProfile = "source"
+	assert.Nil(t, validateLayout(layout))
+
+	layout.Inspect[0].ArtifactProfile = "does-not-exist"
+	assert.ErrorIs(t, validateLayout(layout), ErrUnknownArtifactProfile)
+
+	layout.Inspect[0].ArtifactProfile = ""
+	layout.ArtifactProfiles["source"] = ArtifactProfile{HashAlgorithms: []string{"md5"}}
+	assert.ErrorIs(t, validateLayout(layout), ErrUnsupportedHashAlgorithm)
+}
+
+func TestRunInspectionsWithArtifactProfile(t *testing.T) {
+	mb, err := LoadMetadata("demo.layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	layout := mb.GetPayload().(Layout)
+	layout.ArtifactProfiles = map[string]ArtifactProfile{
+		"tarball": {
+			ExcludePatterns: []string{"*", "!foo.tar.gz"},
+			HashAlgorithms:  []string{"sha256", "sha512"},
+		},
+	}
+	layout.Inspect = []Inspection{
+		{
+			SupplyChainItem: SupplyChainItem{Name: "profiled", ArtifactProfile: "tarball"},
+			Run:             []string{"sh", "-c", "true"},
+		},
+	}
+
+	result, err := RunInspections(layout, "", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("profiled.link")
+
+	// Recorded identically to a step using the same profile
+	expected, err := layout.ArtifactProfiles["tarball"].RecordArtifacts([]string{"."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := result["profiled"].GetPayload().(Link)
+	assert.Equal(t, expected, link.Materials)
+	assert.Equal(t, expected, link.Products)
+	assert.Len(t, link.Products["foo.tar.gz"], 2)
+
+	layout.Inspect[0].ArtifactProfile = "does-not-exist"
+	_, err = RunInspections(layout, "", false, false)
+	assert.ErrorIs(t, err, ErrUnknownArtifactProfile)
+}
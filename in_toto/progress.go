@@ -0,0 +1,136 @@
+package in_toto
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Kinds of a ProgressEvent
+const (
+	ProgressStageStarted   = "stage-started"
+	ProgressStageFinished  = "stage-finished"
+	ProgressArtifactHashed = "artifact-hashed"
+)
+
+/*
+ProgressEvent reports the progress of Run, RecordStart, RecordStop or Verify,
+see ProgressFunc.  Stages are the traced operations, see Tracer, e.g.
+"in_toto.RecordArtifacts" or "in_toto.VerifyArtifacts", and Item is what the
+stage operates on, e.g. the name of the step or inspection verified or run, or
+"materials" or "products" for recorded artifacts.  Stages are reported when
+started and when finished, with their Elapsed time and error, if any.
+
+While artifacts are recorded, each hashed artifact is reported with its Path,
+and the Files hashed so far out of TotalFiles, and the Bytes hashed so far, by
+the current "in_toto.RecordArtifacts" stage.
+*/
+type ProgressEvent struct {
+	Kind       string
+	Stage      string
+	Item       string
+	Elapsed    time.Duration
+	Err        error
+	Path       string
+	Files      int
+	TotalFiles int
+	Bytes      int64
+}
+
+/*
+ProgressFunc is called with the progress of long operations, e.g. to render
+progress bars or per-step timing, see WithProgress and
+WithVerificationProgress.  Calls are serialized, but may come from different
+goroutines, and block the operation, so the function should return quickly.
+*/
+type ProgressFunc func(event ProgressEvent)
+
+// progressKey is the context key of the progressReporter of an operation.
+type progressKey struct{}
+
+// progressReporter serializes the calls of a ProgressFunc.  Its methods do
+// nothing on a nil reporter, i.e. if no progress is reported.
+type progressReporter struct {
+	mu sync.Mutex
+	f  ProgressFunc
+}
+
+// withProgress returns a context, which reports progress to the passed
+// function, or the passed context, if the function is nil.
+func withProgress(ctx context.Context, f ProgressFunc) context.Context {
+	if f == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, progressKey{}, &progressReporter{f: f})
+}
+
+// progressFromContext returns the progressReporter of the passed context, or
+// nil.
+func progressFromContext(ctx context.Context) *progressReporter {
+	p, _ := ctx.Value(progressKey{}).(*progressReporter)
+	return p
+}
+
+func (p *progressReporter) report(event ProgressEvent) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.f(event)
+}
+
+/*
+progressStage is a traced and progress reported operation, see startStage.  It
+replaces the pair of startSpan and endSpan, where progress is of interest.
+*/
+type progressStage struct {
+	span     Span
+	progress *progressReporter
+	name     string
+	item     string
+	start    time.Time
+}
+
+// startStage starts a span of the passed name, and reports the stage with the
+// passed item, if any, as started to the progress reporter of the passed
+// context.
+func startStage(ctx context.Context, name string, item string) (context.Context, *progressStage) {
+	ctx, span := startSpan(ctx, name)
+	s := &progressStage{span: span, progress: progressFromContext(ctx), name: name, item: item, start: time.Now()}
+	s.progress.report(ProgressEvent{Kind: ProgressStageStarted, Stage: name, Item: item})
+	return ctx, s
+}
+
+// end ends the span of the stage with the passed error, if any, and reports
+// the stage as finished.
+func (s *progressStage) end(err error) {
+	endSpan(s.span, err)
+	s.progress.report(ProgressEvent{Kind: ProgressStageFinished, Stage: s.name, Item: s.item,
+		Elapsed: time.Since(s.start), Err: err})
+}
+
+// hashProgress counts the artifacts hashed by hashArtifacts and reports each
+// of them.
+type hashProgress struct {
+	progress *progressReporter
+	mu       sync.Mutex
+	files    int
+	total    int
+	bytes    int64
+}
+
+// hashed reports the artifact at the passed path as hashed, with the passed
+// size.
+func (h *hashProgress) hashed(path string, size int64) {
+	if h.progress == nil {
+		return
+	}
+	// Report while counting, so that counts are reported in order
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.files++
+	h.bytes += size
+	h.progress.report(ProgressEvent{Kind: ProgressArtifactHashed, Stage: "in_toto.RecordArtifacts", Path: path,
+		Files: h.files, TotalFiles: h.total, Bytes: h.bytes})
+}
@@ -0,0 +1,157 @@
+package in_toto
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// progressRecorder records the events reported to its report method.
+type progressRecorder struct {
+	mu     sync.Mutex
+	events []ProgressEvent
+}
+
+func (r *progressRecorder) report(event ProgressEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+// stages returns the finished stages as '<stage> <item>' in order.
+func (r *progressRecorder) stages() []string {
+	var stages []string
+	for _, event := range r.events {
+		if event.Kind == ProgressStageFinished {
+			stages = append(stages, fmt.Sprintf("%s %s", event.Stage, event.Item))
+		}
+	}
+	return stages
+}
+
+func TestRunProgress(t *testing.T) {
+	var key Key
+	if err := key.LoadKey("carol", "ed25519", []string{"sha256", "sha512"}); err != nil {
+		t.Fatal(err)
+	}
+	materials := []string{"alice.pub", "carol.pub", "dan.pub"}
+	var size int64
+	for _, material := range materials {
+		info, err := os.Stat(material)
+		if err != nil {
+			t.Fatal(err)
+		}
+		size += info.Size()
+	}
+
+	recorder := &progressRecorder{}
+	_, err := Run("build", []string{"sh", "-c", "true"}, key, WithMaterials(materials...),
+		WithProducts("foo.tar.gz"), WithProgress(recorder.report))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{
+		"in_toto.RecordArtifacts materials",
+		"in_toto.RunCommand build",
+		"in_toto.RecordArtifacts products",
+		"in_toto.InTotoRun build",
+	}, recorder.stages())
+	assert.Equal(t, ProgressEvent{Kind: ProgressStageStarted, Stage: "in_toto.InTotoRun", Item: "build"}, recorder.events[0])
+
+	// Hashed artifacts are counted in order, per recording stage
+	var hashed []ProgressEvent
+	for _, event := range recorder.events {
+		if event.Kind == ProgressArtifactHashed {
+			hashed = append(hashed, event)
+		}
+	}
+	if assert.Len(t, hashed, 4) {
+		for i, event := range hashed[:3] {
+			assert.Equal(t, i+1, event.Files)
+			assert.Equal(t, 3, event.TotalFiles)
+			assert.Contains(t, materials, event.Path)
+		}
+		assert.Equal(t, size, hashed[2].Bytes)
+		assert.Equal(t, ProgressEvent{Kind: ProgressArtifactHashed, Stage: "in_toto.RecordArtifacts",
+			Path: "foo.tar.gz", Files: 1, TotalFiles: 1, Bytes: hashed[3].Bytes}, hashed[3])
+	}
+
+	// Failed stages are reported with their error
+	recorder = &progressRecorder{}
+	_, err = Run("build", []string{"sh", "-c", "true"}, key, WithMaterials("file-does-not-exist"),
+		WithProgress(recorder.report))
+	assert.NotNil(t, err)
+	last := recorder.events[len(recorder.events)-1]
+	assert.Equal(t, ProgressStageFinished, last.Kind)
+	assert.Equal(t, "in_toto.InTotoRun", last.Stage)
+	assert.Equal(t, err, last.Err)
+
+	recorder = &progressRecorder{}
+	prelimLinkPath, err := RecordStartFile(t.TempDir(), "build", key, WithMaterials(materials...),
+		WithProgress(recorder.report))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"in_toto.RecordArtifacts materials"}, recorder.stages())
+	assert.FileExists(t, prelimLinkPath)
+}
+
+func TestVerifyProgress(t *testing.T) {
+	var layoutKey, key Key
+	if err := layoutKey.LoadKeyDefaults("alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := key.LoadKey("carol", "ed25519", []string{"sha256", "sha512"}); err != nil {
+		t.Fatal(err)
+	}
+	pubKey := key
+	pubKey.KeyVal.Private = ""
+
+	linkDir := t.TempDir()
+	linkEnv, err := Run("build", []string{"sh", "-c", "true"}, key, WithProducts("foo.tar.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := linkEnv.Dump(filepath.Join(linkDir, fmt.Sprintf(LinkNameFormat, "build", key.KeyID))); err != nil {
+		t.Fatal(err)
+	}
+	layoutMb := &Metablock{Signed: Layout{
+		Type:    "layout",
+		Expires: time.Now().Add(time.Hour).UTC().Format(ISO8601DateSchema),
+		Keys:    map[string]Key{pubKey.KeyID: pubKey},
+		Steps: []Step{{
+			Type:            "step",
+			PubKeys:         []string{pubKey.KeyID},
+			ExpectedCommand: []string{"sh", "-c", "true"},
+			Threshold:       1,
+			SupplyChainItem: SupplyChainItem{
+				Name:             "build",
+				ExpectedProducts: [][]string{{"CREATE", "foo.tar.gz"}, {"DISALLOW", "*"}},
+			},
+		}},
+		Inspect: []Inspection{},
+	}}
+	if err := layoutMb.Sign(layoutKey); err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := &progressRecorder{}
+	_, err = Verify(layoutMb, map[string]Key{layoutKey.KeyID: layoutKey}, linkDir,
+		WithVerificationProgress(recorder.report))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{
+		"in_toto.VerifyLayoutSignatures ",
+		"in_toto.LoadLinksForLayout ",
+		"in_toto.VerifyLinkSignatureThesholds ",
+		"in_toto.VerifySublayouts ",
+		"in_toto.VerifyArtifacts build",
+		"in_toto.RunInspections ",
+	}, recorder.stages())
+}
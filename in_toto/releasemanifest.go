@@ -0,0 +1,147 @@
+package in_toto
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ErrNotReleaseManifest is returned when a release manifest is expected, but
+// other metadata is passed.
+var ErrNotReleaseManifest = errors.New("metadata is not a release manifest")
+
+// ErrReleaseProductMismatch indicates that a product does not match its
+// digest in a release manifest, or is not listed in it.
+var ErrReleaseProductMismatch = errors.New("product does not match release manifest")
+
+/*
+ReleaseManifest lists the final products of a supply chain with their digests,
+and references the layout the supply chain was verified with.  Signed as the
+last step of a chain, it gives downstream installers a single small file to
+verify before fetching products, see VerifyReleaseManifest.  Layout is the
+digest of the signed payload of the layout, see MetadataDigest, and LayoutRef
+optionally locates the layout, e.g. by path or URL.
+*/
+type ReleaseManifest struct {
+	Type      string             `json:"_type"`
+	Layout    HashObj            `json:"layout"`
+	LayoutRef string             `json:"layout_ref,omitempty"`
+	Products  map[string]HashObj `json:"products"`
+}
+
+/*
+NewReleaseManifest creates a release manifest for the passed layout and final
+products, e.g. the products of the summary link returned by InTotoVerify.  The
+returned manifest must be signed, e.g. by wrapping it in a Metablock.
+*/
+func NewReleaseManifest(layoutEnv Metadata, layoutRef string, products map[string]HashObj) (*ReleaseManifest, error) {
+	layoutDigest, err := MetadataDigest(layoutEnv)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := layoutEnv.GetPayload().(Layout); !ok {
+		return nil, ErrNotLayout
+	}
+
+	manifest := &ReleaseManifest{
+		Type:      "release-manifest",
+		Layout:    layoutDigest,
+		LayoutRef: layoutRef,
+		Products:  make(map[string]HashObj, len(products)),
+	}
+	for name, digest := range products {
+		manifest.Products[name] = digest
+	}
+	if err := validateReleaseManifest(*manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// validateReleaseManifest checks the type, layout digest and product digests
+// of the passed release manifest.
+func validateReleaseManifest(manifest ReleaseManifest) error {
+	if manifest.Type != "release-manifest" {
+		return fmt.Errorf("invalid Type value for release manifest: should be 'release-manifest'")
+	}
+	if len(manifest.Layout) == 0 {
+		return fmt.Errorf("release manifest has no layout digest")
+	}
+	for algorithm, digest := range manifest.Layout {
+		if err := validateHexString(digest); err != nil {
+			return fmt.Errorf("in release manifest layout, %s hash value: %w", algorithm, err)
+		}
+	}
+	if err := validateArtifacts(manifest.Products); err != nil {
+		return fmt.Errorf("in release manifest products: %w", err)
+	}
+	return nil
+}
+
+/*
+VerifyReleaseManifest verifies that the passed release manifest metadata is
+signed by each of the passed keys.  On success it returns the release
+manifest, whose products can then be checked with VerifyProduct.
+*/
+func VerifyReleaseManifest(manifestEnv Metadata, keys map[string]Key) (*ReleaseManifest, error) {
+	if len(keys) < 1 {
+		return nil, fmt.Errorf("release manifest verification requires at least one key")
+	}
+	for _, key := range keys {
+		if err := manifestEnv.VerifySignature(key); err != nil {
+			return nil, err
+		}
+	}
+
+	manifest, ok := manifestEnv.GetPayload().(ReleaseManifest)
+	if !ok {
+		return nil, ErrNotReleaseManifest
+	}
+	if err := validateReleaseManifest(manifest); err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+/*
+VerifyLayout returns an error if the passed layout is not the layout
+referenced by the release manifest.
+*/
+func (m *ReleaseManifest) VerifyLayout(layoutEnv Metadata) error {
+	digest, err := MetadataDigest(layoutEnv)
+	if err != nil {
+		return err
+	}
+	if !digestsMatch(m.Layout, digest) {
+		return fmt.Errorf("layout does not match release manifest")
+	}
+	return nil
+}
+
+/*
+VerifyProduct returns an ErrReleaseProductMismatch if the product of the
+passed name is not listed in the release manifest, or if the file at the
+passed path does not match its digests.  The file is hashed with the
+algorithms listed for the product.
+*/
+func (m *ReleaseManifest) VerifyProduct(name string, path string) error {
+	expected, ok := m.Products[name]
+	if !ok {
+		return fmt.Errorf("%w: '%s' not listed", ErrReleaseProductMismatch, name)
+	}
+
+	algorithms := make([]string, 0, len(expected))
+	for algorithm := range expected {
+		algorithms = append(algorithms, algorithm)
+	}
+	sort.Strings(algorithms)
+
+	digest, err := RecordArtifact(path, algorithms, false)
+	if err != nil {
+		return err
+	}
+	if !digestsMatch(expected, digest) {
+		return fmt.Errorf("%w: '%s' has unexpected digest", ErrReleaseProductMismatch, name)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package in_toto
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReleaseManifest(t *testing.T) {
+	var key, pubKey, otherKey Key
+	if err := key.LoadKeyDefaults("alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := pubKey.LoadKeyDefaults("alice.pub"); err != nil {
+		t.Fatal(err)
+	}
+	if err := otherKey.LoadKeyDefaults("carol.pub"); err != nil {
+		t.Fatal(err)
+	}
+	layoutEnv, err := LoadMetadata("demo.layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	products, err := RecordArtifacts([]string{"foo.tar.gz"}, []string{"sha256", "sha512"}, nil, nil, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manifest, err := NewReleaseManifest(layoutEnv, "root.layout", products)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Sign, dump and load the release manifest
+	mb := &Metablock{Signed: *manifest}
+	assert.Nil(t, mb.Sign(key))
+	path := filepath.Join(t.TempDir(), "release.json")
+	assert.Nil(t, mb.Dump(path))
+	manifestEnv, err := LoadMetadata(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verified, err := VerifyReleaseManifest(manifestEnv, map[string]Key{pubKey.KeyID: pubKey})
+	if assert.Nil(t, err) {
+		assert.Equal(t, "root.layout", verified.LayoutRef)
+		assert.Nil(t, verified.VerifyLayout(layoutEnv))
+		assert.Nil(t, verified.VerifyProduct("foo.tar.gz", "foo.tar.gz"))
+		assert.ErrorIs(t, verified.VerifyProduct("foo.py", "foo.tar.gz"), ErrReleaseProductMismatch)
+		assert.ErrorIs(t, verified.VerifyProduct("foo.tar.gz", "alice.pub"), ErrReleaseProductMismatch)
+		assert.NotNil(t, verified.VerifyProduct("foo.tar.gz", filepath.Join(t.TempDir(), "missing")))
+
+		superLayout, err := LoadMetadata("super.layout")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.NotNil(t, verified.VerifyLayout(superLayout))
+	}
+
+	_, err = VerifyReleaseManifest(manifestEnv, map[string]Key{})
+	assert.NotNil(t, err)
+	_, err = VerifyReleaseManifest(manifestEnv, map[string]Key{otherKey.KeyID: otherKey})
+	assert.NotNil(t, err)
+
+	linkEnv, err := LoadMetadata("write-code.b7d643de.link")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewReleaseManifest(linkEnv, "", products)
+	assert.ErrorIs(t, err, ErrNotLayout)
+
+	linkMb := &Metablock{Signed: linkEnv.GetPayload()}
+	assert.Nil(t, linkMb.Sign(key))
+	_, err = VerifyReleaseManifest(linkMb, map[string]Key{pubKey.KeyID: pubKey})
+	assert.ErrorIs(t, err, ErrNotReleaseManifest)
+
+	invalid := *manifest
+	invalid.Products = map[string]HashObj{"foo": {"sha256": "not hex"}}
+	mb = &Metablock{Signed: invalid}
+	assert.Nil(t, mb.Sign(key))
+	_, err = VerifyReleaseManifest(mb, map[string]Key{pubKey.KeyID: pubKey})
+	assert.NotNil(t, err)
+}
+
+func TestReleaseManifestProductDigest(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "product")
+	if err := os.WriteFile(path, []byte("product"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	digest, err := RecordArtifact(path, []string{"sha256"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manifest := &ReleaseManifest{Products: map[string]HashObj{"product": digest}}
+	assert.Nil(t, manifest.VerifyProduct("product", path))
+
+	if err := os.WriteFile(path, []byte("tampered"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	assert.ErrorIs(t, manifest.VerifyProduct("product", path), ErrReleaseProductMismatch)
+}
@@ -0,0 +1,393 @@
+package in_toto
+
+import (
+	"encoding/json"
+	"errors"
+	"html/template"
+	"io"
+	"time"
+)
+
+const (
+	// ReportStatusPassed marks a supply chain item that was verified.
+	ReportStatusPassed = "passed"
+	// ReportStatusFailed marks a supply chain item that failed verification.
+	ReportStatusFailed = "failed"
+	// ReportStatusUnknown marks a supply chain item whose verification status
+	// could not be determined, e.g. because verification aborted early.
+	ReportStatusUnknown = "unknown"
+)
+
+// reportRuleVerificationFailure is the generic rule ID used for verification
+// failures that cannot be attributed to a more specific category.
+const reportRuleVerificationFailure = "in-toto/verification-failure"
+
+// reportRuleMissingEvidence is the rule ID of failures of steps that lack link
+// metadata, see MissingEvidenceError.
+const reportRuleMissingEvidence = "in-toto/missing-evidence"
+
+// reportRuleViolation, reportRuleInvalidSignature and reportRuleLayoutExpired
+// are the rule IDs of failures due to a RuleViolationError, an
+// ErrInvalidSignature and an ErrLayoutExpired respectively.
+const (
+	reportRuleViolation        = "in-toto/rule-violation"
+	reportRuleInvalidSignature = "in-toto/invalid-signature"
+	reportRuleLayoutExpired    = "in-toto/layout-expired"
+)
+
+// reportRuleDescriptions maps rule IDs of verification failures to a short
+// human readable description, used e.g. for SARIF rule metadata.
+var reportRuleDescriptions = map[string]string{
+	reportRuleVerificationFailure: "Supply chain verification failed",
+	reportRuleMissingEvidence:     "Step lacks link metadata",
+	reportRuleViolation:           "Artifacts violate an artifact rule",
+	reportRuleInvalidSignature:    "Metadata has an invalid signature",
+	reportRuleLayoutExpired:       "Layout has expired",
+}
+
+// classifyVerificationError returns the rule ID of the passed verification
+// error, and the step or inspection it is attributed to, if any.
+func classifyVerificationError(err error) (string, string) {
+	var ruleErr *RuleViolationError
+	switch {
+	case errors.As(err, &ruleErr):
+		return reportRuleViolation, ruleErr.Step
+	case errors.Is(err, ErrInvalidSignature):
+		return reportRuleInvalidSignature, ""
+	case errors.Is(err, ErrLayoutExpired):
+		return reportRuleLayoutExpired, ""
+	}
+	return reportRuleVerificationFailure, ""
+}
+
+/*
+VerificationFailure describes a single reason why supply chain verification
+failed.  Item is the name of the step or inspection the failure is attributed
+to, if any, and RuleID identifies the category of the failure.  Pointer is
+the JSON pointer of the offending part of the layout, if known, see
+PointerError.
+*/
+type VerificationFailure struct {
+	Item    string `json:"item,omitempty"`
+	RuleID  string `json:"rule_id"`
+	Message string `json:"message"`
+	Pointer string `json:"pointer,omitempty"`
+}
+
+/*
+MissingEvidence describes a step of the layout, for which fewer link metadata
+files than required by its threshold were found, see MissingEvidenceError.
+*/
+type MissingEvidence struct {
+	Step      string `json:"step"`
+	Threshold int    `json:"threshold"`
+	Found     int    `json:"found"`
+}
+
+/*
+ItemReport holds the verification status of a single step or inspection of a
+layout.  Type is either "step" or "inspection".  Reused is set, if the status
+was taken over from a previous verification, see MarkReused.
+*/
+type ItemReport struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Status string `json:"status"`
+	Reused bool   `json:"reused,omitempty"`
+}
+
+/*
+VerificationReport is a structured summary of a supply chain verification.
+It can be rendered as JSON, as an HTML summary page via RenderHTML or as a
+SARIF log via RenderSARIF.  Layout identifies the verified layout, e.g. its
+file path, and is used as artifact location of failures in SARIF output.
+ArtifactMatching is the artifact matching mode of the layout, see
+Layout.GetArtifactMatching.  MissingEvidence lists all steps that lack link
+metadata, if verification failed for that reason.  ClockSkewTolerance records
+the clock skew tolerance applied during verification, e.g. "5m0s", if any, see
+WithClockSkewTolerance, and must be set by the caller.
+*/
+type VerificationReport struct {
+	Layout             string                `json:"layout"`
+	Time               string                `json:"time"`
+	Passed             bool                  `json:"passed"`
+	ArtifactMatching   string                `json:"artifact_matching,omitempty"`
+	ClockSkewTolerance string                `json:"clock_skew_tolerance,omitempty"`
+	Items              []ItemReport          `json:"items"`
+	Failures           []VerificationFailure `json:"failures,omitempty"`
+	MissingEvidence    []MissingEvidence     `json:"missing_evidence,omitempty"`
+}
+
+/*
+NewVerificationReport creates a VerificationReport for the layout in the
+passed metadata and the error returned by verification, e.g. by InTotoVerify.
+A nil error results in a passed report, where all steps and inspections of the
+layout are marked as passed.  Otherwise the report lists the error as failure,
+and all items whose status cannot be told from the error are marked unknown.
+If the error is a MissingEvidenceError, each step that lacks link metadata is
+listed as missing evidence and failure, and marked failed.  Other failures are
+categorized by their error, e.g. a RuleViolationError marks the violating step
+or inspection failed.
+*/
+func NewVerificationReport(layoutURI string, layoutEnv Metadata, verifyErr error) *VerificationReport {
+	report := &VerificationReport{
+		Layout: layoutURI,
+		Time:   time.Now().UTC().Format(ISO8601DateSchema),
+		Passed: verifyErr == nil,
+		Items:  []ItemReport{},
+	}
+
+	var missingErr *MissingEvidenceError
+	failed := map[string]bool{}
+	if errors.As(verifyErr, &missingErr) {
+		for _, step := range missingErr.Steps {
+			report.MissingEvidence = append(report.MissingEvidence, MissingEvidence{
+				Step:      step.StepName,
+				Threshold: step.Threshold,
+				Found:     step.Available,
+			})
+			report.Failures = append(report.Failures, VerificationFailure{
+				Item:    step.StepName,
+				RuleID:  reportRuleMissingEvidence,
+				Message: step.Error(),
+			})
+			failed[step.StepName] = true
+		}
+	} else if verifyErr != nil {
+		ruleID, item := classifyVerificationError(verifyErr)
+		report.Failures = append(report.Failures, VerificationFailure{
+			Item:    item,
+			RuleID:  ruleID,
+			Message: verifyErr.Error(),
+			Pointer: ErrorPointer(verifyErr),
+		})
+		if item != "" {
+			failed[item] = true
+		}
+	}
+
+	var layout Layout
+	if layoutEnv != nil {
+		var ok bool
+		if layout, ok = layoutEnv.GetPayload().(Layout); ok {
+			report.ArtifactMatching = layout.GetArtifactMatching()
+		}
+	}
+
+	status := ReportStatusPassed
+	if verifyErr != nil {
+		status = ReportStatusUnknown
+	}
+	for _, step := range layout.Steps {
+		stepStatus := status
+		if failed[step.Name] {
+			stepStatus = ReportStatusFailed
+		}
+		report.Items = append(report.Items, ItemReport{Name: step.Name, Type: "step", Status: stepStatus})
+	}
+	for _, inspection := range layout.Inspect {
+		inspectionStatus := status
+		if failed[inspection.Name] {
+			inspectionStatus = ReportStatusFailed
+		}
+		report.Items = append(report.Items, ItemReport{Name: inspection.Name, Type: "inspection", Status: inspectionStatus})
+	}
+
+	return report
+}
+
+/*
+MarkReused marks the items of the report, whose verification was reused from
+a previous verification, according to the passed evidence of a differential
+verification, see WithPreviousEvidence.
+*/
+func (r *VerificationReport) MarkReused(evidence *VerificationEvidence) {
+	reused := NewSet(evidence.ReusedItems()...)
+	for i := range r.Items {
+		r.Items[i].Reused = reused.Has(r.Items[i].Name)
+	}
+}
+
+var reportHTMLTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>in-toto verification report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.8em; text-align: left; }
+.passed { color: #1a7f37; }
+.failed { color: #cf222e; }
+.unknown { color: #6e7781; }
+</style>
+</head>
+<body>
+<h1>in-toto verification report</h1>
+<p>Layout: <code>{{.Layout}}</code></p>
+<p>Time: {{.Time}}</p>
+{{if .ArtifactMatching}}<p>Artifact matching: {{.ArtifactMatching}}</p>
+{{end}}{{if .ClockSkewTolerance}}<p>Clock skew tolerance: {{.ClockSkewTolerance}}</p>
+{{end}}{{if .Passed}}<p class="passed"><strong>Verification passed</strong></p>{{else}}<p class="failed"><strong>Verification failed</strong></p>{{end}}
+<h2>Supply chain items</h2>
+<table>
+<tr><th>Name</th><th>Type</th><th>Status</th></tr>
+{{range .Items}}<tr><td>{{.Name}}</td><td>{{.Type}}</td><td class="{{.Status}}">{{.Status}}{{if .Reused}} (reused){{end}}</td></tr>
+{{end}}</table>
+{{if .MissingEvidence}}<h2>Missing evidence</h2>
+<table>
+<tr><th>Step</th><th>Required links</th><th>Found links</th></tr>
+{{range .MissingEvidence}}<tr><td>{{.Step}}</td><td>{{.Threshold}}</td><td>{{.Found}}</td></tr>
+{{end}}</table>
+{{end}}{{if .Failures}}<h2>Failures</h2>
+<table>
+<tr><th>Item</th><th>Rule</th><th>Location</th><th>Message</th></tr>
+{{range .Failures}}<tr><td>{{.Item}}</td><td>{{.RuleID}}</td><td>{{if .Pointer}}<code>{{.Pointer}}</code>{{end}}</td><td><pre>{{.Message}}</pre></td></tr>
+{{end}}</table>
+{{end}}</body>
+</html>
+`))
+
+/*
+RenderHTML writes a self-contained HTML summary page of the report on which it
+was called to the passed writer.
+*/
+func (r *VerificationReport) RenderHTML(w io.Writer) error {
+	return reportHTMLTemplate.Execute(w, r)
+}
+
+// The following types model the subset of the SARIF 2.1.0 format that is
+// needed to report verification failures, see
+// https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool       sarifTool         `json:"tool"`
+	Results    []sarifResult     `json:"results"`
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifResult struct {
+	RuleID     string            `json:"ruleId"`
+	Level      string            `json:"level"`
+	Message    sarifMessage      `json:"message"`
+	Locations  []sarifLocation   `json:"locations"`
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation  `json:"physicalLocation"`
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations,omitempty"`
+}
+
+// sarifLogicalLocation locates a failure within the layout by JSON pointer.
+type sarifLogicalLocation struct {
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+	Kind               string `json:"kind"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+// reportRuleDescription returns the description of the passed rule ID or the
+// ID itself, if there is no description.
+func reportRuleDescription(ruleID string) string {
+	if description, ok := reportRuleDescriptions[ruleID]; ok {
+		return description
+	}
+	return ruleID
+}
+
+/*
+RenderSARIF writes the report on which it was called as SARIF 2.1.0 log to the
+passed writer.  Each failure becomes an error level result located at the
+report's layout, so that failures show up in code scanning tools that consume
+SARIF.
+*/
+func (r *VerificationReport) RenderSARIF(w io.Writer) error {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "in-toto-golang",
+			InformationURI: "https://github.com/in-toto/in-toto-golang",
+			Rules:          []sarifRule{},
+		}},
+		Results: []sarifResult{},
+	}
+	if r.ArtifactMatching != "" || r.ClockSkewTolerance != "" {
+		run.Properties = map[string]string{}
+		if r.ArtifactMatching != "" {
+			run.Properties["artifact_matching"] = r.ArtifactMatching
+		}
+		if r.ClockSkewTolerance != "" {
+			run.Properties["clock_skew_tolerance"] = r.ClockSkewTolerance
+		}
+	}
+
+	seenRules := NewSet()
+	for _, failure := range r.Failures {
+		if !seenRules.Has(failure.RuleID) {
+			seenRules.Add(failure.RuleID)
+			run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{
+				ID:               failure.RuleID,
+				ShortDescription: sarifMessage{Text: reportRuleDescription(failure.RuleID)},
+			})
+		}
+
+		result := sarifResult{
+			RuleID:  failure.RuleID,
+			Level:   "error",
+			Message: sarifMessage{Text: failure.Message},
+			Locations: []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: r.Layout},
+			}}},
+		}
+		if failure.Pointer != "" {
+			result.Locations[0].LogicalLocations = []sarifLogicalLocation{{
+				FullyQualifiedName: failure.Pointer,
+				Kind:               "element",
+			}}
+		}
+		if failure.Item != "" {
+			result.Properties = map[string]string{"item": failure.Item}
+		}
+		run.Results = append(run.Results, result)
+	}
+
+	log := sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(log)
+}
@@ -0,0 +1,194 @@
+package in_toto
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewVerificationReport(t *testing.T) {
+	layoutEnv := &Metablock{Signed: Layout{
+		Type: "layout",
+		Steps: []Step{
+			{SupplyChainItem: SupplyChainItem{Name: "build"}},
+		},
+		Inspect: []Inspection{
+			{SupplyChainItem: SupplyChainItem{Name: "untar"}},
+		},
+	}}
+
+	report := NewVerificationReport("root.layout", layoutEnv, nil)
+	assert.True(t, report.Passed)
+	assert.Empty(t, report.Failures)
+	assert.Equal(t, ArtifactMatchingCaseSensitive, report.ArtifactMatching)
+	assert.Equal(t, []ItemReport{
+		{Name: "build", Type: "step", Status: ReportStatusPassed},
+		{Name: "untar", Type: "inspection", Status: ReportStatusPassed},
+	}, report.Items)
+
+	report = NewVerificationReport("root.layout", layoutEnv, errors.New("layout has expired"))
+	assert.False(t, report.Passed)
+	assert.Len(t, report.Failures, 1)
+	assert.Equal(t, "layout has expired", report.Failures[0].Message)
+	assert.Equal(t, ReportStatusUnknown, report.Items[0].Status)
+
+	layoutEnv.Signed = Layout{Type: "layout", ArtifactMatching: ArtifactMatchingCaseInsensitive}
+	report = NewVerificationReport("root.layout", layoutEnv, nil)
+	assert.Equal(t, ArtifactMatchingCaseInsensitive, report.ArtifactMatching)
+
+	// No mode without a layout
+	report = NewVerificationReport("root.layout", nil, errors.New("failed to load layout"))
+	assert.Empty(t, report.ArtifactMatching)
+}
+
+func TestVerificationReportMissingEvidence(t *testing.T) {
+	layoutEnv := &Metablock{Signed: Layout{Type: "layout", Steps: []Step{
+		{SupplyChainItem: SupplyChainItem{Name: "build"}},
+		{SupplyChainItem: SupplyChainItem{Name: "test"}},
+		{SupplyChainItem: SupplyChainItem{Name: "package"}},
+	}}}
+	verifyErr := &MissingEvidenceError{Steps: []*ThresholdError{
+		{StepName: "build", Threshold: 2, Available: 1, Verified: 1},
+		{StepName: "package", Threshold: 1},
+	}}
+
+	report := NewVerificationReport("root.layout", layoutEnv, verifyErr)
+	assert.False(t, report.Passed)
+	assert.Equal(t, []MissingEvidence{
+		{Step: "build", Threshold: 2, Found: 1},
+		{Step: "package", Threshold: 1, Found: 0},
+	}, report.MissingEvidence)
+	assert.Equal(t, []VerificationFailure{
+		{Item: "build", RuleID: reportRuleMissingEvidence,
+			Message: "step 'build' requires '2' link metadata file(s), found '1'"},
+		{Item: "package", RuleID: reportRuleMissingEvidence,
+			Message: "step 'package' requires '1' link metadata file(s), found '0'"},
+	}, report.Failures)
+	assert.Equal(t, []ItemReport{
+		{Name: "build", Type: "step", Status: ReportStatusFailed},
+		{Name: "test", Type: "step", Status: ReportStatusUnknown},
+		{Name: "package", Type: "step", Status: ReportStatusFailed},
+	}, report.Items)
+
+	var buf bytes.Buffer
+	if err := report.RenderHTML(&buf); err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, buf.String(), "<h2>Missing evidence</h2>")
+	assert.Contains(t, buf.String(), "<tr><td>build</td><td>2</td><td>1</td></tr>")
+}
+
+func TestVerificationReportClassifiesFailures(t *testing.T) {
+	layoutEnv := &Metablock{Signed: Layout{Type: "layout",
+		Steps:   []Step{{SupplyChainItem: SupplyChainItem{Name: "build"}}},
+		Inspect: []Inspection{{SupplyChainItem: SupplyChainItem{Name: "untar"}}},
+	}}
+
+	ruleErr := atPointer(&RuleViolationError{Step: "untar", ItemType: "Inspection",
+		ArtifactType: "products", Rule: []string{"DISALLOW", "*"}, Artifacts: []string{"foo"}},
+		[]interface{}{"inspect", 0, "expected_products", 0}, "")
+	report := NewVerificationReport("root.layout", layoutEnv, ruleErr)
+	assert.Equal(t, []VerificationFailure{{Item: "untar", RuleID: reportRuleViolation,
+		Message: ruleErr.Error(), Pointer: "/inspect/0/expected_products/0"}}, report.Failures)
+	assert.Equal(t, []ItemReport{
+		{Name: "build", Type: "step", Status: ReportStatusUnknown},
+		{Name: "untar", Type: "inspection", Status: ReportStatusFailed},
+	}, report.Items)
+
+	report = NewVerificationReport("root.layout", layoutEnv, fmt.Errorf("%w: bad", ErrInvalidSignature))
+	assert.Equal(t, reportRuleInvalidSignature, report.Failures[0].RuleID)
+	report = NewVerificationReport("root.layout", layoutEnv, fmt.Errorf("%w on today", ErrLayoutExpired))
+	assert.Equal(t, reportRuleLayoutExpired, report.Failures[0].RuleID)
+}
+
+func TestVerificationReportRenderHTML(t *testing.T) {
+	layoutEnv := &Metablock{Signed: Layout{Type: "layout", Steps: []Step{
+		{SupplyChainItem: SupplyChainItem{Name: "build"}},
+	}}}
+	report := NewVerificationReport("root.layout", layoutEnv, errors.New("<script>alert(1)</script>"))
+
+	var buf bytes.Buffer
+	if err := report.RenderHTML(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	assert.Contains(t, out, "Verification failed")
+	assert.Contains(t, out, "<td>build</td>")
+	assert.Contains(t, out, "Artifact matching: case-sensitive")
+	assert.NotContains(t, out, "Clock skew tolerance")
+	// Failure messages must be escaped
+	assert.False(t, strings.Contains(out, "<script>"))
+}
+
+func TestVerificationReportRenderSARIF(t *testing.T) {
+	report := NewVerificationReport("root.layout", nil, errors.New("step 'build' requires '1' link metadata file(s), found '0'"))
+	report.Failures = append(report.Failures, VerificationFailure{
+		Item:    "build",
+		RuleID:  reportRuleVerificationFailure,
+		Message: "another failure",
+	})
+
+	var buf bytes.Buffer
+	if err := report.RenderSARIF(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var log sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "2.1.0", log.Version)
+	assert.Len(t, log.Runs, 1)
+	assert.Len(t, log.Runs[0].Results, 2)
+	// Rules are de-duplicated
+	assert.Len(t, log.Runs[0].Tool.Driver.Rules, 1)
+	assert.Equal(t, "root.layout", log.Runs[0].Results[0].Locations[0].PhysicalLocation.ArtifactLocation.URI)
+	assert.Equal(t, "build", log.Runs[0].Results[1].Properties["item"])
+	assert.Empty(t, log.Runs[0].Properties)
+	assert.Empty(t, log.Runs[0].Results[0].Locations[0].LogicalLocations)
+
+	// Failures located by JSON pointer have a logical location
+	report = NewVerificationReport("root.layout", nil, &PointerError{Pointer: "/signed/steps/0/expected_products/1", Err: errors.New("disallowed")})
+	assert.Equal(t, "/signed/steps/0/expected_products/1", report.Failures[0].Pointer)
+	buf.Reset()
+	if err := report.RenderSARIF(&buf); err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, json.Unmarshal(buf.Bytes(), &log))
+	assert.Equal(t, []sarifLogicalLocation{{FullyQualifiedName: "/signed/steps/0/expected_products/1", Kind: "element"}},
+		log.Runs[0].Results[0].Locations[0].LogicalLocations)
+
+	report.ArtifactMatching = ArtifactMatchingCaseInsensitive
+	buf.Reset()
+	if err := report.RenderSARIF(&buf); err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, json.Unmarshal(buf.Bytes(), &log))
+	assert.Equal(t, ArtifactMatchingCaseInsensitive, log.Runs[0].Properties["artifact_matching"])
+
+	// The applied clock skew tolerance is recorded
+	report.ClockSkewTolerance = (5 * time.Minute).String()
+	buf.Reset()
+	if err := report.RenderSARIF(&buf); err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, json.Unmarshal(buf.Bytes(), &log))
+	assert.Equal(t, "5m0s", log.Runs[0].Properties["clock_skew_tolerance"])
+	buf.Reset()
+	if err := report.RenderHTML(&buf); err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, buf.String(), "Clock skew tolerance: 5m0s")
+
+	buf.Reset()
+	if err := NewVerificationReport("root.layout", nil, nil).RenderSARIF(&buf); err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, buf.String(), `"results": []`)
+}
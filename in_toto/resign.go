@@ -0,0 +1,89 @@
+package in_toto
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrUnverifiedSignature is returned by VerifyExistingSignatures if a
+// signature of the metadata does not verify with any of the passed keys.
+var ErrUnverifiedSignature = errors.New("unverified signature")
+
+/*
+VerifyExistingSignatures verifies that every signature of the passed metadata
+was created by one of the passed keys, e.g. before another signature is added
+to the metadata, see Resign.  For GPG keys, signatures may be created by a
+subkey.  Metadata without signatures verifies.  If a signature does not verify,
+an ErrUnverifiedSignature is returned naming the key ids of all such
+signatures.
+*/
+func VerifyExistingSignatures(metadata Metadata, keys map[string]Key) error {
+	var unverified []string
+	for _, sig := range metadata.Sigs() {
+		verified := false
+		for _, key := range keys {
+			if keyHasID(key, sig.KeyID) && metadata.VerifySignature(key) == nil {
+				verified = true
+				break
+			}
+		}
+		if !verified {
+			unverified = append(unverified, sig.KeyID)
+		}
+	}
+	if len(unverified) > 0 {
+		return fmt.Errorf("%w: by key(s) '%s'", ErrUnverifiedSignature, strings.Join(unverified, "', '"))
+	}
+	return nil
+}
+
+// ClearSignatures removes all signatures of the passed Metablock or
+// Envelope.
+func ClearSignatures(metadata Metadata) error {
+	return removeSignatures(metadata, func(string) bool { return true })
+}
+
+// removeSignatures removes the signatures of the passed Metablock or Envelope
+// for whose key id remove returns true.
+func removeSignatures(metadata Metadata, remove func(keyID string) bool) error {
+	switch m := metadata.(type) {
+	case *Metablock:
+		sigs := []Signature{}
+		for _, sig := range m.Signatures {
+			if !remove(sig.KeyID) {
+				sigs = append(sigs, sig)
+			}
+		}
+		m.Signatures = sigs
+	case *Envelope:
+		sigs := m.envelope.Signatures[:0]
+		for _, sig := range m.envelope.Signatures {
+			if !remove(sig.KeyID) {
+				sigs = append(sigs, sig)
+			}
+		}
+		m.envelope.Signatures = sigs
+	default:
+		return ErrUnknownMetadataType
+	}
+	return nil
+}
+
+/*
+Resign signs the passed Metablock or Envelope with the passed key.  If replace
+is true, all existing signatures are removed first, e.g. to rotate the key of
+a layout, otherwise the signature is appended.  An existing signature of the
+same key is always replaced, so that re-signing does not duplicate
+signatures.  Existing signatures are not verified, see
+VerifyExistingSignatures.
+*/
+func Resign(metadata Metadata, key Key, replace bool) error {
+	err := removeSignatures(metadata, func(keyID string) bool {
+		return replace || keyID == key.KeyID
+	})
+	if err != nil {
+		return err
+	}
+	return metadata.Sign(key)
+}
@@ -0,0 +1,68 @@
+package in_toto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResign(t *testing.T) {
+	var alicePub, dan, danPub Key
+	if err := alicePub.LoadKeyDefaults("alice.pub"); err != nil {
+		t.Fatal(err)
+	}
+	if err := dan.LoadKeyDefaults("dan"); err != nil {
+		t.Fatal(err)
+	}
+	if err := danPub.LoadKeyDefaults("dan.pub"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"demo.layout", "demo.dsse.layout"} {
+		t.Run(path, func(t *testing.T) {
+			layoutEnv, err := LoadMetadata(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Nil(t, VerifyExistingSignatures(layoutEnv, map[string]Key{alicePub.KeyID: alicePub}))
+			assert.ErrorIs(t, VerifyExistingSignatures(layoutEnv, map[string]Key{danPub.KeyID: danPub}),
+				ErrUnverifiedSignature)
+
+			// Appending a signature, and re-signing does not duplicate it
+			for i := 0; i < 2; i++ {
+				if err := Resign(layoutEnv, dan, false); err != nil {
+					t.Fatal(err)
+				}
+				assert.Len(t, layoutEnv.Sigs(), 2)
+			}
+			assert.Nil(t, VerifyExistingSignatures(layoutEnv,
+				map[string]Key{alicePub.KeyID: alicePub, danPub.KeyID: danPub}))
+
+			// Replacing signatures, e.g. to rotate the layout key
+			if err := Resign(layoutEnv, dan, true); err != nil {
+				t.Fatal(err)
+			}
+			if assert.Len(t, layoutEnv.Sigs(), 1) {
+				assert.Equal(t, dan.KeyID, layoutEnv.Sigs()[0].KeyID)
+			}
+			assert.Nil(t, layoutEnv.VerifySignature(danPub))
+
+			assert.Nil(t, ClearSignatures(layoutEnv))
+			assert.Len(t, layoutEnv.Sigs(), 0)
+			assert.Nil(t, VerifyExistingSignatures(layoutEnv, nil))
+
+			_, err = LinkFilename(layoutEnv, dan)
+			assert.ErrorIs(t, err, ErrNotLink)
+		})
+	}
+
+	linkEnv, err := LoadMetadata("package.d3ffd108.link")
+	if err != nil {
+		t.Fatal(err)
+	}
+	linkName, err := LinkFilename(linkEnv, dan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "package."+dan.KeyID[:8]+".link", linkName)
+}
@@ -0,0 +1,182 @@
+package in_toto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrInvalidRetentionPolicy is returned when links are pruned with a
+// malformed RetentionPolicy.
+var ErrInvalidRetentionPolicy = errors.New("invalid retention policy")
+
+/*
+StoredLink is a link of a PrunableLinkStore.  Ref identifies the link in the
+store, e.g. the path of a file or the key of an object, and Stored is the time
+the link was stored, which orders the runs of a step.
+*/
+type StoredLink struct {
+	Ref      string
+	Metadata Metadata
+	Stored   time.Time
+}
+
+/*
+PrunableLinkStore is optionally implemented by a LinkStore, whose links can be
+listed and deleted, e.g. a metadata directory or bucket, so that links can be
+pruned according to a RetentionPolicy, see PruneLinks.  ListLinks returns all
+links of the store, DeleteLink deletes the link of the passed reference.
+*/
+type PrunableLinkStore interface {
+	LinkStore
+	ListLinks(ctx context.Context) ([]StoredLink, error)
+	DeleteLink(ctx context.Context, ref string) error
+}
+
+/*
+RetentionPolicy decides which links of a long-lived metadata store are kept,
+see PruneLinks.  KeepLast is the number of most recent runs kept of each step
+by each functionary, i.e. of links with the same name and signers, where zero
+keeps all runs.  Links whose digest is in Keep are always kept, e.g. the links
+a release was verified with, see VerificationEvidence.LinkDigests.  Metadata
+other than links, e.g. sublayouts, is always kept.
+*/
+type RetentionPolicy struct {
+	KeepLast int
+	Keep     []HashObj
+}
+
+/*
+Prunable returns the passed links, which the retention policy does not keep,
+ordered by reference, e.g. to report what PruneLinks would delete.
+*/
+func (p RetentionPolicy) Prunable(links []StoredLink) ([]StoredLink, error) {
+	if p.KeepLast < 0 {
+		return nil, fmt.Errorf("%w: negative number of runs to keep '%d'", ErrInvalidRetentionPolicy, p.KeepLast)
+	}
+
+	// Runs of a step by the same functionaries, newest first
+	runs := map[string][]StoredLink{}
+	for _, link := range links {
+		payload, ok := link.Metadata.GetPayload().(Link)
+		if !ok {
+			continue
+		}
+		keyIDs := make([]string, 0, len(link.Metadata.Sigs()))
+		for _, sig := range link.Metadata.Sigs() {
+			keyIDs = append(keyIDs, sig.KeyID)
+		}
+		sort.Strings(keyIDs)
+		run := payload.Name + "\x00" + strings.Join(keyIDs, ",")
+		runs[run] = append(runs[run], link)
+	}
+
+	var prunable []StoredLink
+	for _, stepRuns := range runs {
+		sort.SliceStable(stepRuns, func(i, j int) bool {
+			return stepRuns[i].Stored.After(stepRuns[j].Stored)
+		})
+		for i, link := range stepRuns {
+			if p.KeepLast == 0 || i < p.KeepLast {
+				continue
+			}
+			keep, err := p.keeps(link.Metadata)
+			if err != nil {
+				return nil, fmt.Errorf("link '%s': %w", link.Ref, err)
+			}
+			if !keep {
+				prunable = append(prunable, link)
+			}
+		}
+	}
+	sort.Slice(prunable, func(i, j int) bool { return prunable[i].Ref < prunable[j].Ref })
+	return prunable, nil
+}
+
+// keeps reports whether the digest of the passed link is kept by the
+// retention policy.
+func (p RetentionPolicy) keeps(linkEnv Metadata) (bool, error) {
+	if len(p.Keep) == 0 {
+		return false, nil
+	}
+	digest, err := MetadataDigest(linkEnv)
+	if err != nil {
+		return false, err
+	}
+	for _, keep := range p.Keep {
+		if digestsMatch(keep, digest) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+/*
+PruneLinks deletes the links of the passed store, which the passed retention
+policy does not keep, see RetentionPolicy.Prunable, and returns the deleted
+links.  If deleting a link fails, the links deleted so far are returned with
+the error.
+*/
+func PruneLinks(ctx context.Context, store PrunableLinkStore, policy RetentionPolicy) ([]StoredLink, error) {
+	links, err := store.ListLinks(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list links: %w", err)
+	}
+	prunable, err := policy.Prunable(links)
+	if err != nil {
+		return nil, err
+	}
+	var pruned []StoredLink
+	for _, link := range prunable {
+		if err := ctx.Err(); err != nil {
+			return pruned, err
+		}
+		if err := store.DeleteLink(ctx, link.Ref); err != nil {
+			return pruned, fmt.Errorf("failed to delete link '%s': %w", link.Ref, err)
+		}
+		pruned = append(pruned, link)
+	}
+	return pruned, nil
+}
+
+/*
+ListLinks returns the links in the directory of the store, i.e. all files
+with ".link" suffix, referenced by path and stored at their modification
+time.  Files that cannot be loaded are skipped, like by GetLinksForStep.
+*/
+func (s *FileLinkStore) ListLinks(ctx context.Context) ([]StoredLink, error) {
+	paths, err := filepath.Glob(filepath.Join(s.Dir, "*.link"))
+	if err != nil {
+		return nil, err
+	}
+	links := []StoredLink{}
+	for _, path := range paths {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		linkEnv, err := LoadMetadata(path)
+		if err != nil {
+			continue
+		}
+		links = append(links, StoredLink{Ref: path, Metadata: linkEnv, Stored: info.ModTime()})
+	}
+	return links, nil
+}
+
+// DeleteLink removes the link file at the passed path, which must be in the
+// directory of the store.
+func (s *FileLinkStore) DeleteLink(ctx context.Context, ref string) error {
+	if filepath.Dir(filepath.Clean(ref)) != filepath.Clean(s.Dir) || filepath.Ext(ref) != ".link" {
+		return fmt.Errorf("link '%s' is not in '%s'", ref, s.Dir)
+	}
+	return os.Remove(ref)
+}
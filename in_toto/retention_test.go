@@ -0,0 +1,174 @@
+package in_toto
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryLinkStore is a PrunableLinkStore, which holds links in memory.
+type memoryLinkStore struct {
+	links map[string]StoredLink
+}
+
+func (s *memoryLinkStore) GetLinksForStep(ctx context.Context, stepName string) ([]Metadata, error) {
+	var links []Metadata
+	for _, link := range s.links {
+		if link.Metadata.GetPayload().(Link).Name == stepName {
+			links = append(links, link.Metadata)
+		}
+	}
+	return links, nil
+}
+
+func (s *memoryLinkStore) ListLinks(ctx context.Context) ([]StoredLink, error) {
+	var links []StoredLink
+	for _, link := range s.links {
+		links = append(links, link)
+	}
+	return links, nil
+}
+
+func (s *memoryLinkStore) DeleteLink(ctx context.Context, ref string) error {
+	delete(s.links, ref)
+	return nil
+}
+
+func TestPruneLinks(t *testing.T) {
+	var alice, carol Key
+	if err := alice.LoadKeyDefaults("alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := carol.LoadKeyDefaults("carol"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Four runs of build by alice and carol each, and a test run by alice
+	store := &memoryLinkStore{links: map[string]StoredLink{}}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	addLink := func(ref string, name string, run int, key Key) Metadata {
+		link := Link{Type: "link", Name: name, Command: []string{"make", ref}}
+		linkEnv := &Metablock{Signed: link}
+		if err := linkEnv.Sign(key); err != nil {
+			t.Fatal(err)
+		}
+		store.links[ref] = StoredLink{Ref: ref, Metadata: linkEnv, Stored: start.Add(time.Duration(run) * time.Hour)}
+		return linkEnv
+	}
+	var released Metadata
+	for run := 0; run < 4; run++ {
+		linkEnv := addLink(fmt.Sprintf("build-alice-%d", run), "build", run, alice)
+		if run == 0 {
+			released = linkEnv
+		}
+		addLink(fmt.Sprintf("build-carol-%d", run), "build", run, carol)
+	}
+	addLink("test-alice-0", "test", 0, alice)
+	releasedDigest, err := MetadataDigest(released)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = PruneLinks(context.Background(), store, RetentionPolicy{KeepLast: -1})
+	assert.ErrorIs(t, err, ErrInvalidRetentionPolicy)
+
+	// Keeping all runs prunes nothing
+	pruned, err := PruneLinks(context.Background(), store, RetentionPolicy{})
+	assert.Nil(t, err)
+	assert.Empty(t, pruned)
+
+	policy := RetentionPolicy{KeepLast: 2, Keep: []HashObj{releasedDigest}}
+	prunable, err := policy.Prunable(mapValues(store.links))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"build-alice-1", "build-carol-0", "build-carol-1"}, storedLinkRefs(prunable))
+
+	pruned, err = PruneLinks(context.Background(), store, policy)
+	assert.Nil(t, err)
+	assert.Equal(t, storedLinkRefs(prunable), storedLinkRefs(pruned))
+	remaining := make([]string, 0, len(store.links))
+	for ref := range store.links {
+		remaining = append(remaining, ref)
+	}
+	sort.Strings(remaining)
+	assert.Equal(t, []string{"build-alice-0", "build-alice-2", "build-alice-3", "build-carol-2", "build-carol-3", "test-alice-0"}, remaining)
+}
+
+func TestFileLinkStorePrune(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := GenerateTestVectors(dir, []byte("retention")); err != nil {
+		t.Fatal(err)
+	}
+	var ownerKey Key
+	if err := ownerKey.LoadKeyDefaults(filepath.Join(dir, "keys", "owner.pub")); err != nil {
+		t.Fatal(err)
+	}
+	linkDir := filepath.Join(dir, "valid")
+	layoutEnv, err := LoadMetadata(filepath.Join(linkDir, RootLayoutName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	evidence := &VerificationEvidence{}
+	if _, err := Verify(layoutEnv, map[string]Key{ownerKey.KeyID: ownerKey}, linkDir, WithEvidence(evidence)); err != nil {
+		t.Fatal(err)
+	}
+	digests, err := evidence.LinkDigests()
+	assert.Nil(t, err)
+	assert.Len(t, digests, 2)
+
+	// An outdated run of the package step, with a link file of another name
+	store := &FileLinkStore{Dir: linkDir}
+	links, err := store.ListLinks(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, links, 2)
+	var pkgLink StoredLink
+	for _, link := range links {
+		if link.Metadata.GetPayload().(Link).Name == "package" {
+			pkgLink = link
+		}
+	}
+	outdated := filepath.Join(linkDir, "package.outdated.link")
+	if err := pkgLink.Metadata.Dump(outdated); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(outdated, pkgLink.Stored.Add(-time.Hour), pkgLink.Stored.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The outdated run has the digest of the verified link
+	pruned, err := PruneLinks(context.Background(), store, RetentionPolicy{KeepLast: 1, Keep: digests})
+	assert.Nil(t, err)
+	assert.Empty(t, pruned)
+
+	pruned, err = PruneLinks(context.Background(), store, RetentionPolicy{KeepLast: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{outdated}, storedLinkRefs(pruned))
+	assert.NoFileExists(t, outdated)
+	_, err = Verify(layoutEnv, map[string]Key{ownerKey.KeyID: ownerKey}, linkDir)
+	assert.Nil(t, err)
+
+	assert.NotNil(t, store.DeleteLink(context.Background(), filepath.Join(dir, "keys", "owner.pub")))
+}
+
+func storedLinkRefs(links []StoredLink) []string {
+	refs := make([]string, 0, len(links))
+	for _, link := range links {
+		refs = append(refs, link.Ref)
+	}
+	return refs
+}
+
+func mapValues(links map[string]StoredLink) []StoredLink {
+	values := make([]StoredLink, 0, len(links))
+	for _, link := range links {
+		values = append(values, link)
+	}
+	return values
+}
@@ -0,0 +1,210 @@
+package in_toto
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNotDenylist is returned when a denylist is expected, but other metadata
+// is passed.
+var ErrNotDenylist = errors.New("metadata is not a denylist")
+
+/*
+RevokedMetadata identifies revoked link or attestation metadata by the digest
+of its signed payload, see MetadataDigest.  Reason optionally documents why
+the metadata was revoked, e.g. the compromise of the builder that produced it.
+*/
+type RevokedMetadata struct {
+	Digest HashObj `json:"digest"`
+	Reason string  `json:"reason,omitempty"`
+}
+
+/*
+Denylist lists revoked link metadata.  Like a layout, a denylist is signed
+metadata with an expiration date.  Verification with a denylist ignores
+revoked links, which allows to invalidate bad metadata, e.g. links produced by
+a compromised builder, without rotating keys or re-signing layouts.
+*/
+type Denylist struct {
+	Type    string            `json:"_type"`
+	Expires string            `json:"expires"`
+	Revoked []RevokedMetadata `json:"revoked"`
+}
+
+// validateDenylist checks the type, expiration date format and entries of the
+// passed denylist.
+func validateDenylist(denylist Denylist) error {
+	if denylist.Type != "denylist" {
+		return fmt.Errorf("invalid Type value for denylist: should be 'denylist'")
+	}
+	if _, err := time.Parse(ISO8601DateSchema, denylist.Expires); err != nil {
+		return fmt.Errorf("expiry time parsed incorrectly - date either" +
+			" invalid or of incorrect format")
+	}
+	for i, revoked := range denylist.Revoked {
+		if len(revoked.Digest) == 0 {
+			return fmt.Errorf("denylist entry %d has no digest", i)
+		}
+		for algorithm, digest := range revoked.Digest {
+			if err := validateHexString(digest); err != nil {
+				return fmt.Errorf("in denylist entry %d, %s hash value: %w", i, algorithm, err)
+			}
+		}
+	}
+	return nil
+}
+
+/*
+MetadataDigest returns the sha256 and sha512 digests of the signed payload of
+the passed metadata, i.e. of the canonical JSON encoding of the signed part of
+a Metablock, of the payload of an Envelope or of a raw GitObject.  The digest
+does not depend on the signatures or on how the metadata file is formatted.
+*/
+func MetadataDigest(metadata Metadata) (HashObj, error) {
+	var payload []byte
+	var err error
+	switch m := metadata.(type) {
+	case *Metablock:
+		payload, err = m.GetSignableRepresentation()
+	case *Envelope:
+		payload, err = m.envelope.DecodeB64Payload()
+	case *GitObject:
+		payload = m.Raw
+	default:
+		return nil, ErrUnknownMetadataType
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return digestPayload(payload), nil
+}
+
+// digestPayload returns the sha256 and sha512 digests of the passed payload,
+// see MetadataDigest.
+func digestPayload(payload []byte) HashObj {
+	sha256Digest := sha256.Sum256(payload)
+	sha512Digest := sha512.Sum512(payload)
+	return HashObj{
+		"sha256": hex.EncodeToString(sha256Digest[:]),
+		"sha512": hex.EncodeToString(sha512Digest[:]),
+	}
+}
+
+/*
+Revoke adds the passed metadata to the denylist, with an optional reason.
+*/
+func (d *Denylist) Revoke(metadata Metadata, reason string) error {
+	digest, err := MetadataDigest(metadata)
+	if err != nil {
+		return err
+	}
+	d.Revoked = append(d.Revoked, RevokedMetadata{Digest: digest, Reason: reason})
+	return nil
+}
+
+/*
+Lookup returns the denylist entry of the passed metadata, or nil if the
+metadata is not revoked.
+*/
+func (d *Denylist) Lookup(metadata Metadata) (*RevokedMetadata, error) {
+	return d.lookup(metadata, nil)
+}
+
+// lookup implements Lookup, computing the digest of the passed metadata with
+// the passed memo.
+func (d *Denylist) lookup(metadata Metadata, memo *signableMemo) (*RevokedMetadata, error) {
+	digest, err := memo.digest(metadata)
+	if err != nil {
+		return nil, err
+	}
+	for i := range d.Revoked {
+		if digestsMatch(d.Revoked[i].Digest, digest) {
+			return &d.Revoked[i], nil
+		}
+	}
+	return nil, nil
+}
+
+/*
+VerifyDenylist verifies that the passed denylist metadata is signed by each
+of the passed keys and that it has not expired.  On success it returns the
+denylist.
+*/
+func VerifyDenylist(denylistEnv Metadata, keys map[string]Key) (*Denylist, error) {
+	if len(keys) < 1 {
+		return nil, fmt.Errorf("denylist verification requires at least one key")
+	}
+	for _, key := range keys {
+		if err := denylistEnv.VerifySignature(key); err != nil {
+			return nil, err
+		}
+	}
+
+	denylist, ok := denylistEnv.GetPayload().(Denylist)
+	if !ok {
+		return nil, ErrNotDenylist
+	}
+	if err := validateDenylist(denylist); err != nil {
+		return nil, err
+	}
+
+	expires, err := time.Parse(ISO8601DateSchema, denylist.Expires)
+	if err != nil {
+		return nil, err
+	}
+	if time.Until(expires) < 0 {
+		return nil, fmt.Errorf("denylist has expired on %s", expires)
+	}
+	return &denylist, nil
+}
+
+/*
+RemoveRevokedLinks returns the passed links per step and functionary, e.g. as
+returned by LoadLinksForLayout, without the links revoked by the passed
+denylist.  A warning is printed for each removed link.
+*/
+func RemoveRevokedLinks(stepsMetadata map[string]map[string]Metadata, denylist *Denylist) (map[string]map[string]Metadata, error) {
+	return removeRevokedLinks(stepsMetadata, denylist, nil)
+}
+
+// removeRevokedLinks implements RemoveRevokedLinks, computing the digests of
+// the links with the passed memo.
+func removeRevokedLinks(stepsMetadata map[string]map[string]Metadata, denylist *Denylist,
+	memo *signableMemo) (map[string]map[string]Metadata, error) {
+	remaining := make(map[string]map[string]Metadata, len(stepsMetadata))
+	for stepName, linksPerStep := range stepsMetadata {
+		remaining[stepName] = make(map[string]Metadata, len(linksPerStep))
+		for keyID, linkEnv := range linksPerStep {
+			revoked, err := denylist.lookup(linkEnv, memo)
+			if err != nil {
+				return nil, err
+			}
+			if revoked != nil {
+				fmt.Printf("WARNING: Ignoring revoked link for step '%s' signed by '%s': %s\n",
+					stepName, keyID, revoked.Reason)
+				continue
+			}
+			remaining[stepName][keyID] = linkEnv
+		}
+	}
+	return remaining, nil
+}
+
+/*
+InTotoVerifyWithDenylist performs the verification routine of InTotoVerify,
+but ignores links revoked by the passed denylist, see VerifyDenylist.  If
+revoking links leaves fewer links than required by the threshold of a step,
+verification fails.  The denylist is not applied to links of sublayouts.
+*/
+func InTotoVerifyWithDenylist(layoutEnv Metadata, layoutKeys map[string]Key,
+	linkDir string, stepName string, parameterDictionary map[string]string, intermediatePems [][]byte, lineNormalization bool,
+	denylist *Denylist) (Metadata, error) {
+	return inTotoVerify(context.Background(), layoutEnv, layoutKeys, linkDir, stepName,
+		parameterDictionary, intermediatePems, lineNormalization, verifyOptions{denylist: denylist})
+}
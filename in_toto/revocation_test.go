@@ -0,0 +1,135 @@
+package in_toto
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetadataDigest(t *testing.T) {
+	linkEnv, err := LoadMetadata("write-code.b7d643de.link")
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest, err := MetadataDigest(linkEnv)
+	assert.Nil(t, err)
+	assert.Len(t, digest, 2)
+
+	// The digest does not depend on signatures
+	mb := linkEnv.(*Metablock)
+	unsigned := &Metablock{Signed: mb.Signed}
+	unsignedDigest, err := MetadataDigest(unsigned)
+	assert.Nil(t, err)
+	assert.Equal(t, digest, unsignedDigest)
+
+	env := &Envelope{}
+	assert.Nil(t, env.SetPayload(mb.Signed))
+	envDigest, err := MetadataDigest(env)
+	assert.Nil(t, err)
+	assert.Equal(t, digest, envDigest)
+
+	_, err = MetadataDigest(nil)
+	assert.ErrorIs(t, err, ErrUnknownMetadataType)
+}
+
+func TestVerifyDenylist(t *testing.T) {
+	var key, pubKey, otherKey Key
+	if err := key.LoadKeyDefaults("alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := pubKey.LoadKeyDefaults("alice.pub"); err != nil {
+		t.Fatal(err)
+	}
+	if err := otherKey.LoadKeyDefaults("carol.pub"); err != nil {
+		t.Fatal(err)
+	}
+	linkEnv, err := LoadMetadata("write-code.b7d643de.link")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	denylist := Denylist{
+		Type:    "denylist",
+		Expires: time.Now().Add(time.Hour).UTC().Format(ISO8601DateSchema),
+	}
+	assert.Nil(t, denylist.Revoke(linkEnv, "compromised builder"))
+
+	// Sign, dump and load the denylist
+	mb := &Metablock{Signed: denylist}
+	assert.Nil(t, mb.Sign(key))
+	path := filepath.Join(t.TempDir(), "denylist.json")
+	assert.Nil(t, mb.Dump(path))
+	denylistEnv, err := LoadMetadata(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verified, err := VerifyDenylist(denylistEnv, map[string]Key{pubKey.KeyID: pubKey})
+	assert.Nil(t, err)
+	revoked, err := verified.Lookup(linkEnv)
+	assert.Nil(t, err)
+	if assert.NotNil(t, revoked) {
+		assert.Equal(t, "compromised builder", revoked.Reason)
+	}
+	packageEnv, err := LoadMetadata("package.d3ffd108.link")
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked, err = verified.Lookup(packageEnv)
+	assert.Nil(t, err)
+	assert.Nil(t, revoked)
+
+	_, err = VerifyDenylist(denylistEnv, map[string]Key{})
+	assert.NotNil(t, err)
+	_, err = VerifyDenylist(denylistEnv, map[string]Key{otherKey.KeyID: otherKey})
+	assert.NotNil(t, err)
+
+	expired := denylist
+	expired.Expires = "2000-01-01T00:00:00Z"
+	mb = &Metablock{Signed: expired}
+	assert.Nil(t, mb.Sign(key))
+	_, err = VerifyDenylist(mb, map[string]Key{pubKey.KeyID: pubKey})
+	assert.ErrorContains(t, err, "expired")
+
+	invalid := denylist
+	invalid.Revoked = []RevokedMetadata{{Digest: HashObj{"sha256": "not hex"}}}
+	mb = &Metablock{Signed: invalid}
+	assert.Nil(t, mb.Sign(key))
+	_, err = VerifyDenylist(mb, map[string]Key{pubKey.KeyID: pubKey})
+	assert.ErrorIs(t, err, ErrInvalidHexString)
+
+	layoutEnv, err := LoadMetadata("demo.layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = VerifyDenylist(layoutEnv, map[string]Key{pubKey.KeyID: pubKey})
+	assert.ErrorIs(t, err, ErrNotDenylist)
+}
+
+func TestInTotoVerifyWithDenylist(t *testing.T) {
+	layoutEnv, err := LoadMetadata("demo.layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pubKey Key
+	if err := pubKey.LoadKey("alice.pub", "rsassa-pss-sha256", []string{"sha256", "sha512"}); err != nil {
+		t.Fatal(err)
+	}
+	layoutKeys := map[string]Key{pubKey.KeyID: pubKey}
+
+	denylist := &Denylist{Type: "denylist"}
+	_, err = InTotoVerifyWithDenylist(layoutEnv, layoutKeys, ".", "",
+		map[string]string{}, [][]byte{}, testOSisWindows(), denylist)
+	assert.Nil(t, err)
+
+	linkEnv, err := LoadMetadata("write-code.b7d643de.link")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, denylist.Revoke(linkEnv, "compromised builder"))
+	_, err = InTotoVerifyWithDenylist(layoutEnv, layoutKeys, ".", "",
+		map[string]string{}, [][]byte{}, testOSisWindows(), denylist)
+	assert.ErrorContains(t, err, "step 'write-code' requires '1' link metadata file(s)")
+}
@@ -0,0 +1,467 @@
+package in_toto
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// TimestampTypeRFC3161 is the timestamp type of RFC 3161 time-stamp tokens.
+const TimestampTypeRFC3161 = "rfc3161"
+
+// ErrInvalidRFC3161Token is returned when an RFC 3161 time-stamp response or
+// token cannot be parsed or fails verification.
+var ErrInvalidRFC3161Token = errors.New("invalid rfc3161 time-stamp token")
+
+var (
+	oidSignedData        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidTSTInfo           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidAttrContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidAttrMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidRSASSAPSS         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 10}
+)
+
+// rfc3161Hashes are the hash algorithms supported in message imprints and
+// signatures of time-stamp tokens, with the signature algorithms of signer
+// certificates by public key algorithm.
+var rfc3161Hashes = []struct {
+	oid   asn1.ObjectIdentifier
+	hash  crypto.Hash
+	rsa   x509.SignatureAlgorithm
+	pss   x509.SignatureAlgorithm
+	ecdsa x509.SignatureAlgorithm
+}{
+	{asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}, crypto.SHA256, x509.SHA256WithRSA, x509.SHA256WithRSAPSS, x509.ECDSAWithSHA256},
+	{asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}, crypto.SHA384, x509.SHA384WithRSA, x509.SHA384WithRSAPSS, x509.ECDSAWithSHA384},
+	{asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}, crypto.SHA512, x509.SHA512WithRSA, x509.SHA512WithRSAPSS, x509.ECDSAWithSHA512},
+}
+
+// rfc3161MessageImprint is the hash of the time-stamped data, see RFC 3161,
+// section 2.4.1.
+type rfc3161MessageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+// rfc3161Request is a TimeStampReq, see RFC 3161, section 2.4.1.
+type rfc3161Request struct {
+	Version        int
+	MessageImprint rfc3161MessageImprint
+	ReqPolicy      asn1.ObjectIdentifier `asn1:"optional"`
+	Nonce          *big.Int              `asn1:"optional"`
+	CertReq        bool                  `asn1:"optional,default:false"`
+}
+
+// rfc3161Response is a TimeStampResp, see RFC 3161, section 2.4.2.
+type rfc3161Response struct {
+	Status struct {
+		Status       int
+		StatusString []string       `asn1:"optional"`
+		FailInfo     asn1.BitString `asn1:"optional"`
+	}
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+// rfc3161ContentInfo is a CMS ContentInfo, see RFC 5652, section 3.
+type rfc3161ContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+// rfc3161SignedData is a CMS SignedData, see RFC 5652, section 5.1.
+type rfc3161SignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo struct {
+		EContentType asn1.ObjectIdentifier
+		EContent     []byte `asn1:"explicit,optional,tag:0"`
+	}
+	Certificates asn1.RawValue       `asn1:"optional,tag:0"`
+	CRLs         asn1.RawValue       `asn1:"optional,tag:1"`
+	SignerInfos  []rfc3161SignerInfo `asn1:"set"`
+}
+
+// rfc3161SignerInfo is a CMS SignerInfo, see RFC 5652, section 5.3.
+type rfc3161SignerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+// rfc3161Attribute is a CMS Attribute, see RFC 5652, section 5.3.
+type rfc3161Attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+// rfc3161IssuerAndSerial identifies the certificate of a signer, see RFC
+// 5652, section 10.2.4.
+type rfc3161IssuerAndSerial struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+// rfc3161TSTInfo is the content of a time-stamp token, see RFC 3161, section
+// 2.4.2.
+type rfc3161TSTInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint rfc3161MessageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time `asn1:"generalized"`
+	Accuracy       struct {
+		Seconds int `asn1:"optional"`
+		Millis  int `asn1:"optional,tag:0"`
+		Micros  int `asn1:"optional,tag:1"`
+	} `asn1:"optional"`
+	Ordering   bool          `asn1:"optional,default:false"`
+	Nonce      *big.Int      `asn1:"optional"`
+	TSA        asn1.RawValue `asn1:"optional,explicit,tag:0"`
+	Extensions asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+// rfc3161Token is a parsed time-stamp token, i.e. signed data and its parsed
+// TSTInfo.
+type rfc3161Token struct {
+	signedData rfc3161SignedData
+	info       rfc3161TSTInfo
+}
+
+// parseRFC3161Token parses the passed DER encoded time-stamp token, i.e. a
+// CMS ContentInfo with SignedData over a TSTInfo.
+func parseRFC3161Token(der []byte) (*rfc3161Token, error) {
+	var contentInfo rfc3161ContentInfo
+	if rest, err := asn1.Unmarshal(der, &contentInfo); err != nil || len(rest) > 0 {
+		return nil, fmt.Errorf("%w: token is not a CMS ContentInfo", ErrInvalidRFC3161Token)
+	}
+	if !contentInfo.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("%w: token is not CMS SignedData", ErrInvalidRFC3161Token)
+	}
+	var token rfc3161Token
+	if _, err := asn1.Unmarshal(contentInfo.Content.Bytes, &token.signedData); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidRFC3161Token, err)
+	}
+	encap := token.signedData.EncapContentInfo
+	if !encap.EContentType.Equal(oidTSTInfo) {
+		return nil, fmt.Errorf("%w: token does not contain a TSTInfo", ErrInvalidRFC3161Token)
+	}
+	if rest, err := asn1.Unmarshal(encap.EContent, &token.info); err != nil || len(rest) > 0 {
+		return nil, fmt.Errorf("%w: token contains a malformed TSTInfo", ErrInvalidRFC3161Token)
+	}
+	return &token, nil
+}
+
+// rfc3161Hash returns the hash algorithm with the passed object identifier.
+func rfc3161Hash(oid asn1.ObjectIdentifier) (crypto.Hash, error) {
+	for _, h := range rfc3161Hashes {
+		if h.oid.Equal(oid) {
+			return h.hash, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: unsupported hash algorithm '%s'", ErrInvalidRFC3161Token, oid)
+}
+
+// rfc3161Digest returns the digest of the passed data with the hash algorithm
+// with the passed object identifier.
+func rfc3161Digest(oid asn1.ObjectIdentifier, data []byte) ([]byte, error) {
+	hash, err := rfc3161Hash(oid)
+	if err != nil {
+		return nil, err
+	}
+	h := hash.New()
+	h.Write(data)
+	return h.Sum(nil), nil
+}
+
+// verifyImprint checks that the token time-stamps the passed data.
+func (t *rfc3161Token) verifyImprint(data []byte) error {
+	digest, err := rfc3161Digest(t.info.MessageImprint.HashAlgorithm.Algorithm, data)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(digest, t.info.MessageImprint.HashedMessage) {
+		return fmt.Errorf("%w: token does not time-stamp the signature", ErrInvalidRFC3161Token)
+	}
+	return nil
+}
+
+/*
+verifySignature verifies that the passed signer info signs the TSTInfo of the
+token with the passed certificate, i.e. that the signed attributes contain
+the content type and digest of the TSTInfo, and that the signature over the
+signed attributes is valid.
+*/
+func (t *rfc3161Token) verifySignature(signer rfc3161SignerInfo, cert *x509.Certificate) error {
+	if len(signer.SignedAttrs.FullBytes) == 0 {
+		return fmt.Errorf("%w: token has no signed attributes", ErrInvalidRFC3161Token)
+	}
+	// Signed attributes are signed as SET OF, instead of their implicit tag
+	signedAttrs := append([]byte{0x31}, signer.SignedAttrs.FullBytes[1:]...)
+	var attrs []rfc3161Attribute
+	if _, err := asn1.UnmarshalWithParams(signedAttrs, &attrs, "set"); err != nil {
+		return fmt.Errorf("%w: malformed signed attributes: %s", ErrInvalidRFC3161Token, err)
+	}
+
+	digest, err := rfc3161Digest(signer.DigestAlgorithm.Algorithm, t.signedData.EncapContentInfo.EContent)
+	if err != nil {
+		return err
+	}
+	var contentTypeOK, digestOK bool
+	for _, attr := range attrs {
+		if len(attr.Values) != 1 {
+			continue
+		}
+		switch {
+		case attr.Type.Equal(oidAttrContentType):
+			var contentType asn1.ObjectIdentifier
+			_, err := asn1.Unmarshal(attr.Values[0].FullBytes, &contentType)
+			contentTypeOK = err == nil && contentType.Equal(oidTSTInfo)
+		case attr.Type.Equal(oidAttrMessageDigest):
+			var messageDigest []byte
+			_, err := asn1.Unmarshal(attr.Values[0].FullBytes, &messageDigest)
+			digestOK = err == nil && bytes.Equal(messageDigest, digest)
+		}
+	}
+	if !contentTypeOK || !digestOK {
+		return fmt.Errorf("%w: signed attributes do not match the TSTInfo", ErrInvalidRFC3161Token)
+	}
+
+	algorithm, err := rfc3161SignatureAlgorithm(cert, signer)
+	if err != nil {
+		return err
+	}
+	if err := cert.CheckSignature(algorithm, signedAttrs, signer.Signature); err != nil {
+		return fmt.Errorf("%w: bad signature: %s", ErrInvalidRFC3161Token, err)
+	}
+	return nil
+}
+
+// rfc3161SignatureAlgorithm returns the signature algorithm of the passed
+// signer info, whose signature is verified with the passed certificate.
+func rfc3161SignatureAlgorithm(cert *x509.Certificate, signer rfc3161SignerInfo) (x509.SignatureAlgorithm, error) {
+	for _, h := range rfc3161Hashes {
+		if !h.oid.Equal(signer.DigestAlgorithm.Algorithm) {
+			continue
+		}
+		switch cert.PublicKeyAlgorithm {
+		case x509.RSA:
+			if signer.SignatureAlgorithm.Algorithm.Equal(oidRSASSAPSS) {
+				return h.pss, nil
+			}
+			return h.rsa, nil
+		case x509.ECDSA:
+			return h.ecdsa, nil
+		case x509.Ed25519:
+			return x509.PureEd25519, nil
+		}
+	}
+	return x509.UnknownSignatureAlgorithm, fmt.Errorf("%w: unsupported signature algorithm '%s' with '%s'",
+		ErrInvalidRFC3161Token, signer.SignatureAlgorithm.Algorithm, signer.DigestAlgorithm.Algorithm)
+}
+
+// rfc3161SignerCertificate returns the certificate of the passed signer info among
+// the passed certificates.
+func rfc3161SignerCertificate(signer rfc3161SignerInfo, certs []*x509.Certificate) (*x509.Certificate, error) {
+	var issuerAndSerial rfc3161IssuerAndSerial
+	isIssuerAndSerial := signer.SID.Class == asn1.ClassUniversal && signer.SID.Tag == asn1.TagSequence
+	if isIssuerAndSerial {
+		if _, err := asn1.Unmarshal(signer.SID.FullBytes, &issuerAndSerial); err != nil {
+			return nil, fmt.Errorf("%w: malformed signer identifier", ErrInvalidRFC3161Token)
+		}
+	}
+	for _, cert := range certs {
+		if isIssuerAndSerial {
+			if bytes.Equal(cert.RawIssuer, issuerAndSerial.Issuer.FullBytes) &&
+				cert.SerialNumber.Cmp(issuerAndSerial.SerialNumber) == 0 {
+				return cert, nil
+			}
+		} else if signer.SID.Class == asn1.ClassContextSpecific && signer.SID.Tag == 0 &&
+			bytes.Equal(cert.SubjectKeyId, signer.SID.Bytes) {
+			return cert, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: token does not contain the certificate of its signer", ErrInvalidRFC3161Token)
+}
+
+/*
+RFC3161Timestamper is a Timestamper that obtains RFC 3161 time-stamp tokens
+from the time-stamping authority (TSA) at URL.  The tokens time-stamp the
+SHA-256 hash of the signature bytes, and contain the certificate of the TSA.
+If Client is nil, http.DefaultClient is used.
+*/
+type RFC3161Timestamper struct {
+	URL    string
+	Client *http.Client
+}
+
+/*
+Timestamp requests a time-stamp token for the passed signature bytes and
+returns the base64 encoded, DER encoded token as timestamp evidence.  Only
+whether the token answers the request is checked, the token is not verified,
+see RFC3161Verifier.
+*/
+func (r RFC3161Timestamper) Timestamp(signature []byte) (ts Timestamp, err error) {
+	ctx, span := startSpan(context.Background(), "in_toto.RFC3161Timestamper.Timestamp")
+	span.SetAttribute("url.full", r.URL)
+	defer func() { endSpan(span, err) }()
+
+	digest, err := rfc3161Digest(rfc3161Hashes[0].oid, signature)
+	if err != nil {
+		return Timestamp{}, err
+	}
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return Timestamp{}, err
+	}
+	request, err := asn1.Marshal(rfc3161Request{
+		Version: 1,
+		MessageImprint: rfc3161MessageImprint{
+			HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: rfc3161Hashes[0].oid},
+			HashedMessage: digest,
+		},
+		Nonce:   nonce,
+		CertReq: true,
+	})
+	if err != nil {
+		return Timestamp{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.URL, bytes.NewReader(request))
+	if err != nil {
+		return Timestamp{}, err
+	}
+	req.Header.Set("Content-Type", "application/timestamp-query")
+	req.Header.Set("Accept", "application/timestamp-reply")
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return Timestamp{}, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Timestamp{}, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return Timestamp{}, fmt.Errorf("time-stamping authority %s responded with status %d: %s", r.URL,
+			resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	var response rfc3161Response
+	if _, err := asn1.Unmarshal(data, &response); err != nil {
+		return Timestamp{}, fmt.Errorf("%w: malformed response: %s", ErrInvalidRFC3161Token, err)
+	}
+	// Status granted (0) or grantedWithMods (1)
+	if response.Status.Status > 1 || len(response.TimeStampToken.FullBytes) == 0 {
+		return Timestamp{}, fmt.Errorf("%w: request rejected with status %d: %s", ErrInvalidRFC3161Token,
+			response.Status.Status, strings.Join(response.Status.StatusString, " "))
+	}
+	token, err := parseRFC3161Token(response.TimeStampToken.FullBytes)
+	if err != nil {
+		return Timestamp{}, err
+	}
+	if err := token.verifyImprint(signature); err != nil {
+		return Timestamp{}, err
+	}
+	if token.info.Nonce == nil || token.info.Nonce.Cmp(nonce) != 0 {
+		return Timestamp{}, fmt.Errorf("%w: token does not answer the request nonce", ErrInvalidRFC3161Token)
+	}
+
+	return Timestamp{
+		Type: TimestampTypeRFC3161,
+		Data: base64.StdEncoding.EncodeToString(response.TimeStampToken.FullBytes),
+	}, nil
+}
+
+/*
+RFC3161Verifier is a TimestampVerifier for RFC 3161 time-stamp tokens,
+trusting time-stamping authorities with certificates that chain up to Roots,
+possibly using any intermediates in Intermediates, and are valid for time
+stamping.
+*/
+type RFC3161Verifier struct {
+	Roots         *x509.CertPool
+	Intermediates *x509.CertPool
+}
+
+// Type returns TimestampTypeRFC3161.
+func (r RFC3161Verifier) Type() string {
+	return TimestampTypeRFC3161
+}
+
+/*
+VerifyTimestamp verifies that the passed time-stamp token time-stamps the
+passed signature bytes, that it is signed by the certificate it contains, and
+that the certificate is trusted for time stamping at the time in the token.
+On success it returns the time in the token.
+*/
+func (r RFC3161Verifier) VerifyTimestamp(ts Timestamp, signature []byte) (time.Time, error) {
+	if ts.Type != TimestampTypeRFC3161 {
+		return time.Time{}, fmt.Errorf("%w: unexpected timestamp type '%s'", ErrInvalidRFC3161Token, ts.Type)
+	}
+	der, err := base64.StdEncoding.DecodeString(ts.Data)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %s", ErrInvalidRFC3161Token, err)
+	}
+	token, err := parseRFC3161Token(der)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := token.verifyImprint(signature); err != nil {
+		return time.Time{}, err
+	}
+
+	if len(token.signedData.SignerInfos) != 1 {
+		return time.Time{}, fmt.Errorf("%w: token has %d signers, expected 1", ErrInvalidRFC3161Token,
+			len(token.signedData.SignerInfos))
+	}
+	signer := token.signedData.SignerInfos[0]
+	certs, err := x509.ParseCertificates(token.signedData.Certificates.Bytes)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %s", ErrInvalidRFC3161Token, err)
+	}
+	cert, err := rfc3161SignerCertificate(signer, certs)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := token.verifySignature(signer, cert); err != nil {
+		return time.Time{}, err
+	}
+
+	intermediates := x509.NewCertPool()
+	if r.Intermediates != nil {
+		intermediates = r.Intermediates.Clone()
+	}
+	for _, c := range certs {
+		intermediates.AddCert(c)
+	}
+	_, err = cert.Verify(x509.VerifyOptions{
+		Roots:         r.Roots,
+		Intermediates: intermediates,
+		CurrentTime:   token.info.GenTime,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: untrusted time-stamping authority: %s", ErrInvalidRFC3161Token, err)
+	}
+	return token.info.GenTime.UTC(), nil
+}
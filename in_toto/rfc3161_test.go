@@ -0,0 +1,226 @@
+package in_toto
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// rfc3161TestTSA is a minimal time-stamping authority, which issues tokens at
+// the time returned by now, signed with a certificate issued by a test CA, or
+// rejects all requests.
+type rfc3161TestTSA struct {
+	now    func() time.Time
+	reject bool
+	key    *ecdsa.PrivateKey
+	cert   *x509.Certificate
+	roots  *x509.CertPool
+}
+
+func newRFC3161TestTSA(t *testing.T) *rfc3161TestTSA {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "tsa test ca"},
+		NotBefore:             time.Now().Add(-24 * time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, caKey.Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "tsa test"},
+		NotBefore:    time.Now().Add(-24 * time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	}, ca, key.Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	return &rfc3161TestTSA{now: time.Now, key: key, cert: cert, roots: roots}
+}
+
+// token returns a DER encoded time-stamp token for the passed message
+// imprint and nonce.
+func (tsa *rfc3161TestTSA) token(t *testing.T, imprint rfc3161MessageImprint, nonce *big.Int) []byte {
+	info, err := asn1.Marshal(rfc3161TSTInfo{
+		Version:        1,
+		Policy:         asn1.ObjectIdentifier{1, 2, 3, 4},
+		MessageImprint: imprint,
+		SerialNumber:   big.NewInt(42),
+		GenTime:        tsa.now().UTC(),
+		Nonce:          nonce,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	infoDigest := sha256.Sum256(info)
+	contentType, _ := asn1.Marshal(oidTSTInfo)
+	messageDigest, _ := asn1.Marshal(infoDigest[:])
+	signedAttrs, err := asn1.MarshalWithParams([]rfc3161Attribute{
+		{Type: oidAttrContentType, Values: []asn1.RawValue{{FullBytes: contentType}}},
+		{Type: oidAttrMessageDigest, Values: []asn1.RawValue{{FullBytes: messageDigest}}},
+	}, "set")
+	if err != nil {
+		t.Fatal(err)
+	}
+	attrsDigest := sha256.Sum256(signedAttrs)
+	signature, err := tsa.key.Sign(rand.Reader, attrsDigest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sid, err := asn1.Marshal(rfc3161IssuerAndSerial{
+		Issuer:       asn1.RawValue{FullBytes: tsa.cert.RawIssuer},
+		SerialNumber: tsa.cert.SerialNumber,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sha256Algorithm := pkix.AlgorithmIdentifier{Algorithm: rfc3161Hashes[0].oid}
+	signedData := rfc3161SignedData{
+		Version:          3,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{sha256Algorithm},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: tsa.cert.Raw},
+		SignerInfos: []rfc3161SignerInfo{{
+			Version:            1,
+			SID:                asn1.RawValue{FullBytes: sid},
+			DigestAlgorithm:    sha256Algorithm,
+			SignedAttrs:        asn1.RawValue{FullBytes: append([]byte{0xa0}, signedAttrs[1:]...)},
+			SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}},
+			Signature:          signature,
+		}},
+	}
+	signedData.EncapContentInfo.EContentType = oidTSTInfo
+	signedData.EncapContentInfo.EContent = info
+	content, err := asn1.Marshal(signedData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := asn1.Marshal(rfc3161ContentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: content},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// server returns an HTTP server answering time-stamp requests.
+func (tsa *rfc3161TestTSA) server(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		var request rfc3161Request
+		if err != nil || r.Header.Get("Content-Type") != "application/timestamp-query" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if _, err := asn1.Unmarshal(body, &request); err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		var response rfc3161Response
+		if tsa.reject {
+			response.Status.Status = 2
+			response.Status.StatusString = []string{"rejected"}
+		} else {
+			response.TimeStampToken = asn1.RawValue{FullBytes: tsa.token(t, request.MessageImprint, request.Nonce)}
+		}
+		data, err := asn1.Marshal(response)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/timestamp-reply")
+		w.Write(data) //nolint:errcheck
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRFC3161Timestamp(t *testing.T) {
+	tsa := newRFC3161TestTSA(t)
+	at := time.Now().Add(-time.Hour).Truncate(time.Second)
+	tsa.now = func() time.Time { return at }
+	server := tsa.server(t)
+
+	signature := []byte("signature")
+	ts, err := RFC3161Timestamper{URL: server.URL}.Timestamp(signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, TimestampTypeRFC3161, ts.Type)
+
+	verifier := RFC3161Verifier{Roots: tsa.roots}
+	attested, err := verifier.VerifyTimestamp(ts, signature)
+	assert.Nil(t, err)
+	assert.True(t, at.Equal(attested))
+
+	// Tokens over another signature do not verify
+	_, err = verifier.VerifyTimestamp(ts, []byte("other"))
+	assert.ErrorIs(t, err, ErrInvalidRFC3161Token)
+
+	// Tokens of untrusted time-stamping authorities do not verify
+	_, err = RFC3161Verifier{Roots: newRFC3161TestTSA(t).roots}.VerifyTimestamp(ts, signature)
+	assert.ErrorIs(t, err, ErrInvalidRFC3161Token)
+
+	// Tampered tokens do not verify
+	token, err := base64.StdEncoding.DecodeString(ts.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token[len(token)-1] ^= 0xff
+	_, err = verifier.VerifyTimestamp(Timestamp{Type: TimestampTypeRFC3161,
+		Data: base64.StdEncoding.EncodeToString(token)}, signature)
+	assert.ErrorIs(t, err, ErrInvalidRFC3161Token)
+	_, err = verifier.VerifyTimestamp(Timestamp{Type: TimestampTypeRFC3161, Data: "bm90IGEgdG9rZW4="}, signature)
+	assert.ErrorIs(t, err, ErrInvalidRFC3161Token)
+	_, err = verifier.VerifyTimestamp(Timestamp{Type: TimestampTypeRoughtime, Data: ts.Data}, signature)
+	assert.ErrorIs(t, err, ErrInvalidRFC3161Token)
+
+	// Rejected requests fail
+	tsa.reject = true
+	_, err = RFC3161Timestamper{URL: server.URL}.Timestamp(signature)
+	assert.ErrorContains(t, err, "rejected with status 2: rejected")
+}
@@ -0,0 +1,96 @@
+package in_toto
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrUnknownRole is returned when a step references a functionary role that
+// is not defined in the layout.
+var ErrUnknownRole = errors.New("unknown functionary role")
+
+/*
+FunctionaryRole is a named group of functionary keys with a threshold, e.g.
+"builders" or "reviewers".  Roles are defined in the Roles of a layout and
+referenced from steps by name, so that a functionary key is added to or
+removed from all steps performed by a role in a single place, e.g.:
+
+	"roles": {
+	  "builders": {
+	    "keyids": ["<keyid of builder 1>", "<keyid of builder 2>"],
+	    "threshold": 2
+	  }
+	}
+
+A step that references a role is authorized for the keys of the role in
+addition to its own PubKeys, and requires at least the threshold of the role,
+see ResolveRoles.
+*/
+type FunctionaryRole struct {
+	KeyIDs    []string `json:"keyids"`
+	Threshold int      `json:"threshold"`
+}
+
+// validateRole checks that the keys of the passed role are defined in the
+// passed layout keys, and that its threshold can be met.
+func validateRole(name string, role FunctionaryRole, keys map[string]Key) error {
+	if role.Threshold < 1 {
+		return atPointer(fmt.Errorf("threshold of role '%s' must be at least 1, got '%d'",
+			name, role.Threshold), []interface{}{"threshold"}, "")
+	}
+	if role.Threshold > len(role.KeyIDs) {
+		return atPointer(fmt.Errorf("threshold of role '%s' exceeds its '%d' key(s)",
+			name, len(role.KeyIDs)), []interface{}{"threshold"}, "")
+	}
+	seen := NewSet()
+	for i, keyID := range role.KeyIDs {
+		if _, ok := keys[keyID]; !ok {
+			return atPointer(fmt.Errorf("role '%s' references unknown functionary key '%s'",
+				name, keyID), []interface{}{"keyids", i}, "")
+		}
+		if seen.Has(keyID) {
+			return atPointer(fmt.Errorf("role '%s' lists key '%s' more than once",
+				name, keyID), []interface{}{"keyids", i}, "")
+		}
+		seen.Add(keyID)
+	}
+	return nil
+}
+
+/*
+ResolveRoles returns a copy of the passed layout, in which each step that
+references a functionary role is authorized for the keys of the role, in
+addition to the keys in its own PubKeys, and requires the greater of its own
+threshold and the threshold of the role.  The Role field of the steps is
+kept.  It returns an ErrUnknownRole if a step references a role that is not
+defined in the layout.  The verification routines of this package resolve
+roles before links are verified, functions such as
+VerifyLinkSignatureThesholds expect a resolved layout.
+*/
+func ResolveRoles(layout Layout) (Layout, error) {
+	steps := make([]Step, len(layout.Steps))
+	for i, step := range layout.Steps {
+		steps[i] = step
+		if step.Role == "" {
+			continue
+		}
+		role, ok := layout.Roles[step.Role]
+		if !ok {
+			return Layout{}, fmt.Errorf("%w '%s' of step '%s'", ErrUnknownRole, step.Role, step.Name)
+		}
+
+		pubKeys := NewSet(step.PubKeys...)
+		steps[i].PubKeys = append([]string{}, step.PubKeys...)
+		for _, keyID := range role.KeyIDs {
+			if !pubKeys.Has(keyID) {
+				pubKeys.Add(keyID)
+				steps[i].PubKeys = append(steps[i].PubKeys, keyID)
+			}
+		}
+		if role.Threshold > step.Threshold {
+			steps[i].Threshold = role.Threshold
+		}
+	}
+	layout.Steps = steps
+	return layout, nil
+}
@@ -0,0 +1,184 @@
+package in_toto
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveRoles(t *testing.T) {
+	layout := Layout{
+		Roles: map[string]FunctionaryRole{
+			"builders": {KeyIDs: []string{"a", "b", "c"}, Threshold: 2},
+		},
+		Steps: []Step{
+			{PubKeys: []string{"d", "a"}, Threshold: 1, Role: "builders", SupplyChainItem: SupplyChainItem{Name: "build"}},
+			{PubKeys: []string{"d"}, Threshold: 3, Role: "builders", SupplyChainItem: SupplyChainItem{Name: "test"}},
+			{PubKeys: []string{"d"}, Threshold: 1, SupplyChainItem: SupplyChainItem{Name: "package"}},
+		},
+	}
+
+	resolved, err := ResolveRoles(layout)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"d", "a", "b", "c"}, resolved.Steps[0].PubKeys)
+	assert.Equal(t, 2, resolved.Steps[0].Threshold)
+	assert.Equal(t, "builders", resolved.Steps[0].Role)
+	assert.Equal(t, []string{"d", "a", "b", "c"}, resolved.Steps[1].PubKeys)
+	assert.Equal(t, 3, resolved.Steps[1].Threshold)
+	assert.Equal(t, []string{"d"}, resolved.Steps[2].PubKeys)
+	assert.Equal(t, 1, resolved.Steps[2].Threshold)
+
+	// The passed layout is not modified
+	assert.Equal(t, []string{"d", "a"}, layout.Steps[0].PubKeys)
+	assert.Equal(t, 1, layout.Steps[0].Threshold)
+
+	layout.Steps[2].Role = "reviewers"
+	_, err = ResolveRoles(layout)
+	assert.ErrorIs(t, err, ErrUnknownRole)
+}
+
+func TestValidateLayoutRoles(t *testing.T) {
+	var alice, carol Key
+	if err := alice.LoadKeyDefaults("alice.pub"); err != nil {
+		t.Fatal(err)
+	}
+	if err := carol.LoadKey("carol.pub", "ed25519", []string{"sha256", "sha512"}); err != nil {
+		t.Fatal(err)
+	}
+	newLayout := func(role FunctionaryRole, stepRole string) Layout {
+		return Layout{
+			Type:    "layout",
+			Expires: "2030-01-01T00:00:00Z",
+			Keys:    map[string]Key{alice.KeyID: alice, carol.KeyID: carol},
+			Roles:   map[string]FunctionaryRole{"builders": role},
+			Steps:   []Step{{Type: "step", Role: stepRole, Threshold: 1, SupplyChainItem: SupplyChainItem{Name: "build"}}},
+		}
+	}
+
+	assert.Nil(t, validateLayout(newLayout(FunctionaryRole{KeyIDs: []string{alice.KeyID, carol.KeyID}, Threshold: 2}, "builders")))
+
+	tables := []struct {
+		name    string
+		layout  Layout
+		pointer string
+	}{
+		{"zero threshold", newLayout(FunctionaryRole{KeyIDs: []string{alice.KeyID}}, ""), "/roles/builders/threshold"},
+		{"unmet threshold", newLayout(FunctionaryRole{KeyIDs: []string{alice.KeyID}, Threshold: 2}, ""), "/roles/builders/threshold"},
+		{"unknown key", newLayout(FunctionaryRole{KeyIDs: []string{alice.KeyID, "abc"}, Threshold: 1}, ""), "/roles/builders/keyids/1"},
+		{"duplicate key", newLayout(FunctionaryRole{KeyIDs: []string{alice.KeyID, alice.KeyID}, Threshold: 1}, ""), "/roles/builders/keyids/1"},
+		{"unknown role", newLayout(FunctionaryRole{KeyIDs: []string{alice.KeyID}, Threshold: 1}, "reviewers"), "/steps/0/role"},
+	}
+	for _, table := range tables {
+		err := validateLayout(table.layout)
+		assert.NotNil(t, err, table.name)
+		assert.Equal(t, table.pointer, ErrorPointer(err), table.name)
+	}
+}
+
+func TestLayoutBuilderRoles(t *testing.T) {
+	var alice, carol Key
+	if err := alice.LoadKeyDefaults("alice.pub"); err != nil {
+		t.Fatal(err)
+	}
+	if err := carol.LoadKey("carol.pub", "ed25519", []string{"sha256", "sha512"}); err != nil {
+		t.Fatal(err)
+	}
+
+	layout, err := NewLayout().
+		Expires(time.Now().AddDate(0, 1, 0)).
+		AddFunctionary(alice).
+		AddFunctionary(carol).
+		AddRole("builders", 2, alice.KeyID, carol.KeyID).
+		AddStep("build").
+		Role("builders").
+		Build()
+	if assert.Nil(t, err) {
+		assert.Equal(t, FunctionaryRole{KeyIDs: []string{alice.KeyID, carol.KeyID}, Threshold: 2}, layout.Roles["builders"])
+		assert.Equal(t, "builders", layout.Steps[0].Role)
+	}
+
+	_, err = NewLayout().
+		Expires(time.Now().AddDate(0, 1, 0)).
+		AddFunctionary(alice).
+		AddRole("builders", 1, alice.KeyID).
+		AddRole("builders", 1, alice.KeyID).
+		AddRole("reviewers", 1, carol.KeyID).
+		AddStep("build").
+		Role("testers").
+		Build()
+	assert.ErrorIs(t, err, ErrInvalidLayoutBuilder)
+	assert.ErrorContains(t, err, "added twice")
+	assert.ErrorContains(t, err, "unknown functionary key")
+	assert.ErrorIs(t, err, ErrUnknownRole)
+}
+
+func TestInTotoVerifyRoles(t *testing.T) {
+	var alice, alicePub, carol, carolPub Key
+	if err := alice.LoadKeyDefaults("alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := alicePub.LoadKeyDefaults("alice.pub"); err != nil {
+		t.Fatal(err)
+	}
+	if err := carol.LoadKey("carol", "ed25519", []string{"sha256", "sha512"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := carolPub.LoadKey("carol.pub", "ed25519", []string{"sha256", "sha512"}); err != nil {
+		t.Fatal(err)
+	}
+
+	layout, err := NewLayout().
+		Expires(time.Now().AddDate(0, 1, 0)).
+		AddFunctionary(alicePub).
+		AddFunctionary(carolPub).
+		AddRole("builders", 2, alicePub.KeyID, carolPub.KeyID).
+		AddStep("build").
+		ExpectedProducts([]string{"ALLOW", "*"}).
+		Role("builders").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	layoutMb := &Metablock{Signed: layout}
+	if err := layoutMb.Sign(alice); err != nil {
+		t.Fatal(err)
+	}
+	layoutKeys := map[string]Key{alicePub.KeyID: alicePub}
+
+	link := Link{
+		Type:        "link",
+		Name:        "build",
+		Materials:   map[string]HashObj{},
+		Products:    map[string]HashObj{"app": {"sha256": "abcd"}},
+		ByProducts:  map[string]interface{}{},
+		Environment: map[string]interface{}{},
+		Command:     []string{},
+	}
+	linkDir := t.TempDir()
+	for i, key := range []Key{alice, carol} {
+		mb := &Metablock{Signed: link}
+		if err := mb.Sign(key); err != nil {
+			t.Fatal(err)
+		}
+		name, err := LinkFilename(mb, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := mb.Dump(filepath.Join(linkDir, name)); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = InTotoVerify(layoutMb, layoutKeys, linkDir, "", nil, nil, false)
+		if i == 0 {
+			// A single builder does not meet the threshold of the role
+			var thresholdErr *ThresholdError
+			if assert.ErrorAs(t, err, &thresholdErr) {
+				assert.Equal(t, 2, thresholdErr.Threshold)
+			}
+		} else {
+			assert.Nil(t, err)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package in_toto
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+)
+
+// TimestampTypeRoughtime is the timestamp type of Roughtime evidence.
+const TimestampTypeRoughtime = "roughtime"
+
+// ErrInvalidRoughtimeResponse is returned when a Roughtime response cannot be
+// parsed or fails verification.
+var ErrInvalidRoughtimeResponse = errors.New("invalid roughtime response")
+
+const (
+	roughtimeRequestSize     = 1024
+	roughtimeMaxResponseSize = 4096
+	roughtimeDefaultTimeout  = 5 * time.Second
+	// Context strings, see https://roughtime.googlesource.com/roughtime/+/HEAD/PROTOCOL.md
+	roughtimeDelegationContext = "RoughTime v1 delegation signature--\x00"
+	roughtimeResponseContext   = "RoughTime v1 response signature\x00"
+)
+
+// roughtimeTag converts a four character Roughtime tag to its wire value.
+func roughtimeTag(tag string) uint32 {
+	return binary.LittleEndian.Uint32([]byte(tag))
+}
+
+var (
+	roughtimeTagNONC = roughtimeTag("NONC")
+	roughtimeTagPAD  = roughtimeTag("PAD\xff")
+	roughtimeTagSIG  = roughtimeTag("SIG\x00")
+	roughtimeTagPATH = roughtimeTag("PATH")
+	roughtimeTagSREP = roughtimeTag("SREP")
+	roughtimeTagCERT = roughtimeTag("CERT")
+	roughtimeTagINDX = roughtimeTag("INDX")
+	roughtimeTagROOT = roughtimeTag("ROOT")
+	roughtimeTagMIDP = roughtimeTag("MIDP")
+	roughtimeTagDELE = roughtimeTag("DELE")
+	roughtimeTagMINT = roughtimeTag("MINT")
+	roughtimeTagMAXT = roughtimeTag("MAXT")
+	roughtimeTagPUBK = roughtimeTag("PUBK")
+)
+
+/*
+encodeRoughtimeMessage encodes the passed tag value map as Roughtime message.
+All values must have a length that is a multiple of four.
+*/
+func encodeRoughtimeMessage(msg map[uint32][]byte) []byte {
+	tags := make([]uint32, 0, len(msg))
+	for tag := range msg {
+		tags = append(tags, tag)
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i] < tags[j] })
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, uint32(len(tags)))
+	offset := uint32(0)
+	for i, tag := range tags {
+		if i > 0 {
+			binary.Write(&buf, binary.LittleEndian, offset)
+		}
+		offset += uint32(len(msg[tag]))
+	}
+	for _, tag := range tags {
+		binary.Write(&buf, binary.LittleEndian, tag)
+	}
+	for _, tag := range tags {
+		buf.Write(msg[tag])
+	}
+	return buf.Bytes()
+}
+
+/*
+decodeRoughtimeMessage parses the passed Roughtime message into a tag value
+map.
+*/
+func decodeRoughtimeMessage(data []byte) (map[uint32][]byte, error) {
+	if len(data) < 4 || len(data)%4 != 0 {
+		return nil, fmt.Errorf("%w: bad message size", ErrInvalidRoughtimeResponse)
+	}
+	numTags := int(binary.LittleEndian.Uint32(data))
+	if numTags == 0 {
+		return map[uint32][]byte{}, nil
+	}
+	headerSize := 4 * (2 * numTags)
+	if numTags > len(data)/8 || headerSize > len(data) {
+		return nil, fmt.Errorf("%w: bad number of tags", ErrInvalidRoughtimeResponse)
+	}
+
+	offsets := make([]int, numTags+1)
+	for i := 1; i < numTags; i++ {
+		offsets[i] = int(binary.LittleEndian.Uint32(data[4*i:]))
+	}
+	values := data[headerSize:]
+	offsets[numTags] = len(values)
+
+	msg := make(map[uint32][]byte, numTags)
+	var lastTag uint32
+	for i := 0; i < numTags; i++ {
+		tag := binary.LittleEndian.Uint32(data[4*(numTags+i):])
+		if i > 0 && tag <= lastTag {
+			return nil, fmt.Errorf("%w: tags not sorted", ErrInvalidRoughtimeResponse)
+		}
+		lastTag = tag
+		start, end := offsets[i], offsets[i+1]
+		if start > end || end > len(values) || start%4 != 0 {
+			return nil, fmt.Errorf("%w: bad offset", ErrInvalidRoughtimeResponse)
+		}
+		msg[tag] = values[start:end]
+	}
+	return msg, nil
+}
+
+// roughtimeNonce derives the Roughtime request nonce from signature bytes.
+func roughtimeNonce(signature []byte) []byte {
+	nonce := sha512.Sum512(signature)
+	return nonce[:]
+}
+
+/*
+RoughtimeTimestamper is a Timestamper that obtains timestamps from a Roughtime
+server.  The nonce of each request is the SHA-512 hash of the signature bytes,
+which binds the server's signed response to the signature.
+*/
+type RoughtimeTimestamper struct {
+	// Address is the UDP address of the Roughtime server as host:port.
+	Address string
+	// Timeout for the request, defaults to five seconds.
+	Timeout time.Duration
+}
+
+/*
+Timestamp sends a Roughtime request for the passed signature bytes and
+returns the raw, base64 encoded response as timestamp evidence.  The response
+is not verified, see RoughtimeVerifier.
+*/
+func (r RoughtimeTimestamper) Timestamp(signature []byte) (ts Timestamp, err error) {
+	_, span := startSpan(context.Background(), "in_toto.RoughtimeTimestamper.Timestamp")
+	span.SetAttribute("server.address", r.Address)
+	defer func() { endSpan(span, err) }()
+
+	timeout := r.Timeout
+	if timeout == 0 {
+		timeout = roughtimeDefaultTimeout
+	}
+
+	request := map[uint32][]byte{roughtimeTagNONC: roughtimeNonce(signature)}
+	// Pad the request to the minimum size, taking the header of the
+	// additional PAD tag into account.
+	padSize := roughtimeRequestSize - len(encodeRoughtimeMessage(request)) - 8
+	request[roughtimeTagPAD] = make([]byte, padSize)
+
+	conn, err := net.DialTimeout("udp", r.Address, timeout)
+	if err != nil {
+		return Timestamp{}, err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return Timestamp{}, err
+	}
+
+	if _, err := conn.Write(encodeRoughtimeMessage(request)); err != nil {
+		return Timestamp{}, err
+	}
+	response := make([]byte, roughtimeMaxResponseSize)
+	n, err := conn.Read(response)
+	if err != nil {
+		return Timestamp{}, err
+	}
+
+	return Timestamp{
+		Type: TimestampTypeRoughtime,
+		Data: base64.StdEncoding.EncodeToString(response[:n]),
+	}, nil
+}
+
+/*
+RoughtimeVerifier is a TimestampVerifier for Roughtime evidence, trusting the
+Roughtime server with the passed long-term public key.
+*/
+type RoughtimeVerifier struct {
+	PublicKey ed25519.PublicKey
+}
+
+// Type returns TimestampTypeRoughtime.
+func (r RoughtimeVerifier) Type() string {
+	return TimestampTypeRoughtime
+}
+
+/*
+VerifyTimestamp verifies that the passed Roughtime response is signed by a
+delegate of the trusted server key, that it answers the nonce derived from the
+passed signature bytes and that the attested time lies within the validity
+window of the delegation.  On success it returns the midpoint time attested by
+the server.
+*/
+func (r RoughtimeVerifier) VerifyTimestamp(ts Timestamp, signature []byte) (time.Time, error) {
+	if ts.Type != TimestampTypeRoughtime {
+		return time.Time{}, fmt.Errorf("%w: unexpected timestamp type '%s'", ErrInvalidRoughtimeResponse, ts.Type)
+	}
+	raw, err := base64.StdEncoding.DecodeString(ts.Data)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %s", ErrInvalidRoughtimeResponse, err)
+	}
+
+	response, err := decodeRoughtimeMessage(raw)
+	if err != nil {
+		return time.Time{}, err
+	}
+	for _, tag := range []uint32{roughtimeTagSIG, roughtimeTagPATH, roughtimeTagSREP, roughtimeTagCERT, roughtimeTagINDX} {
+		if _, ok := response[tag]; !ok {
+			return time.Time{}, fmt.Errorf("%w: missing tag", ErrInvalidRoughtimeResponse)
+		}
+	}
+
+	cert, err := decodeRoughtimeMessage(response[roughtimeTagCERT])
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !ed25519.Verify(r.PublicKey, append([]byte(roughtimeDelegationContext), cert[roughtimeTagDELE]...), cert[roughtimeTagSIG]) {
+		return time.Time{}, fmt.Errorf("%w: bad delegation signature", ErrInvalidRoughtimeResponse)
+	}
+	dele, err := decodeRoughtimeMessage(cert[roughtimeTagDELE])
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(dele[roughtimeTagPUBK]) != ed25519.PublicKeySize || len(dele[roughtimeTagMINT]) != 8 || len(dele[roughtimeTagMAXT]) != 8 {
+		return time.Time{}, fmt.Errorf("%w: bad delegation", ErrInvalidRoughtimeResponse)
+	}
+	if !ed25519.Verify(dele[roughtimeTagPUBK], append([]byte(roughtimeResponseContext), response[roughtimeTagSREP]...), response[roughtimeTagSIG]) {
+		return time.Time{}, fmt.Errorf("%w: bad response signature", ErrInvalidRoughtimeResponse)
+	}
+
+	srep, err := decodeRoughtimeMessage(response[roughtimeTagSREP])
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(srep[roughtimeTagROOT]) != sha512.Size || len(srep[roughtimeTagMIDP]) != 8 || len(response[roughtimeTagINDX]) != 4 {
+		return time.Time{}, fmt.Errorf("%w: bad signed response", ErrInvalidRoughtimeResponse)
+	}
+
+	// Verify that the nonce is included in the Merkle tree of the response
+	path := response[roughtimeTagPATH]
+	if len(path)%sha512.Size != 0 {
+		return time.Time{}, fmt.Errorf("%w: bad path", ErrInvalidRoughtimeResponse)
+	}
+	index := binary.LittleEndian.Uint32(response[roughtimeTagINDX])
+	hash := sha512.Sum512(append([]byte{0x00}, roughtimeNonce(signature)...))
+	node := hash[:]
+	for len(path) > 0 {
+		sibling := path[:sha512.Size]
+		path = path[sha512.Size:]
+		var combined []byte
+		if index&1 == 0 {
+			combined = append(append([]byte{0x01}, node...), sibling...)
+		} else {
+			combined = append(append([]byte{0x01}, sibling...), node...)
+		}
+		hash = sha512.Sum512(combined)
+		node = hash[:]
+		index >>= 1
+	}
+	if !bytes.Equal(node, srep[roughtimeTagROOT]) {
+		return time.Time{}, fmt.Errorf("%w: nonce not included in response", ErrInvalidRoughtimeResponse)
+	}
+
+	midpoint := binary.LittleEndian.Uint64(srep[roughtimeTagMIDP])
+	minTime := binary.LittleEndian.Uint64(dele[roughtimeTagMINT])
+	maxTime := binary.LittleEndian.Uint64(dele[roughtimeTagMAXT])
+	if midpoint < minTime || midpoint > maxTime {
+		return time.Time{}, fmt.Errorf("%w: time outside of delegation validity", ErrInvalidRoughtimeResponse)
+	}
+
+	return time.UnixMicro(int64(midpoint)).UTC(), nil
+}
@@ -0,0 +1,186 @@
+package in_toto
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// roughtimeTestServer is a minimal Roughtime server answering each request
+// with a single-leaf Merkle tree, signed by a delegate of rootKey.
+type roughtimeTestServer struct {
+	conn     *net.UDPConn
+	rootKey  ed25519.PrivateKey
+	midpoint time.Time
+	minTime  time.Time
+	maxTime  time.Time
+}
+
+func uint64LE(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, v)
+	return b
+}
+
+func (s *roughtimeTestServer) respond(request []byte) ([]byte, error) {
+	msg, err := decodeRoughtimeMessage(request)
+	if err != nil {
+		return nil, err
+	}
+	nonce := msg[roughtimeTagNONC]
+
+	delegatePub, delegateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	dele := encodeRoughtimeMessage(map[uint32][]byte{
+		roughtimeTagPUBK: delegatePub,
+		roughtimeTagMINT: uint64LE(uint64(s.minTime.UnixMicro())),
+		roughtimeTagMAXT: uint64LE(uint64(s.maxTime.UnixMicro())),
+	})
+	cert := encodeRoughtimeMessage(map[uint32][]byte{
+		roughtimeTagDELE: dele,
+		roughtimeTagSIG:  ed25519.Sign(s.rootKey, append([]byte(roughtimeDelegationContext), dele...)),
+	})
+
+	root := sha512.Sum512(append([]byte{0x00}, nonce...))
+	srep := encodeRoughtimeMessage(map[uint32][]byte{
+		roughtimeTagROOT: root[:],
+		roughtimeTagMIDP: uint64LE(uint64(s.midpoint.UnixMicro())),
+	})
+
+	return encodeRoughtimeMessage(map[uint32][]byte{
+		roughtimeTagSIG:  ed25519.Sign(delegateKey, append([]byte(roughtimeResponseContext), srep...)),
+		roughtimeTagPATH: {},
+		roughtimeTagSREP: srep,
+		roughtimeTagCERT: cert,
+		roughtimeTagINDX: make([]byte, 4),
+	}), nil
+}
+
+func (s *roughtimeTestServer) serve() {
+	buf := make([]byte, 2048)
+	for {
+		n, addr, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		if n < roughtimeRequestSize {
+			continue
+		}
+		response, err := s.respond(buf[:n])
+		if err != nil {
+			continue
+		}
+		s.conn.WriteToUDP(response, addr)
+	}
+}
+
+func startRoughtimeTestServer(t *testing.T, midpoint time.Time) (*roughtimeTestServer, ed25519.PublicKey) {
+	rootPub, rootKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &roughtimeTestServer{
+		conn:     conn,
+		rootKey:  rootKey,
+		midpoint: midpoint,
+		minTime:  midpoint.Add(-time.Hour),
+		maxTime:  midpoint.Add(time.Hour),
+	}
+	go s.serve()
+	t.Cleanup(func() { conn.Close() })
+	return s, rootPub
+}
+
+func TestRoughtimeMessageRoundTrip(t *testing.T) {
+	msg := map[uint32][]byte{
+		roughtimeTagNONC: make([]byte, 64),
+		roughtimeTagPATH: {},
+		roughtimeTagMIDP: uint64LE(42),
+	}
+	decoded, err := decodeRoughtimeMessage(encodeRoughtimeMessage(msg))
+	assert.Nil(t, err)
+	assert.Equal(t, len(msg), len(decoded))
+	for tag, value := range msg {
+		assert.Equal(t, len(value), len(decoded[tag]))
+	}
+
+	invalidMessages := [][]byte{
+		{},
+		{1, 0, 0},
+		{5, 0, 0, 0, 0, 0, 0, 0},
+		// two tags with unsorted tags
+		{2, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 1, 0, 0, 0},
+		// offset beyond message
+		{2, 0, 0, 0, 8, 0, 0, 0, 1, 0, 0, 0, 2, 0, 0, 0},
+	}
+	for _, invalid := range invalidMessages {
+		_, err := decodeRoughtimeMessage(invalid)
+		if !errors.Is(err, ErrInvalidRoughtimeResponse) {
+			t.Errorf("decodeRoughtimeMessage(%v) returned '%v', expected '%s'", invalid, err, ErrInvalidRoughtimeResponse)
+		}
+	}
+}
+
+func TestRoughtimeTimestamp(t *testing.T) {
+	midpoint := time.Date(2021, 5, 4, 12, 0, 0, 0, time.UTC)
+	server, rootPub := startRoughtimeTestServer(t, midpoint)
+
+	timestamper := RoughtimeTimestamper{Address: server.conn.LocalAddr().String(), Timeout: 2 * time.Second}
+	signature := []byte("signature bytes")
+	ts, err := timestamper.Timestamp(signature)
+	if err != nil {
+		t.Fatalf("RoughtimeTimestamper.Timestamp() failed: %s", err)
+	}
+	assert.Equal(t, TimestampTypeRoughtime, ts.Type)
+
+	verifier := RoughtimeVerifier{PublicKey: rootPub}
+	attested, err := verifier.VerifyTimestamp(ts, signature)
+	assert.Nil(t, err)
+	assert.True(t, midpoint.Equal(attested))
+
+	// The response must not verify for another signature
+	_, err = verifier.VerifyTimestamp(ts, []byte("other signature"))
+	assert.ErrorIs(t, err, ErrInvalidRoughtimeResponse)
+
+	// The response must not verify with another root key
+	otherPub, _, _ := ed25519.GenerateKey(rand.Reader)
+	_, err = RoughtimeVerifier{PublicKey: otherPub}.VerifyTimestamp(ts, signature)
+	assert.ErrorIs(t, err, ErrInvalidRoughtimeResponse)
+
+	// Tampered evidence must not verify
+	raw, _ := base64.StdEncoding.DecodeString(ts.Data)
+	raw[len(raw)-5] ^= 0xff
+	_, err = verifier.VerifyTimestamp(Timestamp{Type: TimestampTypeRoughtime, Data: base64.StdEncoding.EncodeToString(raw)}, signature)
+	assert.ErrorIs(t, err, ErrInvalidRoughtimeResponse)
+
+	_, err = verifier.VerifyTimestamp(Timestamp{Type: "foo", Data: ts.Data}, signature)
+	assert.ErrorIs(t, err, ErrInvalidRoughtimeResponse)
+}
+
+func TestRoughtimeTimestampOutsideDelegation(t *testing.T) {
+	midpoint := time.Date(2021, 5, 4, 12, 0, 0, 0, time.UTC)
+	server, rootPub := startRoughtimeTestServer(t, midpoint)
+	server.maxTime = midpoint.Add(-time.Minute)
+
+	timestamper := RoughtimeTimestamper{Address: server.conn.LocalAddr().String(), Timeout: 2 * time.Second}
+	ts, err := timestamper.Timestamp([]byte("signature bytes"))
+	if err != nil {
+		t.Fatalf("RoughtimeTimestamper.Timestamp() failed: %s", err)
+	}
+	_, err = RoughtimeVerifier{PublicKey: rootPub}.VerifyTimestamp(ts, []byte("signature bytes"))
+	assert.ErrorIs(t, err, ErrInvalidRoughtimeResponse)
+}
@@ -0,0 +1,51 @@
+package in_toto
+
+import (
+	"context"
+	"encoding/hex"
+	"testing"
+
+	"github.com/in-toto/in-toto-golang/in_toto/keys"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRSASchemes(t *testing.T) {
+	data := []byte("signed data")
+	for _, scheme := range keys.SupportedSchemes(rsaKeyType) {
+		var privKey, pubKey Key
+		if err := privKey.LoadKey("dan", scheme, []string{"sha256", "sha512"}); err != nil {
+			t.Fatalf("failed to load private key with scheme %s: %s", scheme, err)
+		}
+		if err := pubKey.LoadKey("dan.pub", scheme, []string{"sha256", "sha512"}); err != nil {
+			t.Fatalf("failed to load public key with scheme %s: %s", scheme, err)
+		}
+
+		sig, err := GenerateSignature(data, privKey)
+		if err != nil {
+			t.Errorf("GenerateSignature failed for scheme %s: %s", scheme, err)
+			continue
+		}
+		assert.Nil(t, VerifySignature(pubKey, sig, data), scheme)
+		assert.ErrorIs(t, VerifySignature(pubKey, sig, []byte("tampered")), ErrInvalidSignature, scheme)
+
+		// A signature must not verify with a key declaring another scheme
+		for _, otherScheme := range keys.SupportedSchemes(rsaKeyType) {
+			if otherScheme == scheme {
+				continue
+			}
+			otherKey := pubKey
+			otherKey.Scheme = otherScheme
+			sv, err := keys.NewSignerVerifier(otherKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sigBytes, _ := hex.DecodeString(sig.Sig)
+			assert.NotNil(t, sv.Verify(context.Background(), data, sigBytes), "%s verified as %s", scheme, otherScheme)
+		}
+	}
+
+	var key Key
+	if err := key.LoadKey("dan", "rsassa-pss-sha384", []string{"sha256", "sha512"}); err == nil {
+		t.Error("LoadKey passed with unsupported RSA scheme")
+	}
+}
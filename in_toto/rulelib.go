@@ -1,12 +1,18 @@
 package in_toto
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 )
 
-// An error message issued in UnpackRule if it receives a malformed rule.
-var errorMsg = "Wrong rule format, available formats are:\n" +
+// ErrInvalidArtifactRule is returned, wrapped in an ArtifactRuleError, if an
+// artifact rule does not conform with any of the available rule formats.
+var ErrInvalidArtifactRule = errors.New("invalid artifact rule")
+
+// An error message issued in ParseArtifactRule if it receives a rule of an
+// unknown type.
+var errorMsg = "available rule formats are:\n" +
 	"\tMATCH <pattern> [IN <source-path-prefix>] WITH (MATERIALS|PRODUCTS)" +
 	" [IN <destination-path-prefix>] FROM <step>,\n" +
 	"\tCREATE <pattern>,\n" +
@@ -14,12 +20,106 @@ var errorMsg = "Wrong rule format, available formats are:\n" +
 	"\tMODIFY <pattern>,\n" +
 	"\tALLOW <pattern>,\n" +
 	"\tDISALLOW <pattern>,\n" +
-	"\tREQUIRE <filename>\n\n"
+	"\tREQUIRE <filename>,\n" +
+	"\tABSENT <pattern>"
 
 /*
-UnpackRule parses the passed rule and extracts and returns the information
-required for rule processing.  It can be used to verify if a rule has a valid
-format.  Available rule formats are:
+ArtifactRuleError reports the token of an artifact rule that violates the
+available rule formats, see ParseArtifactRule.  Token is the index of the
+offending token in Rule, or the length of Rule, if a token is missing.  Use
+errors.As to inspect it, or errors.Is with ErrInvalidArtifactRule to detect
+it.
+*/
+type ArtifactRuleError struct {
+	Rule  []string
+	Token int
+	Msg   string
+}
+
+func (e *ArtifactRuleError) Error() string {
+	if e.Token < len(e.Rule) {
+		return fmt.Sprintf("%s %s: token %d '%s': %s", ErrInvalidArtifactRule,
+			e.Rule, e.Token, e.Rule[e.Token], e.Msg)
+	}
+	return fmt.Sprintf("%s %s: token %d: %s", ErrInvalidArtifactRule, e.Rule,
+		e.Token, e.Msg)
+}
+
+// Is reports whether the target is ErrInvalidArtifactRule.
+func (e *ArtifactRuleError) Is(target error) bool {
+	return target == ErrInvalidArtifactRule
+}
+
+// ErrRuleViolation is returned, wrapped in a RuleViolationError, if the
+// artifacts of a step or inspection violate one of its artifact rules.
+var ErrRuleViolation = errors.New("artifact rule violated")
+
+/*
+RuleViolationError reports the artifact rule of a step or inspection that the
+artifacts reported by its link violate.  Step is the name of the step or
+inspection, ItemType is either "Step" or "Inspection", and ArtifactType is
+either "materials" or "products".  Artifacts lists the offending artifacts,
+i.e. the artifacts a DISALLOW or ABSENT rule matched, or the artifact missing
+for a REQUIRE rule.  It is empty for an ABSENT rule, if the link did not
+assert the pattern absent.  Use errors.As to inspect it, or errors.Is with
+ErrRuleViolation to detect it.
+*/
+type RuleViolationError struct {
+	Step         string
+	ItemType     string
+	ArtifactType string
+	Rule         []string
+	Artifacts    []string
+}
+
+func (e *RuleViolationError) Error() string {
+	ruleType := ""
+	if len(e.Rule) > 0 {
+		ruleType = strings.ToUpper(e.Rule[0])
+	}
+
+	switch {
+	case ruleType == "REQUIRE" && len(e.Rule) > 1:
+		return fmt.Sprintf("artifact verification failed for %s in REQUIRE '%s',"+
+			" because %s is not in %s of %s '%s'", e.ArtifactType, e.Rule[1],
+			e.Rule[1], e.ArtifactType, e.ItemType, e.Step)
+	case ruleType == "ABSENT" && len(e.Artifacts) == 0 && len(e.Rule) > 1:
+		return fmt.Sprintf("artifact verification failed for %s '%s',"+
+			" link does not assert %s matching '%s' absent as required by rule %s",
+			e.ItemType, e.Step, e.ArtifactType, e.Rule[1], e.Rule)
+	case ruleType == "ABSENT":
+		return fmt.Sprintf("artifact verification failed for %s '%s',"+
+			" %s %s asserted absent by rule %s", e.ItemType, e.Step,
+			e.ArtifactType, e.Artifacts, e.Rule)
+	}
+	return fmt.Sprintf("artifact verification failed for %s '%s',"+
+		" %s %s disallowed by rule %s", e.ItemType, e.Step, e.ArtifactType,
+		e.Artifacts, e.Rule)
+}
+
+// Is reports whether the target is ErrRuleViolation.
+func (e *RuleViolationError) Is(target error) bool {
+	return target == ErrRuleViolation
+}
+
+/*
+ArtifactRule is the typed representation of an artifact rule, see
+ParseArtifactRule.  Type is the lower case rule type, i.e. "match", "create",
+"delete", "modify", "allow", "disallow", "require" or "absent".  SrcPrefix, DstType, i.e.
+"materials" or "products", DstPrefix and DstName are only used by MATCH rules.
+*/
+type ArtifactRule struct {
+	Type      string
+	Pattern   string
+	SrcPrefix string
+	DstType   string
+	DstPrefix string
+	DstName   string
+}
+
+/*
+ParseArtifactRule parses the passed rule list into an ArtifactRule.  It can be
+used to verify if a rule has a valid format.  Available rule formats are:
 
 	MATCH <pattern> [IN <source-path-prefix>] WITH (MATERIALS|PRODUCTS)
 		[IN <destination-path-prefix>] FROM <step>,
@@ -27,13 +127,129 @@ format.  Available rule formats are:
 	DELETE <pattern>,
 	MODIFY <pattern>,
 	ALLOW <pattern>,
-	DISALLOW <pattern>
+	DISALLOW <pattern>,
+	REQUIRE <filename>,
+	ABSENT <pattern>
 
-Rule tokens are normalized to lower case before returning.  The returned map
-has the following format:
+Keywords are matched case-insensitively, the rule type and destination type are
+normalized to lower case.  If the rule does not match any of the available
+formats, an ArtifactRuleError is returned, which locates the offending token.
+*/
+func ParseArtifactRule(rule []string) (ArtifactRule, error) {
+	fail := func(token int, format string, args ...interface{}) (ArtifactRule, error) {
+		return ArtifactRule{}, &ArtifactRuleError{Rule: rule, Token: token,
+			Msg: fmt.Sprintf(format, args...)}
+	}
+	if len(rule) == 0 {
+		return fail(0, "empty rule, %s", errorMsg)
+	}
+
+	parsed := ArtifactRule{Type: strings.ToLower(rule[0])}
+	switch parsed.Type {
+	case "create", "modify", "delete", "allow", "disallow", "require", "absent":
+	case "match":
+	default:
+		return fail(0, "unknown rule type, %s", errorMsg)
+	}
+	if len(rule) < 2 {
+		return fail(1, "missing pattern")
+	}
+	parsed.Pattern = rule[1]
+	if parsed.Type != "match" {
+		if len(rule) > 2 {
+			return fail(2, "unexpected token, %s rules have the format '%s <pattern>'",
+				rule[0], strings.ToUpper(parsed.Type))
+		}
+		return parsed, nil
+	}
+
+	// MATCH <pattern> [IN <source-path-prefix>] WITH (MATERIALS|PRODUCTS)
+	// [IN <destination-path-prefix>] FROM <step>
+	i := 2
+	keyword := func(token int) string {
+		if token < len(rule) {
+			return strings.ToLower(rule[token])
+		}
+		return ""
+	}
+	if keyword(i) == "in" {
+		if i+1 >= len(rule) {
+			return fail(i+1, "missing source path prefix")
+		}
+		parsed.SrcPrefix = rule[i+1]
+		i += 2
+	}
+	if keyword(i) != "with" {
+		return fail(i, "expected 'WITH'")
+	}
+	i++
+	parsed.DstType = keyword(i)
+	if parsed.DstType != "materials" && parsed.DstType != "products" {
+		return fail(i, "expected 'MATERIALS' or 'PRODUCTS'")
+	}
+	i++
+	if keyword(i) == "in" {
+		if i+1 >= len(rule) {
+			return fail(i+1, "missing destination path prefix")
+		}
+		parsed.DstPrefix = rule[i+1]
+		i += 2
+	}
+	if keyword(i) != "from" {
+		return fail(i, "expected 'FROM'")
+	}
+	i++
+	if i >= len(rule) {
+		return fail(i, "missing step name")
+	}
+	parsed.DstName = rule[i]
+	if i+1 < len(rule) {
+		return fail(i+1, "unexpected token after step name")
+	}
+	return parsed, nil
+}
+
+// parseArtifactRule calls ParseArtifactRule and locates errors at the
+// offending token of the passed rule, see PointerError.
+func parseArtifactRule(rule []string) (ArtifactRule, error) {
+	parsed, err := ParseArtifactRule(rule)
+	var ruleErr *ArtifactRuleError
+	if errors.As(err, &ruleErr) {
+		return ArtifactRule{}, atPointer(err, []interface{}{ruleErr.Token}, "")
+	}
+	return parsed, err
+}
+
+// Tokens returns the rule list of the rule on which it was called, with upper
+// case keywords, i.e. the inverse of ParseArtifactRule.
+func (r ArtifactRule) Tokens() []string {
+	tokens := []string{strings.ToUpper(r.Type), r.Pattern}
+	if r.Type != "match" {
+		return tokens
+	}
+	if r.SrcPrefix != "" {
+		tokens = append(tokens, "IN", r.SrcPrefix)
+	}
+	tokens = append(tokens, "WITH", strings.ToUpper(r.DstType))
+	if r.DstPrefix != "" {
+		tokens = append(tokens, "IN", r.DstPrefix)
+	}
+	return append(tokens, "FROM", r.DstName)
+}
+
+// String returns the tokens of the rule on which it was called, separated by
+// spaces.
+func (r ArtifactRule) String() string {
+	return strings.Join(r.Tokens(), " ")
+}
+
+/*
+UnpackRule parses the passed rule and extracts and returns the information
+required for rule processing, see ParseArtifactRule for the available rule
+formats.  The returned map has the following format:
 
 	{
-		"type": "match" | "create" | "delete" |"modify" | "allow" | "disallow"
+		"type": "match" | "create" | "delete" |"modify" | "allow" | "disallow" | "require"
 		"pattern": "<file name pattern>",
 		"srcPrefix": "<path or empty string>", // MATCH rule only
 		"dstPrefix": "<path or empty string>", // MATCH rule only
@@ -45,87 +261,22 @@ If the rule does not match any of the available formats the first return value
 is nil and the second return value is the error.
 */
 func UnpackRule(rule []string) (map[string]string, error) {
-	// Cache rule len
-	ruleLen := len(rule)
-
-	// Create all lower rule copy to case-insensitively parse out tokens whose
-	// position we don't know yet. We keep the original rule to retain the
-	// non-token elements' case.
-	ruleLower := make([]string, ruleLen)
-	for i, val := range rule {
-		ruleLower[i] = strings.ToLower(val)
-	}
-
-	switch ruleLower[0] {
-	case "create", "modify", "delete", "allow", "disallow", "require":
-		if ruleLen != 2 {
-			return nil,
-				fmt.Errorf("%s Got:\n\t %s", errorMsg, rule)
-		}
-
-		return map[string]string{
-			"type":    ruleLower[0],
-			"pattern": rule[1],
-		}, nil
-
-	case "match":
-		var srcPrefix string
-		var dstType string
-		var dstPrefix string
-		var dstName string
-
-		// MATCH <pattern> IN <source-path-prefix> WITH (MATERIALS|PRODUCTS) \
-		// IN <destination-path-prefix> FROM <step>
-		if ruleLen == 10 && ruleLower[2] == "in" &&
-			ruleLower[4] == "with" && ruleLower[6] == "in" &&
-			ruleLower[8] == "from" {
-			srcPrefix = rule[3]
-			dstType = ruleLower[5]
-			dstPrefix = rule[7]
-			dstName = rule[9]
-			// MATCH <pattern> IN <source-path-prefix> WITH (MATERIALS|PRODUCTS) \
-			// FROM <step>
-		} else if ruleLen == 8 && ruleLower[2] == "in" &&
-			ruleLower[4] == "with" && ruleLower[6] == "from" {
-			srcPrefix = rule[3]
-			dstType = ruleLower[5]
-			dstPrefix = ""
-			dstName = rule[7]
-
-			// MATCH <pattern> WITH (MATERIALS|PRODUCTS) IN <destination-path-prefix>
-			// FROM <step>
-		} else if ruleLen == 8 && ruleLower[2] == "with" &&
-			ruleLower[4] == "in" && ruleLower[6] == "from" {
-			srcPrefix = ""
-			dstType = ruleLower[3]
-			dstPrefix = rule[5]
-			dstName = rule[7]
-
-			// MATCH <pattern> WITH (MATERIALS|PRODUCTS) FROM <step>
-		} else if ruleLen == 6 && ruleLower[2] == "with" &&
-			ruleLower[4] == "from" {
-			srcPrefix = ""
-			dstType = ruleLower[3]
-			dstPrefix = ""
-			dstName = rule[5]
-
-		} else {
-			return nil,
-				fmt.Errorf("%s Got:\n\t %s", errorMsg, rule)
-
-		}
-
+	parsed, err := ParseArtifactRule(rule)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Type != "match" {
 		return map[string]string{
-			"type":      ruleLower[0],
-			"pattern":   rule[1],
-			"srcPrefix": srcPrefix,
-			"dstPrefix": dstPrefix,
-			"dstType":   dstType,
-			"dstName":   dstName,
+			"type":    parsed.Type,
+			"pattern": parsed.Pattern,
 		}, nil
-
-	default:
-		return nil,
-			fmt.Errorf("%s Got:\n\t %s", errorMsg, rule)
 	}
+	return map[string]string{
+		"type":      parsed.Type,
+		"pattern":   parsed.Pattern,
+		"srcPrefix": parsed.SrcPrefix,
+		"dstPrefix": parsed.DstPrefix,
+		"dstType":   parsed.DstType,
+		"dstName":   parsed.DstName,
+	}, nil
 }
@@ -1,6 +1,8 @@
 package in_toto
 
 import (
+	"errors"
+	"reflect"
 	"testing"
 )
 
@@ -14,6 +16,7 @@ func TestUnpackValidRules(t *testing.T) {
 		{"ALLOW", "foo"},
 		{"DISALLOW", "foo"},
 		{"REQUIRE", "foo"},
+		{"ABSENT", "*.pem"},
 		{"MATCH", "foo", "IN", "source-path", "WITH", "PRODUCTS", "IN",
 			"dest-path", "FROM", "step-name"},
 		{"MATCH", "foo", "IN", "source-path", "WITH", "MATERIALS",
@@ -32,6 +35,7 @@ func TestUnpackValidRules(t *testing.T) {
 		{"type": "allow", "pattern": "foo"},
 		{"type": "disallow", "pattern": "foo"},
 		{"type": "require", "pattern": "foo"},
+		{"type": "absent", "pattern": "*.pem"},
 		{"type": "match", "pattern": "foo",
 			"srcPrefix": "source-path", "dstPrefix": "dest-path",
 			"dstType": "products", "dstName": "step-name"},
@@ -78,3 +82,65 @@ func TestUnpackInvalidRules(t *testing.T) {
 		}
 	}
 }
+
+func TestParseArtifactRuleRoundTrip(t *testing.T) {
+	rules := [][]string{
+		{"CREATE", "foo"},
+		{"REQUIRE", "foo"},
+		{"ABSENT", "*.key"},
+		{"MATCH", "foo", "IN", "source-path", "WITH", "PRODUCTS", "IN",
+			"dest-path", "FROM", "step-name"},
+		{"MATCH", "foo", "WITH", "MATERIALS", "FROM", "step-name"},
+	}
+	for _, rule := range rules {
+		parsed, err := ParseArtifactRule(rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(parsed.Tokens(), rule) {
+			t.Errorf("rule %s parsed to %#v, which returned tokens %s", rule, parsed, parsed.Tokens())
+		}
+	}
+
+	parsed, err := ParseArtifactRule([]string{"match", "Foo", "with", "Products", "from", "Build"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := ArtifactRule{Type: "match", Pattern: "Foo", DstType: "products", DstName: "Build"}
+	if parsed != expected {
+		t.Errorf("ParseArtifactRule returned %#v, expected %#v", parsed, expected)
+	}
+	if parsed.String() != "MATCH Foo WITH PRODUCTS FROM Build" {
+		t.Errorf("unexpected rule string '%s'", parsed.String())
+	}
+}
+
+func TestParseArtifactRuleErrorToken(t *testing.T) {
+	tables := []struct {
+		rule  []string
+		token int
+	}{
+		{[]string{}, 0},
+		{[]string{"SUBVERT", "foo"}, 0},
+		{[]string{"MODIFY"}, 1},
+		{[]string{"CREATE", "foo", "too-long"}, 2},
+		{[]string{"MATCH", "foo", "too-many-patterns", "WITH", "PRODUCTS", "FROM", "step-name"}, 2},
+		{[]string{"MATCH", "foo", "IN"}, 3},
+		{[]string{"MATCH", "foo", "WITH", "GUMMY", "FROM", "step-name"}, 3},
+		{[]string{"MATCH", "foo", "WITH", "PRODUCTS", "TO", "step-name"}, 4},
+		{[]string{"MATCH", "foo", "WITH", "PRODUCTS", "IN", "dest-path", "FROM"}, 7},
+		{[]string{"MATCH", "foo", "WITH", "PRODUCTS", "FROM", "step-name", "extra"}, 6},
+	}
+	for _, table := range tables {
+		_, err := ParseArtifactRule(table.rule)
+		var ruleErr *ArtifactRuleError
+		if !errors.As(err, &ruleErr) || !errors.Is(err, ErrInvalidArtifactRule) {
+			t.Errorf("rule %s should return an ArtifactRuleError, got: %v", table.rule, err)
+			continue
+		}
+		if ruleErr.Token != table.token {
+			t.Errorf("rule %s should fail at token %d, got %d: %s", table.rule,
+				table.token, ruleErr.Token, err)
+		}
+	}
+}
@@ -2,15 +2,21 @@ package in_toto
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"reflect"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/shibumi/go-pathspec"
 )
@@ -23,12 +29,21 @@ var ErrUnsupportedHashAlgorithm = errors.New("unsupported hash algorithm detecte
 
 var ErrEmptyCommandArgs = errors.New("the command args are empty")
 
-// visitedSymlinks is a hashset that contains all paths that we have visited.
-var visitedSymlinks Set
+// ErrNonUniqueArtifactName signals that left-stripping paths in
+// RecordArtifacts() has resulted in the same name for two artifacts.
+var ErrNonUniqueArtifactName = errors.New("left stripping has resulted in non unique dictionary key")
+
+/*
+ArtifactHashWorkers is the number of files that are hashed concurrently when
+recording artifacts, e.g. with RecordArtifacts.  Values smaller than one use
+GOMAXPROCS workers.  One worker hashes all files sequentially.
+*/
+var ArtifactHashWorkers = 0
 
 /*
 RecordArtifact reads and hashes the contents of the file at the passed path
-using sha256 and returns a map in the following format:
+using the passed hash algorithms, e.g. sha256, and returns a map in the
+following format:
 
 	{
 		"<path>": {
@@ -36,48 +51,115 @@ using sha256 and returns a map in the following format:
 		}
 	}
 
+The file is streamed through the hash functions, see ArtifactHashBufferSize.
 If reading the file fails, the first return value is nil and the second return
 value is the error.
 NOTE: For cross-platform consistency Windows-style line separators (CRLF) are
 normalized to Unix-style line separators (LF) before hashing file contents.
 */
 func RecordArtifact(path string, hashAlgorithms []string, lineNormalization bool) (HashObj, error) {
-	supportedHashMappings := getHashMapping()
 	// Read file from passed path
-	contents, err := os.ReadFile(path)
-	hashedContentsMap := make(HashObj)
+	file, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
+	defer file.Close()
+
+	// Return it in a format that is conformant with link metadata artifacts
+	return hashReader(file, hashAlgorithms, lineNormalization)
+}
+
+/*
+RecordArtifactReader hashes the contents read from the passed reader until EOF
+using the passed hash algorithms, and returns them as artifact of the passed
+name, e.g. "deploy/manifest.yaml", in the following format:
+
+	{
+		"<name>": {
+			"sha256": <hex representation of hash>
+		}
+	}
 
-	if lineNormalization {
-		// "Normalize" file contents. We convert all line separators to '\n'
-		// for keeping operating system independence
-		contents = bytes.ReplaceAll(contents, []byte("\r\n"), []byte("\n"))
-		contents = bytes.ReplaceAll(contents, []byte("\r"), []byte("\n"))
+Artifacts generated in memory, e.g. rendered manifests, can so be recorded as
+materials or products without writing them to files first, see
+WithMaterialArtifacts.  Contents are hashed as they are, i.e. without line
+normalization.
+*/
+func RecordArtifactReader(name string, r io.Reader, hashAlgorithms []string) (map[string]HashObj, error) {
+	if name == "" {
+		return nil, fmt.Errorf("artifact name must not be empty")
 	}
+	hashes, err := hashReader(r, hashAlgorithms, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record artifact '%s': %w", name, err)
+	}
+	return map[string]HashObj{name: hashes}, nil
+}
 
-	// Create a map of all the hashes present in the hash_func list
-	for _, element := range hashAlgorithms {
-		if _, ok := supportedHashMappings[element]; !ok {
-			return nil, fmt.Errorf("%w: %s", ErrUnsupportedHashAlgorithm, element)
+// RecordArtifactBytes behaves like RecordArtifactReader, but hashes the passed
+// data.
+func RecordArtifactBytes(name string, data []byte, hashAlgorithms []string) (map[string]HashObj, error) {
+	return RecordArtifactReader(name, bytes.NewReader(data), hashAlgorithms)
+}
+
+// addArtifacts adds the passed recorded artifacts, e.g. as returned by
+// RecordArtifactBytes, to the passed artifacts, and returns an error if an
+// artifact name is recorded more than once.
+func addArtifacts(artifacts map[string]HashObj, recorded []map[string]HashObj) (map[string]HashObj, error) {
+	for _, recordedArtifacts := range recorded {
+		for name, hashes := range recordedArtifacts {
+			if _, ok := artifacts[name]; ok {
+				return nil, fmt.Errorf("artifact '%s' is recorded more than once", name)
+			}
+			artifacts[name] = hashes
 		}
-		h := supportedHashMappings[element]
-		result := fmt.Sprintf("%x", hashToHex(h(), contents))
-		hashedContentsMap[element] = result
 	}
+	return artifacts, nil
+}
 
-	// Return it in a format that is conformant with link metadata artifacts
-	return hashedContentsMap, nil
+/*
+recordArtifactContext behaves like RecordArtifact, but stops reading the file
+when the passed context is done, so that hashing huge artifacts can be
+aborted.  If textLineNormalization is set, line separators are only
+normalized if the file is text, see sniffText.
+*/
+func recordArtifactContext(ctx context.Context, path string, hashAlgorithms []string, lineNormalization bool,
+	textLineNormalization bool) (HashObj, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var r io.Reader = &contextReader{ctx: ctx, r: file}
+	if textLineNormalization {
+		r, lineNormalization, err = sniffText(r)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return hashReader(r, hashAlgorithms, lineNormalization)
+}
+
+// contextReader reads from r until ctx is done, and returns the error of ctx
+// afterwards.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
 }
 
 /*
-RecordArtifacts is a wrapper around recordArtifacts.
-RecordArtifacts initializes a set for storing visited symlinks,
-calls recordArtifacts and deletes the set if no longer needed.
-recordArtifacts walks through the passed slice of paths, traversing
-subdirectories, and calls RecordArtifact for each file. It returns a map in
-the following format:
+RecordArtifacts is a wrapper around recordArtifacts, which walks through the passed slice of paths, traversing
+subdirectories, and RecordArtifact is called for each found file, using
+ArtifactHashWorkers concurrent workers. Each file is hashed with each of the
+passed hash algorithms, see SupportedHashAlgorithms. It returns a map in the
+following format:
 
 	{
 		"<path>": {
@@ -89,15 +171,91 @@ the following format:
 		...
 	}
 
+Artifact paths that start with one of the passed lStripPaths are recorded
+without the first matching prefix, so that artifacts recorded in different
+working directories compare equal, e.g. "/tmp/build/foo" is recorded as "foo"
+with the prefix "/tmp/build/".  If left-stripping results in the same name for
+two artifacts, ErrNonUniqueArtifactName is returned.
+
+Symlinks to directories, which lead to a cycle, return ErrSymCycle, and
+device files, sockets and FIFOs are skipped, see the SymlinkCyclePolicy and
+SpecialFilePolicy of ArtifactProfile to change this.
+
 If recording an artifact fails the first return value is nil and the second
 return value is the error.
 */
 func RecordArtifacts(paths []string, hashAlgorithms []string, gitignorePatterns []string, lStripPaths []string, lineNormalization bool, followSymlinkDirs bool) (evalArtifacts map[string]HashObj, err error) {
-	// Make sure to initialize a fresh hashset for every RecordArtifacts call
-	visitedSymlinks = NewSet()
-	evalArtifactsUnnormalized, err := recordArtifacts(paths, hashAlgorithms, gitignorePatterns, lStripPaths, lineNormalization, followSymlinkDirs)
+	return RecordArtifactsContext(context.Background(), paths, hashAlgorithms, gitignorePatterns, lStripPaths, lineNormalization, followSymlinkDirs)
+}
+
+/*
+RecordArtifactsContext behaves like RecordArtifacts, but stops walking and
+hashing artifacts when the passed context is done, e.g. when a CI job is
+cancelled, and returns the error of the context.
+*/
+func RecordArtifactsContext(ctx context.Context, paths []string, hashAlgorithms []string, gitignorePatterns []string, lStripPaths []string, lineNormalization bool, followSymlinkDirs bool) (evalArtifacts map[string]HashObj, err error) {
+	evalArtifacts, _, err = recordArtifactsWithContentTypes(ctx, paths, hashAlgorithms, ArtifactProfile{
+		ExcludePatterns:   gitignorePatterns,
+		LStripPaths:       lStripPaths,
+		LineNormalization: lineNormalization,
+		FollowSymlinkDirs: followSymlinkDirs,
+	})
+	return evalArtifacts, err
+}
+
+/*
+recordArtifactsWithProfile implements RecordArtifacts and
+ArtifactProfile.RecordArtifacts.  It records the artifacts at the passed paths
+with the passed hash algorithms and all other options of the passed profile.
+*/
+func recordArtifactsWithProfile(paths []string, hashAlgorithms []string, profile ArtifactProfile) (evalArtifacts map[string]HashObj, err error) {
+	evalArtifacts, _, err = recordArtifactsWithContentTypes(context.Background(), paths, hashAlgorithms, profile)
+	return evalArtifacts, err
+}
+
+/*
+recordArtifactsWithContentTypes behaves like recordArtifactsWithProfile, and
+additionally returns the content types of the recorded artifacts by artifact
+name, if DetectContentTypes is set in the passed profile, or nil otherwise.
+Walking and hashing stops when the passed context is done.
+*/
+func recordArtifactsWithContentTypes(ctx context.Context, paths []string, hashAlgorithms []string, profile ArtifactProfile) (evalArtifacts map[string]HashObj, contentTypes map[string]string, err error) {
+	if err := validateHashAlgorithms(hashAlgorithms); err != nil {
+		return nil, nil, err
+	}
+	if err := validateArtifactPolicies(profile); err != nil {
+		return nil, nil, err
+	}
+
+	artifactPaths, linkTargets, err := recordArtifacts(ctx, paths, profile, nil)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	vendorArtifacts, err := recordGoVendorArtifacts(artifactPaths, hashAlgorithms, profile)
+	if err != nil {
+		return nil, nil, err
+	}
+	evalArtifactsUnnormalized, err := hashArtifacts(ctx, artifactPaths, hashAlgorithms, profile)
+	if err != nil {
+		return nil, nil, err
+	}
+	for name, digest := range vendorArtifacts {
+		if _, exists := evalArtifactsUnnormalized[name]; exists {
+			return nil, nil, fmt.Errorf("%w: %s", ErrNonUniqueArtifactName, name)
+		}
+		evalArtifactsUnnormalized[name] = digest
+	}
+	if err := recordLinkTargets(evalArtifactsUnnormalized, linkTargets, hashAlgorithms); err != nil {
+		return nil, nil, err
+	}
+	if profile.DetectContentTypes {
+		contentTypes, err = detectContentTypes(artifactPaths)
+		if err != nil {
+			return nil, nil, err
+		}
+		for name := range linkTargets {
+			contentTypes[filepath.ToSlash(name)] = SymlinkContentType
+		}
 	}
 
 	// Normalize all paths in evalArtifactsUnnormalized.
@@ -107,49 +265,100 @@ func RecordArtifacts(paths []string, hashAlgorithms []string, gitignorePatterns
 		evalArtifacts[filepath.ToSlash(key)] = value
 	}
 
-	return evalArtifacts, nil
+	return evalArtifacts, contentTypes, nil
 }
 
 /*
 recordArtifacts walks through the passed slice of paths, traversing
-subdirectories, and calls RecordArtifact for each file. It returns a map in
-the following format:
-
-	{
-		"<path>": {
-			"sha256": <hex representation of hash>
-		},
-		"<path>": {
-		"sha256": <hex representation of hash>
-		},
-		...
-	}
-
-If recording an artifact fails the first return value is nil and the second
-return value is the error.
+subdirectories, and returns the paths of all files to record by artifact name,
+i.e. the path after left-stripping and resolving symlinks.  The files are
+hashed afterwards, see hashArtifacts.  Exclude patterns, left-stripping and
+the handling of symlinks and directories are configured by the passed
+profile.  Empty directories are recorded with a trailing slash and map to an
+empty path.  Directories recorded as a single artifact are recorded with a
+trailing slash, too, and map to their path with a trailing separator.
+
+Symlinks, which lead to a cycle, and special files are handled according to
+the SymlinkCyclePolicy and SpecialFilePolicy of the passed profile.  The
+targets of symlinks recorded with ArtifactPolicyRecordTarget are returned by
+artifact name as second return value.  The passed followedDirs are the real
+paths of the directories walked by the callers, when following symlinks to
+directories, see isSymlinkCycle.
+
+If walking a path fails, or the passed context is done, the first return
+value is nil and the last return value is the error.
 */
-func recordArtifacts(paths []string, hashAlgorithms []string, gitignorePatterns []string, lStripPaths []string, lineNormalization bool, followSymlinkDirs bool) (map[string]HashObj, error) {
-	artifacts := make(map[string]HashObj)
-	for _, path := range paths {
-		err := filepath.Walk(path,
+func recordArtifacts(ctx context.Context, paths []string, profile ArtifactProfile, followedDirs []string) (map[string]string, map[string]string, error) {
+	artifacts := make(map[string]string)
+	linkTargets := make(map[string]string)
+	log := loggerFromContext(ctx)
+	for _, root := range paths {
+		walkedDirs := followedDirs
+		if info, err := os.Lstat(root); err == nil && info.IsDir() {
+			rootDir, err := realDir(root)
+			if err != nil {
+				return nil, nil, err
+			}
+			walkedDirs = append(walkedDirs[:len(walkedDirs):len(walkedDirs)], rootDir)
+		}
+		err := filepath.Walk(root,
 			func(path string, info os.FileInfo, err error) error {
 				// Abort if Walk function has a problem,
 				// e.g. path does not exist
 				if err != nil {
 					return err
 				}
+				if err := ctx.Err(); err != nil {
+					return err
+				}
 				// We need to call pathspec.GitIgnore inside of our filepath.Walk, because otherwise
 				// we will not catch all paths. Just imagine a path like "." and a pattern like "*.pub".
 				// If we would call pathspec outside of the filepath.Walk this would not match.
-				ignore, err := pathspec.GitIgnore(gitignorePatterns, path)
+				ignore, err := isExcluded(profile.ExcludePatternSyntax, profile.ExcludePatterns, path)
 				if err != nil {
 					return err
 				}
 				if ignore {
+					logDebug(log, "excluded artifact", "path", path)
+					return nil
+				}
+				// The lock file of a metadata directory is no artifact, it
+				// is left behind by writing links, see writeMetadataFile
+				if !info.IsDir() && info.Name() == metadataDirLockName {
+					logDebug(log, "skipped metadata directory lock file", "path", path)
 					return nil
 				}
-				// Don't hash directories
+				// Don't hash directories, but optionally record empty ones,
+				// except for the passed paths themselves
 				if info.IsDir() {
+					dirHash, err := pathspec.GitIgnore(profile.DirHashPatterns, path)
+					if err != nil {
+						return err
+					}
+					if !dirHash && len(profile.GoVendorPatterns) > 0 {
+						dirHash, err = isGoVendorDir(path, profile.GoVendorPatterns)
+						if err != nil {
+							return err
+						}
+					}
+					if dirHash {
+						logDebug(log, "recording directory as single artifact", "path", path)
+						dirPath := filepath.Clean(path) + string(filepath.Separator)
+						if err := addArtifactPath(artifacts, dirPath, dirPath, profile.LStripPaths); err != nil {
+							return err
+						}
+						return filepath.SkipDir
+					}
+					if !profile.RecordEmptyDirs || path == root {
+						return nil
+					}
+					entries, err := os.ReadDir(path)
+					if err != nil {
+						return err
+					}
+					if len(entries) == 0 {
+						return addArtifactPath(artifacts, path+string(filepath.Separator), "", profile.LStripPaths)
+					}
 					return nil
 				}
 
@@ -160,14 +369,15 @@ func recordArtifacts(paths []string, hashAlgorithms []string, gitignorePatterns
 				// iterations. infoMode()&os.ModeSymlink uses the file
 				// type bitmask to check for a symlink.
 				if info.Mode()&os.ModeSymlink == os.ModeSymlink {
-					// return with error if we detect a symlink cycle
-					if ok := visitedSymlinks.Has(path); ok {
-						// this error will get passed through
-						// to RecordArtifacts()
-						return ErrSymCycle
+					if profile.SkipSymlinks {
+						logDebug(log, "skipped symlink", "path", path)
+						return nil
 					}
 					evalSym, err := filepath.EvalSymlinks(path)
 					if err != nil {
+						if isSymlinkLoop(path) {
+							return handleSymlinkCycle(log, profile, linkTargets, path)
+						}
 						return err
 					}
 					info, err := os.Stat(evalSym)
@@ -176,58 +386,192 @@ func recordArtifacts(paths []string, hashAlgorithms []string, gitignorePatterns
 					}
 					targetIsDir := false
 					if info.IsDir() {
-						if !followSymlinkDirs {
+						if !profile.FollowSymlinkDirs {
 							// We don't follow symlinked directories
+							logDebug(log, "skipped symlink to directory", "path", path, "target", evalSym)
 							return nil
 						}
 						targetIsDir = true
+						// Following the symlink would reach it again, if
+						// its target is walked already
+						targetDir, err := filepath.Abs(evalSym)
+						if err != nil {
+							return err
+						}
+						if isSymlinkCycle(targetDir, walkedDirs) {
+							return handleSymlinkCycle(log, profile, linkTargets, path)
+						}
 					}
-					// add symlink to visitedSymlinks set
-					// this way, we know which link we have visited already
-					// if we visit a symlink twice, we have detected a symlink cycle
-					visitedSymlinks.Add(path)
 					// We recursively call recordArtifacts() to follow
-					// the new path.
-					evalArtifacts, evalErr := recordArtifacts([]string{evalSym}, hashAlgorithms, gitignorePatterns, lStripPaths, lineNormalization, followSymlinkDirs)
+					// the new path.  Left-stripping is applied to the
+					// symlink paths below, not to the target paths.
+					evalProfile := profile
+					evalProfile.LStripPaths = nil
+					evalArtifacts, evalLinkTargets, evalErr := recordArtifacts(ctx, []string{evalSym}, evalProfile, walkedDirs)
 					if evalErr != nil {
 						return evalErr
 					}
-					for key, value := range evalArtifacts {
-						if targetIsDir {
-							symlinkPath := filepath.Join(path, strings.TrimPrefix(key, evalSym))
-							artifacts[symlinkPath] = value
-						} else {
-							artifacts[path] = value
+					symlinkPath := func(key string) string {
+						if !targetIsDir {
+							return path
+						}
+						p := filepath.Join(path, strings.TrimPrefix(key, evalSym))
+						if strings.HasSuffix(key, string(filepath.Separator)) {
+							p += string(filepath.Separator)
+						}
+						return p
+					}
+					for key, filePath := range evalArtifacts {
+						if err := addArtifactPath(artifacts, symlinkPath(key), filePath, profile.LStripPaths); err != nil {
+							return err
+						}
+					}
+					for key, target := range evalLinkTargets {
+						if err := addArtifactPath(linkTargets, symlinkPath(key), target, profile.LStripPaths); err != nil {
+							return err
 						}
 					}
 					return nil
 				}
-				artifact, err := RecordArtifact(path, hashAlgorithms, lineNormalization)
-				// Abort if artifact can't be recorded, e.g.
-				// due to file permissions
-				if err != nil {
-					return err
-				}
-
-				for _, strip := range lStripPaths {
-					if strings.HasPrefix(path, strip) {
-						path = strings.TrimPrefix(path, strip)
-						break
+				if isSpecialFile(info.Mode()) {
+					if profile.SpecialFilePolicy == ArtifactPolicyError {
+						return fmt.Errorf("%w: %s", ErrSpecialFile, path)
 					}
+					logDebug(log, "skipped special file", "path", path, "mode", info.Mode().String())
+					return nil
 				}
-				// Check if path is unique
-				if _, exists := artifacts[path]; exists {
-					return fmt.Errorf("left stripping has resulted in non unique dictionary key: %s", path)
-				}
-				artifacts[path] = artifact
-				return nil
+				return addArtifactPath(artifacts, path, path, profile.LStripPaths)
 			})
 
 		if err != nil {
-			return nil, err
+			return nil, nil, err
+		}
+	}
+
+	return artifacts, linkTargets, nil
+}
+
+/*
+handleSymlinkCycle handles the symlink at the passed path, which leads to a
+cycle, according to the SymlinkCyclePolicy of the passed profile, i.e. it
+returns ErrSymCycle, skips the symlink, or adds its target to the passed link
+targets, see ArtifactPolicyRecordTarget.
+*/
+func handleSymlinkCycle(log Logger, profile ArtifactProfile, linkTargets map[string]string, path string) error {
+	switch profile.SymlinkCyclePolicy {
+	case ArtifactPolicySkip:
+		logDebug(log, "skipped symlink cycle", "path", path)
+		return nil
+	case ArtifactPolicyRecordTarget:
+		target, err := os.Readlink(path)
+		if err != nil {
+			return err
 		}
+		logDebug(log, "recording symlink cycle as target", "path", path, "target", target)
+		return addArtifactPath(linkTargets, path, target, profile.LStripPaths)
+	}
+	return fmt.Errorf("%w: %s", ErrSymCycle, path)
+}
+
+/*
+addArtifactPath adds the passed file path to the passed artifact paths, named
+after the path left-stripped by the first matching lStripPaths prefix.
+Prefixes are matched with forward slashes on all platforms, so that e.g. the
+prefix "src/" also strips "src\" on Windows.
+*/
+func addArtifactPath(artifacts map[string]string, path string, filePath string, lStripPaths []string) error {
+	for _, strip := range lStripPaths {
+		if slashPath := filepath.ToSlash(path); strings.HasPrefix(slashPath, filepath.ToSlash(strip)) {
+			path = filepath.FromSlash(strings.TrimPrefix(slashPath, filepath.ToSlash(strip)))
+			break
+		}
+	}
+	// Check if path is unique
+	if _, exists := artifacts[path]; exists {
+		return fmt.Errorf("%w: %s", ErrNonUniqueArtifactName, path)
+	}
+	artifacts[path] = filePath
+	return nil
+}
+
+/*
+hashArtifacts records the files at the passed paths by artifact name, see
+RecordArtifact, using ArtifactHashWorkers concurrent workers.  The result does
+not depend on the number of workers.  Artifacts with an empty path, i.e. empty
+directories, are recorded without digests, and artifacts whose path ends with
+a separator are recorded as a single directory artifact, see RecordDirectory
+and ArtifactProfile.DirHashMode.  If recording an artifact fails, e.g.
+due to file permissions, the error of the first failed artifact in lexical
+order of artifact names is returned.  Artifacts are not hashed any further
+once the passed context is done, and its error is returned.
+*/
+func hashArtifacts(ctx context.Context, artifactPaths map[string]string, hashAlgorithms []string, profile ArtifactProfile) (map[string]HashObj, error) {
+	names := make([]string, 0, len(artifactPaths))
+	for name := range artifactPaths {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	workers := ArtifactHashWorkers
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > len(names) {
+		workers = len(names)
+	}
+
+	progress := &hashProgress{progress: progressFromContext(ctx), total: len(names)}
+	log := loggerFromContext(ctx)
+
+	// Each worker writes the results of the artifacts it hashed to the
+	// corresponding index, so no further synchronization is needed
+	hashes := make([]HashObj, len(names))
+	errs := make([]error, len(names))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				path := artifactPaths[names[j]]
+				switch {
+				case ctx.Err() != nil:
+					errs[j] = ctx.Err()
+				case path == "":
+					hashes[j] = HashObj{}
+				case strings.HasSuffix(path, string(filepath.Separator)):
+					hashes[j], errs[j] = recordDirectory(path, hashAlgorithms, profile.DirHashMode, profile.ExcludePatternSyntax, profile.ExcludePatterns)
+				default:
+					hashes[j], errs[j] = recordArtifactContext(ctx, path, hashAlgorithms, profile.LineNormalization,
+						profile.TextLineNormalization)
+				}
+				if errs[j] == nil {
+					logDebug(log, "hashed artifact", "artifact", names[j], "path", path, "hashes", hashes[j])
+				}
+				if errs[j] == nil && progress.progress != nil {
+					var size int64
+					if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+						size = info.Size()
+					}
+					progress.hashed(names[j], size)
+				}
+			}
+		}()
 	}
+	for j := range names {
+		jobs <- j
+	}
+	close(jobs)
+	wg.Wait()
 
+	artifacts := make(map[string]HashObj, len(names))
+	for j, name := range names {
+		if errs[j] != nil {
+			return nil, errs[j]
+		}
+		artifacts[name] = hashes[j]
+	}
 	return artifacts, nil
 }
 
@@ -269,84 +613,288 @@ and returns stdout, stderr and exit code.  The format of the returned map is:
 		"stderr": "<standard error>"
 	}
 
-If the command cannot be executed or no pipes for stdout or stderr can be
-created the first return value is nil and the second return value is the error.
+If the command cannot be executed the first return value is nil and the second
+return value is the error.
 NOTE: Since stdout and stderr are captured, they cannot be seen during the
-command execution.
+command execution.  See RunCommandWithByproducts to limit or disable capture.
 */
 func RunCommand(cmdArgs []string, runDir string) (map[string]interface{}, error) {
+	return RunCommandWithByproducts(cmdArgs, runDir, ByproductOptions{})
+}
+
+/*
+ByproductOptions configures how RunCommandWithByproducts captures the
+standard output and standard error of a command as link byproducts.
+
+  - DisableCapture passes stdout and stderr of the command through to the
+    stdout and stderr of the running process instead of capturing them.  The
+    "stdout" and "stderr" byproducts are then empty strings, like in the
+    reference implementation without recorded streams.
+  - MaxStdoutSize and MaxStderrSize limit the number of bytes captured of
+    each stream.  Further output is discarded.  Zero means no limit.
+*/
+type ByproductOptions struct {
+	DisableCapture bool
+	MaxStdoutSize  int
+	MaxStderrSize  int
+}
+
+// truncatingBuffer is an io.Writer that stores at most limit bytes, or all
+// bytes if limit is zero, and silently discards the rest.
+type truncatingBuffer struct {
+	buf   strings.Builder
+	limit int
+}
+
+func (b *truncatingBuffer) Write(p []byte) (int, error) {
+	if b.limit > 0 && b.buf.Len()+len(p) > b.limit {
+		b.buf.Write(p[:b.limit-b.buf.Len()])
+		return len(p), nil
+	}
+	b.buf.Write(p)
+	return len(p), nil
+}
+
+/*
+RunCommandWithByproducts behaves like RunCommand, but captures stdout and
+stderr of the command as configured by the passed options.  The returned map
+always has the format described in RunCommand.
+*/
+func RunCommandWithByproducts(cmdArgs []string, runDir string, opts ByproductOptions) (map[string]interface{}, error) {
+	return runCommand(context.Background(), cmdArgs, runDir, nil, opts)
+}
+
+// commandWaitDelay is how long runCommand waits for the output streams of a
+// command to be closed, after the command was killed because the context was
+// done, e.g. when subprocesses of the command hold them open.
+const commandWaitDelay = 5 * time.Second
+
+/*
+runCommand implements RunCommandWithByproducts.  The command is killed when
+the passed context is done.  If env is not nil, the command is run with
+exactly that environment, in the "key=value" format of os.Environ, instead of
+the environment of the current process.
+*/
+func runCommand(ctx context.Context, cmdArgs []string, runDir string, env []string, opts ByproductOptions) (map[string]interface{}, error) {
 	if len(cmdArgs) == 0 {
 		return nil, ErrEmptyCommandArgs
 	}
 
-	cmd := exec.Command(cmdArgs[0], cmdArgs[1:]...)
+	cmd := exec.CommandContext(ctx, cmdArgs[0], cmdArgs[1:]...)
+	cmd.WaitDelay = commandWaitDelay
+	cmd.Env = env
 
 	if runDir != "" {
 		cmd.Dir = runDir
 	}
 
-	stderrPipe, err := cmd.StderrPipe()
-	if err != nil {
-		return nil, err
-	}
-	stdoutPipe, err := cmd.StdoutPipe()
-	if err != nil {
-		return nil, err
+	// Both streams are copied concurrently, so that a command filling one
+	// of them can not block on the other
+	stdout := &truncatingBuffer{limit: opts.MaxStdoutSize}
+	stderr := &truncatingBuffer{limit: opts.MaxStderrSize}
+	if opts.DisableCapture {
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+	} else {
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
 	}
 
 	if err := cmd.Start(); err != nil {
 		return nil, err
 	}
 
-	// TODO: duplicate stdout, stderr
-	stdout, _ := io.ReadAll(stdoutPipe)
-	stderr, _ := io.ReadAll(stderrPipe)
-
 	retVal := waitErrToExitCode(cmd.Wait())
 
 	return map[string]interface{}{
-		"return-value": float64(retVal),
-		"stdout":       string(stdout),
-		"stderr":       string(stderr),
+		ReturnValueByproductKey: float64(retVal),
+		StdoutByproductKey:      stdout.buf.String(),
+		StderrByproductKey:      stderr.buf.String(),
 	}, nil
 }
 
+/*
+commandOptions configures how inTotoRun executes its command.
+
+  - byproducts configures the capture of the byproducts.
+  - env, if not nil, is the environment of the command, see runCommand.
+  - executor, if not nil, executes the command instead of running it on the
+    host, see CommandExecutor.  Byproduct options do not apply to executors.
+  - imageMaterials and imageProducts are the sources of container images
+    recorded before and after the command by artifact name, see RecordImage,
+    whose references are resolved by imageResolver.
+  - toolchains are the names of the toolchains, whose versions are recorded
+    in the Environment of the link, see CollectToolchainVersions.
+  - materials and products are artifacts recorded in memory, which are added
+    to the recorded materials and products, see RecordArtifactBytes.
+*/
+type commandOptions struct {
+	byproducts     ByproductOptions
+	env            []string
+	executor       CommandExecutor
+	imageMaterials map[string]string
+	imageProducts  map[string]string
+	imageResolver  ImageResolver
+	toolchains     []string
+	materials      []map[string]HashObj
+	products       []map[string]HashObj
+}
+
+// ErrAbsentProductRecorded is returned by Run and RecordStop, if a recorded
+// product matches a pattern asserted absent, see WithAbsentProducts.
+var ErrAbsentProductRecorded = errors.New("product asserted absent was recorded")
+
+// checkAbsentProducts returns an ErrAbsentProductRecorded, if any of the
+// passed products matches any of the passed patterns.
+func checkAbsentProducts(products map[string]HashObj, patterns []string) error {
+	productPaths := NewSet()
+	for _, p := range artifactsDictKeyStrings(products) {
+		productPaths.Add(path.Clean(p))
+	}
+	for _, pattern := range patterns {
+		if _, err := match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid absent product pattern '%s': %w", pattern, err)
+		}
+		if present := productPaths.filter(path.Clean(pattern), artifactMatcher{}); len(present) > 0 {
+			return fmt.Errorf("%w: %s match '%s'", ErrAbsentProductRecorded, present.Slice(), pattern)
+		}
+	}
+	return nil
+}
+
 /*
 InTotoRun executes commands, e.g. for software supply chain steps or
 inspections of an in-toto layout, and creates and returns corresponding link
 metadata.  Link metadata contains recorded products at the passed productPaths
-and materials at the passed materialPaths.  The returned link is wrapped in a
-Metablock object.  If command execution or artifact recording fails the first
+and materials at the passed materialPaths, recorded like in RecordArtifacts,
+e.g. without the passed lStripPaths prefixes.  The returned link is wrapped in
+a Metablock object.  If command execution or artifact recording fails the first
 return value is an empty Metablock and the second return value is the error.
 */
 func InTotoRun(name string, runDir string, materialPaths []string, productPaths []string, cmdArgs []string, key Key, hashAlgorithms []string, gitignorePatterns []string, lStripPaths []string, lineNormalization bool, followSymlinkDirs bool, useDSSE bool) (Metadata, error) {
-	materials, err := RecordArtifacts(materialPaths, hashAlgorithms, gitignorePatterns, lStripPaths, lineNormalization, followSymlinkDirs)
+	return inTotoRun(context.Background(), name, runDir, materialPaths, productPaths, nil, cmdArgs, key, hashAlgorithms, ArtifactProfile{
+		ExcludePatterns:   gitignorePatterns,
+		LStripPaths:       lStripPaths,
+		LineNormalization: lineNormalization,
+		FollowSymlinkDirs: followSymlinkDirs,
+	}, commandOptions{}, useDSSE)
+}
+
+/*
+InTotoRunContext behaves like InTotoRun, but kills the command and stops
+recording artifacts when the passed context is done, e.g. when a CI job is
+cancelled, and returns an error.
+*/
+func InTotoRunContext(ctx context.Context, name string, runDir string, materialPaths []string, productPaths []string, cmdArgs []string, key Key, hashAlgorithms []string, gitignorePatterns []string, lStripPaths []string, lineNormalization bool, followSymlinkDirs bool, useDSSE bool) (Metadata, error) {
+	return inTotoRun(ctx, name, runDir, materialPaths, productPaths, nil, cmdArgs, key, hashAlgorithms, ArtifactProfile{
+		ExcludePatterns:   gitignorePatterns,
+		LStripPaths:       lStripPaths,
+		LineNormalization: lineNormalization,
+		FollowSymlinkDirs: followSymlinkDirs,
+	}, commandOptions{}, useDSSE)
+}
+
+/*
+InTotoRunWithProfile behaves like InTotoRun, but records materials and
+products with the options of the passed artifact profile, e.g. to skip
+symlinks or record empty directories.
+*/
+func InTotoRunWithProfile(name string, runDir string, materialPaths []string, productPaths []string, cmdArgs []string, key Key, profile ArtifactProfile, useDSSE bool) (Metadata, error) {
+	return inTotoRun(context.Background(), name, runDir, materialPaths, productPaths, nil, cmdArgs, key, profile.GetHashAlgorithms(), profile, commandOptions{}, useDSSE)
+}
+
+/*
+InTotoRunWithByproducts behaves like InTotoRunWithProfile, but captures the
+stdout and stderr byproducts of the command as configured by the passed
+options, e.g. truncated to a maximum size, see RunCommandWithByproducts.
+*/
+func InTotoRunWithByproducts(name string, runDir string, materialPaths []string, productPaths []string, cmdArgs []string, key Key, profile ArtifactProfile, byproducts ByproductOptions, useDSSE bool) (Metadata, error) {
+	return inTotoRun(context.Background(), name, runDir, materialPaths, productPaths, nil, cmdArgs, key, profile.GetHashAlgorithms(), profile, commandOptions{byproducts: byproducts}, useDSSE)
+}
+
+// inTotoRun implements InTotoRun, tracing its operations as children of the
+// span in the passed context.  Artifacts are recorded with the passed hash
+// algorithms and all other options of the passed profile, and the command is
+// executed with the passed options.
+func inTotoRun(ctx context.Context, name string, runDir string, materialPaths []string, productPaths []string, absentProducts []string, cmdArgs []string, key Key, hashAlgorithms []string, profile ArtifactProfile, cmdOpts commandOptions, useDSSE bool) (linkEnv Metadata, err error) {
+	ctx, runStage := startStage(ctx, "in_toto.InTotoRun", name)
+	runStage.span.SetAttribute("in_toto.step", name)
+	defer func() { runStage.end(err) }()
+
+	recordCtx, recordStage := startStage(ctx, "in_toto.RecordArtifacts", "materials")
+	recordStage.span.SetAttribute("in_toto.artifact_type", "materials")
+	materials, materialTypes, err := recordArtifactsWithContentTypes(recordCtx, materialPaths, hashAlgorithms, profile)
+	if err == nil {
+		materials, err = recordImages(ctx, materials, cmdOpts.imageMaterials, cmdOpts.imageResolver)
+	}
+	if err == nil {
+		materials, err = addArtifacts(materials, cmdOpts.materials)
+	}
+	recordStage.end(err)
 	if err != nil {
 		return nil, err
 	}
 
+	var toolchainVersions map[string]string
+	if len(cmdOpts.toolchains) > 0 {
+		toolchainVersions, err = CollectToolchainVersions(ctx, runDir, cmdOpts.toolchains...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// make sure that we only run RunCommand if cmdArgs is not nil or empty
 	byProducts := map[string]interface{}{}
 	if len(cmdArgs) != 0 {
-		byProducts, err = RunCommand(cmdArgs, runDir)
+		_, commandStage := startStage(ctx, "in_toto.RunCommand", name)
+		commandStage.span.SetAttribute("in_toto.command", cmdArgs)
+		if cmdOpts.executor != nil {
+			byProducts, err = executeCommand(ctx, cmdOpts.executor, cmdArgs, runDir, cmdOpts.env)
+		} else {
+			byProducts, err = runCommand(ctx, cmdArgs, runDir, cmdOpts.env, cmdOpts.byproducts)
+		}
+		// A command killed on cancellation did not complete the step
+		if err == nil {
+			err = ctx.Err()
+		}
+		commandStage.end(err)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	products, err := RecordArtifacts(productPaths, hashAlgorithms, gitignorePatterns, lStripPaths, lineNormalization, followSymlinkDirs)
+	recordCtx, recordStage = startStage(ctx, "in_toto.RecordArtifacts", "products")
+	recordStage.span.SetAttribute("in_toto.artifact_type", "products")
+	products, productTypes, err := recordArtifactsWithContentTypes(recordCtx, productPaths, hashAlgorithms, profile)
+	if err == nil {
+		products, err = recordImages(ctx, products, cmdOpts.imageProducts, cmdOpts.imageResolver)
+	}
+	if err == nil {
+		products, err = addArtifacts(products, cmdOpts.products)
+	}
+	if err == nil {
+		err = checkAbsentProducts(products, absentProducts)
+	}
+	recordStage.end(err)
 	if err != nil {
 		return nil, err
 	}
 
 	link := Link{
-		Type:        "link",
-		Name:        name,
-		Materials:   materials,
-		Products:    products,
-		ByProducts:  byProducts,
-		Command:     cmdArgs,
-		Environment: map[string]interface{}{},
+		Type:           "link",
+		Name:           name,
+		Materials:      materials,
+		Products:       products,
+		ByProducts:     byProducts,
+		Command:        cmdArgs,
+		Environment:    map[string]interface{}{},
+		AbsentProducts: absentProducts,
+	}
+	if profile.DetectContentTypes {
+		setArtifactContentTypes(&link, ArtifactContentTypes{Materials: materialTypes, Products: productTypes})
+	}
+	if toolchainVersions != nil {
+		setToolchainVersions(&link, toolchainVersions)
 	}
 
 	if useDSSE {
@@ -354,34 +902,61 @@ func InTotoRun(name string, runDir string, materialPaths []string, productPaths
 		if err := env.SetPayload(link); err != nil {
 			return nil, err
 		}
-
-		if !reflect.ValueOf(key).IsZero() {
-			if err := env.Sign(key); err != nil {
-				return nil, err
-			}
-		}
-
-		return env, nil
+		linkEnv = env
+	} else {
+		linkEnv = &Metablock{Signed: link, Signatures: []Signature{}}
 	}
 
-	linkMb := &Metablock{Signed: link, Signatures: []Signature{}}
 	if !reflect.ValueOf(key).IsZero() {
-		if err := linkMb.Sign(key); err != nil {
+		_, signSpan := startSpan(ctx, "in_toto.Sign")
+		err = linkEnv.Sign(key)
+		endSpan(signSpan, err)
+		if err != nil {
 			return nil, err
 		}
 	}
 
-	return linkMb, nil
+	return linkEnv, nil
 }
 
 /*
 InTotoRecordStart begins the creation of a link metablock file in two steps,
-in order to provide evidence for supply chain steps that cannot be carries out
+in order to provide evidence for supply chain steps that cannot be carried out
 by a single command.  InTotoRecordStart collects the hashes of the materials
 before any commands are run, signs the unfinished link, and returns the link.
 */
 func InTotoRecordStart(name string, materialPaths []string, key Key, hashAlgorithms, gitignorePatterns []string, lStripPaths []string, lineNormalization bool, followSymlinkDirs bool, useDSSE bool) (Metadata, error) {
-	materials, err := RecordArtifacts(materialPaths, hashAlgorithms, gitignorePatterns, lStripPaths, lineNormalization, followSymlinkDirs)
+	return InTotoRecordStartContext(context.Background(), name, materialPaths, key, hashAlgorithms, gitignorePatterns, lStripPaths, lineNormalization, followSymlinkDirs, useDSSE)
+}
+
+// InTotoRecordStartContext behaves like InTotoRecordStart, but stops recording
+// materials when the passed context is done and returns an error.
+func InTotoRecordStartContext(ctx context.Context, name string, materialPaths []string, key Key, hashAlgorithms, gitignorePatterns []string, lStripPaths []string, lineNormalization bool, followSymlinkDirs bool, useDSSE bool) (Metadata, error) {
+	return inTotoRecordStart(ctx, name, materialPaths, nil, key, hashAlgorithms, ArtifactProfile{
+		ExcludePatterns:   gitignorePatterns,
+		LStripPaths:       lStripPaths,
+		LineNormalization: lineNormalization,
+		FollowSymlinkDirs: followSymlinkDirs,
+	}, useDSSE)
+}
+
+// InTotoRecordStartWithProfile behaves like InTotoRecordStart, but records
+// materials with the options of the passed artifact profile.
+func InTotoRecordStartWithProfile(name string, materialPaths []string, key Key, profile ArtifactProfile, useDSSE bool) (Metadata, error) {
+	return inTotoRecordStart(context.Background(), name, materialPaths, nil, key, profile.GetHashAlgorithms(), profile, useDSSE)
+}
+
+// inTotoRecordStart implements InTotoRecordStart, recording artifacts with the
+// passed hash algorithms and all other options of the passed profile, and
+// adding the passed materials recorded in memory.
+func inTotoRecordStart(ctx context.Context, name string, materialPaths []string, memoryMaterials []map[string]HashObj, key Key, hashAlgorithms []string, profile ArtifactProfile, useDSSE bool) (Metadata, error) {
+	recordCtx, recordStage := startStage(ctx, "in_toto.RecordArtifacts", "materials")
+	recordStage.span.SetAttribute("in_toto.artifact_type", "materials")
+	materials, materialTypes, err := recordArtifactsWithContentTypes(recordCtx, materialPaths, hashAlgorithms, profile)
+	if err == nil {
+		materials, err = addArtifacts(materials, memoryMaterials)
+	}
+	recordStage.end(err)
 	if err != nil {
 		return nil, err
 	}
@@ -395,6 +970,9 @@ func InTotoRecordStart(name string, materialPaths []string, key Key, hashAlgorit
 		Command:     []string{},
 		Environment: map[string]interface{}{},
 	}
+	if profile.DetectContentTypes {
+		setArtifactContentTypes(&link, ArtifactContentTypes{Materials: materialTypes})
+	}
 
 	if useDSSE {
 		env := &Envelope{}
@@ -425,26 +1003,75 @@ func InTotoRecordStart(name string, materialPaths []string, key Key, hashAlgorit
 /*
 InTotoRecordStop ends the creation of a metatadata link file created by
 InTotoRecordStart. InTotoRecordStop takes in a signed unfinished link metablock
-created by InTotoRecordStart and records the hashes of any products creted by
+created by InTotoRecordStart and records the hashes of any products created by
 commands run between InTotoRecordStart and InTotoRecordStop.  The resultant
 finished link metablock is then signed by the provided key and returned.
 */
 func InTotoRecordStop(prelimLinkEnv Metadata, productPaths []string, key Key, hashAlgorithms, gitignorePatterns []string, lStripPaths []string, lineNormalization bool, followSymlinkDirs bool, useDSSE bool) (Metadata, error) {
+	return InTotoRecordStopContext(context.Background(), prelimLinkEnv, productPaths, key, hashAlgorithms, gitignorePatterns, lStripPaths, lineNormalization, followSymlinkDirs, useDSSE)
+}
+
+// InTotoRecordStopContext behaves like InTotoRecordStop, but stops recording
+// products when the passed context is done and returns an error.
+func InTotoRecordStopContext(ctx context.Context, prelimLinkEnv Metadata, productPaths []string, key Key, hashAlgorithms, gitignorePatterns []string, lStripPaths []string, lineNormalization bool, followSymlinkDirs bool, useDSSE bool) (Metadata, error) {
+	return inTotoRecordStop(ctx, prelimLinkEnv, productPaths, nil, nil, key, hashAlgorithms, ArtifactProfile{
+		ExcludePatterns:   gitignorePatterns,
+		LStripPaths:       lStripPaths,
+		LineNormalization: lineNormalization,
+		FollowSymlinkDirs: followSymlinkDirs,
+	}, useDSSE)
+}
+
+// InTotoRecordStopWithProfile behaves like InTotoRecordStop, but records
+// products with the options of the passed artifact profile.
+func InTotoRecordStopWithProfile(prelimLinkEnv Metadata, productPaths []string, key Key, profile ArtifactProfile, useDSSE bool) (Metadata, error) {
+	return inTotoRecordStop(context.Background(), prelimLinkEnv, productPaths, nil, nil, key, profile.GetHashAlgorithms(), profile, useDSSE)
+}
+
+// inTotoRecordStop implements InTotoRecordStop, recording artifacts with the
+// passed hash algorithms and all other options of the passed profile, and
+// adding the passed products recorded in memory.
+func inTotoRecordStop(ctx context.Context, prelimLinkEnv Metadata, productPaths []string, memoryProducts []map[string]HashObj, absentProducts []string, key Key, hashAlgorithms []string, profile ArtifactProfile, useDSSE bool) (Metadata, error) {
 	if err := prelimLinkEnv.VerifySignature(key); err != nil {
 		return nil, err
 	}
+	return recordStopLink(ctx, prelimLinkEnv, productPaths, memoryProducts, absentProducts, key, hashAlgorithms, profile, useDSSE)
+}
 
+// recordStopLink implements inTotoRecordStop, without verifying the signature
+// of the passed unfinished link.  The finished link is signed with the passed
+// key, unless it is empty.
+func recordStopLink(ctx context.Context, prelimLinkEnv Metadata, productPaths []string, memoryProducts []map[string]HashObj, absentProducts []string, key Key, hashAlgorithms []string, profile ArtifactProfile, useDSSE bool) (Metadata, error) {
 	link, ok := prelimLinkEnv.GetPayload().(Link)
 	if !ok {
 		return nil, errors.New("invalid metadata block")
 	}
 
-	products, err := RecordArtifacts(productPaths, hashAlgorithms, gitignorePatterns, lStripPaths, lineNormalization, followSymlinkDirs)
+	recordCtx, recordStage := startStage(ctx, "in_toto.RecordArtifacts", "products")
+	recordStage.span.SetAttribute("in_toto.artifact_type", "products")
+	products, productTypes, err := recordArtifactsWithContentTypes(recordCtx, productPaths, hashAlgorithms, profile)
+	if err == nil {
+		products, err = addArtifacts(products, memoryProducts)
+	}
+	recordStage.end(err)
 	if err != nil {
 		return nil, err
 	}
+	if err := checkAbsentProducts(products, absentProducts); err != nil {
+		return nil, err
+	}
 
 	link.Products = products
+	link.AbsentProducts = absentProducts
+	if profile.DetectContentTypes {
+		// Keep the content types of the materials recorded at the start
+		contentTypes, err := GetArtifactContentTypes(link)
+		if err != nil {
+			return nil, err
+		}
+		contentTypes.Products = productTypes
+		setArtifactContentTypes(&link, contentTypes)
+	}
 
 	if useDSSE {
 		env := &Envelope{}
@@ -471,6 +1098,64 @@ func InTotoRecordStop(prelimLinkEnv Metadata, productPaths []string, key Key, ha
 	return linkMb, nil
 }
 
+/*
+InTotoRecordStartFile behaves like InTotoRecordStartWithProfile, and writes
+the signed unfinished link to the passed directory, named after
+PreliminaryLinkNameFormat, i.e. '.<name>.<keyid prefix>.link-unfinished'.  It
+returns the path of the unfinished link file.  Steps that are carried out by
+humans or span multiple shell invocations can be recorded with
+InTotoRecordStartFile before and InTotoRecordStopFile after the step.
+*/
+func InTotoRecordStartFile(dir string, name string, materialPaths []string, key Key, profile ArtifactProfile, useDSSE bool) (string, error) {
+	prelimLinkEnv, err := InTotoRecordStartWithProfile(name, materialPaths, key, profile, useDSSE)
+	if err != nil {
+		return "", err
+	}
+
+	prelimLinkPath := filepath.Join(dir, fmt.Sprintf(PreliminaryLinkNameFormat, name, key.KeyID))
+	if err := prelimLinkEnv.Dump(prelimLinkPath); err != nil {
+		return "", err
+	}
+	return prelimLinkPath, nil
+}
+
+/*
+InTotoRecordStopFile loads the unfinished link of the passed step name and
+key from the passed directory, as written by InTotoRecordStartFile, and
+finishes it like InTotoRecordStopWithProfile.  The finished link is written
+to the directory, named after LinkNameFormat, and the unfinished link file
+is removed.  It returns the path of the link file.
+*/
+func InTotoRecordStopFile(dir string, name string, productPaths []string, key Key, profile ArtifactProfile, useDSSE bool) (string, error) {
+	return recordStopFile(dir, name, key, func(prelimLinkEnv Metadata) (Metadata, error) {
+		return InTotoRecordStopWithProfile(prelimLinkEnv, productPaths, key, profile, useDSSE)
+	})
+}
+
+// recordStopFile implements InTotoRecordStopFile and RecordStopFile, it
+// finishes the loaded unfinished link with stop.
+func recordStopFile(dir string, name string, key Key, stop func(Metadata) (Metadata, error)) (string, error) {
+	prelimLinkPath := filepath.Join(dir, fmt.Sprintf(PreliminaryLinkNameFormat, name, key.KeyID))
+	prelimLinkEnv, err := LoadMetadata(prelimLinkPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to load unfinished link: %w", err)
+	}
+
+	linkEnv, err := stop(prelimLinkEnv)
+	if err != nil {
+		return "", err
+	}
+
+	linkPath := filepath.Join(dir, fmt.Sprintf(LinkNameFormat, name, key.KeyID))
+	if err := linkEnv.Dump(linkPath); err != nil {
+		return "", err
+	}
+	if err := os.Remove(prelimLinkPath); err != nil {
+		return "", err
+	}
+	return linkPath, nil
+}
+
 /*
 InTotoMatchProducts checks if local artifacts match products in passed link.
 
@@ -513,17 +1198,7 @@ func InTotoMatchProducts(link *Link, paths []string, hashAlgorithms []string, ex
 	inBothSet := artifactsSet.Intersection(productsSet)
 	differ := []string{}
 	for name := range inBothSet {
-		linkHashes := HashObj{}
-		for alg, val := range link.Products[name] {
-			linkHashes[alg] = val
-		}
-
-		artifactHashes := HashObj{}
-		for alg, val := range artifacts[name] {
-			artifactHashes[alg] = val
-		}
-
-		if !reflect.DeepEqual(linkHashes, artifactHashes) {
+		if !hashObjsEqual(link.Products[name], artifacts[name]) {
 			differ = append(differ, name)
 		}
 	}
@@ -1,6 +1,10 @@
 package in_toto
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
 	"errors"
 	"fmt"
 	"io"
@@ -11,6 +15,8 @@ import (
 	"runtime"
 	"sort"
 	"testing"
+	"testing/iotest"
+	"time"
 
 	"github.com/secure-systems-lab/go-securesystemslib/dsse"
 	"github.com/stretchr/testify/assert"
@@ -46,6 +52,48 @@ func TestRecordArtifact(t *testing.T) {
 	}
 }
 
+func TestRecordArtifactBytes(t *testing.T) {
+	data, err := os.ReadFile("foo.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]HashObj{"dist/foo.tar.gz": {
+		"sha256": "52947cb78b91ad01fe81cd6aef42d1f6817e92b9e6936c1e5aabb7c98514f355",
+	}}
+
+	// Artifacts in memory hash like the files they would be written to
+	result, err := RecordArtifactBytes("dist/foo.tar.gz", data, []string{"sha256"})
+	assert.Nil(t, err)
+	assert.Equal(t, expected, result)
+	result, err = RecordArtifactReader("dist/foo.tar.gz", bytes.NewReader(data), []string{"sha256"})
+	assert.Nil(t, err)
+	assert.Equal(t, expected, result)
+
+	_, err = RecordArtifactBytes("", data, []string{"sha256"})
+	assert.NotNil(t, err)
+	_, err = RecordArtifactBytes("foo", data, []string{"invalid"})
+	assert.ErrorIs(t, err, ErrUnsupportedHashAlgorithm)
+	_, err = RecordArtifactReader("foo", io.MultiReader(bytes.NewReader(data), iotest.ErrReader(io.ErrUnexpectedEOF)), []string{"sha256"})
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestRecordArtifactHashAlgorithms(t *testing.T) {
+	assert.Equal(t, []string{"blake2b", "blake2b-256", "sha256", "sha384", "sha512"}, SupportedHashAlgorithms())
+
+	result, err := RecordArtifact("foo.tar.gz", []string{"sha384", "blake2b", "blake2b-256"}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, HashObj{
+		"sha384":      "ce17464027a7d7c15b15032b404fc76fdbadfa1fa566d7f7747020df2542a293b3098873a98dbbda6e461f7767b8ff6c",
+		"blake2b":     "7b000ead6d3e223c8c6fec960cd5f0fb36d81e256da8801b430bf17714342814b6680071eda0a7a0fa7db0dbfc09adc63f09a2eff4dd76b35771cee3f897cbc4",
+		"blake2b-256": "79952b04d721e6b940c54a3ab00c1dca75847b9eb125732d8b557740d8a309fb",
+	}, result)
+
+	// Unsupported hash algorithms are rejected, even if there is nothing to
+	// record
+	_, err = RecordArtifacts([]string{}, []string{"sha256", "md5"}, nil, nil, false, false)
+	assert.ErrorIs(t, err, ErrUnsupportedHashAlgorithm)
+}
+
 // copy helper function for building more complex test cases
 // for our TestGitPathSpec
 func copy(src, dst string) (int64, error) {
@@ -379,6 +427,41 @@ func TestRunCommand(t *testing.T) {
 	}
 }
 
+func TestRunCommandWithByproducts(t *testing.T) {
+	tables := []struct {
+		name     string
+		opts     ByproductOptions
+		expected map[string]interface{}
+	}{
+		{"unlimited", ByproductOptions{}, map[string]interface{}{
+			"return-value": float64(3), "stdout": "0123456789", "stderr": "abcdef"}},
+		{"truncated", ByproductOptions{MaxStdoutSize: 4, MaxStderrSize: 1}, map[string]interface{}{
+			"return-value": float64(3), "stdout": "0123", "stderr": "a"}},
+		{"limits above output size", ByproductOptions{MaxStdoutSize: 100, MaxStderrSize: 6}, map[string]interface{}{
+			"return-value": float64(3), "stdout": "0123456789", "stderr": "abcdef"}},
+		{"capture disabled", ByproductOptions{DisableCapture: true}, map[string]interface{}{
+			"return-value": float64(3), "stdout": "", "stderr": ""}},
+	}
+	for _, table := range tables {
+		result, err := RunCommandWithByproducts([]string{"sh", "-c", "printf 01234; printf abc >&2; printf 56789; printf def >&2; exit 3"}, "", table.opts)
+		assert.Nil(t, err, table.name)
+		assert.Equal(t, table.expected, result, table.name)
+	}
+
+	// Commands filling both pipes do not block
+	result, err := RunCommandWithByproducts([]string{"sh", "-c", "head -c 200000 /dev/zero >&2; head -c 200000 /dev/zero"}, "", ByproductOptions{MaxStdoutSize: 10})
+	assert.Nil(t, err)
+	assert.Len(t, result["stdout"], 10)
+	assert.Len(t, result["stderr"], 200000)
+
+	// InTotoRunWithByproducts records the captured byproducts in the link
+	linkEnv, err := InTotoRunWithByproducts("test", "", nil, nil, []string{"sh", "-c", "printf 0123456789"}, Key{}, ArtifactProfile{}, ByproductOptions{MaxStdoutSize: 2}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "01", linkEnv.GetPayload().(Link).ByProducts["stdout"])
+}
+
 func TestRunCommandErrors(t *testing.T) {
 	tables := []struct {
 		CmdArgs       []string
@@ -634,6 +717,43 @@ func TestInTotoRecord(t *testing.T) {
 	}
 }
 
+func TestInTotoRecordFile(t *testing.T) {
+	var key Key
+	if err := key.LoadKey("carol", "ed25519", []string{"sha256", "sha512"}); err != nil {
+		t.Fatal(err)
+	}
+	profile := ArtifactProfile{HashAlgorithms: []string{"sha256"}}
+
+	for _, useDSSE := range []bool{false, true} {
+		dir := t.TempDir()
+		prelimLinkPath, err := InTotoRecordStartFile(dir, "manual", []string{"alice.pub"}, key, profile, useDSSE)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, filepath.Join(dir, ".manual.be6371bc.link-unfinished"), prelimLinkPath)
+
+		linkPath, err := InTotoRecordStopFile(dir, "manual", []string{"foo.tar.gz"}, key, profile, useDSSE)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, filepath.Join(dir, "manual.be6371bc.link"), linkPath)
+		assert.NoFileExists(t, prelimLinkPath)
+
+		linkEnv, err := LoadMetadata(linkPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Nil(t, linkEnv.VerifySignature(key))
+		link := linkEnv.GetPayload().(Link)
+		assert.Contains(t, link.Materials, "alice.pub")
+		assert.Contains(t, link.Products, "foo.tar.gz")
+
+		// Stopping requires an unfinished link
+		_, err = InTotoRecordStopFile(dir, "manual", []string{"foo.tar.gz"}, key, profile, useDSSE)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	}
+}
+
 // TestRecordArtifactWithBlobs ensures that we calculate the same hash for blobs
 func TestRecordArtifactWithBlobs(t *testing.T) {
 	type args struct {
@@ -747,6 +867,187 @@ func TestLineNormalizationFlag(t *testing.T) {
 	}
 }
 
+func TestTextLineNormalization(t *testing.T) {
+	dir := t.TempDir()
+	text, err := os.ReadFile("line-ending-windows")
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary := append([]byte("\x00"), text...)
+	if err := os.WriteFile(filepath.Join(dir, "text"), text, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "binary"), binary, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only line separators of text files are normalized
+	profile := ArtifactProfile{TextLineNormalization: true, LStripPaths: []string{dir + string(os.PathSeparator)}}
+	artifacts, err := profile.RecordArtifacts([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "efb929dfabd55c93796fc61cbf1fe6157445f093167dbee82e8b069842a4fceb", artifacts["text"]["sha256"])
+	binaryHash, err := hashReader(bytes.NewReader(binary), []string{"sha256"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, binaryHash, artifacts["binary"])
+
+	profile.LineNormalization = true
+	assert.NotNil(t, validateArtifactProfile("text", profile))
+}
+
+func TestRecordArtifactStreaming(t *testing.T) {
+	defaultBufferSize := ArtifactHashBufferSize
+	defer func() { ArtifactHashBufferSize = defaultBufferSize }()
+
+	expected := HashObj{
+		"sha256": "efb929dfabd55c93796fc61cbf1fe6157445f093167dbee82e8b069842a4fceb",
+	}
+	// Line separators split across buffers are normalized like in one buffer
+	for _, bufferSize := range []int{0, 1, 2, 3, 1024} {
+		ArtifactHashBufferSize = bufferSize
+		for _, path := range []string{"line-ending-windows", "line-ending-mixed"} {
+			got, err := RecordArtifact(path, []string{"sha256"}, true)
+			assert.Nil(t, err)
+			assert.Equal(t, expected, got, "buffer size %d, path %s", bufferSize, path)
+		}
+	}
+
+	// Contents larger than the buffer are hashed as a whole
+	ArtifactHashBufferSize = 7
+	contents := bytes.Repeat([]byte("in-toto\r\n\r"), 1000)
+	got, err := hashReader(bytes.NewReader(contents), []string{"sha256", "sha512"}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, fmt.Sprintf("%x", sha256.Sum256(contents)), got["sha256"])
+	assert.Equal(t, fmt.Sprintf("%x", sha512.Sum512(contents)), got["sha512"])
+
+	normalized := bytes.ReplaceAll(contents, []byte("\r\n"), []byte("\n"))
+	normalized = bytes.ReplaceAll(normalized, []byte("\r"), []byte("\n"))
+	got, err = hashReader(bytes.NewReader(contents), []string{"sha256"}, true)
+	assert.Nil(t, err)
+	assert.Equal(t, fmt.Sprintf("%x", sha256.Sum256(normalized)), got["sha256"])
+}
+
+func TestRecordArtifactsWorkers(t *testing.T) {
+	defaultWorkers := ArtifactHashWorkers
+	defer func() { ArtifactHashWorkers = defaultWorkers }()
+
+	ArtifactHashWorkers = 1
+	expected, err := RecordArtifacts([]string{"."}, []string{"sha256", "sha512"}, nil, nil, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Greater(t, len(expected), 1)
+
+	// The recorded artifacts do not depend on the number of workers
+	for _, workers := range []int{0, 2, 3, 64} {
+		ArtifactHashWorkers = workers
+		got, err := RecordArtifacts([]string{"."}, []string{"sha256", "sha512"}, nil, nil, false, false)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, got, "workers %d", workers)
+
+		_, err = RecordArtifacts([]string{"."}, []string{"invalid"}, nil, nil, false, false)
+		assert.ErrorIs(t, err, ErrUnsupportedHashAlgorithm, "workers %d", workers)
+	}
+}
+
+func TestRecordArtifactsWithProfile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "src", "empty"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "src", "foo"), []byte("foo"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "src", "foo"), filepath.Join(dir, "foo.sym")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "src"), filepath.Join(dir, "src.sym")); err != nil {
+		t.Fatal(err)
+	}
+	fooHash := HashObj{"sha256": "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"}
+	strip := dir + string(os.PathSeparator)
+
+	tests := []struct {
+		name     string
+		profile  ArtifactProfile
+		expected map[string]HashObj
+	}{
+		{"default", ArtifactProfile{LStripPaths: []string{strip}}, map[string]HashObj{
+			"src/foo": fooHash,
+			"foo.sym": fooHash,
+		}},
+		{"follow symlink dirs", ArtifactProfile{LStripPaths: []string{strip}, FollowSymlinkDirs: true}, map[string]HashObj{
+			"src/foo":     fooHash,
+			"foo.sym":     fooHash,
+			"src.sym/foo": fooHash,
+		}},
+		{"skip symlinks", ArtifactProfile{LStripPaths: []string{strip}, FollowSymlinkDirs: true, SkipSymlinks: true}, map[string]HashObj{
+			"src/foo": fooHash,
+		}},
+		{"record empty dirs", ArtifactProfile{LStripPaths: []string{strip}, RecordEmptyDirs: true}, map[string]HashObj{
+			"src/foo":    fooHash,
+			"foo.sym":    fooHash,
+			"src/empty/": {},
+		}},
+		{"exclude empty dirs", ArtifactProfile{LStripPaths: []string{strip}, RecordEmptyDirs: true, ExcludePatterns: []string{"empty"}}, map[string]HashObj{
+			"src/foo": fooHash,
+			"foo.sym": fooHash,
+		}},
+		{"dirhash", ArtifactProfile{LStripPaths: []string{strip}, FollowSymlinkDirs: true, DirHashPatterns: []string{"src*"}}, map[string]HashObj{
+			"src/":     {"sha256": "de94fb61e4351e7eef3dad95bfef0d3352bcac17d7d9c5aa157be31992f6beb1"},
+			"src.sym/": {"sha256": "de94fb61e4351e7eef3dad95bfef0d3352bcac17d7d9c5aa157be31992f6beb1"},
+			"foo.sym":  fooHash,
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := test.profile.RecordArtifacts([]string{dir})
+			assert.Nil(t, err)
+			assert.Equal(t, test.expected, got)
+		})
+	}
+
+	// The root of a recorded path is not an artifact, even if empty
+	got, err := ArtifactProfile{RecordEmptyDirs: true}.RecordArtifacts([]string{filepath.Join(dir, "src", "empty")})
+	assert.Nil(t, err)
+	assert.Empty(t, got)
+}
+
+func TestRecordArtifactsLStripPaths(t *testing.T) {
+	dirA := t.TempDir()
+	dirB := t.TempDir()
+	for _, dir := range []string{dirA, dirB} {
+		if err := os.MkdirAll(filepath.Join(dir, "src"), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "src", "foo"), []byte("foo"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stripA := dirA + string(os.PathSeparator)
+	stripB := dirB + string(os.PathSeparator)
+
+	// Artifacts recorded in different directories compare equal
+	artifactsA, err := RecordArtifacts([]string{dirA}, []string{"sha256"}, nil, []string{stripA, stripB}, false, false)
+	assert.Nil(t, err)
+	artifactsB, err := RecordArtifacts([]string{dirB}, []string{"sha256"}, nil, []string{stripA, stripB}, false, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"src/foo"}, artifactsDictKeyStrings(artifactsA))
+	assert.Equal(t, artifactsA, artifactsB)
+
+	// Only the first matching prefix is stripped
+	artifacts, err := RecordArtifacts([]string{dirA}, []string{"sha256"}, nil, []string{stripA, filepath.Join(stripA, "src") + string(os.PathSeparator)}, false, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"src/foo"}, artifactsDictKeyStrings(artifacts))
+
+	// Stripping both directories results in the same artifact name
+	_, err = RecordArtifacts([]string{dirA, dirB}, []string{"sha256"}, nil, []string{stripA, stripB}, false, false)
+	assert.ErrorIs(t, err, ErrNonUniqueArtifactName)
+}
+
 func TestInTotoMatchProducts(t *testing.T) {
 	link := &Link{
 		Products: map[string]HashObj{
@@ -831,3 +1132,66 @@ func TestInTotoMatchProducts(t *testing.T) {
 		assert.Equal(t, test.expectedDiffer, differ)
 	}
 }
+
+func TestRunContext(t *testing.T) {
+	var key Key
+	if err := key.LoadKey("carol", "ed25519", []string{"sha256", "sha512"}); err != nil {
+		t.Fatal(err)
+	}
+	linkEnv, err := InTotoRunContext(context.Background(), "foo", "", []string{"foo.tar.gz"}, nil, nil, key, []string{"sha256"}, nil, nil, false, false, false)
+	assert.Nil(t, err)
+	assert.Contains(t, linkEnv.GetPayload().(Link).Materials, "foo.tar.gz")
+
+	// Recording artifacts stops on cancellation
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = RecordArtifactsContext(ctx, []string{"."}, []string{"sha256"}, nil, nil, false, false)
+	assert.ErrorIs(t, err, context.Canceled)
+	_, err = InTotoRunContext(ctx, "foo", "", []string{"foo.tar.gz"}, nil, nil, key, []string{"sha256"}, nil, nil, false, false, false)
+	assert.ErrorIs(t, err, context.Canceled)
+	_, err = InTotoRecordStartContext(ctx, "foo", []string{"foo.tar.gz"}, key, []string{"sha256"}, nil, nil, false, false, false)
+	assert.ErrorIs(t, err, context.Canceled)
+	_, err = recordArtifactContext(ctx, "foo.tar.gz", []string{"sha256"}, false, false)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// Commands are killed on cancellation
+	if testOSisWindows() {
+		t.Skip("no sleep command on Windows")
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = RunContext(ctx, "sleep", []string{"sleep", "10"}, key)
+	assert.NotNil(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+// TestRunSkipsMetadataDirLock makes sure that the lock file left behind by
+// dumping a link is not recorded by the next step run in the same directory.
+func TestRunSkipsMetadataDirLock(t *testing.T) {
+	var key Key
+	if err := key.LoadKey("carol", "ed25519", []string{"sha256", "sha512"}); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "foo"), []byte("foo"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"first", "second"} {
+		linkEnv, err := Run(name, []string{"sh", "-c", "true"}, key, WithMaterials(dir), WithProducts(dir))
+		if err != nil {
+			t.Fatal(err)
+		}
+		link := linkEnv.GetPayload().(Link)
+		for _, artifacts := range []map[string]HashObj{link.Materials, link.Products} {
+			for artifact := range artifacts {
+				assert.NotEqual(t, metadataDirLockName, path.Base(artifact))
+			}
+		}
+		if err := linkEnv.Dump(filepath.Join(dir, fmt.Sprintf(LinkNameFormat, name, key.KeyID))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert.FileExists(t, filepath.Join(dir, metadataDirLockName))
+}
@@ -0,0 +1,134 @@
+package in_toto
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/secure-systems-lab/go-securesystemslib/dsse"
+)
+
+// ErrMetadataCorrupted is returned when metadata does not match the self
+// digest embedded in it, see SetSelfDigest.
+var ErrMetadataCorrupted = errors.New("metadata file corrupted in storage or transit")
+
+// selfDigestAlgorithm is the hash algorithm of self digests written by Dump.
+const selfDigestAlgorithm = "sha256"
+
+/*
+SetSelfDigest enables or disables embedding a digest of the signed portion of
+the passed Metablock or Envelope, when it is written with Dump or DumpTo.  The
+digest is stored next to the signatures, in the "signed_digest" field of
+Metablocks, i.e. over the canonical JSON of the signed field, and in the
+"payload_digest" field of envelopes, i.e. over the decoded payload.  Metadata
+loaded with a self digest, e.g. with LoadMetadata, is checked against it, and
+an ErrMetadataCorrupted is returned on mismatch, so that files corrupted in
+storage or transit are told apart from invalid signatures.  Loaded metadata
+keeps the digest when it is written again.  Metadata written without self
+digest, and readers that do not know the field, are not affected.  An
+ErrUnknownMetadataType is returned for other metadata types.
+*/
+func SetSelfDigest(metadata Metadata, enabled bool) error {
+	switch m := metadata.(type) {
+	case *Metablock:
+		m.selfDigest = enabled
+	case *Envelope:
+		m.selfDigest = enabled
+	default:
+		return ErrUnknownMetadataType
+	}
+	return nil
+}
+
+// computeSelfDigest returns the digest of the passed signed bytes with the
+// passed hash algorithms.
+func computeSelfDigest(signed []byte, hashAlgorithms []string) (HashObj, error) {
+	return hashReader(bytes.NewReader(signed), hashAlgorithms, false)
+}
+
+/*
+verifySelfDigest checks the passed signed bytes against the passed JSON
+encoded self digest.  All hash algorithms of the digest must be supported and
+match.
+*/
+func verifySelfDigest(signed []byte, rawDigest json.RawMessage) error {
+	var expected HashObj
+	if err := json.Unmarshal(rawDigest, &expected); err != nil || len(expected) == 0 {
+		return fmt.Errorf("%w: invalid self digest", ErrMetadataCorrupted)
+	}
+	hashAlgorithms := make([]string, 0, len(expected))
+	for algorithm := range expected {
+		hashAlgorithms = append(hashAlgorithms, algorithm)
+	}
+	sort.Strings(hashAlgorithms)
+	actual, err := computeSelfDigest(signed, hashAlgorithms)
+	if err != nil {
+		return err
+	}
+	for _, algorithm := range hashAlgorithms {
+		if actual[algorithm] != expected[algorithm] {
+			return fmt.Errorf("%w: %s digest of signed portion is %s, expected %s",
+				ErrMetadataCorrupted, algorithm, actual[algorithm], expected[algorithm])
+		}
+	}
+	return nil
+}
+
+// marshalMetablock returns the JSON encoding of the passed Metablock in the
+// canonical on-disk format, see DumpMetadataTo, including its self digest, if
+// enabled.
+func marshalMetablock(mb *Metablock) ([]byte, error) {
+	var digest HashObj
+	if mb.selfDigest {
+		signable, err := mb.GetSignableRepresentation()
+		if err != nil {
+			return nil, err
+		}
+		digest, err = computeSelfDigest(signable, []string{selfDigestAlgorithm})
+		if err != nil {
+			return nil, err
+		}
+	}
+	signatures := mb.Signatures
+	if signatures != nil {
+		signatures = sortSignatures(signatures)
+	}
+	return encodeMetadataFile(struct {
+		Signed       interface{} `json:"signed"`
+		Signatures   []Signature `json:"signatures"`
+		SignedDigest HashObj     `json:"signed_digest,omitempty"`
+	}{mb.Signed, signatures, digest})
+}
+
+// marshalEnvelope returns the JSON encoding of the passed envelope in the
+// canonical on-disk format, see DumpMetadataTo, including its self digest, if
+// enabled.
+func marshalEnvelope(e *Envelope) ([]byte, error) {
+	var digest HashObj
+	if e.selfDigest {
+		payload, err := e.envelope.DecodeB64Payload()
+		if err != nil {
+			return nil, err
+		}
+		digest, err = computeSelfDigest(payload, []string{selfDigestAlgorithm})
+		if err != nil {
+			return nil, err
+		}
+	}
+	envelope := *e.envelope
+	if envelope.Signatures != nil {
+		envelope.Signatures = append([]dsse.Signature{}, envelope.Signatures...)
+		sort.SliceStable(envelope.Signatures, func(i, j int) bool {
+			if envelope.Signatures[i].KeyID != envelope.Signatures[j].KeyID {
+				return envelope.Signatures[i].KeyID < envelope.Signatures[j].KeyID
+			}
+			return envelope.Signatures[i].Sig < envelope.Signatures[j].Sig
+		})
+	}
+	return encodeMetadataFile(struct {
+		*dsse.Envelope
+		PayloadDigest HashObj `json:"payload_digest,omitempty"`
+	}{&envelope, digest})
+}
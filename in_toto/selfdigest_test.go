@@ -0,0 +1,102 @@
+package in_toto
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelfDigest(t *testing.T) {
+	var key Key
+	if err := key.LoadKey("carol", "ed25519", []string{"sha256", "sha512"}); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+
+	for _, tc := range []struct {
+		name    string
+		opts    []RunOption
+		field   string
+		corrupt func(data []byte) []byte
+	}{
+		{"metablock", []RunOption{WithMetablock()}, "signed_digest", func(data []byte) []byte {
+			return bytes.Replace(data, []byte(`"name": "foo"`), []byte(`"name": "fop"`), 1)
+		}},
+		{"envelope", nil, "payload_digest", func(data []byte) []byte {
+			var raw map[string]interface{}
+			if err := json.Unmarshal(data, &raw); err != nil {
+				t.Fatal(err)
+			}
+			payload := raw["payload"].(string)
+			raw["payload"] = strings.Replace(payload, payload[10:14], "AAAA", 1)
+			data, _ = json.Marshal(raw)
+			return data
+		}},
+	} {
+		linkEnv, err := Run("foo", nil, key, append(tc.opts, WithMaterials("foo.tar.gz"), WithSelfDigest())...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, tc.name+".link")
+		if err := linkEnv.Dump(path); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Contains(t, string(data), tc.field, tc.name)
+
+		// Intact files are loaded, and keep the digest when written again
+		loaded, err := LoadMetadata(path)
+		if !assert.Nil(t, err, tc.name) {
+			continue
+		}
+		assert.Nil(t, loaded.VerifySignature(key), tc.name)
+		var buf bytes.Buffer
+		assert.Nil(t, DumpMetadataTo(loaded, &buf))
+		assert.Equal(t, data, buf.Bytes(), tc.name)
+
+		// Corrupted files are reported as such, not as invalid signatures
+		_, err = LoadMetadataFrom(bytes.NewReader(tc.corrupt(data)))
+		assert.ErrorIs(t, err, ErrMetadataCorrupted, tc.name)
+
+		// The self digest can be disabled again
+		assert.Nil(t, SetSelfDigest(loaded, false))
+		buf.Reset()
+		assert.Nil(t, DumpMetadataTo(loaded, &buf))
+		assert.NotContains(t, buf.String(), tc.field, tc.name)
+	}
+
+	// Links are written without self digest by default
+	linkEnv, err := Run("foo", nil, key, WithMetablock())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	assert.Nil(t, DumpMetadataTo(linkEnv, &buf))
+	assert.NotContains(t, buf.String(), "signed_digest")
+
+	// Self digests must not be empty
+	var raw map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &raw); err != nil {
+		t.Fatal(err)
+	}
+	raw["signed_digest"] = map[string]string{}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "invalid.link")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	var mb Metablock
+	assert.ErrorIs(t, mb.Load(path), ErrMetadataCorrupted)
+	assert.ErrorIs(t, SetSelfDigest(&GitObject{}, true), ErrUnknownMetadataType)
+}
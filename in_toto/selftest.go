@@ -0,0 +1,216 @@
+package in_toto
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// ErrSelfTestFailed is returned by SelfTest, joined with the errors of all
+// failed checks.
+var ErrSelfTestFailed = errors.New("self-test failed")
+
+// selfTestMessage is the message signed by the signature test vectors.
+var selfTestMessage = []byte("in-toto self-test")
+
+/*
+selfTestVectors are known-answer signatures over selfTestMessage.  The
+ed25519 key is derived from the seed 0x00, 0x01, ... 0x1f, its signature is
+deterministic and hence also checked when signing.  RSA-PSS and ECDSA
+signatures are randomized and only verified.
+*/
+var selfTestVectors = []struct {
+	name   string
+	public string
+	keyID  string
+	sig    string
+}{
+	{
+		name:   "ed25519",
+		public: "03a107bff3ce10be1d70dd18e74bc09967e4d6309ba50d5f1ddc8664125531b8",
+		keyID:  "607f42135d7855e1145188a58aaf4c055fec1edbd7041680576e486f7ea574d1",
+		sig: "127682ae195612b1e2e8a247726364c995c8d29f2619a8f994c8afbc2c27ab7a" +
+			"d2af11a5c81a078ebca58e95a6cf8e97b27cb6856dd4cff6bf164343ed195a09",
+	},
+	{
+		name: "rsassa-pss-sha256",
+		public: `-----BEGIN PUBLIC KEY-----
+MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEA4E5A5KMPc1RojK7BsFKb
+h38DTBm+3b/9ZSUHkJacYtxZI6ISIGIFFR+Tyqdlqe2+tAAtCpnRKnQPUet8bASv
+YYHEw04hgbYpDOEKpseZXsmF+AnWeB8K8FXear0DwcHYLVR0JRdm8/e732DnVZzF
+WEX5OdeFio3WWFgxRtG/lYXCJCwuMvkvOdyIYaihUH0fiLpBrt5NKegLb1d15/SQ
+nosydmyFY6lg/ud5qVnE79BTVbGK/U1YCYSnZ8cHsmB5hgKLcIju/ThaziKlbqUu
+1GS3qdOBivK4NY91lgNC2jjECUx30XfSKepBgeBb9qgYu33jN9FJbiZsgXFhNfhZ
+YQIDAQAB
+-----END PUBLIC KEY-----
+`,
+		sig: "b3ee0237ece768ac2c83aa036ad7772a281397c8c8263729fe7cf580e0f3a70f" +
+			"081effc633a2b5adf17c3d6965f50bcd6a9e433e62121c66d6cd86cd5244e4c2" +
+			"26274488925a99485a2bc4190b187d928a949d1def0453d7d1220702b0ba1e62" +
+			"0dad0e06e342804ab50eb31f27d2465720cb3adbcdff1271e0e992c0c3d10776" +
+			"112af23b2fd438b407130a0dd55dc955288baed05fd1a88e3afa44a9cc958274" +
+			"cd09cf948ef9ca1be4bfdcb2d84fbce17579a2dd197be741e9653f58460f4804" +
+			"2a250529f5e60db3a82c9a475de1e01a3443220a435f81a9bae64bb8b47b9cd2" +
+			"87acd410efcf1f7d6f3a97b72e9c8afdfabaaffc284667b588f7a699ee0f26c8",
+	},
+	{
+		name: "ecdsa-sha2-nistp256",
+		public: `-----BEGIN PUBLIC KEY-----
+MFkwEwYHKoZIzj0CAQYIKoZIzj0DAQcDQgAE5fFu5I1d9U6QU8U9Ymu26Iz+QKTc
+A/RgdFT3qrm9jdEQTUFhdX1YT1mXYvD14JQiswg0QZN2m8if4M25/YXk3w==
+-----END PUBLIC KEY-----
+`,
+		sig: "3046022100cb41220e2dae1393d6ab400f185d02d3b4a0423dc07490a1cb1c09a5" +
+			"0231e25b0221009434710dac7aa9017787dd44002d53d4a1b7c471431e950cb2" +
+			"0c6d4f796d4a0a",
+	},
+}
+
+/*
+SelfTest runs known-answer tests of the cryptographic and verification
+primitives in-toto relies on, i.e. signing and verifying with embedded test
+vectors, the canonicalization of signed payloads, and the evaluation of
+artifact rules.  It takes a few milliseconds and does not access the file
+system or the network, hence it is suitable for readiness probes of
+verification services and for power-on self-tests.  It returns nil if all
+checks pass, or an ErrSelfTestFailed joined with the errors of all failed
+checks.
+*/
+func SelfTest() error {
+	checks := []struct {
+		name  string
+		check func() error
+	}{
+		{"signatures", selfTestSignatures},
+		{"canonicalization", selfTestCanonicalization},
+		{"artifact rules", selfTestArtifactRules},
+	}
+	var errs []error
+	for _, c := range checks {
+		if err := c.check(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", c.name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%w: %w", ErrSelfTestFailed, errors.Join(errs...))
+	}
+	return nil
+}
+
+// selfTestSignatures verifies the signature test vectors, and checks that
+// signing with the ed25519 test key yields the known signature.
+func selfTestSignatures() error {
+	seed := make([]byte, ed25519.SeedSize)
+	for i := range seed {
+		seed[i] = byte(i)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(ed25519.NewKeyFromSeed(seed))
+	if err != nil {
+		return err
+	}
+	var signer Key
+	if err := signer.LoadKeyReaderDefaults(bytes.NewReader(
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))); err != nil {
+		return err
+	}
+	sig, err := GenerateSignature(selfTestMessage, signer)
+	if err != nil {
+		return err
+	}
+	if sig.Sig != selfTestVectors[0].sig || signer.KeyID != selfTestVectors[0].keyID {
+		return fmt.Errorf("ed25519 signature does not match test vector")
+	}
+
+	for _, vector := range selfTestVectors {
+		var key Key
+		if vector.name == "ed25519" {
+			key = signer
+			key.KeyVal.Private = ""
+			if key.KeyVal.Public != vector.public {
+				return fmt.Errorf("ed25519 public key does not match test vector")
+			}
+		} else if err := key.LoadKeyReaderDefaults(bytes.NewReader([]byte(vector.public))); err != nil {
+			return fmt.Errorf("%s: %w", vector.name, err)
+		}
+		if key.Scheme != vector.name {
+			return fmt.Errorf("%s: unexpected scheme '%s'", vector.name, key.Scheme)
+		}
+		sig := Signature{KeyID: key.KeyID, Sig: vector.sig}
+		if err := VerifySignature(key, sig, selfTestMessage); err != nil {
+			return fmt.Errorf("%s: %w", vector.name, err)
+		}
+		tampered := append([]byte{}, selfTestMessage...)
+		tampered[0] ^= 1
+		if err := VerifySignature(key, sig, tampered); err == nil {
+			return fmt.Errorf("%s: signature of tampered message verified", vector.name)
+		}
+	}
+	return nil
+}
+
+// selfTestCanonicalization checks the signable bytes of Metablocks and
+// Envelopes against known encodings.
+func selfTestCanonicalization() error {
+	payload := map[string]interface{}{
+		"b": []interface{}{1, "é\"\\"},
+		"a": map[string]interface{}{"z": true, "y": nil},
+	}
+	tables := []struct {
+		specVersion string
+		expected    string
+	}{
+		{metablockSpecVersion, `{"a":{"y":null,"z":true},"b":[1,"` + "é" + `\"\\"]}`},
+		{envelopeSpecVersion, `DSSEv1 28 application/vnd.in-toto+json 42 {"a":{"y":null,"z":true},"b":[1,"` +
+			"é" + `\"\\"]}`},
+	}
+	for _, table := range tables {
+		c, err := GetCanonicalizer(table.specVersion)
+		if err != nil {
+			return err
+		}
+		encoded, err := c.EncodePayload(payload)
+		if err != nil {
+			return fmt.Errorf("spec version '%s': %w", table.specVersion, err)
+		}
+		if signable := c.SignableBytes(PayloadType, encoded); string(signable) != table.expected {
+			return fmt.Errorf("spec version '%s': unexpected signable bytes '%s'", table.specVersion, signable)
+		}
+	}
+	return nil
+}
+
+// selfTestArtifactRules checks that artifact rules accept a supply chain
+// that follows them and reject one that does not.
+func selfTestArtifactRules() error {
+	digest := HashObj{"sha256": "52947cb78b91ad01fe81cd6aef42d1f6817e92b9e6936c1e5aabb7c98514f355"}
+	items := []interface{}{
+		Step{SupplyChainItem: SupplyChainItem{
+			Name:             "build",
+			ExpectedProducts: [][]string{{"CREATE", "app"}, {"DISALLOW", "*"}},
+		}},
+		Inspection{SupplyChainItem: SupplyChainItem{
+			Name:              "check",
+			ExpectedMaterials: [][]string{{"MATCH", "app", "WITH", "PRODUCTS", "FROM", "build"}, {"DISALLOW", "*"}},
+		}},
+	}
+	link := func(name string, materials, products map[string]HashObj) Metadata {
+		return &Metablock{Signed: Link{Type: "link", Name: name, Materials: materials, Products: products}}
+	}
+	metadata := map[string]Metadata{
+		"build": link("build", map[string]HashObj{}, map[string]HashObj{"app": digest}),
+		"check": link("check", map[string]HashObj{"app": digest}, map[string]HashObj{}),
+	}
+	if err := verifyArtifacts(context.Background(), items, metadata, artifactMatcher{}, nil, nil); err != nil {
+		return err
+	}
+
+	metadata["check"] = link("check", map[string]HashObj{"app": {"sha256": "00"}}, map[string]HashObj{})
+	if err := verifyArtifacts(context.Background(), items, metadata, artifactMatcher{}, nil, nil); err == nil {
+		return fmt.Errorf("artifact with mismatching digest accepted")
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package in_toto
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelfTest(t *testing.T) {
+	if err := SelfTest(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A broken canonicalizer fails the self-test
+	c, err := GetCanonicalizer(metablockSpecVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer RegisterCanonicalizer(metablockSpecVersion, c)
+	RegisterCanonicalizer(metablockSpecVersion, prefixCanonicalizer{})
+	err = SelfTest()
+	assert.ErrorIs(t, err, ErrSelfTestFailed)
+	assert.Contains(t, err.Error(), "canonicalization")
+	assert.False(t, errors.Is(err, ErrInvalidSignature))
+}
@@ -0,0 +1,98 @@
+package in_toto
+
+import (
+	"sync"
+)
+
+/*
+signableMemo memoizes the signable representations of the Metablocks of a
+verification, and their digests, see Metablock.GetSignableRepresentation and
+MetadataDigest.  Otherwise, a link is canonicalized again for each layout key
+its signature is verified with, each denylist lookup, each comparison with a
+previous verification and each digest recorded as evidence, which dominates
+verification of large links.
+
+Metadata is memoized by identity, hence the memo must only be used as long as
+the Signed fields of the memoized Metablocks are not modified, i.e. during a
+verification.  A nil memo memoizes nothing.
+*/
+type signableMemo struct {
+	mu        sync.Mutex
+	signables map[*Metablock][]byte
+	digests   map[*Metablock]HashObj
+}
+
+// newSignableMemo returns an empty signableMemo.
+func newSignableMemo() *signableMemo {
+	return &signableMemo{
+		signables: map[*Metablock][]byte{},
+		digests:   map[*Metablock]HashObj{},
+	}
+}
+
+// signable returns the signable representation of the passed Metablock,
+// computing it only once.
+func (m *signableMemo) signable(mb *Metablock) ([]byte, error) {
+	if m == nil {
+		return mb.GetSignableRepresentation()
+	}
+	m.mu.Lock()
+	signable, ok := m.signables[mb]
+	m.mu.Unlock()
+	if ok {
+		return signable, nil
+	}
+	signable, err := mb.GetSignableRepresentation()
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	m.signables[mb] = signable
+	m.mu.Unlock()
+	return signable, nil
+}
+
+/*
+verifySignature verifies the signature of the passed metadata for the passed
+key, like Metadata.VerifySignature, canonicalizing a Metablock only once for
+all keys.
+*/
+func (m *signableMemo) verifySignature(metadata Metadata, key Key) error {
+	mb, ok := metadata.(*Metablock)
+	if !ok || m == nil {
+		return metadata.VerifySignature(key)
+	}
+	sig, err := mb.getSignatureForKey(key)
+	if err != nil {
+		return err
+	}
+	signable, err := m.signable(mb)
+	if err != nil {
+		return err
+	}
+	return VerifySignature(key, sig, signable)
+}
+
+// digest returns the digest of the passed metadata, see MetadataDigest,
+// computing it only once for Metablocks.
+func (m *signableMemo) digest(metadata Metadata) (HashObj, error) {
+	mb, ok := metadata.(*Metablock)
+	if !ok || m == nil {
+		return MetadataDigest(metadata)
+	}
+	m.mu.Lock()
+	digest, ok := m.digests[mb]
+	m.mu.Unlock()
+	if ok {
+		return digest, nil
+	}
+	signable, err := m.signable(mb)
+	if err != nil {
+		return nil, err
+	}
+	digest = digestPayload(signable)
+	m.mu.Lock()
+	m.digests[mb] = digest
+	m.mu.Unlock()
+	return digest, nil
+}
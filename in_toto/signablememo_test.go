@@ -0,0 +1,77 @@
+package in_toto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countingCanonicalizer counts the payloads encoded by the wrapped
+// Canonicalizer.
+type countingCanonicalizer struct {
+	Canonicalizer
+	encoded *int
+}
+
+func (c countingCanonicalizer) EncodePayload(payload any) ([]byte, error) {
+	*c.encoded++
+	return c.Canonicalizer.EncodePayload(payload)
+}
+
+func TestSignableMemo(t *testing.T) {
+	var carol Key
+	if err := carol.LoadKey("carol", "ed25519", []string{"sha256", "sha512"}); err != nil {
+		t.Fatal(err)
+	}
+	erika, err := GenerateEd25519Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mb := &Metablock{Signed: Link{Type: "link", Name: "build",
+		Products: map[string]HashObj{"foo": {"sha256": "abc"}}}}
+	for _, key := range []Key{carol, erika} {
+		if err := mb.Sign(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	keys := map[string]Key{carol.KeyID: carol, erika.KeyID: erika}
+	expectedDigest, err := MetadataDigest(mb)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defaultCanonicalizer, err := GetCanonicalizer(metablockSpecVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded := 0
+	RegisterCanonicalizer(metablockSpecVersion, countingCanonicalizer{defaultCanonicalizer, &encoded})
+	defer RegisterCanonicalizer(metablockSpecVersion, defaultCanonicalizer)
+
+	// Signatures of all keys and the digest are verified with one encoding
+	memo := newSignableMemo()
+	assert.Nil(t, verifyLayoutSignatures(mb, keys, memo, nil))
+	digest, err := memo.digest(mb)
+	assert.Nil(t, err)
+	assert.Equal(t, expectedDigest, digest)
+	assert.Equal(t, 1, encoded)
+
+	// A nil memo memoizes nothing
+	encoded = 0
+	var noMemo *signableMemo
+	for _, key := range keys {
+		assert.Nil(t, noMemo.verifySignature(mb, key))
+	}
+	digest, err = noMemo.digest(mb)
+	assert.Nil(t, err)
+	assert.Equal(t, expectedDigest, digest)
+	assert.Equal(t, 3, encoded)
+
+	// Modifications of Signed are not noticed, hence memos are only used
+	// during a verification
+	assert.ErrorIs(t, memo.verifySignature(mb, Key{KeyID: "unknown"}), ErrSignatureNotFound)
+	link := mb.Signed.(Link)
+	link.Products["foo"] = HashObj{"sha256": "def"}
+	assert.Nil(t, memo.verifySignature(mb, carol))
+	assert.NotNil(t, mb.VerifySignature(carol))
+}
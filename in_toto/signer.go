@@ -0,0 +1,215 @@
+package in_toto
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"github.com/in-toto/in-toto-golang/in_toto/keys"
+	"github.com/secure-systems-lab/go-securesystemslib/dsse"
+)
+
+/*
+Signer creates signatures for in-toto metadata, without requiring access to
+the private key material.  Besides in-memory keys, see NewKeySigner, this
+allows to sign with keys held by hardware tokens or remote key management
+services, see NewCryptoSigner.
+
+  - Sign returns a signature over the passed data.
+  - KeyID returns the in-toto key ID of the signing key.
+  - Public returns the public part of the signing key, e.g. for adding it to
+    a layout or step as functionary key.
+*/
+type Signer interface {
+	Sign(data []byte) (Signature, error)
+	KeyID() string
+	Public() Key
+}
+
+// keySigner is a Signer for in-memory keys.
+type keySigner struct {
+	key Key
+}
+
+/*
+NewKeySigner returns a Signer that signs with the passed key, which must have
+a private key value.  Signatures are created with GenerateSignature, hence
+they carry the key's certificate, if any.
+*/
+func NewKeySigner(key Key) Signer {
+	return &keySigner{key: key}
+}
+
+func (s *keySigner) Sign(data []byte) (Signature, error) {
+	return GenerateSignature(data, s.key)
+}
+
+func (s *keySigner) KeyID() string {
+	return s.key.KeyID
+}
+
+func (s *keySigner) Public() Key {
+	public := s.key
+	public.KeyVal.Private = ""
+	return public
+}
+
+// cryptoSigner is a Signer for crypto.Signer implementations.
+type cryptoSigner struct {
+	signer crypto.Signer
+	public Key
+	hash   crypto.Hash
+	pss    bool
+	rand   io.Reader
+}
+
+/*
+NewCryptoSigner returns a Signer that signs via the passed crypto.Signer of
+an RSA, ECDSA or ed25519 key, e.g. a PKCS#11 hardware token, or an AWS KMS,
+GCP KMS or Vault transit key through their crypto.Signer client
+implementations.  The private key never needs to be present in memory.  If the
+passed scheme is empty, the default scheme of the key type is used, see
+LoadKeyDefaults.  Signatures are compatible to the signatures created by
+GenerateSignature for an in-memory key of the same scheme.
+*/
+func NewCryptoSigner(signer crypto.Signer, scheme string) (Signer, error) {
+	publicKey := signer.Public()
+	if scheme == "" {
+		var err error
+		scheme, _, err = keys.DefaultScheme(publicKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	public, err := keys.NewKey(publicKey, scheme, []string{"sha256", "sha512"})
+	if err != nil {
+		return nil, err
+	}
+
+	s := &cryptoSigner{signer: signer, public: public, rand: rand.Reader}
+	switch k := publicKey.(type) {
+	case *rsa.PublicKey:
+		hash, pss, err := keys.RSASchemeParameters(scheme)
+		if err != nil {
+			return nil, err
+		}
+		s.hash = hash
+		s.pss = pss
+	case *ecdsa.PublicKey:
+		// Consistent with the securesystemslib, the hash is chosen by curve size
+		curveSize := k.Curve.Params().BitSize
+		switch {
+		case curveSize <= 256:
+			s.hash = crypto.SHA256
+		case curveSize <= 384:
+			s.hash = crypto.SHA384
+		default:
+			s.hash = crypto.SHA512
+		}
+	case ed25519.PublicKey:
+		// ed25519 signs the message itself
+	default:
+		return nil, ErrUnsupportedKeyType
+	}
+	return s, nil
+}
+
+func (s *cryptoSigner) Sign(data []byte) (Signature, error) {
+	digest := data
+	var opts crypto.SignerOpts = crypto.Hash(0)
+	if s.hash != 0 {
+		hasher := s.hash.New()
+		hasher.Write(data)
+		digest = hasher.Sum(nil)
+		opts = s.hash
+	}
+	if s.pss {
+		opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: s.hash}
+	}
+
+	sigBytes, err := s.signer.Sign(s.rand, digest, opts)
+	if err != nil {
+		return Signature{}, fmt.Errorf("failed to sign with crypto signer: %w", err)
+	}
+	return Signature{
+		KeyID:       s.public.KeyID,
+		Sig:         hex.EncodeToString(sigBytes),
+		Certificate: s.public.KeyVal.Certificate,
+	}, nil
+}
+
+func (s *cryptoSigner) KeyID() string {
+	return s.public.KeyID
+}
+
+func (s *cryptoSigner) Public() Key {
+	return s.public
+}
+
+// dsseSigner adapts a Signer to a dsse.SignerVerifier, which verifies with
+// the public key of the Signer.
+type dsseSigner struct {
+	dsse.Verifier
+	signer Signer
+}
+
+// newDSSESigner creates a dsseSigner for the passed Signer.
+func newDSSESigner(signer Signer) (*dsseSigner, error) {
+	verifier, err := keys.NewSignerVerifier(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	return &dsseSigner{Verifier: verifier, signer: signer}, nil
+}
+
+func (s *dsseSigner) Sign(ctx context.Context, data []byte) ([]byte, error) {
+	sig, err := s.signer.Sign(data)
+	if err != nil {
+		return nil, err
+	}
+	return hex.DecodeString(sig.Sig)
+}
+
+func (s *dsseSigner) KeyID() (string, error) {
+	return s.signer.KeyID(), nil
+}
+
+/*
+SignWith signs the signable part of the Metablock with the passed Signer and
+appends the signature to the Metablock.  Unlike Sign, it does not require the
+private key in memory.
+*/
+func (mb *Metablock) SignWith(signer Signer) error {
+	payload, err := mb.GetSignableRepresentation()
+	if err != nil {
+		return err
+	}
+
+	signature, err := signer.Sign(payload)
+	if err != nil {
+		return err
+	}
+
+	mb.Signatures = append(mb.Signatures, signature)
+	return nil
+}
+
+/*
+SignWith signs the payload of the Envelope with the passed Signer and adds
+the signature to the envelope.  Unlike Sign, it does not require the private
+key in memory.
+*/
+func (e *Envelope) SignWith(signer Signer) error {
+	sv, err := newDSSESigner(signer)
+	if err != nil {
+		return err
+	}
+	return e.signWith(sv)
+}
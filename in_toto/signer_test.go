@@ -0,0 +1,122 @@
+package in_toto
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// failingSigner is a crypto.Signer that fails to sign.
+type failingSigner struct {
+	crypto.Signer
+}
+
+func (s failingSigner) Sign(io.Reader, []byte, crypto.SignerOpts) ([]byte, error) {
+	return nil, errors.New("token removed")
+}
+
+func TestNewCryptoSigner(t *testing.T) {
+	pemBytes, err := os.ReadFile("dan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(pemBytes)
+	rsaKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tables := []struct {
+		name   string
+		signer crypto.Signer
+		scheme string
+	}{
+		{"rsa default scheme", rsaKey, ""},
+		{"rsa pss sha512", rsaKey, "rsassa-pss-sha512"},
+		{"rsa pkcs1v15 sha256", rsaKey, "rsassa-pkcs1v15-sha256"},
+		{"ed25519", ed25519Key, ""},
+		{"ecdsa", ecdsaKey, "ecdsa-sha2-nistp384"},
+	}
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			signer, err := NewCryptoSigner(table.signer, table.scheme)
+			if err != nil {
+				t.Fatal(err)
+			}
+			public := signer.Public()
+			assert.Equal(t, public.KeyID, signer.KeyID())
+			assert.Empty(t, public.KeyVal.Private)
+
+			sig, err := signer.Sign([]byte("data"))
+			assert.Nil(t, err)
+			assert.Nil(t, VerifySignature(public, sig, []byte("data")))
+			assert.NotNil(t, VerifySignature(public, sig, []byte("other data")))
+		})
+	}
+
+	// The public key and signatures match the in-memory key
+	var dan Key
+	if err := dan.LoadKeyDefaults("dan"); err != nil {
+		t.Fatal(err)
+	}
+	signer, err := NewCryptoSigner(rsaKey, "")
+	assert.Nil(t, err)
+	assert.Equal(t, dan.KeyID, signer.KeyID())
+	sig, err := signer.Sign([]byte("data"))
+	assert.Nil(t, err)
+	assert.Nil(t, VerifySignature(dan, sig, []byte("data")))
+
+	_, err = NewCryptoSigner(rsaKey, "ed25519")
+	assert.ErrorIs(t, err, ErrSchemeKeyTypeMismatch)
+
+	signer, err = NewCryptoSigner(failingSigner{ed25519Key}, "")
+	assert.Nil(t, err)
+	_, err = signer.Sign([]byte("data"))
+	assert.NotNil(t, err)
+}
+
+func TestSignWith(t *testing.T) {
+	var key Key
+	if err := key.LoadKeyDefaults("carol"); err != nil {
+		t.Fatal(err)
+	}
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cryptoSigner, err := NewCryptoSigner(privateKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, signer := range []Signer{NewKeySigner(key), cryptoSigner} {
+		assert.Empty(t, signer.Public().KeyVal.Private)
+
+		mb := &Metablock{Signed: Link{Type: "link", Name: "test"}}
+		assert.Nil(t, mb.SignWith(signer))
+		assert.Nil(t, mb.VerifySignature(signer.Public()))
+
+		env := &Envelope{}
+		assert.Nil(t, env.SetPayload(Link{Type: "link", Name: "test"}))
+		assert.Nil(t, env.SignWith(signer))
+		assert.Nil(t, env.VerifySignature(signer.Public()))
+	}
+}
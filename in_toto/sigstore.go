@@ -0,0 +1,640 @@
+package in_toto
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/in-toto/in-toto-golang/in_toto/keys"
+)
+
+// ErrSigstoreService is returned when a request to a Fulcio or Rekor
+// instance fails, see FulcioClient and RekorClient.
+var ErrSigstoreService = errors.New("sigstore service request failed")
+
+// ErrInvalidRekorEntry is returned when a Rekor log entry cannot be parsed or
+// fails verification, see RekorVerifier.
+var ErrInvalidRekorEntry = errors.New("invalid rekor log entry")
+
+const (
+	// DefaultFulcioURL is the public Fulcio instance of the Sigstore project.
+	DefaultFulcioURL = "https://fulcio.sigstore.dev"
+	// DefaultRekorURL is the public Rekor instance of the Sigstore project.
+	DefaultRekorURL = "https://rekor.sigstore.dev"
+	// TimestampTypeRekor is the timestamp type of Rekor log entries, see
+	// Metablock.AddRekorEntry.
+	TimestampTypeRekor = "rekor"
+)
+
+/*
+FulcioClient obtains short-lived signing certificates from a Fulcio
+certificate authority, which binds ephemeral keys to the identity of an OIDC
+identity token, e.g. of a CI workflow, see GenerateKeylessKey.  If Client is
+nil, http.DefaultClient is used.
+*/
+type FulcioClient struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+// NewFulcioClient creates a FulcioClient for the Fulcio instance at the
+// passed base URL, e.g. DefaultFulcioURL.
+func NewFulcioClient(baseURL string) *FulcioClient {
+	return &FulcioClient{BaseURL: baseURL}
+}
+
+/*
+GenerateKeylessKey generates an ephemeral ECDSA P-256 key and obtains a
+signing certificate for it from Fulcio, proving possession of the key by
+signing the subject of the passed OIDC identity token, i.e. its email claim,
+if any, or its sub claim.  The certificate is attached to the returned key,
+see AttachCertificate, so that signatures carry the identity of the token,
+which layouts can constrain, like for other certificates.  The second return
+value holds the PEM encoded intermediate and root certificates of the
+returned chain, e.g. to add them to the CAs of a layout.  The key is never
+written to disk, and expires with the certificate after a few minutes.
+*/
+func (c *FulcioClient) GenerateKeylessKey(ctx context.Context, idToken string) (key Key, chain []string, err error) {
+	ctx, span := startSpan(ctx, "in_toto.FulcioClient.GenerateKeylessKey")
+	defer func() { endSpan(span, err) }()
+
+	subject, err := oidcTokenSubject(idToken)
+	if err != nil {
+		return Key{}, nil, err
+	}
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return Key{}, nil, err
+	}
+	publicKey, err := x509.MarshalPKIXPublicKey(privateKey.Public())
+	if err != nil {
+		return Key{}, nil, err
+	}
+	digest := sha256.Sum256([]byte(subject))
+	proof, err := ecdsa.SignASN1(rand.Reader, privateKey, digest[:])
+	if err != nil {
+		return Key{}, nil, err
+	}
+
+	var request struct {
+		Credentials struct {
+			OIDCIdentityToken string `json:"oidcIdentityToken"`
+		} `json:"credentials"`
+		PublicKeyRequest struct {
+			PublicKey struct {
+				Algorithm string `json:"algorithm"`
+				Content   string `json:"content"`
+			} `json:"publicKey"`
+			ProofOfPossession []byte `json:"proofOfPossession"`
+		} `json:"publicKeyRequest"`
+	}
+	request.Credentials.OIDCIdentityToken = idToken
+	request.PublicKeyRequest.PublicKey.Algorithm = "ECDSA"
+	request.PublicKeyRequest.PublicKey.Content = string(generatePEMBlock(publicKey, pemPublicKey))
+	request.PublicKeyRequest.ProofOfPossession = proof
+
+	type certificateChain struct {
+		Chain struct {
+			Certificates []string `json:"certificates"`
+		} `json:"chain"`
+	}
+	var response struct {
+		EmbeddedSCT *certificateChain `json:"signedCertificateEmbeddedSct"`
+		DetachedSCT *certificateChain `json:"signedCertificateDetachedSct"`
+	}
+	if err := postSigstoreJSON(ctx, c.Client, c.BaseURL, "api/v2/signingCert", request, &response); err != nil {
+		return Key{}, nil, err
+	}
+	var certificates []string
+	switch {
+	case response.EmbeddedSCT != nil:
+		certificates = response.EmbeddedSCT.Chain.Certificates
+	case response.DetachedSCT != nil:
+		certificates = response.DetachedSCT.Chain.Certificates
+	}
+	if len(certificates) == 0 {
+		return Key{}, nil, fmt.Errorf("%w: fulcio returned no certificate", ErrSigstoreService)
+	}
+
+	key, err = keys.NewKey(privateKey, ecdsaSha2nistp256, []string{"sha256", "sha512"})
+	if err != nil {
+		return Key{}, nil, err
+	}
+	if err := key.AttachCertificate([]byte(certificates[0])); err != nil {
+		return Key{}, nil, err
+	}
+	return key, certificates[1:], nil
+}
+
+// oidcTokenSubject returns the subject of the passed OIDC identity token that
+// Fulcio expects a proof of possession for, without verifying the token.
+func oidcTokenSubject(idToken string) (string, error) {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return "", errors.New("malformed oidc identity token")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", fmt.Errorf("malformed oidc identity token: %w", err)
+	}
+	var claims struct {
+		Email   string `json:"email"`
+		Subject string `json:"sub"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "", fmt.Errorf("malformed oidc identity token: %w", err)
+	}
+	if claims.Email != "" {
+		return claims.Email, nil
+	}
+	if claims.Subject == "" {
+		return "", errors.New("oidc identity token has no subject")
+	}
+	return claims.Subject, nil
+}
+
+/*
+RekorClient uploads signatures to a Rekor transparency log, see
+Metablock.AddRekorEntry.  If Client is nil, http.DefaultClient is used.
+*/
+type RekorClient struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+// NewRekorClient creates a RekorClient for the Rekor instance at the passed
+// base URL, e.g. DefaultRekorURL.
+func NewRekorClient(baseURL string) *RekorClient {
+	return &RekorClient{BaseURL: baseURL}
+}
+
+/*
+RekorLogEntry is an entry of a Rekor transparency log, as returned by Rekor
+when uploading an entry.  Body is the base64 encoded entry, LogIndex its
+position in the log and IntegratedTime the Unix time it was added at.  The
+Rekor signature over these fields, and the proof that the entry is included
+in the log, are in Verification.
+*/
+type RekorLogEntry struct {
+	Body           string `json:"body"`
+	IntegratedTime int64  `json:"integratedTime"`
+	LogID          string `json:"logID"`
+	LogIndex       int64  `json:"logIndex"`
+	Verification   struct {
+		InclusionProof       *RekorInclusionProof `json:"inclusionProof,omitempty"`
+		SignedEntryTimestamp []byte               `json:"signedEntryTimestamp"`
+	} `json:"verification"`
+}
+
+/*
+RekorInclusionProof proves that a log entry is included in the Merkle tree of
+a Rekor log with the passed size and root hash, see RFC 9162.  Hashes and
+RootHash are hex encoded, and Checkpoint is the signed note of the log that
+commits to the tree.  LogIndex is the position of the entry in the tree,
+which differs from the position in the log, if the log is sharded.
+*/
+type RekorInclusionProof struct {
+	Checkpoint string   `json:"checkpoint"`
+	Hashes     []string `json:"hashes"`
+	LogIndex   int64    `json:"logIndex"`
+	RootHash   string   `json:"rootHash"`
+	TreeSize   int64    `json:"treeSize"`
+}
+
+// rekorHashedRekord is the Rekor entry type that records a signature over the
+// digest of an artifact, here the signable bytes of metadata.
+type rekorHashedRekord struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Spec       struct {
+		Data struct {
+			Hash struct {
+				Algorithm string `json:"algorithm"`
+				Value     string `json:"value"`
+			} `json:"hash"`
+		} `json:"data"`
+		Signature struct {
+			Content   []byte `json:"content"`
+			PublicKey struct {
+				Content []byte `json:"content"`
+			} `json:"publicKey"`
+		} `json:"signature"`
+	} `json:"spec"`
+}
+
+/*
+UploadHashedRekord adds an entry to the log that records the passed signature
+over the data with the passed sha256 digest, created by the passed PEM
+encoded public key or certificate, and returns the entry.  Rekor verifies the
+signature before adding the entry.
+*/
+func (c *RekorClient) UploadHashedRekord(ctx context.Context, digest []byte, signature []byte, publicKey []byte) (entry RekorLogEntry, err error) {
+	ctx, span := startSpan(ctx, "in_toto.RekorClient.UploadHashedRekord")
+	defer func() { endSpan(span, err) }()
+
+	var rekord rekorHashedRekord
+	rekord.APIVersion = "0.0.1"
+	rekord.Kind = "hashedrekord"
+	rekord.Spec.Data.Hash.Algorithm = "sha256"
+	rekord.Spec.Data.Hash.Value = hex.EncodeToString(digest)
+	rekord.Spec.Signature.Content = signature
+	rekord.Spec.Signature.PublicKey.Content = publicKey
+
+	var response map[string]RekorLogEntry
+	if err := postSigstoreJSON(ctx, c.Client, c.BaseURL, "api/v1/log/entries", rekord, &response); err != nil {
+		return RekorLogEntry{}, err
+	}
+	for _, entry := range response {
+		span.SetAttribute("rekor.log_index", entry.LogIndex)
+		return entry, nil
+	}
+	return RekorLogEntry{}, fmt.Errorf("%w: rekor returned no log entry", ErrSigstoreService)
+}
+
+/*
+AddRekorEntry uploads the signature of the passed key over the signable part
+of the Metablock to the passed Rekor log, and attaches the returned log entry,
+including its log index, as timestamp of type TimestampTypeRekor to the
+signature, see RekorVerifier.  The signature is logged with its certificate,
+if any, e.g. of GenerateKeylessKey, or with the public key otherwise.  Only
+RSA and ECDSA signatures can be logged, and Rekor must support the signature
+scheme, e.g. "ecdsa-sha2-nistp256" or "rsassa-pkcs1v15-sha256".
+*/
+func (mb *Metablock) AddRekorEntry(ctx context.Context, client *RekorClient, key Key) (RekorLogEntry, error) {
+	if key.KeyType != rsaKeyType && key.KeyType != ecdsaKeyType {
+		return RekorLogEntry{}, fmt.Errorf("%w: rekor does not support '%s' signatures", ErrUnsupportedKeyType, key.KeyType)
+	}
+	for i, sig := range mb.Signatures {
+		if sig.KeyID != key.KeyID {
+			continue
+		}
+		sigBytes, err := decodeHexSignature(sig.Sig)
+		if err != nil {
+			return RekorLogEntry{}, err
+		}
+		signable, err := mb.GetSignableRepresentation()
+		if err != nil {
+			return RekorLogEntry{}, err
+		}
+		publicKey := sig.Certificate
+		if publicKey == "" {
+			publicKey = key.KeyVal.Public
+		}
+		digest := sha256.Sum256(signable)
+		entry, err := client.UploadHashedRekord(ctx, digest[:], sigBytes, []byte(publicKey))
+		if err != nil {
+			return RekorLogEntry{}, err
+		}
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return RekorLogEntry{}, err
+		}
+		mb.Signatures[i].Timestamps = append(mb.Signatures[i].Timestamps, Timestamp{
+			Type: TimestampTypeRekor,
+			Data: base64.StdEncoding.EncodeToString(data),
+		})
+		return entry, nil
+	}
+	return RekorLogEntry{}, fmt.Errorf("%w for key '%s'", ErrSignatureNotFound, key.KeyID)
+}
+
+// ParseRekorLogEntry returns the Rekor log entry of the passed timestamp of
+// type TimestampTypeRekor, e.g. to look up its log index.
+func ParseRekorLogEntry(ts Timestamp) (RekorLogEntry, error) {
+	if ts.Type != TimestampTypeRekor {
+		return RekorLogEntry{}, fmt.Errorf("%w: unexpected timestamp type '%s'", ErrInvalidRekorEntry, ts.Type)
+	}
+	data, err := base64.StdEncoding.DecodeString(ts.Data)
+	if err != nil {
+		return RekorLogEntry{}, fmt.Errorf("%w: %s", ErrInvalidRekorEntry, err)
+	}
+	var entry RekorLogEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return RekorLogEntry{}, fmt.Errorf("%w: %s", ErrInvalidRekorEntry, err)
+	}
+	return entry, nil
+}
+
+/*
+RekorVerifier is a TimestampVerifier for Rekor log entries, trusting the
+Rekor log with the passed public key, e.g. the key of the public Rekor
+instance distributed by the Sigstore project.
+*/
+type RekorVerifier struct {
+	PublicKey crypto.PublicKey
+}
+
+// Type returns TimestampTypeRekor.
+func (r RekorVerifier) Type() string {
+	return TimestampTypeRekor
+}
+
+/*
+VerifyTimestamp verifies that the passed Rekor log entry records the passed
+signature bytes, that it is signed by the log, and that it is included in the
+log, i.e. that the inclusion proof leads to the root hash of a checkpoint
+signed by the log.  On success it returns the time the entry was added to the
+log at.  Whether the signature is valid for the metadata is verified by the
+signature verification of the metadata, not by the log entry.  As anyone can
+log the same signature bytes with another digest and key, VerifySignedTimestamp
+should be used, if the signed data and signer are known.
+*/
+func (r RekorVerifier) VerifyTimestamp(ts Timestamp, signature []byte) (time.Time, error) {
+	attested, _, err := r.verifyEntry(ts, signature)
+	return attested, err
+}
+
+/*
+VerifySignedTimestamp verifies the passed Rekor log entry like
+VerifyTimestamp, and that the entry records the sha256 digest of the passed
+signed data, i.e. the signable part of the metadata, and, if not nil, the
+passed signer public key as public key or certificate key, see
+SignedTimestampVerifier.
+*/
+func (r RekorVerifier) VerifySignedTimestamp(ts Timestamp, signature []byte, signed []byte,
+	signer crypto.PublicKey) (time.Time, error) {
+	attested, rekord, err := r.verifyEntry(ts, signature)
+	if err != nil {
+		return time.Time{}, err
+	}
+	digest := sha256.Sum256(signed)
+	if rekord.Spec.Data.Hash.Algorithm != "sha256" ||
+		!digestStringsEqual(rekord.Spec.Data.Hash.Value, hex.EncodeToString(digest[:])) {
+		return time.Time{}, fmt.Errorf("%w: entry does not record the digest of the signed data", ErrInvalidRekorEntry)
+	}
+	if signer == nil {
+		return attested, nil
+	}
+	var logged Key
+	if err := logged.LoadKeyReaderDefaults(bytes.NewReader(rekord.Spec.Signature.PublicKey.Content)); err != nil {
+		return time.Time{}, fmt.Errorf("%w: malformed public key: %s", ErrInvalidRekorEntry, err)
+	}
+	loggedKey, err := logged.CryptoPublicKey()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: malformed public key: %s", ErrInvalidRekorEntry, err)
+	}
+	if equaler, ok := signer.(interface{ Equal(crypto.PublicKey) bool }); !ok || !equaler.Equal(loggedKey) {
+		return time.Time{}, fmt.Errorf("%w: entry does not record the key of the signer", ErrInvalidRekorEntry)
+	}
+	return attested, nil
+}
+
+// verifyEntry implements VerifyTimestamp, and also returns the logged entry
+// body.
+func (r RekorVerifier) verifyEntry(ts Timestamp, signature []byte) (time.Time, rekorHashedRekord, error) {
+	entry, err := ParseRekorLogEntry(ts)
+	if err != nil {
+		return time.Time{}, rekorHashedRekord{}, err
+	}
+	publicKey, err := x509.MarshalPKIXPublicKey(r.PublicKey)
+	if err != nil {
+		return time.Time{}, rekorHashedRekord{}, err
+	}
+	logID := sha256.Sum256(publicKey)
+	if entry.LogID != hex.EncodeToString(logID[:]) {
+		return time.Time{}, rekorHashedRekord{}, fmt.Errorf("%w: entry of log '%s' is not from the trusted log", ErrInvalidRekorEntry, entry.LogID)
+	}
+
+	body, err := base64.StdEncoding.DecodeString(entry.Body)
+	if err != nil {
+		return time.Time{}, rekorHashedRekord{}, fmt.Errorf("%w: %s", ErrInvalidRekorEntry, err)
+	}
+	var rekord rekorHashedRekord
+	if err := json.Unmarshal(body, &rekord); err != nil {
+		return time.Time{}, rekorHashedRekord{}, fmt.Errorf("%w: %s", ErrInvalidRekorEntry, err)
+	}
+	if rekord.Kind != "hashedrekord" || !bytes.Equal(rekord.Spec.Signature.Content, signature) {
+		return time.Time{}, rekorHashedRekord{}, fmt.Errorf("%w: entry does not record the signature", ErrInvalidRekorEntry)
+	}
+
+	// The signed entry timestamp is signed over the canonical JSON of the
+	// entry without verification
+	signed, err := EncodeCanonical(map[string]any{
+		"body":           entry.Body,
+		"integratedTime": entry.IntegratedTime,
+		"logID":          entry.LogID,
+		"logIndex":       entry.LogIndex,
+	})
+	if err != nil {
+		return time.Time{}, rekorHashedRekord{}, err
+	}
+	if err := verifyRekorSignature(r.PublicKey, signed, entry.Verification.SignedEntryTimestamp); err != nil {
+		return time.Time{}, rekorHashedRekord{}, fmt.Errorf("%w: bad signed entry timestamp: %s", ErrInvalidRekorEntry, err)
+	}
+
+	proof := entry.Verification.InclusionProof
+	if proof == nil {
+		return time.Time{}, rekorHashedRekord{}, fmt.Errorf("%w: no inclusion proof", ErrInvalidRekorEntry)
+	}
+	if err := r.verifyInclusionProof(proof, body); err != nil {
+		return time.Time{}, rekorHashedRekord{}, err
+	}
+	return time.Unix(entry.IntegratedTime, 0).UTC(), rekord, nil
+}
+
+// verifyInclusionProof verifies that the passed entry body is included in
+// the tree of the passed proof, and that the tree is committed to by a
+// checkpoint signed by the log.
+func (r RekorVerifier) verifyInclusionProof(proof *RekorInclusionProof, body []byte) error {
+	rootHash, err := hex.DecodeString(proof.RootHash)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidRekorEntry, err)
+	}
+	hashes := make([][]byte, 0, len(proof.Hashes))
+	for _, h := range proof.Hashes {
+		hash, err := hex.DecodeString(h)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidRekorEntry, err)
+		}
+		hashes = append(hashes, hash)
+	}
+	if proof.LogIndex < 0 || proof.TreeSize < 0 {
+		return fmt.Errorf("%w: negative log index or tree size", ErrInvalidRekorEntry)
+	}
+	if err := verifyMerkleInclusion(uint64(proof.LogIndex), uint64(proof.TreeSize), merkleLeafHash(body), hashes, rootHash); err != nil {
+		return err
+	}
+
+	size, root, err := r.verifyCheckpoint(proof.Checkpoint)
+	if err != nil {
+		return err
+	}
+	if size != uint64(proof.TreeSize) || !bytes.Equal(root, rootHash) {
+		return fmt.Errorf("%w: checkpoint does not commit to the tree of the inclusion proof", ErrInvalidRekorEntry)
+	}
+	return nil
+}
+
+/*
+verifyCheckpoint verifies that the passed checkpoint, a signed note whose
+text holds the log origin, the tree size and the base64 encoded root hash on
+separate lines, is signed by the log, and returns its tree size and root
+hash.  Signature lines start with an em dash, followed by the name of the
+signer, and the base64 encoded key hint and signature.  Lines that are
+malformed or whose key hint is not that of the log are skipped.
+*/
+func (r RekorVerifier) verifyCheckpoint(checkpoint string) (uint64, []byte, error) {
+	text, signatures, ok := strings.Cut(checkpoint, "\n\n")
+	if !ok {
+		return 0, nil, fmt.Errorf("%w: malformed checkpoint", ErrInvalidRekorEntry)
+	}
+	text += "\n"
+	lines := strings.Split(text, "\n")
+	if len(lines) < 4 {
+		return 0, nil, fmt.Errorf("%w: malformed checkpoint", ErrInvalidRekorEntry)
+	}
+	size, err := strconv.ParseUint(lines[1], 10, 64)
+	if err != nil {
+		return 0, nil, fmt.Errorf("%w: malformed checkpoint size: %s", ErrInvalidRekorEntry, err)
+	}
+	root, err := base64.StdEncoding.DecodeString(lines[2])
+	if err != nil {
+		return 0, nil, fmt.Errorf("%w: malformed checkpoint root hash: %s", ErrInvalidRekorEntry, err)
+	}
+
+	// The key hint of the log is the first four bytes of its log ID
+	publicKey, err := x509.MarshalPKIXPublicKey(r.PublicKey)
+	if err != nil {
+		return 0, nil, err
+	}
+	logID := sha256.Sum256(publicKey)
+
+	for _, line := range strings.Split(strings.TrimSuffix(signatures, "\n"), "\n") {
+		line, ok := strings.CutPrefix(line, "— ")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		sig, err := base64.StdEncoding.DecodeString(fields[len(fields)-1])
+		if err != nil || len(sig) < 4 || !bytes.Equal(sig[:4], logID[:4]) {
+			continue
+		}
+		if verifyRekorSignature(r.PublicKey, []byte(text), sig[4:]) == nil {
+			return size, root, nil
+		}
+	}
+	return 0, nil, fmt.Errorf("%w: checkpoint not signed by the log", ErrInvalidRekorEntry)
+}
+
+// verifyRekorSignature verifies the passed signature of a Rekor log over the
+// passed data, i.e. a signature over its sha256 digest for ECDSA and RSA
+// keys.
+func verifyRekorSignature(publicKey crypto.PublicKey, data []byte, signature []byte) error {
+	digest := sha256.Sum256(data)
+	switch k := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(k, digest[:], signature) {
+			return ErrInvalidSignature
+		}
+		return nil
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], signature)
+	case ed25519.PublicKey:
+		if !ed25519.Verify(k, data, signature) {
+			return ErrInvalidSignature
+		}
+		return nil
+	}
+	return ErrUnsupportedKeyType
+}
+
+// merkleLeafHash returns the RFC 9162 hash of the passed leaf.
+func merkleLeafHash(leaf []byte) []byte {
+	hash := sha256.Sum256(append([]byte{0x00}, leaf...))
+	return hash[:]
+}
+
+// merkleNodeHash returns the RFC 9162 hash of the node with the passed
+// children.
+func merkleNodeHash(left, right []byte) []byte {
+	hash := sha256.Sum256(append(append([]byte{0x01}, left...), right...))
+	return hash[:]
+}
+
+// verifyMerkleInclusion verifies the passed RFC 9162 inclusion proof of the
+// leaf with the passed index and hash in the tree of the passed size and root
+// hash, see section 2.1.3.2 of RFC 9162.
+func verifyMerkleInclusion(index, size uint64, leafHash []byte, proof [][]byte, rootHash []byte) error {
+	if index >= size {
+		return fmt.Errorf("%w: log index %d outside of tree of size %d", ErrInvalidRekorEntry, index, size)
+	}
+	fn, sn := index, size-1
+	hash := leafHash
+	for _, p := range proof {
+		if sn == 0 {
+			return fmt.Errorf("%w: inclusion proof too long", ErrInvalidRekorEntry)
+		}
+		if fn&1 == 1 || fn == sn {
+			hash = merkleNodeHash(p, hash)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			hash = merkleNodeHash(hash, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 || !bytes.Equal(hash, rootHash) {
+		return fmt.Errorf("%w: inclusion proof does not lead to the root hash", ErrInvalidRekorEntry)
+	}
+	return nil
+}
+
+// postSigstoreJSON posts the JSON encoding of the passed request to the passed
+// path relative to the passed base URL, and decodes the JSON response into
+// the passed response.
+func postSigstoreJSON(ctx context.Context, client *http.Client, baseURL string, path string, request any, response any) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	endpoint := strings.TrimSuffix(baseURL, "/") + "/" + path
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrSigstoreService, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrSigstoreService, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%w: POST %s responded with status %d: %s", ErrSigstoreService, endpoint, resp.StatusCode,
+			strings.TrimSpace(string(data)))
+	}
+	if err := json.Unmarshal(data, response); err != nil {
+		return fmt.Errorf("%w: invalid response of POST %s: %s", ErrSigstoreService, endpoint, err)
+	}
+	return nil
+}
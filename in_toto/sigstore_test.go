@@ -0,0 +1,377 @@
+package in_toto
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newFulcioTestServer returns a minimal Fulcio server issuing certificates
+// for the email of the identity token, signed by a test CA, and the PEM
+// encoded CA certificate.
+func newFulcioTestServer(t *testing.T) (*httptest.Server, string) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fulcio test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, caKey.Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Credentials struct {
+				OIDCIdentityToken string `json:"oidcIdentityToken"`
+			} `json:"credentials"`
+			PublicKeyRequest struct {
+				PublicKey struct {
+					Content string `json:"content"`
+				} `json:"publicKey"`
+				ProofOfPossession []byte `json:"proofOfPossession"`
+			} `json:"publicKeyRequest"`
+		}
+		if r.URL.Path != "/api/v2/signingCert" || json.NewDecoder(r.Body).Decode(&request) != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		email, err := oidcTokenSubject(request.Credentials.OIDCIdentityToken)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		block, _ := pem.Decode([]byte(request.PublicKeyRequest.PublicKey.Content))
+		if block == nil {
+			http.Error(w, "bad public key", http.StatusBadRequest)
+			return
+		}
+		publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		digest := sha256.Sum256([]byte(email))
+		if !ecdsa.VerifyASN1(publicKey.(*ecdsa.PublicKey), digest[:], request.PublicKeyRequest.ProofOfPossession) {
+			http.Error(w, "bad proof of possession", http.StatusBadRequest)
+			return
+		}
+		certDER, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+			SerialNumber:   big.NewInt(2),
+			NotBefore:      time.Now().Add(-time.Minute),
+			NotAfter:       time.Now().Add(10 * time.Minute),
+			EmailAddresses: []string{email},
+			KeyUsage:       x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		}, ca, publicKey, caKey)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		certPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}))
+		fmt.Fprintf(w, `{"signedCertificateEmbeddedSct":{"chain":{"certificates":[%q,%q]}}}`, certPEM, caPEM)
+	}))
+	return server, caPEM
+}
+
+// merkleTestRoot returns the RFC 9162 root hash of the passed leaves.
+func merkleTestRoot(leaves [][]byte) []byte {
+	if len(leaves) == 1 {
+		return merkleLeafHash(leaves[0])
+	}
+	k := merkleTestSplit(len(leaves))
+	return merkleNodeHash(merkleTestRoot(leaves[:k]), merkleTestRoot(leaves[k:]))
+}
+
+// merkleTestPath returns the RFC 9162 inclusion proof of the leaf with the
+// passed index.
+func merkleTestPath(index int, leaves [][]byte) [][]byte {
+	if len(leaves) == 1 {
+		return nil
+	}
+	k := merkleTestSplit(len(leaves))
+	if index < k {
+		return append(merkleTestPath(index, leaves[:k]), merkleTestRoot(leaves[k:]))
+	}
+	return append(merkleTestPath(index-k, leaves[k:]), merkleTestRoot(leaves[:k]))
+}
+
+// merkleTestSplit returns the largest power of two smaller than n.
+func merkleTestSplit(n int) int {
+	k := 1
+	for k*2 < n {
+		k *= 2
+	}
+	return k
+}
+
+// newRekorTestServer returns a minimal Rekor server, which logs each entry
+// between other entries, and signs entries and checkpoints with the passed
+// key.
+func newRekorTestServer(t *testing.T, logKey *ecdsa.PrivateKey) *httptest.Server {
+	publicKey, err := x509.MarshalPKIXPublicKey(logKey.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	logID := sha256.Sum256(publicKey)
+	sign := func(data []byte) []byte {
+		digest := sha256.Sum256(data)
+		sig, err := ecdsa.SignASN1(rand.Reader, logKey, digest[:])
+		if err != nil {
+			t.Error(err)
+		}
+		return sig
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if r.URL.Path != "/api/v1/log/entries" || err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		var rekord rekorHashedRekord
+		if err := json.Unmarshal(body, &rekord); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var key Key
+		if err := key.LoadKeyReaderDefaults(bytes.NewReader(rekord.Spec.Signature.PublicKey.Content)); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		cryptoKey, err := key.CryptoPublicKey()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		digest, _ := hex.DecodeString(rekord.Spec.Data.Hash.Value)
+		if !ecdsa.VerifyASN1(cryptoKey.(*ecdsa.PublicKey), digest, rekord.Spec.Signature.Content) {
+			http.Error(w, "bad signature", http.StatusBadRequest)
+			return
+		}
+
+		leaves := [][]byte{[]byte("a"), []byte("b"), []byte("c"), body, []byte("d"), []byte("e")}
+		index := 3
+		root := merkleTestRoot(leaves)
+		var hashes []string
+		for _, h := range merkleTestPath(index, leaves) {
+			hashes = append(hashes, hex.EncodeToString(h))
+		}
+		note := fmt.Sprintf("rekor.test - 1\n%d\n%s\n", len(leaves), base64.StdEncoding.EncodeToString(root))
+		noteSig := base64.StdEncoding.EncodeToString(append(logID[:4], sign([]byte(note))...))
+
+		entry := RekorLogEntry{
+			Body:           base64.StdEncoding.EncodeToString(body),
+			IntegratedTime: 1700000000,
+			LogID:          hex.EncodeToString(logID[:]),
+			LogIndex:       1003,
+		}
+		signed, err := EncodeCanonical(map[string]any{
+			"body":           entry.Body,
+			"integratedTime": entry.IntegratedTime,
+			"logID":          entry.LogID,
+			"logIndex":       entry.LogIndex,
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		entry.Verification.SignedEntryTimestamp = sign(signed)
+		entry.Verification.InclusionProof = &RekorInclusionProof{
+			Checkpoint: note + "\n— rekor.test " + noteSig + "\n",
+			Hashes:     hashes,
+			LogIndex:   int64(index),
+			RootHash:   hex.EncodeToString(root),
+			TreeSize:   int64(len(leaves)),
+		}
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]RekorLogEntry{"uuid": entry})
+	}))
+}
+
+func TestVerifyMerkleInclusion(t *testing.T) {
+	var leaves [][]byte
+	for size := 1; size <= 9; size++ {
+		leaves = append(leaves, []byte{byte(size)})
+		root := merkleTestRoot(leaves)
+		for index := range leaves {
+			proof := merkleTestPath(index, leaves)
+			assert.Nil(t, verifyMerkleInclusion(uint64(index), uint64(size), merkleLeafHash(leaves[index]), proof, root),
+				"leaf %d of %d", index, size)
+			// The proof is bound to the leaf and its index
+			assert.ErrorIs(t, verifyMerkleInclusion(uint64(index), uint64(size), merkleLeafHash([]byte("x")), proof, root),
+				ErrInvalidRekorEntry)
+			if size > 1 {
+				other := (index + 1) % size
+				assert.ErrorIs(t, verifyMerkleInclusion(uint64(other), uint64(size), merkleLeafHash(leaves[index]), proof, root),
+					ErrInvalidRekorEntry)
+			}
+		}
+	}
+	assert.ErrorIs(t, verifyMerkleInclusion(1, 1, nil, nil, nil), ErrInvalidRekorEntry)
+}
+
+func TestSigstoreKeyless(t *testing.T) {
+	fulcio, caPEM := newFulcioTestServer(t)
+	defer fulcio.Close()
+	logKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rekor := newRekorTestServer(t, logKey)
+	defer rekor.Close()
+
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"1234","email":"ci@example.com"}`))
+	key, chain, err := NewFulcioClient(fulcio.URL).GenerateKeylessKey(context.Background(), "e30."+payload+".sig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{caPEM}, chain)
+	assert.Equal(t, ecdsaKeyType, key.KeyType)
+	assert.NotEmpty(t, key.KeyVal.Certificate)
+	block, _ := pem.Decode([]byte(key.KeyVal.Certificate))
+	if block == nil {
+		t.Fatal("no certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"ci@example.com"}, cert.EmailAddresses)
+
+	mb := Metablock{Signed: Link{Type: "link", Name: "build"}}
+	if err := mb.Sign(key); err != nil {
+		t.Fatal(err)
+	}
+	entry, err := mb.AddRekorEntry(context.Background(), NewRekorClient(rekor.URL), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, int64(1003), entry.LogIndex)
+	if assert.Len(t, mb.Signatures[0].Timestamps, 1) {
+		logged, err := ParseRekorLogEntry(mb.Signatures[0].Timestamps[0])
+		assert.Nil(t, err)
+		assert.Equal(t, entry.LogIndex, logged.LogIndex)
+	}
+
+	verifier := RekorVerifier{PublicKey: logKey.Public()}
+	attested, err := VerifyMetadataTimestamps(&mb, verifier)
+	if assert.Nil(t, err) {
+		assert.Equal(t, time.Unix(1700000000, 0).UTC(), attested[key.KeyID])
+	}
+
+	// Entries of other logs are not trusted
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = VerifyMetadataTimestamps(&mb, RekorVerifier{PublicKey: otherKey.Public()})
+	assert.ErrorIs(t, err, ErrNoTimestamp)
+
+	// Entries only verify for the logged signature
+	sig, _ := hex.DecodeString(mb.Signatures[0].Sig)
+	_, err = verifier.VerifyTimestamp(mb.Signatures[0].Timestamps[0], append(sig, 0))
+	assert.ErrorIs(t, err, ErrInvalidRekorEntry)
+
+	// Entries must record the signed data and the key of the signer
+	signable, err := mb.GetSignableRepresentation()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := key.CryptoPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := mb.Signatures[0].Timestamps[0]
+	attestedAt, err := verifier.VerifySignedTimestamp(ts, sig, signable, signer)
+	if assert.Nil(t, err) {
+		assert.Equal(t, time.Unix(1700000000, 0).UTC(), attestedAt)
+	}
+	_, err = verifier.VerifySignedTimestamp(ts, sig, signable, nil)
+	assert.Nil(t, err)
+	_, err = verifier.VerifySignedTimestamp(ts, sig, append(signable, ' '), signer)
+	assert.ErrorIs(t, err, ErrInvalidRekorEntry)
+	_, err = verifier.VerifySignedTimestamp(ts, sig, signable, otherKey.Public())
+	assert.ErrorIs(t, err, ErrInvalidRekorEntry)
+
+	tamper := func(modify func(entry *RekorLogEntry)) error {
+		tampered := entry
+		proof := *entry.Verification.InclusionProof
+		tampered.Verification.InclusionProof = &proof
+		modify(&tampered)
+		data, err := json.Marshal(tampered)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = verifier.VerifyTimestamp(Timestamp{Type: TimestampTypeRekor, Data: base64.StdEncoding.EncodeToString(data)}, sig)
+		return err
+	}
+	assert.Nil(t, tamper(func(*RekorLogEntry) {}))
+	assert.ErrorIs(t, tamper(func(e *RekorLogEntry) { e.IntegratedTime++ }), ErrInvalidRekorEntry)
+	assert.ErrorIs(t, tamper(func(e *RekorLogEntry) { e.Verification.InclusionProof = nil }), ErrInvalidRekorEntry)
+	assert.ErrorIs(t, tamper(func(e *RekorLogEntry) { e.Verification.InclusionProof.LogIndex = 2 }), ErrInvalidRekorEntry)
+	assert.ErrorIs(t, tamper(func(e *RekorLogEntry) { e.Verification.InclusionProof.Checkpoint = "rekor.test\n" }), ErrInvalidRekorEntry)
+	note, noteSig, _ := strings.Cut(entry.Verification.InclusionProof.Checkpoint, "\n\n— rekor.test ")
+	for _, signatures := range []string{"— ", "— \n", "— rekor.test", "—  " + noteSig} {
+		assert.ErrorIs(t, tamper(func(e *RekorLogEntry) {
+			e.Verification.InclusionProof.Checkpoint = note + "\n\n" + signatures
+		}), ErrInvalidRekorEntry)
+	}
+	// Signatures are only verified for the key hint of the log
+	sigBytes, _ := base64.StdEncoding.DecodeString(strings.TrimSuffix(noteSig, "\n"))
+	sigBytes[0] ^= 0xff
+	assert.ErrorIs(t, tamper(func(e *RekorLogEntry) {
+		e.Verification.InclusionProof.Checkpoint = note + "\n\n— rekor.test " + base64.StdEncoding.EncodeToString(sigBytes) + "\n"
+	}), ErrInvalidRekorEntry)
+	assert.ErrorIs(t, tamper(func(e *RekorLogEntry) {
+		e.Verification.InclusionProof.TreeSize = 7
+	}), ErrInvalidRekorEntry)
+
+	// ed25519 signatures cannot be logged
+	var carol Key
+	if err := carol.LoadKeyDefaults("carol"); err != nil {
+		t.Fatal(err)
+	}
+	if err := mb.Sign(carol); err != nil {
+		t.Fatal(err)
+	}
+	_, err = mb.AddRekorEntry(context.Background(), NewRekorClient(rekor.URL), carol)
+	assert.ErrorIs(t, err, ErrUnsupportedKeyType)
+
+	_, _, err = NewFulcioClient(fulcio.URL).GenerateKeylessKey(context.Background(), "not a token")
+	assert.NotNil(t, err)
+	_, err = mb.AddRekorEntry(context.Background(), NewRekorClient(fulcio.URL), key)
+	assert.ErrorIs(t, err, ErrSigstoreService)
+}
@@ -0,0 +1,691 @@
+package in_toto
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrTUFVerification is returned when TUF metadata or targets cannot be
+// verified, e.g. because they are not signed by a threshold of trusted keys,
+// expired, or were rolled back, see TUFClient.
+var ErrTUFVerification = errors.New("tuf verification failed")
+
+const (
+	// DefaultSigstoreTUFURL is the TUF repository of the Sigstore project,
+	// which distributes the trust root of the public Fulcio and Rekor
+	// instances.
+	DefaultSigstoreTUFURL = "https://tuf-repo-cdn.sigstore.dev"
+	// SigstoreTrustedRootTarget is the TUF target of the Sigstore trust root,
+	// see ParseSigstoreTrustedRoot.
+	SigstoreTrustedRootTarget = "trusted_root.json"
+	// maxTUFRootRotations limits the number of root versions fetched in one
+	// update, like the reference implementation of TUF.
+	maxTUFRootRotations = 32
+	// maxTUFFileSize limits the size of downloaded TUF metadata and targets.
+	maxTUFFileSize = 4 << 20
+)
+
+// errTUFNotFound is returned by the getters of a TUF update, if the requested
+// file does not exist, e.g. the next version of the root.
+var errTUFNotFound = errors.New("tuf file not found")
+
+/*
+TUFClient obtains targets from a TUF repository, e.g. the Sigstore trust root
+or in-toto layouts and layout keys, see LoadTUFLayout, instead of fetching
+trust material over HTTPS unauthenticated.  Updates are verified with the TUF
+client workflow, starting from the trusted initial root metadata, which must
+be obtained out of band, e.g. shipped with the application.  Root rotations,
+expiration and rollbacks of the metadata are detected and fail with an
+ErrTUFVerification.  Delegated targets roles are not supported.
+
+Verified metadata and targets are cached in CacheDir, and verified again
+whenever they are loaded, so that a tampered cache is detected.  If Client is
+nil, http.DefaultClient is used.
+*/
+type TUFClient struct {
+	BaseURL  string
+	CacheDir string
+	Client   *http.Client
+	// Now returns the time metadata expiration is checked at, time.Now if
+	// nil
+	Now         func() time.Time
+	initialRoot []byte
+}
+
+/*
+SigstoreTUFClient obtains the Sigstore trust root, i.e. the keys of the Rekor
+logs and the certificates of the Fulcio instances, from a TUF repository,
+e.g. DefaultSigstoreTUFURL, see TrustedRoot.
+*/
+type SigstoreTUFClient = TUFClient
+
+// tufSignedMetadata is TUF metadata, whose signed portion is kept in its
+// encoded form until its signatures are verified.
+type tufSignedMetadata struct {
+	Signed     json.RawMessage `json:"signed"`
+	Signatures []struct {
+		KeyID string `json:"keyid"`
+		Sig   string `json:"sig"`
+	} `json:"signatures"`
+}
+
+// tufMetadata is the signed portion of TUF root, timestamp, snapshot and
+// targets metadata.  Fields not used by the client are ignored.
+type tufMetadata struct {
+	Type               string                 `json:"_type"`
+	Version            int                    `json:"version"`
+	Expires            time.Time              `json:"expires"`
+	Keys               map[string]tufKey      `json:"keys"`
+	Roles              map[string]tufRole     `json:"roles"`
+	ConsistentSnapshot bool                   `json:"consistent_snapshot"`
+	Meta               map[string]tufFileInfo `json:"meta"`
+	Targets            map[string]tufFileInfo `json:"targets"`
+}
+
+type tufKey struct {
+	KeyType string `json:"keytype"`
+	Scheme  string `json:"scheme"`
+	KeyVal  struct {
+		Public string `json:"public"`
+	} `json:"keyval"`
+}
+
+type tufRole struct {
+	KeyIDs    []string `json:"keyids"`
+	Threshold int      `json:"threshold"`
+}
+
+// tufFileInfo describes a metadata file in timestamp and snapshot metadata,
+// or a target file in targets metadata.
+type tufFileInfo struct {
+	Version int               `json:"version"`
+	Length  int64             `json:"length"`
+	Hashes  map[string]string `json:"hashes"`
+}
+
+/*
+NewTUFClient creates a TUFClient for the TUF repository at the passed base
+URL, which caches verified metadata and targets in the passed directory.  The
+passed initial root metadata is trusted and must be signed by a threshold of
+its own root keys.
+*/
+func NewTUFClient(baseURL string, initialRoot []byte, cacheDir string) (*TUFClient, error) {
+	if _, err := verifyTUFRoot(initialRoot, nil); err != nil {
+		return nil, fmt.Errorf("initial root: %w", err)
+	}
+	return &TUFClient{BaseURL: baseURL, CacheDir: cacheDir, initialRoot: initialRoot}, nil
+}
+
+/*
+NewSigstoreTUFClient creates a SigstoreTUFClient for the TUF repository at the
+passed base URL, like NewTUFClient, e.g. with the root.json the Sigstore
+project publishes as initial root metadata.
+*/
+func NewSigstoreTUFClient(baseURL string, initialRoot []byte, cacheDir string) (*SigstoreTUFClient, error) {
+	return NewTUFClient(baseURL, initialRoot, cacheDir)
+}
+
+/*
+Targets returns the contents of the passed targets by name.  Cached targets
+are used as long as their metadata verifies and has not expired, otherwise
+they are refreshed from the TUF repository, see RefreshTargets.
+*/
+func (c *TUFClient) Targets(ctx context.Context, names ...string) (map[string][]byte, error) {
+	if targets, _, err := c.update(ctx, false, names); err == nil {
+		return targets, nil
+	}
+	return c.RefreshTargets(ctx, names...)
+}
+
+/*
+RefreshTargets updates the metadata of the TUF repository, i.e. rotates the
+root, and fetches the timestamp, snapshot and targets metadata and the passed
+targets, verifying each against the metadata verified before, and caches them
+on success.  Versions older than the cached ones are rejected as rollback.
+*/
+func (c *TUFClient) RefreshTargets(ctx context.Context, names ...string) (targets map[string][]byte, err error) {
+	ctx, span := startSpan(ctx, "in_toto.TUFClient.RefreshTargets")
+	defer func() { endSpan(span, err) }()
+	targets, files, err := c.update(ctx, true, names)
+	if err != nil {
+		return nil, err
+	}
+	if c.CacheDir == "" {
+		return targets, nil
+	}
+	for name, file := range files {
+		path := filepath.Join(c.CacheDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, err
+		}
+		if err := writeMetadataFile(path, file, 0644); err != nil {
+			return nil, err
+		}
+	}
+	return targets, nil
+}
+
+/*
+TrustedRoot returns the Sigstore trust root of the SigstoreTrustedRootTarget.
+The cached trust root is used as long as its metadata verifies and has not
+expired, otherwise it is refreshed from the TUF repository, see Refresh.
+*/
+func (c *TUFClient) TrustedRoot(ctx context.Context) (*SigstoreTrustedRoot, error) {
+	targets, err := c.Targets(ctx, SigstoreTrustedRootTarget)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSigstoreTrustedRoot(targets[SigstoreTrustedRootTarget])
+}
+
+// Refresh refreshes the Sigstore trust root from the TUF repository, see
+// RefreshTargets.
+func (c *TUFClient) Refresh(ctx context.Context) (*SigstoreTrustedRoot, error) {
+	targets, err := c.RefreshTargets(ctx, SigstoreTrustedRootTarget)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSigstoreTrustedRoot(targets[SigstoreTrustedRootTarget])
+}
+
+/*
+update runs the TUF client workflow and returns the verified passed targets
+and the files to cache, both by name.  If remote is set, metadata is fetched
+from the repository and must not be older than the cached metadata, otherwise
+the cached metadata is verified.
+*/
+func (c *TUFClient) update(ctx context.Context, remote bool, names []string) (map[string][]byte, map[string][]byte, error) {
+	for _, name := range names {
+		if err := checkTUFTargetName(name); err != nil {
+			return nil, nil, err
+		}
+	}
+	now := time.Now
+	if c.Now != nil {
+		now = c.Now
+	}
+	files := make(map[string][]byte)
+	get := func(name string, remotePath string) ([]byte, error) {
+		if !remote {
+			return c.readCache(name)
+		}
+		data, err := c.fetch(ctx, remotePath)
+		if err == nil {
+			files[name] = data
+		}
+		return data, err
+	}
+
+	// The root is rotated from the initial root through all cached and, if
+	// remote, all newer versions, each signed by the previous version
+	root, err := verifyTUFRoot(c.initialRoot, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	for fetched := 0; fetched < maxTUFRootRotations; {
+		name := strconv.Itoa(root.Version+1) + ".root.json"
+		data, err := c.readCache(name)
+		if errors.Is(err, errTUFNotFound) && remote {
+			data, err = get(name, name)
+			fetched++
+		}
+		if errors.Is(err, errTUFNotFound) {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		next, err := verifyTUFRoot(data, root)
+		if err != nil {
+			return nil, nil, err
+		}
+		root = next
+	}
+	if now().After(root.Expires) {
+		return nil, nil, fmt.Errorf("%w: root version %d expired", ErrTUFVerification, root.Version)
+	}
+
+	// Cached versions protect against rollbacks of remote metadata
+	var cached map[string]int
+	if remote {
+		cached = c.cachedVersions(root)
+	}
+
+	timestampData, err := get("timestamp.json", "timestamp.json")
+	if err != nil {
+		return nil, nil, err
+	}
+	timestamp, err := verifyTUFRole(timestampData, "timestamp", root, now(), cached)
+	if err != nil {
+		return nil, nil, err
+	}
+	targets := timestamp
+	for _, role := range []string{"snapshot", "targets"} {
+		info, ok := targets.Meta[role+".json"]
+		if !ok {
+			return nil, nil, fmt.Errorf("%w: %s metadata is not listed", ErrTUFVerification, role)
+		}
+		remotePath := role + ".json"
+		if root.ConsistentSnapshot {
+			remotePath = strconv.Itoa(info.Version) + "." + remotePath
+		}
+		data, err := get(role+".json", remotePath)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := checkTUFFile(data, info, false); err != nil {
+			return nil, nil, fmt.Errorf("%s metadata: %w", role, err)
+		}
+		metadata, err := verifyTUFRole(data, role, root, now(), cached)
+		if err != nil {
+			return nil, nil, err
+		}
+		if metadata.Version != info.Version {
+			return nil, nil, fmt.Errorf("%w: %s metadata version %d, expected %d", ErrTUFVerification, role,
+				metadata.Version, info.Version)
+		}
+		targets = metadata
+	}
+
+	contents := make(map[string][]byte, len(names))
+	for _, name := range names {
+		info, ok := targets.Targets[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("%w: target '%s' is not listed", ErrTUFVerification, name)
+		}
+		// Consistent snapshot targets are prefixed in their last path element
+		remotePath := "targets/" + name
+		if root.ConsistentSnapshot {
+			dir, file := path.Split(name)
+			remotePath = "targets/" + dir + info.Hashes["sha256"] + "." + file
+		}
+		data, err := get(name, remotePath)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := checkTUFFile(data, info, true); err != nil {
+			return nil, nil, fmt.Errorf("target '%s': %w", name, err)
+		}
+		contents[name] = data
+	}
+	return contents, files, nil
+}
+
+// checkTUFTargetName checks that the passed target name, e.g.
+// "layouts/root.layout", is a relative path in slash notation, which neither
+// leaves the cache directory nor shadows cached metadata.
+func checkTUFTargetName(name string) error {
+	if !filepath.IsLocal(filepath.FromSlash(name)) || strings.Contains(name, `\`) {
+		return fmt.Errorf("invalid tuf target name '%s'", name)
+	}
+	// Targets are cached next to the metadata
+	if NewSet("root.json", "timestamp.json", "snapshot.json", "targets.json").Has(name) ||
+		(!strings.Contains(name, "/") && strings.HasSuffix(name, ".root.json")) {
+		return fmt.Errorf("invalid tuf target name '%s': shadows tuf metadata", name)
+	}
+	return nil
+}
+
+// cachedVersions returns the versions of the cached timestamp, snapshot and
+// targets metadata, that verify with the passed root, by role name.
+func (c *TUFClient) cachedVersions(root *tufMetadata) map[string]int {
+	versions := make(map[string]int)
+	for _, role := range []string{"timestamp", "snapshot", "targets"} {
+		data, err := c.readCache(role + ".json")
+		if err != nil {
+			continue
+		}
+		// Expired metadata is still a lower bound of the version
+		metadata, err := verifyTUFRole(data, role, root, time.Time{}, nil)
+		if err != nil {
+			continue
+		}
+		versions[role] = metadata.Version
+	}
+	return versions
+}
+
+// readCache reads the cached file of the passed name, or returns an
+// errTUFNotFound.
+func (c *TUFClient) readCache(name string) ([]byte, error) {
+	if c.CacheDir == "" {
+		return nil, errTUFNotFound
+	}
+	data, err := os.ReadFile(filepath.Join(c.CacheDir, filepath.FromSlash(name)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errTUFNotFound
+	}
+	return data, err
+}
+
+// fetch downloads the file at the passed path of the TUF repository, or
+// returns an errTUFNotFound.
+func (c *TUFClient) fetch(ctx context.Context, path string) ([]byte, error) {
+	endpoint := strings.TrimSuffix(c.BaseURL, "/") + "/" + path
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrSigstoreService, err)
+	}
+	defer resp.Body.Close()
+	// Like the reference implementation, a missing root version may also be
+	// reported as forbidden, e.g. by cloud storage
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden {
+		return nil, errTUFNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("%w: GET %s responded with status %d", ErrSigstoreService, endpoint, resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxTUFFileSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrSigstoreService, err)
+	}
+	if len(data) > maxTUFFileSize {
+		return nil, fmt.Errorf("%w: %s exceeds %d bytes", ErrTUFVerification, endpoint, maxTUFFileSize)
+	}
+	return data, nil
+}
+
+/*
+verifyTUFRoot verifies the passed root metadata, which must be signed by a
+threshold of the root keys of both the passed trusted root and itself, and
+have the next version of the trusted root.  Without trusted root, the root
+must only be signed by itself.
+*/
+func verifyTUFRoot(data []byte, trusted *tufMetadata) (*tufMetadata, error) {
+	var envelope tufSignedMetadata
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrTUFVerification, err)
+	}
+	var root tufMetadata
+	if err := json.Unmarshal(envelope.Signed, &root); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrTUFVerification, err)
+	}
+	if trusted != nil {
+		if err := verifyTUFSignatures(envelope, "root", trusted); err != nil {
+			return nil, err
+		}
+		if root.Version != trusted.Version+1 {
+			return nil, fmt.Errorf("%w: root version %d, expected %d", ErrTUFVerification, root.Version, trusted.Version+1)
+		}
+	}
+	if err := verifyTUFSignatures(envelope, "root", &root); err != nil {
+		return nil, err
+	}
+	if root.Type != "root" {
+		return nil, fmt.Errorf("%w: metadata of type '%s', expected 'root'", ErrTUFVerification, root.Type)
+	}
+	return &root, nil
+}
+
+/*
+verifyTUFRole verifies that the passed metadata of the passed top-level role
+is signed by a threshold of the keys of the role in the passed root, has not
+expired at the passed time, unless it is zero, and is not older than the
+version in the passed map of versions by role name.
+*/
+func verifyTUFRole(data []byte, role string, root *tufMetadata, now time.Time, minVersions map[string]int) (*tufMetadata, error) {
+	var envelope tufSignedMetadata
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrTUFVerification, err)
+	}
+	if err := verifyTUFSignatures(envelope, role, root); err != nil {
+		return nil, err
+	}
+	var metadata tufMetadata
+	if err := json.Unmarshal(envelope.Signed, &metadata); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrTUFVerification, err)
+	}
+	if metadata.Type != role {
+		return nil, fmt.Errorf("%w: metadata of type '%s', expected '%s'", ErrTUFVerification, metadata.Type, role)
+	}
+	if !now.IsZero() && now.After(metadata.Expires) {
+		return nil, fmt.Errorf("%w: %s version %d expired", ErrTUFVerification, role, metadata.Version)
+	}
+	if metadata.Version < minVersions[role] {
+		return nil, fmt.Errorf("%w: %s version %d rolls back version %d", ErrTUFVerification, role,
+			metadata.Version, minVersions[role])
+	}
+	return &metadata, nil
+}
+
+/*
+verifyTUFSignatures verifies that the signed portion of the passed metadata
+is signed by a threshold of distinct keys of the passed role of the passed
+root.  Keys are distinct by their public key value, not by their key ID, so
+that a key listed under several key IDs counts only once.
+*/
+func verifyTUFSignatures(envelope tufSignedMetadata, role string, root *tufMetadata) error {
+	roleKeys, ok := root.Roles[role]
+	if !ok || roleKeys.Threshold < 1 {
+		return fmt.Errorf("%w: no keys of role '%s' in root", ErrTUFVerification, role)
+	}
+	signed, err := EncodeCanonical(envelope.Signed)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrTUFVerification, err)
+	}
+	authorized := NewSet(roleKeys.KeyIDs...)
+	verified := NewSet()
+	for _, sig := range envelope.Signatures {
+		if !authorized.Has(sig.KeyID) {
+			continue
+		}
+		key, ok := root.Keys[sig.KeyID]
+		if !ok {
+			continue
+		}
+		publicKey, err := tufPublicKey(key)
+		if err != nil {
+			continue
+		}
+		der, err := x509.MarshalPKIXPublicKey(publicKey)
+		if err != nil || verified.Has(string(der)) {
+			continue
+		}
+		sigBytes, err := hex.DecodeString(sig.Sig)
+		if err != nil {
+			continue
+		}
+		if verifyTUFSignature(publicKey, signed, sigBytes) == nil {
+			verified.Add(string(der))
+		}
+	}
+	if len(verified) < roleKeys.Threshold {
+		return fmt.Errorf("%w: %s metadata signed by %d of %d required keys", ErrTUFVerification, role,
+			len(verified), roleKeys.Threshold)
+	}
+	return nil
+}
+
+// tufPublicKey returns the public key of the passed TUF key.  ECDSA and RSA
+// keys are PEM encoded, ed25519 keys hex encoded.
+func tufPublicKey(key tufKey) (crypto.PublicKey, error) {
+	switch key.KeyType {
+	case "ed25519":
+		public, err := hex.DecodeString(key.KeyVal.Public)
+		if err != nil || len(public) != ed25519.PublicKeySize {
+			return nil, ErrInvalidKey
+		}
+		return ed25519.PublicKey(public), nil
+	case "ecdsa", ecdsaSha2nistp256, "rsa":
+		block, _ := pem.Decode([]byte(key.KeyVal.Public))
+		if block == nil {
+			return nil, ErrNoPEMBlock
+		}
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	return nil, ErrUnsupportedKeyType
+}
+
+// verifyTUFSignature verifies the passed signature of the passed public key
+// of a TUF key over the passed data, see tufPublicKey.
+func verifyTUFSignature(publicKey crypto.PublicKey, data []byte, signature []byte) error {
+	if rsaKey, ok := publicKey.(*rsa.PublicKey); ok {
+		digest := sha256.Sum256(data)
+		return rsa.VerifyPSS(rsaKey, crypto.SHA256, digest[:], signature, &rsa.PSSOptions{SaltLength: sha256.Size})
+	}
+	return verifyRekorSignature(publicKey, data, signature)
+}
+
+// checkTUFFile checks the passed file against its length and hashes in the
+// passed file info, if set.  If requireHashes is set, the info must list a
+// supported hash.
+func checkTUFFile(data []byte, info tufFileInfo, requireHashes bool) error {
+	if info.Length > 0 && int64(len(data)) != info.Length {
+		return fmt.Errorf("%w: length %d, expected %d", ErrTUFVerification, len(data), info.Length)
+	}
+	checked := 0
+	for algorithm, expected := range info.Hashes {
+		var h hash.Hash
+		switch algorithm {
+		case "sha256":
+			h = sha256.New()
+		case "sha512":
+			h = sha512.New()
+		default:
+			continue
+		}
+		h.Write(data)
+		if !digestStringsEqual(sumDigest(h).String(), expected) {
+			return fmt.Errorf("%w: %s hash mismatch", ErrTUFVerification, algorithm)
+		}
+		checked++
+	}
+	if requireHashes && checked == 0 {
+		return fmt.Errorf("%w: no supported hash", ErrTUFVerification)
+	}
+	return nil
+}
+
+/*
+SigstoreTrustedRoot is the Sigstore trust root, as distributed in the
+SigstoreTrustedRootTarget of the Sigstore TUF repository: the public keys of
+the trusted Rekor logs, and the root and intermediate certificates of the
+trusted Fulcio instances, e.g. to verify certificates of keyless signers.
+*/
+type SigstoreTrustedRoot struct {
+	RekorKeys           []crypto.PublicKey
+	FulcioRoots         *x509.CertPool
+	FulcioIntermediates *x509.CertPool
+}
+
+// ParseSigstoreTrustedRoot parses the JSON encoded Sigstore trust root, see
+// SigstoreTrustedRoot.
+func ParseSigstoreTrustedRoot(data []byte) (*SigstoreTrustedRoot, error) {
+	type rawBytes struct {
+		RawBytes string `json:"rawBytes"`
+	}
+	var encoded struct {
+		MediaType string `json:"mediaType"`
+		Tlogs     []struct {
+			PublicKey rawBytes `json:"publicKey"`
+		} `json:"tlogs"`
+		CertificateAuthorities []struct {
+			CertChain struct {
+				Certificates []rawBytes `json:"certificates"`
+			} `json:"certChain"`
+		} `json:"certificateAuthorities"`
+	}
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return nil, fmt.Errorf("invalid sigstore trusted root: %w", err)
+	}
+	if !strings.HasPrefix(encoded.MediaType, "application/vnd.dev.sigstore.trustedroot") {
+		return nil, fmt.Errorf("invalid sigstore trusted root: media type '%s'", encoded.MediaType)
+	}
+
+	root := &SigstoreTrustedRoot{FulcioRoots: x509.NewCertPool(), FulcioIntermediates: x509.NewCertPool()}
+	for _, tlog := range encoded.Tlogs {
+		der, err := base64.StdEncoding.DecodeString(tlog.PublicKey.RawBytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sigstore trusted root: %w", err)
+		}
+		publicKey, err := x509.ParsePKIXPublicKey(der)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sigstore trusted root: %w", err)
+		}
+		root.RekorKeys = append(root.RekorKeys, publicKey)
+	}
+	for _, ca := range encoded.CertificateAuthorities {
+		// Chains are ordered from the issuing certificate to the root
+		for i, certificate := range ca.CertChain.Certificates {
+			der, err := base64.StdEncoding.DecodeString(certificate.RawBytes)
+			if err != nil {
+				return nil, fmt.Errorf("invalid sigstore trusted root: %w", err)
+			}
+			cert, err := x509.ParseCertificate(der)
+			if err != nil {
+				return nil, fmt.Errorf("invalid sigstore trusted root: %w", err)
+			}
+			if i == len(ca.CertChain.Certificates)-1 {
+				root.FulcioRoots.AddCert(cert)
+			} else {
+				root.FulcioIntermediates.AddCert(cert)
+			}
+		}
+	}
+	return root, nil
+}
+
+// RekorVerifiers returns a RekorVerifier for each trusted Rekor log, e.g. to
+// pass to VerifyMetadataTimestamps.
+func (r *SigstoreTrustedRoot) RekorVerifiers() []TimestampVerifier {
+	verifiers := make([]TimestampVerifier, 0, len(r.RekorKeys))
+	for _, key := range r.RekorKeys {
+		verifiers = append(verifiers, RekorVerifier{PublicKey: key})
+	}
+	return verifiers
+}
+
+/*
+VerifyFulcioCertificate verifies that the certificate of the passed keyless
+key, e.g. as obtained with FulcioClient.GenerateKeylessKey, was issued by a
+trusted Fulcio instance at the passed time, e.g. the time the signature was
+logged to Rekor, as Fulcio certificates are only valid for minutes.
+*/
+func (r *SigstoreTrustedRoot) VerifyFulcioCertificate(key Key, at time.Time) error {
+	block, _ := pem.Decode([]byte(key.KeyVal.Certificate))
+	if block == nil {
+		return ErrNoPEMBlock
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return err
+	}
+	_, err = cert.Verify(x509.VerifyOptions{
+		Roots:         r.FulcioRoots,
+		Intermediates: r.FulcioIntermediates,
+		CurrentTime:   at,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	})
+	if err != nil {
+		return fmt.Errorf("certificate not issued by a trusted fulcio instance: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,287 @@
+package in_toto
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// tufTestRepository is a TUF repository with consistent snapshots, whose
+// roles are all signed by the same root key, served over HTTP.
+type tufTestRepository struct {
+	t        *testing.T
+	mu       sync.Mutex
+	files    map[string][]byte
+	requests int
+	rootKeys []ed25519.PrivateKey
+	version  int
+}
+
+func newTUFTestRepository(t *testing.T) *tufTestRepository {
+	return &tufTestRepository{t: t, files: make(map[string][]byte)}
+}
+
+func (r *tufTestRepository) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests++
+	data, ok := r.files[strings.TrimPrefix(req.URL.Path, "/")]
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+	_, _ = w.Write(data)
+}
+
+// sign returns the TUF metadata of the passed signed portion, signed by the
+// passed keys.
+func (r *tufTestRepository) sign(signed map[string]any, keys ...ed25519.PrivateKey) []byte {
+	canonical, err := EncodeCanonical(signed)
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	var sigs []map[string]string
+	for _, key := range keys {
+		sigs = append(sigs, map[string]string{
+			"keyid": tufTestKeyID(key),
+			"sig":   hex.EncodeToString(ed25519.Sign(key, canonical)),
+		})
+	}
+	data, err := json.Marshal(map[string]any{"signed": json.RawMessage(canonical), "signatures": sigs})
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	return data
+}
+
+func tufTestKeyID(key ed25519.PrivateKey) string {
+	id := sha256.Sum256(key.Public().(ed25519.PublicKey))
+	return hex.EncodeToString(id[:])
+}
+
+// rotateRoot publishes the next root version, trusting the passed key for
+// all roles, signed by the previous and the new root key.
+func (r *tufTestRepository) rotateRoot(key ed25519.PrivateKey) []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.version++
+	role := map[string]any{"keyids": []string{tufTestKeyID(key)}, "threshold": 1}
+	root := r.sign(map[string]any{
+		"_type":               "root",
+		"spec_version":        "1.0",
+		"version":             r.version,
+		"expires":             time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+		"consistent_snapshot": true,
+		"keys": map[string]any{tufTestKeyID(key): map[string]any{
+			"keytype": "ed25519",
+			"scheme":  "ed25519",
+			"keyval":  map[string]string{"public": hex.EncodeToString(key.Public().(ed25519.PublicKey))},
+		}},
+		"roles": map[string]any{"root": role, "timestamp": role, "snapshot": role, "targets": role},
+	}, append(r.rootKeys, key)...)
+	r.rootKeys = []ed25519.PrivateKey{key}
+	r.files[fmt.Sprintf("%d.root.json", r.version)] = root
+	return root
+}
+
+// publish publishes the passed trust root with the passed metadata version,
+// and timestamp metadata that expires at the passed time.
+func (r *tufTestRepository) publish(trustedRoot []byte, version int, expires time.Time) {
+	r.publishTargets(map[string][]byte{"trusted_root.json": trustedRoot}, version, expires)
+}
+
+// publishTargets publishes the passed targets by name like publish.
+func (r *tufTestRepository) publishTargets(files map[string][]byte, version int, expires time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := r.rootKeys[0]
+	targetFiles := make(map[string]any, len(files))
+	for name, data := range files {
+		sum := sha256.Sum256(data)
+		dir, file := path.Split(name)
+		r.files["targets/"+dir+hex.EncodeToString(sum[:])+"."+file] = data
+		targetFiles[name] = map[string]any{
+			"length": len(data), "hashes": map[string]string{"sha256": hex.EncodeToString(sum[:])}}
+	}
+	exp := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	targets := r.sign(map[string]any{"_type": "targets", "version": version, "expires": exp,
+		"targets": targetFiles}, key)
+	r.files[fmt.Sprintf("%d.targets.json", version)] = targets
+	snapshot := r.sign(map[string]any{"_type": "snapshot", "version": version, "expires": exp,
+		"meta": map[string]any{"targets.json": map[string]any{"version": version}}}, key)
+	r.files[fmt.Sprintf("%d.snapshot.json", version)] = snapshot
+	r.files["timestamp.json"] = r.sign(map[string]any{"_type": "timestamp", "version": version,
+		"expires": expires.UTC().Format(time.RFC3339),
+		"meta":    map[string]any{"snapshot.json": map[string]any{"version": version, "length": len(snapshot)}}}, key)
+}
+
+func TestSigstoreTUFClient(t *testing.T) {
+	fulcio, caPEM := newFulcioTestServer(t)
+	defer fulcio.Close()
+	logKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logKeyDER, err := x509.MarshalPKIXPublicKey(logKey.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	caBlock, _ := pem.Decode([]byte(caPEM))
+	trustedRoot, err := json.Marshal(map[string]any{
+		"mediaType": "application/vnd.dev.sigstore.trustedroot+json;version=0.1",
+		"tlogs": []any{map[string]any{"baseUrl": "https://rekor.test",
+			"publicKey": map[string]string{"rawBytes": base64.StdEncoding.EncodeToString(logKeyDER)}}},
+		"certificateAuthorities": []any{map[string]any{"uri": fulcio.URL,
+			"certChain": map[string]any{"certificates": []any{
+				map[string]string{"rawBytes": base64.StdEncoding.EncodeToString(caBlock.Bytes)}}}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newKey := func() ed25519.PrivateKey {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+	repo := newTUFTestRepository(t)
+	initialRoot := repo.rotateRoot(newKey())
+	repo.publish(trustedRoot, 1, time.Now().Add(time.Hour))
+	server := httptest.NewServer(repo)
+	defer server.Close()
+
+	_, err = NewSigstoreTUFClient(server.URL, []byte(`{"signed": {"_type": "root"}, "signatures": []}`), "")
+	assert.ErrorIs(t, err, ErrTUFVerification)
+
+	cacheDir := filepath.Join(t.TempDir(), "tuf")
+	client, err := NewSigstoreTUFClient(server.URL, initialRoot, cacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := client.TrustedRoot(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, root.RekorVerifiers(), 1) {
+		assert.Equal(t, RekorVerifier{PublicKey: logKey.Public()}, root.RekorVerifiers()[0])
+	}
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"email":"ci@example.com"}`))
+	key, _, err := NewFulcioClient(fulcio.URL).GenerateKeylessKey(context.Background(), "e30."+payload+".sig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, root.VerifyFulcioCertificate(key, time.Now()))
+	assert.NotNil(t, root.VerifyFulcioCertificate(key, time.Now().Add(2*time.Hour)))
+
+	// The verified cache is used without requests
+	requests := repo.requests
+	_, err = client.TrustedRoot(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, requests, repo.requests)
+
+	// A tampered cache is not trusted, but refreshed
+	if err := os.WriteFile(filepath.Join(cacheDir, "trusted_root.json"), []byte(`{}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.TrustedRoot(context.Background())
+	assert.Nil(t, err)
+	assert.Greater(t, repo.requests, requests)
+
+	// Rotated roots are followed, if signed by the previous root
+	repo.rotateRoot(newKey())
+	repo.publish(trustedRoot, 2, time.Now().Add(time.Hour))
+	_, err = client.Refresh(context.Background())
+	assert.Nil(t, err)
+	assert.FileExists(t, filepath.Join(cacheDir, "2.root.json"))
+
+	// Rollbacks, expired metadata and tampered targets are rejected
+	repo.publish(trustedRoot, 1, time.Now().Add(time.Hour))
+	_, err = client.Refresh(context.Background())
+	assert.ErrorIs(t, err, ErrTUFVerification)
+
+	repo.publish(trustedRoot, 3, time.Now().Add(-time.Minute))
+	_, err = client.Refresh(context.Background())
+	assert.ErrorIs(t, err, ErrTUFVerification)
+
+	repo.publish(trustedRoot, 4, time.Now().Add(time.Hour))
+	sum := sha256.Sum256(trustedRoot)
+	repo.files["targets/"+hex.EncodeToString(sum[:])+".trusted_root.json"] = append(trustedRoot, ' ')
+	_, err = client.Refresh(context.Background())
+	assert.ErrorIs(t, err, ErrTUFVerification)
+
+	// Roots not signed by the previous root are rejected
+	repo.rootKeys = []ed25519.PrivateKey{newKey()}
+	repo.rotateRoot(newKey())
+	repo.publish(trustedRoot, 5, time.Now().Add(time.Hour))
+	_, err = client.Refresh(context.Background())
+	assert.ErrorIs(t, err, ErrTUFVerification)
+}
+
+// TestVerifyTUFSignaturesDistinctKeys makes sure that a key listed under
+// several key IDs counts only once towards the threshold.
+func TestVerifyTUFSignaturesDistinctKeys(t *testing.T) {
+	newKey := func() (ed25519.PrivateKey, tufKey) {
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key := tufKey{KeyType: "ed25519", Scheme: "ed25519"}
+		key.KeyVal.Public = hex.EncodeToString(private.Public().(ed25519.PublicKey))
+		return private, key
+	}
+	private, key := newKey()
+	otherPrivate, otherKey := newKey()
+	canonical, err := EncodeCanonical(map[string]any{"_type": "targets", "version": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	envelope := func(sigs map[string]ed25519.PrivateKey) tufSignedMetadata {
+		var signatures []map[string]string
+		for keyID, private := range sigs {
+			signatures = append(signatures, map[string]string{
+				"keyid": keyID,
+				"sig":   hex.EncodeToString(ed25519.Sign(private, canonical)),
+			})
+		}
+		data, err := json.Marshal(map[string]any{"signed": json.RawMessage(canonical), "signatures": signatures})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var metadata tufSignedMetadata
+		if err := json.Unmarshal(data, &metadata); err != nil {
+			t.Fatal(err)
+		}
+		return metadata
+	}
+	root := &tufMetadata{
+		Keys:  map[string]tufKey{"a": key, "b": key, "c": otherKey},
+		Roles: map[string]tufRole{"targets": {KeyIDs: []string{"a", "b", "c"}, Threshold: 2}},
+	}
+
+	err = verifyTUFSignatures(envelope(map[string]ed25519.PrivateKey{"a": private, "b": private}), "targets", root)
+	assert.ErrorIs(t, err, ErrTUFVerification)
+	assert.Nil(t, verifyTUFSignatures(envelope(map[string]ed25519.PrivateKey{"a": private, "c": otherPrivate}),
+		"targets", root))
+}
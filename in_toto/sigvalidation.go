@@ -0,0 +1,125 @@
+package in_toto
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+/*
+ErrMalformedSignature is returned when a signature cannot be decoded, or is
+not in the format of the signature scheme of the key it is verified with, as
+opposed to a well-formed signature, which does not verify.  Errors wrapping it
+also wrap ErrInvalidSignature.
+*/
+var ErrMalformedSignature = errors.New("malformed signature")
+
+// ErrSignatureKeyIDMismatch is returned when a signature is verified with a
+// key, whose key ID is not the key ID of the signature.  Errors wrapping it
+// also wrap ErrInvalidSignature.
+var ErrSignatureKeyIDMismatch = errors.New("signature key ID does not match key")
+
+// malformedSignature returns an error wrapping ErrInvalidSignature and
+// ErrMalformedSignature with the passed message.
+func malformedSignature(format string, a ...interface{}) error {
+	return fmt.Errorf("%w: %w: %s", ErrInvalidSignature, ErrMalformedSignature, fmt.Sprintf(format, a...))
+}
+
+/*
+decodeSignature validates the passed signature as input for its verification
+with the passed key, and returns the decoded signature bytes.  It returns an
+ErrSignatureKeyIDMismatch, if the signature is not from the key, and an
+ErrMalformedSignature, if the signature is not hex encoded, or not in the
+format of the scheme of the key, see validateSignatureBytes.
+*/
+func decodeSignature(key Key, sig Signature) ([]byte, error) {
+	if sig.KeyID != key.KeyID {
+		return nil, fmt.Errorf("%w: %w: signature is from key '%s', got key '%s'",
+			ErrInvalidSignature, ErrSignatureKeyIDMismatch, sig.KeyID, key.KeyID)
+	}
+	sigBytes, err := decodeHexSignature(sig.Sig)
+	if err != nil {
+		return nil, err
+	}
+	// Keys without public key value, e.g. with a certificate only, are left to
+	// their verifier
+	if public, err := key.CryptoPublicKey(); err == nil {
+		if err := validateSignatureBytes(public, sigBytes); err != nil {
+			return nil, err
+		}
+	}
+	return sigBytes, nil
+}
+
+// decodeHexSignature decodes the passed hex encoded signature, as in-toto
+// metadata carries it.  It returns an ErrMalformedSignature, if the signature
+// is empty or not hex encoded.
+func decodeHexSignature(sig string) ([]byte, error) {
+	if sig == "" {
+		return nil, malformedSignature("empty signature")
+	}
+	sigBytes, err := hex.DecodeString(sig)
+	if err != nil {
+		return nil, malformedSignature("signature is not hex encoded: %s", err)
+	}
+	return sigBytes, nil
+}
+
+// decodeBase64Signature decodes the passed base64 encoded signature, as DSSE
+// envelopes carry it.  It returns an ErrMalformedSignature, if the signature
+// is empty or not base64 encoded.
+func decodeBase64Signature(sig string) ([]byte, error) {
+	if sig == "" {
+		return nil, malformedSignature("empty signature")
+	}
+	sigBytes, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil {
+		return nil, malformedSignature("signature is not base64 encoded: %s", err)
+	}
+	return sigBytes, nil
+}
+
+/*
+validateSignatureBytes checks that the passed decoded signature is in the
+format of signatures of the passed public key, and returns an
+ErrMalformedSignature otherwise:
+
+  - ed25519 signatures are 64 bytes long,
+  - rsa signatures are as long as the modulus of the key, for RSASSA-PSS and
+    RSASSA-PKCS1-v1_5 alike,
+  - ecdsa signatures are ASN.1 DER encoded sequences of the integers r and s,
+    like securesystemslib creates them.
+
+Signatures of other public keys are not checked.
+*/
+func validateSignatureBytes(public crypto.PublicKey, sig []byte) error {
+	switch public := public.(type) {
+	case ed25519.PublicKey:
+		if len(sig) != ed25519.SignatureSize {
+			return malformedSignature("ed25519 signature has %d bytes, expected %d", len(sig), ed25519.SignatureSize)
+		}
+	case *rsa.PublicKey:
+		if len(sig) != public.Size() {
+			return malformedSignature("rsa signature has %d bytes, expected %d", len(sig), public.Size())
+		}
+	case *ecdsa.PublicKey:
+		var ecdsaSig struct {
+			R, S *big.Int
+		}
+		rest, err := asn1.Unmarshal(sig, &ecdsaSig)
+		if err != nil || len(rest) > 0 {
+			return malformedSignature("ecdsa signature is not ASN.1 DER encoded")
+		}
+		if ecdsaSig.R.Sign() <= 0 || ecdsaSig.S.Sign() <= 0 {
+			return malformedSignature("ecdsa signature has non-positive integers")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package in_toto
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/secure-systems-lab/go-securesystemslib/dsse"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifySignatureMalformed(t *testing.T) {
+	tables := []struct {
+		name    string
+		privKey string
+	}{
+		{"rsa", "dan"},
+		{"ed25519", "carol"},
+		{"ecdsa", "frank"},
+	}
+	data := []byte("in-toto signable payload")
+	for _, table := range tables {
+		var key Key
+		if err := key.LoadKeyDefaults(table.privKey); err != nil {
+			t.Fatalf("failed to load %s key: %s", table.name, err)
+		}
+		sig, err := GenerateSignature(data, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sigBytes, err := hex.DecodeString(sig.Sig)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		malformed := map[string]string{
+			"empty":      "",
+			"not hex":    strings.Repeat("x", len(sig.Sig)),
+			"odd length": sig.Sig[1:],
+			"truncated":  hex.EncodeToString(sigBytes[:len(sigBytes)-1]),
+			"extended":   sig.Sig + "00",
+		}
+		for name, malformedSig := range malformed {
+			err := VerifySignature(key, Signature{KeyID: key.KeyID, Sig: malformedSig}, data)
+			assert.ErrorIs(t, err, ErrMalformedSignature, table.name+": "+name)
+			assert.ErrorIs(t, err, ErrInvalidSignature, table.name+": "+name)
+		}
+
+		// Well-formed signatures, which do not verify, are not malformed
+		err = VerifySignature(key, sig, []byte("tampered"))
+		assert.ErrorIs(t, err, ErrInvalidSignature, table.name)
+		assert.NotErrorIs(t, err, ErrMalformedSignature, table.name)
+
+		err = VerifySignature(key, Signature{KeyID: strings.Repeat("a", 64), Sig: sig.Sig}, data)
+		assert.ErrorIs(t, err, ErrSignatureKeyIDMismatch, table.name)
+		assert.ErrorIs(t, err, ErrInvalidSignature, table.name)
+	}
+
+	// ecdsa signatures must be ASN.1 DER encoded, as opposed to the plain
+	// concatenation of r and s
+	var key Key
+	if err := key.LoadKeyDefaults("frank"); err != nil {
+		t.Fatal(err)
+	}
+	err := VerifySignature(key, Signature{KeyID: key.KeyID, Sig: strings.Repeat("01", 132)}, data)
+	assert.ErrorIs(t, err, ErrMalformedSignature)
+}
+
+func TestEnvelopeVerifySignatureMalformed(t *testing.T) {
+	var key Key
+	if err := key.LoadKeyDefaults("carol"); err != nil {
+		t.Fatal(err)
+	}
+	env := &Envelope{}
+	if err := env.SetPayload(Link{Type: "link", Name: "foo"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.Sign(key); err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, env.VerifySignature(key))
+
+	sig, err := base64.StdEncoding.DecodeString(env.envelope.Signatures[0].Sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, malformedSig := range []string{"", "not base64!", base64.StdEncoding.EncodeToString(sig[1:])} {
+		env.envelope.Signatures[0].Sig = malformedSig
+		assert.ErrorIs(t, env.VerifySignature(key), ErrMalformedSignature, malformedSig)
+	}
+}
+
+func TestEnvelopeVerifySignatureSkipsMalformed(t *testing.T) {
+	var key, rsaKey Key
+	if err := key.LoadKeyDefaults("carol"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rsaKey.LoadKeyDefaults("dan"); err != nil {
+		t.Fatal(err)
+	}
+	env := &Envelope{}
+	if err := env.SetPayload(Link{Type: "link", Name: "foo"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.Sign(rsaKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.Sign(key); err != nil {
+		t.Fatal(err)
+	}
+	valid := env.envelope.Signatures[1]
+
+	// A signature of another key type without key id precedes the valid one
+	env.envelope.Signatures[0].KeyID = ""
+	assert.Nil(t, env.VerifySignature(key))
+
+	// So does a malformed signature with the key id of the key
+	env.envelope.Signatures[0] = dsse.Signature{KeyID: key.KeyID, Sig: "not base64!"}
+	assert.Nil(t, env.VerifySignature(key))
+
+	// Without valid signature, the first malformed signature is reported
+	env.envelope.Signatures[1] = dsse.Signature{KeyID: key.KeyID, Sig: valid.Sig[4:]}
+	err := env.VerifySignature(key)
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+	assert.ErrorIs(t, err, ErrMalformedSignature)
+	assert.ErrorContains(t, err, "not base64")
+}
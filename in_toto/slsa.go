@@ -0,0 +1,154 @@
+package in_toto
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/common"
+	slsa02 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v0.2"
+)
+
+// SLSABuildTypeCommand is the default build type of provenance generated for
+// command executions, see InTotoRunProvenance.  Its build config holds the
+// executed command as "command".
+const SLSABuildTypeCommand = "https://in-toto.io/slsa/buildtypes/command@v1"
+
+// ErrNoBuilderID is returned when provenance is generated without a builder.
+var ErrNoBuilderID = errors.New("provenance requires a builder id")
+
+/*
+SLSAProvenanceOptions describe the build a SLSA provenance statement is
+generated for.
+
+  - BuilderID identifies the entity that executed the build, e.g. a URI of the
+    build orchestrator.  It is required.
+  - BuildType determines the meaning of the build config.  If empty,
+    SLSABuildTypeCommand is used.
+  - BuildInvocationID identifies this particular build, e.g. a CI job ID.
+  - Parameters and Environment are recorded as invocation parameters and
+    environment.
+  - ConfigSource describes where the build configuration came from.
+  - AdditionalMaterials are recorded in addition to the materials found on
+    disk, e.g. dependencies pinned by RecordLockfileMaterials.
+  - Reproducible and Completeness are claims of the builder about the build.
+*/
+type SLSAProvenanceOptions struct {
+	BuilderID           string
+	BuildType           string
+	BuildInvocationID   string
+	Parameters          interface{}
+	Environment         interface{}
+	ConfigSource        slsa02.ConfigSource
+	AdditionalMaterials map[string]HashObj
+	Reproducible        bool
+	Completeness        slsa02.ProvenanceComplete
+}
+
+// provenanceMaterials converts the passed artifacts into SLSA materials,
+// sorted by URI.
+func provenanceMaterials(artifacts map[string]HashObj) []common.ProvenanceMaterial {
+	materials := make([]common.ProvenanceMaterial, 0, len(artifacts))
+	for uri, digests := range artifacts {
+		digestSet := common.DigestSet{}
+		for algorithm, digest := range digests {
+			digestSet[algorithm] = digest
+		}
+		materials = append(materials, common.ProvenanceMaterial{URI: uri, Digest: digestSet})
+	}
+	sort.Slice(materials, func(i, j int) bool { return materials[i].URI < materials[j].URI })
+	return materials
+}
+
+/*
+NewSLSAProvenanceStatement creates a SLSA v0.2 provenance statement for a build
+that executed the passed command between started and finished, consuming the
+passed materials and producing the passed products.  The products become the
+subjects of the statement.
+*/
+func NewSLSAProvenanceStatement(opts SLSAProvenanceOptions, command []string, materials map[string]HashObj, products map[string]HashObj, started time.Time, finished time.Time) (*ProvenanceStatementSLSA02, error) {
+	if opts.BuilderID == "" {
+		return nil, ErrNoBuilderID
+	}
+	buildType := opts.BuildType
+	if buildType == "" {
+		buildType = SLSABuildTypeCommand
+	}
+
+	allMaterials := make(map[string]HashObj, len(materials)+len(opts.AdditionalMaterials))
+	for uri, digests := range materials {
+		allMaterials[uri] = digests
+	}
+	for uri, digests := range opts.AdditionalMaterials {
+		allMaterials[uri] = digests
+	}
+
+	started = started.UTC()
+	finished = finished.UTC()
+
+	return &ProvenanceStatementSLSA02{
+		StatementHeader: StatementHeader{
+			Type:          StatementInTotoV01,
+			PredicateType: slsa02.PredicateSLSAProvenance,
+			Subject:       SubjectsFromArtifacts(products),
+		},
+		Predicate: slsa02.ProvenancePredicate{
+			Builder:   common.ProvenanceBuilder{ID: opts.BuilderID},
+			BuildType: buildType,
+			Invocation: slsa02.ProvenanceInvocation{
+				ConfigSource: opts.ConfigSource,
+				Parameters:   opts.Parameters,
+				Environment:  opts.Environment,
+			},
+			BuildConfig: map[string]interface{}{
+				"command": command,
+			},
+			Metadata: &slsa02.ProvenanceMetadata{
+				BuildInvocationID: opts.BuildInvocationID,
+				BuildStartedOn:    &started,
+				BuildFinishedOn:   &finished,
+				Completeness:      opts.Completeness,
+				Reproducible:      opts.Reproducible,
+			},
+			Materials: provenanceMaterials(allMaterials),
+		},
+	}, nil
+}
+
+/*
+InTotoRunProvenance executes the passed command like InTotoRun, but instead of
+link metadata it returns a SLSA v0.2 provenance statement about the recorded
+products, wrapped in a DSSE envelope signed with the passed key.  The recorded
+materials and any additional materials of the passed options are listed as
+provenance materials.  If command execution, artifact recording or signing
+fails, the error is returned.
+*/
+func InTotoRunProvenance(opts SLSAProvenanceOptions, runDir string, materialPaths []string, productPaths []string, cmdArgs []string, key Key, hashAlgorithms []string, gitignorePatterns []string, lStripPaths []string, lineNormalization bool, followSymlinkDirs bool) (*Envelope, error) {
+	if opts.BuilderID == "" {
+		return nil, ErrNoBuilderID
+	}
+
+	materials, err := RecordArtifacts(materialPaths, hashAlgorithms, gitignorePatterns, lStripPaths, lineNormalization, followSymlinkDirs)
+	if err != nil {
+		return nil, err
+	}
+
+	started := time.Now()
+	if len(cmdArgs) != 0 {
+		if _, err := RunCommand(cmdArgs, runDir); err != nil {
+			return nil, err
+		}
+	}
+	finished := time.Now()
+
+	products, err := RecordArtifacts(productPaths, hashAlgorithms, gitignorePatterns, lStripPaths, lineNormalization, followSymlinkDirs)
+	if err != nil {
+		return nil, err
+	}
+
+	statement, err := NewSLSAProvenanceStatement(opts, cmdArgs, materials, products, started, finished)
+	if err != nil {
+		return nil, err
+	}
+	return GenerateAttestation(statement, key)
+}
@@ -0,0 +1,87 @@
+package in_toto
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/common"
+	slsa02 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v0.2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSLSAProvenanceStatement(t *testing.T) {
+	started := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	finished := started.Add(time.Minute)
+	opts := SLSAProvenanceOptions{
+		BuilderID:         "https://example.com/builder",
+		BuildInvocationID: "build-1",
+		AdditionalMaterials: map[string]HashObj{
+			"https://proxy.golang.org/golang.org/x/sys/@v/v0.15.0.zip": {"h1": "abcd"},
+		},
+	}
+
+	statement, err := NewSLSAProvenanceStatement(opts, []string{"go", "build"},
+		map[string]HashObj{"main.go": {"sha256": "1234"}},
+		map[string]HashObj{"app": {"sha256": "5678"}}, started, finished)
+	assert.Nil(t, err)
+	assert.Equal(t, StatementInTotoV01, statement.Type)
+	assert.Equal(t, slsa02.PredicateSLSAProvenance, statement.PredicateType)
+	assert.Equal(t, []Subject{{Name: "app", Digest: common.DigestSet{"sha256": "5678"}}}, statement.Subject)
+	assert.Equal(t, "https://example.com/builder", statement.Predicate.Builder.ID)
+	assert.Equal(t, SLSABuildTypeCommand, statement.Predicate.BuildType)
+	assert.Equal(t, map[string]interface{}{"command": []string{"go", "build"}}, statement.Predicate.BuildConfig)
+	assert.Equal(t, []common.ProvenanceMaterial{
+		{URI: "https://proxy.golang.org/golang.org/x/sys/@v/v0.15.0.zip", Digest: common.DigestSet{"h1": "abcd"}},
+		{URI: "main.go", Digest: common.DigestSet{"sha256": "1234"}},
+	}, statement.Predicate.Materials)
+	assert.Equal(t, "build-1", statement.Predicate.Metadata.BuildInvocationID)
+	assert.Equal(t, started, *statement.Predicate.Metadata.BuildStartedOn)
+	assert.Equal(t, finished, *statement.Predicate.Metadata.BuildFinishedOn)
+
+	opts.BuildType = "https://example.com/buildtype"
+	statement, err = NewSLSAProvenanceStatement(opts, nil, nil, nil, started, finished)
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.com/buildtype", statement.Predicate.BuildType)
+
+	_, err = NewSLSAProvenanceStatement(SLSAProvenanceOptions{}, nil, nil, nil, started, finished)
+	assert.ErrorIs(t, err, ErrNoBuilderID)
+}
+
+func TestInTotoRunProvenance(t *testing.T) {
+	var key Key
+	if err := key.LoadKey("carol", "ed25519", []string{"sha256", "sha512"}); err != nil {
+		t.Fatal(err)
+	}
+	opts := SLSAProvenanceOptions{BuilderID: "https://example.com/builder"}
+
+	env, err := InTotoRunProvenance(opts, "", []string{"alice.pub"}, []string{"foo.tar.gz"},
+		[]string{"sh", "-c", "true"}, key, []string{"sha256"}, nil, nil, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var pubKey Key
+	if err := pubKey.LoadKey("carol.pub", "ed25519", []string{"sha256", "sha512"}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = VerifyAttestation(env, map[string]Key{pubKey.KeyID: pubKey}, map[string]HashObj{
+		"foo.tar.gz": {"sha256": "52947cb78b91ad01fe81cd6aef42d1f6817e92b9e6936c1e5aabb7c98514f355"},
+	})
+	assert.Nil(t, err)
+
+	payload, err := env.envelope.DecodeB64Payload()
+	assert.Nil(t, err)
+	var statement ProvenanceStatementSLSA02
+	assert.Nil(t, json.Unmarshal(payload, &statement))
+	assert.Equal(t, []common.ProvenanceMaterial{{
+		URI:    "alice.pub",
+		Digest: common.DigestSet{"sha256": "f051e8b561835b7b2aa7791db7bc72f2613411b0b7d428a0ac33d45b8c518039"},
+	}}, statement.Predicate.Materials)
+	assert.False(t, statement.Predicate.Metadata.BuildFinishedOn.Before(*statement.Predicate.Metadata.BuildStartedOn))
+
+	_, err = InTotoRunProvenance(SLSAProvenanceOptions{}, "", nil, nil, nil, key, nil, nil, nil, false, false)
+	assert.ErrorIs(t, err, ErrNoBuilderID)
+	_, err = InTotoRunProvenance(opts, "", nil, nil, []string{"command-that-does-not-exist"}, key, nil, nil, nil, false, false)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,145 @@
+package in_toto
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+
+	"github.com/in-toto/in-toto-golang/in_toto/keys"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// ErrSSHAgentKeyNotFound is returned by NewSSHAgentSigner, if the ssh-agent
+// does not hold the private key of the passed public key.
+var ErrSSHAgentKeyNotFound = errors.New("key not found in ssh-agent")
+
+// sshAuthSockEnv is the environment variable that holds the path of the
+// ssh-agent socket.
+const sshAuthSockEnv = "SSH_AUTH_SOCK"
+
+// ParseSSHPublicKey parses a public key in OpenSSH format, see
+// keys.ParseSSHPublicKey.
+func ParseSSHPublicKey(data []byte) (Key, error) {
+	return keys.ParseSSHPublicKey(data)
+}
+
+// LoadSSHPublicKeys loads all public keys of the OpenSSH 'authorized_keys'
+// formatted file at the passed path by key id, see keys.LoadSSHPublicKeys.
+func LoadSSHPublicKeys(path string) (map[string]Key, error) {
+	return keys.LoadSSHPublicKeys(path)
+}
+
+// sshAgentSigner is a Signer for keys held by an ssh-agent.
+type sshAgentSigner struct {
+	agent  agent.ExtendedAgent
+	sshKey ssh.PublicKey
+	public Key
+	flags  agent.SignatureFlags
+}
+
+/*
+NewSSHAgentSigner returns a Signer that signs with the private key of the
+passed public key held by the passed ssh-agent, e.g. connected with
+ConnectSSHAgent, so that functionaries can sign links with their existing SSH
+keys, without the private key leaving the agent.  The public key is usually
+loaded with ParseSSHPublicKey.  RSA keys must use one of the
+"rsassa-pkcs1v15-sha256" or "rsassa-pkcs1v15-sha512" schemes.  If the agent
+does not hold the key, ErrSSHAgentKeyNotFound is returned.  Signatures are
+compatible to the signatures created by GenerateSignature for an in-memory key
+of the same scheme.
+*/
+func NewSSHAgentSigner(sshAgent agent.ExtendedAgent, public Key) (Signer, error) {
+	if err := keys.ValidateKey(public); err != nil {
+		return nil, err
+	}
+	cryptoKey, err := public.CryptoPublicKey()
+	if err != nil {
+		return nil, err
+	}
+	sshKey, err := ssh.NewPublicKey(cryptoKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedKeyType, err)
+	}
+
+	var flags agent.SignatureFlags
+	if public.KeyType == rsaKeyType {
+		switch public.Scheme {
+		case rsassapkcs1v15sha256:
+			flags = agent.SignatureFlagRsaSha256
+		case rsassapkcs1v15sha512:
+			flags = agent.SignatureFlagRsaSha512
+		default:
+			return nil, fmt.Errorf("%w: ssh-agents do not support the '%s' scheme", ErrSchemeKeyTypeMismatch, public.Scheme)
+		}
+	}
+
+	agentKeys, err := sshAgent.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ssh-agent keys: %w", err)
+	}
+	for _, agentKey := range agentKeys {
+		if bytes.Equal(agentKey.Marshal(), sshKey.Marshal()) {
+			public.KeyVal.Private = ""
+			return &sshAgentSigner{agent: sshAgent, sshKey: sshKey, public: public, flags: flags}, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrSSHAgentKeyNotFound, ssh.FingerprintSHA256(sshKey))
+}
+
+/*
+ConnectSSHAgent connects to the ssh-agent listening on the socket in the
+SSH_AUTH_SOCK environment variable.  The returned connection must be closed
+by the caller, once no more signatures are created.
+*/
+func ConnectSSHAgent() (agent.ExtendedAgent, net.Conn, error) {
+	socket := os.Getenv(sshAuthSockEnv)
+	if socket == "" {
+		return nil, nil, fmt.Errorf("no ssh-agent found, %s is not set", sshAuthSockEnv)
+	}
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to ssh-agent: %w", err)
+	}
+	return agent.NewClient(conn), conn, nil
+}
+
+func (s *sshAgentSigner) Sign(data []byte) (Signature, error) {
+	sshSig, err := s.agent.SignWithFlags(s.sshKey, data, s.flags)
+	if err != nil {
+		return Signature{}, fmt.Errorf("failed to sign with ssh-agent: %w", err)
+	}
+	sigBytes := sshSig.Blob
+	// SSH encodes ECDSA signatures as a pair of integers, in-toto like X.509
+	// as ASN.1 sequence
+	if _, ok := s.sshKey.(ssh.CryptoPublicKey).CryptoPublicKey().(*ecdsa.PublicKey); ok {
+		var ecSig struct {
+			R *big.Int
+			S *big.Int
+		}
+		if err := ssh.Unmarshal(sshSig.Blob, &ecSig); err != nil {
+			return Signature{}, fmt.Errorf("malformed ssh-agent signature: %w", err)
+		}
+		if sigBytes, err = asn1.Marshal(ecSig); err != nil {
+			return Signature{}, err
+		}
+	}
+	return Signature{
+		KeyID: s.public.KeyID,
+		Sig:   hex.EncodeToString(sigBytes),
+	}, nil
+}
+
+func (s *sshAgentSigner) KeyID() string {
+	return s.public.KeyID
+}
+
+func (s *sshAgentSigner) Public() Key {
+	return s.public
+}
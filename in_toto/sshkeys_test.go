@@ -0,0 +1,137 @@
+package in_toto
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// newSSHTestKey returns a private key of the passed type and its public key in
+// authorized_keys format.
+func newSSHTestKey(t *testing.T, keyType string) (crypto.Signer, []byte) {
+	var privateKey crypto.Signer
+	var err error
+	switch keyType {
+	case ed25519KeyType:
+		_, privateKey, err = ed25519.GenerateKey(rand.Reader)
+	case rsaKeyType:
+		privateKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	case ecdsaKeyType:
+		privateKey, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshKey, err := ssh.NewPublicKey(privateKey.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return privateKey, ssh.MarshalAuthorizedKey(sshKey)
+}
+
+func TestSSHAgentSigner(t *testing.T) {
+	sshAgent := agent.NewKeyring().(agent.ExtendedAgent)
+
+	for _, keyType := range []string{ed25519KeyType, rsaKeyType, ecdsaKeyType} {
+		privateKey, authorizedKey := newSSHTestKey(t, keyType)
+		public, err := ParseSSHPublicKey(authorizedKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, keyType, public.KeyType)
+		assert.Empty(t, public.KeyVal.Private)
+
+		// The agent must hold the key
+		_, err = NewSSHAgentSigner(sshAgent, public)
+		assert.ErrorIs(t, err, ErrSSHAgentKeyNotFound, keyType)
+		if err := sshAgent.Add(agent.AddedKey{PrivateKey: privateKey}); err != nil {
+			t.Fatal(err)
+		}
+		signer, err := NewSSHAgentSigner(sshAgent, public)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, public.KeyID, signer.KeyID())
+
+		// Links signed via the agent verify with the SSH public key
+		for _, opts := range [][]RunOption{nil, {WithMetablock()}} {
+			linkEnv, err := Run("foo", nil, Key{}, append(opts, WithMaterials("foo.tar.gz"), WithSigner(signer))...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Len(t, linkEnv.Sigs(), 1, keyType)
+			assert.Nil(t, linkEnv.VerifySignature(public), keyType)
+
+			prelimLinkEnv, err := RecordStart("foo", Key{}, append(opts, WithSigner(signer))...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			linkEnv, err = RecordStop(prelimLinkEnv, Key{}, append(opts, WithProducts("foo.tar.gz"), WithSigner(signer))...)
+			if assert.Nil(t, err, keyType) {
+				assert.Nil(t, linkEnv.VerifySignature(public), keyType)
+			}
+		}
+	}
+
+	// RSA keys must use a scheme the agent supports
+	_, authorizedKey := newSSHTestKey(t, rsaKeyType)
+	public, err := ParseSSHPublicKey(authorizedKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public.Scheme = rsassapsssha256Scheme
+	_, err = NewSSHAgentSigner(sshAgent, public)
+	assert.ErrorIs(t, err, ErrSchemeKeyTypeMismatch)
+}
+
+func TestLoadSSHPublicKeys(t *testing.T) {
+	dir := t.TempDir()
+	_, ed25519Key := newSSHTestKey(t, ed25519KeyType)
+	_, rsaKey := newSSHTestKey(t, rsaKeyType)
+	authorizedKeys := append(append([]byte("# functionaries\n\n"), ed25519Key...), rsaKey...)
+	path := filepath.Join(dir, "authorized_keys")
+	if err := os.WriteFile(path, authorizedKeys, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := LoadSSHPublicKeys(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, keys, 2)
+	for _, key := range keys {
+		if key.KeyType == rsaKeyType {
+			assert.Equal(t, rsassapkcs1v15sha256, key.Scheme)
+		}
+	}
+
+	// OpenSSH public keys are loaded like other key formats
+	pubPath := filepath.Join(dir, "id_ed25519.pub")
+	if err := os.WriteFile(pubPath, ed25519Key, 0644); err != nil {
+		t.Fatal(err)
+	}
+	var key Key
+	assert.Nil(t, key.LoadKeyDefaults(pubPath))
+	expected, err := ParseSSHPublicKey(ed25519Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, expected, key)
+	assert.Contains(t, keys, key.KeyID)
+
+	if err := os.WriteFile(path, []byte("ssh-ed25519 AAAA\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = LoadSSHPublicKeys(path)
+	assert.ErrorIs(t, err, ErrInvalidKey)
+}
@@ -0,0 +1,149 @@
+package in_toto
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/in-toto/in-toto-golang/in_toto/keys"
+	"github.com/stretchr/testify/assert"
+)
+
+const ivanKeyID = "1f9331310c79da254b0ef042608c5ebbe434f08bfb0426b6cc7b5f1749cf814d"
+
+func TestLoadSSLibKey(t *testing.T) {
+	var privKey Key
+	if err := privKey.LoadSSLibKey("ivan", []byte("123")); err != nil {
+		t.Fatalf("failed to load encrypted key: %s", err)
+	}
+	assert.Equal(t, ivanKeyID, privKey.KeyID)
+	assert.Equal(t, ed25519KeyType, privKey.KeyType)
+	assert.Equal(t, ed25519Scheme, privKey.Scheme)
+	// Private keys are expanded to seed and public key
+	assert.Len(t, privKey.KeyVal.Private, 128)
+
+	var pubKey Key
+	if err := pubKey.LoadSSLibKey("ivan.pub", nil); err != nil {
+		t.Fatalf("failed to load public key: %s", err)
+	}
+	assert.Equal(t, ivanKeyID, pubKey.KeyID)
+	assert.Empty(t, pubKey.KeyVal.Private)
+
+	mb := Metablock{Signed: Link{Type: "link", Name: "foo"}}
+	if err := mb.Sign(privKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := mb.VerifySignature(pubKey); err != nil {
+		t.Errorf("signature of decrypted key does not verify: %s", err)
+	}
+}
+
+func TestLoadSSLibKeyErrors(t *testing.T) {
+	var key Key
+	if err := key.LoadSSLibKey("ivan", nil); !errors.Is(err, ErrEncryptedKeyNoPassphrase) {
+		t.Errorf("expected ErrEncryptedKeyNoPassphrase, got: %v", err)
+	}
+	if err := key.LoadSSLibKey("ivan", []byte("wrong")); !errors.Is(err, ErrDecryptionFailed) {
+		t.Errorf("expected ErrDecryptionFailed, got: %v", err)
+	}
+	if err := key.LoadSSLibKey("not-existing", nil); !os.IsNotExist(err) {
+		t.Errorf("expected not exist error, got: %v", err)
+	}
+	if err := key.LoadSSLibKeyReader(strings.NewReader("a@@@@b"), []byte("123")); !errors.Is(err, ErrDecryptionFailed) {
+		t.Errorf("expected ErrDecryptionFailed for malformed key, got: %v", err)
+	}
+	if err := key.LoadSSLibKeyReader(strings.NewReader(`{"keytype": "foo"}`), nil); !errors.Is(err, ErrUnsupportedKeyType) {
+		t.Errorf("expected ErrUnsupportedKeyType, got: %v", err)
+	}
+
+	pub, err := os.ReadFile("ivan.pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := strings.Replace(string(pub), ivanKeyID, strings.Repeat("a", 64), 1)
+	if err := key.LoadSSLibKeyReader(strings.NewReader(tampered), nil); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("expected ErrInvalidKey for key ID mismatch, got: %v", err)
+	}
+}
+
+func TestLoadSSLibKeyWithPassphraseFunc(t *testing.T) {
+	called := 0
+	passphraseFunc := func() ([]byte, error) {
+		called++
+		return []byte("123"), nil
+	}
+
+	var privKey Key
+	if err := privKey.LoadSSLibKeyWithPassphraseFunc("ivan", passphraseFunc); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, called)
+	assert.Equal(t, ivanKeyID, privKey.KeyID)
+
+	// The passphrase function is not called for unencrypted keys
+	var pubKey Key
+	if err := pubKey.LoadSSLibKeyWithPassphraseFunc("ivan.pub", passphraseFunc); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, called)
+
+	if err := privKey.LoadSSLibKeyWithPassphraseFunc("ivan", func() ([]byte, error) {
+		return nil, errors.New("prompt aborted")
+	}); err == nil || err.Error() != "prompt aborted" {
+		t.Errorf("expected prompt error, got: %v", err)
+	}
+}
+
+func FuzzLoadSSLibKeyReader(f *testing.F) {
+	addFuzzSeeds(f, "ivan.pub")
+	ivan, err := os.ReadFile("ivan")
+	if err != nil {
+		f.Fatal(err)
+	}
+	ivanKey, err := keys.DecodeKey(ivan, []byte("123"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	decrypted, err := EncodePrivateKey(ivanKey, nil)
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(decrypted)
+	for _, path := range []string{"dan", "frank.pub"} {
+		var key Key
+		if err := key.LoadKeyDefaults(path); err != nil {
+			f.Fatal(err)
+		}
+		data, err := json.Marshal(key)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+
+	// Encrypted keys are not decrypted, which is too slow for fuzzing
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var key Key
+		if err := key.LoadSSLibKeyReader(bytes.NewReader(data), nil); err != nil {
+			return
+		}
+		if err := keys.ValidateKey(key); err != nil {
+			t.Fatalf("loaded invalid key: %s", err)
+		}
+		if key.KeyVal.Private == "" {
+			return
+		}
+
+		// Loaded private keys sign verifiable signatures
+		sig, err := GenerateSignature(data, key)
+		if err != nil {
+			t.Fatalf("failed to sign with loaded key: %s", err)
+		}
+		if err := VerifySignature(key, sig, data); err != nil {
+			t.Fatalf("failed to verify signature of loaded key: %s", err)
+		}
+	})
+}
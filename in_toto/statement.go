@@ -0,0 +1,274 @@
+package in_toto
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/common"
+	"github.com/secure-systems-lab/go-securesystemslib/dsse"
+)
+
+// ErrNotStatement is returned when an attestation does not carry an in-toto
+// statement.
+var ErrNotStatement = errors.New("payload is not an in-toto statement")
+
+// ErrSubjectMismatch is returned when an artifact does not match the subjects
+// of an attestation.
+var ErrSubjectMismatch = errors.New("artifact does not match attestation subjects")
+
+// ErrAttestationNotYetValid is returned when an attestation is verified before
+// the start of its validity window.
+var ErrAttestationNotYetValid = errors.New("attestation is not yet valid")
+
+// ErrAttestationExpired is returned when an attestation is verified after the
+// end of its validity window.
+var ErrAttestationExpired = errors.New("attestation has expired")
+
+// ErrAttestationValidityRequired is returned when verification requires an
+// expiry and the attestation has none.
+var ErrAttestationValidityRequired = errors.New("attestation has no expiry")
+
+/*
+StatementValidity is the validity window of a statement.  NotBefore and
+Expires are timestamps in the ISO8601DateSchema format.  Either may be empty,
+leaving the window open at that end.
+*/
+type StatementValidity struct {
+	NotBefore string `json:"notBefore,omitempty"`
+	Expires   string `json:"expires,omitempty"`
+}
+
+/*
+NewStatementValidity creates a validity window, which starts at notBefore and
+ends at expires.  A zero time leaves the window open at that end.
+*/
+func NewStatementValidity(notBefore time.Time, expires time.Time) *StatementValidity {
+	validity := &StatementValidity{}
+	if !notBefore.IsZero() {
+		validity.NotBefore = notBefore.UTC().Format(ISO8601DateSchema)
+	}
+	if !expires.IsZero() {
+		validity.Expires = expires.UTC().Format(ISO8601DateSchema)
+	}
+	return validity
+}
+
+/*
+AttestationVerifyOptions configures the enforcement of statement validity
+windows in VerifyAttestationWithOptions.
+
+  - Now is the time attestations are verified at.  If zero, the current time
+    is used.
+  - ClockSkew is the duration by which the validity window of an attestation
+    is widened at both ends, to tolerate clock differences between the signer
+    and the verifier.
+  - RequireExpiry rejects attestations without an expiry, so that no
+    attestation is trusted forever.
+*/
+type AttestationVerifyOptions struct {
+	Now           time.Time
+	ClockSkew     time.Duration
+	RequireExpiry bool
+}
+
+// verifyStatementValidity verifies that the passed time, see
+// AttestationVerifyOptions, is within the passed validity window.
+func verifyStatementValidity(validity *StatementValidity, opts AttestationVerifyOptions) error {
+	if validity == nil {
+		validity = &StatementValidity{}
+	}
+	if validity.Expires == "" && opts.RequireExpiry {
+		return ErrAttestationValidityRequired
+	}
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	if validity.NotBefore != "" {
+		notBefore, err := time.Parse(ISO8601DateSchema, validity.NotBefore)
+		if err != nil {
+			return fmt.Errorf("invalid attestation validity: %w", err)
+		}
+		if now.Before(notBefore.Add(-opts.ClockSkew)) {
+			return fmt.Errorf("%w before '%s'", ErrAttestationNotYetValid, validity.NotBefore)
+		}
+	}
+	if validity.Expires != "" {
+		expires, err := time.Parse(ISO8601DateSchema, validity.Expires)
+		if err != nil {
+			return fmt.Errorf("invalid attestation validity: %w", err)
+		}
+		if now.After(expires.Add(opts.ClockSkew)) {
+			return fmt.Errorf("%w on '%s'", ErrAttestationExpired, validity.Expires)
+		}
+	}
+	return nil
+}
+
+/*
+SubjectsFromArtifacts converts the passed artifacts, e.g. as returned by
+RecordArtifacts, into statement subjects, sorted by name.
+*/
+func SubjectsFromArtifacts(artifacts map[string]HashObj) []Subject {
+	subjects := make([]Subject, 0, len(artifacts))
+	for name, digests := range artifacts {
+		digestSet := common.DigestSet{}
+		for algorithm, digest := range digests {
+			digestSet[algorithm] = digest
+		}
+		subjects = append(subjects, Subject{Name: name, Digest: digestSet})
+	}
+	sort.Slice(subjects, func(i, j int) bool { return subjects[i].Name < subjects[j].Name })
+	return subjects
+}
+
+/*
+NewStatement creates an ITE-6 v1 statement, which attests the passed predicate
+of the passed predicate type about the passed subjects.
+*/
+func NewStatement(predicateType string, predicate interface{}, subjects []Subject) *Statement {
+	return &Statement{
+		StatementHeader: StatementHeader{
+			Type:          StatementInTotoV1,
+			PredicateType: predicateType,
+			Subject:       subjects,
+		},
+		Predicate: predicate,
+	}
+}
+
+/*
+GenerateAttestation wraps the passed statement, e.g. a Statement or any of the
+typed statements such as ProvenanceStatementSLSA02, in a DSSE envelope and
+signs it with the passed key.
+*/
+func GenerateAttestation(statement interface{}, key Key) (*Envelope, error) {
+	env := &Envelope{}
+	if err := env.SetPayload(statement); err != nil {
+		return nil, err
+	}
+	if err := env.Sign(key); err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+// decodeStatement decodes the passed JSON encoded in-toto statement.
+func decodeStatement(payload []byte) (*Statement, error) {
+	var statement Statement
+	if err := json.Unmarshal(payload, &statement); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrNotStatement, err)
+	}
+	if statement.Type != StatementInTotoV01 && statement.Type != StatementInTotoV1 {
+		return nil, fmt.Errorf("%w: unknown statement type '%s'", ErrNotStatement, statement.Type)
+	}
+	return &statement, nil
+}
+
+/*
+LoadAttestation loads a DSSE envelope carrying an in-toto statement from the
+passed path.  The payload of the returned envelope is a generic Statement.  The
+signatures of the envelope are not verified, see VerifyAttestation.
+*/
+func LoadAttestation(path string) (*Envelope, error) {
+	jsonBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	dsseEnv := &dsse.Envelope{}
+	if err := json.Unmarshal(jsonBytes, dsseEnv); err != nil {
+		return nil, err
+	}
+	if dsseEnv.PayloadType != PayloadType {
+		return nil, ErrInvalidPayloadType
+	}
+
+	payload, err := dsseEnv.DecodeB64Payload()
+	if err != nil {
+		return nil, err
+	}
+	statement, err := decodeStatement(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Envelope{envelope: dsseEnv, payload: *statement}, nil
+}
+
+/*
+VerifySubjects verifies that each of the passed artifacts matches a subject
+of the same name.  An artifact matches a subject if they have at least one
+digest algorithm in common and the digests of all common algorithms are
+equal.  Subjects without a corresponding artifact are ignored.
+*/
+func VerifySubjects(subjects []Subject, artifacts map[string]HashObj) error {
+	for name, artifactDigests := range artifacts {
+		matched := false
+		for _, subject := range subjects {
+			if subject.Name != name {
+				continue
+			}
+			if digestsMatch(artifactDigests, HashObj(subject.Digest)) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%w: '%s'", ErrSubjectMismatch, name)
+		}
+	}
+	return nil
+}
+
+/*
+VerifyAttestation verifies that the passed attestation is signed by each of
+the passed keys, that it is within the validity window of its statement, if
+any, and that its statement is bound to the passed artifacts, see
+VerifySubjects.  On success it returns the statement of the attestation.
+*/
+func VerifyAttestation(attestation *Envelope, keys map[string]Key, artifacts map[string]HashObj) (*Statement, error) {
+	return VerifyAttestationWithOptions(attestation, keys, artifacts, AttestationVerifyOptions{})
+}
+
+/*
+VerifyAttestationWithOptions behaves like VerifyAttestation, but enforces the
+validity window of the statement as configured by the passed options.  The
+validity window is read from the signed payload, so that it can not be
+changed without invalidating the signatures.
+*/
+func VerifyAttestationWithOptions(attestation *Envelope, keys map[string]Key, artifacts map[string]HashObj, opts AttestationVerifyOptions) (*Statement, error) {
+	if len(keys) < 1 {
+		return nil, fmt.Errorf("attestation verification requires at least one key")
+	}
+	for _, key := range keys {
+		if err := attestation.VerifySignature(key); err != nil {
+			return nil, err
+		}
+	}
+
+	// Decode the signed payload, regardless of the payload type the envelope
+	// was created with, e.g. a typed statement
+	payload, err := attestation.envelope.DecodeB64Payload()
+	if err != nil {
+		return nil, err
+	}
+	statement, err := decodeStatement(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := verifyStatementValidity(statement.Validity, opts); err != nil {
+		return nil, err
+	}
+
+	if err := VerifySubjects(statement.Subject, artifacts); err != nil {
+		return nil, err
+	}
+	return statement, nil
+}
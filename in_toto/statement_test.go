@@ -0,0 +1,169 @@
+package in_toto
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubjectsFromArtifacts(t *testing.T) {
+	artifacts := map[string]HashObj{
+		"foo.tar.gz": {"sha256": "52947cb78b91ad01fe81cd6aef42d1f6817e92b9e6936c1e5aabb7c98514f355"},
+		"bar":        {"sha256": "abcd", "sha512": "ef01"},
+	}
+	subjects := SubjectsFromArtifacts(artifacts)
+	if assert.Len(t, subjects, 2) {
+		assert.Equal(t, "bar", subjects[0].Name)
+		assert.Equal(t, "ef01", subjects[0].Digest["sha512"])
+		assert.Equal(t, "foo.tar.gz", subjects[1].Name)
+	}
+}
+
+func TestVerifySubjects(t *testing.T) {
+	subjects := []Subject{
+		{Name: "foo", Digest: map[string]string{"sha256": "aaaa", "sha512": "bbbb"}},
+		{Name: "bar", Digest: map[string]string{"sha256": "cccc"}},
+	}
+
+	tables := []struct {
+		name      string
+		artifacts map[string]HashObj
+		match     bool
+	}{
+		{"no artifacts", map[string]HashObj{}, true},
+		{"all matching", map[string]HashObj{"foo": {"sha256": "aaaa"}, "bar": {"sha256": "cccc"}}, true},
+		{"additional algorithm", map[string]HashObj{"bar": {"sha256": "cccc", "sha512": "dddd"}}, true},
+		{"wrong digest", map[string]HashObj{"foo": {"sha256": "aaaa", "sha512": "ffff"}}, false},
+		{"no common algorithm", map[string]HashObj{"bar": {"sha512": "cccc"}}, false},
+		{"unknown artifact", map[string]HashObj{"baz": {"sha256": "aaaa"}}, false},
+	}
+	for _, table := range tables {
+		err := VerifySubjects(subjects, table.artifacts)
+		if table.match {
+			assert.Nil(t, err, table.name)
+		} else {
+			assert.ErrorIs(t, err, ErrSubjectMismatch, table.name)
+		}
+	}
+}
+
+func TestGenerateAndVerifyAttestation(t *testing.T) {
+	var key Key
+	if err := key.LoadKeyDefaults("carol"); err != nil {
+		t.Fatal(err)
+	}
+	var otherKey Key
+	if err := otherKey.LoadKeyDefaults("dan"); err != nil {
+		t.Fatal(err)
+	}
+
+	artifacts, err := RecordArtifacts([]string{"foo.tar.gz"}, []string{"sha256"}, nil, nil, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statement := NewStatement("https://example.com/test/v1", map[string]interface{}{"foo": "bar"},
+		SubjectsFromArtifacts(artifacts))
+	env, err := GenerateAttestation(statement, key)
+	if err != nil {
+		t.Fatalf("GenerateAttestation failed: %s", err)
+	}
+
+	if err := env.Dump("test.attestation.json"); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("test.attestation.json")
+
+	loaded, err := LoadAttestation("test.attestation.json")
+	if err != nil {
+		t.Fatalf("LoadAttestation failed: %s", err)
+	}
+	assert.Equal(t, "https://example.com/test/v1", loaded.GetPayload().(Statement).PredicateType)
+
+	verified, err := VerifyAttestation(loaded, map[string]Key{key.KeyID: key}, artifacts)
+	if err != nil {
+		t.Fatalf("VerifyAttestation failed: %s", err)
+	}
+	assert.Equal(t, StatementInTotoV1, verified.Type)
+	assert.Equal(t, map[string]interface{}{"foo": "bar"}, verified.Predicate)
+
+	_, err = VerifyAttestation(loaded, map[string]Key{otherKey.KeyID: otherKey}, artifacts)
+	assert.NotNil(t, err)
+	_, err = VerifyAttestation(loaded, map[string]Key{}, artifacts)
+	assert.NotNil(t, err)
+	_, err = VerifyAttestation(loaded, map[string]Key{key.KeyID: key},
+		map[string]HashObj{"foo.tar.gz": {"sha256": "0000"}})
+	assert.ErrorIs(t, err, ErrSubjectMismatch)
+
+	// Links can not be loaded as attestations
+	_, err = LoadAttestation("package-dsse.2f89b927.link")
+	assert.ErrorIs(t, err, ErrNotStatement)
+
+	notJSON, _ := json.Marshal("foo")
+	if err := os.WriteFile("not-an-attestation.json", notJSON, 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("not-an-attestation.json")
+	_, err = LoadAttestation("not-an-attestation.json")
+	assert.NotNil(t, err)
+}
+
+func TestVerifyAttestationValidity(t *testing.T) {
+	var key Key
+	if err := key.LoadKeyDefaults("carol"); err != nil {
+		t.Fatal(err)
+	}
+	keys := map[string]Key{key.KeyID: key}
+	artifacts := map[string]HashObj{"foo": {"sha256": "aaaa"}}
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	attest := func(validity *StatementValidity) *Envelope {
+		statement := NewStatement("https://example.com/test/v1", nil, SubjectsFromArtifacts(artifacts))
+		statement.Validity = validity
+		env, err := GenerateAttestation(statement, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return env
+	}
+
+	tables := []struct {
+		name     string
+		validity *StatementValidity
+		opts     AttestationVerifyOptions
+		err      error
+	}{
+		{"no validity", nil, AttestationVerifyOptions{Now: now}, nil},
+		{"no validity with required expiry", nil, AttestationVerifyOptions{Now: now, RequireExpiry: true}, ErrAttestationValidityRequired},
+		{"within window", NewStatementValidity(now.Add(-time.Hour), now.Add(time.Hour)),
+			AttestationVerifyOptions{Now: now, RequireExpiry: true}, nil},
+		{"not yet valid", NewStatementValidity(now.Add(time.Minute), time.Time{}),
+			AttestationVerifyOptions{Now: now}, ErrAttestationNotYetValid},
+		{"not yet valid within clock skew", NewStatementValidity(now.Add(time.Minute), time.Time{}),
+			AttestationVerifyOptions{Now: now, ClockSkew: 5 * time.Minute}, nil},
+		{"expired", NewStatementValidity(time.Time{}, now.Add(-time.Minute)),
+			AttestationVerifyOptions{Now: now}, ErrAttestationExpired},
+		{"expired within clock skew", NewStatementValidity(time.Time{}, now.Add(-time.Minute)),
+			AttestationVerifyOptions{Now: now, ClockSkew: 5 * time.Minute}, nil},
+	}
+	for _, table := range tables {
+		statement, err := VerifyAttestationWithOptions(attest(table.validity), keys, artifacts, table.opts)
+		if table.err == nil {
+			if assert.Nil(t, err, table.name) {
+				assert.Equal(t, table.validity, statement.Validity, table.name)
+			}
+		} else {
+			assert.ErrorIs(t, err, table.err, table.name)
+		}
+	}
+
+	// VerifyAttestation enforces the validity window at the current time
+	_, err := VerifyAttestation(attest(NewStatementValidity(time.Time{}, time.Now().Add(-time.Hour))), keys, artifacts)
+	assert.ErrorIs(t, err, ErrAttestationExpired)
+
+	_, err = VerifyAttestation(attest(&StatementValidity{Expires: "tomorrow"}), keys, artifacts)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,193 @@
+package in_toto
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrSublayoutDigestMismatch is returned when a fetched sublayout does not
+// match the digest pinned in the referencing layout.
+var ErrSublayoutDigestMismatch = errors.New("sublayout digest mismatch")
+
+// ErrSublayoutFetch is returned when a referenced sublayout cannot be fetched.
+var ErrSublayoutFetch = errors.New("failed to fetch sublayout")
+
+// maxSublayoutSize limits the size of sublayouts fetched via HTTP, like
+// maxTUFFileSize limits TUF metadata.
+const maxSublayoutSize = 4 << 20
+
+/*
+SublayoutReference references the sublayout of a step, which is fetched from
+URI during verification, instead of being shipped as link metadata file of the
+step.  The fetched sublayout must match Digest, i.e. the hex encoded digests
+of the metadata file by hash algorithm, see SupportedHashAlgorithms.  Like a
+shipped sublayout it must be signed by the functionaries of the step, and the
+links of its steps are loaded from the sublayout link directory, see
+SublayoutLinkDirFormat.
+*/
+type SublayoutReference struct {
+	URI    string  `json:"uri"`
+	Digest HashObj `json:"digest"`
+}
+
+// validateSublayoutReference checks that the passed reference has a URI and
+// at least one hex encoded digest of a supported hash algorithm.
+func validateSublayoutReference(ref SublayoutReference) error {
+	if ref.URI == "" {
+		return fmt.Errorf("empty uri")
+	}
+	if len(ref.Digest) == 0 {
+		return fmt.Errorf("no digest for '%s'", ref.URI)
+	}
+	for algorithm, digest := range ref.Digest {
+		if err := validateHashAlgorithms([]string{algorithm}); err != nil {
+			return err
+		}
+		if err := validateHexString(digest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+Fetcher retrieves the contents of a URI, e.g. of a referenced sublayout.
+Custom transports, e.g. object storage or authenticated registries, can be
+used by implementing this interface, or via FetcherFunc.
+*/
+type Fetcher interface {
+	Fetch(ctx context.Context, uri string) ([]byte, error)
+}
+
+// FetcherFunc is an adapter to use an ordinary function as Fetcher.
+type FetcherFunc func(ctx context.Context, uri string) ([]byte, error)
+
+// Fetch calls f(ctx, uri).
+func (f FetcherFunc) Fetch(ctx context.Context, uri string) ([]byte, error) {
+	return f(ctx, uri)
+}
+
+/*
+URIFetcher fetches 'file', 'http' and 'https' URIs.  Relative file URIs and
+URIs without scheme are resolved relative to BaseDir, or the current working
+directory if empty.  If Client is nil, http.DefaultClient is used.
+*/
+type URIFetcher struct {
+	BaseDir string
+	Client  *http.Client
+}
+
+// Fetch returns the contents at the passed URI.  Any HTTP response status
+// other than 200, or a response body of more than 4 MiB results in an
+// ErrSublayoutFetch.
+func (f *URIFetcher) Fetch(ctx context.Context, uri string) (data []byte, err error) {
+	ctx, span := startSpan(ctx, "in_toto.URIFetcher.Fetch")
+	span.SetAttribute("in_toto.uri", uri)
+	defer func() { endSpan(span, err) }()
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrSublayoutFetch, err)
+	}
+
+	switch u.Scheme {
+	case "", "file":
+		p := u.Path
+		if u.Scheme == "" {
+			p = uri
+		}
+		p = filepath.FromSlash(p)
+		// On Windows, an absolute file URI has a leading slash before the
+		// drive letter, e.g. file:///C:/layouts/sub.layout
+		if filepath.VolumeName(strings.TrimPrefix(p, string(filepath.Separator))) != "" {
+			p = strings.TrimPrefix(p, string(filepath.Separator))
+		}
+		if !filepath.IsAbs(p) && f.BaseDir != "" {
+			p = filepath.Join(f.BaseDir, p)
+		}
+		return os.ReadFile(p)
+
+	case "http", "https":
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+		if err != nil {
+			return nil, err
+		}
+		client := f.Client
+		if client == nil {
+			client = http.DefaultClient
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrSublayoutFetch, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("%w: '%s' responded with status %d", ErrSublayoutFetch, uri, resp.StatusCode)
+		}
+		data, err := io.ReadAll(io.LimitReader(resp.Body, maxSublayoutSize+1))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrSublayoutFetch, err)
+		}
+		if len(data) > maxSublayoutSize {
+			return nil, fmt.Errorf("%w: '%s' exceeds %d bytes", ErrSublayoutFetch, uri, maxSublayoutSize)
+		}
+		return data, nil
+	}
+
+	return nil, fmt.Errorf("%w: unsupported scheme of '%s'", ErrSublayoutFetch, uri)
+}
+
+/*
+fetchSublayout fetches the sublayout referenced by the passed step with the
+passed fetcher and verifies it against the pinned digest.  It returns the
+sublayout by the key ids of the step's functionaries it carries signatures
+of, like LoadLinksForLayout returns the links of a step.  The signatures
+themselves are verified later, see VerifyLinkSignatureThesholds.
+*/
+func fetchSublayout(ctx context.Context, step Step, fetcher Fetcher) (map[string]Metadata, error) {
+	ref := step.Sublayout
+	data, err := fetcher.Fetch(ctx, ref.URI)
+	if err != nil {
+		return nil, fmt.Errorf("sublayout of step '%s': %w", step.Name, err)
+	}
+
+	algorithms := make([]string, 0, len(ref.Digest))
+	for algorithm := range ref.Digest {
+		algorithms = append(algorithms, algorithm)
+	}
+	digest, err := hashReader(bytes.NewReader(data), algorithms, false)
+	if err != nil {
+		return nil, err
+	}
+	for algorithm, expected := range ref.Digest {
+		if !digestStringsEqual(digest[algorithm], expected) {
+			return nil, fmt.Errorf("%w: '%s' of step '%s' has %s digest '%s', expected '%s'",
+				ErrSublayoutDigestMismatch, ref.URI, step.Name, algorithm, digest[algorithm], expected)
+		}
+	}
+
+	sublayoutEnv, err := decodeMetadata(data)
+	if err != nil {
+		return nil, fmt.Errorf("sublayout of step '%s': %w", step.Name, err)
+	}
+	if _, ok := sublayoutEnv.GetPayload().(Layout); !ok {
+		return nil, fmt.Errorf("sublayout of step '%s': %w", step.Name, ErrNotLayout)
+	}
+
+	functionaries := NewSet(step.PubKeys...)
+	linksPerStep := make(map[string]Metadata)
+	for _, sig := range sublayoutEnv.Sigs() {
+		if functionaries.Has(sig.KeyID) {
+			linksPerStep[sig.KeyID] = sublayoutEnv
+		}
+	}
+	return linksPerStep, nil
+}
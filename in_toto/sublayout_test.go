@@ -0,0 +1,159 @@
+package in_toto
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newSublayoutReferenceLayout returns the super layout with a reference to
+// the sublayout of its step at the passed URI, signed by the passed key.
+func newSublayoutReferenceLayout(t *testing.T, key Key, uri string, digest HashObj) Metadata {
+	superLayoutMb, err := LoadMetadata("super.layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	layout := superLayoutMb.GetPayload().(Layout)
+	layout.Expires = time.Now().Add(time.Hour).UTC().Format(ISO8601DateSchema)
+	layout.Steps[0].Sublayout = &SublayoutReference{URI: uri, Digest: digest}
+
+	layoutMb := &Metablock{Signed: layout}
+	if err := layoutMb.Sign(key); err != nil {
+		t.Fatal(err)
+	}
+	return layoutMb
+}
+
+func TestVerifySublayoutReference(t *testing.T) {
+	var key Key
+	if err := key.LoadKeyDefaults("alice"); err != nil {
+		t.Fatal(err)
+	}
+	layoutKeys := map[string]Key{key.KeyID: key}
+
+	// The sublayout is fetched from outside the link directory, the links of
+	// its steps are shipped in the sublayout link directory as usual
+	sublayoutBytes, err := os.ReadFile("sub_layout.70ca5750.link")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sublayoutPath := filepath.Join(t.TempDir(), "sub.layout")
+	if err := os.WriteFile(sublayoutPath, sublayoutBytes, 0644); err != nil {
+		t.Fatal(err)
+	}
+	digest := HashObj{"sha256": fmt.Sprintf("%x", sha256.Sum256(sublayoutBytes))}
+
+	linkDir := t.TempDir()
+	sublayoutLinkDir := filepath.Join(linkDir, fmt.Sprintf(SublayoutLinkDirFormat, "sub_layout", key.KeyID))
+	if err := os.Mkdir(sublayoutLinkDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for _, link := range []string{"write-code.b7d643de.link", "package.d3ffd108.link"} {
+		if err := os.Link(link, filepath.Join(sublayoutLinkDir, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	layoutEnv := newSublayoutReferenceLayout(t, key, "file://"+filepath.ToSlash(sublayoutPath), digest)
+	summary, err := InTotoVerify(layoutEnv, layoutKeys, linkDir, "", nil, nil, testOSisWindows())
+	if assert.Nil(t, err) {
+		assert.Contains(t, summary.GetPayload().(Link).Products, "foo.tar.gz")
+	}
+
+	// Relative URIs are resolved in the link directory
+	if err := os.WriteFile(filepath.Join(linkDir, "sub.layout"), sublayoutBytes, 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = InTotoVerify(newSublayoutReferenceLayout(t, key, "sub.layout", digest),
+		layoutKeys, linkDir, "", nil, nil, testOSisWindows())
+	assert.Nil(t, err)
+
+	// The sublayout is fetched with the passed fetcher
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sub.layout":
+			w.Write(sublayoutBytes) //nolint:errcheck
+		case "/huge.layout":
+			w.Write(make([]byte, maxSublayoutSize+1)) //nolint:errcheck
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	_, err = InTotoVerifyWithFetcher(newSublayoutReferenceLayout(t, key, server.URL+"/sub.layout", digest),
+		layoutKeys, linkDir, "", nil, nil, testOSisWindows(), &URIFetcher{Client: server.Client()})
+	assert.Nil(t, err)
+	_, err = InTotoVerifyWithFetcher(newSublayoutReferenceLayout(t, key, server.URL+"/missing.layout", digest),
+		layoutKeys, linkDir, "", nil, nil, testOSisWindows(), &URIFetcher{Client: server.Client()})
+	assert.ErrorIs(t, err, ErrSublayoutFetch)
+	_, err = (&URIFetcher{Client: server.Client()}).Fetch(context.Background(), server.URL+"/huge.layout")
+	assert.ErrorIs(t, err, ErrSublayoutFetch)
+
+	fetched := ""
+	fetcher := FetcherFunc(func(ctx context.Context, uri string) ([]byte, error) {
+		fetched = uri
+		return sublayoutBytes, nil
+	})
+	_, err = InTotoVerifyWithFetcher(newSublayoutReferenceLayout(t, key, "registry://sub", digest),
+		layoutKeys, linkDir, "", nil, nil, testOSisWindows(), fetcher)
+	assert.Nil(t, err)
+	assert.Equal(t, "registry://sub", fetched)
+
+	// Digests are compared case-insensitively
+	upperDigest := HashObj{"sha256": strings.ToUpper(digest["sha256"])}
+	_, err = InTotoVerify(newSublayoutReferenceLayout(t, key, sublayoutPath, upperDigest),
+		layoutKeys, linkDir, "", nil, nil, testOSisWindows())
+	assert.Nil(t, err)
+
+	// Sublayouts not matching the pinned digest are rejected
+	_, err = InTotoVerify(newSublayoutReferenceLayout(t, key, sublayoutPath, HashObj{"sha256": fmt.Sprintf("%x", sha256.Sum256(nil))}),
+		layoutKeys, linkDir, "", nil, nil, testOSisWindows())
+	assert.ErrorIs(t, err, ErrSublayoutDigestMismatch)
+
+	// Fetched metadata must be a layout signed by the functionaries of the step
+	linkBytes, err := os.ReadFile("write-code.b7d643de.link")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = InTotoVerifyWithFetcher(newSublayoutReferenceLayout(t, key, "link", HashObj{"sha256": fmt.Sprintf("%x", sha256.Sum256(linkBytes))}),
+		layoutKeys, linkDir, "", nil, nil, testOSisWindows(), FetcherFunc(func(ctx context.Context, uri string) ([]byte, error) {
+			return linkBytes, nil
+		}))
+	assert.ErrorIs(t, err, ErrNotLayout)
+
+	_, err = InTotoVerify(newSublayoutReferenceLayout(t, key, "ftp://example.com/sub.layout", digest),
+		layoutKeys, linkDir, "", nil, nil, testOSisWindows())
+	assert.ErrorIs(t, err, ErrSublayoutFetch)
+}
+
+func TestValidateSublayoutReference(t *testing.T) {
+	digest := fmt.Sprintf("%x", sha256.Sum256(nil))
+	tables := []struct {
+		ref   SublayoutReference
+		valid bool
+	}{
+		{SublayoutReference{URI: "sub.layout", Digest: HashObj{"sha256": digest}}, true},
+		{SublayoutReference{Digest: HashObj{"sha256": digest}}, false},
+		{SublayoutReference{URI: "sub.layout"}, false},
+		{SublayoutReference{URI: "sub.layout", Digest: HashObj{"md5": digest}}, false},
+		{SublayoutReference{URI: "sub.layout", Digest: HashObj{"sha256": "not hex"}}, false},
+	}
+	for _, table := range tables {
+		step := Step{Type: "step", Sublayout: &table.ref, SupplyChainItem: SupplyChainItem{Name: "sub"}}
+		err := validateStep(step)
+		if table.valid {
+			assert.Nil(t, err, table.ref)
+		} else {
+			assert.NotNil(t, err, table.ref)
+		}
+	}
+}
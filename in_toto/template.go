@@ -0,0 +1,124 @@
+package in_toto
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// ErrUnresolvedTemplateParameter is returned when expanding a StepTemplate
+// leaves a '{<name>}' marker without a corresponding parameter value.
+var ErrUnresolvedTemplateParameter = errors.New("unresolved template parameter")
+
+/*
+StepTemplate is a reusable, parameterized blueprint for a layout Step.  The
+expected command and the expected materials and products of the template may
+contain '{<name>}' markers, using the same syntax as SubstituteParameters,
+which are replaced by concrete values when the template is expanded.  The
+template's own name is ignored, every expanded step gets the name passed to
+Expand.  For example, a generic build step can be defined once:
+
+	StepTemplate{Step: Step{
+		ExpectedCommand: []string{"go", "build", "-o", "{output}"},
+		SupplyChainItem: SupplyChainItem{
+			ExpectedProducts: [][]string{{"CREATE", "{prefix}/{output}"}},
+		},
+		PubKeys:   []string{builderKeyID},
+		Threshold: 1,
+	}}
+
+and expanded into concrete steps for each product of a layout.
+*/
+type StepTemplate struct {
+	Step
+}
+
+// unresolvedParameterRegexp matches a substitution marker, i.e. any
+// parameter name as accepted by SubstituteParameters wrapped in braces.
+var unresolvedParameterRegexp = regexp.MustCompile(`{[a-zA-Z0-9_-]+}`)
+
+// findUnresolvedParameter returns the first substitution marker found in
+// the passed slice or an empty string, if there is none.
+func findUnresolvedParameter(slice []string) string {
+	for _, item := range slice {
+		if marker := unresolvedParameterRegexp.FindString(item); marker != "" {
+			return marker
+		}
+	}
+	return ""
+}
+
+/*
+Expand creates a concrete Step with the passed name from the template on which
+it was called, substituting the passed parameters in the expected command and
+the expected materials and products.  The template itself is not modified.  It
+returns an error if a parameter name has an invalid format, if a substitution
+marker remains unresolved after substitution, or if the resulting step is not
+valid.
+*/
+func (t StepTemplate) Expand(name string, parameters map[string]string) (Step, error) {
+	replacer, err := newParameterReplacer(parameters)
+	if err != nil {
+		return Step{}, err
+	}
+
+	step := Step{
+		Type:                   "step",
+		PubKeys:                append([]string{}, t.PubKeys...),
+		CertificateConstraints: append([]CertificateConstraint{}, t.CertificateConstraints...),
+		ExpectedCommand:        substituteParamatersInSlice(replacer, t.ExpectedCommand),
+		Threshold:              t.Threshold,
+		Role:                   t.Role,
+		SupplyChainItem: SupplyChainItem{
+			Name:              name,
+			ExpectedMaterials: substituteParametersInSliceOfSlices(replacer, t.ExpectedMaterials),
+			ExpectedProducts:  substituteParametersInSliceOfSlices(replacer, t.ExpectedProducts),
+		},
+	}
+
+	if marker := findUnresolvedParameter(step.ExpectedCommand); marker != "" {
+		return Step{}, fmt.Errorf("%w %s in expected command of step '%s'",
+			ErrUnresolvedTemplateParameter, marker, name)
+	}
+	for _, rules := range [][][]string{step.ExpectedMaterials, step.ExpectedProducts} {
+		for _, rule := range rules {
+			if marker := findUnresolvedParameter(rule); marker != "" {
+				return Step{}, fmt.Errorf("%w %s in rule %s of step '%s'",
+					ErrUnresolvedTemplateParameter, marker, rule, name)
+			}
+		}
+	}
+
+	if err := validateStep(step); err != nil {
+		return Step{}, err
+	}
+
+	return step, nil
+}
+
+/*
+AddStepFromTemplate expands the passed template using the passed name and
+parameters and appends the resulting step to the layout on which it was
+called.  It returns an error if expansion fails or if the layout already has a
+step or inspection with the same name.
+*/
+func (l *Layout) AddStepFromTemplate(t StepTemplate, name string, parameters map[string]string) error {
+	for _, step := range l.Steps {
+		if step.Name == name {
+			return fmt.Errorf("non unique step or inspection name found: %s", name)
+		}
+	}
+	for _, inspection := range l.Inspect {
+		if inspection.Name == name {
+			return fmt.Errorf("non unique step or inspection name found: %s", name)
+		}
+	}
+
+	step, err := t.Expand(name, parameters)
+	if err != nil {
+		return err
+	}
+
+	l.Steps = append(l.Steps, step)
+	return nil
+}
@@ -0,0 +1,79 @@
+package in_toto
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestStepTemplateExpand(t *testing.T) {
+	template := StepTemplate{Step: Step{
+		PubKeys:         []string{"70ca5750c2eda80b18f41f4ec5f92146789b5d68dd09577be422a0159bd13680"},
+		ExpectedCommand: []string{"go", "build", "-o", "{output}"},
+		Threshold:       1,
+		Role:            "builders",
+		SupplyChainItem: SupplyChainItem{
+			ExpectedMaterials: [][]string{{"MATCH", "{prefix}/*", "WITH", "PRODUCTS", "FROM", "clone"}},
+			ExpectedProducts:  [][]string{{"CREATE", "{output}"}, {"DISALLOW", "*"}},
+		},
+	}}
+
+	step, err := template.Expand("build-foo", map[string]string{"output": "foo", "prefix": "src"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := Step{
+		Type:                   "step",
+		PubKeys:                []string{"70ca5750c2eda80b18f41f4ec5f92146789b5d68dd09577be422a0159bd13680"},
+		CertificateConstraints: []CertificateConstraint{},
+		ExpectedCommand:        []string{"go", "build", "-o", "foo"},
+		Threshold:              1,
+		Role:                   "builders",
+		SupplyChainItem: SupplyChainItem{
+			Name:              "build-foo",
+			ExpectedMaterials: [][]string{{"MATCH", "src/*", "WITH", "PRODUCTS", "FROM", "clone"}},
+			ExpectedProducts:  [][]string{{"CREATE", "foo"}, {"DISALLOW", "*"}},
+		},
+	}
+	if !reflect.DeepEqual(step, expected) {
+		t.Errorf("Expand returned %#v, expected %#v", step, expected)
+	}
+
+	// The template itself must remain unchanged
+	if template.ExpectedCommand[3] != "{output}" {
+		t.Errorf("Expand modified the template: %s", template.ExpectedCommand)
+	}
+
+	if _, err := template.Expand("build-bar", map[string]string{"output": "bar"}); !errors.Is(err, ErrUnresolvedTemplateParameter) {
+		t.Errorf("expected ErrUnresolvedTemplateParameter, got: %v", err)
+	}
+
+	if _, err := template.Expand("build-baz", map[string]string{"output": "baz", "inv@lid": "x"}); err == nil {
+		t.Error("expected error for invalid parameter name")
+	}
+}
+
+func TestLayoutAddStepFromTemplate(t *testing.T) {
+	template := StepTemplate{Step: Step{
+		ExpectedCommand: []string{"make", "{target}"},
+		Threshold:       1,
+		SupplyChainItem: SupplyChainItem{
+			ExpectedProducts: [][]string{{"CREATE", "{target}"}},
+		},
+	}}
+
+	layout := Layout{Type: "layout"}
+	for _, target := range []string{"foo", "bar"} {
+		if err := layout.AddStepFromTemplate(template, "build-"+target, map[string]string{"target": target}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if len(layout.Steps) != 2 || layout.Steps[1].ExpectedCommand[1] != "bar" {
+		t.Errorf("unexpected layout steps: %#v", layout.Steps)
+	}
+
+	if err := layout.AddStepFromTemplate(template, "build-foo", map[string]string{"target": "foo"}); err == nil {
+		t.Error("expected error for duplicate step name")
+	}
+}
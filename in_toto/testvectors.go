@@ -0,0 +1,419 @@
+package in_toto
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+/*
+DeterministicReader is an io.Reader that yields a pseudo-random byte stream
+derived from a seed, i.e. SHA-256 of the seed and a block counter.  The same
+seed always yields the same stream, hence it can replace crypto/rand.Reader to
+generate reproducible test fixtures, e.g. ed25519 keys.  It is safe for
+concurrent use, but the order in which concurrent readers obtain bytes is not
+deterministic.  It must never be used to generate production keys.
+*/
+type DeterministicReader struct {
+	mu      sync.Mutex
+	seed    []byte
+	counter uint64
+	buf     []byte
+}
+
+// NewDeterministicReader returns a DeterministicReader for the passed seed.
+func NewDeterministicReader(seed []byte) *DeterministicReader {
+	return &DeterministicReader{seed: append([]byte{}, seed...)}
+}
+
+// Read fills p with the next bytes of the stream.  It never fails.
+func (r *DeterministicReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := 0
+	for n < len(p) {
+		if len(r.buf) == 0 {
+			var counter [8]byte
+			binary.BigEndian.PutUint64(counter[:], r.counter)
+			r.counter++
+			block := sha256.Sum256(append(append([]byte{}, r.seed...), counter[:]...))
+			r.buf = block[:]
+		}
+		take := len(p) - n
+		if take > len(r.buf) {
+			take = len(r.buf)
+		}
+		// Not copy, the in_toto tests shadow the builtin
+		for i := 0; i < take; i++ {
+			p[n+i] = r.buf[i]
+		}
+		r.buf = r.buf[take:]
+		n += take
+	}
+	return n, nil
+}
+
+// testVectorExpires is the expiration date of the layouts of test vectors,
+// which is fixed, so that the layouts are reproducible, but lies far ahead.
+var testVectorExpires = time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// testVectorExpired is the expiration date of the expired layout test vector.
+var testVectorExpired = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// TestVectorsManifest is the name of the file, which describes the test
+// vectors written by GenerateTestVectors.
+const TestVectorsManifest = "vectors.json"
+
+/*
+TestVector is a demo supply chain written by GenerateTestVectors.  Layout is
+the path of the signed root layout, LinkDir the directory of its links and
+LayoutKeys the paths of the public keys the layout is signed with, all
+relative to the output directory.  Err is nil, if the supply chain passes
+verification, e.g. with Verify, or the sentinel error the verification error
+matches with errors.Is.  ExpectedError is the message of Err, as recorded in
+the manifest of the test vectors.
+*/
+type TestVector struct {
+	Name          string   `json:"name"`
+	Description   string   `json:"description"`
+	Layout        string   `json:"layout"`
+	LinkDir       string   `json:"link_dir"`
+	LayoutKeys    []string `json:"layout_keys"`
+	ExpectedError string   `json:"expected_error,omitempty"`
+	Err           error    `json:"-"`
+}
+
+/*
+TestVectors describes the test vectors written by GenerateTestVectors.  Seed is
+the hex encoded seed the test vectors were generated from.
+*/
+type TestVectors struct {
+	Seed    string       `json:"seed"`
+	Vectors []TestVector `json:"vectors"`
+}
+
+// testVectorChain holds the keys and metadata of the demo supply chain of the
+// test vectors.
+type testVectorChain struct {
+	owner, alice, bob, mallory Key
+	layout                     Layout
+	writeCode, pkg             Link
+}
+
+/*
+GenerateTestVectors writes reproducible demo supply chains to the passed
+directory, so that downstream projects can use them as fixtures for their own
+verification tests.  All keys and artifact digests are derived from the passed
+seed, see DeterministicReader, and the same seed always yields byte for byte
+the same files.  The directory contains:
+
+  - keys/, the ed25519 keys of the layout owner, the functionaries alice and
+    bob, and the unauthorized mallory, as PKCS8 and PKIX PEM files, e.g.
+    'alice' and 'alice.pub',
+  - a directory per test vector, with a root layout and links of the two step
+    supply chain 'write-code' by alice and 'package' by bob, which is valid, or
+    tampered with, e.g. with a modified artifact or an expired layout,
+  - the TestVectorsManifest, a JSON encoded TestVectors, which lists the test
+    vectors with their expected verification result.
+
+Layouts are valid until 2100, hence the valid test vector passes verification
+until then.
+*/
+func GenerateTestVectors(dir string, seed []byte) (*TestVectors, error) {
+	rand := NewDeterministicReader(seed)
+	keyDir := filepath.Join(dir, "keys")
+	if err := os.MkdirAll(keyDir, 0755); err != nil {
+		return nil, err
+	}
+
+	var chain testVectorChain
+	for _, k := range []struct {
+		name string
+		key  *Key
+	}{
+		{"owner", &chain.owner}, {"alice", &chain.alice}, {"bob", &chain.bob}, {"mallory", &chain.mallory},
+	} {
+		key, err := writeTestVectorKey(keyDir, k.name, rand)
+		if err != nil {
+			return nil, err
+		}
+		*k.key = key
+	}
+
+	source := make([]byte, 32)
+	archive := make([]byte, 32)
+	if _, err := rand.Read(source); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(archive); err != nil {
+		return nil, err
+	}
+	sourceDigest := HashObj{"sha256": fmt.Sprintf("%x", sha256.Sum256(source))}
+	archiveDigest := HashObj{"sha256": fmt.Sprintf("%x", sha256.Sum256(archive))}
+
+	chain.layout = testVectorLayout(chain.alice, chain.bob)
+	chain.writeCode = Link{
+		Type:        "link",
+		Name:        "write-code",
+		Materials:   map[string]HashObj{},
+		Products:    map[string]HashObj{"foo.py": sourceDigest},
+		ByProducts:  map[string]interface{}{},
+		Command:     []string{"vi", "foo.py"},
+		Environment: map[string]interface{}{},
+	}
+	chain.pkg = Link{
+		Type:        "link",
+		Name:        "package",
+		Materials:   map[string]HashObj{"foo.py": sourceDigest},
+		Products:    map[string]HashObj{"foo.tar.gz": archiveDigest},
+		ByProducts:  map[string]interface{}{},
+		Command:     []string{"tar", "zcvf", "foo.tar.gz", "foo.py"},
+		Environment: map[string]interface{}{},
+	}
+
+	vectors := &TestVectors{Seed: hex.EncodeToString(seed)}
+	for _, v := range testVectorCases {
+		vector, err := writeTestVector(dir, chain, v.name, v.description, v.err, v.tamper)
+		if err != nil {
+			return nil, fmt.Errorf("test vector '%s': %w", v.name, err)
+		}
+		vectors.Vectors = append(vectors.Vectors, vector)
+	}
+
+	manifest, err := json.MarshalIndent(vectors, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeMetadataFile(filepath.Join(dir, TestVectorsManifest), manifest, 0644); err != nil {
+		return nil, err
+	}
+	return vectors, nil
+}
+
+// testVectorCases are the test vectors written by GenerateTestVectors.  Each
+// case tampers with a copy of the valid demo supply chain.
+var testVectorCases = []struct {
+	name        string
+	description string
+	err         error
+	tamper      func(c *testVectorChain, layoutMb, writeCodeMb, pkgMb *Metablock) error
+}{
+	{
+		name:        "valid",
+		description: "supply chain carried out as defined in the layout",
+	},
+	{
+		name:        "tampered-artifact",
+		description: "bob packaged a foo.py other than the one alice wrote",
+		err:         ErrRuleViolation,
+		tamper: func(c *testVectorChain, layoutMb, writeCodeMb, pkgMb *Metablock) error {
+			link := c.pkg
+			link.Materials = map[string]HashObj{"foo.py": {"sha256": fmt.Sprintf("%x", sha256.Sum256(nil))}}
+			*pkgMb = Metablock{Signed: link}
+			return pkgMb.Sign(c.bob)
+		},
+	},
+	{
+		name:        "tampered-link",
+		description: "the link of the package step was modified after bob signed it",
+		err:         ErrThresholdNotMet,
+		tamper: func(c *testVectorChain, layoutMb, writeCodeMb, pkgMb *Metablock) error {
+			link := c.pkg
+			link.Command = []string{"tar", "zcvf", "foo.tar.gz", "foo.py", "backdoor.py"}
+			pkgMb.Signed = link
+			return nil
+		},
+	},
+	{
+		name:        "missing-link",
+		description: "there is no link for the package step",
+		err:         ErrThresholdNotMet,
+		tamper: func(c *testVectorChain, layoutMb, writeCodeMb, pkgMb *Metablock) error {
+			*pkgMb = Metablock{}
+			return nil
+		},
+	},
+	{
+		name:        "unauthorized-functionary",
+		description: "the package step was carried out by mallory, who is not authorized",
+		err:         ErrThresholdNotMet,
+		tamper: func(c *testVectorChain, layoutMb, writeCodeMb, pkgMb *Metablock) error {
+			*pkgMb = Metablock{Signed: c.pkg}
+			return pkgMb.Sign(c.mallory)
+		},
+	},
+	{
+		name:        "expired-layout",
+		description: "the layout expired",
+		err:         ErrLayoutExpired,
+		tamper: func(c *testVectorChain, layoutMb, writeCodeMb, pkgMb *Metablock) error {
+			layout := c.layout
+			layout.Expires = testVectorExpired.Format(ISO8601DateSchema)
+			*layoutMb = Metablock{Signed: layout}
+			return layoutMb.Sign(c.owner)
+		},
+	},
+	{
+		name:        "tampered-layout",
+		description: "the layout was modified after the owner signed it",
+		err:         ErrInvalidSignature,
+		tamper: func(c *testVectorChain, layoutMb, writeCodeMb, pkgMb *Metablock) error {
+			layout := c.layout
+			layout.Steps = append([]Step{}, layout.Steps...)
+			layout.Steps[1].PubKeys = append(layout.Steps[1].PubKeys, c.mallory.KeyID)
+			layout.Keys = map[string]Key{}
+			for keyID, key := range c.layout.Keys {
+				layout.Keys[keyID] = key
+			}
+			layout.Keys[c.mallory.KeyID] = publicTestVectorKey(c.mallory)
+			layoutMb.Signed = layout
+			return nil
+		},
+	},
+}
+
+// writeTestVector writes the root layout and links of the passed demo supply
+// chain, tampered with by the passed function, if any, to a subdirectory of
+// the passed directory named after the test vector.
+func writeTestVector(dir string, chain testVectorChain, name string, description string, expected error,
+	tamper func(c *testVectorChain, layoutMb, writeCodeMb, pkgMb *Metablock) error) (TestVector, error) {
+	layoutMb := &Metablock{Signed: chain.layout}
+	writeCodeMb := &Metablock{Signed: chain.writeCode}
+	pkgMb := &Metablock{Signed: chain.pkg}
+	for _, s := range []struct {
+		mb  *Metablock
+		key Key
+	}{{layoutMb, chain.owner}, {writeCodeMb, chain.alice}, {pkgMb, chain.bob}} {
+		if err := s.mb.Sign(s.key); err != nil {
+			return TestVector{}, err
+		}
+	}
+	if tamper != nil {
+		if err := tamper(&chain, layoutMb, writeCodeMb, pkgMb); err != nil {
+			return TestVector{}, err
+		}
+	}
+
+	vectorDir := filepath.Join(dir, name)
+	if err := os.MkdirAll(vectorDir, 0755); err != nil {
+		return TestVector{}, err
+	}
+	if err := layoutMb.Dump(filepath.Join(vectorDir, RootLayoutName)); err != nil {
+		return TestVector{}, err
+	}
+	for _, linkMb := range []*Metablock{writeCodeMb, pkgMb} {
+		if linkMb.Signed == nil {
+			continue
+		}
+		link := linkMb.Signed.(Link)
+		for _, sig := range linkMb.Signatures {
+			if err := linkMb.Dump(filepath.Join(vectorDir, fmt.Sprintf(LinkNameFormat, link.Name, sig.KeyID))); err != nil {
+				return TestVector{}, err
+			}
+		}
+	}
+
+	vector := TestVector{
+		Name:        name,
+		Description: description,
+		Layout:      filepath.ToSlash(filepath.Join(name, RootLayoutName)),
+		LinkDir:     name,
+		LayoutKeys:  []string{"keys/owner.pub"},
+		Err:         expected,
+	}
+	if expected != nil {
+		vector.ExpectedError = expected.Error()
+	}
+	return vector, nil
+}
+
+// testVectorLayout returns the layout of the demo supply chain, in which alice
+// writes foo.py and bob packages it into foo.tar.gz.
+func testVectorLayout(alice, bob Key) Layout {
+	return Layout{
+		Type:    "layout",
+		Expires: testVectorExpires.Format(ISO8601DateSchema),
+		Readme:  "demo supply chain of the in-toto test vectors",
+		Keys: map[string]Key{
+			alice.KeyID: publicTestVectorKey(alice),
+			bob.KeyID:   publicTestVectorKey(bob),
+		},
+		Steps: []Step{
+			{
+				Type:            "step",
+				PubKeys:         []string{alice.KeyID},
+				ExpectedCommand: []string{"vi", "foo.py"},
+				Threshold:       1,
+				SupplyChainItem: SupplyChainItem{
+					Name:              "write-code",
+					ExpectedMaterials: [][]string{{"DISALLOW", "*"}},
+					ExpectedProducts:  [][]string{{"CREATE", "foo.py"}, {"DISALLOW", "*"}},
+				},
+			},
+			{
+				Type:            "step",
+				PubKeys:         []string{bob.KeyID},
+				ExpectedCommand: []string{"tar", "zcvf", "foo.tar.gz", "foo.py"},
+				Threshold:       1,
+				SupplyChainItem: SupplyChainItem{
+					Name: "package",
+					ExpectedMaterials: [][]string{
+						{"MATCH", "foo.py", "WITH", "PRODUCTS", "FROM", "write-code"},
+						{"DISALLOW", "*"},
+					},
+					ExpectedProducts: [][]string{{"CREATE", "foo.tar.gz"}, {"DISALLOW", "*"}},
+				},
+			},
+		},
+		Inspect: []Inspection{},
+	}
+}
+
+// publicTestVectorKey returns the passed key without its private part.
+func publicTestVectorKey(key Key) Key {
+	key.KeyVal.Private = ""
+	return key
+}
+
+// writeTestVectorKey generates an ed25519 key from the passed reader, writes
+// its private and public part to the passed directory and returns the key.
+func writeTestVectorKey(dir string, name string, rand *DeterministicReader) (Key, error) {
+	_, privateKey, err := ed25519.GenerateKey(rand)
+	if err != nil {
+		return Key{}, err
+	}
+	privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return Key{}, err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(privateKey.Public())
+	if err != nil {
+		return Key{}, err
+	}
+	privatePEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER})
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: pemPublicKey, Bytes: publicDER})
+
+	if err := os.WriteFile(filepath.Join(dir, name), privatePEM, 0600); err != nil {
+		return Key{}, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".pub"), publicPEM, 0644); err != nil {
+		return Key{}, err
+	}
+
+	var key Key
+	if err := key.LoadKeyReaderDefaults(bytes.NewReader(privatePEM)); err != nil {
+		return Key{}, err
+	}
+	return key, nil
+}
@@ -0,0 +1,132 @@
+package in_toto
+
+import (
+	"crypto/sha256"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeterministicReader(t *testing.T) {
+	buf := make([]byte, 40)
+	n, err := NewDeterministicReader([]byte("seed")).Read(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, 40, n)
+	first := sha256.Sum256(append([]byte("seed"), 0, 0, 0, 0, 0, 0, 0, 0))
+	second := sha256.Sum256(append([]byte("seed"), 0, 0, 0, 0, 0, 0, 0, 1))
+	assert.Equal(t, first[:], buf[:32])
+	assert.Equal(t, second[:8], buf[32:])
+
+	// Reads in pieces yield the same stream
+	r := NewDeterministicReader([]byte("seed"))
+	pieces := make([]byte, 0, 40)
+	for _, size := range []int{3, 29, 8} {
+		piece := make([]byte, size)
+		_, _ = r.Read(piece)
+		pieces = append(pieces, piece...)
+	}
+	assert.Equal(t, buf, pieces)
+
+	// Concurrent reads consume the stream without overlap
+	r = NewDeterministicReader([]byte("seed"))
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			piece := make([]byte, 100)
+			_, _ = r.Read(piece)
+		}()
+	}
+	wg.Wait()
+	rest := make([]byte, 32)
+	_, _ = r.Read(rest)
+	expected := sha256.Sum256(append([]byte("seed"), 0, 0, 0, 0, 0, 0, 0, 25))
+	assert.Equal(t, expected[:], rest)
+}
+
+// readTree returns the contents of all files in the passed directory by
+// relative path.
+func readTree(t *testing.T, dir string) map[string]string {
+	files := map[string]string{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		files[rel] = string(data)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestGenerateTestVectors(t *testing.T) {
+	dir := t.TempDir()
+	vectors, err := GenerateTestVectors(dir, []byte("in-toto"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "696e2d746f746f", vectors.Seed)
+	assert.Len(t, vectors.Vectors, len(testVectorCases))
+
+	for _, vector := range vectors.Vectors {
+		layoutEnv, err := LoadMetadata(filepath.Join(dir, vector.Layout))
+		if err != nil {
+			t.Fatal(err)
+		}
+		layoutKeys := map[string]Key{}
+		for _, path := range vector.LayoutKeys {
+			var key Key
+			if err := key.LoadKeyDefaults(filepath.Join(dir, path)); err != nil {
+				t.Fatal(err)
+			}
+			layoutKeys[key.KeyID] = key
+		}
+
+		_, err = Verify(layoutEnv, layoutKeys, filepath.Join(dir, vector.LinkDir))
+		if vector.Err == nil {
+			assert.Nil(t, err, vector.Name)
+			assert.Empty(t, vector.ExpectedError, vector.Name)
+		} else {
+			assert.ErrorIs(t, err, vector.Err, vector.Name)
+			assert.Equal(t, vector.Err.Error(), vector.ExpectedError, vector.Name)
+		}
+	}
+
+	// The same seed yields the same files, another seed other keys
+	files := readTree(t, dir)
+	assert.Contains(t, files, TestVectorsManifest)
+	assert.Contains(t, files, filepath.Join("keys", "owner.pub"))
+
+	otherDir := t.TempDir()
+	if _, err := GenerateTestVectors(otherDir, []byte("in-toto")); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, files, readTree(t, otherDir))
+
+	otherDir = t.TempDir()
+	if _, err := GenerateTestVectors(otherDir, []byte("other")); err != nil {
+		t.Fatal(err)
+	}
+	otherFiles := readTree(t, otherDir)
+	assert.NotEqual(t, files[filepath.Join("keys", "owner")], otherFiles[filepath.Join("keys", "owner")])
+
+	// Writing fails on an unwritable destination
+	notADir := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(notADir, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = GenerateTestVectors(notADir, nil)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,195 @@
+package in_toto
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// ErrThresholdNotMet is returned, wrapped in a ThresholdError, if a step of a
+// layout lacks enough links from distinct authorized functionaries.
+var ErrThresholdNotMet = errors.New("step threshold not met")
+
+// ErrNoLinks is returned if no link metadata is found for a step or
+// inspection.
+var ErrNoLinks = errors.New("no links found")
+
+// ErrLinkArtifactMismatch is returned if links of distinct functionaries for
+// the same step record different artifacts.
+var ErrLinkArtifactMismatch = errors.New("links have different artifacts")
+
+/*
+ThresholdError reports the step of a layout that failed its threshold, i.e.
+for which fewer than Threshold links of distinct authorized functionaries were
+found or had a valid signature.  Use errors.As to inspect it, or errors.Is
+with ErrThresholdNotMet to detect it.
+*/
+type ThresholdError struct {
+	// StepName is the name of the step that failed its threshold
+	StepName string
+	// Threshold is the number of links the step requires
+	Threshold int
+	// Available is the number of links found for the step
+	Available int
+	// Verified is the number of available links that were not rejected, e.g.
+	// due to an invalid signature
+	Verified int
+	// Err is the reason why links did not pass verification, if any
+	Err error
+}
+
+func (e *ThresholdError) Error() string {
+	msg := fmt.Sprintf("step '%s' requires '%d' link metadata file(s), found '%d'",
+		e.StepName, e.Threshold, e.Available)
+	if e.Verified < e.Available {
+		msg += fmt.Sprintf(", '%d' with a valid signature from an authorized signer", e.Verified)
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Is reports whether the target is ErrThresholdNotMet.
+func (e *ThresholdError) Is(target error) bool {
+	return target == ErrThresholdNotMet
+}
+
+// Unwrap returns the reason why links did not pass verification.
+func (e *ThresholdError) Unwrap() error {
+	return e.Err
+}
+
+// ErrMissingEvidence is returned, wrapped in a MissingEvidenceError, if steps
+// of a layout lack link metadata before any rule is evaluated.
+var ErrMissingEvidence = errors.New("missing evidence")
+
+/*
+MissingEvidenceError aggregates the steps of a layout, for which fewer link
+metadata files than required by the step threshold were found, so that
+producers learn about all evidence they still need to collect at once.  Use
+errors.Is with ErrMissingEvidence to detect it, errors.As to inspect it, or
+errors.As with a ThresholdError to obtain the first step.
+*/
+type MissingEvidenceError struct {
+	Steps []*ThresholdError
+}
+
+func (e *MissingEvidenceError) Error() string {
+	msgs := make([]string, 0, len(e.Steps))
+	for _, step := range e.Steps {
+		msgs = append(msgs, step.Error())
+	}
+	return fmt.Sprintf("%s for %d step(s): %s", ErrMissingEvidence, len(e.Steps),
+		strings.Join(msgs, "; "))
+}
+
+// Is reports whether the target is ErrMissingEvidence.
+func (e *MissingEvidenceError) Is(target error) bool {
+	return target == ErrMissingEvidence
+}
+
+// Unwrap returns the ThresholdErrors of the steps that lack evidence.
+func (e *MissingEvidenceError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Steps))
+	for _, step := range e.Steps {
+		errs = append(errs, step)
+	}
+	return errs
+}
+
+/*
+artifactsEqual reports whether the passed artifacts, recorded by different
+functionaries for the same step, are equal after normalization: artifact names
+are compared as clean slash-separated paths, and digests are compared case
+insensitively on the hash algorithms recorded in both, of which there must be
+at least one, unless both artifacts have no digests, like empty directories.
+Missing and empty artifact maps are equal.
+*/
+func artifactsEqual(a map[string]HashObj, b map[string]HashObj) bool {
+	normalizedA, okA := normalizeArtifacts(a)
+	normalizedB, okB := normalizeArtifacts(b)
+	if !okA || !okB || len(normalizedA) != len(normalizedB) {
+		return false
+	}
+	for name, hashesA := range normalizedA {
+		hashesB, ok := normalizedB[name]
+		if !ok {
+			return false
+		}
+		if len(hashesA) == 0 || len(hashesB) == 0 {
+			if len(hashesA) != len(hashesB) {
+				return false
+			}
+			continue
+		}
+		common := 0
+		for algorithm, digestA := range hashesA {
+			digestB, ok := hashesB[algorithm]
+			if !ok {
+				continue
+			}
+			if !digestStringsEqual(digestA, digestB) {
+				return false
+			}
+			common++
+		}
+		if common == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeArtifacts returns the passed artifacts by normalized name, see
+// normalizeArtifactName, and false if two names are equal after
+// normalization.  Artifacts whose names are all normalized already, as
+// recorded by RecordArtifacts, are returned as is, without allocation.
+func normalizeArtifacts(artifacts map[string]HashObj) (map[string]HashObj, bool) {
+	normalized := true
+	for name := range artifacts {
+		if normalizeArtifactName(name) != name {
+			normalized = false
+			break
+		}
+	}
+	if normalized {
+		return artifacts, true
+	}
+
+	renamed := make(map[string]HashObj, len(artifacts))
+	for name, hashes := range artifacts {
+		name = normalizeArtifactName(name)
+		if _, exists := renamed[name]; exists {
+			return nil, false
+		}
+		renamed[name] = hashes
+	}
+	return renamed, true
+}
+
+// normalizeArtifactName returns the passed artifact name as clean path, keeping the trailing slash of directory artifacts.
+func normalizeArtifactName(name string) string {
+	cleaned := path.Clean(name)
+	if strings.HasSuffix(name, "/") && cleaned != "/" {
+		// Avoid allocating the normalized name of clean directory artifacts
+		if len(name) == len(cleaned)+1 && strings.HasPrefix(name, cleaned) {
+			return name
+		}
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// sortedKeyIDs returns the key ids of the passed links in lexical order, so
+// that links are compared and selected deterministically.
+func sortedKeyIDs(linksPerStep map[string]Metadata) []string {
+	keyIDs := make([]string, 0, len(linksPerStep))
+	for keyID := range linksPerStep {
+		keyIDs = append(keyIDs, keyID)
+	}
+	sort.Strings(keyIDs)
+	return keyIDs
+}
@@ -0,0 +1,46 @@
+package in_toto
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArtifactsEqual(t *testing.T) {
+	tests := []struct {
+		name  string
+		a, b  map[string]HashObj
+		equal bool
+	}{
+		{"nil and empty", nil, map[string]HashObj{}, true},
+		{"unclean names", map[string]HashObj{"./src/foo": {"sha256": "abc"}}, map[string]HashObj{"src//foo": {"sha256": "abc"}}, true},
+		{"digest case", map[string]HashObj{"foo": {"sha256": "ABC"}}, map[string]HashObj{"foo": {"sha256": "abc"}}, true},
+		{"common algorithm", map[string]HashObj{"foo": {"sha256": "abc", "sha512": "def"}}, map[string]HashObj{"foo": {"sha256": "abc"}}, true},
+		{"empty dirs", map[string]HashObj{"logs/": {}}, map[string]HashObj{"./logs/": {}}, true},
+		{"different digest", map[string]HashObj{"foo": {"sha256": "abc", "sha512": "def"}}, map[string]HashObj{"foo": {"sha256": "abc", "sha512": "123"}}, false},
+		{"no common algorithm", map[string]HashObj{"foo": {"sha256": "abc"}}, map[string]HashObj{"foo": {"sha512": "abc"}}, false},
+		{"missing digests", map[string]HashObj{"foo": {"sha256": "abc"}}, map[string]HashObj{"foo": {}}, false},
+		{"dir and file", map[string]HashObj{"foo/": {}}, map[string]HashObj{"foo": {}}, false},
+		{"different names", map[string]HashObj{"foo": {"sha256": "abc"}}, map[string]HashObj{"bar": {"sha256": "abc"}}, false},
+		{"ambiguous names", map[string]HashObj{"foo": {"sha256": "abc"}, "./foo": {"sha256": "abc"}}, map[string]HashObj{"foo": {"sha256": "abc"}, "bar": {"sha256": "abc"}}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.equal, artifactsEqual(test.a, test.b))
+			assert.Equal(t, test.equal, artifactsEqual(test.b, test.a))
+		})
+	}
+}
+
+func TestThresholdError(t *testing.T) {
+	reason := errors.New("invalid signature")
+	var err error = &ThresholdError{StepName: "build", Threshold: 2, Available: 2, Verified: 1, Err: reason}
+	assert.ErrorIs(t, err, ErrThresholdNotMet)
+	assert.ErrorIs(t, err, reason)
+	assert.Equal(t, "step 'build' requires '2' link metadata file(s), found '2', '1' with a valid"+
+		" signature from an authorized signer: invalid signature", err.Error())
+
+	err = &ThresholdError{StepName: "build", Threshold: 2, Available: 1, Verified: 1}
+	assert.Equal(t, "step 'build' requires '2' link metadata file(s), found '1'", err.Error())
+}
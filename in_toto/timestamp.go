@@ -0,0 +1,273 @@
+package in_toto
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNoTimestamp is returned when a signature carries no timestamp that can
+// be verified by any of the passed timestamp verifiers.
+var ErrNoTimestamp = errors.New("no verifiable timestamp found")
+
+// ErrTimestampInFuture is returned when a timestamp attests a time after the
+// verification time, beyond the tolerated clock skew.
+var ErrTimestampInFuture = errors.New("timestamp attests a time in the future")
+
+// ErrTimestampAfterExpiry is returned by verification, if a link signature is
+// timestamped after the expiration of the layout, see WithTimestampVerifiers.
+var ErrTimestampAfterExpiry = errors.New("link timestamped after layout expiration")
+
+/*
+Timestamp is evidence, issued by a time-stamping service, that a signature
+existed at a certain point in time.  Type identifies the time-stamping
+mechanism, e.g. "roughtime", and Data holds the mechanism specific, base64
+encoded evidence.
+*/
+type Timestamp struct {
+	Type string `json:"type"`
+	Data string `json:"data"`
+}
+
+/*
+Timestamper obtains timestamp evidence over the passed signature bytes from a
+time-stamping service.
+*/
+type Timestamper interface {
+	Timestamp(signature []byte) (Timestamp, error)
+}
+
+/*
+TimestampVerifier verifies timestamp evidence of type Type over the passed
+signature bytes and returns the attested time.
+*/
+type TimestampVerifier interface {
+	Type() string
+	VerifyTimestamp(ts Timestamp, signature []byte) (time.Time, error)
+}
+
+/*
+SignedTimestampVerifier is a TimestampVerifier, whose timestamp evidence also
+records the data a signature is over and the public key of the signer, e.g.
+RekorVerifier.  VerifySignedTimestamp verifies the passed timestamp like
+VerifyTimestamp, and that it records the passed signed data and, if not nil,
+the passed signer public key.  Timestamps of link signatures are verified with
+it during verification, see WithTimestampVerifiers.
+*/
+type SignedTimestampVerifier interface {
+	TimestampVerifier
+	VerifySignedTimestamp(ts Timestamp, signature []byte, signed []byte, signer crypto.PublicKey) (time.Time, error)
+}
+
+/*
+AddTimestamp obtains a timestamp from the passed Timestamper over the signature
+with the passed key ID and attaches it to that signature of the Metablock on
+which it was called.  Timestamps are not part of the signed portion of the
+metadata, hence they can be added after signing without invalidating any
+signature.
+*/
+func (mb *Metablock) AddTimestamp(keyID string, timestamper Timestamper) error {
+	for i, sig := range mb.Signatures {
+		if sig.KeyID != keyID {
+			continue
+		}
+
+		sigBytes, err := decodeHexSignature(sig.Sig)
+		if err != nil {
+			return err
+		}
+
+		ts, err := timestamper.Timestamp(sigBytes)
+		if err != nil {
+			return err
+		}
+
+		mb.Signatures[i].Timestamps = append(mb.Signatures[i].Timestamps, ts)
+		return nil
+	}
+
+	return fmt.Errorf("%w for key '%s'", ErrSignatureNotFound, keyID)
+}
+
+/*
+VerifySignatureTimestamp verifies the timestamps attached to the passed
+signature using the passed verifiers and returns the time attested by the
+first timestamp that passes verification.  Timestamps of a type for which no
+verifier is passed are ignored.  If no timestamp can be verified an error
+wrapping ErrNoTimestamp is returned.
+*/
+func VerifySignatureTimestamp(sig Signature, verifiers ...TimestampVerifier) (time.Time, error) {
+	return verifySignatureTimestamp(sig, nil, nil, verifiers)
+}
+
+/*
+verifySignatureTimestamp implements VerifySignatureTimestamp.  If the passed
+signed data is not nil, SignedTimestampVerifiers also verify that timestamps
+record it and the passed signer public key, see SignedTimestampVerifier.
+*/
+func verifySignatureTimestamp(sig Signature, signed []byte, signer crypto.PublicKey,
+	verifiers []TimestampVerifier) (time.Time, error) {
+	sigBytes, err := decodeHexSignature(sig.Sig)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var lastErr error
+	for _, ts := range sig.Timestamps {
+		for _, verifier := range verifiers {
+			if verifier.Type() != ts.Type {
+				continue
+			}
+			var attested time.Time
+			if signedVerifier, ok := verifier.(SignedTimestampVerifier); ok && signed != nil {
+				attested, err = signedVerifier.VerifySignedTimestamp(ts, sigBytes, signed, signer)
+			} else {
+				attested, err = verifier.VerifyTimestamp(ts, sigBytes)
+			}
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			return attested, nil
+		}
+	}
+
+	if lastErr != nil {
+		return time.Time{}, fmt.Errorf("%w for signature of key '%s': %s", ErrNoTimestamp, sig.KeyID, lastErr)
+	}
+	return time.Time{}, fmt.Errorf("%w for signature of key '%s'", ErrNoTimestamp, sig.KeyID)
+}
+
+/*
+VerifyMetadataTimestamps verifies that every signature of the passed metadata
+carries a timestamp that passes verification with one of the passed
+verifiers.  It returns the attested time per key ID.  Timestamps are only
+supported for metadata in the legacy signature wrapper, because DSSE
+signatures cannot carry additional fields.  SignedTimestampVerifiers verify
+that timestamps record the signable part of the metadata, and the key of the
+certificate of the signature, if any.
+*/
+func VerifyMetadataTimestamps(metadata Metadata, verifiers ...TimestampVerifier) (map[string]time.Time, error) {
+	signed, err := timestampedData(metadata)
+	if err != nil {
+		return nil, err
+	}
+	attested := make(map[string]time.Time)
+	for _, sig := range metadata.Sigs() {
+		var signer crypto.PublicKey
+		if sig.Certificate != "" {
+			cert, err := sig.GetCertificate()
+			if err != nil {
+				return nil, err
+			}
+			if signer, err = cert.CryptoPublicKey(); err != nil {
+				return nil, err
+			}
+		}
+		t, err := verifySignatureTimestamp(sig, signed, signer, verifiers)
+		if err != nil {
+			return nil, err
+		}
+		attested[sig.KeyID] = t
+	}
+	return attested, nil
+}
+
+/*
+TimestampVerifyOptions configures VerifyMetadataTimestampsWithOptions.
+
+  - Now is the time timestamps are verified at.  If zero, the current time is
+    used.
+  - ClockSkew is the duration by which an attested time may lie after Now, to
+    tolerate clock differences between the time-stamping service and the
+    verifier.
+*/
+type TimestampVerifyOptions struct {
+	Now       time.Time
+	ClockSkew time.Duration
+}
+
+/*
+VerifyMetadataTimestampsWithOptions verifies the timestamps of the passed
+metadata like VerifyMetadataTimestamps, and additionally rejects timestamps
+that attest a time after the verification time, beyond the tolerated clock
+skew, with an ErrTimestampInFuture, see TimestampVerifyOptions.
+*/
+func VerifyMetadataTimestampsWithOptions(metadata Metadata, opts TimestampVerifyOptions,
+	verifiers ...TimestampVerifier) (map[string]time.Time, error) {
+	attested, err := VerifyMetadataTimestamps(metadata, verifiers...)
+	if err != nil {
+		return nil, err
+	}
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	for keyID, t := range attested {
+		if t.After(now.Add(opts.ClockSkew)) {
+			return nil, fmt.Errorf("%w for signature of key '%s': '%s'", ErrTimestampInFuture,
+				keyID, t.UTC().Format(ISO8601DateSchema))
+		}
+	}
+	return attested, nil
+}
+
+/*
+linkTimestamps requires the signatures of links to carry a timestamp during
+verification, see WithTimestampVerifiers.  Timestamps must pass verification
+with one of verifiers, and attest a time before the verification time now and
+before the layout expiration expires, tolerating clockSkew and, for the
+expiration, also expiryTolerance.
+*/
+type linkTimestamps struct {
+	verifiers       []TimestampVerifier
+	now             time.Time
+	expires         time.Time
+	expiryTolerance time.Duration
+	clockSkew       time.Duration
+}
+
+/*
+verify returns the time attested by a timestamp of the signature of the
+passed key ID of the passed link, see linkTimestamps.  The timestamp must
+record the signature of the passed signer key, if it is logged with its key,
+see SignedTimestampVerifier.
+*/
+func (l *linkTimestamps) verify(linkEnv Metadata, keyID string, signerKey Key) (time.Time, error) {
+	sig, err := linkEnv.GetSignatureForKeyID(keyID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	signed, err := timestampedData(linkEnv)
+	if err != nil {
+		return time.Time{}, err
+	}
+	// Signatures of keys without crypto public key, e.g. gpg keys, are only
+	// bound to the signed data
+	signer, _ := signerKey.CryptoPublicKey()
+	attested, err := verifySignatureTimestamp(sig, signed, signer, l.verifiers)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if attested.After(l.now.Add(l.clockSkew)) {
+		return time.Time{}, fmt.Errorf("%w for signature of key '%s': '%s'", ErrTimestampInFuture,
+			keyID, attested.UTC().Format(ISO8601DateSchema))
+	}
+	if attested.After(l.expires.Add(l.expiryTolerance + l.clockSkew)) {
+		return time.Time{}, fmt.Errorf("%w: signature of key '%s' timestamped at '%s', layout expired at '%s'",
+			ErrTimestampAfterExpiry, keyID, attested.UTC().Format(ISO8601DateSchema),
+			l.expires.UTC().Format(ISO8601DateSchema))
+	}
+	return attested, nil
+}
+
+// timestampedData returns the signable part of the passed metadata, which
+// timestamped signatures are over, or nil for metadata other than Metablocks.
+func timestampedData(metadata Metadata) ([]byte, error) {
+	mb, ok := metadata.(*Metablock)
+	if !ok {
+		return nil, nil
+	}
+	return mb.GetSignableRepresentation()
+}
@@ -0,0 +1,253 @@
+package in_toto
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeTimestamper issues timestamps that merely carry the signature bytes and
+// the configured time, fakeTimestampVerifier accepts exactly those.
+type fakeTimestamper struct {
+	at time.Time
+}
+
+func (f fakeTimestamper) Timestamp(signature []byte) (Timestamp, error) {
+	return Timestamp{
+		Type: "fake",
+		Data: base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%x", f.at.Unix(), signature))),
+	}, nil
+}
+
+type fakeTimestampVerifier struct{}
+
+func (fakeTimestampVerifier) Type() string {
+	return "fake"
+}
+
+func (fakeTimestampVerifier) VerifyTimestamp(ts Timestamp, signature []byte) (time.Time, error) {
+	data, err := base64.StdEncoding.DecodeString(ts.Data)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var unix int64
+	var sig string
+	if _, err := fmt.Sscanf(string(data), "%d:%s", &unix, &sig); err != nil {
+		return time.Time{}, err
+	}
+	if sig != fmt.Sprintf("%x", signature) {
+		return time.Time{}, errors.New("signature mismatch")
+	}
+	return time.Unix(unix, 0).UTC(), nil
+}
+
+func TestMetablockTimestamps(t *testing.T) {
+	var key Key
+	if err := key.LoadKey("carol", "ed25519", []string{"sha256", "sha512"}); err != nil {
+		t.Fatal(err)
+	}
+	mb := Metablock{Signed: Link{Type: "link", Name: "foo"}}
+	if err := mb.Sign(key); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without timestamps verification fails
+	_, err := VerifyMetadataTimestamps(&mb, fakeTimestampVerifier{})
+	assert.ErrorIs(t, err, ErrNoTimestamp)
+
+	at := time.Date(2021, 5, 4, 12, 0, 0, 0, time.UTC)
+	assert.Nil(t, mb.AddTimestamp(key.KeyID, fakeTimestamper{at: at}))
+	assert.NotNil(t, mb.AddTimestamp("unknown", fakeTimestamper{at: at}))
+
+	// Timestamps do not invalidate the signature
+	assert.Nil(t, mb.VerifySignature(key))
+
+	attested, err := VerifyMetadataTimestamps(&mb, fakeTimestampVerifier{})
+	assert.Nil(t, err)
+	assert.True(t, at.Equal(attested[key.KeyID]))
+
+	// Timestamps of a type without verifier are ignored
+	_, err = VerifyMetadataTimestamps(&mb, RoughtimeVerifier{})
+	assert.ErrorIs(t, err, ErrNoTimestamp)
+
+	// A timestamp over another signature must not verify
+	mb.Signatures[0].Timestamps[0], _ = fakeTimestamper{at: at}.Timestamp([]byte("other"))
+	_, err = VerifySignatureTimestamp(mb.Signatures[0], fakeTimestampVerifier{})
+	assert.ErrorIs(t, err, ErrNoTimestamp)
+}
+
+func TestVerifyMetadataTimestampsClockSkew(t *testing.T) {
+	var key Key
+	if err := key.LoadKey("carol", "ed25519", []string{"sha256", "sha512"}); err != nil {
+		t.Fatal(err)
+	}
+	mb := Metablock{Signed: Link{Type: "link", Name: "foo"}}
+	if err := mb.Sign(key); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2021, 5, 4, 12, 0, 0, 0, time.UTC)
+	assert.Nil(t, mb.AddTimestamp(key.KeyID, fakeTimestamper{at: now.Add(2 * time.Minute)}))
+
+	// A timestamp from the future is only accepted within the clock skew
+	_, err := VerifyMetadataTimestampsWithOptions(&mb, TimestampVerifyOptions{Now: now}, fakeTimestampVerifier{})
+	assert.ErrorIs(t, err, ErrTimestampInFuture)
+	attested, err := VerifyMetadataTimestampsWithOptions(&mb,
+		TimestampVerifyOptions{Now: now, ClockSkew: 5 * time.Minute}, fakeTimestampVerifier{})
+	assert.Nil(t, err)
+	assert.True(t, now.Add(2*time.Minute).Equal(attested[key.KeyID]))
+
+	_, err = VerifyMetadataTimestampsWithOptions(&mb, TimestampVerifyOptions{}, fakeTimestampVerifier{})
+	assert.Nil(t, err)
+}
+
+func TestVerifyWithTimestamps(t *testing.T) {
+	var layoutKey, key Key
+	if err := layoutKey.LoadKeyDefaults("alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := key.LoadKey("carol", "ed25519", []string{"sha256", "sha512"}); err != nil {
+		t.Fatal(err)
+	}
+	pubKey := key
+	pubKey.KeyVal.Private = ""
+	layoutKeys := map[string]Key{layoutKey.KeyID: layoutKey}
+	now := time.Now()
+
+	command := []string{"sh", "-c", "true"}
+	layout := Layout{
+		Type:    "layout",
+		Expires: now.Add(time.Hour).UTC().Format(ISO8601DateSchema),
+		Keys:    map[string]Key{pubKey.KeyID: pubKey},
+		Steps: []Step{{
+			SupplyChainItem: SupplyChainItem{Name: "build"},
+			PubKeys:         []string{pubKey.KeyID},
+			ExpectedCommand: command,
+			Threshold:       1,
+		}},
+		Inspect: []Inspection{},
+	}
+	layoutMb := &Metablock{Signed: layout}
+	if err := layoutMb.Sign(layoutKey); err != nil {
+		t.Fatal(err)
+	}
+
+	// Timestamps require links in the legacy signature wrapper
+	_, err := Run("build", command, key, WithTimestamper(fakeTimestamper{at: now}))
+	assert.ErrorIs(t, err, ErrTimestampRequiresMetablock)
+
+	run := func(opts ...RunOption) string {
+		linkDir := t.TempDir()
+		linkEnv, err := Run("build", command, key, append(opts, WithMetablock())...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := linkEnv.Dump(filepath.Join(linkDir, fmt.Sprintf(LinkNameFormat, "build", key.KeyID))); err != nil {
+			t.Fatal(err)
+		}
+		return linkDir
+	}
+
+	linkDir := run(WithTimestamper(fakeTimestamper{at: now}))
+	_, err = Verify(layoutMb, layoutKeys, linkDir, WithTimestampVerifiers(fakeTimestampVerifier{}))
+	assert.Nil(t, err)
+
+	// Links without timestamp do not count, if timestamps are required
+	linkDir = run()
+	_, err = Verify(layoutMb, layoutKeys, linkDir)
+	assert.Nil(t, err)
+	_, err = Verify(layoutMb, layoutKeys, linkDir, WithTimestampVerifiers(fakeTimestampVerifier{}))
+	assert.ErrorIs(t, err, ErrThresholdNotMet)
+	assert.ErrorIs(t, err, ErrNoTimestamp)
+
+	// Links timestamped after the layout expired, or in the future, do not
+	// count either
+	linkDir = run(WithTimestamper(fakeTimestamper{at: now.Add(150 * time.Minute)}))
+	_, err = Verify(layoutMb, layoutKeys, linkDir, WithTimestampVerifiers(fakeTimestampVerifier{}),
+		WithVerificationTime(now.Add(110*time.Minute)), WithClockSkewTolerance(time.Hour))
+	assert.ErrorIs(t, err, ErrTimestampAfterExpiry)
+	_, err = Verify(layoutMb, layoutKeys, linkDir, WithTimestampVerifiers(fakeTimestampVerifier{}))
+	assert.ErrorIs(t, err, ErrTimestampInFuture)
+}
+
+func TestVerifyLinkSignatureThresholdsTimestampedCertificate(t *testing.T) {
+	root, rootPEM, rootPrivateKey, err := createSelfSignedCA(&x509.Certificate{
+		Subject:    pkix.Name{CommonName: "Root CA"},
+		MaxPathLen: 1,
+	}, x509.Ed25519, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, leafPEM, leafPrivateKey, err := createEndEntityCert(&x509.Certificate{
+		Subject: pkix.Name{CommonName: "build.example.com"},
+	}, root, rootPrivateKey, x509.Ed25519, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rootKey, key Key
+	if err := rootKey.LoadKeyReader(bytes.NewReader(rootPEM), "ed25519", []string{"sha512"}); err != nil {
+		t.Fatal(err)
+	}
+	privateKey, err := x509.MarshalPKCS8PrivateKey(leafPrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := key.LoadKeyReader(bytes.NewReader(generatePEMBlock(privateKey, "PRIVATE KEY")), "ed25519", []string{"sha256", "sha512"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := key.AttachCertificate(leafPEM); err != nil {
+		t.Fatal(err)
+	}
+
+	layout := Layout{
+		RootCas: map[string]Key{rootKey.KeyID: rootKey},
+		Steps: []Step{{
+			SupplyChainItem: SupplyChainItem{Name: "build"},
+			CertificateConstraints: []CertificateConstraint{{
+				CommonName: "build.example.com",
+				Roots:      []string{"*"},
+			}},
+			Threshold: 1,
+		}},
+	}
+	rootCertPool, intermediateCertPool, err := LoadLayoutCertificates(layout, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	linkMb := &Metablock{Signed: Link{Type: "link", Name: "build"}}
+	if err := linkMb.Sign(key); err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, linkMb.AddTimestamp(key.KeyID, fakeTimestamper{at: leaf.NotBefore.Add(time.Minute)}))
+	stepsMetadata := map[string]map[string]Metadata{"build": {key.KeyID: linkMb}}
+
+	// Once the certificate expired, only links timestamped while it was valid
+	// pass verification
+	expired := leaf.NotAfter.Add(time.Hour)
+	timestamps := &linkTimestamps{
+		verifiers: []TimestampVerifier{fakeTimestampVerifier{}},
+		now:       expired,
+		expires:   expired,
+	}
+	_, err = verifyLinkSignatureThresholds(layout, stepsMetadata, rootCertPool, intermediateCertPool,
+		expired, 0, nil, nil, nil)
+	assert.ErrorIs(t, err, ErrUntrustedCertificate)
+	_, err = verifyLinkSignatureThresholds(layout, stepsMetadata, rootCertPool, intermediateCertPool,
+		expired, 0, nil, timestamps, nil)
+	assert.Nil(t, err)
+
+	linkMb.Signatures[0].Timestamps = []Timestamp{}
+	assert.Nil(t, linkMb.AddTimestamp(key.KeyID, fakeTimestamper{at: leaf.NotAfter.Add(time.Minute)}))
+	_, err = verifyLinkSignatureThresholds(layout, stepsMetadata, rootCertPool, intermediateCertPool,
+		expired, 0, nil, timestamps, nil)
+	assert.ErrorIs(t, err, ErrUntrustedCertificate)
+}
@@ -0,0 +1,197 @@
+package in_toto
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ToolchainsEnvironmentKey is the key of the toolchain versions of a link in
+// its Environment, see CollectToolchainVersions.
+const ToolchainsEnvironmentKey = "toolchains"
+
+// ErrUnknownToolchain is returned when the version of a toolchain is
+// collected, for which no version command is registered.
+var ErrUnknownToolchain = errors.New("unknown toolchain")
+
+// ErrToolchainNotApproved is returned by Verify, if a link does not record an
+// approved version of a toolchain expected by its step, see
+// Step.ExpectedToolchains.
+var ErrToolchainNotApproved = errors.New("toolchain not approved")
+
+var (
+	toolchainsMu sync.RWMutex
+	// toolchains are the commands that print the version of a toolchain by
+	// toolchain name, see RegisterToolchain
+	toolchains = map[string][]string{
+		"go":    {"go", "env", "GOVERSION"},
+		"gcc":   {"gcc", "-dumpfullversion", "-dumpversion"},
+		"clang": {"clang", "-dumpversion"},
+		"node":  {"node", "--version"},
+		"rustc": {"rustc", "--version"},
+		"javac": {"javac", "-version"},
+	}
+)
+
+/*
+RegisterToolchain registers the command that prints the version of the
+toolchain of the passed name on the first line of its output, replacing the
+command registered before, if any.  Versions of "go", "gcc", "clang", "node",
+"rustc" and "javac" are collected by default, e.g. as "go1.21.5" and "12.2.0".
+Passing no command unregisters the toolchain.
+*/
+func RegisterToolchain(name string, versionCommand ...string) {
+	toolchainsMu.Lock()
+	defer toolchainsMu.Unlock()
+	if len(versionCommand) == 0 {
+		delete(toolchains, name)
+		return
+	}
+	toolchains[name] = append([]string(nil), versionCommand...)
+}
+
+/*
+CollectToolchainVersions runs the version commands of the toolchains of the
+passed names in the passed directory, see RegisterToolchain, and returns their
+versions by toolchain name.  Run records them in the Environment of the link
+of a step under ToolchainsEnvironmentKey, see WithToolchains, so that layouts
+can require approved toolchains, see Step.ExpectedToolchains.
+*/
+func CollectToolchainVersions(ctx context.Context, dir string, names ...string) (map[string]string, error) {
+	versions := make(map[string]string, len(names))
+	for _, name := range names {
+		toolchainsMu.RLock()
+		versionCommand, ok := toolchains[name]
+		toolchainsMu.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("%w: '%s'", ErrUnknownToolchain, name)
+		}
+		var stdout, stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, versionCommand[0], versionCommand[1:]...)
+		cmd.Dir = dir
+		cmd.Stdout = &stdout
+		// Some toolchains, e.g. older javac, print their version to stderr
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return nil, fmt.Errorf("version of toolchain '%s': %w", name, err)
+		}
+		output := stdout.String()
+		if strings.TrimSpace(output) == "" {
+			output = stderr.String()
+		}
+		version, _, _ := strings.Cut(strings.TrimSpace(output), "\n")
+		if version = strings.TrimSpace(version); version == "" {
+			return nil, fmt.Errorf("version of toolchain '%s': no output", name)
+		}
+		versions[name] = version
+	}
+	return versions, nil
+}
+
+/*
+GetToolchainVersions returns the toolchain versions recorded in the
+Environment of the passed link by toolchain name, or nil if the link has
+none.  Like content types, toolchain versions are reported by the
+functionary, see GetArtifactContentTypes.
+*/
+func GetToolchainVersions(link Link) (map[string]string, error) {
+	var versions map[string]string
+	if _, err := link.Environment.Custom(ToolchainsEnvironmentKey, &versions); err != nil {
+		return nil, fmt.Errorf("invalid toolchains in link '%s': %w", link.Name, err)
+	}
+	return versions, nil
+}
+
+// setToolchainVersions stores the passed toolchain versions in the
+// Environment of the passed link.
+func setToolchainVersions(link *Link, versions map[string]string) {
+	link.Environment.SetCustom(ToolchainsEnvironmentKey, versions)
+}
+
+// validateExpectedToolchains checks that the passed expected toolchains of a
+// step have names and valid version patterns, see path.Match.
+func validateExpectedToolchains(expected map[string][]string) error {
+	for name, patterns := range expected {
+		if name == "" {
+			return fmt.Errorf("empty toolchain name")
+		}
+		if len(patterns) == 0 {
+			return fmt.Errorf("no approved versions of toolchain '%s'", name)
+		}
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid version pattern '%s' of toolchain '%s': %w", pattern, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+/*
+verifyToolchains checks that each link of the steps of the passed layout
+records a version of each toolchain expected by its step, that matches one of
+the approved version patterns, or returns an ErrToolchainNotApproved.  Steps,
+links and toolchains are visited in a fixed order, so that the same error is
+returned on every run.  Links without Link payload, e.g. the summary links of
+sublayouts, are skipped.
+*/
+func verifyToolchains(layout Layout, stepsMetadata map[string]map[string]Metadata) error {
+	for _, step := range layout.Steps {
+		if len(step.ExpectedToolchains) == 0 {
+			continue
+		}
+		names := make([]string, 0, len(step.ExpectedToolchains))
+		for name := range step.ExpectedToolchains {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		keyIDs := make([]string, 0, len(stepsMetadata[step.Name]))
+		for keyID := range stepsMetadata[step.Name] {
+			keyIDs = append(keyIDs, keyID)
+		}
+		sort.Strings(keyIDs)
+
+		for _, keyID := range keyIDs {
+			link, ok := stepsMetadata[step.Name][keyID].GetPayload().(Link)
+			if !ok {
+				continue
+			}
+			versions, err := GetToolchainVersions(link)
+			if err != nil {
+				return err
+			}
+			for _, name := range names {
+				if !matchToolchainVersion(step.ExpectedToolchains[name], versions[name]) {
+					version := versions[name]
+					if version == "" {
+						version = "unknown"
+					}
+					return fmt.Errorf("%w: link of step '%s' signed by '%s' records version '%s' of toolchain '%s', expected one of '%s'",
+						ErrToolchainNotApproved, step.Name, keyID, version, name,
+						strings.Join(step.ExpectedToolchains[name], "', '"))
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// matchToolchainVersion reports whether the passed recorded version matches
+// any of the passed version patterns.  Missing versions never match.
+func matchToolchainVersion(patterns []string, version string) bool {
+	if version == "" {
+		return false
+	}
+	for _, pattern := range patterns {
+		if matched, err := path.Match(pattern, version); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
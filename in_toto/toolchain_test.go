@@ -0,0 +1,67 @@
+package in_toto
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToolchains(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go is not installed")
+	}
+	var key Key
+	if err := key.LoadKeyDefaults("carol"); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := CollectToolchainVersions(context.Background(), "", "unknown")
+	assert.ErrorIs(t, err, ErrUnknownToolchain)
+
+	RegisterToolchain("go-alias", "go", "env", "GOVERSION")
+	defer RegisterToolchain("go-alias")
+	versions, err := CollectToolchainVersions(context.Background(), "", "go", "go-alias")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, strings.HasPrefix(versions["go"], "go"), versions["go"])
+	assert.Equal(t, versions["go"], versions["go-alias"])
+
+	linkEnv, err := Run("build", nil, key, WithToolchains("go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := linkEnv.GetPayload().(Link)
+	recorded, err := GetToolchainVersions(link)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"go": versions["go"]}, recorded)
+
+	layout, err := NewLayout().
+		Expires(time.Now().AddDate(0, 1, 0)).
+		AddFunctionary(key).
+		AddStep("build").
+		Functionaries(key.KeyID).
+		ExpectedToolchain("go", "go0.*", "go1.*", "devel*").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stepsMetadata := map[string]map[string]Metadata{"build": {key.KeyID: linkEnv}}
+	assert.Nil(t, verifyToolchains(layout, stepsMetadata))
+
+	layout.Steps[0].ExpectedToolchains["go"] = []string{"go0.*"}
+	assert.ErrorIs(t, verifyToolchains(layout, stepsMetadata), ErrToolchainNotApproved)
+
+	// Links must record all expected toolchains
+	layout.Steps[0].ExpectedToolchains = map[string][]string{"gcc": {"*"}}
+	assert.ErrorIs(t, verifyToolchains(layout, stepsMetadata), ErrToolchainNotApproved)
+
+	layout.Steps[0].ExpectedToolchains = map[string][]string{"go": {"["}}
+	assert.NotNil(t, validateStep(layout.Steps[0]))
+	layout.Steps[0].ExpectedToolchains = map[string][]string{"go": {}}
+	assert.NotNil(t, validateStep(layout.Steps[0]))
+}
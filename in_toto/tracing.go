@@ -0,0 +1,82 @@
+package in_toto
+
+import (
+	"context"
+	"sync"
+)
+
+/*
+Span is a single traced operation, e.g. recording artifacts or verifying a
+signature.  Span is a subset of the span API of OpenTelemetry, hence an
+OpenTelemetry span can be adapted with a few lines of code.
+*/
+type Span interface {
+	// SetAttribute annotates the span, e.g. with the name of a step
+	SetAttribute(key string, value interface{})
+	// RecordError marks the span as failed with the passed error
+	RecordError(err error)
+	// End completes the span
+	End()
+}
+
+/*
+Tracer starts spans for the operations of the run and verify paths.  By
+default spans are not recorded.  To export spans, e.g. to OpenTelemetry,
+register a Tracer with SetTracer that starts spans via an OpenTelemetry
+trace.Tracer:
+
+	func (t otelTracer) Start(ctx context.Context, name string) (context.Context, in_toto.Span) {
+		ctx, span := t.tracer.Start(ctx, name)
+		return ctx, otelSpan{span}
+	}
+
+The returned context carries the started span and is passed to Start for
+nested operations.
+*/
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(string, interface{}) {}
+func (noopSpan) RecordError(error)                {}
+func (noopSpan) End()                             {}
+
+type noopTracer struct{}
+
+func (noopTracer) Start(ctx context.Context, _ string) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+var (
+	tracerMu sync.RWMutex
+	tracer   Tracer = noopTracer{}
+)
+
+// SetTracer registers the passed Tracer for all subsequent operations.
+// Passing nil disables tracing.
+func SetTracer(t Tracer) {
+	tracerMu.Lock()
+	defer tracerMu.Unlock()
+	if t == nil {
+		t = noopTracer{}
+	}
+	tracer = t
+}
+
+// startSpan starts a span with the passed name using the registered Tracer.
+func startSpan(ctx context.Context, name string) (context.Context, Span) {
+	tracerMu.RLock()
+	t := tracer
+	tracerMu.RUnlock()
+	return t.Start(ctx, name)
+}
+
+// endSpan records the passed error, if any, and ends the passed span.
+func endSpan(span Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
@@ -0,0 +1,126 @@
+package in_toto
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordedSpan struct {
+	name       string
+	parent     string
+	attributes map[string]interface{}
+	err        error
+	ended      bool
+}
+
+func (s *recordedSpan) SetAttribute(key string, value interface{}) { s.attributes[key] = value }
+func (s *recordedSpan) RecordError(err error)                      { s.err = err }
+func (s *recordedSpan) End()                                       { s.ended = true }
+
+type spanKey struct{}
+
+// recordingTracer records all started spans and tracks their parents via the
+// context.
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	span := &recordedSpan{name: name, attributes: map[string]interface{}{}}
+	if parent, ok := ctx.Value(spanKey{}).(*recordedSpan); ok {
+		span.parent = parent.name
+	}
+	t.spans = append(t.spans, span)
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+func (t *recordingTracer) find(name string) []*recordedSpan {
+	found := []*recordedSpan{}
+	for _, span := range t.spans {
+		if span.name == name {
+			found = append(found, span)
+		}
+	}
+	return found
+}
+
+func TestVerifyTracing(t *testing.T) {
+	tracer := &recordingTracer{}
+	SetTracer(tracer)
+	defer SetTracer(nil)
+
+	layoutEnv, err := LoadMetadata("demo.layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pubKey Key
+	if err := pubKey.LoadKey("alice.pub", "rsassa-pss-sha256", []string{"sha256", "sha512"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := InTotoVerify(layoutEnv, map[string]Key{pubKey.KeyID: pubKey}, ".", "",
+		map[string]string{}, [][]byte{}, testOSisWindows()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, span := range tracer.spans {
+		assert.True(t, span.ended, span.name)
+		assert.Nil(t, span.err, span.name)
+	}
+
+	root := tracer.find("in_toto.InTotoVerify")
+	if assert.Len(t, root, 1) {
+		assert.Empty(t, root[0].parent)
+	}
+	for _, name := range []string{"in_toto.VerifyLayoutSignatures", "in_toto.LoadLinksForLayout",
+		"in_toto.VerifyLinkSignatureThesholds", "in_toto.VerifySublayouts", "in_toto.RunInspections"} {
+		spans := tracer.find(name)
+		if assert.Len(t, spans, 1, name) {
+			assert.Equal(t, "in_toto.InTotoVerify", spans[0].parent, name)
+		}
+	}
+
+	// One span per step and inspection
+	items := []string{}
+	for _, span := range tracer.find("in_toto.VerifyArtifacts") {
+		assert.Equal(t, "in_toto.InTotoVerify", span.parent)
+		items = append(items, span.attributes["in_toto.item"].(string))
+	}
+	assert.Equal(t, []string{"write-code", "package", "untar"}, items)
+
+	// Inspections are traced like runs
+	runs := tracer.find("in_toto.InTotoRun")
+	if assert.Len(t, runs, 1) {
+		assert.Equal(t, "in_toto.RunInspections", runs[0].parent)
+		assert.Equal(t, "untar", runs[0].attributes["in_toto.step"])
+	}
+	commands := tracer.find("in_toto.RunCommand")
+	if assert.Len(t, commands, 1) {
+		assert.Equal(t, "in_toto.InTotoRun", commands[0].parent)
+	}
+	assert.Len(t, tracer.find("in_toto.RecordArtifacts"), 2)
+}
+
+func TestRunTracingError(t *testing.T) {
+	tracer := &recordingTracer{}
+	SetTracer(tracer)
+	defer SetTracer(nil)
+
+	_, err := InTotoRun("test", "", []string{"does-not-exist"}, nil, nil, Key{},
+		[]string{"sha256"}, nil, nil, false, false, false)
+	assert.NotNil(t, err)
+
+	for _, name := range []string{"in_toto.InTotoRun", "in_toto.RecordArtifacts"} {
+		spans := tracer.find(name)
+		if assert.Len(t, spans, 1, name) {
+			assert.True(t, spans[0].ended)
+			assert.ErrorIs(t, spans[0].err, err)
+		}
+	}
+	assert.Empty(t, tracer.find("in_toto.RunCommand"))
+}
@@ -0,0 +1,275 @@
+package in_toto
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrUnknownEnvironment is returned when a trust configuration is resolved
+// for an environment it does not define.
+var ErrUnknownEnvironment = errors.New("unknown trust configuration environment")
+
+// ErrInvalidTrustConfig is returned when a resolved trust configuration is
+// incomplete or inconsistent.
+var ErrInvalidTrustConfig = errors.New("invalid trust configuration")
+
+// ErrLayoutThreshold is returned when fewer layout keys than required by the
+// layout threshold have signed the layout.
+var ErrLayoutThreshold = errors.New("layout signature threshold not met")
+
+/*
+TrustSettings holds the settings used to verify a supply chain.  In a
+TrustConfig, unset fields of an environment inherit the value of the base
+settings.  Relative paths are interpreted relative to the directory of the
+trust configuration file.
+
+  - Layout is the path to the root layout.
+  - LayoutKeys are paths to the public keys trusted to sign the layout.
+  - LayoutThreshold is the number of LayoutKeys that must have signed the
+    layout.  If unset, all LayoutKeys must have signed the layout.
+  - ExpiryTolerance is a duration, e.g. "72h", for which an expired layout is
+    still accepted.
+  - LinkDir is the directory to load links from.
+  - IntermediateCerts are paths to PEM encoded intermediate certificates.
+  - Parameters are used for parameter substitution in the layout.  The
+    parameters of an environment are merged with the base parameters.
+  - LineNormalization enables line normalization for inspections.
+*/
+type TrustSettings struct {
+	Layout            string            `json:"layout,omitempty"`
+	LayoutKeys        []string          `json:"layout_keys,omitempty"`
+	LayoutThreshold   *int              `json:"layout_threshold,omitempty"`
+	ExpiryTolerance   string            `json:"expiry_tolerance,omitempty"`
+	LinkDir           string            `json:"link_dir,omitempty"`
+	IntermediateCerts []string          `json:"intermediate_certs,omitempty"`
+	Parameters        map[string]string `json:"parameters,omitempty"`
+	LineNormalization *bool             `json:"normalize_line_endings,omitempty"`
+}
+
+/*
+TrustConfig is a layered trust configuration, consisting of base settings and
+per-environment overrides, e.g. for dev, staging and prod.  This allows to
+enforce different verification strictness per deployment tier with the same
+configuration file, e.g.:
+
+	{
+	  "base": {
+	    "layout": "root.layout",
+	    "layout_keys": ["alice.pub", "bob.pub"],
+	    "layout_threshold": 1
+	  },
+	  "environments": {
+	    "dev": {"expiry_tolerance": "168h"},
+	    "prod": {"layout_threshold": 2}
+	  }
+	}
+*/
+type TrustConfig struct {
+	Base         TrustSettings            `json:"base"`
+	Environments map[string]TrustSettings `json:"environments,omitempty"`
+	// baseDir is used to resolve relative paths
+	baseDir string
+}
+
+/*
+LoadTrustConfig loads a JSON encoded trust configuration from the passed path.
+Relative paths in the configuration are resolved relative to the directory of
+the configuration file.
+*/
+func LoadTrustConfig(path string) (*TrustConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config TrustConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidTrustConfig, err)
+	}
+	config.baseDir = filepath.Dir(path)
+
+	return &config, nil
+}
+
+// resolvePath resolves the passed path relative to the base directory of the
+// trust configuration.
+func (c *TrustConfig) resolvePath(path string) string {
+	if path == "" || filepath.IsAbs(path) || c.baseDir == "" {
+		return path
+	}
+	return filepath.Join(c.baseDir, path)
+}
+
+/*
+Resolve returns the settings for the passed environment, i.e. the base
+settings overridden by all settings that the environment defines.  An empty
+environment resolves to the base settings.  The resolved settings are
+validated and carry resolved paths.
+*/
+func (c *TrustConfig) Resolve(environment string) (TrustSettings, error) {
+	resolved := c.Base
+	resolved.Parameters = map[string]string{}
+	for k, v := range c.Base.Parameters {
+		resolved.Parameters[k] = v
+	}
+
+	if environment != "" {
+		override, ok := c.Environments[environment]
+		if !ok {
+			return TrustSettings{}, fmt.Errorf("%w: '%s'", ErrUnknownEnvironment, environment)
+		}
+		if override.Layout != "" {
+			resolved.Layout = override.Layout
+		}
+		if override.LayoutKeys != nil {
+			resolved.LayoutKeys = override.LayoutKeys
+		}
+		if override.LayoutThreshold != nil {
+			resolved.LayoutThreshold = override.LayoutThreshold
+		}
+		if override.ExpiryTolerance != "" {
+			resolved.ExpiryTolerance = override.ExpiryTolerance
+		}
+		if override.LinkDir != "" {
+			resolved.LinkDir = override.LinkDir
+		}
+		if override.IntermediateCerts != nil {
+			resolved.IntermediateCerts = override.IntermediateCerts
+		}
+		for k, v := range override.Parameters {
+			resolved.Parameters[k] = v
+		}
+		if override.LineNormalization != nil {
+			resolved.LineNormalization = override.LineNormalization
+		}
+	}
+
+	if resolved.Layout == "" {
+		return TrustSettings{}, fmt.Errorf("%w: no layout", ErrInvalidTrustConfig)
+	}
+	if len(resolved.LayoutKeys) == 0 {
+		return TrustSettings{}, fmt.Errorf("%w: no layout keys", ErrInvalidTrustConfig)
+	}
+	if resolved.LayoutThreshold != nil &&
+		(*resolved.LayoutThreshold < 1 || *resolved.LayoutThreshold > len(resolved.LayoutKeys)) {
+		return TrustSettings{}, fmt.Errorf("%w: layout threshold %d must be between 1 and the number of layout keys",
+			ErrInvalidTrustConfig, *resolved.LayoutThreshold)
+	}
+	if _, err := resolved.expiryTolerance(); err != nil {
+		return TrustSettings{}, err
+	}
+
+	resolved.Layout = c.resolvePath(resolved.Layout)
+	resolved.LinkDir = c.resolvePath(resolved.LinkDir)
+	layoutKeys := make([]string, 0, len(resolved.LayoutKeys))
+	for _, keyPath := range resolved.LayoutKeys {
+		layoutKeys = append(layoutKeys, c.resolvePath(keyPath))
+	}
+	resolved.LayoutKeys = layoutKeys
+	intermediateCerts := make([]string, 0, len(resolved.IntermediateCerts))
+	for _, certPath := range resolved.IntermediateCerts {
+		intermediateCerts = append(intermediateCerts, c.resolvePath(certPath))
+	}
+	resolved.IntermediateCerts = intermediateCerts
+
+	return resolved, nil
+}
+
+// expiryTolerance returns the parsed expiry tolerance of the settings.
+func (s TrustSettings) expiryTolerance() (time.Duration, error) {
+	if s.ExpiryTolerance == "" {
+		return 0, nil
+	}
+	tolerance, err := time.ParseDuration(s.ExpiryTolerance)
+	if err != nil || tolerance < 0 {
+		return 0, fmt.Errorf("%w: invalid expiry tolerance '%s'", ErrInvalidTrustConfig, s.ExpiryTolerance)
+	}
+	return tolerance, nil
+}
+
+/*
+VerifyLayoutSignatureThreshold verifies that at least threshold of the passed
+keys have a valid signature on the passed layout and returns the keys with a
+valid signature.  If the threshold is not met an ErrLayoutThreshold is
+returned.
+*/
+func VerifyLayoutSignatureThreshold(layoutEnv Metadata, layoutKeys map[string]Key, threshold int) (map[string]Key, error) {
+	if threshold < 1 {
+		return nil, fmt.Errorf("layout verification requires a threshold of at least one")
+	}
+
+	verifiedKeys := make(map[string]Key)
+	for keyID, key := range layoutKeys {
+		if err := layoutEnv.VerifySignature(key); err == nil {
+			verifiedKeys[keyID] = key
+		}
+	}
+
+	if len(verifiedKeys) < threshold {
+		return nil, fmt.Errorf("%w: found %d valid signature(s), expected %d",
+			ErrLayoutThreshold, len(verifiedKeys), threshold)
+	}
+	return verifiedKeys, nil
+}
+
+/*
+InTotoVerifyWithTrustConfig resolves the passed trust configuration for the
+passed environment and verifies the supply chain accordingly.  It loads the
+layout, layout keys and intermediate certificates from the resolved paths,
+verifies the layout signature threshold and then performs the verification
+routine of InTotoVerify, accepting expired layouts within the resolved expiry
+tolerance.
+*/
+func InTotoVerifyWithTrustConfig(config *TrustConfig, environment string, stepName string) (Metadata, error) {
+	settings, err := config.Resolve(environment)
+	if err != nil {
+		return nil, err
+	}
+	expiryTolerance, err := settings.expiryTolerance()
+	if err != nil {
+		return nil, err
+	}
+
+	layoutEnv, err := LoadMetadata(settings.Layout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load layout at %s: %w", settings.Layout, err)
+	}
+
+	layoutKeys := make(map[string]Key, len(settings.LayoutKeys))
+	for _, keyPath := range settings.LayoutKeys {
+		var key Key
+		if err := key.LoadKeyDefaults(keyPath); err != nil {
+			return nil, fmt.Errorf("invalid key at %s: %w", keyPath, err)
+		}
+		layoutKeys[key.KeyID] = key
+	}
+
+	intermediatePems := make([][]byte, 0, len(settings.IntermediateCerts))
+	for _, certPath := range settings.IntermediateCerts {
+		pemBytes, err := os.ReadFile(certPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read intermediate %s: %w", certPath, err)
+		}
+		intermediatePems = append(intermediatePems, pemBytes)
+	}
+
+	threshold := len(layoutKeys)
+	if settings.LayoutThreshold != nil {
+		threshold = *settings.LayoutThreshold
+	}
+	verifiedKeys, err := VerifyLayoutSignatureThreshold(layoutEnv, layoutKeys, threshold)
+	if err != nil {
+		return nil, err
+	}
+
+	lineNormalization := settings.LineNormalization != nil && *settings.LineNormalization
+
+	return inTotoVerify(context.Background(), layoutEnv, verifiedKeys, settings.LinkDir, stepName,
+		settings.Parameters, intermediatePems, lineNormalization,
+		verifyOptions{expiryTolerance: expiryTolerance})
+}
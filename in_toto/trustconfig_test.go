@@ -0,0 +1,129 @@
+package in_toto
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTrustConfig(t *testing.T, path string, config string) *TrustConfig {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.Remove(path)
+		if dir := filepath.Dir(path); dir != "." {
+			os.Remove(dir)
+		}
+	})
+
+	trustConfig, err := LoadTrustConfig(path)
+	if err != nil {
+		t.Fatalf("LoadTrustConfig failed: %s", err)
+	}
+	return trustConfig
+}
+
+func TestTrustConfigResolve(t *testing.T) {
+	config := writeTrustConfig(t, filepath.Join("trust-config", "trust.json"), `{
+  "base": {
+    "layout": "../demo.layout",
+    "layout_keys": ["../alice.pub", "../dan.pub"],
+    "layout_threshold": 1,
+    "link_dir": "..",
+    "parameters": {"A": "base", "B": "base"}
+  },
+  "environments": {
+    "dev": {"expiry_tolerance": "168h", "parameters": {"B": "dev"}},
+    "prod": {"layout_threshold": 2, "normalize_line_endings": true},
+    "broken": {"layout_threshold": 3},
+    "broken-tolerance": {"expiry_tolerance": "forever"}
+  }
+}`)
+
+	base, err := config.Resolve("")
+	assert.Nil(t, err)
+	assert.Equal(t, "demo.layout", base.Layout)
+	assert.Equal(t, []string{"alice.pub", "dan.pub"}, base.LayoutKeys)
+	assert.Equal(t, ".", base.LinkDir)
+	assert.Equal(t, 1, *base.LayoutThreshold)
+	assert.Nil(t, base.LineNormalization)
+
+	dev, err := config.Resolve("dev")
+	assert.Nil(t, err)
+	assert.Equal(t, "168h", dev.ExpiryTolerance)
+	assert.Equal(t, map[string]string{"A": "base", "B": "dev"}, dev.Parameters)
+	assert.Equal(t, 1, *dev.LayoutThreshold)
+
+	prod, err := config.Resolve("prod")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, *prod.LayoutThreshold)
+	assert.True(t, *prod.LineNormalization)
+	assert.Equal(t, "", prod.ExpiryTolerance)
+
+	// Overrides must not leak into the base settings
+	assert.Equal(t, map[string]string{"A": "base", "B": "base"}, config.Base.Parameters)
+
+	_, err = config.Resolve("qa")
+	assert.ErrorIs(t, err, ErrUnknownEnvironment)
+	_, err = config.Resolve("broken")
+	assert.ErrorIs(t, err, ErrInvalidTrustConfig)
+	_, err = config.Resolve("broken-tolerance")
+	assert.ErrorIs(t, err, ErrInvalidTrustConfig)
+
+	_, err = (&TrustConfig{}).Resolve("")
+	assert.ErrorIs(t, err, ErrInvalidTrustConfig)
+}
+
+func TestInTotoVerifyWithTrustConfig(t *testing.T) {
+	config := writeTrustConfig(t, "trust.json", fmt.Sprintf(`{
+  "base": {
+    "layout": "demo.layout",
+    "layout_keys": ["alice.pub", "dan.pub"],
+    "layout_threshold": 1,
+    "normalize_line_endings": %t
+  },
+  "environments": {
+    "prod": {"layout_threshold": 2},
+    "other": {"link_dir": "does-not-exist"}
+  }
+}`, testOSisWindows()))
+
+	if _, err := InTotoVerifyWithTrustConfig(config, "", ""); err != nil {
+		t.Errorf("InTotoVerifyWithTrustConfig failed: %s", err)
+	}
+
+	// demo.layout is only signed by alice
+	_, err := InTotoVerifyWithTrustConfig(config, "prod", "")
+	assert.ErrorIs(t, err, ErrLayoutThreshold)
+
+	_, err = InTotoVerifyWithTrustConfig(config, "other", "")
+	assert.NotNil(t, err)
+}
+
+func TestVerifyLayoutExpirationWithTolerance(t *testing.T) {
+	layout := Layout{Expires: time.Now().Add(-time.Hour).UTC().Format(ISO8601DateSchema)}
+
+	assert.NotNil(t, VerifyLayoutExpiration(layout))
+	assert.NotNil(t, VerifyLayoutExpirationWithTolerance(layout, time.Minute))
+	assert.Nil(t, VerifyLayoutExpirationWithTolerance(layout, 2*time.Hour))
+}
+
+func TestLoadTrustConfigErrors(t *testing.T) {
+	_, err := LoadTrustConfig("does-not-exist.json")
+	assert.NotNil(t, err)
+
+	if err := os.WriteFile("invalid-trust.json", []byte("not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("invalid-trust.json")
+	_, err = LoadTrustConfig("invalid-trust.json")
+	assert.ErrorIs(t, err, ErrInvalidTrustConfig)
+}
@@ -0,0 +1,181 @@
+package in_toto
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+/*
+TrustSnapshot is a consistent set of trusted layout keys and the root layout
+signed by them, as loaded by a TrustStore at LoadedAt.  Snapshots are never
+modified, a reload creates a new snapshot.
+*/
+type TrustSnapshot struct {
+	Layout     Metadata
+	LayoutKeys map[string]Key
+	LoadedAt   time.Time
+}
+
+// trustFileState is the modification time and size of a file of a
+// TrustStore, used to detect changes.
+type trustFileState struct {
+	modTime time.Time
+	size    int64
+}
+
+/*
+TrustStore holds the trusted layout keys and the root layout of a
+long-running verifier, e.g. an admission controller, and reloads them from
+their files without interrupting verification, e.g. to rotate trust roots.
+
+A reload, either explicit via Reload or triggered by Watch, loads all files
+into a new TrustSnapshot, and only swaps it in if the layout verifies with the
+new keys.  Until then, and if loading fails, e.g. while files of a rotation are
+only partially replaced, the previous snapshot stays in use.  Verifications in
+flight keep the snapshot they started with, see Snapshot and Verify.
+*/
+type TrustStore struct {
+	layoutPath string
+	keyPaths   []string
+
+	// reloadMu serializes reloads, mu guards the current snapshot and the
+	// file states it was loaded from
+	reloadMu sync.Mutex
+	mu       sync.RWMutex
+	snapshot *TrustSnapshot
+	states   map[string]trustFileState
+}
+
+/*
+NewTrustStore returns a TrustStore for the layout at layoutPath and the layout
+keys at keyPaths, which are loaded with LoadKeyDefaults.  The files are loaded
+immediately, and an error is returned if they cannot be loaded or the layout
+does not verify with the keys.
+*/
+func NewTrustStore(layoutPath string, keyPaths ...string) (*TrustStore, error) {
+	s := &TrustStore{layoutPath: layoutPath, keyPaths: append([]string{}, keyPaths...)}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Snapshot returns the current trusted layout keys and layout.
+func (s *TrustStore) Snapshot() *TrustSnapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.snapshot
+}
+
+// files returns the paths of all files of the trust store.
+func (s *TrustStore) files() []string {
+	return append([]string{s.layoutPath}, s.keyPaths...)
+}
+
+// statFiles returns the current states of all files of the trust store.
+func (s *TrustStore) statFiles() (map[string]trustFileState, error) {
+	states := make(map[string]trustFileState)
+	for _, path := range s.files() {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		states[path] = trustFileState{modTime: info.ModTime(), size: info.Size()}
+	}
+	return states, nil
+}
+
+/*
+Reload loads the layout keys and the layout from their files and, if the
+layout verifies with the keys, atomically replaces the current snapshot.  On
+error the current snapshot is kept.
+*/
+func (s *TrustStore) Reload() error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	// Files are stated before they are read, so that changes while reading
+	// are detected by the next check of Watch
+	states, err := s.statFiles()
+	if err != nil {
+		return err
+	}
+
+	layoutKeys := make(map[string]Key, len(s.keyPaths))
+	for _, keyPath := range s.keyPaths {
+		var key Key
+		if err := key.LoadKeyDefaults(keyPath); err != nil {
+			return fmt.Errorf("invalid key at %s: %w", keyPath, err)
+		}
+		layoutKeys[key.KeyID] = key
+	}
+	layoutEnv, err := LoadMetadata(s.layoutPath)
+	if err != nil {
+		return fmt.Errorf("failed to load layout at %s: %w", s.layoutPath, err)
+	}
+	if err := VerifyLayoutSignatures(layoutEnv, layoutKeys); err != nil {
+		return fmt.Errorf("layout at %s does not verify with the layout keys: %w", s.layoutPath, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snapshot = &TrustSnapshot{Layout: layoutEnv, LayoutKeys: layoutKeys, LoadedAt: time.Now()}
+	s.states = states
+	return nil
+}
+
+// changed returns true if any file of the trust store was modified since the
+// current snapshot was loaded.
+func (s *TrustStore) changed() (bool, error) {
+	states, err := s.statFiles()
+	if err != nil {
+		return false, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for path, state := range states {
+		if loaded := s.states[path]; !state.modTime.Equal(loaded.modTime) || state.size != loaded.size {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+/*
+Watch checks the modification times and sizes of the files of the trust store
+every interval, and reloads them if any changed, until ctx is done.  Errors,
+e.g. of a reload of a partially replaced set of files, are passed to onError,
+if not nil, and the check is retried after the next interval.  Watch blocks,
+hence it is usually run in its own goroutine.
+*/
+func (s *TrustStore) Watch(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		changed, err := s.changed()
+		if err == nil && changed {
+			err = s.Reload()
+		}
+		if err != nil && onError != nil {
+			onError(err)
+		}
+	}
+}
+
+/*
+Verify performs the verification routine of Verify with the layout and the
+layout keys of the current snapshot.  A reload during verification does not
+affect it.
+*/
+func (s *TrustStore) Verify(linkDir string, opts ...VerifyOption) (Metadata, error) {
+	snapshot := s.Snapshot()
+	return Verify(snapshot.Layout, snapshot.LayoutKeys, linkDir, opts...)
+}
@@ -0,0 +1,119 @@
+package in_toto
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrustStoreReload(t *testing.T) {
+	var dan Key
+	if err := dan.LoadKeyDefaults("dan"); err != nil {
+		t.Fatal(err)
+	}
+	demo, err := LoadMetadata("demo.layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	danLayout := &Metablock{Signed: demo.GetPayload()}
+	if err := danLayout.Sign(dan); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	layoutPath := filepath.Join(dir, "root.layout")
+	keyPath := filepath.Join(dir, "root.pub")
+	if _, err := copy("demo.layout", layoutPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := copy("alice.pub", keyPath); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := NewTrustStore(layoutPath, keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := store.Snapshot()
+	assert.Len(t, before.LayoutKeys, 1)
+
+	// A partially rotated trust root is not swapped in
+	if err := danLayout.Dump(layoutPath); err != nil {
+		t.Fatal(err)
+	}
+	assert.NotNil(t, store.Reload())
+	assert.Same(t, before, store.Snapshot())
+
+	// A completely rotated trust root is swapped in, previous snapshots stay
+	// usable
+	if _, err := copy("dan.pub", keyPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	after := store.Snapshot()
+	assert.NotSame(t, before, after)
+	assert.Contains(t, after.LayoutKeys, dan.KeyID)
+	assert.Nil(t, VerifyLayoutSignatures(before.Layout, before.LayoutKeys))
+	assert.Nil(t, VerifyLayoutSignatures(after.Layout, after.LayoutKeys))
+
+	_, err = NewTrustStore(filepath.Join(dir, "missing.layout"), keyPath)
+	assert.NotNil(t, err)
+}
+
+func TestTrustStoreWatch(t *testing.T) {
+	dir := t.TempDir()
+	layoutPath := filepath.Join(dir, "root.layout")
+	keyPath := filepath.Join(dir, "root.pub")
+	if _, err := copy("demo.layout", layoutPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := copy("alice.pub", keyPath); err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewTrustStore(layoutPath, keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := store.Snapshot()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	errs := make(chan error, 100)
+	go func() {
+		store.Watch(ctx, 10*time.Millisecond, func(err error) { errs <- err })
+		close(done)
+	}()
+
+	// Touching a file triggers a reload
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(layoutPath, future, future); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for store.Snapshot() == before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.NotSame(t, before, store.Snapshot())
+
+	// Failing reloads are reported and keep the snapshot
+	current := store.Snapshot()
+	if err := os.WriteFile(keyPath, []byte("not a key"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-errs:
+		assert.NotNil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Error("expected reload error")
+	}
+	assert.Same(t, current, store.Snapshot())
+
+	cancel()
+	<-done
+}
@@ -0,0 +1,88 @@
+package in_toto
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrNoTUFLayoutKeys is returned when a layout is verified with layout keys
+// from a TUF repository, but no key targets are passed.
+var ErrNoTUFLayoutKeys = errors.New("no tuf targets of layout keys")
+
+/*
+TUFTargetFetcher returns the contents of verified targets of a TUF repository
+by name.  It is implemented by TUFClient, and can be implemented for other TUF
+clients, e.g. for a go-tuf updater, by looking up each target with
+GetTargetInfo and downloading it with DownloadTarget.  Implementations must
+only return targets that verify against the trusted TUF metadata.
+*/
+type TUFTargetFetcher interface {
+	Targets(ctx context.Context, names ...string) (map[string][]byte, error)
+}
+
+/*
+LoadTUFLayout loads the root layout from the passed target of a TUF
+repository, so that layouts can be updated without distributing them to
+verifiers out of band.  Like LoadMetadata, the layout is validated, but its
+signatures are not verified.
+*/
+func LoadTUFLayout(ctx context.Context, fetcher TUFTargetFetcher, target string) (Metadata, error) {
+	targets, err := fetcher.Targets(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	layoutEnv, err := decodeMetadata(targets[target])
+	if err != nil {
+		return nil, fmt.Errorf("target '%s': %w", target, err)
+	}
+	if _, ok := layoutEnv.GetPayload().(Layout); !ok {
+		return nil, fmt.Errorf("target '%s': %w", target, ErrNotLayout)
+	}
+	return layoutEnv, nil
+}
+
+/*
+LoadTUFLayoutKeys loads the PEM formatted public keys of the passed targets
+of a TUF repository, and returns them by keyid, e.g. to pass as layout keys to
+Verify.  This implements the bootstrapping of in-toto with TUF: only the
+initial TUF root metadata is distributed out of band, while layout keys are
+rotated and revoked with the targets of the repository.
+*/
+func LoadTUFLayoutKeys(ctx context.Context, fetcher TUFTargetFetcher, targets ...string) (map[string]Key, error) {
+	if len(targets) == 0 {
+		return nil, ErrNoTUFLayoutKeys
+	}
+	contents, err := fetcher.Targets(ctx, targets...)
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]Key, len(targets))
+	for _, target := range targets {
+		var key Key
+		if err := key.LoadKeyReaderDefaults(bytes.NewReader(contents[target])); err != nil {
+			return nil, fmt.Errorf("target '%s': %w", target, err)
+		}
+		keys[key.KeyID] = key
+	}
+	return keys, nil
+}
+
+/*
+VerifyWithTUF behaves like VerifyContext, but loads the root layout and the
+layout keys from the passed targets of a TUF repository, see LoadTUFLayout and
+LoadTUFLayoutKeys.  The layout must be signed by each of the keys.
+*/
+func VerifyWithTUF(ctx context.Context, fetcher TUFTargetFetcher, layoutTarget string, keyTargets []string,
+	linkDir string, opts ...VerifyOption) (Metadata, error) {
+	layoutKeys, err := LoadTUFLayoutKeys(ctx, fetcher, keyTargets...)
+	if err != nil {
+		return nil, err
+	}
+	layoutEnv, err := LoadTUFLayout(ctx, fetcher, layoutTarget)
+	if err != nil {
+		return nil, err
+	}
+	return VerifyContext(ctx, layoutEnv, layoutKeys, linkDir, opts...)
+}
@@ -0,0 +1,85 @@
+package in_toto
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyWithTUF(t *testing.T) {
+	var alice Key
+	if err := alice.LoadKeyDefaults("alice"); err != nil {
+		t.Fatal(err)
+	}
+	layoutMb := &Metablock{Signed: Layout{Type: "layout", Expires: "2100-01-01T00:00:00Z",
+		Steps: []Step{}, Inspect: []Inspection{}, Keys: map[string]Key{}}, Signatures: []Signature{}}
+	if err := layoutMb.Sign(alice); err != nil {
+		t.Fatal(err)
+	}
+	var layout bytes.Buffer
+	if err := layoutMb.DumpTo(&layout); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{"layouts/root.layout": layout.Bytes()}
+	for _, name := range []string{"alice.pub", "carol.pub", "foo.b7d643de.link"} {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files["keys/"+name] = data
+	}
+
+	_, rootKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := newTUFTestRepository(t)
+	initialRoot := repo.rotateRoot(rootKey)
+	repo.publishTargets(files, 1, time.Now().Add(time.Hour))
+	server := httptest.NewServer(repo)
+	defer server.Close()
+	cacheDir := filepath.Join(t.TempDir(), "tuf")
+	client, err := NewTUFClient(server.URL, initialRoot, cacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	linkDir := t.TempDir()
+	_, err = VerifyWithTUF(ctx, client, "layouts/root.layout", []string{"keys/alice.pub"}, linkDir)
+	assert.Nil(t, err)
+	assert.FileExists(t, filepath.Join(cacheDir, "layouts", "root.layout"))
+
+	// The layout must be signed by each key
+	_, err = VerifyWithTUF(ctx, client, "layouts/root.layout", []string{"keys/alice.pub", "keys/carol.pub"}, linkDir)
+	assert.ErrorIs(t, err, ErrSignatureNotFound)
+	_, err = VerifyWithTUF(ctx, client, "layouts/root.layout", nil, linkDir)
+	assert.ErrorIs(t, err, ErrNoTUFLayoutKeys)
+
+	// Targets must be listed, be layouts and keys, and not be tampered with
+	_, err = LoadTUFLayoutKeys(ctx, client, "keys/bob.pub")
+	assert.ErrorIs(t, err, ErrTUFVerification)
+	_, err = LoadTUFLayout(ctx, client, "keys/foo.b7d643de.link")
+	assert.ErrorIs(t, err, ErrNotLayout)
+	_, err = LoadTUFLayoutKeys(ctx, client, "layouts/root.layout")
+	assert.NotNil(t, err)
+	for _, name := range []string{"../root.layout", "/root.layout", "timestamp.json", "2.root.json"} {
+		_, err = client.Targets(ctx, name)
+		assert.ErrorContains(t, err, "invalid tuf target name")
+	}
+	if err := os.WriteFile(filepath.Join(cacheDir, "keys", "alice.pub"), files["keys/carol.pub"], 0644); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := LoadTUFLayoutKeys(ctx, client, "keys/alice.pub")
+	if assert.Nil(t, err) {
+		assert.Contains(t, keys, alice.KeyID)
+	}
+}
@@ -4,7 +4,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"reflect"
+	"sort"
 	"strings"
 )
 
@@ -92,9 +95,15 @@ was called that match the passed pattern. A matching error is treated like a
 non-match plus a warning is printed.
 */
 func (s Set) Filter(pattern string) Set {
+	return s.filter(pattern, artifactMatcher{})
+}
+
+// filter implements Filter, matching the pattern with the passed
+// artifactMatcher.
+func (s Set) filter(pattern string, m artifactMatcher) Set {
 	res := NewSet()
 	for elem := range s {
-		matched, err := match(pattern, elem)
+		matched, err := m.match(pattern, elem)
 		if err != nil {
 			fmt.Printf("WARNING: %s, pattern was '%s'\n", err, pattern)
 			continue
@@ -120,6 +129,13 @@ func (s Set) Slice() []string {
 	return res
 }
 
+// sortedSlice returns the elements of the set as sorted string slice.
+func (s Set) sortedSlice() []string {
+	res := s.Slice()
+	sort.Strings(res)
+	return res
+}
+
 /*
 artifactsDictKeyStrings returns string keys of passed HashObj map in an
 unordered string slice.
@@ -184,7 +200,112 @@ func loadPayload(payloadBytes []byte) (any, error) {
 		}
 
 		return layout, nil
+	} else if payload["_type"] == "denylist" {
+		var denylist Denylist
+		if err := checkRequiredJSONFields(payload, reflect.TypeOf(denylist)); err != nil {
+			return nil, fmt.Errorf("error decoding payload: %w", err)
+		}
+
+		decoder := json.NewDecoder(strings.NewReader(string(payloadBytes)))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&denylist); err != nil {
+			return nil, fmt.Errorf("error decoding payload: %w", err)
+		}
+
+		return denylist, nil
+	} else if payload["_type"] == "release-manifest" {
+		var manifest ReleaseManifest
+		if err := checkRequiredJSONFields(payload, reflect.TypeOf(manifest)); err != nil {
+			return nil, fmt.Errorf("error decoding payload: %w", err)
+		}
+
+		decoder := json.NewDecoder(strings.NewReader(string(payloadBytes)))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&manifest); err != nil {
+			return nil, fmt.Errorf("error decoding payload: %w", err)
+		}
+
+		return manifest, nil
 	}
 
 	return nil, ErrUnknownMetadataType
 }
+
+// digestsMatch returns true if the passed digests have at least one algorithm
+// in common and the digests of all common algorithms are equal.
+func digestsMatch(a HashObj, b HashObj) bool {
+	commonAlgorithms := 0
+	for algorithm, digest := range a {
+		other, ok := b[algorithm]
+		if !ok {
+			continue
+		}
+		if !digestStringsEqual(other, digest) {
+			return false
+		}
+		commonAlgorithms++
+	}
+	return commonAlgorithms > 0
+}
+
+// metadataDirLockName is the name of the lock file, which serializes writes of
+// metadata files to the same directory across processes.  It is not recorded
+// as artifact, see recordArtifacts.
+const metadataDirLockName = ".in-toto.lock"
+
+/*
+writeMetadataFile writes the passed data to the passed path, so that
+concurrent writers, e.g. parallel CI jobs recording links into the same
+directory, neither corrupt nor interleave metadata files.  Writes are
+serialized by an advisory lock on a lock file in the directory of the path,
+and the data is first written to a temporary file in the same directory,
+which is then renamed to the path.  Readers thus see either the previous or
+the new contents of the file, but never a partial write.
+*/
+func writeMetadataFile(path string, data []byte, perm os.FileMode) (err error) {
+	dir := filepath.Dir(path)
+	lock, err := os.OpenFile(filepath.Join(dir, metadataDirLockName), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		// Report the metadata file rather than the lock file, e.g. if the
+		// directory does not exist
+		var pathErr *os.PathError
+		if errors.As(err, &pathErr) {
+			return &os.PathError{Op: pathErr.Op, Path: path, Err: pathErr.Err}
+		}
+		return err
+	}
+	defer lock.Close()
+	if err := lockFile(lock); err != nil {
+		return fmt.Errorf("failed to lock metadata directory %s: %w", dir, err)
+	}
+	defer func() {
+		if unlockErr := unlockFile(lock); err == nil {
+			err = unlockErr
+		}
+	}()
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	// Remove the temporary file, unless it was renamed to the path
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	if _, err := tmp.Write(data); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -1,9 +1,13 @@
 package in_toto
 
 import (
+	"bytes"
+	"fmt"
 	"os"
+	"path/filepath"
 	"reflect"
 	"sort"
+	"sync"
 	"testing"
 )
 
@@ -138,3 +142,63 @@ func TestIsWritable(t *testing.T) {
 		t.Errorf("%s should be writable, but it is not writable", writable)
 	}
 }
+
+func TestWriteMetadataFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "foo.link")
+
+	// Concurrent writers of the same file never interleave their contents
+	var wg sync.WaitGroup
+	contents := make([][]byte, 8)
+	for i := range contents {
+		contents[i] = bytes.Repeat([]byte(fmt.Sprintf("%d", i)), 1<<16)
+		wg.Add(1)
+		go func(data []byte) {
+			defer wg.Done()
+			if err := writeMetadataFile(path, data, 0644); err != nil {
+				t.Error(err)
+			}
+		}(contents[i])
+	}
+	wg.Wait()
+
+	written, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, data := range contents {
+		if bytes.Equal(written, data) {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("written file does not match the contents of any writer")
+	}
+
+	// Only the written file and the lock file remain in the directory
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	if !reflect.DeepEqual(names, []string{metadataDirLockName, "foo.link"}) {
+		t.Errorf("unexpected files in metadata directory: %s", names)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0644 {
+		t.Errorf("unexpected permissions %s", info.Mode().Perm())
+	}
+
+	if err := writeMetadataFile(filepath.Join(dir, "missing", "foo.link"), nil, 0644); err == nil {
+		t.Errorf("writing to a missing directory should fail")
+	}
+}
@@ -3,7 +3,11 @@
 
 package in_toto
 
-import "golang.org/x/sys/unix"
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
 
 func isWritable(path string) error {
 	err := unix.Access(path, unix.W_OK)
@@ -12,3 +16,13 @@ func isWritable(path string) error {
 	}
 	return nil
 }
+
+// lockFile blocks until it holds an exclusive advisory lock on the passed file.
+func lockFile(f *os.File) error {
+	return unix.Flock(int(f.Fd()), unix.LOCK_EX)
+}
+
+// unlockFile releases the lock acquired with lockFile.
+func unlockFile(f *os.File) error {
+	return unix.Flock(int(f.Fd()), unix.LOCK_UN)
+}
@@ -3,6 +3,8 @@ package in_toto
 import (
 	"errors"
 	"os"
+
+	"golang.org/x/sys/windows"
 )
 
 func isWritable(path string) error {
@@ -23,3 +25,15 @@ func isWritable(path string) error {
 	}
 	return nil
 }
+
+// lockFile blocks until it holds an exclusive lock on the first byte of the
+// passed file.
+func lockFile(f *os.File) error {
+	return windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK,
+		0, 1, 0, &windows.Overlapped{})
+}
+
+// unlockFile releases the lock acquired with lockFile.
+func unlockFile(f *os.File) error {
+	return windows.UnlockFileEx(windows.Handle(f.Fd()), 0, 1, 0, &windows.Overlapped{})
+}
@@ -0,0 +1,150 @@
+package in_toto
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"runtime/debug"
+
+	"github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/common"
+)
+
+// PredicateVerifierV01 is the predicate type of attestations that describe
+// the verifier that produced a verification result.
+const PredicateVerifierV01 = "https://in-toto.io/attestation/verifier/v0.1"
+
+// libraryModulePath is the module path used to look up the library version
+// in the build information of the running binary.
+const libraryModulePath = "github.com/in-toto/in-toto-golang"
+
+/*
+VerifierIdentity describes the verifier that produced a verification result:
+the version of this library, the digest of the verifier binary and the digest
+of the configuration the verifier was run with.
+*/
+type VerifierIdentity struct {
+	LibraryVersion string           `json:"libraryVersion"`
+	BinaryDigest   common.DigestSet `json:"binaryDigest,omitempty"`
+	ConfigDigest   common.DigestSet `json:"configDigest,omitempty"`
+}
+
+// VerifierResult summarizes the verification result the verifier attests to.
+type VerifierResult struct {
+	Layout string `json:"layout"`
+	Passed bool   `json:"passed"`
+	Time   string `json:"time"`
+}
+
+// VerifierPredicate is the predicate of a verifier self-attestation.
+type VerifierPredicate struct {
+	Verifier VerifierIdentity `json:"verifier"`
+	Result   VerifierResult   `json:"result"`
+}
+
+// VerifierStatement is the definition for an entire verifier self-attestation
+// statement.
+type VerifierStatement struct {
+	StatementHeader
+	Predicate VerifierPredicate `json:"predicate"`
+}
+
+/*
+getLibraryVersion returns the version of this library as recorded in the build
+information of the running binary, or "unknown" if it is not available.
+*/
+func getLibraryVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	if info.Main.Path == libraryModulePath {
+		return info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == libraryModulePath {
+			if dep.Replace != nil {
+				return dep.Replace.Version
+			}
+			return dep.Version
+		}
+	}
+	return "unknown"
+}
+
+/*
+NewVerifierIdentity creates a VerifierIdentity for the running binary.  It
+hashes the executable of the current process and the passed configuration,
+which may be any representation of the verifier configuration, e.g. the raw
+bytes of a config file.  If config is nil, no configuration digest is
+recorded.
+*/
+func NewVerifierIdentity(config []byte) (VerifierIdentity, error) {
+	identity := VerifierIdentity{LibraryVersion: getLibraryVersion()}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return VerifierIdentity{}, err
+	}
+	binary, err := os.Open(executable)
+	if err != nil {
+		return VerifierIdentity{}, err
+	}
+	defer binary.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, binary); err != nil {
+		return VerifierIdentity{}, err
+	}
+	identity.BinaryDigest = common.DigestSet{"sha256": hex.EncodeToString(h.Sum(nil))}
+
+	if config != nil {
+		configHash := sha256.Sum256(config)
+		identity.ConfigDigest = common.DigestSet{"sha256": hex.EncodeToString(configHash[:])}
+	}
+
+	return identity, nil
+}
+
+/*
+GenerateVerifierAttestation creates an attestation in which the verifier
+described by the passed identity attests to the passed verification report.
+The subject of the attestation is the report, identified by the digest of its
+canonical JSON representation.  The attestation is wrapped in a DSSE envelope
+and signed with the passed key.
+*/
+func GenerateVerifierAttestation(identity VerifierIdentity, report *VerificationReport, key Key) (*Envelope, error) {
+	if report == nil {
+		return nil, fmt.Errorf("verifier attestation requires a verification report")
+	}
+
+	reportCanonical, err := EncodeCanonical(report)
+	if err != nil {
+		return nil, err
+	}
+	reportHash := sha256.Sum256(reportCanonical)
+
+	statement := VerifierStatement{
+		StatementHeader: StatementHeader{
+			Type:          StatementInTotoV1,
+			PredicateType: PredicateVerifierV01,
+			Subject: []Subject{
+				{
+					Name:   report.Layout,
+					Digest: common.DigestSet{"sha256": hex.EncodeToString(reportHash[:])},
+				},
+			},
+		},
+		Predicate: VerifierPredicate{
+			Verifier: identity,
+			Result: VerifierResult{
+				Layout: report.Layout,
+				Passed: report.Passed,
+				Time:   report.Time,
+			},
+		},
+	}
+
+	return GenerateAttestation(statement, key)
+}
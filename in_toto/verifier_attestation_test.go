@@ -0,0 +1,66 @@
+package in_toto
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewVerifierIdentity(t *testing.T) {
+	identity, err := NewVerifierIdentity([]byte("config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotEmpty(t, identity.LibraryVersion)
+	assert.Len(t, identity.BinaryDigest["sha256"], 64)
+	assert.Equal(t, "b79606fb3afea5bd1609ed40b622142f1c98125abcfe89a76a661b0e8e343910", identity.ConfigDigest["sha256"])
+
+	identity, err = NewVerifierIdentity(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, identity.ConfigDigest)
+}
+
+func TestGenerateVerifierAttestation(t *testing.T) {
+	var privKey, pubKey Key
+	if err := privKey.LoadKeyDefaults("carol"); err != nil {
+		t.Fatal(err)
+	}
+	if err := pubKey.LoadKeyDefaults("carol.pub"); err != nil {
+		t.Fatal(err)
+	}
+
+	identity, err := NewVerifierIdentity([]byte("config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := NewVerificationReport("demo.layout", nil, nil)
+
+	env, err := GenerateVerifierAttestation(identity, report, privKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.VerifySignature(pubKey); err != nil {
+		t.Errorf("verifier attestation signature verification failed: %s", err)
+	}
+
+	payload, err := env.envelope.DecodeB64Payload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var statement VerifierStatement
+	if err := json.Unmarshal(payload, &statement); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, StatementInTotoV1, statement.Type)
+	assert.Equal(t, PredicateVerifierV01, statement.PredicateType)
+	assert.Equal(t, "demo.layout", statement.Subject[0].Name)
+	assert.Equal(t, identity, statement.Predicate.Verifier)
+	assert.True(t, statement.Predicate.Result.Passed)
+
+	if _, err := GenerateVerifierAttestation(identity, nil, privKey); err == nil {
+		t.Error("expected error for missing report")
+	}
+}
@@ -6,6 +6,7 @@ See https://github.com/in-toto/docs/blob/master/in-toto-spec.md
 package in_toto
 
 import (
+	"context"
 	"crypto/x509"
 	"errors"
 	"fmt"
@@ -24,13 +25,21 @@ var ErrInspectionRunDirIsSymlink = errors.New("runDir is a symlink. This is a se
 
 var ErrNotLayout = errors.New("verification workflow passed a non-layout")
 
+// ErrLayoutExpired is returned when the expiration date of a layout has
+// passed.
+var ErrLayoutExpired = errors.New("layout has expired")
+
 /*
 RunInspections iteratively executes the command in the Run field of all
 inspections of the passed layout, creating unsigned link metadata that records
 all files found in the current working directory as materials (before command
-execution) and products (after command execution).  A map with inspection names
-as keys and Metablocks containing the generated link metadata as values is
-returned.  The format is:
+execution) and products (after command execution).  Inspections that reference
+an artifact profile of the layout record their artifacts with the options of
+the profile, instead of the passed lineNormalization.  Inspections with a
+registered function, see RegisterInspection, call the function without step
+links, instead of executing their command.  A map with inspection
+names as keys and Metablocks containing the generated link metadata as values
+is returned.  The format is:
 
 	{
 		<inspection name> : Metablock,
@@ -43,7 +52,16 @@ non-zero exit code, the first return value is an empty Metablock map and the
 second return value is the error.
 */
 func RunInspections(layout Layout, runDir string, lineNormalization bool, useDSSE bool) (map[string]Metadata, error) {
+	return runInspections(context.Background(), layout, nil, lineNormalization, useDSSE, InspectionOptions{Dir: runDir})
+}
+
+// runInspections implements RunInspections, tracing each inspection as child
+// of the span in the passed context, and running inspections as constrained
+// by the passed options.  Registered inspection functions are passed the
+// passed step links.
+func runInspections(ctx context.Context, layout Layout, stepsMetadata map[string]Metadata, lineNormalization bool, useDSSE bool, opts InspectionOptions) (map[string]Metadata, error) {
 	inspectionMetadata := make(map[string]Metadata)
+	runDir := opts.Dir
 
 	for _, inspection := range layout.Inspect {
 
@@ -52,18 +70,48 @@ func RunInspections(layout Layout, runDir string, lineNormalization bool, useDSS
 			paths = []string{runDir}
 		}
 
-		linkEnv, err := InTotoRun(inspection.Name, runDir, paths, paths,
-			inspection.Run, Key{}, []string{"sha256"}, nil, nil, lineNormalization, false, useDSSE)
+		// Inspections that reference an artifact profile record their artifacts
+		// like the steps using the same profile
+		profile := ArtifactProfile{LineNormalization: lineNormalization}
+		if inspection.ArtifactProfile != "" {
+			var err error
+			profile, err = ResolveArtifactProfile(layout.ArtifactProfiles, inspection.ArtifactProfile)
+			if err != nil {
+				return nil, err
+			}
+		}
 
+		inspectionCtx, cancel := context.WithCancel(ctx)
+		if opts.Timeout > 0 {
+			inspectionCtx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		}
+		// Inspections with a registered function are implemented natively,
+		// instead of by their command
+		f, native := getInspectionFunc(inspection.Name)
+		var linkEnv Metadata
+		var err error
+		if native {
+			linkEnv, err = runInspectionFunc(inspectionCtx, f, inspection, stepsMetadata, useDSSE)
+		} else {
+			linkEnv, err = inTotoRun(inspectionCtx, inspection.Name, runDir, paths, paths, nil,
+				inspection.Run, Key{}, profile.GetHashAlgorithms(), profile,
+				commandOptions{env: opts.Env, executor: opts.Executor}, useDSSE)
+		}
+		timedOut := errors.Is(inspectionCtx.Err(), context.DeadlineExceeded)
+		cancel()
+		if timedOut {
+			return nil, fmt.Errorf("%w: inspection '%s' did not finish within %s",
+				ErrInspectionTimeout, inspection.Name, opts.Timeout)
+		}
 		if err != nil {
 			return nil, err
 		}
 
-		retVal := linkEnv.GetPayload().(Link).ByProducts["return-value"]
-		if retVal != float64(0) {
+		byProducts := linkEnv.GetPayload().(Link).ByProducts
+		if retVal, ok := byProducts.ReturnValue(); !native && (!ok || retVal != 0) {
 			return nil, fmt.Errorf("inspection command '%s' of inspection '%s'"+
-				" returned a non-zero value: %d", inspection.Run, inspection.Name,
-				retVal)
+				" returned a non-zero value: %v", inspection.Run, inspection.Name,
+				byProducts[ReturnValueByproductKey])
 		}
 
 		// Dump inspection link to cwd using the short link name format
@@ -77,81 +125,128 @@ func RunInspections(layout Layout, runDir string, lineNormalization bool, useDSS
 	return inspectionMetadata, nil
 }
 
+// trimArtifactPrefix removes the passed prefix from the passed artifact path,
+// if the path has the prefix, optionally comparing case-insensitively.
+func trimArtifactPrefix(artifactPath string, prefix string, caseInsensitive bool) string {
+	if caseInsensitive && len(artifactPath) >= len(prefix) &&
+		strings.EqualFold(artifactPath[:len(prefix)], prefix) {
+		return artifactPath[len(prefix):]
+	}
+	return strings.TrimPrefix(artifactPath, prefix)
+}
+
+// lookupArtifact returns the artifact with the passed path, preferring an
+// exact match over a case-insensitive one, if caseInsensitive is true.
+func lookupArtifact(artifacts map[string]HashObj, artifactPath string, caseInsensitive bool) (HashObj, bool) {
+	if artifact, exists := artifacts[artifactPath]; exists || !caseInsensitive {
+		return artifact, exists
+	}
+	for name, artifact := range artifacts {
+		if strings.EqualFold(name, artifactPath) {
+			return artifact, true
+		}
+	}
+	return nil, false
+}
+
+/*
+lookupCleanArtifact returns the artifact with the passed cleaned path, like
+lookupArtifact.  Artifacts recorded with paths that are not clean, e.g.
+'./foo', are looked up in the passed artifacts by cleaned path, which are
+computed only once and only if needed.
+*/
+func lookupCleanArtifact(artifacts map[string]HashObj, cleanArtifacts *map[string]HashObj,
+	artifactPath string, caseInsensitive bool) (HashObj, bool) {
+	if artifact, exists := lookupArtifact(artifacts, artifactPath, caseInsensitive); exists {
+		return artifact, true
+	}
+	if *cleanArtifacts == nil {
+		*cleanArtifacts = make(map[string]HashObj, len(artifacts))
+		for k, artifact := range artifacts {
+			(*cleanArtifacts)[path.Clean(k)] = artifact
+		}
+	}
+	return lookupArtifact(*cleanArtifacts, artifactPath, caseInsensitive)
+}
+
 // verifyMatchRule is a helper function to process artifact rules of
-// type MATCH. See VerifyArtifacts for more details.
-func verifyMatchRule(ruleData map[string]string,
-	srcArtifacts map[string]HashObj, srcArtifactQueue Set,
-	itemsMetadata map[string]Metadata) Set {
+// type MATCH, with the passed index of the source artifacts. See
+// VerifyArtifacts for more details.
+func verifyMatchRule(rule ArtifactRule,
+	srcArtifacts map[string]HashObj, srcArtifactQueue Set, srcIndex artifactIndex,
+	itemsMetadata map[string]Metadata, m artifactMatcher, log Logger) Set {
 	consumed := NewSet()
 	// Get destination link metadata
-	dstLinkEnv, exists := itemsMetadata[ruleData["dstName"]]
+	dstLinkEnv, exists := itemsMetadata[rule.DstName]
 	if !exists {
 		// Destination link does not exist, rule can't consume any
 		// artifacts
+		logDebug(log, "MATCH rule destination not found", "destination", rule.DstName)
 		return consumed
 	}
 
 	// Get artifacts from destination link metadata
 	var dstArtifacts map[string]HashObj
-	switch ruleData["dstType"] {
+	switch rule.DstType {
 	case "materials":
 		dstArtifacts = dstLinkEnv.GetPayload().(Link).Materials
 	case "products":
 		dstArtifacts = dstLinkEnv.GetPayload().(Link).Products
 	}
 
-	// cleanup paths in pattern and artifact maps
-	if ruleData["pattern"] != "" {
-		ruleData["pattern"] = path.Clean(ruleData["pattern"])
-	}
-	for k := range srcArtifacts {
-		if path.Clean(k) != k {
-			srcArtifacts[path.Clean(k)] = srcArtifacts[k]
-			delete(srcArtifacts, k)
-		}
-	}
-	for k := range dstArtifacts {
-		if path.Clean(k) != k {
-			dstArtifacts[path.Clean(k)] = dstArtifacts[k]
-			delete(dstArtifacts, k)
-		}
+	// cleanup paths in pattern, artifacts are looked up by cleaned path, see
+	// lookupCleanArtifact
+	if rule.Pattern != "" {
+		rule.Pattern = path.Clean(rule.Pattern)
 	}
+	var cleanSrcArtifacts, cleanDstArtifacts map[string]HashObj
 
 	// Normalize optional source and destination prefixes, i.e. if
 	// there is a prefix, then add a trailing slash if not there yet
-	for _, prefix := range []string{"srcPrefix", "dstPrefix"} {
-		if ruleData[prefix] != "" {
-			ruleData[prefix] = path.Clean(ruleData[prefix])
-			if !strings.HasSuffix(ruleData[prefix], "/") {
-				ruleData[prefix] += "/"
+	for _, prefix := range []*string{&rule.SrcPrefix, &rule.DstPrefix} {
+		if *prefix != "" {
+			*prefix = path.Clean(*prefix)
+			if !strings.HasSuffix(*prefix, "/") {
+				*prefix += "/"
 			}
 		}
 	}
-	// Iterate over queue and mark consumed artifacts
-	for srcPath := range srcArtifactQueue {
+	// Iterate over queued artifacts, which may match the rule pattern, and
+	// mark consumed artifacts
+	for _, srcPath := range srcIndex.withTrimmedPrefix(rule.SrcPrefix, rule.Pattern) {
+		if !srcArtifactQueue.Has(srcPath) {
+			continue
+		}
+
 		// Remove optional source prefix from source artifact path
 		// Noop if prefix is empty, or artifact does not have it
-		srcBasePath := strings.TrimPrefix(srcPath, ruleData["srcPrefix"])
+		srcBasePath := trimArtifactPrefix(srcPath, rule.SrcPrefix, m.caseInsensitive)
 
 		// Ignore artifacts not matched by rule pattern
-		matched, err := match(ruleData["pattern"], srcBasePath)
+		matched, err := m.match(rule.Pattern, srcBasePath)
 		if err != nil || !matched {
 			continue
 		}
 
 		// Construct corresponding destination artifact path, i.e.
 		// an optional destination prefix plus the source base path
-		dstPath := path.Clean(path.Join(ruleData["dstPrefix"], srcBasePath))
+		dstPath := path.Clean(path.Join(rule.DstPrefix, srcBasePath))
 
 		// Try to find the corresponding destination artifact
-		dstArtifact, exists := dstArtifacts[dstPath]
+		dstArtifact, exists := lookupCleanArtifact(dstArtifacts, &cleanDstArtifacts, dstPath, m.caseInsensitive)
 		// Ignore artifacts without corresponding destination artifact
 		if !exists {
+			logDebug(log, "MATCH rule found no destination artifact", "artifact", srcPath,
+				"destination", rule.DstName, "destination_type", rule.DstType, "destination_artifact", dstPath)
 			continue
 		}
 
 		// Ignore artifact pairs with no matching hashes
-		if !reflect.DeepEqual(srcArtifacts[srcPath], dstArtifact) {
+		srcArtifact, _ := lookupCleanArtifact(srcArtifacts, &cleanSrcArtifacts, srcPath, false)
+		if !hashObjsEqual(srcArtifact, dstArtifact) {
+			logDebug(log, "MATCH rule found different destination artifact hashes", "artifact", srcPath,
+				"destination", rule.DstName, "destination_type", rule.DstType, "destination_artifact", dstPath,
+				"hashes", srcArtifact, "destination_hashes", dstArtifact)
 			continue
 		}
 
@@ -163,6 +258,23 @@ func verifyMatchRule(ruleData map[string]string,
 	return consumed
 }
 
+// queueHasArtifact returns true if the passed queue contains the passed artifact
+// path, optionally comparing case-insensitively.
+func queueHasArtifact(queue Set, artifactPath string, caseInsensitive bool) bool {
+	if queue.Has(artifactPath) {
+		return true
+	}
+	if !caseInsensitive {
+		return false
+	}
+	for name := range queue {
+		if strings.EqualFold(name, artifactPath) {
+			return true
+		}
+	}
+	return false
+}
+
 /*
 VerifyArtifacts iteratively applies the material and product rules of the
 passed items (step or inspection) to enforce and authorize artifacts (materials
@@ -182,22 +294,51 @@ that should have been consumed by preceding rules.
 */
 func VerifyArtifacts(items []interface{},
 	itemsMetadata map[string]Metadata) error {
+	return verifyArtifacts(context.Background(), items, itemsMetadata, artifactMatcher{}, nil, nil)
+}
+
+/*
+verifyArtifacts implements VerifyArtifacts, tracing the rule evaluation of
+each item as child of the span in the passed context.  If onConsume is not
+nil, it is called for each rule that consumes artifacts, with the name of the
+item, the type of the consumed artifacts, i.e. "materials" or "products", the
+rule and the consumed artifacts.  Rule patterns are matched with the passed
+artifactMatcher, see Layout.PatternSyntax and ArtifactMatchingCaseInsensitive.
+Items whose names are in the passed skip set are not verified, e.g. items
+reused from a previous verification, but keep their index, so that errors are
+located at the rules of the passed items, see PointerError.
+*/
+func verifyArtifacts(ctx context.Context, items []interface{}, itemsMetadata map[string]Metadata,
+	m artifactMatcher, skip Set, onConsume func(itemName string, srcType string, rule []string, consumed Set)) (err error) {
+	// The stage of the item currently verified, it is ended with the error
+	// that aborts verification, if any
+	var itemStage *progressStage
+	log := loggerFromContext(ctx)
+	defer func() {
+		if itemStage != nil {
+			itemStage.end(err)
+		}
+	}()
+
 	// Verify artifact rules for each item in the layout
-	for _, itemI := range items {
+	for i, itemI := range items {
 		// The layout item (interface) must be a Link or an Inspection we are only
 		// interested in the name and the expected materials and products
 		var itemName string
+		var itemsField string
 		var expectedMaterials [][]string
 		var expectedProducts [][]string
 
 		switch item := itemI.(type) {
 		case Step:
 			itemName = item.Name
+			itemsField = "steps"
 			expectedMaterials = item.ExpectedMaterials
 			expectedProducts = item.ExpectedProducts
 
 		case Inspection:
 			itemName = item.Name
+			itemsField = "inspect"
 			expectedMaterials = item.ExpectedMaterials
 			expectedProducts = item.ExpectedProducts
 
@@ -206,12 +347,18 @@ func VerifyArtifacts(items []interface{},
 				" elements of passed slice 'items' must be one of 'Step' or"+
 				" 'Inspection', got: '%s'", reflect.TypeOf(item))
 		}
+		if skip.Has(itemName) {
+			continue
+		}
+
+		_, itemStage = startStage(ctx, "in_toto.VerifyArtifacts", itemName)
+		itemStage.span.SetAttribute("in_toto.item", itemName)
 
 		// Use the item's name to extract the corresponding link
 		srcLinkEnv, exists := itemsMetadata[itemName]
 		if !exists {
-			return fmt.Errorf("VerifyArtifacts could not find metadata"+
-				" for item '%s', got: '%s'", itemName, itemsMetadata)
+			return fmt.Errorf("%w: VerifyArtifacts could not find metadata"+
+				" for item '%s', got: '%s'", ErrNoLinks, itemName, itemsMetadata)
 		}
 
 		// Create shortcuts to materials and products (including hashes) reported
@@ -239,7 +386,7 @@ func VerifyArtifacts(items []interface{},
 		remained := materialPaths.Intersection(productPaths)
 		modified := NewSet()
 		for name := range remained {
-			if !reflect.DeepEqual(materials[name], products[name]) {
+			if !hashObjsEqual(materials[name], products[name]) {
 				modified.Add(name)
 			}
 		}
@@ -249,28 +396,27 @@ func VerifyArtifacts(items []interface{},
 		verificationDataList := []map[string]interface{}{
 			{
 				"srcType":       "materials",
+				"rulesField":    "expected_materials",
 				"rules":         expectedMaterials,
 				"artifacts":     materials,
 				"artifactPaths": materialPaths,
+				"index":         newArtifactIndex(materialPaths, m),
 			},
 			{
 				"srcType":       "products",
+				"rulesField":    "expected_products",
 				"rules":         expectedProducts,
 				"artifacts":     products,
 				"artifactPaths": productPaths,
+				"index":         newArtifactIndex(productPaths, m),
 			},
 		}
-		// TODO: Add logging library (see in-toto/in-toto-golang#4)
-		// fmt.Printf("Verifying %s '%s' ", reflect.TypeOf(itemI), itemName)
-
 		// Process all material rules using the corresponding materials and all
 		// product rules using the corresponding products
 		for _, verificationData := range verificationDataList {
-			// TODO: Add logging library (see in-toto/in-toto-golang#4)
-			// fmt.Printf("%s...\n", verificationData["srcType"])
-
 			rules := verificationData["rules"].([][]string)
 			artifacts := verificationData["artifacts"].(map[string]HashObj)
+			index := verificationData["index"].(artifactIndex)
 
 			// Use artifacts (without hashes) as base queue. Each rule only operates
 			// on artifacts in that queue.  If a rule consumes an artifact (i.e. can
@@ -278,30 +424,37 @@ func VerifyArtifacts(items []interface{},
 			// applying a DISALLOW rule eventually, verification may return an error,
 			// if the rule matches any artifacts in the queue that should have been
 			// consumed earlier.
-			queue := verificationData["artifactPaths"].(Set)
+			queue := NewSet(verificationData["artifactPaths"].(Set).Slice()...)
 
-			// TODO: Add logging library (see in-toto/in-toto-golang#4)
-			// fmt.Printf("Initial state\nMaterials: %s\nProducts: %s\nQueue: %s\n\n",
-			// 	materialPaths.Slice(), productPaths.Slice(), queue.Slice())
+			if log != nil {
+				log.Debug("verifying artifact rules", "item", itemName, "type", verificationData["srcType"],
+					"queue", queue.sortedSlice())
+			}
 
-			// Verify rules sequentially
-			for _, rule := range rules {
+			// Verify rules sequentially, locating errors at the failing rule
+			for j, rule := range rules {
+				rulePointer := []interface{}{itemsField, i, verificationData["rulesField"], j}
 				// Parse rule and error out if it is malformed
 				// NOTE: the rule format should have been validated before
-				ruleData, err := UnpackRule(rule)
+				parsedRule, err := parseArtifactRule(rule)
 				if err != nil {
-					return err
+					return atPointer(err, rulePointer, "")
 				}
 
 				// Apply rule pattern to filter queued artifacts that are up for rule
-				// specific consumption
-				filtered := queue.Filter(path.Clean(ruleData["pattern"]))
+				// specific consumption, only for the rules that consume or disallow
+				// them
+				var filtered Set
+				switch parsedRule.Type {
+				case "allow", "create", "delete", "modify", "disallow":
+					filtered = index.filter(queue, path.Clean(parsedRule.Pattern))
+				}
 
 				var consumed Set
-				switch ruleData["type"] {
+				switch parsedRule.Type {
 				case "match":
 					// Note: here we need to perform more elaborate filtering
-					consumed = verifyMatchRule(ruleData, artifacts, queue, itemsMetadata)
+					consumed = verifyMatchRule(parsedRule, artifacts, queue, index, itemsMetadata, m, log)
 
 				case "allow":
 					// Consumes all filtered artifacts
@@ -322,34 +475,91 @@ func VerifyArtifacts(items []interface{},
 				case "disallow":
 					// Does not consume but errors out if artifacts were filtered
 					if len(filtered) > 0 {
-						return fmt.Errorf("artifact verification failed for %s '%s',"+
-							" %s %s disallowed by rule %s",
-							reflect.TypeOf(itemI).Name(), itemName,
-							verificationData["srcType"], filtered.Slice(), rule)
+						return atPointer(&RuleViolationError{
+							Step:         itemName,
+							ItemType:     reflect.TypeOf(itemI).Name(),
+							ArtifactType: verificationData["srcType"].(string),
+							Rule:         rule,
+							Artifacts:    filtered.Slice(),
+						}, rulePointer, "")
 					}
 				case "require":
 					// REQUIRE is somewhat of a weird animal that does not use
 					// patterns bur rather single filenames (for now).
-					if !queue.Has(ruleData["pattern"]) {
-						return fmt.Errorf("artifact verification failed for %s in REQUIRE '%s',"+
-							" because %s is not in %s", verificationData["srcType"],
-							ruleData["pattern"], ruleData["pattern"], queue.Slice())
+					if !queueHasArtifact(queue, parsedRule.Pattern, m.caseInsensitive) {
+						return atPointer(&RuleViolationError{
+							Step:         itemName,
+							ItemType:     reflect.TypeOf(itemI).Name(),
+							ArtifactType: verificationData["srcType"].(string),
+							Rule:         rule,
+							Artifacts:    []string{parsedRule.Pattern},
+						}, rulePointer, "")
+					}
+				case "absent":
+					// Does not consume but errors out if any artifact matches, not
+					// only queued ones.  Products may be recorded selectively, hence
+					// the link must also assert that no product matched the pattern
+					// after the step.
+					present := index.filter(verificationData["artifactPaths"].(Set), path.Clean(parsedRule.Pattern))
+					if len(present) > 0 {
+						return atPointer(&RuleViolationError{
+							Step:         itemName,
+							ItemType:     reflect.TypeOf(itemI).Name(),
+							ArtifactType: verificationData["srcType"].(string),
+							Rule:         rule,
+							Artifacts:    present.Slice(),
+						}, rulePointer, "")
+					}
+					if verificationData["srcType"] == "products" &&
+						!linkAssertsAbsent(srcLinkEnv.GetPayload().(Link), parsedRule.Pattern) {
+						return atPointer(&RuleViolationError{
+							Step:         itemName,
+							ItemType:     reflect.TypeOf(itemI).Name(),
+							ArtifactType: verificationData["srcType"].(string),
+							Rule:         rule,
+						}, rulePointer, "")
 					}
 				}
 				// Update queue by removing consumed artifacts
-				queue = queue.Difference(consumed)
-				// TODO: Add logging library (see in-toto/in-toto-golang#4)
-				// fmt.Printf("Rule: %s\nQueue: %s\n\n", rule, queue.Slice())
+				if onConsume != nil && len(consumed) > 0 {
+					onConsume(itemName, verificationData["srcType"].(string), rule, consumed.Intersection(queue))
+				}
+				if log != nil {
+					log.Debug("applied artifact rule", "item", itemName, "type", verificationData["srcType"],
+						"rule", strings.Join(rule, " "), "consumed", consumed.Intersection(queue).sortedSlice())
+				}
+				for artifactPath := range consumed {
+					queue.Remove(artifactPath)
+				}
+			}
+			if log != nil && len(queue) > 0 {
+				log.Debug("artifacts not consumed by any rule", "item", itemName, "type", verificationData["srcType"],
+					"queue", queue.sortedSlice())
 			}
 		}
+		itemStage.end(nil)
+		itemStage = nil
 	}
 	return nil
 }
 
+// linkAssertsAbsent returns true if the passed link asserts that no product
+// matched the passed pattern, see Link.AbsentProducts.
+func linkAssertsAbsent(link Link, pattern string) bool {
+	for _, absent := range link.AbsentProducts {
+		if path.Clean(absent) == path.Clean(pattern) {
+			return true
+		}
+	}
+	return false
+}
+
 /*
 ReduceStepsMetadata merges for each step of the passed Layout all the passed
 per-functionary links into a single link, asserting that the reported Materials
-and Products are equal across links for a given step.  This function may be
+and Products are equal across links for a given step.  Artifacts are compared
+after normalizing names and digests, and on the hash algorithms recorded by
+both links, so that links recorded with different tools agree.  This function may be
 used at a time during the overall verification, where link threshold's have
 been verified and subsequent verification only needs one exemplary link per
 step.  The function returns a map with one Metablock (link) per step:
@@ -362,7 +572,7 @@ step.  The function returns a map with one Metablock (link) per step:
 
 If links corresponding to the same step report different Materials or different
 Products, the first return value is an empty Metablock map and the second
-return value is the error.
+return value is an ErrLinkArtifactMismatch.
 */
 func ReduceStepsMetadata(layout Layout,
 	stepsMetadata map[string]map[string]Metadata) (map[string]Metadata,
@@ -377,40 +587,23 @@ func ReduceStepsMetadata(layout Layout,
 				"', no link metadata found.")
 		}
 
-		// Get the first link (could be any link) for the current step, which will
-		// serve as reference link for below comparisons
-		var referenceKeyID string
-		var referenceLinkEnv Metadata
-		for keyID, linkEnv := range linksPerStep {
-			referenceLinkEnv = linkEnv
-			referenceKeyID = keyID
-			break
-		}
-
-		// Only one link, nothing to reduce, take the reference link
-		if len(linksPerStep) == 1 {
-			stepsMetadataReduced[step.Name] = referenceLinkEnv
-
-			// Multiple links, reduce but first check
-		} else {
-			// Artifact maps must be equal for each type among all links
-			// TODO: What should we do if there are more links, than the
-			// threshold requires, but not all of them are equal? Right now we would
-			// also error.
-			for keyID, linkEnv := range linksPerStep {
-				if !reflect.DeepEqual(linkEnv.GetPayload().(Link).Materials,
-					referenceLinkEnv.GetPayload().(Link).Materials) ||
-					!reflect.DeepEqual(linkEnv.GetPayload().(Link).Products,
-						referenceLinkEnv.GetPayload().(Link).Products) {
-					return nil, fmt.Errorf("link '%s' and '%s' have different"+
-						" artifacts",
-						fmt.Sprintf(LinkNameFormat, step.Name, referenceKeyID),
-						fmt.Sprintf(LinkNameFormat, step.Name, keyID))
-				}
+		// Links of distinct functionaries must record the same artifacts, see
+		// artifactsEqual.  The link of the lowest key id serves as reference
+		// link and is taken as the reduced link.
+		keyIDs := sortedKeyIDs(linksPerStep)
+		referenceKeyID := keyIDs[0]
+		referenceLink := linksPerStep[referenceKeyID].GetPayload().(Link)
+		for _, keyID := range keyIDs[1:] {
+			link := linksPerStep[keyID].GetPayload().(Link)
+			if !artifactsEqual(link.Materials, referenceLink.Materials) ||
+				!artifactsEqual(link.Products, referenceLink.Products) {
+				return nil, fmt.Errorf("%w: step '%s': link '%s' and '%s'",
+					ErrLinkArtifactMismatch, step.Name,
+					fmt.Sprintf(LinkNameFormat, step.Name, referenceKeyID),
+					fmt.Sprintf(LinkNameFormat, step.Name, keyID))
 			}
-			// We haven't errored out, so we can reduce (i.e take the reference link)
-			stepsMetadataReduced[step.Name] = referenceLinkEnv
 		}
+		stepsMetadataReduced[step.Name] = linksPerStep[referenceKeyID]
 	}
 	return stepsMetadataReduced, nil
 }
@@ -418,8 +611,10 @@ func ReduceStepsMetadata(layout Layout,
 /*
 VerifyStepCommandAlignment (soft) verifies that for each step of the passed
 layout the command executed, as per the passed link, matches the expected
-command, as per the layout.  Soft verification means that, in case a command
-does not align, a warning is issued.
+command, as per the layout.  Commands are compared argument by argument.  Soft
+verification means that, in case a command does not align, a warning is
+issued.  A warning is also issued for expected commands that pass arguments
+with shell metacharacters to a shell, see AnalyzeCommandShellSafety.
 */
 func VerifyStepCommandAlignment(layout Layout,
 	stepsMetadata map[string]map[string]Metadata) {
@@ -431,11 +626,16 @@ func VerifyStepCommandAlignment(layout Layout,
 				"', no link metadata found.")
 		}
 
-		for signerKeyID, linkEnv := range linksPerStep {
-			expectedCommandS := strings.Join(step.ExpectedCommand, " ")
-			executedCommandS := strings.Join(linkEnv.GetPayload().(Link).Command, " ")
+		for _, risk := range AnalyzeCommandShellSafety(step.ExpectedCommand) {
+			fmt.Printf("WARNING: Expected command for step '%s' runs a shell,"+
+				" %s.\n", step.Name, risk)
+		}
 
-			if expectedCommandS != executedCommandS {
+		for signerKeyID, linkEnv := range linksPerStep {
+			executedCommand := linkEnv.GetPayload().(Link).Command
+			if !CommandsEqual(step.ExpectedCommand, executedCommand) {
+				expectedCommandS := strings.Join(step.ExpectedCommand, " ")
+				executedCommandS := strings.Join(executedCommand, " ")
 				linkName := fmt.Sprintf(LinkNameFormat, step.Name, signerKeyID)
 				fmt.Printf("WARNING: Expected command for step '%s' (%s) and command"+
 					" reported by '%s' (%s) differ.\n",
@@ -500,11 +700,29 @@ links with valid signatures from distinct functionaries and has the format:
 
 If for any step of the layout there are not enough links available, the first
 return value is an empty map of Metablock maps and the second return value is
-the error.
+a ThresholdError.
 */
 func VerifyLinkSignatureThesholds(layout Layout,
 	stepsMetadata map[string]map[string]Metadata, rootCertPool, intermediateCertPool *x509.CertPool) (
 	map[string]map[string]Metadata, error) {
+	return verifyLinkSignatureThresholds(layout, stepsMetadata, rootCertPool, intermediateCertPool, time.Time{}, 0, nil, nil,
+		loggerFromContext(context.Background()))
+}
+
+/*
+verifyLinkSignatureThresholds is like VerifyLinkSignatureThesholds, but
+verifies the certificates of link signers at the passed time with the passed
+clock skew tolerance, see VerifyCertificateTrustAt, and canonicalizes links
+with the passed memo.  If timestamps is not nil, only links with signatures
+that carry a timestamp are counted, see linkTimestamps, and certificates are
+verified at the timestamped time instead.  Likewise, links signed with
+functionary keys, which are revoked or not valid at the passed or timestamped
+time, are not counted, see KeyValidity.  Signature checks are logged to the
+passed Logger, if not nil.
+*/
+func verifyLinkSignatureThresholds(layout Layout,
+	stepsMetadata map[string]map[string]Metadata, rootCertPool, intermediateCertPool *x509.CertPool,
+	now time.Time, clockSkew time.Duration, memo *signableMemo, timestamps *linkTimestamps, log Logger) (map[string]map[string]Metadata, error) {
 	// This will stores links with valid signature from an authorized functionary
 	// for all steps
 	stepsMetadataVerified := make(map[string]map[string]Metadata)
@@ -521,26 +739,46 @@ func VerifyLinkSignatureThesholds(layout Layout,
 		// Check if there are any links at all for the given step
 		linksPerStep, ok := stepsMetadata[step.Name]
 		if !ok || len(linksPerStep) < 1 {
-			stepErr = fmt.Errorf("no links found")
+			stepErr = ErrNoLinks
 		}
 
 		// For each link corresponding to a step, check that the signer key was
 		// authorized, the layout contains a verification key and the signature
 		// verification passes.  Only good links are stored, to verify thresholds
 		// below.
-		isAuthorizedSignature := false
 		for signerKeyID, linkEnv := range linksPerStep {
+			isAuthorizedSignature := false
+			var keyErr error
 			for _, authorizedKeyID := range step.PubKeys {
-				if signerKeyID == authorizedKeyID {
-					if verifierKey, ok := layout.Keys[authorizedKeyID]; ok {
-						if err := linkEnv.VerifySignature(verifierKey); err == nil {
-							linksPerStepVerified[signerKeyID] = linkEnv
-							isAuthorizedSignature = true
+				// GPG links may be signed by a subkey of an authorized key
+				if verifierKey, ok := layout.Keys[authorizedKeyID]; ok && keyHasID(verifierKey, signerKeyID) {
+					err := memo.verifySignature(linkEnv, verifierKey)
+					logDebug(log, "verified link signature", "step", step.Name, "keyid", signerKeyID,
+						"authorized_keyid", authorizedKeyID, "error", err)
+					if err == nil {
+						// Keys must have been valid when the link was signed,
+						// which is only known for timestamped signatures
+						signedAt := now
+						if timestamps != nil {
+							if signedAt, keyErr = timestamps.verify(linkEnv, signerKeyID, verifierKey); keyErr != nil {
+								break
+							}
+						}
+						if keyErr = layout.checkKeyValidity(authorizedKeyID, signedAt, clockSkew); keyErr != nil {
+							logDebug(log, "functionary key not accepted", "step", step.Name, "keyid", authorizedKeyID,
+								"error", keyErr)
 							break
 						}
+						linksPerStepVerified[authorizedKeyID] = linkEnv
+						isAuthorizedSignature = true
+						break
 					}
 				}
 			}
+			if keyErr != nil {
+				stepErr = keyErr
+				continue
+			}
 
 			// If the signer's key wasn't in our step's pubkeys array, check the cert pool to
 			// see if the key is known to us.
@@ -557,14 +795,29 @@ func VerifyLinkSignatureThesholds(layout Layout,
 					continue
 				}
 
+				// Certificates of timestamped signatures must have been valid
+				// when the link was signed, instead of now
+				certTime := now
+				if timestamps != nil {
+					certTime, err = timestamps.verify(linkEnv, signerKeyID, cert)
+					if err != nil {
+						stepErr = err
+						continue
+					}
+				}
+
 				// test certificate against the step's constraints to make sure it's a valid functionary
-				err = step.CheckCertConstraints(cert, layout.RootCAIDs(), rootCertPool, intermediateCertPool)
+				err = step.checkCertConstraintsAt(cert, layout.RootCAIDs(), rootCertPool, intermediateCertPool, certTime, clockSkew)
 				if err != nil {
+					logDebug(log, "certificate does not meet constraints", "step", step.Name, "keyid", signerKeyID,
+						"error", err)
 					stepErr = err
 					continue
 				}
 
-				err = linkEnv.VerifySignature(cert)
+				err = memo.verifySignature(linkEnv, cert)
+				logDebug(log, "verified link signature with certificate", "step", step.Name, "keyid", signerKeyID,
+					"error", err)
 				if err != nil {
 					stepErr = err
 					continue
@@ -576,13 +829,17 @@ func VerifyLinkSignatureThesholds(layout Layout,
 
 		// Store all good links for a step
 		stepsMetadataVerified[step.Name] = linksPerStepVerified
+		logDebug(log, "verified link signature threshold", "step", step.Name, "threshold", step.Threshold,
+			"verified", len(linksPerStepVerified), "available", len(linksPerStep))
 
 		if len(linksPerStepVerified) < step.Threshold {
-			linksPerStep := stepsMetadata[step.Name]
-			return nil, fmt.Errorf("step '%s' requires '%d' link metadata file(s)."+
-				" '%d' out of '%d' available link(s) have a valid signature from an"+
-				" authorized signer: %v", step.Name, step.Threshold,
-				len(linksPerStepVerified), len(linksPerStep), stepErr)
+			return nil, &ThresholdError{
+				StepName:  step.Name,
+				Threshold: step.Threshold,
+				Verified:  len(linksPerStepVerified),
+				Available: len(linksPerStep),
+				Err:       stepErr,
+			}
 		}
 	}
 	return stepsMetadataVerified, nil
@@ -613,12 +870,79 @@ format:
 If a link cannot be loaded at a constructed link name or is invalid, it is
 ignored. Only a preliminary threshold check is performed, that is, if there
 aren't at least Threshold links for any given step, the first return value
-is an empty map of Metablock maps and the second return value is the error.
+is an empty map of Metablock maps and the second return value is a
+MissingEvidenceError, which lists all such steps.
+
+For steps referencing their sublayout by URI, see SublayoutReference, the
+sublayout is fetched with a URIFetcher, resolving relative URIs in linkDir.
+If fetching fails or the sublayout does not match the pinned digest, an error
+is returned.
+
+For steps referencing a signed git commit or tag, see GitReference, the object
+is loaded from the git repository in the current working directory, by the key
+ids of its signers.  If it cannot be loaded an error is returned.
 */
 func LoadLinksForLayout(layout Layout, linkDir string) (map[string]map[string]Metadata, error) {
+	return loadLinksForLayout(context.Background(), layout, linkDir, verifyOptions{})
+}
+
+// loadLinksForLayout implements LoadLinksForLayout, fetching referenced
+// sublayouts with the fetcher of the passed options, or a URIFetcher if nil,
+// loading referenced git objects from the git repository of the options, and
+// links from the link store of the options, if not nil, instead of linkDir.
+func loadLinksForLayout(ctx context.Context, layout Layout, linkDir string, opts verifyOptions) (map[string]map[string]Metadata, error) {
+	fetcher := opts.fetcher
+	if fetcher == nil {
+		fetcher = &URIFetcher{BaseDir: linkDir}
+	}
 	stepsMetadata := make(map[string]map[string]Metadata)
+	var missing []*ThresholdError
 
 	for _, step := range layout.Steps {
+		if step.Sublayout != nil {
+			linksPerStep, err := fetchSublayout(ctx, step, fetcher)
+			if err != nil {
+				return nil, err
+			}
+			if len(linksPerStep) < step.Threshold {
+				missing = append(missing, &ThresholdError{StepName: step.Name, Threshold: step.Threshold,
+					Available: len(linksPerStep), Verified: len(linksPerStep),
+					Err: errors.New("not enough sublayout signatures")})
+				continue
+			}
+			stepsMetadata[step.Name] = linksPerStep
+			continue
+		}
+
+		if step.Git != nil {
+			linksPerStep, err := loadGitEvidence(ctx, step, layout.Keys, opts.gitDir)
+			if err != nil {
+				return nil, err
+			}
+			if len(linksPerStep) < step.Threshold {
+				missing = append(missing, &ThresholdError{StepName: step.Name, Threshold: step.Threshold,
+					Available: len(linksPerStep), Verified: len(linksPerStep),
+					Err: errors.New("not enough git signatures")})
+				continue
+			}
+			stepsMetadata[step.Name] = linksPerStep
+			continue
+		}
+
+		if opts.linkStore != nil {
+			linksPerStep, err := loadLinksFromStore(ctx, opts.linkStore, step.Name)
+			if err != nil {
+				return nil, err
+			}
+			if len(linksPerStep) < step.Threshold {
+				missing = append(missing, &ThresholdError{StepName: step.Name, Threshold: step.Threshold,
+					Available: len(linksPerStep), Verified: len(linksPerStep)})
+				continue
+			}
+			stepsMetadata[step.Name] = linksPerStep
+			continue
+		}
+
 		linksPerStep := make(map[string]Metadata)
 		// Since we can verify against certificates belonging to a CA, we need to
 		// load any possible links
@@ -644,14 +968,19 @@ func LoadLinksForLayout(layout Layout, linkDir string) (map[string]map[string]Me
 			}
 		}
 
+		// Collect all steps that lack links, instead of failing on the first
 		if len(linksPerStep) < step.Threshold {
-			return nil, fmt.Errorf("step '%s' requires '%d' link metadata file(s),"+
-				" found '%d'", step.Name, step.Threshold, len(linksPerStep))
+			missing = append(missing, &ThresholdError{StepName: step.Name, Threshold: step.Threshold,
+				Available: len(linksPerStep), Verified: len(linksPerStep)})
+			continue
 		}
 
 		stepsMetadata[step.Name] = linksPerStep
 	}
 
+	if len(missing) > 0 {
+		return nil, &MissingEvidenceError{Steps: missing}
+	}
 	return stepsMetadata, nil
 }
 
@@ -660,13 +989,28 @@ VerifyLayoutExpiration verifies that the passed Layout has not expired.  It
 returns an error if the (zulu) date in the Expires field is in the past.
 */
 func VerifyLayoutExpiration(layout Layout) error {
+	return VerifyLayoutExpirationWithTolerance(layout, 0)
+}
+
+/*
+VerifyLayoutExpirationWithTolerance behaves like VerifyLayoutExpiration, but
+considers the layout unexpired, if it expired less than the passed tolerance
+ago.  This allows to relax expiration checks, e.g. in development
+environments.
+*/
+func VerifyLayoutExpirationWithTolerance(layout Layout, tolerance time.Duration) error {
+	return verifyLayoutExpiration(layout, time.Now(), tolerance)
+}
+
+// verifyLayoutExpiration implements VerifyLayoutExpirationWithTolerance,
+// verifying the expiration of the passed layout at the passed time.
+func verifyLayoutExpiration(layout Layout, now time.Time, tolerance time.Duration) error {
 	expires, err := time.Parse(ISO8601DateSchema, layout.Expires)
 	if err != nil {
 		return err
 	}
-	// Uses timezone of expires, i.e. UTC
-	if time.Until(expires) < 0 {
-		return fmt.Errorf("layout has expired on '%s'", expires)
+	if now.After(expires.Add(tolerance)) {
+		return fmt.Errorf("%w on '%s'", ErrLayoutExpired, expires)
 	}
 	return nil
 }
@@ -680,12 +1024,20 @@ passed keys, or a matching signature is invalid, an error is returned.
 */
 func VerifyLayoutSignatures(layoutEnv Metadata,
 	layoutKeys map[string]Key) error {
+	return verifyLayoutSignatures(layoutEnv, layoutKeys, newSignableMemo(), loggerFromContext(context.Background()))
+}
+
+// verifyLayoutSignatures implements VerifyLayoutSignatures, canonicalizing the
+// layout with the passed memo, and logging to the passed Logger.
+func verifyLayoutSignatures(layoutEnv Metadata, layoutKeys map[string]Key, memo *signableMemo, log Logger) error {
 	if len(layoutKeys) < 1 {
 		return fmt.Errorf("layout verification requires at least one key")
 	}
 
 	for _, key := range layoutKeys {
-		if err := layoutEnv.VerifySignature(key); err != nil {
+		err := memo.verifySignature(layoutEnv, key)
+		logDebug(log, "verified layout signature", "keyid", key.KeyID, "error", err)
+		if err != nil {
 			return err
 		}
 	}
@@ -735,11 +1087,28 @@ func GetSummaryLink(layout Layout, stepsMetadataReduced map[string]Metadata,
 /*
 VerifySublayouts checks if any step in the supply chain is a sublayout, and if
 so, recursively resolves it and replaces it with a summary link summarizing the
-steps carried out in the sublayout.
+steps carried out in the sublayout.  Each sublayout is verified in its own
+namespace, i.e. with the links in the sublayout link directory of the step and
+signer, see SublayoutLinkDirFormat, and without parameters.
 */
 func VerifySublayouts(layout Layout,
 	stepsMetadataVerified map[string]map[string]Metadata,
 	superLayoutLinkPath string, intermediatePems [][]byte, lineNormalization bool) (map[string]map[string]Metadata, error) {
+	return verifySublayouts(context.Background(), layout, stepsMetadataVerified, superLayoutLinkPath,
+		intermediatePems, lineNormalization, verifyOptions{})
+}
+
+/*
+verifySublayouts implements VerifySublayouts.  The sublayouts are verified
+with the passed options of the super layout verification, e.g. the same
+fetcher, denylist and expiry tolerance, so that a delegated supply chain is
+held to the same standard.  Only evidence is not collected for sublayouts.
+*/
+func verifySublayouts(ctx context.Context, layout Layout,
+	stepsMetadataVerified map[string]map[string]Metadata,
+	superLayoutLinkPath string, intermediatePems [][]byte, lineNormalization bool,
+	opts verifyOptions) (map[string]map[string]Metadata, error) {
+	opts.evidence = nil
 	for stepName, linkData := range stepsMetadataVerified {
 		for keyID, metadata := range linkData {
 			if _, ok := metadata.GetPayload().(Layout); ok {
@@ -750,10 +1119,17 @@ func VerifySublayouts(layout Layout,
 					stepName, keyID)
 				sublayoutLinkPath := filepath.Join(superLayoutLinkPath,
 					sublayoutLinkDir)
-				summaryLink, err := InTotoVerify(metadata, layoutKeys,
-					sublayoutLinkPath, stepName, make(map[string]string), intermediatePems, lineNormalization)
+				sublayoutOpts := opts
+				if store, ok := opts.linkStore.(SublayoutLinkStore); ok {
+					sublayoutOpts.linkStore = store.Sublayout(stepName, keyID)
+				} else {
+					sublayoutOpts.linkStore = nil
+				}
+				summaryLink, err := inTotoVerify(ctx, metadata, layoutKeys,
+					sublayoutLinkPath, stepName, make(map[string]string), intermediatePems, lineNormalization,
+					sublayoutOpts)
 				if err != nil {
-					return nil, err
+					return nil, fmt.Errorf("sublayout of step '%s' signed by '%s': %w", stepName, keyID, err)
 				}
 				linkData[keyID] = summaryLink
 			}
@@ -783,6 +1159,29 @@ func substituteParametersInSliceOfSlices(replacer *strings.Replacer,
 	return newSlice
 }
 
+/*
+newParameterReplacer validates the names of the passed parameters and returns
+a replacer that substitutes each '{<name>}' marker with the corresponding
+value.
+*/
+func newParameterReplacer(parameterDictionary map[string]string) (*strings.Replacer, error) {
+	parameters := make([]string, 0)
+
+	re := regexp.MustCompile("^[a-zA-Z0-9_-]+$")
+
+	for parameter, value := range parameterDictionary {
+		parameterFormatCheck := re.MatchString(parameter)
+		if !parameterFormatCheck {
+			return nil, fmt.Errorf("invalid format for parameter")
+		}
+
+		parameters = append(parameters, "{"+parameter+"}")
+		parameters = append(parameters, value)
+	}
+
+	return strings.NewReplacer(parameters...), nil
+}
+
 /*
 SubstituteParameters performs parameter substitution in steps and inspections
 in the following fields:
@@ -800,22 +1199,15 @@ func SubstituteParameters(layout Layout,
 		return layout, nil
 	}
 
-	parameters := make([]string, 0)
-
-	re := regexp.MustCompile("^[a-zA-Z0-9_-]+$")
-
-	for parameter, value := range parameterDictionary {
-		parameterFormatCheck := re.MatchString(parameter)
-		if !parameterFormatCheck {
-			return layout, fmt.Errorf("invalid format for parameter")
-		}
-
-		parameters = append(parameters, "{"+parameter+"}")
-		parameters = append(parameters, value)
+	replacer, err := newParameterReplacer(parameterDictionary)
+	if err != nil {
+		return layout, err
 	}
 
-	replacer := strings.NewReplacer(parameters...)
-
+	// Substitute in copies, the passed layout shares its steps and
+	// inspections, e.g. with the signed layout of a Metablock
+	layout.Steps = append([]Step{}, layout.Steps...)
+	layout.Inspect = append([]Inspection{}, layout.Inspect...)
 	for i := range layout.Steps {
 		layout.Steps[i].ExpectedMaterials = substituteParametersInSliceOfSlices(
 			replacer, layout.Steps[i].ExpectedMaterials)
@@ -823,6 +1215,11 @@ func SubstituteParameters(layout Layout,
 			replacer, layout.Steps[i].ExpectedProducts)
 		layout.Steps[i].ExpectedCommand = substituteParamatersInSlice(replacer,
 			layout.Steps[i].ExpectedCommand)
+		if git := layout.Steps[i].Git; git != nil {
+			g := *git
+			g.Revision = replacer.Replace(git.Revision)
+			layout.Steps[i].Git = &g
+		}
 	}
 
 	for i := range layout.Inspect {
@@ -871,9 +1268,127 @@ and "delete" are currently not supported.
 func InTotoVerify(layoutEnv Metadata, layoutKeys map[string]Key,
 	linkDir string, stepName string, parameterDictionary map[string]string, intermediatePems [][]byte, lineNormalization bool) (
 	Metadata, error) {
+	return InTotoVerifyContext(context.Background(), layoutEnv, layoutKeys, linkDir, stepName,
+		parameterDictionary, intermediatePems, lineNormalization)
+}
+
+/*
+InTotoVerifyContext behaves like InTotoVerify, but aborts the verification
+when the passed context is done, e.g. when a CI job is cancelled.  Running
+inspection commands are killed, and hashing of their materials and products
+stops.
+*/
+func InTotoVerifyContext(ctx context.Context, layoutEnv Metadata, layoutKeys map[string]Key,
+	linkDir string, stepName string, parameterDictionary map[string]string, intermediatePems [][]byte, lineNormalization bool) (
+	Metadata, error) {
+	return inTotoVerify(ctx, layoutEnv, layoutKeys, linkDir, stepName,
+		parameterDictionary, intermediatePems, lineNormalization, verifyOptions{})
+}
+
+/*
+InTotoVerifyWithFetcher behaves like InTotoVerify, but fetches sublayouts that
+steps reference by URI with the passed fetcher, e.g. to fetch them from a
+private registry, see SublayoutReference.  Fetched sublayouts are verified
+against the digest pinned in the referencing layout before they are verified
+recursively.  If fetcher is nil, a URIFetcher is used.
+*/
+func InTotoVerifyWithFetcher(layoutEnv Metadata, layoutKeys map[string]Key,
+	linkDir string, stepName string, parameterDictionary map[string]string, intermediatePems [][]byte, lineNormalization bool,
+	fetcher Fetcher) (Metadata, error) {
+	return inTotoVerify(context.Background(), layoutEnv, layoutKeys, linkDir, stepName,
+		parameterDictionary, intermediatePems, lineNormalization, verifyOptions{fetcher: fetcher})
+}
+
+/*
+InTotoVerifyWithLinkStore behaves like InTotoVerify, but loads the links of
+the steps of the layout from the passed link store instead of a link
+directory, e.g. from object storage or a metadata service.  The links of
+sublayouts are loaded from the store, too, if it implements
+SublayoutLinkStore, and from the current working directory otherwise.
+*/
+func InTotoVerifyWithLinkStore(layoutEnv Metadata, layoutKeys map[string]Key,
+	store LinkStore, stepName string, parameterDictionary map[string]string, intermediatePems [][]byte,
+	lineNormalization bool) (Metadata, error) {
+	return inTotoVerify(context.Background(), layoutEnv, layoutKeys, "", stepName,
+		parameterDictionary, intermediatePems, lineNormalization, verifyOptions{linkStore: store})
+}
+
+/*
+verifyOptions holds optional settings of inTotoVerify.
+
+  - inspection constrains how inspections are run, e.g. in which directory,
+    see InspectionOptions.
+  - expiryTolerance is the duration for which an expired layout is still
+    considered unexpired.
+  - clockSkew is the tolerated difference between the clocks of signers and
+    the verifier.  It extends the expiry tolerance of the layout, and the
+    validity windows of certificates of link signers at both ends.
+  - now is the time the layout expiration and certificates are verified at.
+    If zero, the current time is used.
+  - evidence, if not nil, is populated with the evidence gathered during
+    verification.
+  - denylist, if not nil, lists revoked links, which are ignored.
+  - fetcher, if not nil, fetches sublayouts referenced by URI, see
+    loadLinksForLayout.
+  - gitDir is the git repository of git objects referenced by steps, see
+    GitReference.  If empty, the current working directory is used.
+  - linkStore, if not nil, provides the links of steps instead of the link
+    directory, see LinkStore.
+  - timestampVerifiers, if not empty, require link signatures to carry a
+    timestamp that passes verification with one of them, see
+    WithTimestampVerifiers.
+  - previous, if not nil, is the evidence of a previous verification, whose
+    results are reused for unchanged steps, see
+    WithPreviousEvidence.
+  - signables memoizes the canonicalization of the layout and links, it is
+    created by inTotoVerify if nil, and shared with sublayouts, see
+    signableMemo.
+*/
+type verifyOptions struct {
+	inspection      InspectionOptions
+	expiryTolerance time.Duration
+	clockSkew       time.Duration
+	now             time.Time
+	evidence        *VerificationEvidence
+	denylist        *Denylist
+	fetcher         Fetcher
+	gitDir          string
+	linkStore       LinkStore
+	previous        *VerificationEvidence
+	// timestampVerifiers verify the timestamps of link signatures
+	timestampVerifiers []TimestampVerifier
+	signables          *signableMemo
+	// contentTypeHooks are called for the artifacts of the step links by
+	// content type, see WithContentTypeHook
+	contentTypeHooks []contentTypeHook
+	// strictCommandAlignment fails verification on command misalignment and
+	// checkLinkNames on links reporting another step name, see Verify
+	strictCommandAlignment bool
+	checkLinkNames         bool
+}
+
+/*
+inTotoVerify implements the verification routine of InTotoVerify and its
+variants, see verifyOptions.
+*/
+func inTotoVerify(ctx context.Context, layoutEnv Metadata, layoutKeys map[string]Key,
+	linkDir string, stepName string, parameterDictionary map[string]string,
+	intermediatePems [][]byte, lineNormalization bool, opts verifyOptions) (
+	summaryLink Metadata, err error) {
+	ctx, span := startSpan(ctx, "in_toto.InTotoVerify")
+	defer func() { endSpan(span, err) }()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if opts.signables == nil {
+		opts.signables = newSignableMemo()
+	}
 
 	// Verify root signatures
-	if err := VerifyLayoutSignatures(layoutEnv, layoutKeys); err != nil {
+	_, stage := startStage(ctx, "in_toto.VerifyLayoutSignatures", "")
+	err = verifyLayoutSignatures(layoutEnv, layoutKeys, opts.signables, loggerFromContext(ctx))
+	stage.end(err)
+	if err != nil {
 		return nil, err
 	}
 
@@ -889,12 +1404,22 @@ func InTotoVerify(layoutEnv Metadata, layoutKeys map[string]Key,
 	}
 
 	// Verify layout expiration
-	if err := VerifyLayoutExpiration(layout); err != nil {
-		return nil, err
+	now := opts.now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	if err := verifyLayoutExpiration(layout, now, opts.expiryTolerance+opts.clockSkew); err != nil {
+		return nil, locateInMetadata(layoutEnv, atPointer(err, []interface{}{"expires"}, ""))
 	}
 
 	// Substitute parameters in layout
-	layout, err := SubstituteParameters(layout, parameterDictionary)
+	layout, err = SubstituteParameters(layout, parameterDictionary)
+	if err != nil {
+		return nil, err
+	}
+
+	// Authorize the keys of functionary roles for the steps of the roles
+	layout, err = ResolveRoles(layout)
 	if err != nil {
 		return nil, err
 	}
@@ -905,31 +1430,78 @@ func InTotoVerify(layoutEnv Metadata, layoutKeys map[string]Key,
 	}
 
 	// Load links for layout
-	stepsMetadata, err := LoadLinksForLayout(layout, linkDir)
+	_, stage = startStage(ctx, "in_toto.LoadLinksForLayout", "")
+	stepsMetadata, err := loadLinksForLayout(ctx, layout, linkDir, opts)
+	stage.end(err)
 	if err != nil {
 		return nil, err
 	}
 
+	// Ignore revoked links
+	if opts.denylist != nil {
+		stepsMetadata, err = removeRevokedLinks(stepsMetadata, opts.denylist, opts.signables)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Verify link signatures
-	stepsMetadataVerified, err := VerifyLinkSignatureThesholds(layout,
-		stepsMetadata, rootCertPool, intermediateCertPool)
+	_, stage = startStage(ctx, "in_toto.VerifyLinkSignatureThesholds", "")
+	var timestamps *linkTimestamps
+	if len(opts.timestampVerifiers) > 0 {
+		// The expiration was parsed when verifying it above
+		expires, _ := time.Parse(ISO8601DateSchema, layout.Expires)
+		timestamps = &linkTimestamps{
+			verifiers:       opts.timestampVerifiers,
+			now:             now,
+			expires:         expires,
+			expiryTolerance: opts.expiryTolerance,
+			clockSkew:       opts.clockSkew,
+		}
+	}
+	stepsMetadataVerified, err := verifyLinkSignatureThresholds(layout,
+		stepsMetadata, rootCertPool, intermediateCertPool, now, opts.clockSkew, opts.signables, timestamps,
+		loggerFromContext(ctx))
+	stage.end(err)
 	if err != nil {
 		return nil, err
 	}
 
+	// Only links that count towards the thresholds must report their step
+	// name, unsigned or unauthorized files in the link directory are ignored
+	if opts.checkLinkNames {
+		if err := verifyLinkNames(layout, stepsMetadataVerified); err != nil {
+			return nil, err
+		}
+	}
+
 	// Verify and resolve sublayouts
-	stepsSublayoutVerified, err := VerifySublayouts(layout,
-		stepsMetadataVerified, linkDir, intermediatePems, lineNormalization)
+	sublayoutsCtx, stage := startStage(ctx, "in_toto.VerifySublayouts", "")
+	stepsSublayoutVerified, err := verifySublayouts(sublayoutsCtx, layout,
+		stepsMetadataVerified, linkDir, intermediatePems, lineNormalization, opts)
+	stage.end(err)
 	if err != nil {
 		return nil, err
 	}
 
-	// Verify command alignment (WARNING only)
+	// Verify command alignment (WARNING only, unless strict)
 	VerifyStepCommandAlignment(layout, stepsSublayoutVerified)
+	if opts.strictCommandAlignment {
+		if err := verifyStepCommandAlignmentStrict(layout, stepsSublayoutVerified); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := verifyContentTypes(layout, stepsSublayoutVerified, opts.contentTypeHooks); err != nil {
+		return nil, err
+	}
+	if err := verifyToolchains(layout, stepsSublayoutVerified); err != nil {
+		return nil, err
+	}
 
 	// Given that signature thresholds have been checked above and the rest of
 	// the relevant link properties, i.e. materials and products, have to be
-	// exactly equal, we can reduce the map of steps metadata. However, we error
+	// equal, see ReduceStepsMetadata, we can reduce the map of steps metadata. However, we error
 	// if the relevant properties are not equal among links of a step.
 	stepsMetadataReduced, err := ReduceStepsMetadata(layout,
 		stepsSublayoutVerified)
@@ -937,13 +1509,35 @@ func InTotoVerify(layoutEnv Metadata, layoutKeys map[string]Key,
 		return nil, err
 	}
 
+	// Only items affected by changes since a previous verification are
+	// verified again
+	reused, err := opts.previous.reusableItems(layout, stepsMetadataReduced, opts.signables)
+	if err != nil {
+		return nil, err
+	}
+	var onConsume func(itemName string, srcType string, rule []string, consumed Set)
+	if opts.evidence != nil {
+		opts.evidence.init(layout, stepsMetadataVerified, opts.signables)
+		opts.evidence.reuse(opts.previous, reused)
+		onConsume = opts.evidence.recordConsumption
+	}
+
 	// Verify artifact rules
-	if err = VerifyArtifacts(layout.stepsAsInterfaceSlice(),
-		stepsMetadataReduced); err != nil {
+	matcher, err := newArtifactMatcher(layout)
+	if err != nil {
+		return nil, err
+	}
+	if err = verifyArtifacts(ctx, layout.stepsAsInterfaceSlice(),
+		stepsMetadataReduced, matcher, reused, onConsume); err != nil {
+		return nil, locateInMetadata(layoutEnv, err)
+	}
+	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
 
-	inspectionMetadata, err := RunInspections(layout, "", lineNormalization, useDSSE)
+	inspectionsCtx, stage := startStage(ctx, "in_toto.RunInspections", "")
+	inspectionMetadata, err := runInspections(inspectionsCtx, layout, stepsMetadataReduced, lineNormalization, useDSSE, opts.inspection)
+	stage.end(err)
 	if err != nil {
 		return nil, err
 	}
@@ -954,17 +1548,15 @@ func InTotoVerify(layoutEnv Metadata, layoutKeys map[string]Key,
 		inspectionMetadata[k] = v
 	}
 
-	if err = VerifyArtifacts(layout.inspectAsInterfaceSlice(),
-		inspectionMetadata); err != nil {
-		return nil, err
+	if err = verifyArtifacts(ctx, layout.inspectAsInterfaceSlice(),
+		inspectionMetadata, matcher, reused, onConsume); err != nil {
+		return nil, locateInMetadata(layoutEnv, err)
 	}
-
-	summaryLink, err := GetSummaryLink(layout, stepsMetadataReduced, stepName, useDSSE)
-	if err != nil {
-		return nil, err
+	if opts.evidence != nil {
+		opts.evidence.itemsMetadata = inspectionMetadata
 	}
 
-	return summaryLink, nil
+	return GetSummaryLink(layout, stepsMetadataReduced, stepName, useDSSE)
 }
 
 /*
@@ -1012,97 +1604,6 @@ func InTotoVerifyWithDirectory(layoutEnv Metadata, layoutKeys map[string]Key,
 		return nil, err
 	}
 
-	// Verify root signatures
-	if err := VerifyLayoutSignatures(layoutEnv, layoutKeys); err != nil {
-		return nil, err
-	}
-
-	useDSSE := false
-	if _, ok := layoutEnv.(*Envelope); ok {
-		useDSSE = true
-	}
-
-	// Extract the layout from its Metadata container (for further processing)
-	layout, ok := layoutEnv.GetPayload().(Layout)
-	if !ok {
-		return nil, ErrNotLayout
-	}
-
-	// Verify layout expiration
-	if err := VerifyLayoutExpiration(layout); err != nil {
-		return nil, err
-	}
-
-	// Substitute parameters in layout
-	layout, err = SubstituteParameters(layout, parameterDictionary)
-	if err != nil {
-		return nil, err
-	}
-
-	rootCertPool, intermediateCertPool, err := LoadLayoutCertificates(layout, intermediatePems)
-	if err != nil {
-		return nil, err
-	}
-
-	// Load links for layout
-	stepsMetadata, err := LoadLinksForLayout(layout, linkDir)
-	if err != nil {
-		return nil, err
-	}
-
-	// Verify link signatures
-	stepsMetadataVerified, err := VerifyLinkSignatureThesholds(layout,
-		stepsMetadata, rootCertPool, intermediateCertPool)
-	if err != nil {
-		return nil, err
-	}
-
-	// Verify and resolve sublayouts
-	stepsSublayoutVerified, err := VerifySublayouts(layout,
-		stepsMetadataVerified, linkDir, intermediatePems, lineNormalization)
-	if err != nil {
-		return nil, err
-	}
-
-	// Verify command alignment (WARNING only)
-	VerifyStepCommandAlignment(layout, stepsSublayoutVerified)
-
-	// Given that signature thresholds have been checked above and the rest of
-	// the relevant link properties, i.e. materials and products, have to be
-	// exactly equal, we can reduce the map of steps metadata. However, we error
-	// if the relevant properties are not equal among links of a step.
-	stepsMetadataReduced, err := ReduceStepsMetadata(layout,
-		stepsSublayoutVerified)
-	if err != nil {
-		return nil, err
-	}
-
-	// Verify artifact rules
-	if err = VerifyArtifacts(layout.stepsAsInterfaceSlice(),
-		stepsMetadataReduced); err != nil {
-		return nil, err
-	}
-
-	inspectionMetadata, err := RunInspections(layout, runDir, lineNormalization, useDSSE)
-	if err != nil {
-		return nil, err
-	}
-
-	// Add steps metadata to inspection metadata, because inspection artifact
-	// rules may also refer to artifacts reported by step links
-	for k, v := range stepsMetadataReduced {
-		inspectionMetadata[k] = v
-	}
-
-	if err = VerifyArtifacts(layout.inspectAsInterfaceSlice(),
-		inspectionMetadata); err != nil {
-		return nil, err
-	}
-
-	summaryLink, err := GetSummaryLink(layout, stepsMetadataReduced, stepName, useDSSE)
-	if err != nil {
-		return nil, err
-	}
-
-	return summaryLink, nil
+	return inTotoVerify(context.Background(), layoutEnv, layoutKeys, linkDir, stepName,
+		parameterDictionary, intermediatePems, lineNormalization, verifyOptions{inspection: InspectionOptions{Dir: runDir}})
 }
@@ -2,8 +2,10 @@ package in_toto
 
 import (
 	"bytes"
+	"context"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"errors"
 	"fmt"
 	"os"
 	"path"
@@ -153,6 +155,59 @@ func TestGetSummaryLink(t *testing.T) {
 	}
 }
 
+func TestInTotoVerifySublayoutOptions(t *testing.T) {
+	var key Key
+	if err := key.LoadKeyDefaults("alice"); err != nil {
+		t.Fatal(err)
+	}
+	layoutKeys := map[string]Key{key.KeyID: key}
+
+	superLayoutMb, err := LoadMetadata("super.layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	layout := superLayoutMb.GetPayload().(Layout)
+	layout.Expires = time.Now().Add(time.Hour).UTC().Format(ISO8601DateSchema)
+	layoutMb := &Metablock{Signed: layout}
+	if err := layoutMb.Sign(key); err != nil {
+		t.Fatal(err)
+	}
+
+	linkDir := t.TempDir()
+	sublayoutLinkDir := filepath.Join(linkDir, fmt.Sprintf(SublayoutLinkDirFormat, "sub_layout", key.KeyID))
+	if err := os.Mkdir(sublayoutLinkDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link("sub_layout.70ca5750.link", filepath.Join(linkDir, "sub_layout.70ca5750.link")); err != nil {
+		t.Fatal(err)
+	}
+	for _, link := range []string{"write-code.b7d643de.link", "package.d3ffd108.link"} {
+		if err := os.Link(link, filepath.Join(sublayoutLinkDir, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	summary, err := InTotoVerify(layoutMb, layoutKeys, linkDir, "", nil, nil, testOSisWindows())
+	if assert.Nil(t, err) {
+		assert.Contains(t, summary.GetPayload().(Link).Products, "foo.tar.gz")
+	}
+
+	// Links revoked by the denylist are also ignored in the sublayout namespace
+	writeCodeMb, err := LoadMetadata("write-code.b7d643de.link")
+	if err != nil {
+		t.Fatal(err)
+	}
+	denylist := &Denylist{Type: "denylist"}
+	if err := denylist.Revoke(writeCodeMb, "compromised"); err != nil {
+		t.Fatal(err)
+	}
+	_, err = InTotoVerifyWithDenylist(layoutMb, layoutKeys, linkDir, "", nil, nil, testOSisWindows(), denylist)
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "sublayout of step 'sub_layout'")
+		assert.Contains(t, err.Error(), "step 'write-code' requires '1' link metadata file(s)")
+	}
+}
+
 func TestVerifySublayouts(t *testing.T) {
 	sublayoutName := "sub_layout"
 	var aliceKey Key
@@ -237,8 +292,15 @@ func TestRunInspections(t *testing.T) {
 		},
 	}
 
-	// Make a list of files in current dir (all must be recorded as artifacts)
-	availableFiles, _ := filepath.Glob("*")
+	// Make a list of files in current dir (all must be recorded as artifacts,
+	// except for the lock file of dumping links)
+	var availableFiles []string
+	files, _ := filepath.Glob("*")
+	for _, file := range files {
+		if file != metadataDirLockName {
+			availableFiles = append(availableFiles, file)
+		}
+	}
 	result, err := RunInspections(layout, "", testOSisWindows(), false)
 
 	// Error must be nil
@@ -303,6 +365,8 @@ func TestRunInspections(t *testing.T) {
 	if result != nil || err == nil {
 		t.Errorf("RunInspections returned '(%s, %s)', expected"+
 			" '(nil, *exec.Error)'", result, err)
+	} else {
+		assert.Contains(t, err.Error(), "returned a non-zero value: 1")
 	}
 }
 
@@ -584,63 +648,63 @@ func TestVerifyArtifact(t *testing.T) {
 func TestVerifyMatchRule(t *testing.T) {
 	var testCases = []struct {
 		name        string
-		rule        map[string]string
+		rule        ArtifactRule
 		srcArtifact map[string]HashObj
 		item        map[string]Metadata
 		expectSet   Set
 	}{
 		{
 			name:        "Can't find destination link (invalid rule)",
-			rule:        map[string]string{},
+			rule:        ArtifactRule{},
 			srcArtifact: map[string]HashObj{},
 			item:        map[string]Metadata{},
 			expectSet:   NewSet(),
 		},
 		{
 			name:        "Can't find destination link (empty metadata map)",
-			rule:        map[string]string{"pattern": "*", "dstName": "foo", "dstType": "materials"},
+			rule:        ArtifactRule{Pattern: "*", DstName: "foo", DstType: "materials"},
 			srcArtifact: map[string]HashObj{"foo.py": {"sha265": "abc"}},
 			item:        map[string]Metadata{},
 			expectSet:   NewSet(),
 		},
 		{
 			name:        "Match material foo.py",
-			rule:        map[string]string{"pattern": "*", "dstName": "foo", "dstType": "materials"},
+			rule:        ArtifactRule{Pattern: "*", DstName: "foo", DstType: "materials"},
 			srcArtifact: map[string]HashObj{"foo.py": {"sha265": "abc"}},
 			item:        map[string]Metadata{"foo": &Metablock{Signed: Link{Name: "foo", Materials: map[string]HashObj{"foo.py": {"sha265": "abc"}}}}},
 			expectSet:   NewSet("foo.py"),
 		},
 		{
 			name:        "Match material foo.py with foo.d/foo.py",
-			rule:        map[string]string{"pattern": "*", "dstName": "foo", "dstType": "materials", "dstPrefix": "foo.d"},
+			rule:        ArtifactRule{Pattern: "*", DstName: "foo", DstType: "materials", DstPrefix: "foo.d"},
 			srcArtifact: map[string]HashObj{"foo.py": {"sha265": "abc"}},
 			item:        map[string]Metadata{"foo": &Metablock{Signed: Link{Name: "foo", Materials: map[string]HashObj{"foo.d/foo.py": HashObj{"sha265": "abc"}}}}},
 			expectSet:   NewSet("foo.py"),
 		},
 		{
 			name:        "Match material foo.d/foo.py with foo.py",
-			rule:        map[string]string{"pattern": "*", "dstName": "foo", "dstType": "materials", "srcPrefix": "foo.d"},
+			rule:        ArtifactRule{Pattern: "*", DstName: "foo", DstType: "materials", SrcPrefix: "foo.d"},
 			srcArtifact: map[string]HashObj{"foo.d/foo.py": {"sha265": "abc"}},
 			item:        map[string]Metadata{"foo": &Metablock{Signed: Link{Name: "foo", Materials: map[string]HashObj{"foo.py": HashObj{"sha265": "abc"}}}}},
 			expectSet:   NewSet("foo.d/foo.py"),
 		},
 		{
 			name:        "Don't match material (different name)",
-			rule:        map[string]string{"pattern": "*", "dstName": "foo", "dstType": "materials"},
+			rule:        ArtifactRule{Pattern: "*", DstName: "foo", DstType: "materials"},
 			srcArtifact: map[string]HashObj{"bar.py": {"sha265": "abc"}},
 			item:        map[string]Metadata{"foo": &Metablock{Signed: Link{Name: "foo", Materials: map[string]HashObj{"foo.py": {"sha265": "abc"}}}}},
 			expectSet:   NewSet(),
 		},
 		{
 			name:        "Don't match material (different hash)",
-			rule:        map[string]string{"pattern": "*", "dstName": "foo", "dstType": "materials"},
+			rule:        ArtifactRule{Pattern: "*", DstName: "foo", DstType: "materials"},
 			srcArtifact: map[string]HashObj{"foo.py": {"sha265": "dead"}},
 			item:        map[string]Metadata{"foo": &Metablock{Signed: Link{Name: "foo", Materials: map[string]HashObj{"foo.py": {"sha265": "abc"}}}}},
 			expectSet:   NewSet(),
 		},
 		{
 			name:        "Match material in sub-directories dir/foo.py",
-			rule:        map[string]string{"pattern": "*", "dstName": "foo", "dstType": "materials"},
+			rule:        ArtifactRule{Pattern: "*", DstName: "foo", DstType: "materials"},
 			srcArtifact: map[string]HashObj{"bar/foo.py": {"sha265": "abc"}},
 			item:        map[string]Metadata{"foo": &Metablock{Signed: Link{Name: "foo", Materials: map[string]HashObj{"bar/foo.py": {"sha265": "abc"}}}}},
 			expectSet:   NewSet("bar/foo.py"),
@@ -650,7 +714,7 @@ func TestVerifyMatchRule(t *testing.T) {
 	for _, tt := range testCases {
 		t.Run(tt.name, func(t *testing.T) {
 			queue := NewSet(artifactsDictKeyStrings(tt.srcArtifact)...)
-			result := verifyMatchRule(tt.rule, tt.srcArtifact, queue, tt.item)
+			result := verifyMatchRule(tt.rule, tt.srcArtifact, queue, newArtifactIndex(queue, artifactMatcher{}), tt.item, artifactMatcher{}, nil)
 			if !reflect.DeepEqual(result, tt.expectSet) {
 				t.Errorf("verifyMatchRule returned '%s', expected '%s'", result, tt.expectSet)
 			}
@@ -723,6 +787,16 @@ func TestReduceStepsMetadata(t *testing.T) {
 		}
 	}
 
+	// Links recorded with different hash algorithms or path spellings agree
+	result, err = ReduceStepsMetadata(layout, map[string]map[string]Metadata{"foo": {
+		"b": &Metablock{Signed: Link{Materials: map[string]HashObj{"./foo.py": {"sha256": "abc", "sha512": "def"}}}},
+		"a": &Metablock{Signed: Link{Materials: map[string]HashObj{"foo.py": {"sha256": "ABC"}}, Products: map[string]HashObj{}}},
+	}})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]HashObj{"foo.py": {"sha256": "ABC"}}, result["foo"].GetPayload().(Link).Materials)
+	_, err = ReduceStepsMetadata(layout, stepsMetadataList[0])
+	assert.ErrorIs(t, err, ErrLinkArtifactMismatch)
+
 	// Panic due to missing link metadata for step (final product verification
 	// should gracefully error earlier)
 	defer func() {
@@ -820,6 +894,18 @@ func TestVerifyLinkSignatureThesholds(t *testing.T) {
 			t.Errorf("VerifyLinkSignatureThesholds returned (%s, %s), expected"+
 				" 'not enough distinct valid links' error.", result, err)
 		}
+		var thresholdErr *ThresholdError
+		if assert.ErrorAs(t, err, &thresholdErr) {
+			assert.Equal(t, 2, thresholdErr.Threshold)
+		}
+	}
+
+	var thresholdErr *ThresholdError
+	_, err = VerifyLinkSignatureThesholds(layout, stepsMetadata[4], x509.NewCertPool(), x509.NewCertPool())
+	assert.ErrorIs(t, err, ErrThresholdNotMet)
+	if assert.ErrorAs(t, err, &thresholdErr) {
+		assert.Equal(t, ThresholdError{StepName: "foo", Threshold: 2, Available: 2, Verified: 1, Err: thresholdErr.Err}, *thresholdErr)
+		assert.NotNil(t, thresholdErr.Err)
 	}
 
 	// Test successfully return threshold distinct valid links:
@@ -872,6 +958,55 @@ func TestLoadLinksForLayout(t *testing.T) {
 		t.Errorf("VerifyLoadLinksForLayout returned (%s, %s), expected"+
 			" 'not enough links' error.", result, err)
 	}
+
+	// Test all steps lacking links are reported at once
+	layout.Steps = append(layout.Steps,
+		Step{SupplyChainItem: SupplyChainItem{Name: "foo-ok"}, Threshold: 0},
+		Step{SupplyChainItem: SupplyChainItem{Name: "bar"}, Threshold: 1, PubKeys: []string{keyID3}})
+	_, err = LoadLinksForLayout(layout, ".")
+	var missingErr *MissingEvidenceError
+	if !errors.As(err, &missingErr) {
+		t.Fatalf("LoadLinksForLayout returned '%v', expected MissingEvidenceError", err)
+	}
+	assert.ErrorIs(t, err, ErrMissingEvidence)
+	assert.ErrorIs(t, err, ErrThresholdNotMet)
+	assert.Equal(t, []*ThresholdError{
+		{StepName: "foo", Threshold: 3, Available: 2, Verified: 2},
+		{StepName: "bar", Threshold: 1, Available: 0, Verified: 0},
+	}, missingErr.Steps)
+	assert.Equal(t, "missing evidence for 2 step(s): step 'foo' requires '3' link metadata file(s), found '2'; "+
+		"step 'bar' requires '1' link metadata file(s), found '0'", err.Error())
+}
+
+func TestVerifyArtifactsRuleViolationError(t *testing.T) {
+	items := []interface{}{Step{SupplyChainItem: SupplyChainItem{Name: "foo",
+		ExpectedProducts: [][]string{{"ALLOW", "foo.py"}, {"DISALLOW", "*"}}}}}
+	metadata := map[string]Metadata{"foo": &Metablock{Signed: Link{Name: "foo",
+		Products: map[string]HashObj{"foo.py": {"sha256": "abc"}, "bar.py": {"sha256": "abc"}}}}}
+
+	err := VerifyArtifacts(items, metadata)
+	assert.ErrorIs(t, err, ErrRuleViolation)
+	var ruleErr *RuleViolationError
+	if assert.ErrorAs(t, err, &ruleErr) {
+		assert.Equal(t, "foo", ruleErr.Step)
+		assert.Equal(t, "Step", ruleErr.ItemType)
+		assert.Equal(t, "products", ruleErr.ArtifactType)
+		assert.Equal(t, []string{"DISALLOW", "*"}, ruleErr.Rule)
+		assert.Equal(t, []string{"bar.py"}, ruleErr.Artifacts)
+	}
+	assert.Equal(t, "/steps/0/expected_products/1", ErrorPointer(err))
+
+	items = []interface{}{Inspection{SupplyChainItem: SupplyChainItem{Name: "foo",
+		ExpectedMaterials: [][]string{{"REQUIRE", "baz.py"}}}}}
+	err = VerifyArtifacts(items, metadata)
+	if assert.ErrorAs(t, err, &ruleErr) {
+		assert.Equal(t, "Inspection", ruleErr.ItemType)
+		assert.Equal(t, []string{"baz.py"}, ruleErr.Artifacts)
+	}
+
+	err = VerifyArtifacts(items, map[string]Metadata{})
+	assert.ErrorIs(t, err, ErrNoLinks)
+	assert.False(t, errors.Is(err, ErrRuleViolation))
 }
 
 func TestVerifyLayoutExpiration(t *testing.T) {
@@ -896,6 +1031,9 @@ func TestVerifyLayoutExpiration(t *testing.T) {
 		}
 	}
 
+	layout.Expires = "1970-01-01T00:00:00Z"
+	assert.ErrorIs(t, VerifyLayoutExpiration(layout), ErrLayoutExpired)
+
 	// Test not (yet) expired layout :)
 	layout.Expires = "3000-01-01T00:00:00Z"
 	err = VerifyLayoutExpiration(layout)
@@ -904,6 +1042,27 @@ func TestVerifyLayoutExpiration(t *testing.T) {
 	}
 }
 
+func TestLayoutExpirationHelpers(t *testing.T) {
+	var layout Layout
+	assert.True(t, layout.IsExpired(time.Now()), "malformed expiration dates are expired")
+
+	layout.SetExpiration(time.Hour)
+	expires, err := time.Parse(ISO8601DateSchema, layout.Expires)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.WithinDuration(t, time.Now().Add(time.Hour), expires, time.Minute)
+	assert.False(t, layout.IsExpired(time.Now()))
+	assert.True(t, layout.IsExpired(time.Now().Add(2*time.Hour)))
+	assert.Nil(t, VerifyLayoutExpiration(layout))
+
+	// Historical layouts can be verified at a past time
+	layout.Expires = "2000-01-01T00:00:00Z"
+	assert.False(t, layout.IsExpired(time.Date(1999, 12, 31, 0, 0, 0, 0, time.UTC)))
+	assert.Nil(t, verifyLayoutExpiration(layout, time.Date(1999, 12, 31, 0, 0, 0, 0, time.UTC), 0))
+	assert.ErrorContains(t, verifyLayoutExpiration(layout, time.Date(2000, 1, 2, 0, 0, 0, 0, time.UTC), 0), "has expired")
+}
+
 func TestVerifyLayoutSignatures(t *testing.T) {
 	mbLayout, err := LoadMetadata("demo.layout")
 	if err != nil {
@@ -940,6 +1099,7 @@ func TestSubstituteParamaters(t *testing.T) {
 	parameterDictionary := map[string]string{
 		"EDITOR":       "vim",
 		"NEW_THING":    "new_thing",
+		"REVISION":     "v1.0",
 		"SOURCE_STEP":  "source_step",
 		"SOURCE_THING": "source_thing",
 		"UNTAR":        "tar",
@@ -967,6 +1127,7 @@ func TestSubstituteParamaters(t *testing.T) {
 					ExpectedProducts: [][]string{{"CREATE", "{NEW_THING}"}},
 				},
 				ExpectedCommand: []string{"{EDITOR}"},
+				Git:             &GitReference{Revision: "{REVISION}"},
 			},
 		},
 	}
@@ -1016,6 +1177,20 @@ func TestSubstituteParamaters(t *testing.T) {
 			"got %s", newLayout.Inspect[0].ExpectedMaterials[0][5])
 	}
 
+	if newLayout.Steps[0].Git.Revision != "v1.0" {
+		t.Errorf("parameter substitution failed - expected 'v1.0', got %s",
+			newLayout.Steps[0].Git.Revision)
+	}
+
+	// The passed layout is not modified
+	assert.Equal(t, []string{"{EDITOR}"}, layout.Steps[0].ExpectedCommand)
+	assert.Equal(t, "{NEW_THING}", layout.Steps[0].ExpectedProducts[0][1])
+	assert.Equal(t, "{SOURCE_THING}", layout.Steps[0].ExpectedMaterials[0][1])
+	assert.Equal(t, "{REVISION}", layout.Steps[0].Git.Revision)
+	assert.Equal(t, "{UNTAR}", layout.Inspect[0].Run[0])
+	assert.Equal(t, "{NEW_THING}", layout.Inspect[0].ExpectedProducts[0][1])
+	assert.Equal(t, "{SOURCE_THING}", layout.Inspect[0].ExpectedMaterials[0][1])
+
 	parameterDictionary = map[string]string{
 		"invalid$": "some_replacement",
 	}
@@ -1101,3 +1276,125 @@ func TestLoadLayoutCertificates(t *testing.T) {
 	_, _, err = LoadLayoutCertificates(testLayout, [][]byte{[]byte("123123123")})
 	assert.NotNil(t, err, "expected error with invalid extra intermediates")
 }
+
+func TestVerifyArtifactsCaseInsensitive(t *testing.T) {
+	digest := HashObj{"sha256": "52947cb78b91ad01fe81cd6aef42d1f6817e92b9e6936c1e5aabb7c98514f355"}
+	items := []interface{}{
+		Step{SupplyChainItem: SupplyChainItem{
+			Name:              "build",
+			ExpectedMaterials: [][]string{{"REQUIRE", "src/main.go"}, {"MATCH", "*.go", "IN", "src", "WITH", "PRODUCTS", "IN", "SRC", "FROM", "checkout"}, {"DISALLOW", "*"}},
+			ExpectedProducts:  [][]string{{"CREATE", "*.TAR.GZ"}, {"ALLOW", "src/*"}, {"DISALLOW", "*"}},
+		}},
+	}
+	itemsMetadata := map[string]Metadata{
+		"build": &Metablock{Signed: Link{
+			Name:      "build",
+			Materials: map[string]HashObj{"Src/Main.go": digest},
+			Products:  map[string]HashObj{"Src/Main.go": digest, "foo.tar.gz": digest},
+		}},
+		"checkout": &Metablock{Signed: Link{
+			Name:     "checkout",
+			Products: map[string]HashObj{"SRC/MAIN.GO": digest},
+		}},
+	}
+
+	assert.Nil(t, verifyArtifacts(context.Background(), items, itemsMetadata, artifactMatcher{caseInsensitive: true}, nil, nil))
+	// Rules are matched case-sensitively by default
+	assert.NotNil(t, verifyArtifacts(context.Background(), items, itemsMetadata, artifactMatcher{}, nil, nil))
+	// The error locates the failing rule
+	err := VerifyArtifacts(items, itemsMetadata)
+	assert.Equal(t, "/steps/0/expected_materials/0", ErrorPointer(err))
+}
+
+func TestVerifyArtifactsAbsent(t *testing.T) {
+	digest := HashObj{"sha256": "52947cb78b91ad01fe81cd6aef42d1f6817e92b9e6936c1e5aabb7c98514f355"}
+	items := []interface{}{
+		Step{SupplyChainItem: SupplyChainItem{
+			Name:              "build",
+			ExpectedMaterials: [][]string{{"ABSENT", "*.key"}, {"ALLOW", "*"}},
+			ExpectedProducts:  [][]string{{"CREATE", "app"}, {"ABSENT", "*.pem"}, {"DISALLOW", "*"}},
+		}},
+	}
+	build := func(materials, products map[string]HashObj, absentProducts ...string) map[string]Metadata {
+		return map[string]Metadata{"build": &Metablock{Signed: Link{
+			Name:           "build",
+			Materials:      materials,
+			Products:       products,
+			AbsentProducts: absentProducts,
+		}}}
+	}
+
+	assert.Nil(t, verifyArtifacts(context.Background(), items,
+		build(map[string]HashObj{"main.go": digest}, map[string]HashObj{"app": digest}, "*.pem"), artifactMatcher{}, nil, nil))
+
+	// Products must be asserted absent by the link
+	err := VerifyArtifacts(items, build(map[string]HashObj{}, map[string]HashObj{"app": digest}))
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "does not assert")
+		assert.Equal(t, "/steps/0/expected_products/1", ErrorPointer(err))
+	}
+
+	// Matching artifacts fail, even if consumed by a previous rule
+	err = VerifyArtifacts(items, build(map[string]HashObj{}, map[string]HashObj{"app": digest, "tls.pem": digest}, "*.pem"))
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "asserted absent")
+		assert.Equal(t, "/steps/0/expected_products/1", ErrorPointer(err))
+	}
+	items[0] = Step{SupplyChainItem: SupplyChainItem{
+		Name:             "build",
+		ExpectedProducts: [][]string{{"ALLOW", "*"}, {"ABSENT", "*.pem"}},
+	}}
+	assert.NotNil(t, VerifyArtifacts(items, build(map[string]HashObj{}, map[string]HashObj{"tls.pem": digest}, "*.pem")))
+
+	// Materials only must not match
+	items[0] = Step{SupplyChainItem: SupplyChainItem{
+		Name:              "build",
+		ExpectedMaterials: [][]string{{"ABSENT", "*.key"}},
+	}}
+	err = VerifyArtifacts(items, build(map[string]HashObj{"signing.key": digest}, map[string]HashObj{}))
+	assert.Equal(t, "/steps/0/expected_materials/0", ErrorPointer(err))
+}
+
+func TestValidateLayoutArtifactMatching(t *testing.T) {
+	layout := Layout{
+		Type:    "layout",
+		Expires: "2030-01-01T00:00:00Z",
+	}
+	for _, mode := range []string{"", ArtifactMatchingCaseSensitive, ArtifactMatchingCaseInsensitive} {
+		layout.ArtifactMatching = mode
+		assert.Nil(t, validateLayout(layout), mode)
+	}
+	assert.Equal(t, ArtifactMatchingCaseInsensitive, layout.GetArtifactMatching())
+	layout.ArtifactMatching = ""
+	assert.Equal(t, ArtifactMatchingCaseSensitive, layout.GetArtifactMatching())
+
+	layout.ArtifactMatching = "fuzzy"
+	assert.NotNil(t, validateLayout(layout))
+}
+
+func TestInTotoVerifyContext(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := GenerateTestVectors(dir, []byte("context")); err != nil {
+		t.Fatal(err)
+	}
+	var ownerKey Key
+	if err := ownerKey.LoadKeyDefaults(filepath.Join(dir, "keys", "owner.pub")); err != nil {
+		t.Fatal(err)
+	}
+	layoutKeys := map[string]Key{ownerKey.KeyID: ownerKey}
+	linkDir := filepath.Join(dir, "valid")
+	layoutEnv, err := LoadMetadata(filepath.Join(linkDir, RootLayoutName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = InTotoVerifyContext(context.Background(), layoutEnv, layoutKeys, linkDir, "", nil, nil, false)
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = InTotoVerifyContext(ctx, layoutEnv, layoutKeys, linkDir, "", nil, nil, false)
+	assert.ErrorIs(t, err, context.Canceled)
+	_, err = VerifyContext(ctx, layoutEnv, layoutKeys, linkDir)
+	assert.ErrorIs(t, err, context.Canceled)
+}